@@ -0,0 +1,235 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// DefaultOperationClass is the operation class of statements that are
+// executed with a context without an operation class.
+const DefaultOperationClass = "default"
+
+type operationClassKey struct{}
+
+// WithOperationClass returns a context that assigns the given operation class
+// to all statements that are executed with the context. The
+// AdmissionController of the dialector uses the class to decide whether and
+// when a statement may be executed.
+//
+// Example:
+//
+//	ctx := spannergorm.WithOperationClass(context.Background(), "background")
+//	db.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&Event{})
+func WithOperationClass(ctx context.Context, class string) context.Context {
+	return context.WithValue(ctx, operationClassKey{}, class)
+}
+
+// OperationClass returns the operation class of the given context, or
+// DefaultOperationClass if the context has no operation class.
+func OperationClass(ctx context.Context) string {
+	if ctx != nil {
+		if class, ok := ctx.Value(operationClassKey{}).(string); ok {
+			return class
+		}
+	}
+	return DefaultOperationClass
+}
+
+// AdmissionController decides whether and when a statement may be executed.
+// Set Config.AdmissionController to throttle statements, for example to
+// prevent background jobs from using capacity that is needed for user-facing
+// traffic.
+type AdmissionController interface {
+	// Admit is called before each statement that is executed by gorm. It
+	// blocks until the statement may be executed, or returns an error if the
+	// statement is rejected. The statement is not executed if Admit returns an
+	// error, and the error is returned to the caller.
+	Admit(ctx context.Context, class string) error
+}
+
+// AdmissionRejectedError is returned for statements that are rejected by a
+// TokenBucketAdmissionController.
+type AdmissionRejectedError struct {
+	// Class is the operation class of the statement.
+	Class string
+	// Wait is the time that the statement would have had to wait before it
+	// could be executed.
+	Wait time.Duration
+}
+
+func (e *AdmissionRejectedError) Error() string {
+	return fmt.Sprintf("statement of operation class %q rejected by admission control: wait time %v exceeds the maximum", e.Class, e.Wait)
+}
+
+// TokenBucketLimit is the limit of one operation class of a
+// TokenBucketAdmissionController.
+type TokenBucketLimit struct {
+	// Rate is the number of statements per second that may be executed.
+	Rate float64
+	// Burst is the number of statements that may be executed at once.
+	Burst int
+	// MaxWait is the maximum time that a statement waits until it may be
+	// executed. Statements that would have to wait longer are rejected with
+	// an *AdmissionRejectedError. Statements wait until their context is done
+	// if MaxWait is zero.
+	MaxWait time.Duration
+}
+
+// AdmissionStats contains the number of statements of one operation class
+// that have been admitted, throttled and rejected by a
+// TokenBucketAdmissionController.
+type AdmissionStats struct {
+	// Admitted is the number of statements that were executed without waiting.
+	Admitted int64
+	// Throttled is the number of statements that were executed after waiting.
+	Throttled int64
+	// Rejected is the number of statements that were not executed.
+	Rejected int64
+	// WaitTime is the total time that throttled statements have waited.
+	WaitTime time.Duration
+}
+
+// TokenBucketAdmissionController is an AdmissionController that uses a token
+// bucket per operation class. Statements of operation classes without a limit
+// are always admitted.
+//
+// Example:
+//
+//	controller := spannergorm.NewTokenBucketAdmissionController(map[string]spannergorm.TokenBucketLimit{
+//	  "background": {Rate: 50, Burst: 10, MaxWait: 5 * time.Second},
+//	})
+//	db, err := gorm.Open(spannergorm.New(spannergorm.Config{
+//	  DSN:                 "projects/my-project/instances/my-instance/databases/my-database",
+//	  AdmissionController: controller,
+//	}), &gorm.Config{})
+type TokenBucketAdmissionController struct {
+	classes map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	limiter *rate.Limiter
+	maxWait time.Duration
+
+	mu    sync.Mutex
+	stats AdmissionStats
+}
+
+// NewTokenBucketAdmissionController returns an AdmissionController with the
+// given limits per operation class.
+func NewTokenBucketAdmissionController(limits map[string]TokenBucketLimit) *TokenBucketAdmissionController {
+	classes := make(map[string]*tokenBucket, len(limits))
+	for class, limit := range limits {
+		classes[class] = &tokenBucket{
+			limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst),
+			maxWait: limit.MaxWait,
+		}
+	}
+	return &TokenBucketAdmissionController{classes: classes}
+}
+
+// Admit implements AdmissionController.
+func (c *TokenBucketAdmissionController) Admit(ctx context.Context, class string) error {
+	bucket, ok := c.classes[class]
+	if !ok {
+		return nil
+	}
+	reservation := bucket.limiter.Reserve()
+	if !reservation.OK() {
+		bucket.record(func(stats *AdmissionStats) { stats.Rejected++ })
+		return &AdmissionRejectedError{Class: class, Wait: rate.InfDuration}
+	}
+	wait := reservation.Delay()
+	if wait == 0 {
+		bucket.record(func(stats *AdmissionStats) { stats.Admitted++ })
+		return nil
+	}
+	if bucket.maxWait > 0 && wait > bucket.maxWait {
+		reservation.Cancel()
+		bucket.record(func(stats *AdmissionStats) { stats.Rejected++ })
+		return &AdmissionRejectedError{Class: class, Wait: wait}
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		bucket.record(func(stats *AdmissionStats) {
+			stats.Throttled++
+			stats.WaitTime += wait
+		})
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		bucket.record(func(stats *AdmissionStats) { stats.Rejected++ })
+		return ctx.Err()
+	}
+}
+
+// Stats returns the statistics of all operation classes with a limit.
+func (c *TokenBucketAdmissionController) Stats() map[string]AdmissionStats {
+	result := make(map[string]AdmissionStats, len(c.classes))
+	for class, bucket := range c.classes {
+		bucket.mu.Lock()
+		result[class] = bucket.stats
+		bucket.mu.Unlock()
+	}
+	return result
+}
+
+func (b *tokenBucket) record(f func(stats *AdmissionStats)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f(&b.stats)
+}
+
+// registerAdmissionControl registers callbacks that call the admission
+// controller before any other callback for each type of statement. This
+// ensures that statements wait before a transaction is started for them.
+func registerAdmissionControl(db *gorm.DB, controller AdmissionController) error {
+	admit := func(db *gorm.DB) {
+		if db.Error != nil || db.DryRun {
+			return
+		}
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := controller.Admit(ctx, OperationClass(ctx)); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+	if err := db.Callback().Create().Before("*").Register("gorm:spanner:admission", admit); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("*").Register("gorm:spanner:admission", admit); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("*").Register("gorm:spanner:admission", admit); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("*").Register("gorm:spanner:admission", admit); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("*").Register("gorm:spanner:admission", admit); err != nil {
+		return err
+	}
+	return db.Callback().Raw().Before("*").Register("gorm:spanner:admission", admit)
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+func TestAdmissionControl(t *testing.T) {
+	t.Parallel()
+
+	controller := NewTokenBucketAdmissionController(map[string]TokenBucketLimit{
+		"background": {Rate: 0.001, Burst: 1, MaxWait: 10 * time.Millisecond},
+	})
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{AdmissionController: controller})
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+	countQueries := func() int {
+		count := 0
+		for _, req := range requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+			if req.(*spannerpb.ExecuteSqlRequest).Sql == querySql {
+				count++
+			}
+		}
+		return count
+	}
+
+	ctx := WithOperationClass(context.Background(), "background")
+	var singers []singerWithCommitTimestamp
+	if err := db.WithContext(ctx).Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	// The second query exceeds the rate of the background class.
+	err := db.WithContext(ctx).Find(&singers).Error
+	var rejected *AdmissionRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, rejected)
+	}
+	if g, w := rejected.Class, "background"; g != w {
+		t.Fatalf("class mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := countQueries(), 1; g != w {
+		t.Fatalf("query count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Statements without an operation class are not limited.
+	for i := 0; i < 3; i++ {
+		if err := db.Find(&singers).Error; err != nil {
+			t.Fatalf("failed to execute query: %v", err)
+		}
+	}
+	if g, w := countQueries(), 3; g != w {
+		t.Fatalf("query count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := controller.Stats(), map[string]AdmissionStats{"background": {Admitted: 1, Rejected: 1}}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("stats mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestTokenBucketAdmissionControllerThrottles(t *testing.T) {
+	t.Parallel()
+
+	controller := NewTokenBucketAdmissionController(map[string]TokenBucketLimit{
+		"background": {Rate: 50, Burst: 1},
+	})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := controller.Admit(ctx, "background"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := controller.Stats()["background"]
+	if g, w := stats.Admitted, int64(1); g != w {
+		t.Fatalf("admitted mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := stats.Throttled, int64(2); g != w {
+		t.Fatalf("throttled mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if stats.WaitTime <= 0 {
+		t.Fatalf("missing wait time: %v", stats.WaitTime)
+	}
+
+	// Waiting stops when the context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := controller.Admit(ctx, "background"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Aggregate is a call to an aggregate function on a column. Use it as an
+// argument for Select to add Spanner-specific aggregate functions to a query.
+//
+// Example:
+//
+//	db.Model(&Album{}).
+//	  Select("singer_id, ?, ?", spannergorm.AnyValue("title").As("title"), spannergorm.ApproxCountDistinct("genre")).
+//	  Group("singer_id").
+//	  Scan(&results)
+//	// SELECT singer_id, ANY_VALUE(`title`) AS `title`, APPROX_COUNT_DISTINCT(`genre`) FROM `albums` GROUP BY `singer_id`
+type Aggregate struct {
+	Function string
+	Column   clause.Column
+	// Args are added as additional arguments after the column.
+	Args  []interface{}
+	Alias string
+}
+
+// As returns a copy of the aggregate with the given alias.
+func (a Aggregate) As(alias string) Aggregate {
+	a.Alias = alias
+	return a
+}
+
+func (a Aggregate) Build(builder clause.Builder) {
+	builder.WriteString(a.Function)
+	builder.WriteByte('(')
+	builder.WriteQuoted(a.Column)
+	for _, arg := range a.Args {
+		builder.WriteString(", ")
+		builder.AddVar(builder, arg)
+	}
+	builder.WriteByte(')')
+	if a.Alias != "" {
+		builder.WriteString(" AS ")
+		builder.WriteQuoted(a.Alias)
+	}
+}
+
+// AnyValue returns ANY_VALUE(column). It returns the value of the column for
+// any row in the group.
+func AnyValue(column string) Aggregate {
+	return Aggregate{Function: "ANY_VALUE", Column: clause.Column{Name: column}}
+}
+
+// ApproxCountDistinct returns APPROX_COUNT_DISTINCT(column). It returns the
+// approximate number of distinct values in the column, and is more efficient
+// than COUNT(DISTINCT column).
+func ApproxCountDistinct(column string) Aggregate {
+	return Aggregate{Function: "APPROX_COUNT_DISTINCT", Column: clause.Column{Name: column}}
+}
+
+// ArrayAgg returns ARRAY_AGG(column). It returns an array of all values of the
+// column in the group.
+func ArrayAgg(column string) Aggregate {
+	return Aggregate{Function: "ARRAY_AGG", Column: clause.Column{Name: column}}
+}
+
+// StringAgg returns STRING_AGG(column, delimiter). It returns the values of
+// the column in the group concatenated with the given delimiter.
+func StringAgg(column string, delimiter string) Aggregate {
+	return Aggregate{Function: "STRING_AGG", Column: clause.Column{Name: column}, Args: []interface{}{delimiter}}
+}
+
+// LogicalAnd returns LOGICAL_AND(column). It returns true if the column is
+// true for all rows in the group.
+func LogicalAnd(column string) Aggregate {
+	return Aggregate{Function: "LOGICAL_AND", Column: clause.Column{Name: column}}
+}
+
+// LogicalOr returns LOGICAL_OR(column). It returns true if the column is
+// true for at least one row in the group.
+func LogicalOr(column string) Aggregate {
+	return Aggregate{Function: "LOGICAL_OR", Column: clause.Column{Name: column}}
+}
+
+// Rollup is a GROUP BY ROLLUP clause. Use GroupByRollup to create a Rollup.
+type Rollup struct {
+	Columns []string
+}
+
+// GroupByRollup groups the result of a query by the given columns, and adds
+// subtotal rows for each prefix of the columns and a grand total row.
+//
+// Example:
+//
+//	db.Model(&Album{}).
+//	  Select("singer_id, release_year, SUM(sales) AS sales").
+//	  Clauses(spannergorm.GroupByRollup("singer_id", "release_year")).
+//	  Scan(&results)
+//	// SELECT singer_id, release_year, SUM(sales) AS sales FROM `albums` GROUP BY ROLLUP(`singer_id`,`release_year`)
+func GroupByRollup(columns ...string) Rollup {
+	return Rollup{Columns: columns}
+}
+
+// ModifyStatement implements gorm.StatementModifier.
+func (rollup Rollup) ModifyStatement(stmt *gorm.Statement) {
+	quoted := make([]string, len(rollup.Columns))
+	for i, column := range rollup.Columns {
+		quoted[i] = stmt.Quote(column)
+	}
+	stmt.AddClause(clause.GroupBy{
+		Columns: []clause.Column{{Name: "ROLLUP(" + strings.Join(quoted, ",") + ")", Raw: true}},
+	})
+}
+
+// Build implements clause.Expression. The clause is added to the statement by
+// ModifyStatement, so Build does not write anything.
+func (rollup Rollup) Build(clause.Builder) {}
@@ -0,0 +1,55 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestAggregates(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	var results []map[string]interface{}
+	stmt := db.Session(&gorm.Session{DryRun: true}).
+		Model(&album{}).
+		Select("singer_id, ?, ?, ?", AnyValue("title").As("title"), ApproxCountDistinct("genre"), StringAgg("title", ", ")).
+		Group("singer_id").
+		Find(&results).Statement
+	if g, w := stmt.SQL.String(), "SELECT singer_id, ANY_VALUE(`title`) AS `title`, APPROX_COUNT_DISTINCT(`genre`), STRING_AGG(`title`, ?) FROM `albums` WHERE `albums`.`deleted_at` IS NULL GROUP BY `singer_id`"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(stmt.Vars), 1; g != w {
+		t.Fatalf("var count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestGroupByRollup(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	var results []map[string]interface{}
+	stmt := db.Session(&gorm.Session{DryRun: true}).
+		Model(&album{}).
+		Select("singer_id, title, COUNT(*) AS c").
+		Clauses(GroupByRollup("singer_id", "title")).
+		Having("COUNT(*) > ?", 1).
+		Find(&results).Statement
+	if g, w := stmt.SQL.String(), "SELECT singer_id, title, COUNT(*) AS c FROM `albums` WHERE `albums`.`deleted_at` IS NULL GROUP BY ROLLUP(`singer_id`,`title`) HAVING COUNT(*) > ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+)
+
+// ArrayElement is the set of element types that are supported by Array. Use
+// one of the spanner.Null* types for arrays that can contain NULL elements.
+type ArrayElement interface {
+	string | int64 | float64 | float32 | bool | time.Time | civil.Date | []byte |
+		spanner.NullString | spanner.NullInt64 | spanner.NullFloat64 | spanner.NullFloat32 | spanner.NullBool |
+		spanner.NullTime | spanner.NullDate | spanner.NullNumeric | spanner.NullJSON
+}
+
+// Array can be used for fields that are mapped to an ARRAY column. Use it as
+// the type for a field in a model. The migrator creates an ARRAY column with
+// the element type that corresponds with T, e.g. ARRAY<STRING(MAX)> for
+// Array[string] and ARRAY<INT64> for Array[int64].
+//
+// A nil Array is written as NULL, and an empty Array is written as an empty
+// array. Arrays that contain NULL elements can only be read into an Array
+// with one of the spanner.Null* types as element type, such as
+// Array[spanner.NullString].
+//
+// Example:
+//
+//	type Singer struct {
+//	  ID        int64
+//	  Name      string
+//	  Nicknames spannergorm.Array[string]
+//	  Ratings   spannergorm.Array[spanner.NullInt64]
+//	}
+type Array[T ArrayElement] []T
+
+// StringArray is an Array of STRING values.
+type StringArray = Array[string]
+
+// Int64Array is an Array of INT64 values.
+type Int64Array = Array[int64]
+
+// Float64Array is an Array of FLOAT64 values.
+type Float64Array = Array[float64]
+
+// BoolArray is an Array of BOOL values.
+type BoolArray = Array[bool]
+
+// GormDataType implements gorm.GormDataTypeInterface.
+func (a Array[T]) GormDataType() string {
+	var element T
+	switch any(element).(type) {
+	case string, spanner.NullString:
+		return "ARRAY<STRING(MAX)>"
+	case int64, spanner.NullInt64:
+		return "ARRAY<INT64>"
+	case float64, spanner.NullFloat64:
+		return "ARRAY<FLOAT64>"
+	case float32, spanner.NullFloat32:
+		return "ARRAY<FLOAT32>"
+	case bool, spanner.NullBool:
+		return "ARRAY<BOOL>"
+	case time.Time, spanner.NullTime:
+		return "ARRAY<TIMESTAMP>"
+	case civil.Date, spanner.NullDate:
+		return "ARRAY<DATE>"
+	case []byte:
+		return "ARRAY<BYTES(MAX)>"
+	case spanner.NullNumeric:
+		return "ARRAY<NUMERIC>"
+	case spanner.NullJSON:
+		return "ARRAY<JSON>"
+	}
+	return ""
+}
+
+// Value implements the driver.Valuer interface.
+func (a Array[T]) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return []T(a), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (a *Array[T]) Scan(src interface{}) error {
+	if src == nil {
+		*a = nil
+		return nil
+	}
+	// Arrays with one of the spanner.Null* types as element type and BYTES
+	// arrays are returned by the driver with the same element type.
+	if values, ok := src.([]T); ok {
+		*a = values
+		return nil
+	}
+	values, err := arrayElements(src)
+	if err != nil {
+		return err
+	}
+	result := make(Array[T], len(values))
+	for i, value := range values {
+		if value == nil {
+			return fmt.Errorf("cannot scan an array with NULL elements into %T, use an Array with a spanner.Null* element type instead", a)
+		}
+		element, ok := value.(T)
+		if !ok {
+			return fmt.Errorf("cannot scan an array with elements of type %T into %T", value, a)
+		}
+		result[i] = element
+	}
+	*a = result
+	return nil
+}
+
+// arrayElements returns the elements of an array that was returned by the
+// driver, with nil for NULL elements.
+func arrayElements(src interface{}) ([]interface{}, error) {
+	var values []interface{}
+	switch v := src.(type) {
+	case []spanner.NullString:
+		for _, e := range v {
+			values = append(values, nullableElement(e.Valid, e.StringVal))
+		}
+	case []spanner.NullInt64:
+		for _, e := range v {
+			values = append(values, nullableElement(e.Valid, e.Int64))
+		}
+	case []spanner.NullFloat64:
+		for _, e := range v {
+			values = append(values, nullableElement(e.Valid, e.Float64))
+		}
+	case []spanner.NullFloat32:
+		for _, e := range v {
+			values = append(values, nullableElement(e.Valid, e.Float32))
+		}
+	case []spanner.NullBool:
+		for _, e := range v {
+			values = append(values, nullableElement(e.Valid, e.Bool))
+		}
+	case []spanner.NullTime:
+		for _, e := range v {
+			values = append(values, nullableElement(e.Valid, e.Time))
+		}
+	case []spanner.NullDate:
+		for _, e := range v {
+			values = append(values, nullableElement(e.Valid, e.Date))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported array type: %T", src)
+	}
+	return values, nil
+}
+
+func nullableElement(valid bool, value interface{}) interface{} {
+	if !valid {
+		return nil
+	}
+	return value
+}
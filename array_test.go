@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/migrator"
+)
+
+type arrayRecord struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	Tags      StringArray
+	Ratings   Array[spanner.NullInt64]
+	Checksums Array[[]byte]
+}
+
+func TestArrayDataTypes(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&arrayRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string]string{
+		"Tags":      "ARRAY<STRING(MAX)>",
+		"Ratings":   "ARRAY<INT64>",
+		"Checksums": "ARRAY<BYTES(MAX)>",
+	} {
+		if g, w := db.Dialector.DataTypeOf(stmt.Schema.LookUpField(field)), want; g != w {
+			t.Errorf("%s: data type mismatch\n Got: %v\nWant: %v", field, g, w)
+		}
+	}
+}
+
+func TestArrayCreateAndFind(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT INTO `array_records` (`id`,`tags`,`ratings`,`checksums`) VALUES (@p1,@p2,@p3,@p4)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	record := arrayRecord{
+		ID:        1,
+		Tags:      StringArray{"a", "b"},
+		Ratings:   Array[spanner.NullInt64]{{Int64: 5, Valid: true}, {}},
+		Checksums: Array[[]byte]{},
+	}
+	if err := db.Create(&record).Error; err != nil {
+		t.Fatalf("failed to create record: %v", err)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.Sql, insertSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.ParamTypes["p2"].GetArrayElementType().GetCode(), spannerpb.TypeCode_STRING; g != w {
+		t.Fatalf("tags element type mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(req.Params.Fields["p2"].GetListValue().GetValues()), 2; g != w {
+		t.Fatalf("tags length mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.ParamTypes["p3"].GetArrayElementType().GetCode(), spannerpb.TypeCode_INT64; g != w {
+		t.Fatalf("ratings element type mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if _, ok := req.Params.Fields["p3"].GetListValue().GetValues()[1].GetKind().(*structpb.Value_NullValue); !ok {
+		t.Fatalf("ratings element is not NULL: %v", req.Params.Fields["p3"])
+	}
+	if req.Params.Fields["p4"].GetListValue() == nil {
+		t.Fatalf("empty array was not sent as an array: %v", req.Params.Fields["p4"])
+	}
+
+	querySql := "SELECT * FROM `array_records` WHERE `array_records`.`id` = @p1 ORDER BY `array_records`.`id` LIMIT @p2"
+	arrayType := func(code spannerpb.TypeCode) *spannerpb.Type {
+		return &spannerpb.Type{Code: spannerpb.TypeCode_ARRAY, ArrayElementType: &spannerpb.Type{Code: code}}
+	}
+	list := func(values ...*structpb.Value) *structpb.Value {
+		return structpb.NewListValue(&structpb.ListValue{Values: values})
+	}
+	_ = server.TestSpanner.PutStatementResult(querySql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+				{Name: "id", Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}},
+				{Name: "tags", Type: arrayType(spannerpb.TypeCode_STRING)},
+				{Name: "ratings", Type: arrayType(spannerpb.TypeCode_INT64)},
+				{Name: "checksums", Type: arrayType(spannerpb.TypeCode_BYTES)},
+			}}},
+			Rows: []*structpb.ListValue{{Values: []*structpb.Value{
+				structpb.NewStringValue("1"),
+				list(structpb.NewStringValue("a"), structpb.NewStringValue("b")),
+				list(structpb.NewStringValue("5"), structpb.NewNullValue()),
+				structpb.NewNullValue(),
+			}}},
+		},
+	})
+	var found arrayRecord
+	if err := db.First(&found, 1).Error; err != nil {
+		t.Fatalf("failed to find record: %v", err)
+	}
+	if g, w := found.Tags, (StringArray{"a", "b"}); !reflect.DeepEqual(g, w) {
+		t.Fatalf("tags mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := found.Ratings, (Array[spanner.NullInt64]{{Int64: 5, Valid: true}, {}}); !reflect.DeepEqual(g, w) {
+		t.Fatalf("ratings mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if found.Checksums != nil {
+		t.Fatalf("checksums mismatch\n Got: %v\nWant: nil", found.Checksums)
+	}
+}
+
+func TestArrayScan(t *testing.T) {
+	t.Parallel()
+
+	var ids Int64Array
+	if err := ids.Scan([]spanner.NullInt64{{Int64: 1, Valid: true}, {Int64: 2, Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := ids, (Int64Array{1, 2}); !reflect.DeepEqual(g, w) {
+		t.Fatalf("ids mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// NULL elements can only be scanned into arrays of spanner.Null* types.
+	if err := ids.Scan([]spanner.NullInt64{{}}); err == nil {
+		t.Fatal("missing expected error for NULL element")
+	}
+	// The element type of the array must match the column type.
+	var names StringArray
+	if err := names.Scan([]spanner.NullInt64{{Int64: 1, Valid: true}}); err == nil {
+		t.Fatal("missing expected error for element type mismatch")
+	}
+}
+
+func TestArrayMigrateColumn(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&arrayRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	m := db.Migrator()
+	// ColumnTypes returns ARRAY<STRING(MAX)> columns as ARRAY<STRING>, which
+	// must not be altered.
+	if err := m.MigrateColumn(&arrayRecord{}, stmt.Schema.LookUpField("Tags"), migrator.ColumnType{
+		NameValue:     sql.NullString{String: "tags", Valid: true},
+		DataTypeValue: sql.NullString{String: "ARRAY<STRING>", Valid: true},
+		NullableValue: sql.NullBool{Bool: true, Valid: true},
+		SQLColumnType: &sql.ColumnType{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
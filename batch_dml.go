@@ -0,0 +1,145 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"strings"
+
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+)
+
+type batchDMLKey struct{}
+
+// WithBatchDML returns a context that enables automatic batching of DML
+// statements for read/write transactions that are started with the context.
+// Consecutive INSERT, UPDATE and DELETE statements in such a transaction are
+// buffered, and are sent to Spanner as one batch of DML statements when the
+// transaction executes a query or any other statement, or when the
+// transaction is committed. This reduces the number of round trips for
+// operations that generate many DML statements, such as CreateInBatches.
+//
+// The number of affected rows of a buffered statement is not known when the
+// statement is executed, which means that gorm reports zero affected rows for
+// these statements. Errors that are returned by a statement in the batch are
+// returned by the next query or by the commit of the transaction. DML
+// statements with a THEN RETURN clause are not buffered.
+//
+// Example:
+//
+//	ctx := spannergorm.WithBatchDML(context.Background())
+//	err := db.WithContext(ctx).CreateInBatches(singers, 100).Error
+func WithBatchDML(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batchDMLKey{}, true)
+}
+
+// batchDMLEnabled returns true if automatic batching of DML statements has
+// been enabled for the given context.
+func batchDMLEnabled(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	enabled, _ := ctx.Value(batchDMLKey{}).(bool)
+	return enabled
+}
+
+// registerBatchDMLCallbacks registers callbacks that bypass the cache of
+// prepared statements for statements that are executed in a transaction with
+// automatic batching of DML statements. Prepared statements are executed
+// directly on the underlying *sql.Tx, which means that they would skip the
+// batching of the transaction.
+func registerBatchDMLCallbacks(db *gorm.DB) error {
+	bypass := func(db *gorm.DB) {
+		switch p := db.Statement.ConnPool.(type) {
+		case *gorm.PreparedStmtDB:
+			if batchDMLEnabled(db.Statement.Context) {
+				db.Statement.ConnPool = p.ConnPool
+			}
+		case *gorm.PreparedStmtTX:
+			if t, ok := unwrapConnPool(p).(*connTx); ok && t.batchDML {
+				db.Statement.ConnPool = p.Tx
+			}
+		}
+	}
+	if err := db.Callback().Create().Before("*").Register("gorm:spanner:batch_dml", bypass); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("*").Register("gorm:spanner:batch_dml", bypass); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("*").Register("gorm:spanner:batch_dml", bypass); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("*").Register("gorm:spanner:batch_dml", bypass); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("*").Register("gorm:spanner:batch_dml", bypass); err != nil {
+		return err
+	}
+	return db.Callback().Raw().Before("*").Register("gorm:spanner:batch_dml", bypass)
+}
+
+// isBatchableDML returns true if the given statement can be added to a batch
+// of DML statements.
+func isBatchableDML(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "INSERT", "UPDATE", "DELETE":
+		return !thenReturnRegExp.MatchString(query)
+	}
+	return false
+}
+
+// prepareBatch starts a batch of DML statements on the transaction if the
+// given statement can be batched, and otherwise runs the batch that is active.
+func (tx *connTx) prepareBatch(ctx context.Context, query string) error {
+	if !tx.batchDML {
+		return nil
+	}
+	if !isBatchableDML(query) {
+		return tx.runBatch(ctx)
+	}
+	if tx.inBatch {
+		return nil
+	}
+	return withSpannerConn(tx.conn, func(conn spannerdriver.SpannerConn) error {
+		// Do not start a batch if the application already started one with
+		// START BATCH DML.
+		if conn.InDMLBatch() {
+			return nil
+		}
+		if err := conn.StartBatchDML(); err != nil {
+			return err
+		}
+		tx.inBatch = true
+		return nil
+	})
+}
+
+// runBatch sends the DML statements that have been buffered by the
+// transaction to Spanner.
+func (tx *connTx) runBatch(ctx context.Context) error {
+	if !tx.inBatch {
+		return nil
+	}
+	tx.inBatch = false
+	return withSpannerConn(tx.conn, func(conn spannerdriver.SpannerConn) error {
+		return conn.RunBatch(ctx)
+	})
+}
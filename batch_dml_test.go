@@ -0,0 +1,180 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+type batchedSinger struct {
+	ID   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name string
+}
+
+func TestWithBatchDMLCreateInBatches(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT INTO `batched_singers` (`id`,`name`) VALUES (@p1,@p2),(@p3,@p4)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 2,
+	})
+	singers := []batchedSinger{{1, "One"}, {2, "Two"}, {3, "Three"}, {4, "Four"}, {5, "Five"}, {6, "Six"}}
+	ctx := WithBatchDML(context.Background())
+	if err := db.WithContext(ctx).CreateInBatches(singers, 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	for _, req := range requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		if g, w := req.(*spannerpb.ExecuteSqlRequest).Sql, insertSql; g == w {
+			t.Fatalf("insert statement was executed outside of a batch")
+		}
+	}
+	batchReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteBatchDmlRequest{}))
+	if g, w := len(batchReqs), 1; g != w {
+		t.Fatalf("batch request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	batchReq := batchReqs[0].(*spannerpb.ExecuteBatchDmlRequest)
+	if g, w := len(batchReq.Statements), 3; g != w {
+		t.Fatalf("statement count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, stmt := range batchReq.Statements {
+		if g, w := stmt.Sql, insertSql; g != w {
+			t.Fatalf("%d: sql mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWithBatchDMLQueryRunsBatch(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT INTO `batched_singers` (`id`,`name`) VALUES (@p1,@p2)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	querySql := "SELECT * FROM `batched_singers`"
+	_ = server.TestSpanner.PutStatementResult(querySql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+				{Name: "id", Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}},
+				{Name: "name", Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}},
+			}}},
+		},
+	})
+	ctx := WithBatchDML(context.Background())
+	if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&batchedSinger{ID: 1, Name: "One"}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&batchedSinger{ID: 2, Name: "Two"}).Error; err != nil {
+			return err
+		}
+		var singers []batchedSinger
+		if err := tx.Find(&singers).Error; err != nil {
+			return err
+		}
+		return tx.Create(&batchedSinger{ID: 3, Name: "Three"}).Error
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	var types []string
+	var batchSizes []int
+	for _, req := range reqs {
+		switch r := req.(type) {
+		case *spannerpb.ExecuteBatchDmlRequest:
+			types = append(types, "batch")
+			batchSizes = append(batchSizes, len(r.Statements))
+		case *spannerpb.ExecuteSqlRequest:
+			if r.Sql == querySql {
+				types = append(types, "query")
+			} else if r.Sql == insertSql {
+				types = append(types, "insert")
+			}
+		case *spannerpb.CommitRequest:
+			types = append(types, "commit")
+		}
+	}
+	if g, w := types, []string{"batch", "query", "batch", "commit"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("request types mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := batchSizes, []int{2, 1}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("batch sizes mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWithBatchDMLUpdateMany(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	updateSql := "UPDATE `batched_singers` SET `name`=@p1 WHERE `id` = @p2"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	// UpdateMany uses the batch of the transaction, also if WithBatchDML has
+	// already been set for the context.
+	singers := []batchedSinger{{1, "One"}, {2, "Two"}}
+	if err := UpdateMany(WithBatchDML(context.Background()), db, singers, "name"); err != nil {
+		t.Fatal(err)
+	}
+	batchReqs := requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.ExecuteBatchDmlRequest{}))
+	if g, w := len(batchReqs), 1; g != w {
+		t.Fatalf("batch request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(batchReqs[0].(*spannerpb.ExecuteBatchDmlRequest).Statements), 2; g != w {
+		t.Fatalf("statement count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestIsBatchableDML(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		query string
+		want  bool
+	}{
+		{"INSERT INTO singers (id) VALUES (1)", true},
+		{"update singers set name='a' where id=1", true},
+		{"DELETE FROM singers WHERE id=1 /*application='app'*/", true},
+		{"INSERT INTO singers (id) VALUES (1) THEN RETURN id", false},
+		{"SELECT * FROM singers", false},
+		{"START BATCH DML", false},
+		{"", false},
+	} {
+		if g, w := isBatchableDML(test.query), test.want; g != w {
+			t.Errorf("%q: mismatch\n Got: %v\nWant: %v", test.query, g, w)
+		}
+	}
+}
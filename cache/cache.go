@@ -0,0 +1,257 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache contains a gorm plugin that caches the results of queries.
+// This can be used for expensive queries for reference data that seldom
+// changes. Only queries that are marked with the Cached scope are cached.
+//
+// The results are by default stored in a Spanner table that uses a row
+// deletion policy to remove expired entries. Implement the Store interface to
+// store the results in a different cache, for example Memorystore.
+//
+// Example:
+//
+//	store := cache.NewSpannerStore(db)
+//	if err := store.CreateTable(); err != nil {
+//	  return err
+//	}
+//	if err := db.Use(&cache.Plugin{Store: store, TTL: 5 * time.Minute}); err != nil {
+//	  return err
+//	}
+//	var countries []Country
+//	err := db.Scopes(cache.Cached(0)).Order("name").Find(&countries).Error
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+const (
+	// DefaultTable is the name of the table that is used by a SpannerStore if
+	// no other table name is set.
+	DefaultTable = "gorm_query_cache"
+	// DefaultTTL is the time to live of cached results if no other TTL is set.
+	DefaultTTL = time.Minute
+
+	cachedKey = "gorm:spanner:cache_ttl"
+)
+
+// Store stores the serialized results of queries.
+type Store interface {
+	// Get returns the value for the given key, and whether the key was found
+	// and has not expired.
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	// Set stores the value for the given key for the given duration.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Plugin is a gorm plugin that caches the results of queries that are marked
+// with the Cached scope. Queries in transactions are never cached.
+//
+// The results are serialized with encoding/json. Fields that are not
+// serialized by encoding/json, for example fields with a `json:"-"` tag, are
+// therefore empty in cached results.
+type Plugin struct {
+	// Store is where the results are stored. The default is a SpannerStore
+	// that uses the database that the plugin is registered on.
+	Store Store
+	// TTL is the time to live of cached results for queries that do not set a
+	// TTL. The default is DefaultTTL.
+	TTL time.Duration
+}
+
+type entry struct {
+	RowsAffected int64           `json:"rowsAffected"`
+	Dest         json.RawMessage `json:"dest"`
+}
+
+// Cached marks a query as cacheable. The result of the query is returned from
+// the cache if the same query with the same parameters has been executed
+// within the given TTL. The default TTL of the plugin is used if ttl is zero.
+//
+// Example:
+//
+//	db.Scopes(cache.Cached(10 * time.Minute)).Find(&countries)
+func Cached(ttl time.Duration) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(cachedKey, ttl)
+	}
+}
+
+// Name implements gorm.Plugin.
+func (p *Plugin) Name() string {
+	return "gorm:spanner:cache"
+}
+
+// Initialize implements gorm.Plugin.
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	if p.Store == nil {
+		p.Store = NewSpannerStore(db)
+	}
+	if p.TTL <= 0 {
+		p.TTL = DefaultTTL
+	}
+	query := db.Callback().Query().Get("gorm:query")
+	if query == nil {
+		return fmt.Errorf("gorm:query callback not found")
+	}
+	return db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		p.query(db, query)
+	})
+}
+
+func (p *Plugin) query(db *gorm.DB, next func(*gorm.DB)) {
+	value, ok := db.Get(cachedKey)
+	if !ok || db.Error != nil || db.DryRun {
+		next(db)
+		return
+	}
+	if _, inTransaction := db.Statement.ConnPool.(gorm.TxCommitter); inTransaction {
+		next(db)
+		return
+	}
+	ttl, _ := value.(time.Duration)
+	if ttl <= 0 {
+		ttl = p.TTL
+	}
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+	ctx := db.Statement.Context
+	key, err := fingerprint(db.Statement)
+	if err != nil {
+		db.Logger.Warn(ctx, "query result not cached: %v", err)
+		next(db)
+		return
+	}
+
+	data, found, err := p.Store.Get(ctx, key)
+	if err != nil {
+		db.Logger.Warn(ctx, "failed to read query result from cache: %v", err)
+	} else if found {
+		var cached entry
+		if err := json.Unmarshal(data, &cached); err == nil {
+			if err := json.Unmarshal(cached.Dest, db.Statement.Dest); err == nil {
+				db.RowsAffected = cached.RowsAffected
+				if db.RowsAffected == 0 && db.Statement.RaiseErrorOnNotFound {
+					_ = db.AddError(gorm.ErrRecordNotFound)
+				}
+				return
+			}
+		}
+		db.Logger.Warn(ctx, "ignoring invalid cached query result")
+	}
+
+	next(db)
+	if db.Error != nil {
+		return
+	}
+	dest, err := json.Marshal(db.Statement.Dest)
+	if err == nil {
+		data, err = json.Marshal(&entry{RowsAffected: db.RowsAffected, Dest: dest})
+	}
+	if err == nil {
+		err = p.Store.Set(ctx, key, data, ttl)
+	}
+	if err != nil {
+		db.Logger.Warn(ctx, "failed to write query result to cache: %v", err)
+	}
+}
+
+// fingerprint returns the cache key of the query of the given statement. The
+// key is a hash of the SQL string, the query parameters and the type of the
+// destination.
+func fingerprint(stmt *gorm.Statement) (string, error) {
+	vars, err := json.Marshal(stmt.Vars)
+	if err != nil {
+		return "", fmt.Errorf("cannot serialize query parameters: %w", err)
+	}
+	hash := sha256.New()
+	hash.Write([]byte(stmt.SQL.String()))
+	hash.Write([]byte{0})
+	hash.Write(vars)
+	hash.Write([]byte{0})
+	hash.Write([]byte(fmt.Sprintf("%T", stmt.Dest)))
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// SpannerStore is a Store that stores the results in a Spanner table. The
+// table uses a row deletion policy to remove expired entries. Expired entries
+// are also ignored by Get before they have been removed.
+type SpannerStore struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewSpannerStore returns a Store that stores the results in the table
+// DefaultTable in the given database.
+func NewSpannerStore(db *gorm.DB) *SpannerStore {
+	return NewSpannerStoreWithTable(db, DefaultTable)
+}
+
+// NewSpannerStoreWithTable returns a Store that stores the results in the
+// given table in the given database.
+func NewSpannerStoreWithTable(db *gorm.DB, table string) *SpannerStore {
+	return &SpannerStore{db: db, table: table}
+}
+
+// CreateTable creates the table of the store if it does not exist.
+func (s *SpannerStore) CreateTable() error {
+	return s.session(context.Background()).Exec(fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS `%s` (`cache_key` STRING(64) NOT NULL, `value` BYTES(MAX), `expires_at` TIMESTAMP NOT NULL) "+
+			"PRIMARY KEY (`cache_key`), ROW DELETION POLICY (OLDER_THAN(`expires_at`, INTERVAL 0 DAY))", s.table)).Error
+}
+
+// Get implements Store.
+func (s *SpannerStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var value []byte
+	err := s.session(ctx).Raw(
+		fmt.Sprintf("SELECT `value` FROM `%s` WHERE `cache_key` = ? AND `expires_at` > CURRENT_TIMESTAMP()", s.table),
+		key).Row().Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set implements Store.
+func (s *SpannerStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.session(ctx).Exec(
+		fmt.Sprintf("INSERT OR UPDATE INTO `%s` (`cache_key`, `value`, `expires_at`) VALUES (?, ?, ?)", s.table),
+		key, value, time.Now().Add(ttl).UTC()).Error
+}
+
+// session returns a session that is not affected by the statement that is
+// being cached. The query and write of the store are executed outside of any
+// transaction.
+func (s *SpannerStore) session(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return s.db.Session(&gorm.Session{NewDB: true, Context: ctx, SkipDefaultTransaction: true})
+}
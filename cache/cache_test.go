@@ -0,0 +1,233 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+)
+
+type country struct {
+	ID   int64
+	Name string
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	ttls    map[string]time.Duration
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.entries[key]
+	return value, ok, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+func TestCachedQuery(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	store := newMemoryStore()
+	if err := db.Use(&Plugin{Store: store}); err != nil {
+		t.Fatal(err)
+	}
+	querySql := "SELECT * FROM `countries` WHERE name LIKE @p1"
+	_ = putCountriesResult(server, querySql)
+
+	for i := 0; i < 3; i++ {
+		var countries []country
+		if err := db.Scopes(Cached(0)).Where("name LIKE ?", "N%").Find(&countries).Error; err != nil {
+			t.Fatal(err)
+		}
+		if g, w := fmt.Sprint(countries), "[{1 Netherlands} {2 Norway}]"; g != w {
+			t.Fatalf("%d: result mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+	if g, w := countQueries(server, querySql), 1; g != w {
+		t.Fatalf("query count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(store.entries), 1; g != w {
+		t.Fatalf("cache entry count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for _, ttl := range store.ttls {
+		if g, w := ttl, DefaultTTL; g != w {
+			t.Fatalf("ttl mismatch\n Got: %v\nWant: %v", g, w)
+		}
+	}
+
+	// A query with a different parameter value is not served from the cache.
+	var countries []country
+	if err := db.Scopes(Cached(time.Hour)).Where("name LIKE ?", "No%").Find(&countries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := countQueries(server, querySql), 1; g != w {
+		t.Fatalf("query count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(store.entries), 2; g != w {
+		t.Fatalf("cache entry count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Queries without the Cached scope are always executed.
+	for i := 0; i < 2; i++ {
+		if err := db.Where("name LIKE ?", "N%").Find(&countries).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, w := countQueries(server, querySql), 2; g != w {
+		t.Fatalf("query count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestCachedQueryInTransaction(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	store := newMemoryStore()
+	if err := db.Use(&Plugin{Store: store}); err != nil {
+		t.Fatal(err)
+	}
+	querySql := "SELECT * FROM `countries`"
+	_ = putCountriesResult(server, querySql)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		var countries []country
+		return tx.Scopes(Cached(0)).Find(&countries).Error
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(store.entries), 0; g != w {
+		t.Fatalf("cache entry count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestSpannerStore(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	store := NewSpannerStoreWithTable(db, "cache")
+	getSql := "SELECT `value` FROM `cache` WHERE `cache_key` = @p1 AND `expires_at` > CURRENT_TIMESTAMP()"
+	setSql := "INSERT OR UPDATE INTO `cache` (`cache_key`, `value`, `expires_at`) VALUES (@p1, @p2, @p3)"
+	_ = server.TestSpanner.PutStatementResult(getSql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{
+				RowType: &spannerpb.StructType{
+					Fields: []*spannerpb.StructType_Field{
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_BYTES}, Name: "value"},
+					},
+				},
+			},
+		},
+	})
+	_ = server.TestSpanner.PutStatementResult(setSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+
+	_, found, err := store.Get(context.Background(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Fatal("unexpected cache hit")
+	}
+	if err := store.Set(context.Background(), "key", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := countQueries(server, setSql), 1; g != w {
+		t.Fatalf("insert count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func putCountriesResult(server *testutil.MockedSpannerInMemTestServer, sql string) error {
+	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{
+				RowType: &spannerpb.StructType{
+					Fields: []*spannerpb.StructType_Field{
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, Name: "id"},
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, Name: "name"},
+					},
+				},
+			},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{structpb.NewStringValue("1"), structpb.NewStringValue("Netherlands")}},
+				{Values: []*structpb.Value{structpb.NewStringValue("2"), structpb.NewStringValue("Norway")}},
+			},
+		},
+	})
+}
+
+// countQueries returns the number of ExecuteSqlRequests with the given SQL
+// string that have been received by the server since the last call.
+func countQueries(server *testutil.MockedSpannerInMemTestServer, sql string) int {
+	count := 0
+	for _, req := range drainRequestsFromServer(server.TestSpanner) {
+		if executeReq, ok := req.(*spannerpb.ExecuteSqlRequest); ok && executeReq.Sql == sql {
+			count++
+		}
+	}
+	return count
+}
+
+func setupTestGormConnection(t *testing.T) (db *gorm.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	server, _, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	db, err := gorm.Open(spannergorm.New(spannergorm.Config{
+		DriverName: "spanner",
+		DSN:        fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address),
+
+		DisableDialectCheck: true,
+	}), &gorm.Config{})
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	return db, server, serverTeardown
+}
+
+func drainRequestsFromServer(server testutil.InMemSpannerServer) []interface{} {
+	var reqs []interface{}
+loop:
+	for {
+		select {
+		case req := <-server.ReceivedRequests():
+			reqs = append(reqs, req)
+		default:
+			break loop
+		}
+	}
+	return reqs
+}
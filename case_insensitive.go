@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	caseInsensitiveIndexTag = "CASEINSENSITIVEINDEX"
+	// caseInsensitiveColumnSuffix is added to the name of a column with a
+	// caseInsensitiveIndex tag to get the name of its normalized column.
+	caseInsensitiveColumnSuffix = "_lower"
+)
+
+// caseInsensitiveIndex is an index on a generated column that contains the
+// lower-case value of a STRING column. Spanner does not support
+// case-insensitive collations. Add a `gorm:"caseInsensitiveIndex"` tag to a
+// string field to let the migrator create a generated column with the
+// lower-case value of the field, and an index on the generated column.
+//
+// The tag accepts an optional index name, and the option 'unique'. Example:
+//
+//	type User struct {
+//	  ID    int64
+//	  // Creates the column `email_lower STRING(MAX) AS (LOWER(email)) STORED`
+//	  // and the unique index `idx_users_email_lower` on that column.
+//	  Email string `gorm:"caseInsensitiveIndex:,unique"`
+//	}
+//
+// Use CaseInsensitiveEq to query the table with the index.
+type caseInsensitiveIndex struct {
+	field  *schema.Field
+	column string
+	name   string
+	unique bool
+}
+
+func caseInsensitiveIndexes(s *schema.Schema) []caseInsensitiveIndex {
+	if s == nil {
+		return nil
+	}
+	var indexes []caseInsensitiveIndex
+	for _, field := range s.Fields {
+		value, ok := field.TagSettings[caseInsensitiveIndexTag]
+		if !ok || field.DBName == "" || field.IgnoreMigration {
+			continue
+		}
+		index := caseInsensitiveIndex{field: field, column: field.DBName + caseInsensitiveColumnSuffix}
+		if value != caseInsensitiveIndexTag {
+			for i, option := range strings.Split(value, ",") {
+				option = strings.TrimSpace(option)
+				if i == 0 {
+					index.name = option
+				} else if strings.EqualFold(option, "unique") {
+					index.unique = true
+				}
+			}
+		}
+		if index.name == "" {
+			index.name = "idx_" + s.Table + "_" + index.column
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// caseInsensitiveColumnDefinition returns the definition of the generated
+// column of the given index.
+func (m spannerMigrator) caseInsensitiveColumnDefinition(index caseInsensitiveIndex) (string, []interface{}) {
+	return "? ? AS (LOWER(?)) STORED", []interface{}{
+		clause.Column{Name: index.column},
+		clause.Expr{SQL: m.Migrator.DataTypeOf(index.field)},
+		clause.Column{Name: index.field.DBName},
+	}
+}
+
+func (m spannerMigrator) createCaseInsensitiveIndex(tx *gorm.DB, stmt *gorm.Statement, index caseInsensitiveIndex) error {
+	createIndexSQL := "CREATE INDEX ? ON ? (?)"
+	if index.unique {
+		createIndexSQL = "CREATE UNIQUE INDEX ? ON ? (?)"
+	}
+	return tx.Exec(createIndexSQL, clause.Column{Name: qualifiedIndexName(qualifiedTableName(stmt), index.name)}, m.CurrentTable(stmt), clause.Column{Name: index.column}).Error
+}
+
+// migrateCaseInsensitiveIndexes adds the generated columns and indexes for
+// fields with a caseInsensitiveIndex tag to an existing table, if these do not
+// yet exist.
+func (m spannerMigrator) migrateCaseInsensitiveIndexes(value interface{}) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		for _, index := range caseInsensitiveIndexes(stmt.Schema) {
+			if !m.HasColumn(value, index.column) {
+				sql, vars := m.caseInsensitiveColumnDefinition(index)
+				if err := m.DB.Exec("ALTER TABLE ? ADD COLUMN "+sql, append([]interface{}{m.CurrentTable(stmt)}, vars...)...).Error; err != nil {
+					return err
+				}
+			}
+			if !m.HasIndex(value, index.name) {
+				if err := m.createCaseInsensitiveIndex(m.DB, stmt, index); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// CaseInsensitiveEq returns a condition that compares the generated lower-case
+// column of a field with a caseInsensitiveIndex tag with the given value. The
+// condition can use the index on the generated column.
+//
+// Example:
+//
+//	// SELECT * FROM `users` WHERE `email_lower` = LOWER(@p1)
+//	db.Where(spannergorm.CaseInsensitiveEq("email", "Alice@Example.com")).First(&user)
+func CaseInsensitiveEq(column string, value string) clause.Expression {
+	return clause.Expr{
+		SQL:  "? = LOWER(?)",
+		Vars: []interface{}{clause.Column{Name: column + caseInsensitiveColumnSuffix}, value},
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gorm.io/gorm"
+)
+
+type account struct {
+	ID    int64  `gorm:"primaryKey;autoIncrement:false"`
+	Email string `gorm:"caseInsensitiveIndex:,unique"`
+	Name  string `gorm:"caseInsensitiveIndex:idx_account_names"`
+}
+
+func TestCaseInsensitiveIndex(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 0)
+
+	if err := db.Migrator().AutoMigrate(&account{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE TABLE `accounts` (`id` INT64,`email` STRING(MAX),`name` STRING(MAX)," +
+			"`email_lower` STRING(MAX) AS (LOWER(`email`)) STORED,`name_lower` STRING(MAX) AS (LOWER(`name`)) STORED) " +
+			"PRIMARY KEY (`id`)",
+		"CREATE UNIQUE INDEX `idx_accounts_email_lower` ON `accounts` (`email_lower`)",
+		"CREATE INDEX `idx_account_names` ON `accounts` (`name_lower`)",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigrateCaseInsensitiveIndexesExistingTable(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasColSql := "SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = @p1 AND table_name = @p2 AND column_name = @p3"
+	hasIndexSql := "SELECT count(*) FROM information_schema.indexes WHERE table_schema = @p1 AND table_name = @p2 AND index_name = @p3"
+	_ = putCountStatementResult(server, hasColSql, 0)
+	_ = putCountStatementResult(server, hasIndexSql, 0)
+
+	m := db.Migrator().(spannerMigrator)
+	defer m.Close()
+	if err := m.migrateCaseInsensitiveIndexes(&account{}); err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	for _, request := range server.TestDatabaseAdmin.Reqs() {
+		statements = append(statements, request.(*databasepb.UpdateDatabaseDdlRequest).GetStatements()...)
+	}
+	if g, w := statements, []string{
+		"ALTER TABLE `accounts` ADD COLUMN `email_lower` STRING(MAX) AS (LOWER(`email`)) STORED",
+		"CREATE UNIQUE INDEX `idx_accounts_email_lower` ON `accounts` (`email_lower`)",
+		"ALTER TABLE `accounts` ADD COLUMN `name_lower` STRING(MAX) AS (LOWER(`name`)) STORED",
+		"CREATE INDEX `idx_account_names` ON `accounts` (`name_lower`)",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestCaseInsensitiveEq(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(CaseInsensitiveEq("email", "Alice@Example.com")).Find(&[]account{})
+	})
+	if g, w := sql, "SELECT * FROM `accounts` WHERE `email_lower` = LOWER('Alice@Example.com')"; g != w {
+		t.Fatalf("SQL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
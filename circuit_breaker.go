@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"gorm.io/gorm"
+)
+
+const circuitBreakerDoneKey = "gorm:spanner:circuit_breaker_done"
+
+// CircuitBreaker is a circuit breaker that is called for each statement that
+// is executed by gorm. The interface is compatible with two-step circuit
+// breakers such as gobreaker.TwoStepCircuitBreaker.
+type CircuitBreaker interface {
+	// Allow returns an error if the circuit breaker is open, in which case
+	// the statement is not executed. Otherwise, it returns a function that is
+	// called with the outcome of the statement once it has finished.
+	Allow() (done func(success bool), err error)
+}
+
+// CircuitOpenError is returned for statements that are not executed, because
+// the circuit breaker of the operation is open.
+type CircuitOpenError struct {
+	// Operation is the type of operation of the statement: create, query,
+	// update, delete, row or raw.
+	Operation string
+	// Err is the error that was returned by the circuit breaker.
+	Err error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s operations is open: %v", e.Operation, e.Err)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.Err
+}
+
+// IsOutageError returns true if the given error indicates that Spanner is
+// unavailable or overloaded. These are the errors that count as failures for
+// the circuit breakers in Config.CircuitBreakers. Other errors, such as
+// constraint violations and records that are not found, are caused by the
+// statement and not by an outage.
+func IsOutageError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch spanner.ErrCode(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// registerCircuitBreakers registers callbacks that ask the circuit breaker of
+// the operation for permission before any other callback, and that report the
+// outcome of the statement after all other callbacks.
+func registerCircuitBreakers(db *gorm.DB, breakers func(operation string) CircuitBreaker) error {
+	if breaker := breakers("create"); breaker != nil {
+		allow, done := circuitBreakerCallbacks("create", breaker)
+		if err := db.Callback().Create().Before("*").Register("gorm:spanner:circuit_breaker_allow", allow); err != nil {
+			return err
+		}
+		if err := db.Callback().Create().After("*").Register("gorm:spanner:circuit_breaker_done", done); err != nil {
+			return err
+		}
+	}
+	if breaker := breakers("query"); breaker != nil {
+		allow, done := circuitBreakerCallbacks("query", breaker)
+		if err := db.Callback().Query().Before("*").Register("gorm:spanner:circuit_breaker_allow", allow); err != nil {
+			return err
+		}
+		if err := db.Callback().Query().After("*").Register("gorm:spanner:circuit_breaker_done", done); err != nil {
+			return err
+		}
+	}
+	if breaker := breakers("update"); breaker != nil {
+		allow, done := circuitBreakerCallbacks("update", breaker)
+		if err := db.Callback().Update().Before("*").Register("gorm:spanner:circuit_breaker_allow", allow); err != nil {
+			return err
+		}
+		if err := db.Callback().Update().After("*").Register("gorm:spanner:circuit_breaker_done", done); err != nil {
+			return err
+		}
+	}
+	if breaker := breakers("delete"); breaker != nil {
+		allow, done := circuitBreakerCallbacks("delete", breaker)
+		if err := db.Callback().Delete().Before("*").Register("gorm:spanner:circuit_breaker_allow", allow); err != nil {
+			return err
+		}
+		if err := db.Callback().Delete().After("*").Register("gorm:spanner:circuit_breaker_done", done); err != nil {
+			return err
+		}
+	}
+	if breaker := breakers("row"); breaker != nil {
+		allow, done := circuitBreakerCallbacks("row", breaker)
+		if err := db.Callback().Row().Before("*").Register("gorm:spanner:circuit_breaker_allow", allow); err != nil {
+			return err
+		}
+		if err := db.Callback().Row().After("*").Register("gorm:spanner:circuit_breaker_done", done); err != nil {
+			return err
+		}
+	}
+	if breaker := breakers("raw"); breaker != nil {
+		allow, done := circuitBreakerCallbacks("raw", breaker)
+		if err := db.Callback().Raw().Before("*").Register("gorm:spanner:circuit_breaker_allow", allow); err != nil {
+			return err
+		}
+		if err := db.Callback().Raw().After("*").Register("gorm:spanner:circuit_breaker_done", done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// circuitBreakerCallbacks returns the callbacks that call the given circuit
+// breaker before and after a statement.
+func circuitBreakerCallbacks(operation string, breaker CircuitBreaker) (allow func(*gorm.DB), done func(*gorm.DB)) {
+	allow = func(db *gorm.DB) {
+		if db.Error != nil || db.DryRun {
+			return
+		}
+		report, err := breaker.Allow()
+		if err != nil {
+			_ = db.AddError(&CircuitOpenError{Operation: operation, Err: err})
+			return
+		}
+		db.InstanceSet(circuitBreakerDoneKey, report)
+	}
+	done = func(db *gorm.DB) {
+		value, ok := db.InstanceGet(circuitBreakerDoneKey)
+		if !ok {
+			return
+		}
+		// Clear the function, so the outcome is only reported once.
+		db.InstanceSet(circuitBreakerDoneKey, (func(bool))(nil))
+		if report, ok := value.(func(success bool)); ok && report != nil {
+			report(!IsOutageError(db.Error))
+		}
+	}
+	return allow, done
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+var errCircuitOpen = errors.New("circuit open")
+
+// testCircuitBreaker opens after the given number of consecutive failures.
+type testCircuitBreaker struct {
+	mu          sync.Mutex
+	maxFailures int
+	failures    int
+	successes   int
+}
+
+func (b *testCircuitBreaker) Allow() (func(success bool), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.maxFailures {
+		return nil, errCircuitOpen
+	}
+	return func(success bool) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if success {
+			b.successes++
+			b.failures = 0
+		} else {
+			b.failures++
+		}
+	}, nil
+}
+
+func TestCircuitBreakers(t *testing.T) {
+	t.Parallel()
+
+	queryBreaker := &testCircuitBreaker{maxFailures: 1}
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{
+		CircuitBreakers: func(operation string) CircuitBreaker {
+			if operation == "query" {
+				return queryBreaker
+			}
+			return nil
+		},
+	})
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+	var singers []singerWithCommitTimestamp
+	if err := db.Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	// The Spanner client retries Unavailable and ResourceExhausted errors, so
+	// the error is injected by a callback instead of by the mock server.
+	var injectErr error
+	if err := db.Callback().Query().After("gorm:query").Register("test:inject_error", func(db *gorm.DB) {
+		if injectErr != nil {
+			_ = db.AddError(injectErr)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Errors that are not caused by an outage count as a success.
+	injectErr = status.Error(codes.FailedPrecondition, "constraint violation")
+	if err := db.Find(&singers).Error; err == nil {
+		t.Fatal("missing expected error")
+	}
+	if g, w := queryBreaker.successes, 2; g != w {
+		t.Fatalf("success count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	injectErr = status.Error(codes.ResourceExhausted, "overloaded")
+	if err := db.Find(&singers).Error; !IsOutageError(err) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, codes.ResourceExhausted)
+	}
+	// The circuit breaker is now open, and queries fail without being sent to
+	// Spanner.
+	injectErr = nil
+	drainRequestsFromServer(server.TestSpanner)
+	err := db.Find(&singers).Error
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, openErr)
+	}
+	if g, w := openErr.Operation, "query"; g != w {
+		t.Fatalf("operation mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("error does not wrap the error of the circuit breaker: %v", err)
+	}
+	if g, w := len(drainRequestsFromServer(server.TestSpanner)), 0; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Other operations do not use the circuit breaker of queries.
+	updateSql := "UPDATE `singers` SET `name`=@p1 WHERE `id` = @p2"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	if err := db.Model(&singerWithCommitTimestamp{ID: 1}).Update("name", "test").Error; err != nil {
+		t.Fatalf("failed to execute update: %v", err)
+	}
+}
+
+func TestIsOutageError(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{status.Error(codes.Unavailable, "unavailable"), true},
+		{status.Error(codes.ResourceExhausted, "overloaded"), true},
+		{fmt.Errorf("wrapped: %w", status.Error(codes.Unavailable, "unavailable")), true},
+		{status.Error(codes.NotFound, "not found"), false},
+		{status.Error(codes.FailedPrecondition, "constraint violation"), false},
+		{errors.New("other"), false},
+	} {
+		if g, w := IsOutageError(test.err), test.want; g != w {
+			t.Errorf("%v: result mismatch\n Got: %v\nWant: %v", test.err, g, w)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"gorm.io/gorm"
+)
+
+// sharedClient is a Spanner client that is created when it is first needed,
+// and that is shared by all operations of a dialector that need direct access
+// to the Spanner client library.
+type sharedClient struct {
+	mu     sync.Mutex
+	client *spanner.Client
+	// adminClient is the database admin client that is used for DDL batches.
+	adminClient *database.DatabaseAdminClient
+	// dsn is the connection string with the credentials that were set by
+	// RotateCredentials. It is empty if the credentials have not been rotated.
+	dsn string
+	// closed is set when the connection pool of the dialector is closed. No
+	// new client is created after that.
+	closed bool
+}
+
+// close closes the clients, and prevents that new clients are created.
+func (c *sharedClient) close() {
+	c.mu.Lock()
+	client, adminClient := c.client, c.adminClient
+	c.client, c.adminClient, c.closed = nil, nil, true
+	c.mu.Unlock()
+	if client != nil {
+		client.Close()
+	}
+	if adminClient != nil {
+		_ = adminClient.Close()
+	}
+}
+
+// ErrInTransaction is returned by the functions that execute a statement with
+// the Spanner client of the dialector, such as QueryRows, FindStructs,
+// ScanTable, ExportCSV and ImportCSV, if they are called with a gorm database
+// that is a transaction. The client has its own sessions, and its statements
+// would not be part of the transaction.
+var ErrInTransaction = errors.New("spanner: the Spanner client of the dialector cannot be used in a gorm transaction")
+
+// checkNotInTransaction returns ErrInTransaction if the given gorm database is
+// a transaction.
+func checkNotInTransaction(db *gorm.DB, operation string) error {
+	pool := db.Statement.ConnPool
+	if pool == nil {
+		pool = db.ConnPool
+	}
+	switch unwrapConnPool(pool).(type) {
+	case gorm.TxCommitter, *hybridConnPool:
+		return fmt.Errorf("%s: %w", operation, ErrInTransaction)
+	}
+	return nil
+}
+
+// rotate closes the clients and sets the connection string that is used for
+// the next clients.
+func (c *sharedClient) rotate(dsn string) {
+	c.mu.Lock()
+	client, adminClient := c.client, c.adminClient
+	c.client, c.adminClient, c.dsn = nil, nil, dsn
+	c.mu.Unlock()
+	if client != nil {
+		client.Close()
+	}
+	if adminClient != nil {
+		_ = adminClient.Close()
+	}
+}
+
+// currentDSN returns the connection string of the dialector with the
+// credentials that were set by RotateCredentials.
+func (dialector Dialector) currentDSN() string {
+	if dialector.Config == nil {
+		return ""
+	}
+	if dialector.sharedClient != nil {
+		dialector.sharedClient.mu.Lock()
+		defer dialector.sharedClient.mu.Unlock()
+		if dialector.sharedClient.dsn != "" {
+			return dialector.sharedClient.dsn
+		}
+	}
+	return dialector.DSN
+}
+
+// spannerClient returns the Spanner client of the dialector. The client
+// connects to the database in the DSN of the dialector.
+func (dialector Dialector) spannerClient(ctx context.Context) (*spanner.Client, error) {
+	if dialector.Config == nil || dialector.DSN == "" {
+		return nil, fmt.Errorf("the Spanner client can only be used with a dialector that has a DSN")
+	}
+	if dialector.sharedClient == nil {
+		return nil, fmt.Errorf("the dialector has not been initialized")
+	}
+	dialector.sharedClient.mu.Lock()
+	defer dialector.sharedClient.mu.Unlock()
+	if dialector.sharedClient.closed {
+		return nil, fmt.Errorf("the Spanner client cannot be used after the database has been closed")
+	}
+	if dialector.sharedClient.client == nil {
+		dsn := dialector.DSN
+		if dialector.sharedClient.dsn != "" {
+			dsn = dialector.sharedClient.dsn
+		}
+		config, err := parseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		clientConfig := spanner.ClientConfig{SessionPoolConfig: spanner.DefaultSessionPoolConfig}
+		if dialector.SpannerClientRetryConfig != nil {
+			clientConfig.CallOptions = dialector.SpannerClientRetryConfig.callOptions()
+		}
+		client, err := spanner.NewClientWithConfig(ctx, config.databaseName(), clientConfig, config.clientOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		dialector.sharedClient.client = client
+	}
+	return dialector.sharedClient.client, nil
+}
+
+// databaseAdminClient returns the database admin client of the dialector and
+// the name of the database in the DSN of the dialector. The client is created
+// when it is first used, and is closed together with the Spanner client of the
+// dialector.
+func (dialector Dialector) databaseAdminClient(ctx context.Context) (*database.DatabaseAdminClient, string, error) {
+	if dialector.Config == nil || dialector.DSN == "" {
+		return nil, "", fmt.Errorf("the database admin client can only be used with a dialector that has a DSN")
+	}
+	if dialector.sharedClient == nil {
+		return nil, "", fmt.Errorf("the dialector has not been initialized")
+	}
+	dialector.sharedClient.mu.Lock()
+	defer dialector.sharedClient.mu.Unlock()
+	if dialector.sharedClient.closed {
+		return nil, "", fmt.Errorf("the database admin client cannot be used after the database has been closed")
+	}
+	dsn := dialector.DSN
+	if dialector.sharedClient.dsn != "" {
+		dsn = dialector.sharedClient.dsn
+	}
+	config, err := parseDSN(dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	if dialector.sharedClient.adminClient == nil {
+		client, err := database.NewDatabaseAdminClient(ctx, config.clientOptions()...)
+		if err != nil {
+			return nil, "", err
+		}
+		dialector.sharedClient.adminClient = client
+	}
+	return dialector.sharedClient.adminClient, config.databaseName(), nil
+}
+
+// SpannerClient returns the Spanner client library client that this library
+// uses for operations that are not supported by the database/sql driver, such
+// as QueryRows, ScanTable and ImportCSV. Use it for features of the client
+// library that are not available through gorm, such as reads with a key set,
+// change streams or batch writes. The client connects to the database in the
+// DSN of the dialector, and is created when it is first used. An error is
+// returned if the dialector was not created with a DSN.
+//
+// The client is shared by all operations of the dialector, and must not be
+// closed by the caller. It is closed when the connection pool that is returned
+// by db.DB() is closed, if the dialector opened that pool from its DSN. It is
+// replaced when the credentials are rotated with RotateCredentials, so call
+// SpannerClient for each use instead of keeping a reference to it.
+//
+// The client has its own sessions, and is not the client that is used by the
+// gorm connection. Operations on the client therefore never take part in a
+// gorm transaction. Reads do not see the uncommitted writes of an active gorm
+// transaction, and writes are committed independently of it. Use
+// WithSpannerConn to buffer mutations in a gorm transaction instead, or use
+// RunHybridTransaction to combine gorm operations and client library calls in
+// one transaction.
+//
+// Example:
+//
+//	client, err := spannergorm.SpannerClient(ctx, db)
+//	if err != nil {
+//	  return err
+//	}
+//	row, err := client.Single().ReadRow(ctx, "singers", spanner.Key{1}, []string{"first_name"})
+func SpannerClient(ctx context.Context, db *gorm.DB) (*spanner.Client, error) {
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return dialector.spannerClient(ctx)
+}
+
+// spannerDialector returns the Spanner dialector of the given gorm database.
+func spannerDialector(db *gorm.DB) (Dialector, error) {
+	switch dialector := db.Dialector.(type) {
+	case *Dialector:
+		return *dialector, nil
+	case Dialector:
+		return dialector, nil
+	}
+	return Dialector{}, fmt.Errorf("not a Spanner database: %T", db.Dialector)
+}
+
+// toSpannerStatement converts a SQL string with positional parameters and the
+// values of those parameters to a statement for the Spanner client library.
+func toSpannerStatement(sql string, vars []interface{}) (spanner.Statement, error) {
+	var builder strings.Builder
+	params := make(map[string]interface{}, len(vars))
+	index := 0
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(sql) {
+				builder.WriteByte(c)
+				i++
+				c = sql[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			if index >= len(vars) {
+				return spanner.Statement{}, fmt.Errorf("missing value for parameter %d", index+1)
+			}
+			name := "p" + strconv.Itoa(index+1)
+			value := vars[index]
+			if valuer, ok := value.(driver.Valuer); ok {
+				v, err := valuer.Value()
+				if err != nil {
+					return spanner.Statement{}, err
+				}
+				value = v
+			}
+			params[name] = value
+			index++
+			builder.WriteString("@" + name)
+			continue
+		}
+		builder.WriteByte(c)
+	}
+	return spanner.Statement{SQL: builder.String(), Params: params}, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"gorm.io/gorm"
+)
+
+func TestSpannerClient(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	ctx := context.Background()
+	client, err := SpannerClient(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value int64
+	if err := client.Single().Query(ctx, spanner.NewStatement("SELECT 1")).Do(func(row *spanner.Row) error {
+		return row.Columns(&value)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := value, int64(1); g != w {
+		t.Fatalf("value mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The client is shared by all operations of the dialector.
+	other, err := SpannerClient(ctx, db.Session(&gorm.Session{NewDB: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != client {
+		t.Fatal("SpannerClient returned a different client")
+	}
+}
+
+func TestSpannerClientClosedWithDatabase(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	ctx := context.Background()
+	if _, err := SpannerClient(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SpannerClient(ctx, db); err == nil {
+		t.Fatal("missing expected error for a closed database")
+	}
+}
+
+func TestSpannerClientInTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return QueryRows(tx.Model(&singerWithCommitTimestamp{}), func(row *spanner.Row) error {
+			return nil
+		})
+	}); !errors.Is(err, ErrInTransaction) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, ErrInTransaction)
+	}
+	var singers []singerWithCommitTimestamp
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return FindStructs(tx.Model(&singerWithCommitTimestamp{}), &singers)
+	}); !errors.Is(err, ErrInTransaction) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, ErrInTransaction)
+	}
+}
@@ -0,0 +1,460 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ColumnTypeChangeStep is a step of ChangeColumnTypeSafely.
+type ColumnTypeChangeStep int
+
+const (
+	// ColumnTypeChangeAddColumn adds the column of the field with the new
+	// type to the table.
+	ColumnTypeChangeAddColumn ColumnTypeChangeStep = iota
+	// ColumnTypeChangeBackfill copies the values of the old column to the new
+	// column for all rows where the new column is NULL.
+	ColumnTypeChangeBackfill
+	// ColumnTypeChangeDropOldColumn drops the old column.
+	ColumnTypeChangeDropOldColumn
+)
+
+func (s ColumnTypeChangeStep) String() string {
+	switch s {
+	case ColumnTypeChangeAddColumn:
+		return "AddColumn"
+	case ColumnTypeChangeBackfill:
+		return "Backfill"
+	case ColumnTypeChangeDropOldColumn:
+		return "DropOldColumn"
+	}
+	return fmt.Sprintf("ColumnTypeChangeStep(%d)", int(s))
+}
+
+// ChangeColumnTypeSafely executes one step of changing the type of a column
+// without downtime. Spanner only supports a limited set of type changes with
+// ALTER COLUMN, and does not support renaming columns. The type of a column is
+// therefore changed by adding a new column with the new type, copying the data
+// from the old column, and then dropping the old column. The field must be
+// mapped to the new column, and the old column is given by name.
+//
+// A type change consists of the following steps, which are executed in order,
+// and each of which can safely be retried:
+//  1. Call ChangeColumnTypeSafely with ColumnTypeChangeAddColumn to add the
+//     new column to the table.
+//  2. Call RegisterDualWrite and deploy the application, so all inserts and
+//     updates write both the old and the new column.
+//  3. Call ChangeColumnTypeSafely with ColumnTypeChangeBackfill to copy the
+//     values of existing rows from the old column to the new column. The
+//     update is executed as a Partitioned DML statement.
+//  4. Remove the old field from the model and deploy the application, so it
+//     only uses the new column.
+//  5. Call ChangeColumnTypeSafely with ColumnTypeChangeDropOldColumn to drop
+//     the old column. This step returns an error if the table contains rows
+//     that have not been backfilled.
+//
+// Example:
+//
+//	// Change the type of the column `price` from INT64 to NUMERIC.
+//	type Product struct {
+//	  ID           int64
+//	  Price        int64           // Removed in step 4.
+//	  PriceNumeric decimal.Decimal `gorm:"type:numeric"`
+//	}
+//	err := m.ChangeColumnTypeSafely(&Product{}, "PriceNumeric", "price", spannergorm.ColumnTypeChangeAddColumn)
+func (m spannerMigrator) ChangeColumnTypeSafely(value interface{}, field string, oldColumn string, step ColumnTypeChangeStep) error {
+	if m.conn.batching {
+		return fmt.Errorf("ChangeColumnTypeSafely cannot be called while a DDL batch is active")
+	}
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		f := stmt.Schema.LookUpField(field)
+		if f == nil {
+			return fmt.Errorf("failed to look up field with name: %s", field)
+		}
+		if f.DBName == oldColumn {
+			return fmt.Errorf("field %s must be mapped to a different column than the old column %s", field, oldColumn)
+		}
+		column := clause.Column{Name: f.DBName}
+		source := clause.Column{Name: oldColumn}
+
+		switch step {
+		case ColumnTypeChangeAddColumn:
+			if m.HasColumn(value, f.DBName) {
+				return nil
+			}
+			return m.addNullableColumn(stmt, f)
+		case ColumnTypeChangeBackfill:
+			if !m.HasColumn(value, f.DBName) {
+				if err := m.addNullableColumn(stmt, f); err != nil {
+					return err
+				}
+			}
+			return execPartitionedDML(m.DB,
+				fmt.Sprintf("UPDATE ? SET ? = CAST(? AS %s) WHERE ? IS NULL AND ? IS NOT NULL", normalizeDataType(m.Migrator.DataTypeOf(f))),
+				m.CurrentTable(stmt), column, source, column, source,
+			)
+		case ColumnTypeChangeDropOldColumn:
+			if !m.HasColumn(value, oldColumn) {
+				return nil
+			}
+			var count int64
+			if err := m.DB.Raw(
+				"SELECT COUNT(*) FROM ? WHERE ? IS NULL AND ? IS NOT NULL",
+				m.CurrentTable(stmt), column, source,
+			).Row().Scan(&count); err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("cannot drop column %s: %d rows have not been backfilled to column %s", oldColumn, count, f.DBName)
+			}
+			return m.DB.Exec("ALTER TABLE ? DROP COLUMN ?", m.CurrentTable(stmt), source).Error
+		}
+		return fmt.Errorf("unknown column type change step: %v", step)
+	})
+}
+
+// addNullableColumn adds the column of the given field to the table without a
+// NOT NULL constraint, as existing rows do not have a value for the column
+// until they have been backfilled.
+func (m spannerMigrator) addNullableColumn(stmt *gorm.Statement, field *schema.Field) error {
+	return m.DB.Exec(
+		"ALTER TABLE ? ADD ? ?",
+		m.CurrentTable(stmt), clause.Column{Name: field.DBName}, clause.Expr{SQL: m.Migrator.DataTypeOf(field)},
+	).Error
+}
+
+// ColumnTypeChange is a change of the type of a column that Spanner does not
+// support, or that can fail for existing rows. See Config.StrictMigrateColumn
+// and Config.AllowUnsafeColumnTypeChanges.
+type ColumnTypeChange struct {
+	Table  string
+	Column string
+	// From is the current type of the column in the database.
+	From string
+	// To is the type of the field in the model.
+	To string
+}
+
+// ColumnTypeChangeError is returned by AutoMigrate and MigrateColumn if
+// Config.StrictMigrateColumn is enabled and one or more columns have a type in
+// the database that Spanner cannot change to the type of the field in the
+// model.
+type ColumnTypeChangeError struct {
+	Changes []ColumnTypeChange
+}
+
+func (e *ColumnTypeChangeError) Error() string {
+	return fmt.Sprintf("spanner does not support changing the type of these columns: %s; use ChangeColumnTypeSafely to change the type of a column", formatColumnTypeChanges(e.Changes))
+}
+
+// UnsafeColumnTypeChangeError is returned by AutoMigrate and MigrateColumn if
+// they would alter a column to a type that cannot hold all values of the
+// current type, and Config.AllowUnsafeColumnTypeChanges is not enabled.
+type UnsafeColumnTypeChangeError struct {
+	Changes []ColumnTypeChange
+}
+
+func (e *UnsafeColumnTypeChangeError) Error() string {
+	return fmt.Sprintf("changing the type of these columns fails if an existing value does not fit the new type: %s; set AllowUnsafeColumnTypeChanges to change them", formatColumnTypeChanges(e.Changes))
+}
+
+func formatColumnTypeChanges(changes []ColumnTypeChange) string {
+	formatted := make([]string, len(changes))
+	for i, change := range changes {
+		formatted[i] = fmt.Sprintf("%s.%s from %s to %s", change.Table, change.Column, change.From, change.To)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// unsafeColumnTypeChangeKey is the context key of the unsafe type change of
+// the column that is being migrated by MigrateColumn.
+type unsafeColumnTypeChangeKey struct{}
+
+// MigrateColumn migrates the column of the given field. If
+// Config.StrictMigrateColumn is enabled, it returns a *ColumnTypeChangeError
+// if Spanner cannot change the type of the column to the type of the field.
+// It returns an *UnsafeColumnTypeChangeError instead of altering the column
+// if the type of the field cannot hold all values of the current type of the
+// column, unless Config.AllowUnsafeColumnTypeChanges is enabled.
+func (m spannerMigrator) MigrateColumn(value interface{}, field *schema.Field, columnType gorm.ColumnType) error {
+	if m.Dialector.Config.StrictMigrateColumn {
+		if change, ok := m.unsupportedColumnTypeChange(field, columnType); ok {
+			return &ColumnTypeChangeError{Changes: []ColumnTypeChange{change}}
+		}
+	}
+	if !m.Dialector.Config.AllowUnsafeColumnTypeChanges {
+		if change, ok := m.unsafeColumnTypeChange(field, columnType); ok {
+			// gorm decides whether the column must be altered, for example
+			// because the NOT NULL constraint changed. AlterColumn refuses to
+			// alter the column with the narrower type of the field.
+			migrator := m.Migrator
+			migrator.DB = m.DB.WithContext(context.WithValue(m.DB.Statement.Context, unsafeColumnTypeChangeKey{}, change))
+			return migrator.MigrateColumn(value, field, columnType)
+		}
+	}
+	return m.Migrator.MigrateColumn(value, field, columnType)
+}
+
+// checkColumnTypeChanges returns a *ColumnTypeChangeError with all columns of
+// the existing tables of the given models whose type Spanner cannot change
+// to the type of their field.
+func (m spannerMigrator) checkColumnTypeChanges(values ...interface{}) error {
+	var changes []ColumnTypeChange
+	for _, value := range values {
+		if !m.HasTable(value) {
+			continue
+		}
+		columnTypes, err := m.ColumnTypes(value)
+		if err != nil {
+			return err
+		}
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			for _, columnType := range columnTypes {
+				field := stmt.Schema.LookUpField(columnType.Name())
+				if field == nil {
+					continue
+				}
+				if change, ok := m.unsupportedColumnTypeChange(field, columnType); ok {
+					changes = append(changes, change)
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	if len(changes) > 0 {
+		return &ColumnTypeChangeError{Changes: changes}
+	}
+	return nil
+}
+
+// unsupportedColumnTypeChange returns the change of the type of the column of
+// the given field and true if Spanner cannot execute the change with ALTER
+// COLUMN.
+func (m spannerMigrator) unsupportedColumnTypeChange(field *schema.Field, columnType gorm.ColumnType) (ColumnTypeChange, bool) {
+	return m.columnTypeChangeOf(field, columnType, columnTypeChangeUnsupported)
+}
+
+// unsafeColumnTypeChange returns the change of the type of the column of the
+// given field and true if the type of the field cannot hold all values of the
+// current type of the column.
+func (m spannerMigrator) unsafeColumnTypeChange(field *schema.Field, columnType gorm.ColumnType) (ColumnTypeChange, bool) {
+	return m.columnTypeChangeOf(field, columnType, columnTypeChangeUnsafe)
+}
+
+func (m spannerMigrator) columnTypeChangeOf(field *schema.Field, columnType gorm.ColumnType, kind columnTypeChangeKind) (ColumnTypeChange, bool) {
+	if field.IgnoreMigration || field.DBName == "" {
+		return ColumnTypeChange{}, false
+	}
+	from := columnDataType(columnType)
+	to := m.Migrator.DataTypeOf(field)
+	if classifyColumnTypeChange(from, to) != kind {
+		return ColumnTypeChange{}, false
+	}
+	if kind == columnTypeChangeUnsupported {
+		from, to = normalizeDataType(from), normalizeDataType(to)
+	}
+	return ColumnTypeChange{Table: field.Schema.Table, Column: field.DBName, From: from, To: to}, true
+}
+
+// columnDataType returns the type of the given column including its length,
+// e.g. STRING(100), STRING(MAX) or ARRAY<BYTES(10)>. ColumnTypes returns the
+// type name and the length of a column separately.
+func columnDataType(columnType gorm.ColumnType) string {
+	dataType := strings.ToUpper(columnType.DatabaseTypeName())
+	element := strings.TrimSuffix(strings.TrimPrefix(dataType, "ARRAY<"), ">")
+	if element != "STRING" && element != "BYTES" {
+		return dataType
+	}
+	length := "MAX"
+	if l, ok := columnType.Length(); ok && l > 0 {
+		length = strconv.FormatInt(l, 10)
+	}
+	if element != dataType {
+		return fmt.Sprintf("ARRAY<%s(%s)>", element, length)
+	}
+	return fmt.Sprintf("%s(%s)", element, length)
+}
+
+// columnTypeChangeKind is the kind of a change of the type of a column.
+type columnTypeChangeKind int
+
+const (
+	// columnTypeUnchanged is returned if the types are equal.
+	columnTypeUnchanged columnTypeChangeKind = iota
+	// columnTypeChangeSafe is a change to a type that can hold all values of
+	// the current type, such as increasing the length of a STRING column.
+	columnTypeChangeSafe
+	// columnTypeChangeUnsafe is a change that Spanner supports, but that fails
+	// if an existing value does not fit the new type, such as reducing the
+	// length of a STRING column or changing a BYTES column to STRING.
+	columnTypeChangeUnsafe
+	// columnTypeChangeUnsupported is a change that Spanner does not support,
+	// such as changing an INT64 column to STRING.
+	columnTypeChangeUnsupported
+)
+
+// maxBytesPerChar is the maximum number of bytes of a character in UTF-8.
+const maxBytesPerChar = 4
+
+// classifyColumnTypeChange returns the kind of the change from one GoogleSQL
+// type to another. Spanner supports changing the length of STRING and BYTES
+// columns, and changing a STRING column to BYTES and vice versa, also for
+// arrays of these types. Changes to a shorter length and from BYTES to STRING
+// are unsafe, as Spanner validates the existing values, and the change fails
+// if a value is too long or is not valid UTF-8. The lengths of STRING columns
+// are in characters, and the lengths of BYTES columns are in bytes.
+func classifyColumnTypeChange(from, to string) columnTypeChangeKind {
+	fromType, toType := normalizeDataType(from), normalizeDataType(to)
+	if fromType == "" || toType == "" {
+		return columnTypeUnchanged
+	}
+	fromElement := strings.TrimSuffix(strings.TrimPrefix(fromType, "ARRAY<"), ">")
+	toElement := strings.TrimSuffix(strings.TrimPrefix(toType, "ARRAY<"), ">")
+	if (fromElement == fromType) != (toElement == toType) {
+		return columnTypeChangeUnsupported
+	}
+	fromLength, toLength := dataTypeMaxLength(from), dataTypeMaxLength(to)
+	switch fromElement + "->" + toElement {
+	case "STRING->STRING", "BYTES->BYTES":
+		if fromLength == toLength {
+			return columnTypeUnchanged
+		}
+		if toLength == 0 || fromLength != 0 && toLength > fromLength {
+			return columnTypeChangeSafe
+		}
+		return columnTypeChangeUnsafe
+	case "STRING->BYTES":
+		if toLength == 0 || fromLength != 0 && toLength >= fromLength*maxBytesPerChar {
+			return columnTypeChangeSafe
+		}
+		return columnTypeChangeUnsafe
+	case "BYTES->STRING":
+		return columnTypeChangeUnsafe
+	}
+	if fromType == toType {
+		return columnTypeUnchanged
+	}
+	return columnTypeChangeUnsupported
+}
+
+// dataTypeMaxLength returns the length of the given STRING or BYTES type, or of
+// the element type of an array, e.g. 100 for STRING(100) and ARRAY<BYTES(100)>.
+// It returns 0 for the length MAX and for types without a length.
+func dataTypeMaxLength(dataType string) int64 {
+	length, err := strconv.ParseInt(dataTypeLengthOf(dataType), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return length
+}
+
+// RegisterDualWrite registers callbacks that copy the value of oldField to
+// newField of the given model before each insert and update of the model.
+// The value is converted to the type of newField. Use this to write both the
+// old and the new column while the type of a column is changed with
+// ChangeColumnTypeSafely, as Spanner does not support triggers.
+//
+// Updates with a map of values are supported if the map contains the column
+// or field name of oldField. Updates that use Select must select both fields.
+//
+// Example:
+//
+//	err := spannergorm.RegisterDualWrite(db, &Product{}, "PriceNumeric", "Price")
+func RegisterDualWrite(db *gorm.DB, model interface{}, newField, oldField string) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	if stmt.Schema.LookUpField(newField) == nil {
+		return fmt.Errorf("failed to look up field with name: %s", newField)
+	}
+	if stmt.Schema.LookUpField(oldField) == nil {
+		return fmt.Errorf("failed to look up field with name: %s", oldField)
+	}
+	table := stmt.Schema.Table
+	copyValue := func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.Table != table {
+			return
+		}
+		if err := dualWrite(db.Statement, newField, oldField); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+	name := fmt.Sprintf("gorm:spanner:dual_write:%s.%s", table, newField)
+	if err := db.Callback().Create().Before("gorm:create").Register(name, copyValue); err != nil {
+		return err
+	}
+	return db.Callback().Update().
+		After("gorm:before_update").
+		Before("gorm:update").
+		Register(name, copyValue)
+}
+
+// dualWrite copies the value of oldField to newField in the destination of the
+// statement.
+func dualWrite(stmt *gorm.Statement, newField, oldField string) error {
+	newF := stmt.Schema.LookUpField(newField)
+	oldF := stmt.Schema.LookUpField(oldField)
+	if newF == nil || oldF == nil {
+		return nil
+	}
+	if values, ok := stmt.Dest.(map[string]interface{}); ok {
+		value, ok := values[oldF.DBName]
+		if !ok {
+			if value, ok = values[oldF.Name]; !ok {
+				return nil
+			}
+		}
+		// Normalize the value to a driver.Value, and use a temporary instance
+		// of the model to convert it to the type of the new field.
+		if v, err := driver.DefaultParameterConverter.ConvertValue(value); err == nil {
+			value = v
+		}
+		tmp := reflect.New(stmt.Schema.ModelType).Elem()
+		if err := newF.Set(stmt.Context, tmp, value); err != nil {
+			return err
+		}
+		converted, _ := newF.ValueOf(stmt.Context, tmp)
+		values[newF.DBName] = converted
+		return nil
+	}
+	copyField := func(rv reflect.Value) error {
+		value, _ := oldF.ValueOf(stmt.Context, rv)
+		return newF.Set(stmt.Context, rv, value)
+	}
+	switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := copyField(reflect.Indirect(rv.Index(i))); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return copyField(rv)
+	}
+	return nil
+}
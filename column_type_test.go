@@ -0,0 +1,349 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"github.com/shopspring/decimal"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/migrator"
+)
+
+type product struct {
+	ID           int64 `gorm:"primaryKey;autoIncrement:false"`
+	Price        int64
+	PriceNumeric decimal.NullDecimal `gorm:"type:NUMERIC"`
+}
+
+func TestChangeColumnTypeSafely(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasColSql := "SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = @p1 AND table_name = @p2 AND column_name = @p3"
+	updateSql := "UPDATE `products` SET `price_numeric` = CAST(`price` AS NUMERIC) WHERE `price_numeric` IS NULL AND `price` IS NOT NULL"
+	countSql := "SELECT COUNT(*) FROM `products` WHERE `price_numeric` IS NULL AND `price` IS NOT NULL"
+	_ = putCountStatementResult(server, hasColSql, 0)
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 10,
+	})
+
+	m := db.Migrator().(DataMigrator)
+	defer m.(io.Closer).Close()
+	if err := m.ChangeColumnTypeSafely(&product{}, "PriceNumeric", "price", ColumnTypeChangeAddColumn); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements()[0], "ALTER TABLE `products` ADD `price_numeric` NUMERIC"; g != w {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Backfill the new column. The column now exists.
+	_ = putCountStatementResult(server, hasColSql, 1)
+	drainRequestsFromServer(server.TestSpanner)
+	if err := m.ChangeColumnTypeSafely(&product{}, "PriceNumeric", "price", ColumnTypeChangeBackfill); err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	beginRequests := requestsOfType(reqs, reflect.TypeOf(&spannerpb.BeginTransactionRequest{}))
+	if g, w := len(beginRequests), 1; g != w {
+		t.Fatalf("begin request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if beginRequests[0].(*spannerpb.BeginTransactionRequest).Options.GetPartitionedDml() == nil {
+		t.Fatal("update was not executed as Partitioned DML")
+	}
+	executeRequests := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := executeRequests[len(executeRequests)-1].(*spannerpb.ExecuteSqlRequest).Sql, updateSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Dropping the old column fails if not all rows have been backfilled.
+	_ = putCountStatementResult(server, countSql, 2)
+	if err := m.ChangeColumnTypeSafely(&product{}, "PriceNumeric", "price", ColumnTypeChangeDropOldColumn); err == nil {
+		t.Fatal("missing expected error for rows that have not been backfilled")
+	}
+	_ = putCountStatementResult(server, countSql, 0)
+	if err := m.ChangeColumnTypeSafely(&product{}, "PriceNumeric", "price", ColumnTypeChangeDropOldColumn); err != nil {
+		t.Fatal(err)
+	}
+	requests = server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 2; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[1].(*databasepb.UpdateDatabaseDdlRequest).GetStatements()[0], "ALTER TABLE `products` DROP COLUMN `price`"; g != w {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	if err := m.ChangeColumnTypeSafely(&product{}, "Price", "price", ColumnTypeChangeAddColumn); err == nil {
+		t.Fatal("missing expected error for field that is mapped to the old column")
+	}
+}
+
+func TestRegisterDualWrite(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	if err := RegisterDualWrite(db, &product{}, "PriceNumeric", "Price"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterDualWrite(db, &product{}, "Unknown", "Price"); err == nil {
+		t.Fatal("missing expected error for unknown field")
+	}
+
+	insertSql := "INSERT INTO `products` (`id`,`price`,`price_numeric`) VALUES (@p1,@p2,@p3)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	p := product{ID: 1, Price: 100}
+	if err := db.Create(&p).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := p.PriceNumeric.Decimal.String(), "100"; !p.PriceNumeric.Valid || g != w {
+		t.Fatalf("price numeric mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.Sql, insertSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p3"].GetStringValue(), "100"; g != w {
+		t.Fatalf("param mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	updateSql := "UPDATE `products` SET `price`=@p1,`price_numeric`=@p2 WHERE `id` = @p3"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	if err := db.Model(&p).Updates(map[string]interface{}{"price": 200}).Error; err != nil {
+		t.Fatal(err)
+	}
+	req = getLastSqlRequest(server)
+	if g, w := req.Sql, updateSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p2"].GetStringValue(), "200"; g != w {
+		t.Fatalf("param mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+type document struct {
+	ID      int64 `gorm:"primaryKey;autoIncrement:false"`
+	Content []byte
+	Views   string
+}
+
+func TestStrictMigrateColumn(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{StrictMigrateColumn: true})
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	_ = putCountStatementResult(server, "SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = @p1 AND table_name = @p2 AND column_name = @p3 AND generation_expression IS NOT NULL", 0)
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&document{}); err != nil {
+		t.Fatal(err)
+	}
+	columnType := func(name, dataType string) gorm.ColumnType {
+		return migrator.ColumnType{
+			NameValue:     sql.NullString{String: name, Valid: true},
+			DataTypeValue: sql.NullString{String: dataType, Valid: true},
+			SQLColumnType: &sql.ColumnType{},
+		}
+	}
+	m := db.Migrator().(SpannerMigrator)
+	defer m.(io.Closer).Close()
+
+	// Spanner cannot change an INT64 column to STRING.
+	err = m.MigrateColumn(&document{}, stmt.Schema.LookUpField("Views"), columnType("views", "INT64"))
+	var changeErr *ColumnTypeChangeError
+	if !errors.As(err, &changeErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, changeErr)
+	}
+	if g, w := changeErr.Changes, []ColumnTypeChange{{Table: "documents", Column: "views", From: "INT64", To: "STRING"}}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("changes mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Changing a STRING column to BYTES is supported.
+	if err := m.MigrateColumn(&document{}, stmt.Schema.LookUpField("Content"), columnType("content", "STRING")); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements()[0], "ALTER TABLE `documents` ALTER COLUMN `content` BYTES(MAX)"; g != w {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+type shortCode struct {
+	ID   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Code string `gorm:"size:10"`
+}
+
+func TestMigrateColumnUnsafeTypeChange(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name   string
+		config Config
+		length int64
+		want   string
+	}{
+		{name: "narrowing", length: 100},
+		{name: "narrowing allowed", config: Config{AllowUnsafeColumnTypeChanges: true}, length: 100, want: "ALTER TABLE `short_codes` ALTER COLUMN `code` STRING(10)"},
+		{name: "widening", length: 5, want: "ALTER TABLE `short_codes` ALTER COLUMN `code` STRING(10)"},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, server, teardown := setupTestGormConnectionWithConfig(t, "", test.config)
+			defer teardown()
+			anyProto, err := anypb.New(&emptypb.Empty{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+				Name:   "test-operation",
+				Done:   true,
+				Result: &longrunningpb.Operation_Response{Response: anyProto},
+			}})
+			_ = putCountStatementResult(server, "SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = @p1 AND table_name = @p2 AND column_name = @p3 AND generation_expression IS NOT NULL", 0)
+
+			stmt := &gorm.Statement{DB: db}
+			if err := stmt.Parse(&shortCode{}); err != nil {
+				t.Fatal(err)
+			}
+			m := db.Migrator().(SpannerMigrator)
+			defer m.(io.Closer).Close()
+			err = m.MigrateColumn(&shortCode{}, stmt.Schema.LookUpField("Code"), migrator.ColumnType{
+				NameValue:     sql.NullString{String: "code", Valid: true},
+				DataTypeValue: sql.NullString{String: "STRING", Valid: true},
+				LengthValue:   sql.NullInt64{Int64: test.length, Valid: true},
+				NullableValue: sql.NullBool{Bool: true, Valid: true},
+				SQLColumnType: &sql.ColumnType{},
+			})
+			requests := server.TestDatabaseAdmin.Reqs()
+			if test.want == "" {
+				var changeErr *UnsafeColumnTypeChangeError
+				if !errors.As(err, &changeErr) {
+					t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, changeErr)
+				}
+				if g, w := changeErr.Changes, []ColumnTypeChange{{Table: "short_codes", Column: "code", From: "STRING(100)", To: "STRING(10)"}}; !reflect.DeepEqual(g, w) {
+					t.Fatalf("changes mismatch\n Got: %v\nWant: %v", g, w)
+				}
+				if g, w := len(requests), 0; g != w {
+					t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g, w := len(requests), 1; g != w {
+				t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+			}
+			if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements()[0], test.want; g != w {
+				t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+			}
+		})
+	}
+}
+
+func TestClassifyColumnTypeChange(t *testing.T) {
+	for _, test := range []struct {
+		from string
+		to   string
+		want columnTypeChangeKind
+	}{
+		{"STRING(MAX)", "STRING(MAX)", columnTypeUnchanged},
+		{"STRING(10)", "STRING(10)", columnTypeUnchanged},
+		{"STRING(10)", "STRING(100)", columnTypeChangeSafe},
+		{"STRING(10)", "STRING(MAX)", columnTypeChangeSafe},
+		{"STRING(100)", "STRING(10)", columnTypeChangeUnsafe},
+		{"STRING(MAX)", "STRING(10)", columnTypeChangeUnsafe},
+		{"BYTES(10)", "BYTES(100)", columnTypeChangeSafe},
+		{"BYTES(10)", "BYTES(MAX)", columnTypeChangeSafe},
+		{"BYTES(100)", "BYTES(10)", columnTypeChangeUnsafe},
+		{"BYTES(MAX)", "BYTES(10)", columnTypeChangeUnsafe},
+		{"STRING(MAX)", "BYTES(MAX)", columnTypeChangeSafe},
+		{"STRING(10)", "BYTES(40)", columnTypeChangeSafe},
+		{"STRING(10)", "BYTES(39)", columnTypeChangeUnsafe},
+		{"STRING(MAX)", "BYTES(100)", columnTypeChangeUnsafe},
+		{"BYTES(MAX)", "STRING(MAX)", columnTypeChangeUnsafe},
+		{"BYTES(10)", "STRING(100)", columnTypeChangeUnsafe},
+		{"ARRAY<STRING(10)>", "ARRAY<STRING(MAX)>", columnTypeChangeSafe},
+		{"ARRAY<STRING(MAX)>", "ARRAY<STRING(10)>", columnTypeChangeUnsafe},
+		{"ARRAY<STRING(MAX)>", "ARRAY<BYTES(MAX)>", columnTypeChangeSafe},
+		{"ARRAY<BYTES(MAX)>", "ARRAY<STRING(MAX)>", columnTypeChangeUnsafe},
+		{"ARRAY<STRING(MAX)>", "STRING(MAX)", columnTypeChangeUnsupported},
+		{"STRING(MAX)", "ARRAY<STRING(MAX)>", columnTypeChangeUnsupported},
+		{"INT64", "INT64", columnTypeUnchanged},
+		{"INT64", "int", columnTypeUnchanged},
+		{"TIMESTAMP", "TIMESTAMP OPTIONS (allow_commit_timestamp=true)", columnTypeUnchanged},
+		{"INT64", "STRING(MAX)", columnTypeChangeUnsupported},
+		{"INT64", "FLOAT64", columnTypeChangeUnsupported},
+		{"FLOAT32", "FLOAT64", columnTypeChangeUnsupported},
+		{"INT64", "NUMERIC", columnTypeChangeUnsupported},
+		{"STRING(MAX)", "JSON", columnTypeChangeUnsupported},
+		{"DATE", "TIMESTAMP", columnTypeChangeUnsupported},
+		{"ARRAY<INT64>", "ARRAY<FLOAT64>", columnTypeChangeUnsupported},
+		{"", "STRING(MAX)", columnTypeUnchanged},
+	} {
+		if g, w := classifyColumnTypeChange(test.from, test.to), test.want; g != w {
+			t.Errorf("%s -> %s: mismatch\n Got: %v\nWant: %v", test.from, test.to, g, w)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"gorm.io/gorm"
+)
+
+// CommitOutcome is the outcome of a transaction.
+type CommitOutcome int
+
+const (
+	// CommitOutcomeCommitted means that the transaction was committed.
+	CommitOutcomeCommitted CommitOutcome = iota
+	// CommitOutcomeNotCommitted means that the transaction was not committed,
+	// and that it can safely be retried.
+	CommitOutcomeNotCommitted
+	// CommitOutcomeUnknown means that it is unknown whether the transaction
+	// was committed. This happens when the commit times out or is cancelled
+	// after it has been sent to Spanner, or when the connection to Spanner is
+	// lost during the commit.
+	CommitOutcomeUnknown
+)
+
+func (o CommitOutcome) String() string {
+	switch o {
+	case CommitOutcomeCommitted:
+		return "Committed"
+	case CommitOutcomeNotCommitted:
+		return "NotCommitted"
+	default:
+		return "Unknown"
+	}
+}
+
+// ClassifyCommitError returns the outcome of a transaction that returned the
+// given error. A nil error means that the transaction was committed. Errors
+// that guarantee that the transaction was not committed, such as an aborted
+// transaction or a constraint violation, return CommitOutcomeNotCommitted.
+// Errors that could have happened after Spanner received the commit request
+// return CommitOutcomeUnknown.
+func ClassifyCommitError(err error) CommitOutcome {
+	if err == nil {
+		return CommitOutcomeCommitted
+	}
+	var deadlineErr *CommitDeadlineError
+	if errors.As(err, &deadlineErr) {
+		return CommitOutcomeNotCommitted
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return CommitOutcomeUnknown
+	}
+	switch spanner.ErrCode(err) {
+	case codes.DeadlineExceeded, codes.Canceled, codes.Unavailable, codes.Internal, codes.Unknown:
+		return CommitOutcomeUnknown
+	}
+	return CommitOutcomeNotCommitted
+}
+
+// ResolveCommitOutcome returns the outcome of a transaction that returned the
+// given error. If ClassifyCommitError cannot determine the outcome from the
+// error, ResolveCommitOutcome calls committed to check whether the transaction
+// was committed. committed should look up a change that the transaction made,
+// for example a row with an idempotency key that was inserted by the
+// transaction. See HasRow for a helper that does that.
+//
+// Example:
+//
+//	key := uuid.NewString()
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//	  if err := tx.Create(&Payment{IdempotencyKey: key, Amount: 100}).Error; err != nil {
+//	    return err
+//	  }
+//	  return tx.Model(&Account{}).Where("id = ?", 1).Update("balance", gorm.Expr("balance - ?", 100)).Error
+//	})
+//	outcome, err := spannergorm.ResolveCommitOutcome(err, func() (bool, error) {
+//	  return spannergorm.HasRow(db, &Payment{}, "idempotency_key = ?", key)
+//	})
+func ResolveCommitOutcome(err error, committed func() (bool, error)) (CommitOutcome, error) {
+	outcome := ClassifyCommitError(err)
+	if outcome != CommitOutcomeUnknown {
+		return outcome, nil
+	}
+	ok, lookupErr := committed()
+	if lookupErr != nil {
+		return CommitOutcomeUnknown, lookupErr
+	}
+	if ok {
+		return CommitOutcomeCommitted, nil
+	}
+	return CommitOutcomeNotCommitted, nil
+}
+
+// HasRow returns true if the table of the given model contains at least one
+// row that matches the given conditions. The lookup is executed as a strong
+// read outside of any transaction, and is therefore guaranteed to see all
+// transactions that have been committed before it was executed.
+func HasRow(db *gorm.DB, model interface{}, conds ...interface{}) (bool, error) {
+	var count int64
+	tx := db.Session(&gorm.Session{NewDB: true}).Model(model)
+	if len(conds) > 0 {
+		tx = tx.Where(conds[0], conds[1:]...)
+	}
+	if err := tx.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
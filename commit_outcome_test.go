@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifyCommitError(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want CommitOutcome
+	}{
+		{nil, CommitOutcomeCommitted},
+		{status.Error(codes.Aborted, "aborted"), CommitOutcomeNotCommitted},
+		{status.Error(codes.AlreadyExists, "row exists"), CommitOutcomeNotCommitted},
+		{&CommitDeadlineError{}, CommitOutcomeNotCommitted},
+		{status.Error(codes.DeadlineExceeded, "deadline exceeded"), CommitOutcomeUnknown},
+		{status.Error(codes.Unavailable, "unavailable"), CommitOutcomeUnknown},
+		{fmt.Errorf("commit failed: %w", context.DeadlineExceeded), CommitOutcomeUnknown},
+	} {
+		if g, w := ClassifyCommitError(test.err), test.want; g != w {
+			t.Errorf("%v: outcome mismatch\n Got: %v\nWant: %v", test.err, g, w)
+		}
+	}
+}
+
+func TestResolveCommitOutcome(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	querySql := "SELECT count(*) FROM `singers` WHERE id = @p1"
+	_ = putCountStatementResult(server, querySql, 1)
+	outcome, err := ResolveCommitOutcome(status.Error(codes.DeadlineExceeded, "deadline exceeded"), func() (bool, error) {
+		return HasRow(db, &singerWithCommitTimestamp{}, "id = ?", 1)
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve commit outcome: %v", err)
+	}
+	if g, w := outcome, CommitOutcomeCommitted; g != w {
+		t.Fatalf("outcome mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := getLastSql(server), querySql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	_ = putCountStatementResult(server, querySql, 0)
+	outcome, err = ResolveCommitOutcome(status.Error(codes.DeadlineExceeded, "deadline exceeded"), func() (bool, error) {
+		return HasRow(db, &singerWithCommitTimestamp{}, "id = ?", 1)
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve commit outcome: %v", err)
+	}
+	if g, w := outcome, CommitOutcomeNotCommitted; g != w {
+		t.Fatalf("outcome mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The lookup is not executed if the outcome is known.
+	outcome, _ = ResolveCommitOutcome(status.Error(codes.Aborted, "aborted"), func() (bool, error) {
+		t.Fatal("unexpected lookup")
+		return false, nil
+	})
+	if g, w := outcome, CommitOutcomeNotCommitted; g != w {
+		t.Fatalf("outcome mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
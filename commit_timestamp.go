@@ -18,10 +18,12 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 // CommitTimestamp can be used for columns that should write the PENDING_COMMIT_TIMESTAMP().
@@ -68,3 +70,185 @@ func (ct *CommitTimestamp) Scan(v interface{}) error {
 	}
 	return nil
 }
+
+// commitTimestampTagSetting is the setting of the `spannerGorm` tag that marks
+// a TIMESTAMP field as a commit timestamp field, e.g.
+// `spannerGorm:"commit_timestamp"`.
+const commitTimestampTagSetting = "COMMIT_TIMESTAMP"
+
+// hasCommitTimestampTag returns true if the given field has a
+// `spannerGorm:"commit_timestamp"` tag.
+func hasCommitTimestampTag(field *schema.Field) bool {
+	settings, ok := spannerGormSettings(field)
+	if !ok {
+		return false
+	}
+	_, ok = settings[commitTimestampTagSetting]
+	return ok
+}
+
+// isCommitTimestampField returns true if the given field is a TIMESTAMP field
+// that should be filled with the commit timestamp of the transaction when a
+// row is inserted. These are fields with a `spannerGorm:"commit_timestamp"`
+// tag, and fields with an autoCreateTime or autoUpdateTime tag if
+// UseCommitTimestampForAutoTime is enabled.
+func (dialector Dialector) isCommitTimestampField(field *schema.Field) bool {
+	if field == nil || field.DataType != schema.Time {
+		return false
+	}
+	if hasCommitTimestampTag(field) {
+		return true
+	}
+	if dialector.Config == nil || !dialector.UseCommitTimestampForAutoTime {
+		return false
+	}
+	return field.AutoCreateTime > 0 || field.AutoUpdateTime > 0
+}
+
+// allowCommitTimestampOption is the column option that allows a TIMESTAMP
+// column to be set to the commit timestamp of a transaction.
+const allowCommitTimestampOption = "OPTIONS (allow_commit_timestamp=true)"
+
+// allowsCommitTimestamp returns true if the column of the given field must
+// have the allow_commit_timestamp option. These are the fields of type
+// CommitTimestamp and the commit timestamp fields.
+func (dialector Dialector) allowsCommitTimestamp(field *schema.Field) bool {
+	if field == nil {
+		return false
+	}
+	return field.DataType == schema.DataType(CommitTimestamp{}.GormDataType()) || dialector.isCommitTimestampField(field)
+}
+
+// hasCommitTimestampColumns returns true if the given schema has fields whose
+// columns must have the allow_commit_timestamp option.
+func (dialector Dialector) hasCommitTimestampColumns(s *schema.Schema) bool {
+	for _, field := range s.Fields {
+		if field.DBName != "" && !field.IgnoreMigration && dialector.allowsCommitTimestamp(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// getCommitTimestampOptionsSql returns the TIMESTAMP columns of a table and
+// the value of their allow_commit_timestamp option.
+const getCommitTimestampOptionsSql = "SELECT C.COLUMN_NAME, COALESCE(O.OPTION_VALUE, 'FALSE') " +
+	"FROM INFORMATION_SCHEMA.COLUMNS C " +
+	"LEFT JOIN INFORMATION_SCHEMA.COLUMN_OPTIONS O " +
+	"ON O.TABLE_SCHEMA = C.TABLE_SCHEMA AND O.TABLE_NAME = C.TABLE_NAME AND O.COLUMN_NAME = C.COLUMN_NAME " +
+	"AND O.OPTION_NAME = 'allow_commit_timestamp' " +
+	"WHERE C.TABLE_SCHEMA = ? AND C.TABLE_NAME = ? AND C.SPANNER_TYPE = 'TIMESTAMP'"
+
+// migrateCommitTimestampOptions sets the allow_commit_timestamp option of the
+// existing columns of the given model that are filled with the commit
+// timestamp, but that were created without the option. Columns that do not
+// yet exist are created with the option by AutoMigrate.
+func (m spannerMigrator) migrateCommitTimestampOptions(value interface{}) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if !m.Dialector.hasCommitTimestampColumns(stmt.Schema) {
+			return nil
+		}
+		tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+		rows, err := m.DB.Raw(getCommitTimestampOptionsSql, tableSchema, table).Rows()
+		if err != nil {
+			return err
+		}
+		allowed := make(map[string]bool)
+		for rows.Next() {
+			var column, option string
+			if err := rows.Scan(&column, &option); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			allowed[column] = strings.EqualFold(option, "TRUE")
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration || !m.Dialector.allowsCommitTimestamp(field) {
+				continue
+			}
+			if allow, exists := allowed[field.DBName]; !exists || allow {
+				continue
+			}
+			if err := m.DB.Exec(
+				"ALTER TABLE ? ALTER COLUMN ? SET "+allowCommitTimestampOption,
+				m.CurrentTable(stmt), clause.Column{Name: field.DBName},
+			).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// isCommitTimestampOnUpdate returns true if the given field should be set to
+// the commit timestamp of the transaction when it is updated. Fields that are
+// only filled when a row is created, such as CreatedAt, keep their value.
+func (dialector Dialector) isCommitTimestampOnUpdate(field *schema.Field) bool {
+	if !dialector.isCommitTimestampField(field) {
+		return false
+	}
+	return field.AutoUpdateTime > 0 || (field.AutoCreateTime == 0 && hasCommitTimestampTag(field))
+}
+
+// registerCommitTimestamps registers clause builders that replace the values
+// of commit timestamp fields with PENDING_COMMIT_TIMESTAMP(). The previously
+// registered builders for these clauses are called afterwards.
+func (dialector Dialector) registerCommitTimestamps(db *gorm.DB) {
+	pendingCommitTimestamp := clause.Expr{SQL: "PENDING_COMMIT_TIMESTAMP()"}
+	wrap := func(name string, replace func(c clause.Clause, s *schema.Schema) clause.Clause) {
+		next := db.ClauseBuilders[name]
+		db.ClauseBuilders[name] = func(c clause.Clause, builder clause.Builder) {
+			if stmt, ok := builder.(*gorm.Statement); ok && stmt.Schema != nil {
+				c = replace(c, stmt.Schema)
+			}
+			if next != nil {
+				next(c, builder)
+			} else {
+				c.Build(builder)
+			}
+		}
+	}
+	wrap(clause.Values{}.Name(), func(c clause.Clause, s *schema.Schema) clause.Clause {
+		values, ok := c.Expression.(clause.Values)
+		if !ok {
+			return c
+		}
+		var indexes []int
+		for i, column := range values.Columns {
+			if dialector.isCommitTimestampField(s.LookUpField(column.Name)) {
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) == 0 {
+			return c
+		}
+		rows := make([][]interface{}, len(values.Values))
+		for r, row := range values.Values {
+			rows[r] = make([]interface{}, len(row))
+			copy(rows[r], row)
+			for _, i := range indexes {
+				rows[r][i] = pendingCommitTimestamp
+			}
+		}
+		c.Expression = clause.Values{Columns: values.Columns, Values: rows}
+		return c
+	})
+	wrap(clause.Set{}.Name(), func(c clause.Clause, s *schema.Schema) clause.Clause {
+		set, ok := c.Expression.(clause.Set)
+		if !ok {
+			return c
+		}
+		assignments := make(clause.Set, len(set))
+		for i, assignment := range set {
+			assignments[i] = assignment
+			if dialector.isCommitTimestampOnUpdate(s.LookUpField(assignment.Column.Name)) {
+				assignments[i].Value = pendingCommitTimestamp
+			}
+		}
+		c.Expression = assignments
+		return c
+	})
+}
@@ -0,0 +1,472 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+)
+
+// connPool is the gorm.ConnPool that is used for a *sql.DB. It starts each
+// transaction on a pinned connection, so the underlying Spanner connection of
+// the transaction can be accessed with WithSpannerConn.
+type connPool struct {
+	// DB is replaced by RotateCredentials, and must only be accessed while
+	// holding mu.
+	*sql.DB
+
+	// translate is applied to all statements before they are executed, if set.
+	translate func(query string) string
+	// minCommitDeadline is the minimum time that must be left until the
+	// deadline of a transaction when it is committed.
+	minCommitDeadline time.Duration
+
+	// driverName and dsn are used to open a connection pool for each request
+	// priority that is set with WithRequestOptions. They are empty if the
+	// dialector was not created with a DSN.
+	driverName    string
+	dsn           string
+	mu            sync.Mutex
+	priorityPools map[spannerpb.RequestOptions_Priority]*sql.DB
+	// closed is set when DB is closed. No new connection pools are opened
+	// for request priorities after that. onClose are the functions that are
+	// called when DB is closed.
+	closed  bool
+	onClose []func()
+
+	// rotateMu serializes calls to RotateCredentials. generation is the
+	// number of times that the credentials have been rotated.
+	rotateMu   sync.Mutex
+	generation int
+}
+
+// openDB opens a connection pool for the given connection string. The
+// connection pools for request priorities of p are closed when the returned
+// pool is closed, as long as it is the current pool of p.
+func (p *connPool) openDB(driverName, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := db.Driver().(driver.DriverContext)
+	if !ok {
+		return db, nil
+	}
+	// sql.Open does not connect to the database, so the pool can be replaced
+	// with a pool with a connector that is notified when it is closed.
+	_ = db.Close()
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c := &poolConnector{Connector: connector, pool: p}
+	c.db = sql.OpenDB(c)
+	return c.db, nil
+}
+
+// poolConnector is the connector of a connection pool that is opened by
+// connPool.openDB. database/sql calls Close when the pool is closed.
+type poolConnector struct {
+	driver.Connector
+
+	pool *connPool
+	db   *sql.DB
+}
+
+func (c *poolConnector) Close() error {
+	c.pool.closeDB(c.db)
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// closeDB closes the connection pools for request priorities and calls the
+// onClose functions of p if db is the current connection pool of p.
+func (p *connPool) closeDB(db *sql.DB) {
+	p.mu.Lock()
+	if p.DB != db {
+		p.mu.Unlock()
+		return
+	}
+	pools := p.priorityPools
+	p.priorityPools, p.closed = nil, true
+	p.mu.Unlock()
+	for _, pool := range pools {
+		_ = pool.Close()
+	}
+	for _, f := range p.onClose {
+		f()
+	}
+}
+
+func (p *connPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := checkDriverTags(ctx, true); err != nil {
+		return nil, err
+	}
+	db, err := p.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecContext(ctx, translateQuery(p.translate, query), args...)
+}
+
+func (p *connPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if err := checkDriverTags(ctx, false); err != nil {
+		return nil, err
+	}
+	db, err := p.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryContext(ctx, translateQuery(p.translate, query), args...)
+}
+
+func (p *connPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if err := checkDriverTags(ctx, false); err != nil {
+		return errorRow(ctx, err)
+	}
+	db, err := p.db(ctx)
+	if err != nil {
+		return errorRow(ctx, err)
+	}
+	return db.QueryRowContext(ctx, translateQuery(p.translate, query), args...)
+}
+
+func (p *connPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if err := checkDriverTags(ctx, false); err != nil {
+		return nil, err
+	}
+	db, err := p.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.PrepareContext(ctx, translateQuery(p.translate, query))
+}
+
+// errorRow returns a *sql.Row whose Scan method returns err. database/sql does
+// not offer a way to create a *sql.Row with an error, so the row is returned
+// by a connection pool whose connector always fails with err.
+func errorRow(ctx context.Context, err error) *sql.Row {
+	db := sql.OpenDB(errorConnector{err: err})
+	defer db.Close()
+	return db.QueryRowContext(ctx, "")
+}
+
+// errorConnector is a driver.Connector whose connections always fail with
+// err.
+type errorConnector struct {
+	err error
+}
+
+func (c errorConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c errorConnector) Driver() driver.Driver {
+	return c
+}
+
+func (c errorConnector) Open(string) (driver.Conn, error) {
+	return nil, c.err
+}
+
+// GetDBConn implements gorm.GetDBConnector.
+func (p *connPool) GetDBConn() (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.DB, nil
+}
+
+// BeginTx implements gorm.ConnPoolBeginner.
+func (p *connPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	if err := checkDriverTags(ctx, opts == nil || !opts.ReadOnly); err != nil {
+		return nil, err
+	}
+	db, err := p.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The timestamp bound of a read-only transaction is taken from the
+	// read-only staleness of the connection.
+	bound, stale := ctx.Value(readOnlyTransactionKey{}).(spanner.TimestampBound)
+	stale = stale && opts != nil && opts.ReadOnly
+	if stale {
+		if err := setReadOnlyStaleness(conn, bound); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		if stale {
+			_ = setReadOnlyStaleness(conn, spanner.StrongRead())
+		}
+		_ = conn.Close()
+		return nil, err
+	}
+	batchDML := batchDMLEnabled(ctx) && (opts == nil || !opts.ReadOnly)
+	return &connTx{Tx: tx, ctx: ctx, db: db, conn: conn, translate: p.translate, minCommitDeadline: p.minCommitDeadline, stale: stale, batchDML: batchDML}, nil
+}
+
+// connTx is a transaction on a pinned connection. The connection is returned
+// to the pool when the transaction is committed or rolled back.
+type connTx struct {
+	*sql.Tx
+
+	ctx               context.Context
+	db                *sql.DB
+	conn              *sql.Conn
+	translate         func(query string) string
+	minCommitDeadline time.Duration
+	// stale is true if the read-only staleness of the connection must be
+	// reset when the transaction ends.
+	stale bool
+	transactionHooks
+	// batchDML is true if DML statements are batched automatically. inBatch
+	// is true if the transaction has started a batch that has not yet been
+	// sent to Spanner. batchErr is the error of a batch that was run before a
+	// QueryRowContext call, and is returned by Commit.
+	batchDML bool
+	inBatch  bool
+	batchErr error
+}
+
+func (tx *connTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query = translateQuery(tx.translate, query)
+	if err := tx.prepareBatch(ctx, query); err != nil {
+		return nil, err
+	}
+	return tx.Tx.ExecContext(ctx, query, args...)
+}
+
+func (tx *connTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if err := tx.runBatch(ctx); err != nil {
+		return nil, err
+	}
+	return tx.Tx.QueryContext(ctx, translateQuery(tx.translate, query), args...)
+}
+
+func (tx *connTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if err := tx.runBatch(ctx); err != nil && tx.batchErr == nil {
+		tx.batchErr = err
+	}
+	return tx.Tx.QueryRowContext(ctx, translateQuery(tx.translate, query), args...)
+}
+
+func (tx *connTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if err := tx.runBatch(ctx); err != nil {
+		return nil, err
+	}
+	return tx.Tx.PrepareContext(ctx, translateQuery(tx.translate, query))
+}
+
+// GetDBConn implements gorm.GetDBConnector.
+func (tx *connTx) GetDBConn() (*sql.DB, error) {
+	return tx.db, nil
+}
+
+func (tx *connTx) Commit() error {
+	err := tx.runBatch(tx.ctx)
+	if err == nil {
+		err = tx.batchErr
+	}
+	if err == nil {
+		err = tx.checkCommitDeadline()
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	err = tx.Tx.Commit()
+	tx.close()
+	switch ClassifyCommitError(err) {
+	case CommitOutcomeCommitted:
+		tx.runHooks(tx.afterCommit)
+	case CommitOutcomeNotCommitted:
+		tx.runHooks(tx.afterRollback)
+	default:
+		tx.runHooks(nil)
+	}
+	return err
+}
+
+func (tx *connTx) Rollback() error {
+	tx.inBatch = false
+	err := tx.Tx.Rollback()
+	tx.close()
+	tx.runHooks(tx.afterRollback)
+	return err
+}
+
+// transactionHooks are the functions that are called once after a
+// transaction has been committed or rolled back.
+type transactionHooks struct {
+	afterCommit   []func()
+	afterRollback []func()
+}
+
+// runHooks calls the given functions and clears all functions of the
+// transaction, so they are called at most once. gorm calls Rollback if Commit
+// fails.
+func (h *transactionHooks) runHooks(hooks []func()) {
+	h.afterCommit, h.afterRollback = nil, nil
+	for _, f := range hooks {
+		f()
+	}
+}
+
+// close returns the connection of the transaction to the pool.
+func (tx *connTx) close() {
+	if tx.stale {
+		// Reset the staleness before the connection is returned to the pool.
+		_ = setReadOnlyStaleness(tx.conn, spanner.StrongRead())
+	}
+	_ = tx.conn.Close()
+}
+
+// checkCommitDeadline returns a *CommitDeadlineError if the deadline of the
+// context of the transaction is closer than the minimum commit deadline.
+func (tx *connTx) checkCommitDeadline() error {
+	if tx.minCommitDeadline <= 0 || tx.ctx == nil {
+		return nil
+	}
+	deadline, ok := tx.ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	if remaining := time.Until(deadline); remaining < tx.minCommitDeadline {
+		return &CommitDeadlineError{Remaining: remaining, MinCommitDeadline: tx.minCommitDeadline}
+	}
+	return nil
+}
+
+// CommitDeadlineError is returned when a transaction is not committed, because
+// the remaining time until the deadline of the context of the transaction is
+// less than Config.MinCommitDeadline. The transaction is rolled back, and is
+// guaranteed not to have been committed.
+type CommitDeadlineError struct {
+	// Remaining is the time that was left until the deadline.
+	Remaining time.Duration
+	// MinCommitDeadline is the configured minimum commit deadline.
+	MinCommitDeadline time.Duration
+}
+
+func (e *CommitDeadlineError) Error() string {
+	return fmt.Sprintf("transaction was rolled back instead of committed: remaining time until deadline %v is less than %v", e.Remaining, e.MinCommitDeadline)
+}
+
+func translateQuery(translate func(query string) string, query string) string {
+	if translate == nil {
+		return query
+	}
+	return translate(query)
+}
+
+// WithSpannerConn calls f with the Spanner connection that is used by the
+// given gorm database. This gives access to features of the Spanner
+// database/sql driver that are not available through gorm, such as buffering
+// mutations in a transaction or reading the commit timestamp of the last
+// transaction.
+//
+// The function is called with the connection of the current transaction if db
+// is a transaction that was started with db.Transaction or db.Begin. Otherwise,
+// a connection is taken from the pool for the duration of the call. Changes to
+// the state of that connection, for example the read-only staleness, stay on
+// the connection when it is returned to the pool.
+//
+// Example:
+//
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//	  return spannergorm.WithSpannerConn(tx, func(conn spannerdriver.SpannerConn) error {
+//	    return conn.BufferWrite([]*spanner.Mutation{
+//	      spanner.Insert("singers", []string{"id", "name"}, []interface{}{1, "Name"}),
+//	    })
+//	  })
+//	})
+func WithSpannerConn(db *gorm.DB, f func(conn spannerdriver.SpannerConn) error) error {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	pool := db.Statement.ConnPool
+	if pool == nil {
+		pool = db.ConnPool
+	}
+	var conn *sql.Conn
+	switch p := unwrapConnPool(pool).(type) {
+	case *connTx:
+		conn = p.conn
+	case *migratorConn:
+		c, err := p.getConn(ctx)
+		if err != nil {
+			return err
+		}
+		conn = c
+	case *sql.Conn:
+		conn = p
+	case *sql.Tx:
+		return fmt.Errorf("the Spanner connection of a transaction that was not started by gorm cannot be accessed")
+	case *hybridConnPool:
+		return fmt.Errorf("a hybrid transaction does not have a Spanner connection, use the transaction of the client library instead")
+	default:
+		pool, err := sqlDB(ctx, db)
+		if err != nil {
+			return err
+		}
+		if conn, err = pool.Conn(ctx); err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+	return withSpannerConn(conn, f)
+}
+
+// withSpannerConn calls f with the Spanner connection of the given connection.
+func withSpannerConn(conn *sql.Conn, f func(conn spannerdriver.SpannerConn) error) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		spannerConn, ok := driverConn.(spannerdriver.SpannerConn)
+		if !ok {
+			return fmt.Errorf("not a Spanner connection: %T", driverConn)
+		}
+		return f(spannerConn)
+	})
+}
+
+// unwrapConnPool returns the connection pool or transaction that is wrapped
+// by a prepared statement pool or transaction.
+func unwrapConnPool(pool gorm.ConnPool) gorm.ConnPool {
+	switch p := pool.(type) {
+	case *gorm.PreparedStmtTX:
+		return unwrapConnPool(p.Tx)
+	case *gorm.PreparedStmtDB:
+		return unwrapConnPool(p.ConnPool)
+	}
+	return pool
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+)
+
+func TestWithSpannerConnInTransaction(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	_ = putSingerResult(server, "SELECT * FROM `singers` WHERE `singers`.`id` = @p1 ORDER BY `singers`.`id` LIMIT @p2", singerWithCommitTimestamp{ID: 1})
+	drainRequestsFromServer(server.TestSpanner)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var s singerWithCommitTimestamp
+		if err := tx.First(&s, 1).Error; err != nil {
+			return err
+		}
+		return WithSpannerConn(tx, func(conn spannerdriver.SpannerConn) error {
+			return conn.BufferWrite([]*spanner.Mutation{
+				spanner.Insert("singers", []string{"id", "first_name"}, []interface{}{2, "First"}),
+			})
+		})
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	executeReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(executeReqs), 1; g != w {
+		t.Fatalf("execute request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The mutation must have been included in the same transaction as the query.
+	commitReq := commitReqs[0].(*spannerpb.CommitRequest)
+	if g, w := len(commitReq.Mutations), 1; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWithSpannerConnOutsideTransaction(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	drainRequestsFromServer(server.TestSpanner)
+	err := WithSpannerConn(db, func(conn spannerdriver.SpannerConn) error {
+		_, err := conn.Apply(db.Statement.Context, []*spanner.Mutation{
+			spanner.Delete("singers", spanner.Key{1}),
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(commitReqs[0].(*spannerpb.CommitRequest).Mutations), 1; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMinCommitDeadline(t *testing.T) {
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{MinCommitDeadline: 10 * time.Second})
+	defer teardown()
+
+	_ = putSingerResult(server, "SELECT * FROM `singers` WHERE `singers`.`id` = @p1 ORDER BY `singers`.`id` LIMIT @p2", singerWithCommitTimestamp{ID: 1})
+	drainRequestsFromServer(server.TestSpanner)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var s singerWithCommitTimestamp
+		return tx.First(&s, 1).Error
+	})
+	var deadlineErr *CommitDeadlineError
+	if !errors.As(err, &deadlineErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, deadlineErr)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 0; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.RollbackRequest{}))), 1; g != w {
+		t.Fatalf("rollback request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Transactions with enough time left and transactions without a deadline
+	// are committed.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, tx := range []*gorm.DB{db.WithContext(ctx), db} {
+		if err := tx.Transaction(func(tx *gorm.DB) error {
+			var s singerWithCommitTimestamp
+			return tx.First(&s, 1).Error
+		}); err != nil {
+			t.Fatalf("failed to commit transaction: %v", err)
+		}
+	}
+	reqs = drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 2; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	sqlDB, _ := db.DB()
+	if g, w := sqlDB.Stats().InUse, 0; g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ConstraintOptions are the options for CreateConstraintWithOptions and
+// EnforceConstraint.
+type ConstraintOptions struct {
+	// NotEnforced creates a foreign key with NOT ENFORCED. Spanner does not
+	// validate the existing rows of the table when the foreign key is added,
+	// and does not enforce it for new rows, so a NOT ENFORCED foreign key is
+	// added quickly to a large table. Use EnforceConstraint to validate and
+	// enforce the foreign key later. Only supported for foreign keys.
+	NotEnforced bool
+	// DDLOptions are the options for the schema update that adds the
+	// constraint. Spanner validates the existing rows of the table as part of
+	// the schema update, and DDLOptions.Progress is called with the progress
+	// of the validation.
+	DDLOptions DDLBatchOptions
+}
+
+// ConstraintValidationError is returned by CreateConstraintWithOptions and
+// EnforceConstraint if one or more existing rows violate the constraint.
+type ConstraintValidationError struct {
+	// Table is the table of the constraint.
+	Table string
+	// Constraint is the name of the constraint.
+	Constraint string
+	// Statement is the DDL statement that failed.
+	Statement string
+	// Err is the error that was returned by Spanner, which describes a row
+	// that violates the constraint.
+	Err error
+}
+
+func (e *ConstraintValidationError) Error() string {
+	return fmt.Sprintf("existing rows of %s violate constraint %s: %v", e.Table, e.Constraint, e.Err)
+}
+
+func (e *ConstraintValidationError) Unwrap() error {
+	return e.Err
+}
+
+// CreateConstraintWithOptions adds the foreign key or check constraint with
+// the given name to an existing table, and waits for Spanner to validate the
+// existing rows of the table. The progress of the validation is reported to
+// options.DDLOptions.Progress, and a *ConstraintValidationError is returned if
+// an existing row violates the constraint. The constraint is not added in
+// that case.
+//
+// Adding a constraint to a large table can take a long time. Set NotEnforced
+// to add a foreign key without validating the existing rows, and call
+// EnforceConstraint to validate and enforce it when the data has been
+// cleaned up. CreateConstraintWithOptions cannot be called while a DDL batch
+// is active.
+//
+// Example:
+//
+//	err := m.CreateConstraintWithOptions(&Album{}, "fk_albums_singer", spannergorm.ConstraintOptions{
+//	  DDLOptions: spannergorm.DDLBatchOptions{
+//	    Progress: func(p spannergorm.DDLBatchProgress) { log.Printf("validated %d%%", p.Percent) },
+//	  },
+//	})
+//	var validationErr *spannergorm.ConstraintValidationError
+//	if errors.As(err, &validationErr) {
+//	  log.Printf("fix the rows of %s: %v", validationErr.Table, validationErr.Err)
+//	}
+func (m spannerMigrator) CreateConstraintWithOptions(value interface{}, name string, options ConstraintOptions) error {
+	table, definition, err := m.constraintDefinition(value, name, options.NotEnforced)
+	if err != nil {
+		return err
+	}
+	return m.executeConstraintDDL(table, name, []string{fmt.Sprintf("ALTER TABLE %s ADD %s", table, definition)}, options.DDLOptions)
+}
+
+// EnforceConstraint replaces a NOT ENFORCED foreign key that was added with
+// CreateConstraintWithOptions with a foreign key that is enforced. Spanner
+// validates the existing rows of the table, and the progress of the
+// validation is reported to options.DDLOptions.Progress. If an existing row
+// violates the foreign key, a *ConstraintValidationError is returned, and the
+// NOT ENFORCED foreign key is added again. options.NotEnforced is ignored.
+func (m spannerMigrator) EnforceConstraint(value interface{}, name string, options ConstraintOptions) error {
+	table, definition, err := m.constraintDefinition(value, name, false)
+	if err != nil {
+		return err
+	}
+	drop := m.DB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Exec("ALTER TABLE ? DROP CONSTRAINT ?", clause.Table{Name: table}, clause.Column{Name: name})
+	})
+	// Spanner cannot change a NOT ENFORCED foreign key, so it is dropped and
+	// added again in one schema update.
+	err = m.executeConstraintDDL(table, name, []string{drop, fmt.Sprintf("ALTER TABLE %s ADD %s", table, definition)}, options.DDLOptions)
+	var validationErr *ConstraintValidationError
+	if errors.As(err, &validationErr) {
+		if _, notEnforced, defErr := m.constraintDefinition(value, name, true); defErr == nil {
+			_ = m.executeConstraintDDL(table, name, []string{fmt.Sprintf("ALTER TABLE %s ADD %s", table, notEnforced)}, DDLBatchOptions{})
+		}
+	}
+	return err
+}
+
+// constraintDefinition returns the quoted table name and the definition of
+// the foreign key or check constraint with the given name of the given model.
+func (m spannerMigrator) constraintDefinition(value interface{}, name string, notEnforced bool) (string, string, error) {
+	var table, definition string
+	err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		constraint, tableName := m.GuessConstraintInterfaceAndTable(stmt, name)
+		var sql string
+		var vars []interface{}
+		switch c := constraint.(type) {
+		case *schema.Constraint:
+			sql, vars = buildConstraint(c)
+			if notEnforced {
+				sql += " NOT ENFORCED"
+			}
+		case *schema.CheckConstraint:
+			if notEnforced {
+				return fmt.Errorf("NOT ENFORCED is only supported for foreign keys, and %s is a check constraint", name)
+			}
+			sql, vars = "CONSTRAINT ? CHECK (?)", []interface{}{clause.Column{Name: c.Name}, clause.Expr{SQL: c.Constraint}}
+		default:
+			return fmt.Errorf("failed to look up constraint with name: %s", name)
+		}
+		table = m.DB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return tx.Raw("?", clause.Table{Name: tableName})
+		})
+		definition = m.DB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return tx.Raw(sql, vars...)
+		})
+		return nil
+	})
+	return table, definition, err
+}
+
+// executeConstraintDDL executes the given statements that add a constraint as
+// one schema update, and returns a *ConstraintValidationError if Spanner
+// rejects the constraint because of the existing rows of the table.
+func (m spannerMigrator) executeConstraintDDL(table, name string, statements []string, options DDLBatchOptions) error {
+	if m.conn.batching {
+		return fmt.Errorf("constraints with options cannot be created while a DDL batch is active")
+	}
+	err := m.executeDDLBatchWithOptions(m.DB.Statement.Context, statements, options)
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) == codes.FailedPrecondition {
+		statement := statements[len(statements)-1]
+		var batchErr *BatchDDLError
+		if errors.As(err, &batchErr) {
+			statement = batchErr.Statement
+		}
+		return &ConstraintValidationError{Table: unquoteIdentifier(table), Constraint: name, Statement: statement, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type checkedRelease struct {
+	ID     int64 `gorm:"primaryKey;autoIncrement:false"`
+	Rating int64 `gorm:"check:chk_checked_releases_rating,rating > 0"`
+}
+
+func succeededDDLOperation(t *testing.T, commits int) *longrunningpb.Operation {
+	metadata, err := anypb.New(&databasepb.UpdateDatabaseDdlMetadata{CommitTimestamps: make([]*timestamppb.Timestamp, commits)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &longrunningpb.Operation{
+		Name:     "test-operation",
+		Done:     true,
+		Metadata: metadata,
+		Result:   &longrunningpb.Operation_Response{Response: response},
+	}
+}
+
+func failedDDLOperation(t *testing.T, commits int, message string) *longrunningpb.Operation {
+	metadata, err := anypb.New(&databasepb.UpdateDatabaseDdlMetadata{CommitTimestamps: make([]*timestamppb.Timestamp, commits)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &longrunningpb.Operation{
+		Name:     "test-operation",
+		Done:     true,
+		Metadata: metadata,
+		Result: &longrunningpb.Operation_Error{Error: &statuspb.Status{
+			Code:    int32(codes.FailedPrecondition),
+			Message: message,
+		}},
+	}
+}
+
+func ddlStatements(server interface {
+	Reqs() []proto.Message
+}) [][]string {
+	var statements [][]string
+	for _, request := range server.Reqs() {
+		statements = append(statements, request.(*databasepb.UpdateDatabaseDdlRequest).GetStatements())
+	}
+	return statements
+}
+
+func TestCreateConstraintWithOptions(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	server.TestDatabaseAdmin.SetResps([]proto.Message{succeededDDLOperation(t, 1), succeededDDLOperation(t, 1)})
+
+	m := db.Migrator().(ConstraintMigrator)
+	defer m.(io.Closer).Close()
+	var progress []DDLBatchProgress
+	if err := m.CreateConstraintWithOptions(&release{}, "fk_releases_label", ConstraintOptions{
+		NotEnforced: true,
+		DDLOptions: DDLBatchOptions{
+			Progress: func(p DDLBatchProgress) { progress = append(progress, p) },
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateConstraintWithOptions(&checkedRelease{}, "chk_checked_releases_rating", ConstraintOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"ALTER TABLE `releases` ADD CONSTRAINT `fk_releases_label` FOREIGN KEY (`label_id`) REFERENCES `labels`(`id`) ON DELETE CASCADE NOT ENFORCED"},
+		{"ALTER TABLE `checked_releases` ADD CONSTRAINT `chk_checked_releases_rating` CHECK (rating > 0)"},
+	}
+	if g, w := ddlStatements(server.TestDatabaseAdmin), want; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(progress), 1; g != w || !progress[0].Done {
+		t.Fatalf("progress mismatch\n Got: %+v\nWant: %v done", progress, w)
+	}
+
+	// NOT ENFORCED is only supported for foreign keys.
+	if err := m.CreateConstraintWithOptions(&checkedRelease{}, "chk_checked_releases_rating", ConstraintOptions{NotEnforced: true}); err == nil {
+		t.Fatal("missing error for NOT ENFORCED check constraint")
+	}
+	if err := m.CreateConstraintWithOptions(&release{}, "fk_unknown", ConstraintOptions{}); err == nil {
+		t.Fatal("missing error for unknown constraint")
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 2; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestCreateConstraintWithOptionsValidationError(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	server.TestDatabaseAdmin.SetResps([]proto.Message{failedDDLOperation(t, 0, "Foreign key constraint `fk_releases_label` is violated on table `releases`.")})
+
+	m := db.Migrator().(ConstraintMigrator)
+	defer m.(io.Closer).Close()
+	err := m.CreateConstraintWithOptions(&release{}, "fk_releases_label", ConstraintOptions{})
+	var validationErr *ConstraintValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, validationErr)
+	}
+	if g, w := validationErr.Table, "releases"; g != w {
+		t.Fatalf("table mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := validationErr.Constraint, "fk_releases_label"; g != w {
+		t.Fatalf("constraint mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := validationErr.Statement, "ALTER TABLE `releases` ADD CONSTRAINT `fk_releases_label` FOREIGN KEY (`label_id`) REFERENCES `labels`(`id`) ON DELETE CASCADE"; g != w {
+		t.Fatalf("statement mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestEnforceConstraint(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name    string
+		resps   func(t *testing.T) []proto.Message
+		wantErr bool
+		want    [][]string
+	}{
+		{
+			name:  "valid",
+			resps: func(t *testing.T) []proto.Message { return []proto.Message{succeededDDLOperation(t, 2)} },
+			want: [][]string{{
+				"ALTER TABLE `releases` DROP CONSTRAINT `fk_releases_label`",
+				"ALTER TABLE `releases` ADD CONSTRAINT `fk_releases_label` FOREIGN KEY (`label_id`) REFERENCES `labels`(`id`) ON DELETE CASCADE",
+			}},
+		},
+		{
+			name: "violated",
+			resps: func(t *testing.T) []proto.Message {
+				return []proto.Message{
+					failedDDLOperation(t, 1, "Foreign key constraint `fk_releases_label` is violated on table `releases`."),
+					succeededDDLOperation(t, 1),
+				}
+			},
+			wantErr: true,
+			want: [][]string{
+				{
+					"ALTER TABLE `releases` DROP CONSTRAINT `fk_releases_label`",
+					"ALTER TABLE `releases` ADD CONSTRAINT `fk_releases_label` FOREIGN KEY (`label_id`) REFERENCES `labels`(`id`) ON DELETE CASCADE",
+				},
+				// The NOT ENFORCED foreign key is added again.
+				{"ALTER TABLE `releases` ADD CONSTRAINT `fk_releases_label` FOREIGN KEY (`label_id`) REFERENCES `labels`(`id`) ON DELETE CASCADE NOT ENFORCED"},
+			},
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, server, teardown := setupTestGormConnection(t)
+			defer teardown()
+			server.TestDatabaseAdmin.SetResps(test.resps(t))
+
+			m := db.Migrator().(ConstraintMigrator)
+			defer m.(io.Closer).Close()
+			err := m.EnforceConstraint(&release{}, "fk_releases_label", ConstraintOptions{})
+			var validationErr *ConstraintValidationError
+			if g, w := errors.As(err, &validationErr), test.wantErr; g != w {
+				t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, w)
+			}
+			if !test.wantErr && err != nil {
+				t.Fatal(err)
+			}
+			if g, w := ddlStatements(server.TestDatabaseAdmin), test.want; !reflect.DeepEqual(g, w) {
+				t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultCopyTableBatchSize = 1000
+
+// CopyTableOptions are the options for CopyTableWithOptions.
+type CopyTableOptions struct {
+	// Where is an optional condition for the rows that are copied. The values
+	// are passed to gorm's Where function, e.g. []interface{}{"active = ?", true}.
+	Where []interface{}
+	// BatchSize is the maximum number of rows that are copied in one
+	// transaction. The default is 1000. Reduce the batch size if the copy
+	// exceeds the mutation limit of Spanner for tables with many columns or
+	// indexes.
+	BatchSize int
+}
+
+// CopyTable creates the table of the destination model if it does not exist,
+// and copies the rows of the source table to it. See CopyTableWithOptions for
+// more information.
+func (m spannerMigrator) CopyTable(src, dst interface{}, where ...interface{}) error {
+	return m.CopyTableWithOptions(src, dst, CopyTableOptions{Where: where})
+}
+
+// CopyTableWithOptions creates the table of the destination model if it does
+// not exist, and copies the rows of the source table to it. Spanner does not
+// support CREATE TABLE AS SELECT. Use this method instead, for example to
+// change the primary key of a table, by copying the data to a new table with
+// a different primary key.
+//
+// The source can be a model or a table name. All columns of the destination
+// model that also exist in the source table are copied. The rows are copied in
+// batches in primary key order of the source table, and each batch is copied
+// with an INSERT ... SELECT statement in a separate transaction. The copy can
+// therefore be stopped halfway, in which case only part of the rows have been
+// copied. The primary key columns of the source table may not contain NULL
+// values.
+//
+// Example:
+//
+//	// Copy all active singers to a table with a different primary key.
+//	err := m.CopyTable("singers", &SingerByName{}, "active = ?", true)
+func (m spannerMigrator) CopyTableWithOptions(src, dst interface{}, options CopyTableOptions) error {
+	if m.conn.batching {
+		return fmt.Errorf("CopyTable cannot be called while a DDL batch is active")
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCopyTableBatchSize
+	}
+	srcTable, err := m.tableNameOf(src)
+	if err != nil {
+		return err
+	}
+	if !m.HasTable(dst) {
+		if err := m.CreateTable(dst); err != nil {
+			return err
+		}
+	}
+	keyColumns, err := m.primaryKeyColumns(srcTable)
+	if err != nil {
+		return err
+	}
+	if len(keyColumns) == 0 {
+		return fmt.Errorf("table %s not found", srcTable)
+	}
+	var srcColumns []string
+	srcSchema, srcName := m.tableSchemaAndName(srcTable)
+	if err := m.DB.Raw(
+		"SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		srcSchema, srcName).Scan(&srcColumns).Error; err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(srcColumns))
+	for _, column := range srcColumns {
+		existing[column] = true
+	}
+
+	return m.RunWithValue(dst, func(stmt *gorm.Statement) error {
+		var columns, quoted []string
+		for _, dbName := range stmt.Schema.DBNames {
+			field := stmt.Schema.FieldsByDBName[dbName]
+			if field.Creatable && !field.IgnoreMigration && existing[dbName] {
+				columns = append(columns, dbName)
+				quoted = append(quoted, m.DB.Statement.Quote(clause.Column{Name: dbName}))
+			}
+		}
+		if len(columns) == 0 {
+			return fmt.Errorf("table %s and %s have no columns in common", srcTable, stmt.Table)
+		}
+		quotedKey := make([]string, len(keyColumns))
+		for i, column := range keyColumns {
+			quotedKey[i] = m.DB.Statement.Quote(clause.Column{Name: column})
+		}
+
+		var last []interface{}
+		for {
+			query := func() *gorm.DB {
+				tx := m.DB.Session(&gorm.Session{NewDB: true}).Table(srcTable)
+				if len(options.Where) > 0 {
+					tx = tx.Where(options.Where[0], options.Where[1:]...)
+				}
+				if last != nil {
+					tx = tx.Where(keyComparison(keyColumns, last, ">", false))
+				}
+				return tx
+			}
+			// Get the primary key of the last row in this batch.
+			upper := make([]interface{}, len(keyColumns))
+			dest := make([]interface{}, len(keyColumns))
+			for i := range upper {
+				dest[i] = &upper[i]
+			}
+			rows, err := query().
+				Select(strings.Join(quotedKey, ",")).
+				Order(strings.Join(quotedKey, ",")).
+				Offset(batchSize - 1).
+				Limit(1).
+				Rows()
+			if err != nil {
+				return err
+			}
+			found := rows.Next()
+			if found {
+				err = rows.Scan(dest...)
+			} else {
+				err = rows.Err()
+			}
+			if closeErr := rows.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+
+			batch := query().Select(strings.Join(quoted, ","))
+			if found {
+				batch = batch.Where(keyComparison(keyColumns, upper, "<", true))
+			}
+			if err := m.DB.Session(&gorm.Session{NewDB: true}).Table(qualifiedTableName(stmt)).Select(columns).Create(batch).Error; err != nil {
+				return err
+			}
+			if !found {
+				return nil
+			}
+			last = upper
+		}
+	})
+}
+
+// tableNameOf returns the name of the table of the given model or table name.
+func (m spannerMigrator) tableNameOf(value interface{}) (string, error) {
+	if name, ok := value.(string); ok {
+		return name, nil
+	}
+	stmt := &gorm.Statement{DB: m.DB}
+	if err := stmt.Parse(value); err != nil {
+		return "", err
+	}
+	return qualifiedTableName(stmt), nil
+}
+
+// primaryKeyColumns returns the primary key columns of the given table in
+// key order.
+func (m spannerMigrator) primaryKeyColumns(table string) ([]string, error) {
+	var columns []string
+	tableSchema, table := m.tableSchemaAndName(table)
+	err := m.DB.Raw(
+		`SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.INDEX_COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND INDEX_TYPE = 'PRIMARY_KEY'
+		ORDER BY ORDINAL_POSITION`, tableSchema, table).Scan(&columns).Error
+	return columns, err
+}
+
+// keyComparison returns a lexicographic comparison of the given key columns
+// with the given values, e.g. `(a > @p1) OR (a = @p1 AND b > @p2)` for
+// op '>'. The comparison also matches the key itself if inclusive is true.
+func keyComparison(columns []string, values []interface{}, op string, inclusive bool) clause.Expression {
+	var conditions []clause.Expression
+	for i := range columns {
+		var and []clause.Expression
+		for j := 0; j < i; j++ {
+			and = append(and, clause.Eq{Column: clause.Column{Name: columns[j]}, Value: values[j]})
+		}
+		and = append(and, clause.Expr{SQL: "? " + op + " ?", Vars: []interface{}{clause.Column{Name: columns[i]}, values[i]}})
+		conditions = append(conditions, clause.And(and...))
+	}
+	if inclusive {
+		var and []clause.Expression
+		for i := range columns {
+			and = append(and, clause.Eq{Column: clause.Column{Name: columns[i]}, Value: values[i]})
+		}
+		conditions = append(conditions, clause.And(and...))
+	}
+	return clause.Or(conditions...)
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+)
+
+type singerCopy struct {
+	ID       int64 `gorm:"primaryKey;autoIncrement:false"`
+	LastName string
+	Unknown  string
+}
+
+func TestCopyTable(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 1)
+	_ = putStringRowsResult(server, "SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.INDEX_COLUMNS\n\t\tWHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2 AND INDEX_TYPE = 'PRIMARY_KEY'\n\t\tORDER BY ORDINAL_POSITION",
+		[]string{"COLUMN_NAME"}, [][]string{{"id"}})
+	_ = putStringRowsResult(server, "SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2",
+		[]string{"COLUMN_NAME"}, [][]string{{"id"}, {"first_name"}, {"last_name"}})
+	_ = putCountStatementResult(server, "SELECT `id` FROM `singers` WHERE active = @p1 ORDER BY `id` LIMIT @p2 OFFSET @p3", 2)
+	_ = putStringRowsResult(server, "SELECT `id` FROM `singers` WHERE active = @p1 AND `id` > @p2 ORDER BY `id` LIMIT @p3 OFFSET @p4",
+		[]string{"id"}, [][]string{})
+	firstBatchSql := "INSERT INTO `singer_copies` (`id`,`last_name`) SELECT `id`,`last_name` FROM `singers` WHERE active = @p1 AND (`id` < @p2 OR `id` = @p3)"
+	lastBatchSql := "INSERT INTO `singer_copies` (`id`,`last_name`) SELECT `id`,`last_name` FROM `singers` WHERE active = @p1 AND `id` > @p2"
+	for _, sql := range []string{firstBatchSql, lastBatchSql} {
+		_ = server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+			Type:        testutil.StatementResultUpdateCount,
+			UpdateCount: 2,
+		})
+	}
+	drainRequestsFromServer(server.TestSpanner)
+
+	m := db.Migrator().(DataMigrator)
+	defer m.(io.Closer).Close()
+	if err := m.CopyTableWithOptions("singers", &singerCopy{}, CopyTableOptions{
+		Where:     []interface{}{"active = ?", true},
+		BatchSize: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	var inserts []*spannerpb.ExecuteSqlRequest
+	for _, req := range requestsOfType(requests, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		if sql := req.(*spannerpb.ExecuteSqlRequest).Sql; sql == firstBatchSql || sql == lastBatchSql {
+			inserts = append(inserts, req.(*spannerpb.ExecuteSqlRequest))
+		}
+	}
+	if g, w := len(inserts), 2; g != w {
+		t.Fatalf("insert count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := inserts[0].Sql, firstBatchSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := inserts[0].Params.Fields["p2"].GetStringValue(), "2"; g != w {
+		t.Fatalf("param mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := inserts[1].Params.Fields["p2"].GetStringValue(), "2"; g != w {
+		t.Fatalf("param mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The DDL statement for the destination table is not executed, as the
+	// table already exists.
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// credentialsGenerationParam is added to the connection string when the
+// credentials are rotated. The Spanner driver shares one Spanner client
+// between all connection pools with the same connection string, so the
+// connection string must change to create a client with new credentials,
+// also if the new credentials are read from the same file. The driver ignores
+// unknown properties.
+const credentialsGenerationParam = "credentialsGeneration"
+
+// RotateCredentials replaces the credentials of the given gorm database
+// without reopening it, for example to switch to a new service account key.
+// credentialsFile is the path of the new credentials file. An empty path
+// means Application Default Credentials. The file may be the same file as
+// before, if the file has been updated with new credentials.
+//
+// A new connection pool with a new Spanner client is created with the new
+// credentials, and the creation of the client is verified before the pool
+// replaces the current pool. Statements that are executed after
+// RotateCredentials returns use the new pool. Transactions that are running
+// while the credentials are rotated finish on their connections in the old
+// pool. The old Spanner client and its gRPC channels are closed when the last
+// connection of the old pool is closed. Operations that use the Spanner
+// client of the dialector directly, such as QueryRows, ScanTable and Export,
+// and that are running while the credentials are rotated fail, and must be
+// retried.
+//
+// The maximum number of open connections is copied to the new pool. Other
+// settings of the connection pool, such as SetMaxIdleConns, must be applied
+// again to the pool that is returned by db.DB().
+//
+// Example:
+//
+//	if err := spannergorm.RotateCredentials(ctx, db, "/secrets/new-key.json"); err != nil {
+//	  return err
+//	}
+func RotateCredentials(ctx context.Context, db *gorm.DB, credentialsFile string) error {
+	pool, ok := unwrapConnPool(db.ConnPool).(*connPool)
+	if !ok || pool.dsn == "" {
+		return fmt.Errorf("credentials can only be rotated for a gorm database that was opened with a DSN")
+	}
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return err
+	}
+	dsn, err := pool.rotateCredentials(ctx, credentialsFile)
+	if err != nil {
+		return err
+	}
+	// Prepared statements are bound to the pool that prepared them.
+	if prepared, ok := db.ConnPool.(*gorm.PreparedStmtDB); ok {
+		prepared.Reset()
+	}
+	if dialector.sharedClient != nil {
+		dialector.sharedClient.rotate(dsn)
+	}
+	return nil
+}
+
+// rotateCredentials replaces the connection pools with pools that use the
+// given credentials file, and returns the new connection string.
+func (p *connPool) rotateCredentials(ctx context.Context, credentialsFile string) (string, error) {
+	p.rotateMu.Lock()
+	defer p.rotateMu.Unlock()
+
+	p.mu.Lock()
+	dsn := withCredentials(p.dsn, credentialsFile, p.generation+1)
+	maxOpen := p.DB.Stats().MaxOpenConnections
+	p.mu.Unlock()
+
+	db, err := p.openDB(p.driverName, dsn)
+	if err != nil {
+		return "", err
+	}
+	db.SetMaxOpenConns(maxOpen)
+	// Opening a connection creates the Spanner client of the new pool.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		_ = db.Close()
+		return "", err
+	}
+	_ = conn.Close()
+
+	p.mu.Lock()
+	old := []*sql.DB{p.DB}
+	for _, pool := range p.priorityPools {
+		old = append(old, pool)
+	}
+	p.DB, p.dsn, p.priorityPools = db, dsn, nil
+	p.generation++
+	p.mu.Unlock()
+
+	// Connections that are in use are closed when they are returned to the
+	// closed pool.
+	for _, pool := range old {
+		_ = pool.Close()
+	}
+	return dsn, nil
+}
+
+// withCredentials returns the given connection string with the given
+// credentials file and credentials generation.
+func withCredentials(dsn, credentialsFile string, generation int) string {
+	base, params := dsn, ""
+	start := strings.Index(dsn, "projects/")
+	if start < 0 {
+		start = 0
+	}
+	if i := strings.IndexAny(dsn[start:], "?;"); i >= 0 {
+		base, params = dsn[:start+i], dsn[start+i+1:]
+	}
+	var result []string
+	for _, param := range strings.Split(params, ";") {
+		key, _, _ := strings.Cut(param, "=")
+		if param == "" || strings.EqualFold(key, "credentials") || strings.EqualFold(key, credentialsGenerationParam) {
+			continue
+		}
+		result = append(result, param)
+	}
+	if credentialsFile != "" {
+		result = append(result, "credentials="+credentialsFile)
+	}
+	result = append(result, credentialsGenerationParam+"="+strconv.Itoa(generation))
+	return base + ";" + strings.Join(result, ";")
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+func TestWithCredentials(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		dsn             string
+		credentialsFile string
+		want            string
+	}{
+		{
+			dsn:             "projects/p/instances/i/databases/d",
+			credentialsFile: "/keys/new.json",
+			want:            "projects/p/instances/i/databases/d;credentials=/keys/new.json;credentialsGeneration=1",
+		},
+		{
+			dsn:             "localhost:9010/projects/p/instances/i/databases/d?credentials=/keys/old.json;minSessions=10",
+			credentialsFile: "/keys/new.json",
+			want:            "localhost:9010/projects/p/instances/i/databases/d;minSessions=10;credentials=/keys/new.json;credentialsGeneration=1",
+		},
+		{
+			dsn:  "projects/p/instances/i/databases/d;Credentials=/keys/old.json;credentialsGeneration=3;",
+			want: "projects/p/instances/i/databases/d;credentialsGeneration=1",
+		},
+	} {
+		if g, w := withCredentials(test.dsn, test.credentialsFile, 1), test.want; g != w {
+			t.Errorf("%s: dsn mismatch\n Got: %v\nWant: %v", test.dsn, g, w)
+		}
+	}
+}
+
+func TestRotateCredentials(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	if err := db.Exec(testutil.UpdateBarSetFoo).Error; err != nil {
+		t.Fatal(err)
+	}
+	before, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before.SetMaxOpenConns(7)
+
+	if err := RotateCredentials(context.Background(), db, ""); err != nil {
+		t.Fatal(err)
+	}
+	after, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after == before {
+		t.Fatal("connection pool was not replaced")
+	}
+	if g, w := after.Stats().MaxOpenConnections, 7; g != w {
+		t.Fatalf("max open connections mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if err := before.Ping(); err == nil {
+		t.Fatal("old connection pool was not closed")
+	}
+	// The prepared statement of the query must not use the old pool.
+	if err := db.Exec(testutil.UpdateBarSetFoo).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Exec(testutil.UpdateBarSetFoo).Error
+	}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := DebugInfo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := info.Params["credentialsgeneration"], "<redacted>"; g != w {
+		t.Fatalf("credentials generation mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestRotateCredentialsInvalidFile(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+	before, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RotateCredentials(context.Background(), db, "/non-existing/key.json"); err == nil {
+		t.Fatal("missing error for invalid credentials file")
+	}
+	after, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Fatal("connection pool was replaced")
+	}
+	if err := after.Ping(); err != nil {
+		t.Fatalf("connection pool is not usable: %v", err)
+	}
+}
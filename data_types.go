@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// dataTypeNames maps the names of data types to the GoogleSQL data type that
+// they are normalized to when the type of a column in the database is compared
+// with the type of a field. It contains the types of the SPANNER_TYPE column
+// of INFORMATION_SCHEMA.COLUMNS, and the gorm data types of fields, which are
+// used if a field has a type tag such as `gorm:"type:int"`. Add new Spanner
+// data types here to make them known to the migrator.
+var dataTypeNames = map[string]string{
+	"BOOL":      "BOOL",
+	"BYTES":     "BYTES",
+	"DATE":      "DATE",
+	"FLOAT32":   "FLOAT32",
+	"FLOAT64":   "FLOAT64",
+	"INT64":     "INT64",
+	"INTERVAL":  "INTERVAL",
+	"JSON":      "JSON",
+	"NUMERIC":   "NUMERIC",
+	"STRING":    "STRING",
+	"TIMESTAMP": "TIMESTAMP",
+	"TOKENLIST": "TOKENLIST",
+
+	strings.ToUpper(string(schema.Bool)):   "BOOL",
+	strings.ToUpper(string(schema.Int)):    "INT64",
+	strings.ToUpper(string(schema.Uint)):   "INT64",
+	strings.ToUpper(string(schema.Float)):  "FLOAT64",
+	strings.ToUpper(string(schema.String)): "STRING",
+	strings.ToUpper(string(schema.Time)):   "TIMESTAMP",
+	strings.ToUpper(string(schema.Bytes)):  "BYTES",
+}
+
+var dataTypeLength = regexp.MustCompile(`\([^)]*\)`)
+
+// normalizeDataType returns the GoogleSQL data type of the given type without
+// length and options, e.g. STRING for STRING(100), ARRAY<STRING> for
+// ARRAY<STRING(MAX)>, TIMESTAMP for TIMESTAMP OPTIONS (allow_commit_timestamp=true)
+// and INT64 for the gorm data type int. Unknown types are returned in upper
+// case without length and options.
+func normalizeDataType(dataType string) string {
+	fields := strings.Fields(dataTypeLength.ReplaceAllString(dataType, ""))
+	if len(fields) == 0 {
+		return ""
+	}
+	name := strings.ToUpper(fields[0])
+	if strings.HasPrefix(name, "ARRAY<") && strings.HasSuffix(name, ">") {
+		return "ARRAY<" + normalizeDataType(name[len("ARRAY<"):len(name)-1]) + ">"
+	}
+	if normalized, ok := dataTypeNames[name]; ok {
+		return normalized
+	}
+	return name
+}
+
+// dataTypeAliases returns the lower case names of the data types other than
+// the given type that are normalized to the same GoogleSQL data type. gorm
+// compares the aliases of a type with the prefix of the type of a field, so
+// names that are a prefix of a different data type, such as float for
+// FLOAT32, are not returned.
+func dataTypeAliases(dataType string) []string {
+	normalized := normalizeDataType(dataType)
+	var aliases []string
+	for name, n := range dataTypeNames {
+		if n != normalized || strings.EqualFold(name, dataType) || isPrefixOfOtherDataType(name, n) {
+			continue
+		}
+		aliases = append(aliases, strings.ToLower(name))
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+func isPrefixOfOtherDataType(name, normalized string) bool {
+	for other, n := range dataTypeNames {
+		if n != normalized && strings.HasPrefix(other, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeDataType(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		dataType string
+		want     string
+	}{
+		{"", ""},
+		{"STRING(MAX)", "STRING"},
+		{"STRING(100) NOT NULL", "STRING"},
+		{"string", "STRING"},
+		{"BYTES(1024)", "BYTES"},
+		{"INT64", "INT64"},
+		{"int", "INT64"},
+		{"uint", "INT64"},
+		{"float", "FLOAT64"},
+		{"FLOAT32", "FLOAT32"},
+		{"bool", "BOOL"},
+		{"time", "TIMESTAMP"},
+		{"TIMESTAMP OPTIONS (allow_commit_timestamp=true)", "TIMESTAMP"},
+		{"INTERVAL", "INTERVAL"},
+		{"TOKENLIST", "TOKENLIST"},
+		{"ARRAY<STRING(MAX)>", "ARRAY<STRING>"},
+		{"array<int>", "ARRAY<INT64>"},
+		{"ARRAY<FLOAT32>", "ARRAY<FLOAT32>"},
+		{"my_type", "MY_TYPE"},
+	} {
+		if g, w := normalizeDataType(test.dataType), test.want; g != w {
+			t.Errorf("%q: normalized data type mismatch\n Got: %v\nWant: %v", test.dataType, g, w)
+		}
+	}
+}
+
+func TestDataTypeAliases(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		dataType string
+		want     []string
+	}{
+		// int and float are prefixes of interval and float32, and are
+		// therefore not returned as aliases.
+		{"int64", []string{"uint"}},
+		{"float64", nil},
+		{"timestamp", []string{"time"}},
+		{"float32", nil},
+		{"string", nil},
+		{"tokenlist", nil},
+	} {
+		if g, w := dataTypeAliases(test.dataType), test.want; !reflect.DeepEqual(g, w) {
+			t.Errorf("%q: aliases mismatch\n Got: %v\nWant: %v", test.dataType, g, w)
+		}
+	}
+}
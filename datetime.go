@@ -0,0 +1,111 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	postgresIntervalRegExp = regexp.MustCompile(`(?i)\bINTERVAL\s+'\s*(\d+)\s+([a-z]+)\s*'`)
+	currentTimestampRegExp = regexp.MustCompile(`(?i)\b(?:NOW|UTC_TIMESTAMP|SYSDATE)\s*\(\s*\)|\bCURRENT_TIMESTAMP\b(?:\s*\(\s*\d*\s*\))?|\bLOCALTIMESTAMP\b(?:\s*\(\s*\d*\s*\))?`)
+	currentDateRegExp      = regexp.MustCompile(`(?i)\bCURDATE\s*\(\s*\)|\bCURRENT_DATE\b(?:\s*\(\s*\))?`)
+	intervalRegExp         = regexp.MustCompile("(?i)((?:`[^`]+`|[a-z_][a-z0-9_]*)(?:\\.(?:`[^`]+`|[a-z_][a-z0-9_]*))*(?:\\(\\))?|@[a-z0-9_]+|\\?)\\s*([+-])\\s*INTERVAL\\s+(\\d+)\\s+([a-z]+)\\b")
+)
+
+// timestampIntervalUnits contains the units that are supported by
+// TIMESTAMP_ADD and TIMESTAMP_SUB, including the plural forms that are used by
+// PostgreSQL.
+var timestampIntervalUnits = map[string]string{
+	"NANOSECOND": "NANOSECOND", "NANOSECONDS": "NANOSECOND",
+	"MICROSECOND": "MICROSECOND", "MICROSECONDS": "MICROSECOND",
+	"MILLISECOND": "MILLISECOND", "MILLISECONDS": "MILLISECOND",
+	"SECOND": "SECOND", "SECONDS": "SECOND",
+	"MINUTE": "MINUTE", "MINUTES": "MINUTE",
+	"HOUR": "HOUR", "HOURS": "HOUR",
+	"DAY": "DAY", "DAYS": "DAY",
+}
+
+// translateDateTimeFunctions rewrites common MySQL and PostgreSQL date/time
+// expressions in the given SQL string to their Spanner GoogleSQL equivalents:
+//
+//   - NOW(), UTC_TIMESTAMP(), SYSDATE(), LOCALTIMESTAMP and CURRENT_TIMESTAMP
+//     with or without a precision are rewritten to CURRENT_TIMESTAMP().
+//   - CURDATE() and CURRENT_DATE are rewritten to CURRENT_DATE().
+//   - `expr + INTERVAL n unit` and `expr - INTERVAL n unit`, including the
+//     PostgreSQL form INTERVAL 'n units', are rewritten to TIMESTAMP_ADD and
+//     TIMESTAMP_SUB if expr is a column, a parameter or a function call without
+//     arguments, and the unit is supported by TIMESTAMP_ADD.
+//
+// String literals and quoted identifiers are not modified.
+func translateDateTimeFunctions(query string) string {
+	query = postgresIntervalRegExp.ReplaceAllString(query, "INTERVAL $1 $2")
+
+	var result strings.Builder
+	start := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c != '\'' && c != '"' {
+			continue
+		}
+		result.WriteString(translateDateTimeSegment(query[start:i]))
+		// Copy the string literal without modifying it.
+		end := i + 1
+		for end < len(query) && query[end] != c {
+			if query[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(query) {
+			end = len(query) - 1
+		}
+		result.WriteString(query[i : end+1])
+		i = end
+		start = end + 1
+	}
+	if start < len(query) {
+		result.WriteString(translateDateTimeSegment(query[start:]))
+	}
+	return result.String()
+}
+
+func translateDateTimeSegment(segment string) string {
+	segment = replaceOutsideBackticks(segment, currentTimestampRegExp, "CURRENT_TIMESTAMP()")
+	segment = replaceOutsideBackticks(segment, currentDateRegExp, "CURRENT_DATE()")
+	return intervalRegExp.ReplaceAllStringFunc(segment, func(match string) string {
+		m := intervalRegExp.FindStringSubmatch(match)
+		unit, ok := timestampIntervalUnits[strings.ToUpper(m[4])]
+		if !ok {
+			return match
+		}
+		function := "TIMESTAMP_ADD"
+		if m[2] == "-" {
+			function = "TIMESTAMP_SUB"
+		}
+		return function + "(" + m[1] + ", INTERVAL " + m[3] + " " + unit + ")"
+	})
+}
+
+// replaceOutsideBackticks replaces all matches of the given regular expression
+// that are not inside a quoted identifier.
+func replaceOutsideBackticks(s string, re *regexp.Regexp, replacement string) string {
+	parts := strings.Split(s, "`")
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = re.ReplaceAllString(parts[i], replacement)
+	}
+	return strings.Join(parts, "`")
+}
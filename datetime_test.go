@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import "testing"
+
+func TestTranslateDateTimeFunctions(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  string
+	}{
+		{"SELECT NOW()", "SELECT CURRENT_TIMESTAMP()"},
+		{"SELECT now( )", "SELECT CURRENT_TIMESTAMP()"},
+		{"SELECT CURRENT_TIMESTAMP", "SELECT CURRENT_TIMESTAMP()"},
+		{"SELECT CURRENT_TIMESTAMP(6)", "SELECT CURRENT_TIMESTAMP()"},
+		{"SELECT CURRENT_TIMESTAMP()", "SELECT CURRENT_TIMESTAMP()"},
+		{"SELECT UTC_TIMESTAMP(), LOCALTIMESTAMP", "SELECT CURRENT_TIMESTAMP(), CURRENT_TIMESTAMP()"},
+		{"SELECT CURDATE(), CURRENT_DATE", "SELECT CURRENT_DATE(), CURRENT_DATE()"},
+		{
+			"SELECT * FROM `singers` WHERE created_at > NOW() - INTERVAL 1 DAY",
+			"SELECT * FROM `singers` WHERE created_at > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 1 DAY)",
+		},
+		{
+			"SELECT * FROM `singers` WHERE `singers`.`created_at` + INTERVAL 2 hour < @p1",
+			"SELECT * FROM `singers` WHERE TIMESTAMP_ADD(`singers`.`created_at`, INTERVAL 2 HOUR) < @p1",
+		},
+		{
+			"SELECT * FROM singers WHERE created_at > now() - interval '30 minutes'",
+			"SELECT * FROM singers WHERE created_at > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 30 MINUTE)",
+		},
+		{
+			"SELECT @p1 + INTERVAL 10 SECOND",
+			"SELECT TIMESTAMP_ADD(@p1, INTERVAL 10 SECOND)",
+		},
+		// Units that are not supported by TIMESTAMP_ADD are not rewritten.
+		{
+			"SELECT created_at - INTERVAL 1 MONTH FROM singers",
+			"SELECT created_at - INTERVAL 1 MONTH FROM singers",
+		},
+		// String literals and quoted identifiers are not modified.
+		{
+			"SELECT 'NOW()', \"CURRENT_TIMESTAMP\", `now` FROM singers WHERE name = 'it''s now()'",
+			"SELECT 'NOW()', \"CURRENT_TIMESTAMP\", `now` FROM singers WHERE name = 'it''s now()'",
+		},
+		{
+			"SELECT * FROM `singers` WHERE `current_date` = CURRENT_DATE",
+			"SELECT * FROM `singers` WHERE `current_date` = CURRENT_DATE()",
+		},
+	} {
+		if g, w := translateDateTimeFunctions(test.input), test.want; g != w {
+			t.Errorf("translation mismatch for %q\n Got: %v\nWant: %v", test.input, g, w)
+		}
+	}
+}
+
+func TestTranslateDateTimeFunctionsConfig(t *testing.T) {
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{TranslateDateTimeFunctions: true})
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers` WHERE last_updated > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 1 DAY)"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+	var singers []singerWithCommitTimestamp
+	if err := db.Where("last_updated > NOW() - INTERVAL 1 DAY").Find(&singers).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSql(server), querySql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+)
+
+// DDLBatchObserver is implemented by gorm plugins that are notified of the DDL
+// batches that the migrator executes, for example to record metrics. DDL
+// batches are sent to Spanner directly, and not with gorm callbacks. The
+// migrator calls ObserveDDLBatch on all plugins that have been registered
+// with db.Use and that implement the interface.
+type DDLBatchObserver interface {
+	// ObserveDDLBatch is called after a batch of DDL statements has been
+	// executed with the time that it took and the error of the batch, if any.
+	ObserveDDLBatch(ctx context.Context, statements []string, duration time.Duration, err error)
+}
+
+// BatchDDLError is returned when a DDL batch fails. It contains the index and
+// the text of the statement in the batch that failed. It is only returned if
+// the dialector opened its connection pool from a DSN, as the database/sql
+// driver does not report which statement of a batch failed.
+type BatchDDLError struct {
+	// Index is the zero-based index of the statement in the batch that failed.
+	Index int
+	// Statement is the DDL statement that failed.
+	Statement string
+	// Err is the error that was returned by Spanner.
+	Err error
+}
+
+func (e *BatchDDLError) Error() string {
+	return fmt.Sprintf("DDL statement %d failed: %s: %v", e.Index+1, e.Statement, e.Err)
+}
+
+func (e *BatchDDLError) Unwrap() error {
+	return e.Err
+}
+
+// migratorConn is the connection that is used by the migrator. DDL statements
+// that are executed on the connection while a DDL batch is active are
+// buffered, and sent to Spanner as one batch when RunBatch is called.
+//
+// The connection is taken from the pool when it is first used, and returned to
+// the pool when release is called. A connection that was supplied by the
+// application is never released.
+type migratorConn struct {
+	// db is the pool that the connection is taken from. It is nil if the
+	// connection was supplied by the application.
+	db   *sql.DB
+	conn *sql.Conn
+
+	batching   bool
+	statements []string
+}
+
+func (c *migratorConn) getConn(ctx context.Context) (*sql.Conn, error) {
+	if c.conn == nil {
+		conn, err := c.db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+	return c.conn, nil
+}
+
+// release returns the connection to the pool. A new connection is taken from
+// the pool if the migrator is used again after it has been released.
+func (c *migratorConn) release() error {
+	if c.db == nil || c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *migratorConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if c.batching && isDDL(query) {
+		c.statements = append(c.statements, query)
+		return driver.ResultNoRows, nil
+	}
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.ExecContext(ctx, query, args...)
+}
+
+func (c *migratorConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.QueryContext(ctx, query, args...)
+}
+
+func (c *migratorConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		// Let the pool return the error, as a *sql.Row cannot be created here.
+		return c.db.QueryRowContext(ctx, query, args...)
+	}
+	return conn.QueryRowContext(ctx, query, args...)
+}
+
+func (c *migratorConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.PrepareContext(ctx, query)
+}
+
+func (c *migratorConn) startBatch() error {
+	if c.batching {
+		return fmt.Errorf("this connection already has an active batch")
+	}
+	c.batching = true
+	c.statements = nil
+	return nil
+}
+
+func (c *migratorConn) takeBatch() ([]string, error) {
+	if !c.batching {
+		return nil, fmt.Errorf("this connection does not have an active batch")
+	}
+	statements := c.statements
+	c.batching = false
+	c.statements = nil
+	return statements, nil
+}
+
+var ddlKeywords = []string{"CREATE", "DROP", "ALTER", "ANALYZE", "GRANT", "REVOKE", "RENAME"}
+
+func isDDL(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, keyword := range ddlKeywords {
+		if strings.EqualFold(fields[0], keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultMaxDDLBatchSize is the default maximum number of statements in one
+// DDL batch.
+const defaultMaxDDLBatchSize = 100
+
+// maxDDLBatchSize returns the maximum number of statements in one DDL batch.
+func (dialector Dialector) maxDDLBatchSize() int {
+	if dialector.Config == nil || dialector.MaxDDLBatchSize <= 0 {
+		return defaultMaxDDLBatchSize
+	}
+	return dialector.MaxDDLBatchSize
+}
+
+// splitDDLBatch splits the given statements into batches of at most size
+// statements. The order of the statements is preserved.
+func splitDDLBatch(statements []string, size int) [][]string {
+	var batches [][]string
+	for len(statements) > size {
+		batches = append(batches, statements[:size])
+		statements = statements[size:]
+	}
+	if len(statements) > 0 {
+		batches = append(batches, statements)
+	}
+	return batches
+}
+
+// executeDDL executes the given DDL statements as one batch. The statements are
+// sent directly to the database admin API if the dialector opened its
+// connection pool from a DSN, so the index of the statement that failed can be
+// included in the error. Otherwise, the statements are sent as one batch on
+// the given connection.
+func (dialector Dialector) executeDDL(ctx context.Context, conn *migratorConn, statements []string) error {
+	return dialector.executeDDLWithOptions(ctx, conn, statements, DDLBatchOptions{})
+}
+
+// executeDDLWithOptions executes the given DDL statements as one batch like
+// executeDDL, and reports the progress of the batch to options.Progress.
+func (dialector Dialector) executeDDLWithOptions(ctx context.Context, conn *migratorConn, statements []string, options DDLBatchOptions) error {
+	if len(statements) == 0 {
+		return nil
+	}
+	descriptors := dialector.protoDescriptorsFor(statements)
+	// A connection pool that was supplied by the application might use other
+	// credentials or another database than the DSN, so the statements are
+	// sent through the pool instead of the admin client of the dialector.
+	if dialector.DSN == "" || dialector.Conn != nil {
+		if descriptors != nil {
+			return fmt.Errorf("proto descriptors can only be sent with a dialector that opens its connection pool from a DSN")
+		}
+		return executeDDLOnConn(ctx, conn, statements, options)
+	}
+	client, databaseName, err := dialector.databaseAdminClient(ctx)
+	if err != nil {
+		return err
+	}
+	op, err := client.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+		Database:         databaseName,
+		Statements:       statements,
+		ProtoDescriptors: descriptors,
+	})
+	if err != nil {
+		return err
+	}
+	if err := waitForDDL(ctx, op, statements, options); err != nil {
+		// Spanner returns a commit timestamp for each statement that has been
+		// executed successfully, which means that the number of commit
+		// timestamps is the index of the statement that failed.
+		if metadata, metadataErr := op.Metadata(); metadataErr == nil && metadata != nil {
+			if idx := len(metadata.CommitTimestamps); idx < len(statements) {
+				return &BatchDDLError{Index: idx, Statement: statements[idx], Err: err}
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// waitForDDL waits for the given DDL operation to finish. The operation is
+// polled every options.PollInterval, and options.Progress is called with the
+// metadata of the operation after each poll if it is set.
+func waitForDDL(ctx context.Context, op *database.UpdateDatabaseDdlOperation, statements []string, options DDLBatchOptions) error {
+	if options.Progress == nil {
+		return op.Wait(ctx)
+	}
+	interval := options.PollInterval
+	if interval <= 0 {
+		interval = defaultDDLPollInterval
+	}
+	for {
+		// Poll returns the error of the operation if it has failed, and does not
+		// call the server if the operation is already done.
+		err := op.Poll(ctx)
+		if metadata, metadataErr := op.Metadata(); metadataErr == nil && metadata != nil {
+			options.Progress(ddlBatchProgressOf(statements, metadata, op.Done() && err == nil))
+		}
+		if err != nil || op.Done() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// executeDDLOnConn executes the given DDL statements as one batch on the
+// given connection with START BATCH DDL and RUN BATCH. The database/sql driver
+// does not report which statement of a DDL batch failed, so the error of the
+// batch is returned as-is, and not as a *BatchDDLError.
+func executeDDLOnConn(ctx context.Context, c *migratorConn, statements []string, options DDLBatchOptions) error {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "START BATCH DDL"); err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			_, _ = conn.ExecContext(ctx, "ABORT BATCH")
+			return err
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "RUN BATCH"); err != nil {
+		return err
+	}
+	if options.Progress != nil {
+		options.Progress(DDLBatchProgress{Statements: statements, Completed: len(statements), Done: true})
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"gorm.io/gorm"
+)
+
+// defaultDDLPollInterval is the default interval at which the progress of a
+// DDL batch is polled if a progress function is set.
+const defaultDDLPollInterval = 5 * time.Second
+
+// DDLBatchOptions are the options for RunDDLBatchWithOptions.
+type DDLBatchOptions struct {
+	// Timeout is the maximum time to wait for the batch to finish. The
+	// default is no timeout other than the deadline of the context. Spanner
+	// continues to execute the batch if the timeout expires.
+	Timeout time.Duration
+	// PollInterval is the interval at which the progress of the batch is
+	// polled if Progress is set. The default is 5 seconds.
+	PollInterval time.Duration
+	// Progress is called with the progress of the batch each time it is
+	// polled, and when the batch has finished.
+	Progress func(progress DDLBatchProgress)
+}
+
+// DDLBatchProgress is the progress of a DDL batch.
+type DDLBatchProgress struct {
+	// Statements are the statements in the batch.
+	Statements []string
+	// Completed is the number of statements that have been applied.
+	Completed int
+	// Percent is the progress of the statement that is being executed, from
+	// 0 to 100. Statements that are applied to existing data, such as
+	// CREATE INDEX, can take a long time.
+	Percent int32
+	// Throttled is true if the batch is throttled by Spanner, because other
+	// schema changes are running.
+	Throttled bool
+	// Done is true if all statements have been applied.
+	Done bool
+}
+
+// RunDDLBatch executes the given DDL statements as a single schema update and
+// waits for it to finish. See RunDDLBatchWithOptions.
+func RunDDLBatch(ctx context.Context, db *gorm.DB, statements []string) error {
+	return RunDDLBatchWithOptions(ctx, db, statements, DDLBatchOptions{})
+}
+
+// RunDDLBatchWithOptions executes the given DDL statements as a single
+// UpdateDatabaseDdl operation and waits for it to finish. An error is returned
+// without executing any statement if one of the statements is not a DDL
+// statement. Use this to apply schema changes from application code that are
+// not derived from gorm models, for example in a migration tool.
+//
+// Unlike the DDL batches of the migrator, the statements are not split into
+// batches of Config.MaxDDLBatchSize statements. A *BatchDDLError that
+// contains the index and text of the statement that failed is returned if one
+// of the statements fails. The statements before it have been applied in that
+// case. The plugins that implement DDLBatchObserver are notified of the batch.
+//
+// The statements are sent directly to the database admin API if the dialector
+// opened its connection pool from a DSN. If the connection pool was supplied
+// in Config.Conn, the statements are sent as one batch through that pool with
+// START BATCH DDL and RUN BATCH. The database/sql driver does not report which
+// statement of a batch failed, so the error of the batch is then returned
+// as-is instead of as a *BatchDDLError, and options.Progress is only called
+// once when the batch has finished.
+//
+// Example:
+//
+//	err := spannergorm.RunDDLBatchWithOptions(ctx, db, []string{
+//	  "CREATE INDEX idx_singers_last_name ON singers (last_name)",
+//	  "ALTER TABLE albums ADD COLUMN release_date DATE",
+//	}, spannergorm.DDLBatchOptions{
+//	  Timeout: time.Hour,
+//	  Progress: func(p spannergorm.DDLBatchProgress) {
+//	    log.Printf("%d of %d statements applied (%d%%)", p.Completed, len(p.Statements), p.Percent)
+//	  },
+//	})
+func RunDDLBatchWithOptions(ctx context.Context, db *gorm.DB, statements []string, options DDLBatchOptions) error {
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if !isDDL(statement) {
+			return fmt.Errorf("not a DDL statement: %s", statement)
+		}
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn := &migratorConn{db: sqlDB}
+	defer conn.release()
+
+	start := time.Now()
+	err = dialector.executeDDLWithOptions(ctx, conn, statements, options)
+	for _, plugin := range db.Config.Plugins {
+		if observer, ok := plugin.(DDLBatchObserver); ok {
+			observer.ObserveDDLBatch(ctx, statements, time.Since(start), err)
+		}
+	}
+	return err
+}
+
+// ddlBatchProgressOf returns the progress of a DDL batch from the metadata of
+// its operation.
+func ddlBatchProgressOf(statements []string, metadata *databasepb.UpdateDatabaseDdlMetadata, done bool) DDLBatchProgress {
+	progress := DDLBatchProgress{
+		Statements: statements,
+		Completed:  len(metadata.CommitTimestamps),
+		Throttled:  metadata.Throttled,
+		Done:       done,
+	}
+	if done {
+		progress.Completed, progress.Percent = len(statements), 100
+	} else if progress.Completed < len(metadata.Progress) {
+		progress.Percent = metadata.Progress[progress.Completed].GetProgressPercent()
+	}
+	return progress
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestRunDDLBatch(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	metadata, err := anypb.New(&databasepb.UpdateDatabaseDdlMetadata{
+		CommitTimestamps: []*timestamppb.Timestamp{timestamppb.Now(), timestamppb.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:     "test-operation",
+		Done:     true,
+		Metadata: metadata,
+		Result:   &longrunningpb.Operation_Response{Response: response},
+	}})
+
+	statements := []string{
+		"CREATE INDEX idx_singers_last_name ON singers (last_name)",
+		"ALTER TABLE albums ADD COLUMN release_date DATE",
+	}
+	var progress []DDLBatchProgress
+	if err := RunDDLBatchWithOptions(context.Background(), db, statements, DDLBatchOptions{
+		Progress: func(p DDLBatchProgress) { progress = append(progress, p) },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), statements; !reflect.DeepEqual(g, w) {
+		t.Fatalf("statements mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	want := []DDLBatchProgress{{Statements: statements, Completed: 2, Percent: 100, Done: true}}
+	if g, w := progress, want; !reflect.DeepEqual(g, w) {
+		t.Fatalf("progress mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+}
+
+func TestRunDDLBatchError(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	metadata, err := anypb.New(&databasepb.UpdateDatabaseDdlMetadata{
+		CommitTimestamps: []*timestamppb.Timestamp{timestamppb.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:     "test-operation",
+		Done:     true,
+		Metadata: metadata,
+		Result: &longrunningpb.Operation_Error{Error: &statuspb.Status{
+			Code:    int32(codes.FailedPrecondition),
+			Message: "Duplicate name in schema: albums",
+		}},
+	}})
+
+	statements := []string{"CREATE TABLE singers (id INT64) PRIMARY KEY (id)", "CREATE TABLE albums (id INT64) PRIMARY KEY (id)"}
+	var progress []DDLBatchProgress
+	err = RunDDLBatchWithOptions(context.Background(), db, statements, DDLBatchOptions{
+		Progress: func(p DDLBatchProgress) { progress = append(progress, p) },
+	})
+	var batchErr *BatchDDLError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, batchErr)
+	}
+	if g, w := batchErr.Statement, statements[1]; g != w {
+		t.Fatalf("statement mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := progress, []DDLBatchProgress{{Statements: statements, Completed: 1}}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("progress mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+}
+
+func TestRunDDLBatchNotDDL(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	err := RunDDLBatch(context.Background(), db, []string{
+		"CREATE TABLE singers (id INT64) PRIMARY KEY (id)",
+		"DELETE FROM singers WHERE TRUE",
+	})
+	if err == nil {
+		t.Fatal("missing error for DML statement")
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Default sets a column to its default value when it is used as the value of
+// a column in an update or an insert. The column is set to the DEFAULT
+// keyword, so Spanner evaluates the default expression of the column, such as
+// a sequence or an expression with CURRENT_TIMESTAMP(). Columns without a
+// default value are set to NULL.
+//
+// Example:
+//
+//	// UPDATE singers SET status=DEFAULT WHERE id=1
+//	db.Model(&Singer{ID: 1}).Update("status", spannergorm.Default)
+var Default = defaultValue{}
+
+type defaultValue struct{}
+
+// GormValue implements the gorm.Valuer interface.
+func (defaultValue) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	return clause.Expr{SQL: "DEFAULT"}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"testing"
+
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+func TestUpdateDefault(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	sql := "UPDATE `singers` SET `active`=DEFAULT WHERE `singers`.`deleted_at` IS NULL AND `id` = @p1"
+	_ = server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+
+	if err := db.Model(&singer{Model: gorm.Model{ID: 1}}).UpdateColumn("active", Default).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSql(server), sql; g != w {
+		t.Fatalf("SQL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestUpdatesDefault(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&singer{Model: gorm.Model{ID: 1}}).UpdateColumns(map[string]interface{}{
+			"first_name": "Alice",
+			"full_name":  Default,
+		})
+	})
+	if g, w := sql, "UPDATE `singers` SET `first_name`='Alice',`full_name`=DEFAULT WHERE `singers`.`deleted_at` IS NULL AND `id` = 1"; g != w {
+		t.Fatalf("SQL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+)
+
+// spannerCallbackNames are the names of the callbacks that the dialector
+// registers. DebugInfo reports which of these are registered for each type of
+// operation. Add the names of new callbacks here.
+var spannerCallbackNames = []string{
+	"gorm:spanner:admission",
+	"gorm:spanner:after_stale_query",
+	"gorm:spanner:batch_dml",
+	"gorm:spanner:before_stale_query",
+	"gorm:spanner:begin_returning_transaction",
+	"gorm:spanner:check_returning_transaction",
+	"gorm:spanner:circuit_breaker_allow",
+	"gorm:spanner:circuit_breaker_done",
+	"gorm:spanner:commit_returning_transaction",
+	"gorm:spanner:convert_map_values",
+	"gorm:spanner:insert_select",
+	"gorm:spanner:mark_written",
+	"gorm:spanner:omit_generated_columns",
+	"gorm:spanner:partitioned_dml",
+	"gorm:spanner:partitioned_dml_end",
+	"gorm:spanner:read_only_view",
+	"gorm:spanner:remove_primary_key_from_update",
+	"gorm:spanner:request_options",
+	"gorm:spanner:return_generated_columns",
+	"gorm:spanner:stale_query_conn",
+	"gorm:spanner:stale_query_conn_pool",
+	"gorm:spanner:started_returning_transaction",
+	"gorm:spanner:table_synonym",
+	"gorm:spanner:transaction_hooks",
+}
+
+// Diagnostics is the effective configuration of a gorm database that uses
+// the Spanner dialector. See DebugInfo.
+type Diagnostics struct {
+	// Dialect is the SQL dialect that the dialector supports.
+	Dialect databasepb.DatabaseDialect
+	// Host, Project, Instance and Database are the components of the
+	// connection string. They are empty if the dialector was created with an
+	// existing connection pool instead of a connection string.
+	Host     string
+	Project  string
+	Instance string
+	Database string
+	// Params are the properties of the connection string, with lower case
+	// keys. The values of credentials are redacted.
+	Params map[string]string
+	// SessionPool contains the session pool settings of the Spanner client of
+	// the driver.
+	SessionPool SessionPoolDiagnostics
+	// Connection contains the connection variables of a connection from the
+	// pool, or of the transaction if DebugInfo is called with a transaction.
+	Connection ConnectionDiagnostics
+	// Callbacks are the Spanner callbacks that are registered for each type
+	// of operation: create, query, update, delete, row and raw.
+	Callbacks map[string][]string
+	// ClauseBuilders are the names of the clauses that the dialector builds.
+	ClauseBuilders []string
+}
+
+// SessionPoolDiagnostics contains the session pool settings of the Spanner
+// client of the driver.
+type SessionPoolDiagnostics struct {
+	MinSessions uint64
+	MaxSessions uint64
+	// NumChannels is the number of gRPC channels. Zero means the default of
+	// the Spanner client library.
+	NumChannels int
+}
+
+// defaultSessionPoolDiagnostics returns the default session pool settings of
+// the Spanner client library.
+func defaultSessionPoolDiagnostics() SessionPoolDiagnostics {
+	return SessionPoolDiagnostics{
+		MinSessions: spanner.DefaultSessionPoolConfig.MinOpened,
+		MaxSessions: spanner.DefaultSessionPoolConfig.MaxOpened,
+	}
+}
+
+// sessionPoolDiagnosticsOf returns the session pool settings in the given
+// properties of a connection string, with lower case keys.
+func sessionPoolDiagnosticsOf(params map[string]string) SessionPoolDiagnostics {
+	pool := defaultSessionPoolDiagnostics()
+	if val, err := strconv.ParseUint(params["minsessions"], 10, 64); err == nil {
+		pool.MinSessions = val
+	}
+	if val, err := strconv.ParseUint(params["maxsessions"], 10, 64); err == nil {
+		pool.MaxSessions = val
+	}
+	if val, err := strconv.Atoi(params["numchannels"]); err == nil && val > 0 {
+		pool.NumChannels = val
+	}
+	return pool
+}
+
+// ConnectionDiagnostics contains the connection variables of a Spanner
+// connection.
+type ConnectionDiagnostics struct {
+	RetryAbortsInternally       bool
+	AutocommitDMLMode           string
+	ReadOnlyStaleness           string
+	ExcludeTxnFromChangeStreams bool
+	InDDLBatch                  bool
+	InDMLBatch                  bool
+}
+
+// DebugInfo returns the effective configuration of the given gorm database:
+// the components of the connection string, the dialect, the session pool
+// settings, the connection variables, and the registered callbacks and
+// clause builders. Include the output in support requests for behavior that
+// depends on the configuration. Use the String method to print it.
+//
+// Example:
+//
+//	info, err := spannergorm.DebugInfo(db)
+//	if err != nil {
+//	  return err
+//	}
+//	fmt.Println(info)
+func DebugInfo(db *gorm.DB) (*Diagnostics, error) {
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return nil, err
+	}
+	info := &Diagnostics{
+		Dialect:     databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL,
+		Params:      make(map[string]string),
+		SessionPool: defaultSessionPoolDiagnostics(),
+		Callbacks:   make(map[string][]string),
+	}
+	if dialector.Config != nil && dialector.DSN != "" {
+		config, err := parseDSN(dialector.currentDSN())
+		if err != nil {
+			return nil, err
+		}
+		info.Host, info.Project, info.Instance, info.Database = config.host, config.project, config.instance, config.database
+		for key, value := range config.params {
+			if strings.Contains(key, "credentials") {
+				value = "<redacted>"
+			}
+			info.Params[key] = value
+		}
+		info.SessionPool = sessionPoolDiagnosticsOf(config.params)
+	}
+	if err := WithSpannerConn(db, func(conn spannerdriver.SpannerConn) error {
+		info.Connection = ConnectionDiagnostics{
+			RetryAbortsInternally:       conn.RetryAbortsInternally(),
+			AutocommitDMLMode:           conn.AutocommitDMLMode().String(),
+			ReadOnlyStaleness:           conn.ReadOnlyStaleness().String(),
+			ExcludeTxnFromChangeStreams: conn.ExcludeTxnFromChangeStreams(),
+			InDDLBatch:                  conn.InDDLBatch(),
+			InDMLBatch:                  conn.InDMLBatch(),
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	processors := map[string]interface{ Get(name string) func(*gorm.DB) }{
+		"create": db.Callback().Create(),
+		"query":  db.Callback().Query(),
+		"update": db.Callback().Update(),
+		"delete": db.Callback().Delete(),
+		"row":    db.Callback().Row(),
+		"raw":    db.Callback().Raw(),
+	}
+	for operation, processor := range processors {
+		for _, name := range spannerCallbackNames {
+			if processor.Get(name) != nil {
+				info.Callbacks[operation] = append(info.Callbacks[operation], name)
+			}
+		}
+	}
+	for name := range db.ClauseBuilders {
+		info.ClauseBuilders = append(info.ClauseBuilders, name)
+	}
+	sort.Strings(info.ClauseBuilders)
+	return info, nil
+}
+
+// String returns the configuration in a human-readable format.
+func (d *Diagnostics) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "dialect: %v\n", d.Dialect)
+	fmt.Fprintf(&b, "host: %s\nproject: %s\ninstance: %s\ndatabase: %s\n", d.Host, d.Project, d.Instance, d.Database)
+	fmt.Fprintf(&b, "params:\n")
+	keys := make([]string, 0, len(d.Params))
+	for key := range d.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "  %s=%s\n", key, d.Params[key])
+	}
+	fmt.Fprintf(&b, "session pool: min=%d max=%d channels=%d\n", d.SessionPool.MinSessions, d.SessionPool.MaxSessions, d.SessionPool.NumChannels)
+	fmt.Fprintf(&b, "connection: %+v\n", d.Connection)
+	fmt.Fprintf(&b, "callbacks:\n")
+	for _, operation := range []string{"create", "query", "update", "delete", "row", "raw"} {
+		fmt.Fprintf(&b, "  %s: %s\n", operation, strings.Join(d.Callbacks[operation], ", "))
+	}
+	fmt.Fprintf(&b, "clause builders: %s\n", strings.Join(d.ClauseBuilders, ", "))
+	return b.String()
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestDebugInfo(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnectionWithParams(t, "minSessions=10;credentialsJson=secret")
+	defer teardown()
+
+	info, err := DebugInfo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := info.Project+"/"+info.Instance+"/"+info.Database, "p/i/d"; g != w {
+		t.Fatalf("database mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := info.Params["useplaintext"], "true"; g != w {
+		t.Fatalf("useplaintext mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := info.Params["credentialsjson"], "<redacted>"; g != w {
+		t.Fatalf("credentials mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := info.SessionPool.MinSessions, uint64(10); g != w {
+		t.Fatalf("min sessions mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := info.Connection.AutocommitDMLMode, "Transactional"; g != w {
+		t.Fatalf("autocommit DML mode mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for _, operation := range []string{"create", "query", "update", "delete", "row", "raw"} {
+		if !containsString(info.Callbacks[operation], "gorm:spanner:request_options") {
+			t.Fatalf("missing request_options callback for %s: %v", operation, info.Callbacks[operation])
+		}
+	}
+	if !containsString(info.ClauseBuilders, "RETURNING") {
+		t.Fatalf("missing RETURNING clause builder: %v", info.ClauseBuilders)
+	}
+	if s := info.String(); !strings.Contains(s, "database: d\n") || strings.Contains(s, "secret") {
+		t.Fatalf("unexpected output: %s", s)
+	}
+
+	// The connection variables of a transaction are those of the transaction.
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		info, err := DebugInfo(tx)
+		if err != nil {
+			return err
+		}
+		if g, w := info.Connection.RetryAbortsInternally, true; g != w {
+			t.Fatalf("retry aborts mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
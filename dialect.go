@@ -0,0 +1,124 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"gorm.io/gorm"
+)
+
+// databaseDialectQuery returns the dialect of the database. The query is valid
+// in both the GoogleSQL and the PostgreSQL dialect.
+const databaseDialectQuery = "SELECT option_value FROM information_schema.database_options WHERE option_name = 'database_dialect'"
+
+// DialectMismatchError is returned by gorm.Open if the database uses a
+// different SQL dialect than the dialector. The Spanner gorm dialector only
+// supports databases that use the GoogleSQL dialect.
+type DialectMismatchError struct {
+	// Database is the DSN of the database, if known.
+	Database string
+	// Expected is the dialect that is supported by the dialector.
+	Expected databasepb.DatabaseDialect
+	// Actual is the dialect of the database.
+	Actual databasepb.DatabaseDialect
+}
+
+func (e *DialectMismatchError) Error() string {
+	database := e.Database
+	if database == "" {
+		database = "the database"
+	}
+	return fmt.Sprintf("%s uses the %v dialect, but this gorm dialector only supports the %v dialect", database, e.Actual, e.Expected)
+}
+
+// DetectDialect returns the SQL dialect of the database that db is connected
+// to.
+func DetectDialect(ctx context.Context, db gorm.ConnPool) (databasepb.DatabaseDialect, error) {
+	var dialect string
+	if err := db.QueryRowContext(ctx, databaseDialectQuery).Scan(&dialect); err != nil {
+		return databasepb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED, fmt.Errorf("failed to get the dialect of the database: %w", err)
+	}
+	value, ok := databasepb.DatabaseDialect_value[dialect]
+	if !ok {
+		return databasepb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED, fmt.Errorf("unknown database dialect: %s", dialect)
+	}
+	return databasepb.DatabaseDialect(value), nil
+}
+
+// checkDialect returns a *DialectMismatchError if the database does not use
+// the GoogleSQL dialect.
+func (dialector Dialector) checkDialect(db *gorm.DB) error {
+	dialect, err := DetectDialect(context.Background(), db.ConnPool)
+	if err != nil {
+		return err
+	}
+	if dialect != databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL {
+		return &DialectMismatchError{
+			Database: dialector.DSN,
+			Expected: databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL,
+			Actual:   dialect,
+		}
+	}
+	return nil
+}
+
+// OpenAny opens a connection to the database with the given DSN, detects the
+// SQL dialect of the database, and returns a dialector for that dialect. The
+// returned dialector uses the connection that was opened to detect the
+// dialect. Tools that must support databases of both dialects can use this
+// function instead of choosing a dialector up front.
+//
+// Only databases that use the GoogleSQL dialect are currently supported. A
+// *DialectMismatchError is returned for databases that use the PostgreSQL
+// dialect.
+//
+// Example:
+//
+//	dialector, err := spannergorm.OpenAny("projects/my-project/instances/my-instance/databases/my-database")
+//	if err != nil {
+//	  return err
+//	}
+//	db, err := gorm.Open(dialector, &gorm.Config{})
+func OpenAny(dsn string) (gorm.Dialector, error) {
+	sqlDB, err := sql.Open("spanner", dsn)
+	if err != nil {
+		return nil, err
+	}
+	dialect, err := DetectDialect(context.Background(), sqlDB)
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	switch dialect {
+	case databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL:
+		return New(Config{
+			DriverName: "spanner",
+			DSN:        dsn,
+			Conn:       sqlDB,
+			// The dialect has already been verified.
+			DisableDialectCheck: true,
+		}), nil
+	}
+	_ = sqlDB.Close()
+	return nil, &DialectMismatchError{
+		Database: dsn,
+		Expected: databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL,
+		Actual:   dialect,
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+func putDialectResult(server *testutil.MockedSpannerInMemTestServer, dialect databasepb.DatabaseDialect) error {
+	return putStringRowsResult(server, databaseDialectQuery, []string{"option_value"}, [][]string{{dialect.String()}})
+}
+
+func TestDialectCheck(t *testing.T) {
+	t.Parallel()
+
+	server, _, teardown := setupMockedTestServer(t)
+	defer teardown()
+	dsn := fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address)
+
+	_ = putDialectResult(server, databasepb.DatabaseDialect_POSTGRESQL)
+	_, err := gorm.Open(New(Config{DriverName: "spanner", DSN: dsn}), &gorm.Config{})
+	var mismatch *DialectMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, "DialectMismatchError")
+	}
+	if g, w := mismatch.Actual, databasepb.DatabaseDialect_POSTGRESQL; g != w {
+		t.Fatalf("dialect mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The check can be disabled.
+	if _, err := gorm.Open(New(Config{DriverName: "spanner", DSN: dsn, DisableDialectCheck: true}), &gorm.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	// The check is skipped in DryRun mode.
+	if _, err := gorm.Open(New(Config{DriverName: "spanner", DSN: dsn}), &gorm.Config{DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = putDialectResult(server, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+	if _, err := gorm.Open(New(Config{DriverName: "spanner", DSN: dsn}), &gorm.Config{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenAny(t *testing.T) {
+	t.Parallel()
+
+	server, _, teardown := setupMockedTestServer(t)
+	defer teardown()
+	dsn := fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address)
+
+	_ = putDialectResult(server, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+	dialector, err := OpenAny(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = putCountStatementResult(server, "SELECT COUNT(*) FROM singers", 3)
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM singers").Scan(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := count, int64(3); g != w {
+		t.Fatalf("count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	_ = putDialectResult(server, databasepb.DatabaseDialect_POSTGRESQL)
+	var mismatch *DialectMismatchError
+	if _, err := OpenAny(dsn); !errors.As(err, &mismatch) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, "DialectMismatchError")
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// dsnRegExp is the same regular expression that is used by the Spanner
+// database/sql driver to parse a connection string.
+var dsnRegExp = regexp.MustCompile(`((?P<HOSTGROUP>[\w.-]+(?:\.[\w\.-]+)*[\w\-\._~:/?#\[\]@!\$&'\(\)\*\+,;=.]+)/)?projects/(?P<PROJECTGROUP>(([a-z]|[-.:]|[0-9])+|(DEFAULT_PROJECT_ID)))(/instances/(?P<INSTANCEGROUP>([a-z]|[-]|[0-9])+)(/databases/(?P<DATABASEGROUP>([a-z]|[-]|[_]|[0-9])+))?)?(([\?|;])(?P<PARAMSGROUP>.*))?`)
+
+// connectionConfig contains the components of a Spanner connection string.
+type connectionConfig struct {
+	host     string
+	project  string
+	instance string
+	database string
+	params   map[string]string
+}
+
+func parseDSN(dsn string) (connectionConfig, error) {
+	match := dsnRegExp.FindStringSubmatch(dsn)
+	if match == nil {
+		return connectionConfig{}, fmt.Errorf("invalid connection string: %s", dsn)
+	}
+	matches := make(map[string]string)
+	for i, name := range dsnRegExp.SubexpNames() {
+		if i != 0 && name != "" {
+			matches[name] = match[i]
+		}
+	}
+	params := make(map[string]string)
+	for _, keyValueString := range strings.Split(matches["PARAMSGROUP"], ";") {
+		if keyValueString == "" {
+			continue
+		}
+		keyValue := strings.SplitN(keyValueString, "=", 2)
+		if len(keyValue) != 2 {
+			return connectionConfig{}, fmt.Errorf("invalid connection property: %s", keyValueString)
+		}
+		params[strings.ToLower(keyValue[0])] = keyValue[1]
+	}
+	return connectionConfig{
+		host:     matches["HOSTGROUP"],
+		project:  matches["PROJECTGROUP"],
+		instance: matches["INSTANCEGROUP"],
+		database: matches["DATABASEGROUP"],
+		params:   params,
+	}, nil
+}
+
+// databaseName returns the fully qualified name of the database.
+func (c connectionConfig) databaseName() string {
+	return fmt.Sprintf("projects/%s/instances/%s/databases/%s", c.project, c.instance, c.database)
+}
+
+// clientOptions returns the client options that should be used for clients
+// that connect to the same database as the connection string.
+func (c connectionConfig) clientOptions() []option.ClientOption {
+	opts := make([]option.ClientOption, 0)
+	if c.host != "" {
+		opts = append(opts, option.WithEndpoint(c.host))
+	}
+	if strval, ok := c.params["credentials"]; ok {
+		opts = append(opts, option.WithCredentialsFile(strval))
+	}
+	if strval, ok := c.params["useplaintext"]; ok {
+		if val, err := strconv.ParseBool(strval); err == nil && val {
+			opts = append(opts,
+				option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				option.WithoutAuthentication())
+		}
+	}
+	if strval, ok := c.params["useragent"]; ok {
+		opts = append(opts, option.WithUserAgent(strval))
+	}
+	return opts
+}
+
+var (
+	projectIDRegExp  = regexp.MustCompile(`^[a-z0-9.:-]+$`)
+	instanceIDRegExp = regexp.MustCompile(`^[a-z0-9-]+$`)
+	databaseIDRegExp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+)
+
+// ConnectionOptions are the components of a connection string. Set
+// Config.Connection instead of Config.DSN to let the dialector build the
+// connection string from these options.
+type ConnectionOptions struct {
+	// Host is the host and port of the Spanner API, e.g. localhost:9010 for
+	// the emulator. The default is the Spanner API of Google Cloud.
+	Host string
+	// Project, Instance and Database are the IDs of the project, instance and
+	// database. They are required.
+	Project  string
+	Instance string
+	Database string
+	// CredentialsFile is the path of a service account key file. The default
+	// is Application Default Credentials.
+	CredentialsFile string
+	// UsePlainText connects to Spanner without TLS and without
+	// authentication, for example to connect to the emulator. It cannot be
+	// combined with CredentialsFile.
+	UsePlainText bool
+	// MinSessions and MaxSessions are the minimum and maximum number of
+	// sessions in the session pool. The defaults are those of the Spanner
+	// client library.
+	MinSessions uint64
+	MaxSessions uint64
+	// OptimizerVersion is the version of the query optimizer, e.g. "6" or
+	// "latest". The default is the default version of the database.
+	OptimizerVersion string
+	// UserAgent is added to the user agent of the Spanner clients that the
+	// dialector creates, such as the client of QueryRows and FindStructs. The
+	// Spanner database/sql driver always uses its own user agent.
+	UserAgent string
+}
+
+// DSN validates the options and returns the connection string.
+func (o ConnectionOptions) DSN() (string, error) {
+	if !projectIDRegExp.MatchString(o.Project) {
+		return "", fmt.Errorf("invalid project ID %q: must be a non-empty string of lower case letters, digits, '-', '.' and ':'", o.Project)
+	}
+	if !instanceIDRegExp.MatchString(o.Instance) {
+		return "", fmt.Errorf("invalid instance ID %q: must be a non-empty string of lower case letters, digits and '-'", o.Instance)
+	}
+	if !databaseIDRegExp.MatchString(o.Database) {
+		return "", fmt.Errorf("invalid database ID %q: must be a non-empty string of lower case letters, digits, '-' and '_'", o.Database)
+	}
+	if o.UsePlainText && o.CredentialsFile != "" {
+		return "", fmt.Errorf("UsePlainText cannot be combined with CredentialsFile, as plain text connections do not use authentication")
+	}
+	if o.MaxSessions > 0 && o.MinSessions > o.MaxSessions {
+		return "", fmt.Errorf("MinSessions (%d) must not be larger than MaxSessions (%d)", o.MinSessions, o.MaxSessions)
+	}
+	var params []string
+	for name, value := range map[string]string{
+		"credentials":      o.CredentialsFile,
+		"optimizerVersion": o.OptimizerVersion,
+		"userAgent":        o.UserAgent,
+	} {
+		if strings.ContainsAny(value, ";") {
+			return "", fmt.Errorf("%s must not contain ';': %q", name, value)
+		}
+		if value != "" {
+			params = append(params, name+"="+value)
+		}
+	}
+	if o.UsePlainText {
+		params = append(params, "usePlainText=true")
+	}
+	if o.MinSessions > 0 {
+		params = append(params, fmt.Sprintf("minSessions=%d", o.MinSessions))
+	}
+	if o.MaxSessions > 0 {
+		params = append(params, fmt.Sprintf("maxSessions=%d", o.MaxSessions))
+	}
+	sort.Strings(params)
+	var dsn strings.Builder
+	if o.Host != "" {
+		dsn.WriteString(strings.TrimSuffix(o.Host, "/"))
+		dsn.WriteString("/")
+	}
+	fmt.Fprintf(&dsn, "projects/%s/instances/%s/databases/%s", o.Project, o.Instance, o.Database)
+	if len(params) > 0 {
+		dsn.WriteString("?")
+		dsn.WriteString(strings.Join(params, ";"))
+	}
+	return dsn.String(), nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"google.golang.org/grpc/codes"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAbortedTransaction is the kind of error that is returned when Spanner
+	// aborts a transaction, or when the driver cannot retry an aborted
+	// transaction, because the data that it read was modified concurrently.
+	// The transaction can be retried.
+	ErrAbortedTransaction = errors.New("spanner: transaction was aborted")
+	// ErrUniqueKeyViolation is the kind of error that is returned when a row
+	// with the same primary key or unique index key already exists. Errors of
+	// this kind also match gorm.ErrDuplicatedKey.
+	ErrUniqueKeyViolation = errors.New("spanner: unique key violation")
+	// ErrForeignKeyViolation is the kind of error that is returned when a
+	// statement violates a foreign key constraint. Errors of this kind also
+	// match gorm.ErrForeignKeyViolated.
+	ErrForeignKeyViolation = errors.New("spanner: foreign key violation")
+	// ErrSchemaChangePending is the kind of error that is returned when a
+	// statement uses a table, column or index that is being changed by a
+	// schema change that has not finished yet.
+	ErrSchemaChangePending = errors.New("spanner: schema change pending")
+)
+
+// Error is a Spanner error that has been translated by TranslateError. The
+// original error is returned by Unwrap, so spanner.ErrCode and errors.As
+// continue to work for the original error.
+type Error struct {
+	// Kind is one of ErrAbortedTransaction, ErrUniqueKeyViolation,
+	// ErrForeignKeyViolation and ErrSchemaChangePending.
+	Kind error
+	// Err is the error that was returned by Spanner.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is the kind of the error, or the equivalent gorm
+// error of the kind.
+func (e *Error) Is(target error) bool {
+	if target == e.Kind {
+		return true
+	}
+	switch e.Kind {
+	case ErrUniqueKeyViolation:
+		return target == gorm.ErrDuplicatedKey
+	case ErrForeignKeyViolation:
+		return target == gorm.ErrForeignKeyViolated
+	}
+	return false
+}
+
+// TranslateError converts the given error into an *Error if it is a Spanner
+// error of a known kind, so it can be checked with errors.Is. Other errors
+// are returned unchanged.
+//
+// gorm calls TranslateError for all errors if the gorm database is opened
+// with gorm.Config{TranslateError: true}, so errors.Is(err,
+// gorm.ErrDuplicatedKey) works the same way as for other gorm dialectors.
+//
+// Example:
+//
+//	db, err := gorm.Open(spannergorm.New(config), &gorm.Config{TranslateError: true})
+//	...
+//	if err := db.Create(&singer).Error; errors.Is(err, gorm.ErrDuplicatedKey) {
+//	  ...
+//	}
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var translated *Error
+	if errors.As(err, &translated) {
+		return err
+	}
+	if kind := errorKind(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	return err
+}
+
+// Translate implements gorm.ErrorTranslator.
+func (dialector Dialector) Translate(err error) error {
+	return TranslateError(err)
+}
+
+func errorKind(err error) error {
+	if errors.Is(err, spannerdriver.ErrAbortedDueToConcurrentModification) {
+		return ErrAbortedTransaction
+	}
+	message := strings.ToLower(spanner.ErrDesc(err))
+	switch spanner.ErrCode(err) {
+	case codes.Aborted:
+		return ErrAbortedTransaction
+	case codes.AlreadyExists:
+		return ErrUniqueKeyViolation
+	case codes.FailedPrecondition:
+		switch {
+		case strings.Contains(message, "unique index violation"):
+			return ErrUniqueKeyViolation
+		case strings.Contains(message, "foreign key"):
+			return ErrForeignKeyViolation
+		case strings.Contains(message, "schema change"):
+			return ErrSchemaChangePending
+		}
+	}
+	return nil
+}
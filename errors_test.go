@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func TestTranslateError(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		err  error
+		want error
+	}{
+		{status.Error(codes.Aborted, "Transaction was aborted."), ErrAbortedTransaction},
+		{spannerdriver.ErrAbortedDueToConcurrentModification, ErrAbortedTransaction},
+		{status.Error(codes.AlreadyExists, "Row [1] in table singers already exists"), ErrUniqueKeyViolation},
+		{status.Error(codes.FailedPrecondition, "Unique index violation on index idx_singers_name at index key [Doe]"), ErrUniqueKeyViolation},
+		{status.Error(codes.FailedPrecondition, "Foreign key constraint `fk_albums_singers` is violated on table `albums`"), ErrForeignKeyViolation},
+		{status.Error(codes.FailedPrecondition, "Table singers is being changed by a pending schema change"), ErrSchemaChangePending},
+		{fmt.Errorf("insert failed: %w", status.Error(codes.AlreadyExists, "already exists")), ErrUniqueKeyViolation},
+	} {
+		err := TranslateError(test.err)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%v: error kind mismatch\n Got: %v\nWant: %v", test.err, err, test.want)
+		}
+		if g, w := spanner.ErrCode(err), spanner.ErrCode(test.err); g != w {
+			t.Errorf("%v: error code mismatch\n Got: %v\nWant: %v", test.err, g, w)
+		}
+	}
+
+	if g, w := errors.Is(TranslateError(status.Error(codes.AlreadyExists, "already exists")), gorm.ErrDuplicatedKey), true; g != w {
+		t.Errorf("duplicated key mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := errors.Is(TranslateError(status.Error(codes.FailedPrecondition, "Foreign key constraint is violated")), gorm.ErrForeignKeyViolated), true; g != w {
+		t.Errorf("foreign key violated mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// Other errors are returned unchanged.
+	for _, err := range []error{nil, gorm.ErrRecordNotFound, status.Error(codes.NotFound, "Table not found: singers")} {
+		if g, w := TranslateError(err), err; g != w {
+			t.Errorf("error mismatch\n Got: %v\nWant: %v", g, w)
+		}
+	}
+}
+
+func TestTranslateErrorConfig(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	db.Config.TranslateError = true
+
+	insertSql := "INSERT INTO singers (id) VALUES (1)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type: testutil.StatementResultError,
+		Err:  status.Error(codes.AlreadyExists, "Row [1] in table singers already exists"),
+	})
+	err := db.Exec(insertSql).Error
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, gorm.ErrDuplicatedKey)
+	}
+	if !errors.Is(err, ErrUniqueKeyViolation) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, ErrUniqueKeyViolation)
+	}
+}
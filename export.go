@@ -0,0 +1,673 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+)
+
+// defaultImportBatchSize is the default number of rows that are written in
+// one transaction by ImportCSV and ImportAvro.
+const defaultImportBatchSize = 1000
+
+// avroBlockSize is the number of rows that ExportAvro writes in one block of
+// the Avro object container file.
+const avroBlockSize = 1000
+
+// ExportOptions are the options for ExportCSV and ExportAvro.
+type ExportOptions struct {
+	// NullValue is the value that ExportCSV writes for NULL values. The
+	// default is an empty field, which means that NULL values and empty
+	// strings cannot be distinguished when the file is imported. Use the same
+	// value for ImportOptions.NullValue when the file is imported.
+	NullValue string
+}
+
+// ImportOptions are the options for ImportCSV, ImportAvro and CopyFromCSV.
+type ImportOptions struct {
+	// BatchSize is the number of rows that are written in one transaction.
+	// The default is 1000. Spanner limits the number of mutations in one
+	// transaction, so tables with many columns or indexes may require a
+	// smaller batch size.
+	BatchSize int
+	// NullValue is the value that ImportCSV and CopyFromCSV read as NULL. The
+	// default is an empty field.
+	NullValue string
+}
+
+// ExportCSV writes the rows of the table of the given model to w as CSV. The
+// first line of the output contains the column names. The conditions, the
+// selected columns and the order of the given gorm database are applied, so
+// ExportCSV can also be used to export a subset of a table.
+//
+// The values are written in the same format as Spanner uses for these types
+// in JSON: NUMERIC values are written as decimal strings, JSON values as JSON
+// text, TIMESTAMP values in RFC 3339 format with nanosecond precision, DATE
+// values as yyyy-mm-dd, BYTES values as base64 strings and ARRAY values as
+// JSON arrays. This ensures that ImportCSV can import the file without losing
+// precision.
+//
+// The rows are read with the Spanner client library in a single-use
+// read-only transaction and streamed to w. The read-only staleness that is
+// set with WithReadOnlyStaleness is applied to the query. ExportCSV can only
+// be used with a dialector that was created with a DSN.
+//
+// Example:
+//
+//	f, err := os.Create("singers.csv")
+//	...
+//	err = spannergorm.ExportCSV(db.Where("active = ?", true), &Singer{}, f, spannergorm.ExportOptions{})
+func ExportCSV(db *gorm.DB, model interface{}, w io.Writer, options ExportOptions) error {
+	writer := csv.NewWriter(w)
+	err := export(db, model, func(_ string, fields []*spannerpb.StructType_Field) error {
+		names := make([]string, len(fields))
+		for i, field := range fields {
+			names[i] = field.Name
+		}
+		return writer.Write(names)
+	}, func(fields []*spannerpb.StructType_Field, row *spanner.Row) error {
+		record := make([]string, len(fields))
+		for i, field := range fields {
+			var col spanner.GenericColumnValue
+			if err := row.Column(i, &col); err != nil {
+				return err
+			}
+			value, err := csvValue(field.Type, col.Value, options.NullValue)
+			if err != nil {
+				return fmt.Errorf("failed to export column %s: %w", field.Name, err)
+			}
+			record[i] = value
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportAvro writes the rows of the table of the given model to w as an Avro
+// object container file. The conditions, the selected columns and the order
+// of the given gorm database are applied, in the same way as for ExportCSV.
+//
+// All fields in the Avro schema are nullable. BOOL, INT64, FLOAT32, FLOAT64
+// and BYTES columns are written as the corresponding Avro types. STRING,
+// JSON, NUMERIC, TIMESTAMP and DATE columns are written as Avro strings in
+// the same format as ExportCSV uses, as Avro has no types that can hold these
+// values without losing precision. ARRAY columns are written as Avro arrays.
+// The Spanner type of each column is stored in the sqlType attribute of the
+// field, which is used by ImportAvro to restore the values.
+func ExportAvro(db *gorm.DB, model interface{}, w io.Writer) error {
+	var (
+		writer *goavro.OCFWriter
+		batch  []interface{}
+	)
+	err := export(db, model, func(table string, fields []*spannerpb.StructType_Field) error {
+		schema, err := avroSchema(table, fields)
+		if err != nil {
+			return err
+		}
+		writer, err = goavro.NewOCFWriter(goavro.OCFConfig{W: w, Schema: schema})
+		return err
+	}, func(fields []*spannerpb.StructType_Field, row *spanner.Row) error {
+		record := make(map[string]interface{}, len(fields))
+		for i, field := range fields {
+			var col spanner.GenericColumnValue
+			if err := row.Column(i, &col); err != nil {
+				return err
+			}
+			value, err := avroValue(field.Type, col.Value)
+			if err != nil {
+				return fmt.Errorf("failed to export column %s: %w", field.Name, err)
+			}
+			record[field.Name] = value
+		}
+		batch = append(batch, record)
+		if len(batch) == avroBlockSize {
+			if err := writer.Append(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return writer.Append(batch)
+	}
+	return nil
+}
+
+// export executes the query of the given gorm database for the given model
+// and calls header with the columns of the result before calling f for each
+// row.
+func export(db *gorm.DB, model interface{}, header func(table string, fields []*spannerpb.StructType_Field) error, f func(fields []*spannerpb.StructType_Field, row *spanner.Row) error) error {
+	table, err := tableName(db, model)
+	if err != nil {
+		return err
+	}
+	iter, err := query(db.Model(model))
+	if err != nil {
+		return err
+	}
+	defer iter.Stop()
+	// The metadata of the result is only available after the first call to
+	// Next, also if the result contains no rows.
+	row, err := iter.Next()
+	if err != nil && err != iterator.Done {
+		return err
+	}
+	if iter.Metadata == nil {
+		return fmt.Errorf("query for table %s did not return any metadata", table)
+	}
+	fields := iter.Metadata.RowType.GetFields()
+	if err := header(table, fields); err != nil {
+		return err
+	}
+	for err != iterator.Done {
+		if err := f(fields, row); err != nil {
+			return err
+		}
+		row, err = iter.Next()
+		if err != nil && err != iterator.Done {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportCSV writes the rows in the given CSV file to the table of the given
+// model. The first line of the file must contain the column names, and the
+// values must be in the format that is written by ExportCSV. The column
+// types are read from INFORMATION_SCHEMA.COLUMNS.
+//
+// The rows are written as InsertOrUpdate mutations with the Spanner client
+// library, so existing rows with the same primary key are overwritten and gorm
+// hooks are not invoked. The rows are written in batches of
+// ImportOptions.BatchSize rows, each in its own transaction. The rows that
+// were written before an error occurred are not rolled back, and ImportCSV
+// can be retried with the same file. ImportCSV can only be used with a
+// dialector that was created with a DSN.
+//
+// Example:
+//
+//	f, err := os.Open("singers.csv")
+//	...
+//	err = spannergorm.ImportCSV(db, &Singer{}, f, spannergorm.ImportOptions{})
+func ImportCSV(db *gorm.DB, model interface{}, r io.Reader, options ImportOptions) error {
+	table, err := tableName(db, model)
+	if err != nil {
+		return err
+	}
+	reader := csv.NewReader(r)
+	columns, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	columnTypes, err := importColumnTypes(db, table)
+	if err != nil {
+		return err
+	}
+	types := make([]*spannerpb.Type, len(columns))
+	for i, column := range columns {
+		spannerType, ok := columnTypes[column]
+		if !ok {
+			return fmt.Errorf("column %s not found in table %s", column, table)
+		}
+		if types[i], err = parseSpannerType(spannerType); err != nil {
+			return fmt.Errorf("column %s: %w", column, err)
+		}
+	}
+	return importRows(db, table, columns, options, func() ([]interface{}, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(record))
+		for i, s := range record {
+			value, err := parseCSVValue(types[i], s, options.NullValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for column %s: %w", columns[i], err)
+			}
+			values[i] = spanner.GenericColumnValue{Type: types[i], Value: value}
+		}
+		return values, nil
+	})
+}
+
+// ImportAvro writes the rows in the given Avro object container file to the
+// table of the given model. The file must have been written by ExportAvro, or
+// have the same schema. The rows are written in the same way as by ImportCSV.
+func ImportAvro(db *gorm.DB, model interface{}, r io.Reader, options ImportOptions) error {
+	table, err := tableName(db, model)
+	if err != nil {
+		return err
+	}
+	reader, err := goavro.NewOCFReader(r)
+	if err != nil {
+		return err
+	}
+	var schema struct {
+		Fields []struct {
+			Name    string `json:"name"`
+			SQLType string `json:"sqlType"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(reader.Codec().Schema()), &schema); err != nil {
+		return err
+	}
+	columns := make([]string, len(schema.Fields))
+	types := make([]*spannerpb.Type, len(schema.Fields))
+	for i, field := range schema.Fields {
+		columns[i] = field.Name
+		if types[i], err = parseSpannerType(field.SQLType); err != nil {
+			return fmt.Errorf("invalid sqlType for field %s: %w", field.Name, err)
+		}
+	}
+	return importRows(db, table, columns, options, func() ([]interface{}, error) {
+		if !reader.Scan() {
+			if err := reader.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		datum, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		record, ok := datum.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected Avro record: %v", datum)
+		}
+		values := make([]interface{}, len(columns))
+		for i, column := range columns {
+			value, err := fromAvroValue(types[i], record[column])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for column %s: %w", column, err)
+			}
+			values[i] = spanner.GenericColumnValue{Type: types[i], Value: value}
+		}
+		return values, nil
+	})
+}
+
+// importRows writes the rows that are returned by next to the given table in
+// batches. next must return io.EOF when there are no more rows.
+func importRows(db *gorm.DB, table string, columns []string, options ImportOptions, next func() ([]interface{}, error)) error {
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return err
+	}
+	if err := checkNotInTransaction(db, "import"); err != nil {
+		return err
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client, err := dialector.spannerClient(ctx)
+	if err != nil {
+		return err
+	}
+	return applyRows(ctx, client, table, columns, options, dialector.transactionTag(ctx, "import", table), next)
+}
+
+// applyRows writes the rows that are returned by next to the given table as
+// InsertOrUpdate mutations in batches of ImportOptions.BatchSize rows. next
+// must return io.EOF when there are no more rows.
+func applyRows(ctx context.Context, client *spanner.Client, table string, columns []string, options ImportOptions, transactionTag string, next func() ([]interface{}, error)) error {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+	applyOptions := []spanner.ApplyOption{spanner.Priority(requestOptions(ctx).Priority)}
+	if transactionTag != "" {
+		applyOptions = append(applyOptions, spanner.TransactionTag(transactionTag))
+	}
+	mutations := make([]*spanner.Mutation, 0, batchSize)
+	for {
+		values, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		mutations = append(mutations, spanner.InsertOrUpdate(table, columns, values))
+		if len(mutations) == batchSize {
+			if _, err := client.Apply(ctx, mutations, applyOptions...); err != nil {
+				return err
+			}
+			mutations = mutations[:0]
+		}
+	}
+	if len(mutations) > 0 {
+		if _, err := client.Apply(ctx, mutations, applyOptions...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableName returns the name of the table of the given model, or the table
+// that is set on the given gorm database.
+func tableName(db *gorm.DB, model interface{}) (string, error) {
+	if db.Statement.Table != "" {
+		return qualifiedTableName(db.Statement), nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return qualifiedTableName(stmt), nil
+}
+
+// importColumnTypes returns the types of the columns of the given table as
+// they are returned in INFORMATION_SCHEMA.COLUMNS.
+func importColumnTypes(db *gorm.DB, table string) (map[string]string, error) {
+	tableSchema, table := splitTableName(table, defaultSchemaOf(db))
+	rows, err := db.Raw(
+		"SELECT COLUMN_NAME, SPANNER_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		tableSchema, table,
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types := make(map[string]string)
+	for rows.Next() {
+		var column, spannerType string
+		if err := rows.Scan(&column, &spannerType); err != nil {
+			return nil, err
+		}
+		types[column] = spannerType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	return types, nil
+}
+
+var spannerTypeLengthRegexp = regexp.MustCompile(`\([^)]*\)`)
+
+// parseSpannerType parses a type as it is returned in the SPANNER_TYPE column
+// of INFORMATION_SCHEMA.COLUMNS, such as STRING(MAX) or ARRAY<INT64>.
+func parseSpannerType(s string) (*spannerpb.Type, error) {
+	name := strings.ToUpper(strings.TrimSpace(spannerTypeLengthRegexp.ReplaceAllString(s, "")))
+	if strings.HasPrefix(name, "ARRAY<") && strings.HasSuffix(name, ">") {
+		elem, err := parseSpannerType(name[len("ARRAY<") : len(name)-1])
+		if err != nil {
+			return nil, err
+		}
+		if elem.Code == spannerpb.TypeCode_ARRAY {
+			return nil, fmt.Errorf("nested arrays are not supported: %s", s)
+		}
+		return &spannerpb.Type{Code: spannerpb.TypeCode_ARRAY, ArrayElementType: elem}, nil
+	}
+	switch code := spannerpb.TypeCode(spannerpb.TypeCode_value[name]); code {
+	case spannerpb.TypeCode_BOOL, spannerpb.TypeCode_INT64, spannerpb.TypeCode_FLOAT32, spannerpb.TypeCode_FLOAT64,
+		spannerpb.TypeCode_NUMERIC, spannerpb.TypeCode_STRING, spannerpb.TypeCode_JSON, spannerpb.TypeCode_BYTES,
+		spannerpb.TypeCode_TIMESTAMP, spannerpb.TypeCode_DATE:
+		return &spannerpb.Type{Code: code}, nil
+	}
+	return nil, fmt.Errorf("unsupported column type: %s", s)
+}
+
+// formatSpannerType returns the name of the given type, such as
+// ARRAY<STRING>. It is the inverse of parseSpannerType.
+func formatSpannerType(t *spannerpb.Type) string {
+	if t.Code == spannerpb.TypeCode_ARRAY {
+		return "ARRAY<" + formatSpannerType(t.ArrayElementType) + ">"
+	}
+	return t.Code.String()
+}
+
+// csvValue returns the CSV representation of the given value. Spanner
+// returns all values, except BOOL and FLOAT values, as strings in their
+// canonical format, which is also the format that is used in CSV files.
+func csvValue(t *spannerpb.Type, value *structpb.Value, nullValue string) (string, error) {
+	switch v := value.GetKind().(type) {
+	case *structpb.Value_NullValue:
+		return nullValue, nil
+	case *structpb.Value_StringValue:
+		return v.StringValue, nil
+	case *structpb.Value_BoolValue:
+		return strconv.FormatBool(v.BoolValue), nil
+	case *structpb.Value_NumberValue:
+		bitSize := 64
+		if t.Code == spannerpb.TypeCode_FLOAT32 {
+			bitSize = 32
+		}
+		return strconv.FormatFloat(v.NumberValue, 'g', -1, bitSize), nil
+	case *structpb.Value_ListValue:
+		b, err := json.Marshal(v.ListValue.AsSlice())
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("unsupported value: %v", value)
+}
+
+// parseCSVValue parses a value that was written by csvValue.
+func parseCSVValue(t *spannerpb.Type, s, nullValue string) (*structpb.Value, error) {
+	if s == nullValue {
+		return structpb.NewNullValue(), nil
+	}
+	switch t.Code {
+	case spannerpb.TypeCode_BOOL:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewBoolValue(b), nil
+	case spannerpb.TypeCode_FLOAT32, spannerpb.TypeCode_FLOAT64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return floatValue(f), nil
+	case spannerpb.TypeCode_ARRAY:
+		var values []interface{}
+		if err := json.Unmarshal([]byte(s), &values); err != nil {
+			return nil, err
+		}
+		list, err := structpb.NewList(values)
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewListValue(list), nil
+	}
+	return structpb.NewStringValue(s), nil
+}
+
+// floatValue returns the Spanner representation of the given float. NaN and
+// infinity are represented as strings.
+func floatValue(f float64) *structpb.Value {
+	switch {
+	case math.IsNaN(f):
+		return structpb.NewStringValue("NaN")
+	case math.IsInf(f, 1):
+		return structpb.NewStringValue("Infinity")
+	case math.IsInf(f, -1):
+		return structpb.NewStringValue("-Infinity")
+	}
+	return structpb.NewNumberValue(f)
+}
+
+// avroSchema returns the Avro schema for the given columns.
+func avroSchema(table string, fields []*spannerpb.StructType_Field) (string, error) {
+	avroFields := make([]map[string]interface{}, len(fields))
+	for i, field := range fields {
+		t, err := avroType(field.Type)
+		if err != nil {
+			return "", fmt.Errorf("column %s: %w", field.Name, err)
+		}
+		avroFields[i] = map[string]interface{}{
+			"name":    field.Name,
+			"type":    []interface{}{"null", t},
+			"sqlType": formatSpannerType(field.Type),
+		}
+	}
+	schema, err := json.Marshal(map[string]interface{}{
+		"type":   "record",
+		"name":   table,
+		"fields": avroFields,
+	})
+	return string(schema), err
+}
+
+// avroType returns the Avro type that is used for the given Spanner type.
+func avroType(t *spannerpb.Type) (interface{}, error) {
+	switch t.Code {
+	case spannerpb.TypeCode_BOOL:
+		return "boolean", nil
+	case spannerpb.TypeCode_INT64:
+		return "long", nil
+	case spannerpb.TypeCode_FLOAT32:
+		return "float", nil
+	case spannerpb.TypeCode_FLOAT64:
+		return "double", nil
+	case spannerpb.TypeCode_BYTES:
+		return "bytes", nil
+	case spannerpb.TypeCode_STRING, spannerpb.TypeCode_JSON, spannerpb.TypeCode_NUMERIC,
+		spannerpb.TypeCode_TIMESTAMP, spannerpb.TypeCode_DATE:
+		return "string", nil
+	case spannerpb.TypeCode_ARRAY:
+		elem, err := avroType(t.ArrayElementType)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": []interface{}{"null", elem}}, nil
+	}
+	return nil, fmt.Errorf("unsupported column type: %s", t.Code)
+}
+
+// avroValue converts a Spanner value to the native Go value that goavro uses
+// for the Avro type of the given Spanner type.
+func avroValue(t *spannerpb.Type, value *structpb.Value) (interface{}, error) {
+	if _, ok := value.GetKind().(*structpb.Value_NullValue); ok {
+		return nil, nil
+	}
+	switch t.Code {
+	case spannerpb.TypeCode_BOOL:
+		return goavro.Union("boolean", value.GetBoolValue()), nil
+	case spannerpb.TypeCode_INT64:
+		i, err := strconv.ParseInt(value.GetStringValue(), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return goavro.Union("long", i), nil
+	case spannerpb.TypeCode_FLOAT32, spannerpb.TypeCode_FLOAT64:
+		f := value.GetNumberValue()
+		if s, ok := value.GetKind().(*structpb.Value_StringValue); ok {
+			var err error
+			if f, err = strconv.ParseFloat(s.StringValue, 64); err != nil {
+				return nil, err
+			}
+		}
+		if t.Code == spannerpb.TypeCode_FLOAT32 {
+			return goavro.Union("float", float32(f)), nil
+		}
+		return goavro.Union("double", f), nil
+	case spannerpb.TypeCode_BYTES:
+		b, err := base64.StdEncoding.DecodeString(value.GetStringValue())
+		if err != nil {
+			return nil, err
+		}
+		return goavro.Union("bytes", b), nil
+	case spannerpb.TypeCode_ARRAY:
+		values := value.GetListValue().GetValues()
+		items := make([]interface{}, len(values))
+		for i, v := range values {
+			item, err := avroValue(t.ArrayElementType, v)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return goavro.Union("array", items), nil
+	}
+	return goavro.Union("string", value.GetStringValue()), nil
+}
+
+// fromAvroValue converts a value that was decoded by goavro to the Spanner
+// representation of the given type. It is the inverse of avroValue.
+func fromAvroValue(t *spannerpb.Type, value interface{}) (*structpb.Value, error) {
+	// goavro decodes non-null union values as a map with one entry.
+	if union, ok := value.(map[string]interface{}); ok && len(union) == 1 {
+		for _, v := range union {
+			value = v
+		}
+	}
+	if value == nil {
+		return structpb.NewNullValue(), nil
+	}
+	switch v := value.(type) {
+	case bool:
+		return structpb.NewBoolValue(v), nil
+	case int64:
+		return structpb.NewStringValue(strconv.FormatInt(v, 10)), nil
+	case int32:
+		return structpb.NewStringValue(strconv.FormatInt(int64(v), 10)), nil
+	case float64:
+		return floatValue(v), nil
+	case float32:
+		return floatValue(float64(v)), nil
+	case []byte:
+		return structpb.NewStringValue(base64.StdEncoding.EncodeToString(v)), nil
+	case string:
+		return structpb.NewStringValue(v), nil
+	case []interface{}:
+		if t.Code != spannerpb.TypeCode_ARRAY {
+			return nil, fmt.Errorf("unexpected array value for type %s", formatSpannerType(t))
+		}
+		values := make([]*structpb.Value, len(v))
+		for i, item := range v {
+			value, err := fromAvroValue(t.ArrayElementType, item)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return structpb.NewListValue(&structpb.ListValue{Values: values}), nil
+	}
+	return nil, fmt.Errorf("unsupported Avro value: %T", value)
+}
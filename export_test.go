@@ -0,0 +1,210 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type exportRecord struct {
+	ID       int64
+	Name     string
+	Price    string
+	Data     string
+	Updated  string
+	Tags     string
+	Active   bool
+	Score    float64
+	Checksum []byte
+}
+
+var exportRecordFields = []*spannerpb.StructType_Field{
+	{Name: "id", Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}},
+	{Name: "name", Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}},
+	{Name: "price", Type: &spannerpb.Type{Code: spannerpb.TypeCode_NUMERIC}},
+	{Name: "data", Type: &spannerpb.Type{Code: spannerpb.TypeCode_JSON}},
+	{Name: "updated", Type: &spannerpb.Type{Code: spannerpb.TypeCode_TIMESTAMP}},
+	{Name: "tags", Type: &spannerpb.Type{Code: spannerpb.TypeCode_ARRAY, ArrayElementType: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}}},
+	{Name: "active", Type: &spannerpb.Type{Code: spannerpb.TypeCode_BOOL}},
+	{Name: "score", Type: &spannerpb.Type{Code: spannerpb.TypeCode_FLOAT64}},
+	{Name: "checksum", Type: &spannerpb.Type{Code: spannerpb.TypeCode_BYTES}},
+}
+
+var exportRecordRows = []*structpb.ListValue{
+	{Values: []*structpb.Value{
+		structpb.NewStringValue("1"),
+		structpb.NewStringValue("Alice, \"the first\""),
+		structpb.NewStringValue("12345678901234567890.123456789"),
+		structpb.NewStringValue(`{"a":[1,2]}`),
+		structpb.NewStringValue("2024-06-01T12:00:00.123456789Z"),
+		structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("x"), structpb.NewNullValue()}}),
+		structpb.NewBoolValue(true),
+		structpb.NewNumberValue(0.1),
+		structpb.NewStringValue("AQID"),
+	}},
+	{Values: []*structpb.Value{
+		structpb.NewStringValue("2"),
+		structpb.NewStringValue(""),
+		structpb.NewNullValue(),
+		structpb.NewNullValue(),
+		structpb.NewNullValue(),
+		structpb.NewNullValue(),
+		structpb.NewNullValue(),
+		structpb.NewStringValue("NaN"),
+		structpb.NewNullValue(),
+	}},
+}
+
+func putExportRecordResults(t *testing.T, server *testutil.MockedSpannerInMemTestServer) {
+	if err := server.TestSpanner.PutStatementResult("SELECT * FROM `export_records`", &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: exportRecordFields}},
+			Rows:     exportRecordRows,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]string{
+		"id": "INT64", "name": "STRING(MAX)", "price": "NUMERIC", "data": "JSON", "updated": "TIMESTAMP",
+		"tags": "ARRAY<STRING(100)>", "active": "BOOL", "score": "FLOAT64", "checksum": "BYTES(MAX)",
+	}
+	rows := make([]*structpb.ListValue, 0, len(exportRecordFields))
+	for _, field := range exportRecordFields {
+		rows = append(rows, &structpb.ListValue{Values: []*structpb.Value{
+			structpb.NewStringValue(field.Name), structpb.NewStringValue(types[field.Name]),
+		}})
+	}
+	if err := server.TestSpanner.PutStatementResult(
+		"SELECT COLUMN_NAME, SPANNER_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2",
+		&testutil.StatementResult{
+			Type: testutil.StatementResultResultSet,
+			ResultSet: &spannerpb.ResultSet{
+				Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+					{Name: "COLUMN_NAME", Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}},
+					{Name: "SPANNER_TYPE", Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}},
+				}}},
+				Rows: rows,
+			},
+		}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifyImportedRows verifies that the imported rows were written as
+// mutations with the same values as the exported rows.
+func verifyImportedRows(t *testing.T, server *testutil.MockedSpannerInMemTestServer) {
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	mutations := commitReqs[0].(*spannerpb.CommitRequest).Mutations
+	if g, w := len(mutations), len(exportRecordRows); g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, mutation := range mutations {
+		write := mutation.GetInsertOrUpdate()
+		if write == nil {
+			t.Fatalf("mutation %d is not an InsertOrUpdate mutation: %v", i, mutation)
+		}
+		if g, w := write.Table, "export_records"; g != w {
+			t.Fatalf("table mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		if g, w := len(write.Columns), len(exportRecordFields); g != w {
+			t.Fatalf("column count mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		if g, w := write.Values[0], exportRecordRows[i]; !proto.Equal(g, w) {
+			t.Fatalf("row %d mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+}
+
+func TestExportImportCSV(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	putExportRecordResults(t, server)
+
+	var buf bytes.Buffer
+	if err := ExportCSV(db, &exportRecord{}, &buf, ExportOptions{NullValue: `\N`}); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if g, w := buf.String(), "id,name,price,data,updated,tags,active,score,checksum\n"+
+		`1,"Alice, ""the first""",12345678901234567890.123456789,"{""a"":[1,2]}",2024-06-01T12:00:00.123456789Z,"[""x"",null]",true,0.1,AQID`+"\n"+
+		`2,,\N,\N,\N,\N,\N,NaN,\N`+"\n"; g != w {
+		t.Fatalf("csv mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	drainRequestsFromServer(server.TestSpanner)
+	if err := ImportCSV(db, &exportRecord{}, &buf, ImportOptions{NullValue: `\N`}); err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	verifyImportedRows(t, server)
+}
+
+func TestExportImportAvro(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	putExportRecordResults(t, server)
+
+	var buf bytes.Buffer
+	if err := ExportAvro(db, &exportRecord{}, &buf); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	drainRequestsFromServer(server.TestSpanner)
+	if err := ImportAvro(db, &exportRecord{}, &buf, ImportOptions{}); err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	verifyImportedRows(t, server)
+}
+
+func TestParseSpannerType(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		input string
+		want  string
+	}{
+		{"STRING(MAX)", "STRING"},
+		{"BYTES(1024)", "BYTES"},
+		{"ARRAY<STRING(100)>", "ARRAY<STRING>"},
+		{"ARRAY<FLOAT32>", "ARRAY<FLOAT32>"},
+		{"numeric", "NUMERIC"},
+	} {
+		got, err := parseSpannerType(test.input)
+		if err != nil {
+			t.Fatalf("%s: %v", test.input, err)
+		}
+		if g, w := formatSpannerType(got), test.want; g != w {
+			t.Errorf("%s: type mismatch\n Got: %v\nWant: %v", test.input, g, w)
+		}
+	}
+	for _, input := range []string{"STRUCT<a INT64>", "PROTO<my.Message>", "ARRAY<ARRAY<INT64>>"} {
+		if _, err := parseSpannerType(input); err == nil {
+			t.Errorf("%s: missing expected error", input)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// foreignKeyNoAction is the delete rule of foreign keys without an ON DELETE
+// action in INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS.
+const foreignKeyNoAction = "NO ACTION"
+
+// foreignKeyConstraints returns the foreign key constraints that are created
+// for the table of the given schema, ordered by name.
+func foreignKeyConstraints(s *schema.Schema) []*schema.Constraint {
+	if s == nil {
+		return nil
+	}
+	var constraints []*schema.Constraint
+	for _, rel := range s.Relationships.Relations {
+		if rel.Field.IgnoreMigration {
+			continue
+		}
+		if constraint := rel.ParseConstraint(); constraint != nil && constraint.Schema == s {
+			constraints = append(constraints, constraint)
+		}
+	}
+	sort.Slice(constraints, func(i, j int) bool {
+		return constraints[i].Name < constraints[j].Name
+	})
+	return constraints
+}
+
+// foreignKeyOnDelete returns the ON DELETE action of a `constraint:OnDelete`
+// tag in the form that Spanner uses. It returns false if Spanner does not
+// support the action.
+func foreignKeyOnDelete(action string) (string, bool) {
+	switch strings.Join(strings.Fields(strings.ToUpper(action)), " ") {
+	case "":
+		return "", true
+	case "CASCADE":
+		return "CASCADE", true
+	case foreignKeyNoAction, "NO_ACTION":
+		return foreignKeyNoAction, true
+	}
+	return "", false
+}
+
+// validateForeignKeys returns a *ModelError for each foreign key constraint
+// of the given schema with an action that Spanner does not support. Spanner
+// supports the ON DELETE actions CASCADE and NO ACTION, and does not support
+// ON UPDATE actions.
+func (m spannerMigrator) validateForeignKeys(s *schema.Schema) []error {
+	if m.DB.DisableForeignKeyConstraintWhenMigrating {
+		return nil
+	}
+	var errs []error
+	for _, constraint := range foreignKeyConstraints(s) {
+		if _, ok := foreignKeyOnDelete(constraint.OnDelete); !ok {
+			errs = append(errs, &ModelError{
+				Model:      s.Name,
+				Field:      constraint.Field.Name,
+				Problem:    fmt.Sprintf("OnDelete action %q of foreign key %s is not supported", constraint.OnDelete, constraint.Name),
+				Suggestion: "Use CASCADE or NO ACTION, e.g. `gorm:\"constraint:OnDelete:CASCADE\"`",
+			})
+		}
+		if onUpdate, ok := foreignKeyOnDelete(constraint.OnUpdate); !ok || onUpdate == "CASCADE" {
+			errs = append(errs, &ModelError{
+				Model:      s.Name,
+				Field:      constraint.Field.Name,
+				Problem:    fmt.Sprintf("OnUpdate action %q of foreign key %s is not supported, as Spanner does not support ON UPDATE actions", constraint.OnUpdate, constraint.Name),
+				Suggestion: "Remove OnUpdate from the constraint tag",
+			})
+		}
+	}
+	return errs
+}
+
+// buildConstraint returns the definition of the given foreign key
+// constraint. ON UPDATE actions are not included, as Spanner does not support
+// them.
+func buildConstraint(constraint *schema.Constraint) (sql string, results []interface{}) {
+	sql = "CONSTRAINT ? FOREIGN KEY ? REFERENCES ??"
+	if onDelete, _ := foreignKeyOnDelete(constraint.OnDelete); onDelete != "" {
+		sql += " ON DELETE " + onDelete
+	}
+
+	var foreignKeys, references []interface{}
+	for _, field := range constraint.ForeignKeys {
+		foreignKeys = append(foreignKeys, clause.Column{Name: field.DBName})
+	}
+
+	for _, field := range constraint.References {
+		references = append(references, clause.Column{Name: field.DBName})
+	}
+	results = append(results, clause.Table{Name: constraint.Name}, foreignKeys, clause.Table{Name: constraint.ReferenceSchema.Table}, references)
+	return
+}
+
+// CreateConstraint adds the foreign key or check constraint with the given
+// name to an existing table. Foreign keys are created with the same definition
+// as in CreateTable.
+func (m spannerMigrator) CreateConstraint(value interface{}, name string) error {
+	var constraint *schema.Constraint
+	var table string
+	if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		constraint, _, table = m.GuessConstraintAndTable(stmt, name)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if constraint == nil {
+		return m.Migrator.CreateConstraint(value, name)
+	}
+	sql, vars := buildConstraint(constraint)
+	return m.DB.Exec("ALTER TABLE ? ADD "+sql, append([]interface{}{clause.Table{Name: table}}, vars...)...).Error
+}
+
+// migrateForeignKeys recreates the foreign keys of an existing table whose
+// definition in the database differs from the model. A foreign key is
+// recreated if its columns, its referenced table or columns, or its ON DELETE
+// action differ, for example if a column has been added to a composite
+// foreign key. Spanner does not support changing a foreign key, so the
+// foreign key is dropped and added again.
+func (m spannerMigrator) migrateForeignKeys(value interface{}) error {
+	if m.DB.DisableForeignKeyConstraintWhenMigrating {
+		return nil
+	}
+	var constraints []*schema.Constraint
+	if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		constraints = foreignKeyConstraints(stmt.Schema)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(constraints) == 0 {
+		return nil
+	}
+	foreignKeys, err := m.GetForeignKeys(value)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]ForeignKey, len(foreignKeys))
+	for _, foreignKey := range foreignKeys {
+		existing[foreignKey.Name] = foreignKey
+	}
+	for _, constraint := range constraints {
+		foreignKey, ok := existing[constraint.Name]
+		if !ok {
+			// The foreign key is added by AutoMigrate.
+			continue
+		}
+		want, _ := foreignKeyOnDelete(constraint.OnDelete)
+		if want == "" {
+			want = foreignKeyNoAction
+		}
+		if got, _ := foreignKeyOnDelete(foreignKey.OnDelete); got == want && m.foreignKeyMatches(foreignKey, constraint) {
+			continue
+		}
+		if err := m.DropConstraint(value, constraint.Name); err != nil {
+			return err
+		}
+		if err := m.CreateConstraint(value, constraint.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// equivalentForeignKey returns the foreign key of the given table that has the
+// same columns, referenced table and referenced columns as the given
+// constraint, and true if the table has such a foreign key.
+func (m spannerMigrator) equivalentForeignKey(table string, constraint *schema.Constraint) (ForeignKey, bool) {
+	if constraint.ReferenceSchema == nil {
+		return ForeignKey{}, false
+	}
+	foreignKeys, err := m.GetForeignKeys(table)
+	if err != nil {
+		return ForeignKey{}, false
+	}
+	for _, foreignKey := range foreignKeys {
+		if m.foreignKeyMatches(foreignKey, constraint) {
+			return foreignKey, true
+		}
+	}
+	return ForeignKey{}, false
+}
+
+// foreignKeyMatches returns true if the given foreign key in the database has
+// the same columns, referenced table and referenced columns as the given
+// constraint. The columns of composite foreign keys must be in the same order.
+func (m spannerMigrator) foreignKeyMatches(foreignKey ForeignKey, constraint *schema.Constraint) bool {
+	if constraint.ReferenceSchema == nil {
+		return false
+	}
+	_, referencedTable := m.tableSchemaAndName(constraint.ReferenceSchema.Table)
+	columns := make([]string, len(constraint.ForeignKeys))
+	for i, field := range constraint.ForeignKeys {
+		columns[i] = field.DBName
+	}
+	references := make([]string, len(constraint.References))
+	for i, field := range constraint.References {
+		references[i] = field.DBName
+	}
+	return strings.EqualFold(foreignKey.ReferencedTable, referencedTable) &&
+		equalFoldStrings(foreignKey.Columns, columns) &&
+		equalFoldStrings(foreignKey.ReferencedColumns, references)
+}
+
+func equalFoldStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// migrateReferencingForeignKeys adds the foreign keys of the has-one and
+// has-many associations of the given model to the existing tables of the
+// associated models. gorm only adds a foreign key to an existing table when
+// the model of that table is migrated, so adding an association to a model
+// would otherwise not add a foreign key to the table of an associated model
+// that is not migrated in the same call. The associated table must already
+// have the foreign key columns.
+func (m spannerMigrator) migrateReferencingForeignKeys(value interface{}, migrated map[string]bool) error {
+	if m.DB.DisableForeignKeyConstraintWhenMigrating || m.DB.IgnoreRelationshipsWhenMigrating {
+		return nil
+	}
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		for _, rel := range stmt.Schema.Relationships.Relations {
+			if rel.Field.IgnoreMigration || rel.JoinTable != nil {
+				continue
+			}
+			constraint := rel.ParseConstraint()
+			if constraint == nil || constraint.Schema == nil || constraint.Schema == stmt.Schema || migrated[constraint.Schema.Table] {
+				continue
+			}
+			model := reflect.New(constraint.Schema.ModelType).Interface()
+			if !m.HasTable(model) {
+				continue
+			}
+			hasColumns := true
+			for _, field := range constraint.ForeignKeys {
+				hasColumns = hasColumns && m.HasColumn(model, field.DBName)
+			}
+			if !hasColumns || m.HasConstraint(model, constraint.Name) {
+				continue
+			}
+			if err := m.CreateConstraint(model, constraint.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,312 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const getForeignKeysSql = `SELECT FK.CONSTRAINT_NAME, FK.COLUMN_NAME, PK.TABLE_NAME, PK.COLUMN_NAME, RC.DELETE_RULE
+			FROM INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS RC
+			INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE FK
+				ON FK.CONSTRAINT_CATALOG = RC.CONSTRAINT_CATALOG
+				AND FK.CONSTRAINT_SCHEMA = RC.CONSTRAINT_SCHEMA
+				AND FK.CONSTRAINT_NAME = RC.CONSTRAINT_NAME
+			INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE PK
+				ON PK.CONSTRAINT_CATALOG = RC.UNIQUE_CONSTRAINT_CATALOG
+				AND PK.CONSTRAINT_SCHEMA = RC.UNIQUE_CONSTRAINT_SCHEMA
+				AND PK.CONSTRAINT_NAME = RC.UNIQUE_CONSTRAINT_NAME
+				AND PK.ORDINAL_POSITION = FK.POSITION_IN_UNIQUE_CONSTRAINT
+			WHERE FK.TABLE_SCHEMA = @p1 AND FK.TABLE_NAME = @p2
+			ORDER BY FK.CONSTRAINT_NAME, FK.ORDINAL_POSITION`
+
+type label struct {
+	ID   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name string
+}
+
+type release struct {
+	ID      int64 `gorm:"primaryKey;autoIncrement:false"`
+	LabelID int64
+	Label   label `gorm:"constraint:OnDelete:cascade"`
+}
+
+type invalidForeignKeyAction struct {
+	ID      int64 `gorm:"primaryKey;autoIncrement:false"`
+	LabelID int64
+	Label   label `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+}
+
+func TestMigrateForeignKeyOnDelete(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 0)
+
+	if err := db.Migrator().AutoMigrate(&label{}, &release{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE TABLE `labels` (`id` INT64,`name` STRING(MAX)) PRIMARY KEY (`id`)",
+		"CREATE TABLE `releases` (`id` INT64,`label_id` INT64," +
+			"CONSTRAINT `fk_releases_label` FOREIGN KEY (`label_id`) REFERENCES `labels`(`id`) ON DELETE CASCADE) " +
+			"PRIMARY KEY (`id`)",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigrateForeignKeyActions(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name:   "test-operation-1",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+		&longrunningpb.Operation{
+			Name:   "test-operation-2",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+	})
+	columns := []string{"CONSTRAINT_NAME", "COLUMN_NAME", "TABLE_NAME", "COLUMN_NAME", "DELETE_RULE"}
+	_ = putStringRowsResult(server, getForeignKeysSql, columns, [][]string{
+		{"fk_releases_label", "label_id", "labels", "id", "NO ACTION"},
+	})
+
+	m := db.Migrator().(spannerMigrator)
+	defer m.Close()
+	if err := m.migrateForeignKeys(&release{}); err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	for _, request := range server.TestDatabaseAdmin.Reqs() {
+		statements = append(statements, request.(*databasepb.UpdateDatabaseDdlRequest).GetStatements()...)
+	}
+	if g, w := statements, []string{
+		"ALTER TABLE `releases` DROP CONSTRAINT `fk_releases_label`",
+		"ALTER TABLE `releases` ADD CONSTRAINT `fk_releases_label` FOREIGN KEY (`label_id`) REFERENCES `labels`(`id`) ON DELETE CASCADE",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Migrating the table again does not change the foreign key.
+	_ = putStringRowsResult(server, getForeignKeysSql, columns, [][]string{
+		{"fk_releases_label", "label_id", "labels", "id", "CASCADE"},
+	})
+	if err := m.migrateForeignKeys(&release{}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 2; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigrateCompositeForeignKeyColumns(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	// The foreign key in the database only contains one of the columns of the
+	// composite foreign key of the model.
+	columns := []string{"CONSTRAINT_NAME", "COLUMN_NAME", "TABLE_NAME", "COLUMN_NAME", "DELETE_RULE"}
+	_ = putStringRowsResult(server, getForeignKeysSql, columns, [][]string{
+		{"fk_tenant_albums_singer", "singer_id", "tenant_singers", "id", "NO ACTION"},
+	})
+
+	m := db.Migrator().(spannerMigrator)
+	defer m.Close()
+	if err := m.migrateForeignKeys(&tenantAlbum{}); err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	for _, request := range server.TestDatabaseAdmin.Reqs() {
+		statements = append(statements, request.(*databasepb.UpdateDatabaseDdlRequest).GetStatements()...)
+	}
+	if g, w := statements, []string{
+		"ALTER TABLE `tenant_albums` DROP CONSTRAINT `fk_tenant_albums_singer`",
+		"ALTER TABLE `tenant_albums` ADD CONSTRAINT `fk_tenant_albums_singer` FOREIGN KEY (`tenant_id`,`singer_id`) REFERENCES `tenant_singers`(`tenant_id`,`id`)",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// A foreign key with the same columns is not changed.
+	_ = putStringRowsResult(server, getForeignKeysSql, columns, [][]string{
+		{"fk_tenant_albums_singer", "tenant_id", "tenant_singers", "tenant_id", "NO ACTION"},
+		{"fk_tenant_albums_singer", "singer_id", "tenant_singers", "id", "NO ACTION"},
+	})
+	reqs := len(server.TestDatabaseAdmin.Reqs())
+	if err := m.migrateForeignKeys(&tenantAlbum{}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), reqs; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigrateInvalidForeignKeyAction(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	err := db.Migrator().AutoMigrate(&invalidForeignKeyAction{})
+	var modelErr *ModelError
+	if !errors.As(err, &modelErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, modelErr)
+	}
+	for _, want := range []string{
+		`invalidForeignKeyAction.Label: OnDelete action "SET NULL" of foreign key fk_invalid_foreign_key_actions_label is not supported`,
+		`invalidForeignKeyAction.Label: OnUpdate action "CASCADE" of foreign key fk_invalid_foreign_key_actions_label is not supported`,
+	} {
+		if g := err.Error(); !strings.Contains(g, want) {
+			t.Fatalf("error message mismatch\n Got: %v\nWant: %v", g, want)
+		}
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+type fkArtist struct {
+	ID      int64 `gorm:"primaryKey;autoIncrement:false"`
+	Records []fkRecord
+}
+
+type fkRecord struct {
+	ID         int64 `gorm:"primaryKey;autoIncrement:false"`
+	FkArtistID int64
+}
+
+func TestMigrateReferencingForeignKeys(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name        string
+		foreignKeys [][]string
+		want        []string
+	}{
+		{
+			name: "missing",
+			want: []string{"ALTER TABLE `fk_records` ADD CONSTRAINT `fk_fk_artists_records` FOREIGN KEY (`fk_artist_id`) REFERENCES `fk_artists`(`id`)"},
+		},
+		{
+			name:        "equivalent",
+			foreignKeys: [][]string{{"FK_Records_Artists", "fk_artist_id", "fk_artists", "id", "NO ACTION"}},
+		},
+		{
+			name:        "different columns",
+			foreignKeys: [][]string{{"FK_Records_Artists", "id", "fk_artists", "id", "NO ACTION"}},
+			want:        []string{"ALTER TABLE `fk_records` ADD CONSTRAINT `fk_fk_artists_records` FOREIGN KEY (`fk_artist_id`) REFERENCES `fk_artists`(`id`)"},
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, server, teardown := setupTestGormConnection(t)
+			defer teardown()
+			anyProto, err := anypb.New(&emptypb.Empty{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+				Name:   "test-operation",
+				Done:   true,
+				Result: &longrunningpb.Operation_Response{Response: anyProto},
+			}})
+			_ = putCountStatementResult(server, "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3", 1)
+			_ = putCountStatementResult(server, "SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = @p1 AND table_name = @p2 AND column_name = @p3", 1)
+			_ = putCountStatementResult(server, "SELECT count(*) FROM INFORMATION_SCHEMA.table_constraints WHERE constraint_schema = @p1 AND table_name = @p2 AND constraint_name = @p3", 0)
+			columns := []string{"CONSTRAINT_NAME", "COLUMN_NAME", "TABLE_NAME", "COLUMN_NAME", "DELETE_RULE"}
+			_ = putStringRowsResult(server, getForeignKeysSql, columns, test.foreignKeys)
+
+			m := db.Migrator().(spannerMigrator)
+			defer m.Close()
+			if err := m.migrateReferencingForeignKeys(&fkArtist{}, map[string]bool{"fk_artists": true}); err != nil {
+				t.Fatal(err)
+			}
+			var statements []string
+			for _, request := range server.TestDatabaseAdmin.Reqs() {
+				statements = append(statements, request.(*databasepb.UpdateDatabaseDdlRequest).GetStatements()...)
+			}
+			if g, w := statements, test.want; !reflect.DeepEqual(g, w) {
+				t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+			}
+		})
+	}
+}
+
+func TestHasConstraintEquivalentForeignKey(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putCountStatementResult(server, "SELECT count(*) FROM INFORMATION_SCHEMA.table_constraints WHERE constraint_schema = @p1 AND table_name = @p2 AND constraint_name = @p3", 0)
+	columns := []string{"CONSTRAINT_NAME", "COLUMN_NAME", "TABLE_NAME", "COLUMN_NAME", "DELETE_RULE"}
+	_ = putStringRowsResult(server, getForeignKeysSql, columns, [][]string{
+		{"FK_Releases_Labels", "label_id", "labels", "id", "CASCADE"},
+	})
+
+	m := db.Migrator()
+	if !m.HasConstraint(&release{}, "fk_releases_label") {
+		t.Fatal("foreign key with a different name not found")
+	}
+	// Check constraints are only found by name.
+	if m.HasConstraint(&release{}, "chk_releases_label") {
+		t.Fatal("unexpected check constraint")
+	}
+}
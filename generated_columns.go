@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"regexp"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// generationExpression matches the generation expression of a generated
+// column in the type of a field, e.g. `gorm:"type:STRING(MAX) AS (LOWER(name)) STORED"`.
+var generationExpression = regexp.MustCompile(`(?i)\bAS\s*\(`)
+
+// isGeneratedField returns true if the column of the given field is a
+// generated column.
+func isGeneratedField(field *schema.Field) bool {
+	return field.DBName != "" && generationExpression.MatchString(field.TagSettings["TYPE"])
+}
+
+// isReadOnlyGeneratedField returns true if the given field is marked as
+// read-only with the `->` tag, and its column gets its value from the
+// database, e.g. `gorm:"->;default:(-)"`. Read-only fields without a default
+// value and fields that are ignored by the migrator, such as computed values
+// with `gorm:"->;-:migration"`, are not columns that are filled by the
+// database, and can be missing from the table.
+func isReadOnlyGeneratedField(field *schema.Field) bool {
+	return field.DBName != "" && field.Readable && !field.Creatable && !field.Updatable &&
+		field.HasDefaultValue && !field.IgnoreMigration
+}
+
+// registerGeneratedColumnCallbacks registers callbacks that omit generated
+// columns from Create and Update operations, and that return the values of
+// generated columns from Create operations. Spanner does not allow values to
+// be written to generated columns, so these fields do not need to be marked
+// as read-only with the `->` tag.
+func registerGeneratedColumnCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("gorm:spanner:omit_generated_columns", omitGeneratedColumns); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().Before("gorm:create").Register("gorm:spanner:return_generated_columns", returnGeneratedColumns); err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register("gorm:spanner:omit_generated_columns", omitGeneratedColumns)
+}
+
+func omitGeneratedColumns(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	for _, field := range db.Statement.Schema.Fields {
+		if isGeneratedField(field) {
+			db.Statement.Omits = append(db.Statement.Omits, field.DBName)
+		}
+	}
+}
+
+// returnGeneratedColumns adds a THEN RETURN clause for the generated columns
+// and the read-only columns with a default value of the model to a Create
+// operation, so the values that are computed by Spanner are set in the model
+// after the insert without a separate query. The columns with a default value
+// that gorm returns are also included. Create operations with a THEN RETURN
+// clause are always executed as DML statements, also if WithMutations is used.
+func returnGeneratedColumns(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || stmt.SQL.Len() > 0 {
+		return
+	}
+	if _, ok := stmt.Clauses[clause.Returning{}.Name()]; ok {
+		return
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array:
+	default:
+		return
+	}
+	var generated []*schema.Field
+	for _, field := range stmt.Schema.Fields {
+		if isGeneratedField(field) || isReadOnlyGeneratedField(field) {
+			generated = append(generated, field)
+		}
+	}
+	if len(generated) == 0 {
+		return
+	}
+	// Read-only fields with a default value are also in
+	// FieldsWithDefaultDBValue, and are only returned once.
+	columns := make([]clause.Column, 0, len(stmt.Schema.FieldsWithDefaultDBValue)+len(generated))
+	returned := make(map[string]bool, cap(columns))
+	for _, fields := range [][]*schema.Field{stmt.Schema.FieldsWithDefaultDBValue, generated} {
+		for _, field := range fields {
+			if !returned[field.DBName] {
+				returned[field.DBName] = true
+				columns = append(columns, clause.Column{Name: field.DBName})
+			}
+		}
+	}
+	stmt.AddClause(clause.Returning{Columns: columns})
+}
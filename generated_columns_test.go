@@ -0,0 +1,174 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type generatedSinger struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	FirstName string
+	LastName  string
+	FullName  string `gorm:"type:STRING(MAX) AS (ARRAY_TO_STRING([first_name, last_name], \" \")) STORED"`
+}
+
+func TestOmitGeneratedColumns(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT INTO `generated_singers` (`id`,`first_name`,`last_name`) VALUES (@p1,@p2,@p3) THEN RETURN `full_name`"
+	updateSql := "UPDATE `generated_singers` SET `first_name`=@p1,`last_name`=@p2 WHERE `id` = @p3"
+	updateLastNameSql := "UPDATE `generated_singers` SET `last_name`=@p1 WHERE `id` = @p2"
+	_ = putStringRowsResult(server, insertSql, []string{"full_name"}, [][]string{{"Pete Allison"}})
+	for _, sql := range []string{updateSql, updateLastNameSql} {
+		_ = server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+			Type:        testutil.StatementResultUpdateCount,
+			UpdateCount: 1,
+		})
+	}
+
+	singer := generatedSinger{ID: 1, FirstName: "Pete", LastName: "Allison"}
+	if err := db.Create(&singer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).Sql, insertSql; g != w {
+		t.Fatalf("insert sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := singer.FullName, "Pete Allison"; g != w {
+		t.Fatalf("full name mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if err := db.Save(&singer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).Sql, updateSql; g != w {
+		t.Fatalf("save sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if err := db.Model(&singer).Omit("first_name").Updates(map[string]interface{}{"first_name": "Peter", "last_name": "Allison", "full_name": "Peter Allison"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).Sql, updateLastNameSql; g != w {
+		t.Fatalf("updates sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+type readOnlySinger struct {
+	ID        string `gorm:"primaryKey;type:STRING(36);default:GENERATE_UUID()"`
+	Name      string
+	NameToken string `gorm:"->;default:(-)"`
+}
+
+func TestReturnReadOnlyColumns(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	stmt := db.Session(&gorm.Session{DryRun: true}).Create(&readOnlySinger{Name: "Alice"}).Statement
+	if g, w := stmt.SQL.String(), "INSERT INTO `read_only_singers` (`name`) VALUES (?) THEN RETURN `id`,`name_token`"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// An explicit THEN RETURN clause is not changed.
+	stmt = db.Session(&gorm.Session{DryRun: true}).Clauses(clause.Returning{}).Create(&readOnlySinger{Name: "Alice"}).Statement
+	if g, w := stmt.SQL.String(), "INSERT INTO `read_only_singers` (`name`) VALUES (?) THEN RETURN *"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+type computedSinger struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	FirstName string
+	LastName  string
+	FullName  string `gorm:"type:STRING(MAX) AS (ARRAY_TO_STRING([first_name, last_name], \" \")) STORED"`
+	// AlbumCount is computed by a query and is not a column in the table.
+	AlbumCount int64 `gorm:"->;-:migration"`
+}
+
+func TestCreateDoesNotReturnComputedFields(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT INTO `computed_singers` (`id`,`first_name`,`last_name`) VALUES (@p1,@p2,@p3) THEN RETURN `full_name`"
+	_ = putStringRowsResult(server, insertSql, []string{"full_name"}, [][]string{{"Pete Allison"}})
+
+	singer := computedSinger{ID: 1, FirstName: "Pete", LastName: "Allison"}
+	if err := db.Create(&singer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).Sql, insertSql; g != w {
+		t.Fatalf("insert sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := singer.FullName, "Pete Allison"; g != w {
+		t.Fatalf("full name mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestIsGeneratedField(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		dataType  string
+		generated bool
+	}{
+		{"", false},
+		{"STRING(MAX)", false},
+		{"STRING(MAX) AS (LOWER(name)) STORED", true},
+		{"INT64 as(1+2)", true},
+		{"STRING(MAX) DEFAULT ('alias')", false},
+	} {
+		field := &schema.Field{DBName: "name", TagSettings: map[string]string{"TYPE": test.dataType}}
+		if g, w := isGeneratedField(field), test.generated; g != w {
+			t.Errorf("%q: generated mismatch\n Got: %v\nWant: %v", test.dataType, g, w)
+		}
+	}
+}
+
+func TestIsReadOnlyGeneratedField(t *testing.T) {
+	t.Parallel()
+
+	type model struct {
+		ID          int64
+		Token       string `gorm:"->;default:(-)"`
+		ReadOnly    string `gorm:"->"`
+		Computed    string `gorm:"->;-:migration"`
+		NotMigrated string `gorm:"->;default:(-);-:migration"`
+		Name        string
+	}
+	s, err := schema.Parse(&model{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"Token":       true,
+		"ReadOnly":    false,
+		"Computed":    false,
+		"NotMigrated": false,
+		"Name":        false,
+	} {
+		if g, w := isReadOnlyGeneratedField(s.LookUpField(name)), want; g != w {
+			t.Errorf("%s: read-only generated mismatch\n Got: %v\nWant: %v", name, g, w)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hints contains gorm clauses that add Spanner hints to the
+// statements that gorm generates. Statement hints are added in front of SELECT,
+// UPDATE and DELETE statements, and table hints are added after the table in
+// the FROM clause. The clauses can be combined, and all statement hints of a
+// statement are rendered in one hint block.
+//
+// Example:
+//
+//	var singers []Singer
+//	err := db.Clauses(
+//	  hints.ForceIndex("idx_singers_last_name"),
+//	  hints.OptimizerVersion(7),
+//	  hints.UseAdditionalParallelism(),
+//	).Where("last_name = ?", "Doe").Find(&singers).Error
+//	// @{OPTIMIZER_VERSION=7,USE_ADDITIONAL_PARALLELISM=TRUE} SELECT * FROM `singers`
+//	// @{FORCE_INDEX=`idx_singers_last_name`} WHERE last_name = @p1
+//
+// The hints use the GoogleSQL syntax, as the Spanner gorm dialector only
+// supports databases that use the GoogleSQL dialect. Hints are not added to
+// statements that are created with Raw or Exec.
+package hints
+
+import (
+	"strconv"
+
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// statementClauses are the clauses that statement hints are added to. Only
+// the clause that starts the statement is built, so the hint is rendered once.
+var statementClauses = []string{"SELECT", "UPDATE", "DELETE"}
+
+// StatementHint is a hint for a whole statement, such as
+// @{OPTIMIZER_VERSION=7}. A hint replaces an earlier hint with the same name on
+// the same statement.
+type StatementHint struct {
+	Name  string
+	Value string
+}
+
+// Statement returns a statement hint with the given name and value. Use this
+// for hints that have no function in this package.
+//
+// Example:
+//
+//	db.Clauses(hints.Statement("LOCK_SCANNED_RANGES", "exclusive")).
+//	  Model(&singer).Update("name", "Alice")
+//	// @{LOCK_SCANNED_RANGES=exclusive} UPDATE `singers` SET ...
+func Statement(name, value string) StatementHint {
+	return StatementHint{Name: name, Value: value}
+}
+
+// OptimizerVersion instructs Spanner to use the given version of the query
+// optimizer for the statement.
+func OptimizerVersion(version int) StatementHint {
+	return Statement("OPTIMIZER_VERSION", strconv.Itoa(version))
+}
+
+// OptimizerStatisticsPackage instructs Spanner to use the given optimizer
+// statistics package for the statement.
+func OptimizerStatisticsPackage(name string) StatementHint {
+	return Statement("OPTIMIZER_STATISTICS_PACKAGE", name)
+}
+
+// UseAdditionalParallelism allows Spanner to use more parallelism to execute
+// the query, which can reduce the latency of queries that scan a lot of data.
+func UseAdditionalParallelism() StatementHint {
+	return Statement("USE_ADDITIONAL_PARALLELISM", "TRUE")
+}
+
+// ForceIndex instructs Spanner to use the given index for the table in the
+// FROM clause of the query. It is the same as spannergorm.ForceIndex.
+func ForceIndex(name string) spannergorm.IndexHint {
+	return spannergorm.ForceIndex(name)
+}
+
+// ModifyStatement implements gorm.StatementModifier.
+func (hint StatementHint) ModifyStatement(stmt *gorm.Statement) {
+	for _, name := range statementClauses {
+		c := stmt.Clauses[name]
+		switch before := c.BeforeExpression.(type) {
+		case nil:
+			c.BeforeExpression = statementHints{hint}
+		case statementHints:
+			c.BeforeExpression = before.with(hint)
+		default:
+			c.BeforeExpression = spannergorm.Exprs{statementHints{hint}, before}
+		}
+		stmt.Clauses[name] = c
+	}
+}
+
+// Build implements clause.Expression.
+func (hint StatementHint) Build(builder clause.Builder) {
+	statementHints{hint}.Build(builder)
+}
+
+// statementHints are the statement hints of one statement.
+type statementHints []StatementHint
+
+// with returns the hints with the given hint added, or with the value of an
+// existing hint with the same name replaced.
+func (hints statementHints) with(hint StatementHint) statementHints {
+	result := make(statementHints, len(hints), len(hints)+1)
+	copy(result, hints)
+	for i, h := range result {
+		if h.Name == hint.Name {
+			result[i] = hint
+			return result
+		}
+	}
+	return append(result, hint)
+}
+
+func (hints statementHints) Build(builder clause.Builder) {
+	if len(hints) == 0 {
+		return
+	}
+	builder.WriteString("@{")
+	for i, hint := range hints {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(hint.Name)
+		builder.WriteByte('=')
+		builder.WriteString(hint.Value)
+	}
+	builder.WriteByte('}')
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hints
+
+import (
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+type singer struct {
+	ID       int64
+	LastName string
+}
+
+func TestStatementHints(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	var singers []singer
+	stmt := db.Session(&gorm.Session{DryRun: true}).
+		Clauses(ForceIndex("idx_singers_last_name"), OptimizerVersion(6), UseAdditionalParallelism(), OptimizerVersion(7)).
+		Where("last_name = ?", "Doe").
+		Find(&singers).Statement
+	if g, w := stmt.SQL.String(), "@{OPTIMIZER_VERSION=7,USE_ADDITIONAL_PARALLELISM=TRUE} SELECT * FROM `singers` @{FORCE_INDEX=`idx_singers_last_name`} WHERE last_name = ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	var count int64
+	stmt = db.Session(&gorm.Session{DryRun: true}).
+		Clauses(OptimizerStatisticsPackage("auto_20240601")).
+		Model(&singer{}).
+		Count(&count).Statement
+	if g, w := stmt.SQL.String(), "@{OPTIMIZER_STATISTICS_PACKAGE=auto_20240601} SELECT count(*) FROM `singers`"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	stmt = db.Session(&gorm.Session{DryRun: true}).
+		Clauses(Statement("LOCK_SCANNED_RANGES", "exclusive")).
+		Model(&singer{ID: 1}).
+		Update("last_name", "Doe").Statement
+	if g, w := stmt.SQL.String(), "@{LOCK_SCANNED_RANGES=exclusive} UPDATE `singers` SET `last_name`=? WHERE `id` = ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	stmt = db.Session(&gorm.Session{DryRun: true}).
+		Clauses(Statement("LOCK_SCANNED_RANGES", "exclusive")).
+		Delete(&singer{ID: 1}).Statement
+	if g, w := stmt.SQL.String(), "@{LOCK_SCANNED_RANGES=exclusive} DELETE FROM `singers` WHERE `singers`.`id` = ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestStatementHintsExecuted(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	updateSql := "@{LOCK_SCANNED_RANGES=exclusive} UPDATE `singers` SET `last_name`=@p1 WHERE `id` = @p2"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+
+	res := db.Clauses(Statement("LOCK_SCANNED_RANGES", "exclusive")).Model(&singer{ID: 1}).Update("last_name", "Doe")
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if g, w := res.RowsAffected, int64(1); g != w {
+		t.Fatalf("rows affected mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	var found bool
+	for _, req := range drainRequestsFromServer(server.TestSpanner) {
+		if executeReq, ok := req.(*spannerpb.ExecuteSqlRequest); ok && executeReq.Sql == updateSql {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("update statement with hint not found")
+	}
+}
+
+func setupTestGormConnection(t *testing.T) (db *gorm.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	server, _, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	db, err := gorm.Open(spannergorm.New(spannergorm.Config{
+		DriverName: "spanner",
+		DSN:        fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address),
+
+		DisableDialectCheck: true,
+	}), &gorm.Config{})
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	return db, server, serverTeardown
+}
+
+func drainRequestsFromServer(server testutil.InMemSpannerServer) []interface{} {
+	var reqs []interface{}
+loop:
+	for {
+		select {
+		case req := <-server.ReceivedRequests():
+			reqs = append(reqs, req)
+		default:
+			break loop
+		}
+	}
+	return reqs
+}
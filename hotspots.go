@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// HotspotWarning is a primary key or an index of a model that is likely to
+// cause a hotspot in Spanner. Spanner splits tables and indexes into ranges of
+// keys. Keys that increase or decrease monotonically, such as timestamps,
+// write all new rows to the same split, which limits the write throughput of
+// the table to the throughput of a single server.
+type HotspotWarning struct {
+	// Model is the name of the model.
+	Model string
+	// Field is the name of the field that is the leading column of the key.
+	Field string
+	// Index is the name of the index, or empty if the warning is about the
+	// primary key of the table.
+	Index string
+	// Problem describes why the key is likely to cause a hotspot.
+	Problem string
+	// Suggestion describes how the hotspot can be prevented.
+	Suggestion string
+}
+
+func (w HotspotWarning) String() string {
+	name := w.Model + "." + w.Field
+	if w.Index != "" {
+		name += " (" + w.Index + ")"
+	}
+	return fmt.Sprintf("%s: %s. %s", name, w.Problem, w.Suggestion)
+}
+
+// AnalyzeHotspots inspects the primary keys and indexes of the given models,
+// and returns a warning for each key whose leading column is likely to
+// increase monotonically. These are timestamp columns, including commit
+// timestamps, and INT64 columns with an autoCreateTime or autoUpdateTime tag.
+// Primary keys with an autoIncrement tag are not reported, as these use
+// bit-reversed sequences. No statements are executed.
+//
+// Set Config.WarnHotspots to log these warnings when AutoMigrate is called.
+// The analysis is intended for development. Not all monotonic keys can be
+// detected, e.g. INT64 keys that are generated by the application.
+//
+// Example:
+//
+//	warnings, err := db.Migrator().(spannergorm.SchemaAnalyzer).AnalyzeHotspots(&Event{})
+//	for _, w := range warnings {
+//	  log.Println(w)
+//	}
+func (m spannerMigrator) AnalyzeHotspots(values ...interface{}) ([]HotspotWarning, error) {
+	warnings := make([]HotspotWarning, 0)
+	for _, value := range values {
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			warnings = append(warnings, m.analyzeHotspots(stmt.Schema)...)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return warnings, nil
+}
+
+func (m spannerMigrator) analyzeHotspots(s *schema.Schema) []HotspotWarning {
+	if s == nil {
+		return nil
+	}
+	var warnings []HotspotWarning
+	// The primary key of an interleaved table starts with the key of its
+	// parent, which is reported for the parent.
+	if interleaved, _ := interleaveOf(s); interleaved == nil && len(s.PrimaryFields) > 0 {
+		field := s.PrimaryFields[0]
+		if kind := m.monotonicKindOf(field); kind != "" {
+			warnings = append(warnings, HotspotWarning{
+				Model:   s.Name,
+				Field:   field.Name,
+				Problem: fmt.Sprintf("the first column of the primary key is %s, which writes all new rows to the end of the table", kind),
+				Suggestion: "Use a UUID or an autoIncrement column, which uses a bit-reversed sequence, as the first column of the " +
+					"primary key, or add a shard column, e.g. `shard INT64 AS (MOD(FARM_FINGERPRINT(...), 10)) STORED`, before it",
+			})
+		}
+	}
+	for _, index := range s.ParseIndexes() {
+		if len(index.Fields) == 0 {
+			continue
+		}
+		field := index.Fields[0].Field
+		if kind := m.monotonicKindOf(field); kind != "" {
+			warnings = append(warnings, HotspotWarning{
+				Model:   s.Name,
+				Field:   field.Name,
+				Index:   index.Name,
+				Problem: fmt.Sprintf("the first column of the index is %s, which writes all new index entries to the end of the index", kind),
+				Suggestion: "Add a shard column, e.g. `shard INT64 AS (MOD(FARM_FINGERPRINT(...), 10)) STORED`, as the first column " +
+					"of the index, or make the timestamp a later column of the index",
+			})
+		}
+	}
+	return warnings
+}
+
+// deletedAtType is the type of the soft delete field of gorm models.
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// monotonicKindOf returns a description of the values of the given field if
+// they are likely to increase monotonically, or an empty string otherwise.
+func (m spannerMigrator) monotonicKindOf(field *schema.Field) string {
+	if field == nil {
+		return ""
+	}
+	// Rows are deleted much less often than they are created, so indexes on
+	// the soft delete field of gorm.Model are not reported.
+	if field.FieldType == deletedAtType {
+		return ""
+	}
+	switch field.DataType {
+	case schema.Time:
+		if m.Dialector.isCommitTimestampField(field) {
+			return "a commit timestamp"
+		}
+		return "a timestamp"
+	case schema.Int, schema.Uint:
+		if field.AutoCreateTime > 0 || field.AutoUpdateTime > 0 {
+			return "an epoch timestamp"
+		}
+	}
+	return ""
+}
+
+// warnHotspots logs the hotspot warnings of the given models with the logger
+// of the database.
+func (m spannerMigrator) warnHotspots(values ...interface{}) error {
+	warnings, err := m.AnalyzeHotspots(values...)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		m.DB.Logger.Warn(m.DB.Statement.Context, "possible hotspot: %s", w)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type hotspotEvent struct {
+	CreatedAt time.Time `gorm:"primaryKey"`
+	ID        string    `gorm:"primaryKey"`
+	Name      string    `gorm:"index:idx_hotspot_events_name_updated"`
+	UpdatedAt int64     `gorm:"autoUpdateTime;index;index:idx_hotspot_events_name_updated"`
+}
+
+type hotspotSinger struct {
+	gorm.Model
+	Name string `gorm:"index"`
+}
+
+func TestAnalyzeHotspots(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	warnings, err := db.Migrator().(SchemaAnalyzer).AnalyzeHotspots(&hotspotEvent{}, &hotspotSinger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, w := range warnings {
+		got = append(got, w.Model+"."+w.Field+"/"+w.Index)
+	}
+	if g, w := got, []string{"hotspotEvent.CreatedAt/", "hotspotEvent.UpdatedAt/idx_hotspot_events_updated_at"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("warnings mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := warnings[0].Problem, "the first column of the primary key is a timestamp"; !strings.HasPrefix(g, w) {
+		t.Fatalf("problem mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := warnings[1].Problem, "the first column of the index is an epoch timestamp"; !strings.HasPrefix(g, w) {
+		t.Fatalf("problem mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWarnHotspots(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{WarnHotspots: true})
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 0)
+	recorder := &logRecorder{}
+	db = db.Session(&gorm.Session{Logger: logger.New(recorder, logger.Config{LogLevel: logger.Warn})})
+
+	if err := db.AutoMigrate(&hotspotEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	for _, line := range recorder.lines {
+		if strings.Contains(line, "possible hotspot: hotspotEvent.") {
+			warnings = append(warnings, line)
+		}
+	}
+	if g, w := len(warnings), 2; g != w {
+		t.Fatalf("warning count mismatch\n Got: %v\nWant: %v\n%s", g, w, strings.Join(recorder.lines, "\n"))
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/api/iterator"
+	"gorm.io/gorm"
+)
+
+// errHybridTransactionStatement is returned for operations of the database/sql
+// package that are not supported in a hybrid transaction.
+var errHybridTransactionStatement = errors.New("spanner: prepared statements and nested transactions are not supported in a hybrid transaction")
+
+// errHybridReadOnlyDML is returned for DML statements in a read-only hybrid
+// transaction.
+var errHybridReadOnlyDML = errors.New("spanner: DML statements are not supported in a read-only hybrid transaction")
+
+// RunHybridTransaction runs f in a read/write transaction of the Spanner
+// client library, and returns the commit timestamp of the transaction. f is
+// called with a gorm database that executes all its statements in the
+// transaction, and with the *spanner.ReadWriteTransaction itself. This makes
+// it possible to mix gorm operations with client library calls, such as reads
+// with a key set and buffered mutations, in one atomic transaction. The
+// statements of tx see the writes of the DML statements of rwTx and vice
+// versa.
+//
+// The transaction is retried by the client library if it is aborted by
+// Spanner, which means that f can be called more than once. f must therefore
+// not have any side effects outside of the transaction. The tx of a retried
+// attempt is a new gorm database.
+//
+// The priority and the transaction tag of the request options of ctx are
+// applied to the transaction, and the priority and the request tag of the
+// context of each statement are applied to that statement. The AfterCommit
+// and AfterRollback functions of tx are called once when the transaction has
+// finished. RunHybridTransaction can only be used with a dialector that was
+// created with a DSN, and not in a gorm transaction. tx does not support
+// nested transactions or WithSpannerConn. Use rwTx.BufferWrite to buffer
+// mutations.
+//
+// Example:
+//
+//	_, err := spannergorm.RunHybridTransaction(ctx, db, func(tx *gorm.DB, rwTx *spanner.ReadWriteTransaction) error {
+//	  row, err := rwTx.ReadRow(ctx, "accounts", spanner.Key{1}, []string{"balance"})
+//	  if err != nil {
+//	    return err
+//	  }
+//	  var balance int64
+//	  if err := row.Column(0, &balance); err != nil {
+//	    return err
+//	  }
+//	  return tx.Create(&Payment{AccountID: 1, Amount: balance}).Error
+//	})
+func RunHybridTransaction(ctx context.Context, db *gorm.DB, f func(tx *gorm.DB, rwTx *spanner.ReadWriteTransaction) error) (time.Time, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := checkNotInTransaction(db, "hybrid transaction"); err != nil {
+		return time.Time{}, err
+	}
+	client, err := dialector.spannerClient(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	options := requestOptions(ctx)
+	var pool *hybridConnPool
+	var fErr error
+	resp, err := client.ReadWriteTransactionWithOptions(ctx, func(ctx context.Context, rwTx *spanner.ReadWriteTransaction) error {
+		pool = openHybridConnPool(rwTx)
+		defer pool.Close()
+		fErr = f(hybridSession(ctx, db, pool), rwTx)
+		return fErr
+	}, spanner.TransactionOptions{
+		CommitPriority: options.Priority,
+		TransactionTag: dialector.transactionTag(ctx, "transaction", ""),
+	})
+	if pool != nil {
+		// The transaction is rolled back if f returns an error.
+		switch outcome := ClassifyCommitError(err); {
+		case outcome == CommitOutcomeCommitted:
+			pool.runHooks(pool.afterCommit)
+		case outcome == CommitOutcomeNotCommitted || fErr != nil:
+			pool.runHooks(pool.afterRollback)
+		}
+	}
+	return resp.CommitTs, err
+}
+
+// RunHybridReadOnlyTransaction runs f in a read-only transaction of the
+// Spanner client library. f is called with a gorm database that executes all
+// its queries in the transaction, and with the *spanner.ReadOnlyTransaction
+// itself, so gorm queries and client library reads see the same snapshot of
+// the database. The read-only staleness of ctx that is set with
+// WithReadOnlyStaleness is applied to the transaction. DML statements fail in
+// the transaction. RunHybridReadOnlyTransaction can only be used with a
+// dialector that was created with a DSN, and not in a gorm transaction.
+//
+// Example:
+//
+//	err := spannergorm.RunHybridReadOnlyTransaction(ctx, db, func(tx *gorm.DB, roTx *spanner.ReadOnlyTransaction) error {
+//	  var singers []Singer
+//	  if err := tx.Find(&singers).Error; err != nil {
+//	    return err
+//	  }
+//	  iter := roTx.Read(ctx, "albums", spanner.AllKeys(), []string{"id", "title"})
+//	  defer iter.Stop()
+//	  return iter.Do(func(row *spanner.Row) error { ... })
+//	})
+func RunHybridReadOnlyTransaction(ctx context.Context, db *gorm.DB, f func(tx *gorm.DB, roTx *spanner.ReadOnlyTransaction) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return err
+	}
+	if err := checkNotInTransaction(db, "hybrid transaction"); err != nil {
+		return err
+	}
+	client, err := dialector.spannerClient(ctx)
+	if err != nil {
+		return err
+	}
+	roTx := client.ReadOnlyTransaction()
+	if bound, ok := ctx.Value(readOnlyTransactionKey{}).(spanner.TimestampBound); ok {
+		roTx = roTx.WithTimestampBound(bound)
+	}
+	defer roTx.Close()
+	pool := openHybridConnPool(roTx)
+	defer pool.Close()
+	return f(hybridSession(ctx, db, pool), roTx)
+}
+
+// hybridSession returns a session of db that executes its statements on the
+// given connection pool of a hybrid transaction.
+func hybridSession(ctx context.Context, db *gorm.DB, pool *hybridConnPool) *gorm.DB {
+	tx := db.Session(&gorm.Session{Context: ctx, SkipDefaultTransaction: true})
+	tx.Statement.ConnPool = pool
+	return tx
+}
+
+// hybridQuerier is implemented by the read/write and read-only transactions of
+// the Spanner client library.
+type hybridQuerier interface {
+	QueryWithOptions(ctx context.Context, statement spanner.Statement, opts spanner.QueryOptions) *spanner.RowIterator
+}
+
+// hybridConnPool is the gorm.ConnPool of a hybrid transaction. It is a
+// database/sql connection pool whose connections execute all statements in
+// the transaction of the client library.
+type hybridConnPool struct {
+	*sql.DB
+
+	transactionHooks
+}
+
+func openHybridConnPool(tx hybridQuerier) *hybridConnPool {
+	return &hybridConnPool{DB: sql.OpenDB(&hybridConnector{tx: tx})}
+}
+
+// hybridConnector is the driver.Connector of a hybridConnPool.
+type hybridConnector struct {
+	tx hybridQuerier
+}
+
+func (c *hybridConnector) Connect(context.Context) (driver.Conn, error) {
+	return &hybridConn{tx: c.tx}, nil
+}
+
+func (c *hybridConnector) Driver() driver.Driver {
+	return hybridDriver{}
+}
+
+// hybridDriver is the driver of a hybridConnector. Connections can only be
+// created by the connector.
+type hybridDriver struct{}
+
+func (hybridDriver) Open(string) (driver.Conn, error) {
+	return nil, errHybridTransactionStatement
+}
+
+// hybridConn is a connection that executes statements in the transaction of a
+// hybridConnPool.
+type hybridConn struct {
+	tx hybridQuerier
+}
+
+var (
+	_ driver.ExecerContext     = (*hybridConn)(nil)
+	_ driver.QueryerContext    = (*hybridConn)(nil)
+	_ driver.NamedValueChecker = (*hybridConn)(nil)
+)
+
+func (c *hybridConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errHybridTransactionStatement
+}
+
+func (c *hybridConn) Close() error {
+	return nil
+}
+
+func (c *hybridConn) Begin() (driver.Tx, error) {
+	return nil, errHybridTransactionStatement
+}
+
+// CheckNamedValue accepts all values. The values are encoded by the Spanner
+// client library, which supports more types than database/sql.
+func (c *hybridConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c *hybridConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rwTx, ok := c.tx.(*spanner.ReadWriteTransaction)
+	if !ok {
+		return nil, errHybridReadOnlyDML
+	}
+	statement, err := hybridStatement(query, args)
+	if err != nil {
+		return nil, err
+	}
+	count, err := rwTx.UpdateWithOptions(ctx, statement, requestOptions(ctx).queryOptions())
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(count), nil
+}
+
+func (c *hybridConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	statement, err := hybridStatement(query, args)
+	if err != nil {
+		return nil, err
+	}
+	it := c.tx.QueryWithOptions(ctx, statement, requestOptions(ctx).queryOptions())
+	// The first row is fetched to get the metadata with the columns of the
+	// result.
+	row, err := it.Next()
+	if err != nil && err != iterator.Done {
+		it.Stop()
+		return nil, err
+	}
+	return &hybridRows{it: it, next: row}, nil
+}
+
+// hybridStatement converts the given query and arguments to a statement for
+// the Spanner client library. Named arguments are added as parameters with
+// their name.
+func hybridStatement(query string, args []driver.NamedValue) (spanner.Statement, error) {
+	var vars []interface{}
+	named := make(map[string]interface{})
+	for _, arg := range args {
+		if arg.Name != "" {
+			named[arg.Name] = arg.Value
+		} else {
+			vars = append(vars, arg.Value)
+		}
+	}
+	statement, err := toSpannerStatement(query, vars)
+	if err != nil {
+		return spanner.Statement{}, err
+	}
+	for name, value := range named {
+		statement.Params[name] = value
+	}
+	return statement, nil
+}
+
+// hybridRows are the rows of a query in a hybrid transaction. The values are
+// returned with the same types as by the Spanner database/sql driver.
+type hybridRows struct {
+	it   *spanner.RowIterator
+	next *spanner.Row
+}
+
+func (r *hybridRows) Columns() []string {
+	if r.it.Metadata == nil {
+		return nil
+	}
+	fields := r.it.Metadata.RowType.Fields
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field.Name
+	}
+	return columns
+}
+
+func (r *hybridRows) Close() error {
+	r.it.Stop()
+	return nil
+}
+
+func (r *hybridRows) Next(dest []driver.Value) error {
+	row := r.next
+	r.next = nil
+	if row == nil {
+		var err error
+		if row, err = r.it.Next(); err == iterator.Done {
+			return io.EOF
+		} else if err != nil {
+			return err
+		}
+	}
+	for i := 0; i < row.Size(); i++ {
+		var col spanner.GenericColumnValue
+		if err := row.Column(i, &col); err != nil {
+			return err
+		}
+		value, err := hybridColumnValue(col)
+		if err != nil {
+			return err
+		}
+		dest[i] = value
+	}
+	return nil
+}
+
+// hybridColumnValue decodes the given column value to the type that the
+// Spanner database/sql driver uses for the type of the column.
+func hybridColumnValue(col spanner.GenericColumnValue) (driver.Value, error) {
+	var v interface{}
+	switch col.Type.Code {
+	case spannerpb.TypeCode_INT64:
+		v = &spanner.NullInt64{}
+	case spannerpb.TypeCode_FLOAT32:
+		v = &spanner.NullFloat32{}
+	case spannerpb.TypeCode_FLOAT64:
+		v = &spanner.NullFloat64{}
+	case spannerpb.TypeCode_NUMERIC:
+		v = &spanner.NullNumeric{}
+	case spannerpb.TypeCode_STRING:
+		v = &spanner.NullString{}
+	case spannerpb.TypeCode_JSON:
+		// There is no native type for JSON in database/sql, so an invalid
+		// NullJSON is returned instead of nil.
+		var value spanner.NullJSON
+		err := col.Decode(&value)
+		return value, err
+	case spannerpb.TypeCode_BYTES:
+		var value []byte
+		err := col.Decode(&value)
+		return value, err
+	case spannerpb.TypeCode_BOOL:
+		v = &spanner.NullBool{}
+	case spannerpb.TypeCode_DATE:
+		v = &spanner.NullDate{}
+	case spannerpb.TypeCode_TIMESTAMP:
+		v = &spanner.NullTime{}
+	case spannerpb.TypeCode_ARRAY:
+		return hybridArrayValue(col)
+	default:
+		return col, nil
+	}
+	if err := col.Decode(v); err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case *spanner.NullInt64:
+		return nullValue(v.Valid, v.Int64), nil
+	case *spanner.NullFloat32:
+		return nullValue(v.Valid, v.Float32), nil
+	case *spanner.NullFloat64:
+		return nullValue(v.Valid, v.Float64), nil
+	case *spanner.NullNumeric:
+		return nullValue(v.Valid, v.Numeric), nil
+	case *spanner.NullString:
+		return nullValue(v.Valid, v.StringVal), nil
+	case *spanner.NullBool:
+		return nullValue(v.Valid, v.Bool), nil
+	case *spanner.NullDate:
+		return nullValue(v.Valid, v.Date), nil
+	case *spanner.NullTime:
+		return nullValue(v.Valid, v.Time), nil
+	}
+	return nil, nil
+}
+
+func nullValue(valid bool, value interface{}) driver.Value {
+	if !valid {
+		return nil
+	}
+	return value
+}
+
+// hybridArrayValue decodes the given ARRAY column value to a slice of the
+// null type of the element type of the array.
+func hybridArrayValue(col spanner.GenericColumnValue) (driver.Value, error) {
+	var v interface{}
+	switch col.Type.ArrayElementType.Code {
+	case spannerpb.TypeCode_INT64:
+		v = &[]spanner.NullInt64{}
+	case spannerpb.TypeCode_FLOAT32:
+		v = &[]spanner.NullFloat32{}
+	case spannerpb.TypeCode_FLOAT64:
+		v = &[]spanner.NullFloat64{}
+	case spannerpb.TypeCode_NUMERIC:
+		v = &[]spanner.NullNumeric{}
+	case spannerpb.TypeCode_STRING:
+		v = &[]spanner.NullString{}
+	case spannerpb.TypeCode_JSON:
+		v = &[]spanner.NullJSON{}
+	case spannerpb.TypeCode_BYTES:
+		v = &[][]byte{}
+	case spannerpb.TypeCode_BOOL:
+		v = &[]spanner.NullBool{}
+	case spannerpb.TypeCode_DATE:
+		v = &[]spanner.NullDate{}
+	case spannerpb.TypeCode_TIMESTAMP:
+		v = &[]spanner.NullTime{}
+	default:
+		return col, nil
+	}
+	if err := col.Decode(v); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(v).Elem().Interface(), nil
+}
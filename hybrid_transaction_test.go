@@ -0,0 +1,186 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+func TestRunHybridTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	drainRequestsFromServer(server.TestSpanner)
+
+	insertSql := "INSERT INTO `labels` (`id`,`name`) VALUES (@p1,@p2)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	querySql := "SELECT * FROM `labels` WHERE name = @p1"
+	_ = putStringRowsResult(server, querySql, []string{"id", "name"}, [][]string{{"1", "Label 1"}})
+
+	ctx := WithRequestOptions(context.Background(), RequestOptions{TransactionTag: "hybrid", RequestTag: "find-labels"})
+	committed := false
+	commitTs, err := RunHybridTransaction(ctx, db, func(tx *gorm.DB, rwTx *spanner.ReadWriteTransaction) error {
+		var labels []label
+		if err := tx.Where("name = ?", "Label 1").Find(&labels).Error; err != nil {
+			return err
+		}
+		if g, w := labels, []label{{ID: 1, Name: "Label 1"}}; !reflect.DeepEqual(g, w) {
+			t.Fatalf("labels mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		if err := tx.Create(&label{ID: 2, Name: "Label 2"}).Error; err != nil {
+			return err
+		}
+		if err := AfterCommit(tx, func() { committed = true }); err != nil {
+			return err
+		}
+		return rwTx.BufferWrite([]*spanner.Mutation{spanner.Insert("labels", []string{"id", "name"}, []interface{}{3, "Label 3"})})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commitTs.IsZero() {
+		t.Fatal("missing commit timestamp")
+	}
+	if !committed {
+		t.Fatal("AfterCommit function was not called")
+	}
+
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	sqlReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(sqlReqs), 2; g != w {
+		t.Fatalf("sql request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	query, insert := sqlReqs[0].(*spannerpb.ExecuteSqlRequest), sqlReqs[1].(*spannerpb.ExecuteSqlRequest)
+	if g, w := query.Sql, querySql; g != w {
+		t.Fatalf("query sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := query.GetRequestOptions().GetRequestTag(), "find-labels"; g != w {
+		t.Fatalf("request tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if query.GetTransaction().GetBegin().GetReadWrite() == nil {
+		t.Fatalf("query did not begin a read/write transaction: %v", query.GetTransaction())
+	}
+	if g, w := insert.Sql, insertSql; g != w {
+		t.Fatalf("insert sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if insert.GetTransaction().GetId() == nil {
+		t.Fatalf("insert was not executed in the transaction: %v", insert.GetTransaction())
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commit := commitReqs[0].(*spannerpb.CommitRequest)
+	if g, w := len(commit.Mutations), 1; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := commit.GetRequestOptions().GetTransactionTag(), "hybrid"; g != w {
+		t.Fatalf("transaction tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestRunHybridTransactionRollback(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	drainRequestsFromServer(server.TestSpanner)
+
+	insertSql := "INSERT INTO `labels` (`id`,`name`) VALUES (@p1,@p2)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	want := errors.New("test error")
+	rolledBack := false
+	_, err := RunHybridTransaction(context.Background(), db, func(tx *gorm.DB, rwTx *spanner.ReadWriteTransaction) error {
+		if err := tx.Create(&label{ID: 1, Name: "Label 1"}).Error; err != nil {
+			return err
+		}
+		if err := AfterRollback(tx, func() { rolledBack = true }); err != nil {
+			return err
+		}
+		// Nested transactions are not supported.
+		if err := tx.Transaction(func(tx *gorm.DB) error { return nil }); err == nil {
+			t.Fatal("missing error for nested transaction")
+		}
+		return want
+	})
+	if !errors.Is(err, want) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, want)
+	}
+	if !rolledBack {
+		t.Fatal("AfterRollback function was not called")
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 0; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// A hybrid transaction cannot be started in a gorm transaction.
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := RunHybridTransaction(context.Background(), tx, func(*gorm.DB, *spanner.ReadWriteTransaction) error { return nil })
+		return err
+	}); !errors.Is(err, ErrInTransaction) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, ErrInTransaction)
+	}
+}
+
+func TestRunHybridReadOnlyTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	drainRequestsFromServer(server.TestSpanner)
+
+	querySql := "SELECT * FROM `labels`"
+	_ = putStringRowsResult(server, querySql, []string{"id", "name"}, [][]string{{"1", "Label 1"}, {"2", "Label 2"}})
+
+	err := RunHybridReadOnlyTransaction(context.Background(), db, func(tx *gorm.DB, roTx *spanner.ReadOnlyTransaction) error {
+		var labels []label
+		if err := tx.Find(&labels).Error; err != nil {
+			return err
+		}
+		if g, w := len(labels), 2; g != w {
+			t.Fatalf("label count mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		if g, w := tx.Create(&label{ID: 3}).Error, errHybridReadOnlyDML; !errors.Is(g, w) {
+			t.Fatalf("create error mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(reqs), 1; g != w {
+		t.Fatalf("sql request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if reqs[0].(*spannerpb.ExecuteSqlRequest).GetTransaction().GetSingleUse() != nil {
+		t.Fatal("query was not executed in a read-only transaction")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// gormSpannerSequenceSkipRangeTag sets the range of values that the
+	// sequence or identity column of an autoIncrement field skips, e.g.
+	// `gorm_sequence_skip_range:"1,1000"`.
+	gormSpannerSequenceSkipRangeTag = "gorm_sequence_skip_range"
+	// gormSpannerSequenceStartCounterTag sets the initial value of the
+	// internal counter of the sequence or identity column of an
+	// autoIncrement field, e.g. `gorm_sequence_start_counter:"1000"`.
+	gormSpannerSequenceStartCounterTag = "gorm_sequence_start_counter"
+)
+
+// IdentityMode determines how the migrator generates the values of integer
+// primary keys with an autoIncrement tag. See Config.IdentityMode.
+type IdentityMode int
+
+const (
+	// IdentityModeSequence creates a bit-reversed sequence for each table with
+	// an autoIncrement field, and uses GET_NEXT_SEQUENCE_VALUE as the default
+	// value of the column. The sequence is named <table>_seq, unless the
+	// field has a gorm_sequence_name tag. This is the default.
+	IdentityModeSequence IdentityMode = iota
+	// IdentityModeIdentity creates autoIncrement fields as identity columns
+	// with GENERATED BY DEFAULT AS IDENTITY (BIT_REVERSED_POSITIVE). Spanner
+	// manages the sequence of an identity column.
+	IdentityModeIdentity
+	// IdentityModeUUID does not support autoIncrement fields, and AutoMigrate
+	// returns a *ModelError for each integer primary key with an
+	// autoIncrement tag. Use a string primary key with a GENERATE_UUID()
+	// default value instead, for example with UUIDBaseModel.
+	IdentityModeUUID
+)
+
+func (m IdentityMode) String() string {
+	switch m {
+	case IdentityModeSequence:
+		return "IdentityModeSequence"
+	case IdentityModeIdentity:
+		return "IdentityModeIdentity"
+	case IdentityModeUUID:
+		return "IdentityModeUUID"
+	}
+	return fmt.Sprintf("IdentityMode(%d)", int(m))
+}
+
+// sequenceOptions are the options of the sequence or identity column of an
+// autoIncrement field.
+type sequenceOptions struct {
+	skipRange    bool
+	skipRangeMin int64
+	skipRangeMax int64
+	startCounter int64
+}
+
+// isGeneratedIdentity returns true if the value of the given field is
+// generated by a sequence or identity column that is created by the migrator.
+func isGeneratedIdentity(field *schema.Field) bool {
+	return field.AutoIncrement && field.HasDefaultValue && field.DefaultValue == "" && field.DefaultValueInterface == nil
+}
+
+// sequenceOptionsOf returns the options of the gorm_sequence_skip_range and
+// gorm_sequence_start_counter tags of the given field.
+func sequenceOptionsOf(field *schema.Field) (sequenceOptions, error) {
+	var options sequenceOptions
+	if skipRange, ok := field.Tag.Lookup(gormSpannerSequenceSkipRangeTag); ok {
+		bounds := strings.Split(skipRange, ",")
+		if len(bounds) != 2 {
+			return options, fmt.Errorf("invalid %s %q, expected <min>,<max>", gormSpannerSequenceSkipRangeTag, skipRange)
+		}
+		var errMin, errMax error
+		options.skipRangeMin, errMin = strconv.ParseInt(strings.TrimSpace(bounds[0]), 10, 64)
+		options.skipRangeMax, errMax = strconv.ParseInt(strings.TrimSpace(bounds[1]), 10, 64)
+		if errMin != nil || errMax != nil || options.skipRangeMin > options.skipRangeMax {
+			return options, fmt.Errorf("invalid %s %q, expected <min>,<max>", gormSpannerSequenceSkipRangeTag, skipRange)
+		}
+		options.skipRange = true
+	}
+	if startCounter, ok := field.Tag.Lookup(gormSpannerSequenceStartCounterTag); ok {
+		counter, err := strconv.ParseInt(strings.TrimSpace(startCounter), 10, 64)
+		if err != nil || counter < 1 {
+			return options, fmt.Errorf("invalid %s %q, expected a positive integer", gormSpannerSequenceStartCounterTag, startCounter)
+		}
+		options.startCounter = counter
+	}
+	return options, nil
+}
+
+// sequenceClause returns the OPTIONS clause of a CREATE SEQUENCE statement.
+func (o sequenceOptions) sequenceClause() string {
+	clause := `OPTIONS (sequence_kind = "bit_reversed_positive"`
+	if o.skipRange {
+		clause += fmt.Sprintf(", skip_range_min = %d, skip_range_max = %d", o.skipRangeMin, o.skipRangeMax)
+	}
+	if o.startCounter > 0 {
+		clause += fmt.Sprintf(", start_with_counter = %d", o.startCounter)
+	}
+	return clause + ")"
+}
+
+// identityClause returns the GENERATED BY DEFAULT AS IDENTITY clause of an
+// identity column.
+func (o sequenceOptions) identityClause() string {
+	clause := "GENERATED BY DEFAULT AS IDENTITY (BIT_REVERSED_POSITIVE"
+	if o.skipRange {
+		clause += fmt.Sprintf(" SKIP RANGE %d, %d", o.skipRangeMin, o.skipRangeMax)
+	}
+	if o.startCounter > 0 {
+		clause += fmt.Sprintf(" START COUNTER WITH %d", o.startCounter)
+	}
+	return clause + ")"
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gorm.io/gorm"
+)
+
+type identitySinger struct {
+	ID   int64 `gorm:"primaryKey" gorm_sequence_skip_range:"1,1000" gorm_sequence_start_counter:"5000"`
+	Name string
+}
+
+type sequenceSinger struct {
+	ID   int64 `gorm:"primaryKey" gorm_sequence_skip_range:"1,1000" gorm_sequence_start_counter:"5000"`
+	Name string
+}
+
+type uuidModeSinger struct {
+	ID   int64 `gorm:"primaryKey"`
+	Name string
+}
+
+type uuidModeAlbum struct {
+	UUIDBaseModel
+	Title string
+}
+
+type invalidSequenceOptions struct {
+	ID   int64 `gorm:"primaryKey" gorm_sequence_skip_range:"1000" gorm_sequence_start_counter:"-1"`
+	Name string
+}
+
+func TestIdentityMode(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		mode  IdentityMode
+		model interface{}
+		want  []string
+	}{
+		{
+			mode:  IdentityModeIdentity,
+			model: &identitySinger{},
+			want: []string{
+				"CREATE TABLE `identity_singers` (" +
+					"`id` INT64 GENERATED BY DEFAULT AS IDENTITY (BIT_REVERSED_POSITIVE SKIP RANGE 1, 1000 START COUNTER WITH 5000)," +
+					"`name` STRING(MAX)) PRIMARY KEY (`id`)",
+			},
+		},
+		{
+			mode:  IdentityModeSequence,
+			model: &sequenceSinger{},
+			want: []string{
+				`CREATE SEQUENCE IF NOT EXISTS sequence_singers_seq OPTIONS (sequence_kind = "bit_reversed_positive", skip_range_min = 1, skip_range_max = 1000, start_with_counter = 5000)`,
+				"CREATE TABLE `sequence_singers` (" +
+					"`id` INT64 DEFAULT (GET_NEXT_SEQUENCE_VALUE(Sequence sequence_singers_seq))," +
+					"`name` STRING(MAX)) PRIMARY KEY (`id`)",
+			},
+		},
+		{
+			mode:  IdentityModeUUID,
+			model: &uuidModeAlbum{},
+			want: []string{
+				"CREATE TABLE `uuid_mode_albums` (`id` STRING(36) DEFAULT (GENERATE_UUID())," +
+					"`created_at` TIMESTAMP,`updated_at` TIMESTAMP,`deleted_at` TIMESTAMP,`title` STRING(MAX)) PRIMARY KEY (`id`)",
+				"CREATE INDEX `idx_uuid_mode_albums_deleted_at` ON `uuid_mode_albums`(`deleted_at`)",
+			},
+		},
+	} {
+		test := test
+		t.Run(test.mode.String(), func(t *testing.T) {
+			t.Parallel()
+
+			db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{IdentityMode: test.mode})
+			defer teardown()
+			anyProto, err := anypb.New(&emptypb.Empty{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+				Name:   "test-operation",
+				Done:   true,
+				Result: &longrunningpb.Operation_Response{Response: anyProto},
+			}})
+			_ = putCountStatementResult(server, "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3", 0)
+
+			if err := db.Migrator().AutoMigrate(test.model); err != nil {
+				t.Fatal(err)
+			}
+			requests := server.TestDatabaseAdmin.Reqs()
+			if g, w := len(requests), 1; g != w {
+				t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+			}
+			if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), test.want; !reflect.DeepEqual(g, w) {
+				t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+			}
+		})
+	}
+}
+
+func TestIdentityModeInvalidModels(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name  string
+		mode  IdentityMode
+		model interface{}
+		want  []string
+	}{
+		{
+			name:  "autoIncrement with IdentityModeUUID",
+			mode:  IdentityModeUUID,
+			model: &uuidModeSinger{},
+			want:  []string{"uuidModeSinger.ID: autoIncrement is not supported with IdentityModeUUID"},
+		},
+		{
+			name:  "invalid sequence options",
+			mode:  IdentityModeIdentity,
+			model: &invalidSequenceOptions{},
+			want:  []string{`invalidSequenceOptions.ID: invalid gorm_sequence_skip_range "1000"`},
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{IdentityMode: test.mode})
+			defer teardown()
+
+			err := db.Migrator().AutoMigrate(test.model)
+			var modelErr *ModelError
+			if !errors.As(err, &modelErr) {
+				t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, modelErr)
+			}
+			for _, want := range test.want {
+				if g := err.Error(); !strings.Contains(g, want) {
+					t.Fatalf("error message mismatch\n Got: %v\nWant: %v", g, want)
+				}
+			}
+			if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+				t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+			}
+		})
+	}
+}
+
+func TestSequenceOptionsOf(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	for _, test := range []struct {
+		model   interface{}
+		want    sequenceOptions
+		wantErr bool
+	}{
+		{model: &uuidModeSinger{}},
+		{model: &identitySinger{}, want: sequenceOptions{skipRange: true, skipRangeMin: 1, skipRangeMax: 1000, startCounter: 5000}},
+		{model: &invalidSequenceOptions{}, wantErr: true},
+	} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(test.model); err != nil {
+			t.Fatal(err)
+		}
+		options, err := sequenceOptionsOf(stmt.Schema.LookUpField("ID"))
+		if g, w := err != nil, test.wantErr; g != w {
+			t.Fatalf("%T: error mismatch\n Got: %v\nWant: %v", test.model, err, w)
+		}
+		if g, w := options, test.want; !test.wantErr && g != w {
+			t.Fatalf("%T: options mismatch\n Got: %+v\nWant: %+v", test.model, g, w)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// registerInsertOrUpdate registers a clause builder for INSERT clauses that
+// translates OnConflict clauses to the GoogleSQL INSERT OR UPDATE and INSERT
+// OR IGNORE statements:
+//   - clause.OnConflict{UpdateAll: true} is translated to INSERT OR UPDATE,
+//     which updates all inserted columns of existing rows.
+//   - clause.OnConflict{DoNothing: true} is translated to INSERT OR IGNORE,
+//     which skips rows that already exist.
+//
+// Spanner only detects conflicts on the primary key. Other OnConflict clauses,
+// such as clauses that only update some of the columns, cannot be expressed
+// in GoogleSQL, and are ignored.
+func registerInsertOrUpdate(db *gorm.DB) {
+	db.ClauseBuilders[clause.Insert{}.Name()] = func(c clause.Clause, builder clause.Builder) {
+		stmt, ok := builder.(*gorm.Statement)
+		insert, isInsert := c.Expression.(clause.Insert)
+		if ok && isInsert && insert.Modifier == "" {
+			if onConflict, ok := stmt.Clauses[clause.OnConflict{}.Name()].Expression.(clause.OnConflict); ok {
+				switch {
+				case onConflict.UpdateAll:
+					insert.Modifier = "OR UPDATE"
+				case onConflict.DoNothing:
+					insert.Modifier = "OR IGNORE"
+				}
+				c.Expression = insert
+			}
+		}
+		c.Build(builder)
+	}
+}
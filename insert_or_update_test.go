@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"testing"
+
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm/clause"
+)
+
+type upsertSinger struct {
+	ID   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name string
+}
+
+func TestOnConflictInsertOrUpdate(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name       string
+		onConflict clause.OnConflict
+		sql        string
+	}{
+		{
+			name:       "UpdateAll",
+			onConflict: clause.OnConflict{UpdateAll: true},
+			sql:        "INSERT OR UPDATE INTO `upsert_singers` (`id`,`name`) VALUES (@p1,@p2)",
+		},
+		{
+			name:       "DoNothing",
+			onConflict: clause.OnConflict{DoNothing: true},
+			sql:        "INSERT OR IGNORE INTO `upsert_singers` (`id`,`name`) VALUES (@p1,@p2)",
+		},
+		{
+			name:       "DoUpdates",
+			onConflict: clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"name"})},
+			sql:        "INSERT INTO `upsert_singers` (`id`,`name`) VALUES (@p1,@p2)",
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, server, teardown := setupTestGormConnection(t)
+			defer teardown()
+
+			_ = server.TestSpanner.PutStatementResult(test.sql, &testutil.StatementResult{
+				Type:        testutil.StatementResultUpdateCount,
+				UpdateCount: 1,
+			})
+			if err := db.Clauses(test.onConflict).Create(&upsertSinger{ID: 1, Name: "One"}).Error; err != nil {
+				t.Fatal(err)
+			}
+			req := getLastSqlRequest(server)
+			if g, w := req.Sql, test.sql; g != w {
+				t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+			}
+		})
+	}
+}
+
+func TestOnConflictInsertOrUpdateMultipleRows(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT OR UPDATE INTO `upsert_singers` (`id`,`name`) VALUES (@p1,@p2),(@p3,@p4)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 2,
+	})
+	singers := []upsertSinger{{1, "One"}, {2, "Two"}}
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&singers).Error; err != nil {
+		t.Fatal(err)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.Sql, insertSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
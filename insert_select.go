@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	selectAliasRegExp      = regexp.MustCompile("(?i)\\s+AS\\s+`?(\\w+)`?\\s*$")
+	selectIdentifierRegExp = regexp.MustCompile("^`?\\w+`?(\\.`?\\w+`?)*$")
+)
+
+// registerInsertSelectCallback registers a callback that generates an
+// INSERT ... SELECT statement when Create is called with a gorm query instead
+// of a model.
+//
+// Example:
+//
+//	// INSERT INTO `singer_archives` (`id`,`name`) SELECT id, name FROM `singers` WHERE active = @p1
+//	err := db.Model(&SingerArchive{}).Create(db.Table("singers").Select("id, name").Where("active = ?", false)).Error
+//
+// The columns of the INSERT statement are taken from the Select of the outer
+// statement if it has one, and otherwise from the column names and aliases in
+// the Select of the query. An error is returned if the columns cannot be
+// determined.
+func registerInsertSelectCallback(db *gorm.DB) error {
+	return db.Callback().Create().
+		After("gorm:begin_transaction").
+		Before("gorm:before_create").
+		Register("gorm:spanner:insert_select", buildInsertSelect)
+}
+
+func buildInsertSelect(db *gorm.DB) {
+	query, ok := db.Statement.Dest.(*gorm.DB)
+	if !ok || db.Error != nil || db.Statement.SQL.Len() > 0 {
+		return
+	}
+	stmt := db.Statement
+	if stmt.Table == "" {
+		_ = db.AddError(fmt.Errorf("INSERT ... SELECT requires a model or a table, use Model or Table to set the table to insert into"))
+		return
+	}
+	columns := splitSelects(stmt.Selects)
+	if len(columns) == 0 {
+		columns = splitSelects(query.Statement.Selects)
+		for i, expr := range columns {
+			name, ok := selectColumnName(expr)
+			if !ok {
+				_ = db.AddError(fmt.Errorf("cannot determine the column name of %q for INSERT ... SELECT, use Select to set the columns to insert", expr))
+				return
+			}
+			columns[i] = name
+		}
+	}
+	if len(columns) == 0 {
+		_ = db.AddError(fmt.Errorf("cannot determine the columns for INSERT ... SELECT, use Select to set the columns to insert"))
+		return
+	}
+
+	stmt.WriteString("INSERT INTO ")
+	stmt.WriteQuoted(clause.Table{Name: stmt.Table})
+	stmt.WriteString(" (")
+	for i, column := range columns {
+		if i > 0 {
+			stmt.WriteByte(',')
+		}
+		if stmt.Schema != nil {
+			if field := stmt.Schema.LookUpField(column); field != nil {
+				column = field.DBName
+			}
+		}
+		stmt.WriteQuoted(clause.Column{Name: column})
+	}
+	stmt.WriteString(") ")
+	stmt.AddVar(stmt, query)
+	// Clear the schema, so gorm does not try to use the query as a model, for
+	// example for hooks, associations and returning the generated values.
+	stmt.Schema = nil
+}
+
+// splitSelects splits the given select expressions at top-level commas.
+func splitSelects(selects []string) []string {
+	var result []string
+	for _, s := range selects {
+		depth, start := 0, 0
+		for i, c := range s {
+			switch c {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			case ',':
+				if depth == 0 {
+					result = append(result, strings.TrimSpace(s[start:i]))
+					start = i + 1
+				}
+			}
+		}
+		if part := strings.TrimSpace(s[start:]); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// selectColumnName returns the name of the column of a select expression. This
+// is either the alias of the expression, or the name of the column if the
+// expression is a (qualified) column reference.
+func selectColumnName(expr string) (string, bool) {
+	if match := selectAliasRegExp.FindStringSubmatch(expr); match != nil {
+		return match[1], true
+	}
+	if !selectIdentifierRegExp.MatchString(expr) {
+		return "", false
+	}
+	name := expr[strings.LastIndex(expr, ".")+1:]
+	return strings.Trim(name, "`"), true
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"testing"
+
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+type singerArchive struct {
+	ID       int64
+	FullName string
+}
+
+func TestInsertSelect(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT INTO `singer_archives` (`id`,`full_name`) SELECT id, CONCAT(first_name, ' ', last_name) AS full_name FROM `singers` WHERE active = @p1"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 5,
+	})
+	query := db.Table("singers").Select("id, CONCAT(first_name, ' ', last_name) AS full_name").Where("active = ?", false)
+	res := db.Model(&singerArchive{}).Create(query)
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if g, w := res.RowsAffected, int64(5); g != w {
+		t.Fatalf("rows affected mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.Sql, insertSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p1"].GetBoolValue(), false; g != w {
+		t.Fatalf("param mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The columns can be set with Select on the outer statement.
+	dryRun := db.Session(&gorm.Session{DryRun: true})
+	stmt := dryRun.Model(&singerArchive{}).Select("ID", "FullName").
+		Create(db.Table("singers").Select("?, ?", gorm.Expr("id"), gorm.Expr("last_name"))).Statement
+	if g, w := stmt.SQL.String(), "INSERT INTO `singer_archives` (`id`,`full_name`) SELECT id, last_name FROM `singers`"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	stmt = dryRun.Table("singer_archives").Create(db.Table("singers").Select("`singers`.`id`, name")).Statement
+	if g, w := stmt.SQL.String(), "INSERT INTO `singer_archives` (`id`,`name`) SELECT `singers`.`id`, name FROM `singers`"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The columns cannot be determined for expressions without an alias.
+	if err := dryRun.Model(&singerArchive{}).Create(db.Table("singers").Select("id, UPPER(name)")).Error; err == nil {
+		t.Fatal("missing expected error for expression without alias")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// spannerGormTag is the name of the struct tag for Spanner-specific
+	// settings of a model.
+	spannerGormTag = "spannerGorm"
+
+	interleaveInTagSetting = "INTERLEAVE_IN"
+	onDeleteTagSetting     = "ON_DELETE"
+)
+
+// interleave contains the settings of an interleaved table. A table is
+// interleaved in a parent table by adding a `spannerGorm` tag with the
+// setting `interleave_in` to one of the fields of the model, typically the
+// field that references the parent. The optional setting `on_delete` can be
+// `cascade` or `no action`. Example:
+//
+//	// Track is interleaved in Album. The primary key of Track must start with
+//	// the primary key of Album.
+//	type Track struct {
+//	  AlbumID     int64 `gorm:"primaryKey;autoIncrement:false"`
+//	  TrackNumber int64 `gorm:"primaryKey;autoIncrement:false"`
+//	  Title       string
+//	  Album       Album `spannerGorm:"interleave_in:albums,on_delete:cascade"`
+//	}
+//
+// AutoMigrate then creates the table with the clause
+// `INTERLEAVE IN PARENT albums ON DELETE CASCADE`.
+type interleave struct {
+	parent   string
+	onDelete string
+}
+
+// interleaveOf returns the interleave settings of the given schema, or nil if
+// the table is not interleaved. A *ModelError is returned if the settings are
+// invalid.
+func interleaveOf(s *schema.Schema) (*interleave, error) {
+	if s == nil {
+		return nil, nil
+	}
+	var result *interleave
+	for _, field := range s.Fields {
+		settings, ok := spannerGormSettings(field)
+		if !ok {
+			continue
+		}
+		parent, ok := settings[interleaveInTagSetting]
+		if !ok {
+			continue
+		}
+		if result != nil {
+			return nil, &ModelError{
+				Model:      s.Name,
+				Field:      field.Name,
+				Problem:    "the model has more than one interleave_in setting",
+				Suggestion: "Remove all but one of the interleave_in settings",
+			}
+		}
+		parent = strings.TrimSpace(parent)
+		if parent == "" || parent == interleaveInTagSetting {
+			return nil, &ModelError{
+				Model:      s.Name,
+				Field:      field.Name,
+				Problem:    "interleave_in does not specify a parent table",
+				Suggestion: "Add the name of the parent table, e.g. `spannerGorm:\"interleave_in:albums\"`",
+			}
+		}
+		result = &interleave{parent: parent}
+		if onDelete, ok := settings[onDeleteTagSetting]; ok {
+			switch strings.Join(strings.Fields(strings.ToUpper(onDelete)), " ") {
+			case "CASCADE":
+				result.onDelete = "CASCADE"
+			case "NO ACTION", "NO_ACTION":
+				result.onDelete = "NO ACTION"
+			default:
+				return nil, &ModelError{
+					Model:      s.Name,
+					Field:      field.Name,
+					Problem:    fmt.Sprintf("on_delete action %q is not supported for interleaved tables", onDelete),
+					Suggestion: "Use 'cascade' or 'no action'",
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// clause returns the INTERLEAVE IN PARENT clause for a CREATE TABLE statement.
+func (i *interleave) clause() (string, []interface{}) {
+	sql := " INTERLEAVE IN PARENT ?"
+	if i.onDelete != "" {
+		sql += " ON DELETE " + i.onDelete
+	}
+	return sql, []interface{}{clause.Table{Name: i.parent}}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type playlist struct {
+	ID   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name string
+}
+
+type playlistEntry struct {
+	PlaylistID int64 `gorm:"primaryKey;autoIncrement:false"`
+	Position   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Title      string
+	Playlist   playlist `spannerGorm:"interleave_in:playlists,on_delete:cascade"`
+}
+
+type playlistComment struct {
+	PlaylistID int64 `gorm:"primaryKey;autoIncrement:false" spannerGorm:"interleave_in:playlists"`
+	ID         int64 `gorm:"primaryKey;autoIncrement:false"`
+	Comment    string
+}
+
+type invalidInterleave struct {
+	PlaylistID int64 `gorm:"primaryKey;autoIncrement:false" spannerGorm:"interleave_in:playlists,on_delete:set null"`
+}
+
+func TestMigrateInterleavedTable(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 0)
+
+	if err := db.Migrator().AutoMigrate(&playlistEntry{}, &playlistComment{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE TABLE `playlists` (`id` INT64,`name` STRING(MAX)) PRIMARY KEY (`id`)",
+		"CREATE TABLE `playlist_entries` (`playlist_id` INT64,`position` INT64,`title` STRING(MAX)," +
+			"CONSTRAINT `fk_playlist_entries_playlist` FOREIGN KEY (`playlist_id`) REFERENCES `playlists`(`id`)) " +
+			"PRIMARY KEY (`playlist_id`,`position`) INTERLEAVE IN PARENT `playlists` ON DELETE CASCADE",
+		"CREATE TABLE `playlist_comments` (`playlist_id` INT64,`id` INT64,`comment` STRING(MAX)) " +
+			"PRIMARY KEY (`playlist_id`,`id`) INTERLEAVE IN PARENT `playlists`",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigrateInvalidInterleave(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	err := db.Migrator().AutoMigrate(&invalidInterleave{})
+	var modelErr *ModelError
+	if !errors.As(err, &modelErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, modelErr)
+	}
+	if g, w := err.Error(), `invalidInterleave.PlaylistID: on_delete action "set null" is not supported`; !strings.Contains(g, w) {
+		t.Fatalf("error message mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql/driver"
+
+	"cloud.google.com/go/spanner"
+)
+
+// JSONNull represents the JSON value null in a JSON column, as opposed to a
+// SQL NULL value. Rows of a DML statement with a THEN RETURN clause that are
+// scanned into a map contain JSONNull for JSON columns that contain the JSON
+// value null, and nil for JSON columns that are NULL. Rows of other queries
+// that are scanned into a map contain the spanner.NullJSON values of the
+// driver. JSONNull can also be used as a value in a map that is passed to
+// Create or Updates to write the JSON value null to a column.
+//
+// Fields of type spanner.NullJSON distinguish the two values with the Valid
+// field: a SQL NULL value has Valid=false, and the JSON value null has
+// Valid=true and Value=nil. Note that spanner.NullJSON encodes both values as
+// null when it is marshaled to JSON, and that it unmarshals null as a SQL
+// NULL value.
+type JSONNull struct{}
+
+// Value implements the driver.Valuer interface.
+func (JSONNull) Value() (driver.Value, error) {
+	return spanner.NullJSON{Valid: true}, nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (JSONNull) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// NewJSONNull returns a spanner.NullJSON that contains the JSON value null.
+func NewJSONNull() spanner.NullJSON {
+	return spanner.NullJSON{Valid: true}
+}
+
+// IsJSONNull returns true if the given value contains the JSON value null,
+// and false if it is a SQL NULL value or any other JSON value.
+func IsJSONNull(value spanner.NullJSON) bool {
+	return value.Valid && value.Value == nil
+}
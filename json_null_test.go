@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type jsonRecord struct {
+	ID      int64 `gorm:"primaryKey;autoIncrement:false"`
+	Details spanner.NullJSON
+}
+
+func TestJSONNullRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	// Maps are inserted with the columns in alphabetical order.
+	for _, insertSql := range []string{
+		"INSERT INTO `json_records` (`id`,`details`) VALUES (@p1,@p2)",
+		"INSERT INTO `json_records` (`details`,`id`) VALUES (@p1,@p2)",
+	} {
+		_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+			Type:        testutil.StatementResultUpdateCount,
+			UpdateCount: 1,
+		})
+	}
+	for _, test := range []struct {
+		name  string
+		value interface{}
+		param string
+		want  *structpb.Value
+	}{
+		{"json null", &jsonRecord{ID: 1, Details: NewJSONNull()}, "p2", structpb.NewStringValue("null")},
+		{"sql null", &jsonRecord{ID: 1}, "p2", structpb.NewNullValue()},
+		{"map json null", map[string]interface{}{"id": 1, "details": JSONNull{}}, "p1", structpb.NewStringValue("null")},
+		{"map sql null", map[string]interface{}{"id": 1, "details": nil}, "p1", structpb.NewNullValue()},
+	} {
+		if err := db.Model(&jsonRecord{}).Create(test.value).Error; err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if g, w := getLastSqlRequest(server).Params.Fields[test.param], test.want; !reflect.DeepEqual(g.AsInterface(), w.AsInterface()) {
+			t.Fatalf("%s: param mismatch\n Got: %v\nWant: %v", test.name, g, w)
+		}
+	}
+
+	querySql := "SELECT * FROM `json_records`"
+	_ = server.TestSpanner.PutStatementResult(querySql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+				{Name: "id", Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}},
+				{Name: "details", Type: &spannerpb.Type{Code: spannerpb.TypeCode_JSON}},
+			}}},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{structpb.NewStringValue("1"), structpb.NewStringValue("null")}},
+				{Values: []*structpb.Value{structpb.NewStringValue("2"), structpb.NewNullValue()}},
+			},
+		},
+	})
+	var records []jsonRecord
+	if err := db.Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(records), 2; g != w {
+		t.Fatalf("record count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if !IsJSONNull(records[0].Details) {
+		t.Fatalf("details of first record is not JSON null: %v", records[0].Details)
+	}
+	if records[1].Details.Valid || IsJSONNull(records[1].Details) {
+		t.Fatalf("details of second record is not SQL NULL: %v", records[1].Details)
+	}
+
+	var results []map[string]interface{}
+	if err := db.Model(&jsonRecord{}).Find(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+	// The values of a query that is not a DML statement with THEN RETURN are
+	// not converted.
+	if g, ok := results[0]["details"].(spanner.NullJSON); !ok || !IsJSONNull(g) {
+		t.Fatalf("first result mismatch\n Got: %v\nWant: %v", results[0]["details"], NewJSONNull())
+	}
+	if g, ok := results[1]["details"].(spanner.NullJSON); !ok || g.Valid {
+		t.Fatalf("second result mismatch\n Got: %v\nWant: %v", results[1]["details"], spanner.NullJSON{})
+	}
+}
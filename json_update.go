@@ -0,0 +1,169 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxUpdateJSONAttempts is the maximum number of times that UpdateJSON
+// executes its transaction if the transaction is aborted because the JSON
+// document was modified concurrently.
+const maxUpdateJSONAttempts = 10
+
+// JSONUpdate is an expression that modifies parts of a JSON document in a
+// column with the Spanner functions JSON_SET and JSON_REMOVE, without
+// rewriting the whole document in the application. Use it as the value for
+// Update or Updates. Operations are applied in the order in which they are
+// added.
+//
+// Example:
+//
+//	db.Model(&venue).Update("details", spannergorm.JSONSet("details", "$.capacity", 500).Remove("$.closed"))
+//	// UPDATE `venues` SET `details`=JSON_REMOVE(JSON_SET(`details`, '$.capacity', @p1), '$.closed') WHERE `id` = @p2
+type JSONUpdate struct {
+	Column     clause.Column
+	operations []jsonOperation
+}
+
+type jsonOperation struct {
+	function string
+	paths    []string
+	// values contains the value for each path for JSON_SET operations.
+	values []interface{}
+}
+
+// JSONSet returns an expression that sets the value at the given JSON path in
+// the given column. The value is converted to JSON.
+func JSONSet(column, path string, value interface{}) JSONUpdate {
+	return JSONUpdate{Column: clause.Column{Name: column}}.Set(path, value)
+}
+
+// JSONRemove returns an expression that removes the values at the given JSON
+// paths from the given column.
+func JSONRemove(column string, paths ...string) JSONUpdate {
+	return JSONUpdate{Column: clause.Column{Name: column}}.Remove(paths...)
+}
+
+// Set returns a copy of the expression that also sets the value at the given
+// JSON path.
+func (u JSONUpdate) Set(path string, value interface{}) JSONUpdate {
+	operations := append([]jsonOperation{}, u.operations...)
+	last := len(operations) - 1
+	if last >= 0 && operations[last].function == "JSON_SET" {
+		operations[last].paths = append(append([]string{}, operations[last].paths...), path)
+		operations[last].values = append(append([]interface{}{}, operations[last].values...), jsonValue(value))
+	} else {
+		operations = append(operations, jsonOperation{function: "JSON_SET", paths: []string{path}, values: []interface{}{jsonValue(value)}})
+	}
+	u.operations = operations
+	return u
+}
+
+// Remove returns a copy of the expression that also removes the values at the
+// given JSON paths.
+func (u JSONUpdate) Remove(paths ...string) JSONUpdate {
+	u.operations = append(append([]jsonOperation{}, u.operations...), jsonOperation{function: "JSON_REMOVE", paths: paths})
+	return u
+}
+
+func (u JSONUpdate) Build(builder clause.Builder) {
+	for i := len(u.operations) - 1; i >= 0; i-- {
+		builder.WriteString(u.operations[i].function)
+		builder.WriteByte('(')
+	}
+	builder.WriteQuoted(u.Column)
+	for _, operation := range u.operations {
+		for i, path := range operation.paths {
+			// JSON paths must be string literals.
+			builder.WriteString(", ")
+			builder.WriteString(jsonPathLiteral(path))
+			if operation.values != nil {
+				builder.WriteString(", ")
+				builder.AddVar(builder, operation.values[i])
+			}
+		}
+		builder.WriteByte(')')
+	}
+}
+
+// jsonValue returns the value that is used as a query parameter for a value in
+// a JSON document.
+func jsonValue(value interface{}) interface{} {
+	if v, ok := value.(spanner.NullJSON); ok {
+		return v
+	}
+	return spanner.NullJSON{Value: value, Valid: true}
+}
+
+// jsonPathLiteral returns the given JSON path as a string literal.
+func jsonPathLiteral(path string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(path) + "'"
+}
+
+// UpdateJSON reads the JSON document in the given field of the model, calls f
+// with the document, and writes the document that is returned by f to the
+// field. The read and the write are executed in one read/write transaction,
+// which is retried if the document is modified by another transaction
+// between the read and the write. Use this for modifications that cannot be
+// expressed with JSONUpdate, or for databases that do not support JSON_SET.
+//
+// The model must have its primary key set, and the field must be of type
+// spanner.NullJSON. The field of the model is set to the document that was
+// written when UpdateJSON returns without an error.
+//
+// Example:
+//
+//	venue := &Venue{ID: 1}
+//	err := spannergorm.UpdateJSON(db, venue, "Details", func(details spanner.NullJSON) (spanner.NullJSON, error) {
+//	  m, _ := details.Value.(map[string]interface{})
+//	  m["visits"] = m["visits"].(float64) + 1
+//	  return spanner.NullJSON{Value: m, Valid: true}, nil
+//	})
+func UpdateJSON(db *gorm.DB, model interface{}, field string, f func(value spanner.NullJSON) (spanner.NullJSON, error)) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	schemaField := stmt.Schema.LookUpField(field)
+	if schemaField == nil {
+		return fmt.Errorf("field %s not found in %s", field, stmt.Schema.Name)
+	}
+	if schemaField.FieldType != reflect.TypeOf(spanner.NullJSON{}) {
+		return fmt.Errorf("field %s must be of type spanner.NullJSON, got %v", field, schemaField.FieldType)
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return RunTransactionWithOptions(ctx, db, func(tx *gorm.DB) error {
+		if err := tx.Select(schemaField.DBName).Take(model).Error; err != nil {
+			return err
+		}
+		value, _ := schemaField.ValueOf(tx.Statement.Context, reflect.ValueOf(model))
+		updated, err := f(value.(spanner.NullJSON))
+		if err != nil {
+			return err
+		}
+		return tx.Model(model).Update(schemaField.DBName, updated).Error
+	}, TransactionOptions{MaxAttempts: maxUpdateJSONAttempts})
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestJSONUpdate(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	updateSql := "UPDATE `json_records` SET `details`=JSON_REMOVE(JSON_SET(`details`, '$.capacity', @p1, '$.name', @p2), '$.closed', '$.o\\'neil') WHERE `id` = @p3"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	update := JSONSet("details", "$.capacity", 500).Set("$.name", "Hall").Remove("$.closed", "$.o'neil")
+	if err := db.Model(&jsonRecord{ID: 1}).Update("details", update).Error; err != nil {
+		t.Fatal(err)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.Sql, updateSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.ParamTypes["p1"].GetCode(), spannerpb.TypeCode_JSON; g != w {
+		t.Fatalf("param type mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p2"].GetStringValue(), `"Hall"`; g != w {
+		t.Fatalf("param value mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestUpdateJSON(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	querySql := "SELECT `details` FROM `json_records` WHERE `json_records`.`id` = @p1 LIMIT @p2"
+	_ = server.TestSpanner.PutStatementResult(querySql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+				{Name: "details", Type: &spannerpb.Type{Code: spannerpb.TypeCode_JSON}},
+			}}},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{structpb.NewStringValue(`{"visits":1}`)}},
+			},
+		},
+	})
+	updateSql := "UPDATE `json_records` SET `details`=@p1 WHERE `id` = @p2"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	record := &jsonRecord{ID: 1}
+	if err := UpdateJSON(db, record, "Details", func(details spanner.NullJSON) (spanner.NullJSON, error) {
+		m := details.Value.(map[string]interface{})
+		m["visits"] = m["visits"].(float64) + 1
+		return spanner.NullJSON{Value: m, Valid: true}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	executeReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	req := executeReqs[len(executeReqs)-1].(*spannerpb.ExecuteSqlRequest)
+	if g, w := req.Sql, updateSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if req.GetTransaction().GetSingleUse() != nil {
+		t.Fatalf("update was not executed in a read/write transaction")
+	}
+	if g, w := req.Params.Fields["p1"].GetStringValue(), `{"visits":2}`; g != w {
+		t.Fatalf("param value mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := record.Details.Value, map[string]interface{}{"visits": float64(2)}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("details mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	if err := UpdateJSON(db, record, "ID", nil); err == nil {
+		t.Fatal("missing expected error for field that is not a spanner.NullJSON")
+	}
+}
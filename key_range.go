@@ -0,0 +1,153 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"math"
+
+	"cloud.google.com/go/spanner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// KeyRange returns a scope that limits a statement to the rows whose primary
+// key is in the range from start to end. The range has the same semantics as
+// spanner.KeyRange: the keys may be prefixes of the primary key of the model,
+// and kind determines whether the start and end keys are included in the
+// range. An empty start or end key means that the range has no lower or upper
+// bound.
+//
+// The range is translated to comparisons of the primary key columns, so
+// Spanner can read the range directly instead of scanning the table.
+//
+// Example:
+//
+//	db.Scopes(spannergorm.KeyRange(spanner.Key{1}, spanner.Key{1, 100}, spanner.ClosedOpen)).Find(&entries)
+//	// SELECT * FROM `playlist_entries` WHERE `playlist_entries`.`playlist_id` >= @p1 AND `playlist_entries`.`playlist_id` <= @p2
+//	//   AND (`playlist_entries`.`playlist_id` < @p3 OR (`playlist_entries`.`position` < @p4))
+func KeyRange(start, end spanner.Key, kind spanner.KeyRangeKind) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(keyRangeExpression{start: start, end: end, kind: kind})
+	}
+}
+
+// BitReversedKeyRanges splits the values of a bit-reversed positive sequence
+// into the given number of key ranges of equal size. Use the ranges with
+// KeyRange to process a table with a primary key that is generated by a
+// bit-reversed sequence in parallel shards.
+//
+// A bit-reversed sequence distributes its values evenly over all positive
+// INT64 values, and the order of the primary key values is unrelated to the
+// order in which the rows were inserted. Splitting the range between the
+// lowest and the highest value in the table would therefore not give shards
+// of equal size, while splitting all positive values does.
+//
+// Example:
+//
+//	for _, r := range spannergorm.BitReversedKeyRanges(8) {
+//	  go db.Scopes(spannergorm.KeyRange(r.Start, r.End, r.Kind)).FindInBatches(&singers, 1000, process)
+//	}
+func BitReversedKeyRanges(shards int) []spanner.KeyRange {
+	if shards < 1 {
+		shards = 1
+	}
+	size := math.MaxInt64 / int64(shards)
+	ranges := make([]spanner.KeyRange, shards)
+	for i := range ranges {
+		start := int64(i) * size
+		if i == shards-1 {
+			ranges[i] = spanner.KeyRange{Start: spanner.Key{start}, End: spanner.Key{int64(math.MaxInt64)}, Kind: spanner.ClosedClosed}
+		} else {
+			ranges[i] = spanner.KeyRange{Start: spanner.Key{start}, End: spanner.Key{start + size}, Kind: spanner.ClosedOpen}
+		}
+	}
+	return ranges
+}
+
+type keyRangeExpression struct {
+	start spanner.Key
+	end   spanner.Key
+	kind  spanner.KeyRangeKind
+}
+
+// Build implements clause.Expression. The primary key columns are resolved
+// when the statement is built, as the model is not known when the scope is
+// added to the statement.
+func (r keyRangeExpression) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok || stmt.Schema == nil {
+		_ = builder.AddError(fmt.Errorf("KeyRange requires a model"))
+		return
+	}
+	columns := make([]clause.Column, len(stmt.Schema.PrimaryFields))
+	for i, field := range stmt.Schema.PrimaryFields {
+		columns[i] = clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+	}
+	if len(r.start) > len(columns) || len(r.end) > len(columns) {
+		_ = builder.AddError(fmt.Errorf("key range %v-%v has more parts than the primary key of table %s", r.start, r.end, stmt.Table))
+		return
+	}
+	startOpen := r.kind == spanner.OpenOpen || r.kind == spanner.OpenClosed
+	endOpen := r.kind == spanner.ClosedOpen || r.kind == spanner.OpenOpen
+	switch {
+	case len(r.start) > 0 && len(r.end) > 0:
+		writeKeyComparison(builder, columns, r.start, true, startOpen)
+		builder.WriteString(" AND ")
+		writeKeyComparison(builder, columns, r.end, false, endOpen)
+	case len(r.start) > 0:
+		writeKeyComparison(builder, columns, r.start, true, startOpen)
+	case len(r.end) > 0:
+		writeKeyComparison(builder, columns, r.end, false, endOpen)
+	default:
+		builder.WriteString("TRUE")
+	}
+}
+
+// writeKeyComparison writes a comparison of the primary key columns with the
+// given key. Spanner does not support comparing rows of values, so a key
+// (a, b) >= (1, 2) is written as a >= 1 AND (a > 1 OR b >= 2). The leading
+// comparison of the first column lets Spanner seek directly to the start or
+// end of the range.
+func writeKeyComparison(builder clause.Builder, columns []clause.Column, key spanner.Key, lower, strict bool) {
+	inclusiveOp, exclusiveOp := " >= ", " > "
+	if !lower {
+		inclusiveOp, exclusiveOp = " <= ", " < "
+	}
+	for i, value := range key {
+		if i > 0 {
+			builder.WriteString(" OR (")
+		}
+		builder.WriteQuoted(columns[i])
+		if i == len(key)-1 {
+			if strict {
+				builder.WriteString(exclusiveOp)
+			} else {
+				builder.WriteString(inclusiveOp)
+			}
+			builder.AddVar(builder, value)
+			break
+		}
+		builder.WriteString(inclusiveOp)
+		builder.AddVar(builder, value)
+		builder.WriteString(" AND (")
+		builder.WriteQuoted(columns[i])
+		builder.WriteString(exclusiveOp)
+		builder.AddVar(builder, value)
+	}
+	for i := 1; i < len(key); i++ {
+		builder.WriteString("))")
+	}
+}
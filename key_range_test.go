@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"math"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"gorm.io/gorm"
+)
+
+func TestKeyRange(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	for _, test := range []struct {
+		start, end spanner.Key
+		kind       spanner.KeyRangeKind
+		want       string
+		vars       int
+	}{
+		{
+			start: spanner.Key{1},
+			end:   spanner.Key{2},
+			kind:  spanner.ClosedOpen,
+			want:  "SELECT * FROM `playlist_entries` WHERE `playlist_entries`.`playlist_id` >= ? AND `playlist_entries`.`playlist_id` < ?",
+			vars:  2,
+		},
+		{
+			start: spanner.Key{1, 10},
+			end:   spanner.Key{1, 20},
+			kind:  spanner.OpenClosed,
+			want: "SELECT * FROM `playlist_entries` WHERE " +
+				"`playlist_entries`.`playlist_id` >= ? AND (`playlist_entries`.`playlist_id` > ? OR (`playlist_entries`.`position` > ?)) AND " +
+				"`playlist_entries`.`playlist_id` <= ? AND (`playlist_entries`.`playlist_id` < ? OR (`playlist_entries`.`position` <= ?))",
+			vars: 6,
+		},
+		{
+			start: spanner.Key{},
+			end:   spanner.Key{5},
+			kind:  spanner.ClosedClosed,
+			want:  "SELECT * FROM `playlist_entries` WHERE `playlist_entries`.`playlist_id` <= ?",
+			vars:  1,
+		},
+	} {
+		var entries []playlistEntry
+		stmt := db.Session(&gorm.Session{DryRun: true}).
+			Scopes(KeyRange(test.start, test.end, test.kind)).
+			Find(&entries).Statement
+		if stmt.Error != nil {
+			t.Fatalf("%v-%v: failed to build statement: %v", test.start, test.end, stmt.Error)
+		}
+		if g, w := stmt.SQL.String(), test.want; g != w {
+			t.Errorf("%v-%v: sql mismatch\n Got: %v\nWant: %v", test.start, test.end, g, w)
+		}
+		if g, w := len(stmt.Vars), test.vars; g != w {
+			t.Errorf("%v-%v: var count mismatch\n Got: %v\nWant: %v", test.start, test.end, g, w)
+		}
+	}
+
+	// Keys with more parts than the primary key are not valid.
+	var entries []playlistEntry
+	err := db.Session(&gorm.Session{DryRun: true}).
+		Scopes(KeyRange(spanner.Key{1, 2, 3}, spanner.Key{}, spanner.ClosedClosed)).
+		Find(&entries).Error
+	if err == nil {
+		t.Fatal("missing expected error")
+	}
+}
+
+func TestBitReversedKeyRanges(t *testing.T) {
+	t.Parallel()
+
+	ranges := BitReversedKeyRanges(3)
+	if g, w := len(ranges), 3; g != w {
+		t.Fatalf("range count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := ranges[0].Start[0], int64(0); g != w {
+		t.Fatalf("start mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i := 1; i < len(ranges); i++ {
+		if g, w := ranges[i].Start[0], ranges[i-1].End[0]; g != w {
+			t.Fatalf("range %d does not start at the end of the previous range\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+	last := ranges[len(ranges)-1]
+	if g, w := last.End[0], int64(math.MaxInt64); g != w {
+		t.Fatalf("end mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := last.Kind, spanner.ClosedClosed; g != w {
+		t.Fatalf("kind mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
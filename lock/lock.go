@@ -0,0 +1,282 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lock contains a distributed lock that is stored in a Spanner table.
+// It can be used for leader election, for example to make sure that only one
+// instance of a service runs a background job at a time.
+//
+// A lock is held by one owner for a lease duration. The owner must renew the
+// lease before it expires, and releases the lock when it is done. Another
+// owner can acquire the lock when it has been released, or when the lease has
+// expired. Expiry is determined with the clock of Spanner, so the clocks of
+// the owners do not need to be synchronized. The time at which a lock was
+// acquired and renewed is recorded with commit timestamps.
+//
+// All locks are stored in the table DefaultTable. The table is created or
+// updated by CreateTable or by AutoMigrate with the Lock model.
+//
+// Example:
+//
+//	l := lock.New(db, "nightly-report")
+//	if err := l.CreateTable(); err != nil {
+//	  return err
+//	}
+//	err := l.Hold(ctx, func(ctx context.Context) error {
+//	  // Only one instance runs the report at a time. ctx is cancelled if
+//	  // the lock is lost.
+//	  return runReport(ctx)
+//	})
+//	if errors.Is(err, lock.ErrLockHeld) {
+//	  // Another instance is running the report.
+//	}
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultTable is the name of the table that contains all locks.
+	DefaultTable = "gorm_locks"
+	// DefaultLeaseDuration is the duration of the lease of a lock if no other
+	// duration is set.
+	DefaultLeaseDuration = 30 * time.Second
+)
+
+var (
+	// ErrLockHeld is returned by Acquire and Hold if the lock is held by
+	// another owner.
+	ErrLockHeld = errors.New("lock: the lock is held by another owner")
+	// ErrLockLost is returned by Renew and Release if the lease of the lock
+	// has expired, and the lock has been released or acquired by another
+	// owner.
+	ErrLockLost = errors.New("lock: the lock is no longer held by the owner")
+)
+
+// Lock is a lock in the table of the locks. It is also the model of the
+// table, which can be passed to AutoMigrate.
+type Lock struct {
+	Name string `gorm:"primaryKey"`
+	// Owner identifies the owner that holds the lock.
+	Owner string `gorm:"not null"`
+	// ExpiresAt is the time at which the lease of the lock expires.
+	ExpiresAt time.Time `gorm:"not null"`
+	// AcquiredAt is the commit timestamp of the last time that the lock was
+	// acquired.
+	AcquiredAt time.Time `spannerGorm:"commit_timestamp"`
+	// RenewedAt is the commit timestamp of the last time that the lease of the
+	// lock was acquired or renewed.
+	RenewedAt time.Time `spannerGorm:"commit_timestamp"`
+}
+
+// TableName implements schema.Tabler.
+func (Lock) TableName() string {
+	return DefaultTable
+}
+
+// Options are the options of a lock.
+type Options struct {
+	// Owner identifies the owner of the lock. The default is a random string,
+	// which is unique for each call to New and NewWithOptions.
+	Owner string
+	// LeaseDuration is the duration of the lease of the lock. The lock can be
+	// acquired by another owner if the lease is not renewed before it expires.
+	// The default is DefaultLeaseDuration.
+	LeaseDuration time.Duration
+}
+
+// Locker acquires, renews and releases a named lock for one owner.
+type Locker struct {
+	db      *gorm.DB
+	name    string
+	options Options
+}
+
+// New returns a Locker for the lock with the given name with the default
+// options.
+func New(db *gorm.DB, name string) *Locker {
+	return NewWithOptions(db, name, Options{})
+}
+
+// NewWithOptions returns a Locker for the lock with the given name with the
+// given options.
+func NewWithOptions(db *gorm.DB, name string, options Options) *Locker {
+	if options.Owner == "" {
+		options.Owner = randomOwner()
+	}
+	if options.LeaseDuration <= 0 {
+		options.LeaseDuration = DefaultLeaseDuration
+	}
+	return &Locker{db: db, name: name, options: options}
+}
+
+// Owner returns the owner of the Locker.
+func (l *Locker) Owner() string {
+	return l.options.Owner
+}
+
+// CreateTable creates or updates the table of the locks with AutoMigrate.
+func (l *Locker) CreateTable() error {
+	return l.session(context.Background()).AutoMigrate(&Lock{})
+}
+
+// Acquire acquires the lock for the owner of the Locker. It returns
+// ErrLockHeld if the lock is held by another owner and its lease has not
+// expired. Acquire extends the lease if the lock is already held by the
+// owner. The lease must be renewed with Renew before it expires.
+func (l *Locker) Acquire(ctx context.Context) error {
+	res := l.session(ctx).Exec(fmt.Sprintf(
+		"UPDATE `%s` SET `owner` = ?, "+
+			"`expires_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ? MILLISECOND), "+
+			"`acquired_at` = PENDING_COMMIT_TIMESTAMP(), `renewed_at` = PENDING_COMMIT_TIMESTAMP() "+
+			"WHERE `name` = ? AND (`owner` = ? OR `expires_at` <= CURRENT_TIMESTAMP())", DefaultTable),
+		l.options.Owner, l.options.LeaseDuration.Milliseconds(), l.name, l.options.Owner)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	// The lock does not exist, or is held by another owner. The insert fails
+	// if the lock exists, also if another owner inserted it concurrently.
+	err := l.session(ctx).Exec(fmt.Sprintf(
+		"INSERT INTO `%s` (`name`, `owner`, `expires_at`, `acquired_at`, `renewed_at`) "+
+			"VALUES (?, ?, TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ? MILLISECOND), "+
+			"PENDING_COMMIT_TIMESTAMP(), PENDING_COMMIT_TIMESTAMP())", DefaultTable),
+		l.name, l.options.Owner, l.options.LeaseDuration.Milliseconds()).Error
+	if errors.Is(spannergorm.TranslateError(err), spannergorm.ErrUniqueKeyViolation) {
+		return ErrLockHeld
+	}
+	return err
+}
+
+// Renew extends the lease of the lock by the lease duration from now. It
+// returns ErrLockLost if the lock is no longer held by the owner.
+func (l *Locker) Renew(ctx context.Context) error {
+	return l.execAsOwner(ctx, fmt.Sprintf(
+		"UPDATE `%s` SET `expires_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ? MILLISECOND), "+
+			"`renewed_at` = PENDING_COMMIT_TIMESTAMP() "+
+			"WHERE `name` = ? AND `owner` = ? AND `expires_at` > CURRENT_TIMESTAMP()", DefaultTable),
+		l.options.LeaseDuration.Milliseconds(), l.name, l.options.Owner)
+}
+
+// Release releases the lock, so it can be acquired by another owner. It
+// returns ErrLockLost if the lock is no longer held by the owner.
+func (l *Locker) Release(ctx context.Context) error {
+	return l.execAsOwner(ctx, fmt.Sprintf(
+		"DELETE FROM `%s` WHERE `name` = ? AND `owner` = ?", DefaultTable),
+		l.name, l.options.Owner)
+}
+
+// Current returns the lock if it is held by any owner, and nil if the lock is
+// not held, or if its lease has expired.
+func (l *Locker) Current(ctx context.Context) (*Lock, error) {
+	var locks []Lock
+	if err := l.session(ctx).Raw(fmt.Sprintf(
+		"SELECT * FROM `%s` WHERE `name` = ? AND `expires_at` > CURRENT_TIMESTAMP()", DefaultTable),
+		l.name).Find(&locks).Error; err != nil {
+		return nil, err
+	}
+	if len(locks) == 0 {
+		return nil, nil
+	}
+	return &locks[0], nil
+}
+
+// Hold acquires the lock, calls fn, and releases the lock when fn returns. The
+// lease of the lock is renewed in the background while fn runs. The context
+// that is passed to fn is cancelled if the lease cannot be renewed. Hold
+// returns ErrLockHeld without calling fn if the lock is held by another owner.
+func (l *Locker) Hold(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := l.Acquire(ctx); err != nil {
+		return err
+	}
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	renewed := make(chan error, 1)
+	go func() {
+		renewed <- l.keepAlive(fnCtx, done)
+		cancel()
+	}()
+	err := fn(fnCtx)
+	close(done)
+	if renewErr := <-renewed; renewErr != nil {
+		err = errors.Join(err, renewErr)
+		if errors.Is(renewErr, ErrLockLost) {
+			return err
+		}
+	}
+	// The context of the caller might be cancelled, but the lock should still
+	// be released.
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), l.options.LeaseDuration)
+	defer releaseCancel()
+	return errors.Join(err, l.Release(releaseCtx))
+}
+
+// keepAlive renews the lease of the lock three times per lease duration until
+// done is closed or ctx is cancelled. It returns the error of the first
+// renewal that fails.
+func (l *Locker) keepAlive(ctx context.Context, done <-chan struct{}) error {
+	ticker := time.NewTicker(l.options.LeaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := l.Renew(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (l *Locker) execAsOwner(ctx context.Context, sql string, values ...interface{}) error {
+	res := l.session(ctx).Exec(sql, values...)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// session returns a session that is not affected by other statements on the
+// database of the lock.
+func (l *Locker) session(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return l.db.Session(&gorm.Session{NewDB: true, Context: ctx})
+}
+
+func randomOwner() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("owner-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
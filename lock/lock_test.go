@@ -0,0 +1,227 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	acquireSql = "UPDATE `gorm_locks` SET `owner` = @p1, " +
+		"`expires_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @p2 MILLISECOND), " +
+		"`acquired_at` = PENDING_COMMIT_TIMESTAMP(), `renewed_at` = PENDING_COMMIT_TIMESTAMP() " +
+		"WHERE `name` = @p3 AND (`owner` = @p4 OR `expires_at` <= CURRENT_TIMESTAMP())"
+	insertSql = "INSERT INTO `gorm_locks` (`name`, `owner`, `expires_at`, `acquired_at`, `renewed_at`) " +
+		"VALUES (@p1, @p2, TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @p3 MILLISECOND), " +
+		"PENDING_COMMIT_TIMESTAMP(), PENDING_COMMIT_TIMESTAMP())"
+	renewSql = "UPDATE `gorm_locks` SET `expires_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @p1 MILLISECOND), " +
+		"`renewed_at` = PENDING_COMMIT_TIMESTAMP() " +
+		"WHERE `name` = @p2 AND `owner` = @p3 AND `expires_at` > CURRENT_TIMESTAMP()"
+	releaseSql = "DELETE FROM `gorm_locks` WHERE `name` = @p1 AND `owner` = @p2"
+)
+
+func TestAcquireExistingLock(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putUpdateCount(server, acquireSql, 1)
+
+	l := NewWithOptions(db, "report", Options{Owner: "worker-1", LeaseDuration: time.Minute})
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var acquire *spannerpb.ExecuteSqlRequest
+	for _, req := range executeRequests(server) {
+		switch req.Sql {
+		case acquireSql:
+			acquire = req
+		case insertSql:
+			t.Fatal("lock that exists was inserted")
+		}
+	}
+	if acquire == nil {
+		t.Fatal("acquire statement not found")
+	}
+	if g, w := fmt.Sprintf("%s %s %s", acquire.Params.Fields["p1"].GetStringValue(), acquire.Params.Fields["p2"].GetStringValue(), acquire.Params.Fields["p3"].GetStringValue()), "worker-1 60000 report"; g != w {
+		t.Fatalf("params mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestAcquireNewLock(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putUpdateCount(server, acquireSql, 0)
+	_ = putUpdateCount(server, insertSql, 1)
+
+	l := NewWithOptions(db, "report", Options{Owner: "worker-1"})
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if req := lastRequest(server, insertSql); req == nil {
+		t.Fatal("insert statement not found")
+	}
+}
+
+func TestAcquireHeldLock(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putUpdateCount(server, acquireSql, 0)
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type: testutil.StatementResultError,
+		Err:  status.Error(codes.AlreadyExists, "Row [report] in table gorm_locks already exists"),
+	})
+
+	l := New(db, "report")
+	if g, w := l.Acquire(context.Background()), ErrLockHeld; !errors.Is(g, w) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestRenewLockLost(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putUpdateCount(server, renewSql, 0)
+
+	l := New(db, "report")
+	if g, w := l.Renew(context.Background()), ErrLockLost; !errors.Is(g, w) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestHold(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putUpdateCount(server, acquireSql, 1)
+	_ = putUpdateCount(server, renewSql, 1)
+	_ = putUpdateCount(server, releaseSql, 1)
+
+	l := NewWithOptions(db, "report", Options{LeaseDuration: 30 * time.Millisecond})
+	called := false
+	if err := l.Hold(context.Background(), func(ctx context.Context) error {
+		called = true
+		// Wait long enough for the lease to be renewed.
+		time.Sleep(50 * time.Millisecond)
+		return ctx.Err()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("function was not called")
+	}
+	counts := make(map[string]int)
+	for _, req := range executeRequests(server) {
+		counts[req.Sql]++
+	}
+	if g, w := counts[acquireSql], 1; g != w {
+		t.Fatalf("acquire count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g := counts[renewSql]; g == 0 {
+		t.Fatal("lease was not renewed")
+	}
+	if g, w := counts[releaseSql], 1; g != w {
+		t.Fatalf("release count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestHoldLockLost(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putUpdateCount(server, acquireSql, 1)
+	_ = putUpdateCount(server, renewSql, 0)
+
+	l := NewWithOptions(db, "report", Options{LeaseDuration: 30 * time.Millisecond})
+	err := l.Hold(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if g, w := err, ErrLockLost; !errors.Is(g, w) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for _, req := range executeRequests(server) {
+		if req.Sql == releaseSql {
+			t.Fatal("lock that was lost was released")
+		}
+	}
+}
+
+func putUpdateCount(server *testutil.MockedSpannerInMemTestServer, sql string, count int64) error {
+	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: count,
+	})
+}
+
+// executeRequests returns the ExecuteSqlRequests that have been received by
+// the server.
+func executeRequests(server *testutil.MockedSpannerInMemTestServer) []*spannerpb.ExecuteSqlRequest {
+	var reqs []*spannerpb.ExecuteSqlRequest
+	for _, req := range drainRequestsFromServer(server.TestSpanner) {
+		if executeReq, ok := req.(*spannerpb.ExecuteSqlRequest); ok {
+			reqs = append(reqs, executeReq)
+		}
+	}
+	return reqs
+}
+
+// lastRequest returns the last ExecuteSqlRequest with the given SQL string
+// that has been received by the server.
+func lastRequest(server *testutil.MockedSpannerInMemTestServer, sql string) *spannerpb.ExecuteSqlRequest {
+	var last *spannerpb.ExecuteSqlRequest
+	for _, req := range executeRequests(server) {
+		if req.Sql == sql {
+			last = req
+		}
+	}
+	return last
+}
+
+func setupTestGormConnection(t *testing.T) (db *gorm.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	server, _, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	db, err := gorm.Open(spannergorm.New(spannergorm.Config{
+		DriverName: "spanner",
+		DSN:        fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address),
+
+		DisableDialectCheck: true,
+	}), &gorm.Config{})
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	return db, server, serverTeardown
+}
+
+func drainRequestsFromServer(server testutil.InMemSpannerServer) []interface{} {
+	var reqs []interface{}
+loop:
+	for {
+		select {
+		case req := <-server.ReceivedRequests():
+			reqs = append(reqs, req)
+		default:
+			break loop
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,253 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics contains a gorm plugin that records OpenTelemetry metrics
+// and traces for the operations that gorm executes on Spanner. The traces of
+// the Spanner client library show the RPCs that are sent to Spanner, but not
+// which gorm operation sent them. The plugin adds a span for each gorm
+// operation, which is the parent of the spans of the client library, with
+// Spanner-specific attributes such as the transaction tag, the number of
+// times that the transaction was retried after an abort, and the number of
+// mutations that were written. It also records the size of the DDL batches
+// that are executed by the migrator.
+//
+// The plugin uses the global meter and tracer providers of OpenTelemetry,
+// unless other providers are set.
+//
+// Example:
+//
+//	if err := db.Use(&metrics.Plugin{}); err != nil {
+//	  return err
+//	}
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	instrumentationName = "github.com/googleapis/go-gorm-spanner/metrics"
+
+	parentContextKey = "gorm:spanner:metrics_parent_context"
+	startTimeKey     = "gorm:spanner:metrics_start_time"
+)
+
+// The attributes that the plugin adds to spans and metrics.
+const (
+	// OperationKey is the gorm operation: create, query, update, delete, row
+	// or raw.
+	OperationKey = attribute.Key("db.operation")
+	// TableKey is the table of the operation.
+	TableKey = attribute.Key("db.sql.table")
+	// StatementKey is the SQL statement of the operation. It is only added to
+	// spans.
+	StatementKey = attribute.Key("db.statement")
+	// RowsAffectedKey is the number of rows that the operation affected. It
+	// is only added to spans.
+	RowsAffectedKey = attribute.Key("db.rows_affected")
+	// TransactionTagKey is the transaction tag that was set with
+	// spannergorm.WithTransactionTag or spannergorm.WithRequestOptions.
+	TransactionTagKey = attribute.Key("spanner.transaction_tag")
+	// AbortedRetriesKey is the number of times that the transaction of the
+	// operation was retried by spannergorm.RunTransaction after it was
+	// aborted.
+	AbortedRetriesKey = attribute.Key("spanner.aborted_retries")
+	// MutationCountKey is the number of mutations that the operation wrote
+	// with spannergorm.WithMutations.
+	MutationCountKey = attribute.Key("spanner.mutation_count")
+	// DDLBatchSizeKey is the number of statements in a DDL batch.
+	DDLBatchSizeKey = attribute.Key("spanner.ddl_batch_size")
+	// ErrorKey is true if the operation failed. gorm.ErrRecordNotFound is not
+	// counted as a failure.
+	ErrorKey = attribute.Key("error")
+)
+
+// Plugin is a gorm plugin that records OpenTelemetry metrics and traces for
+// gorm operations on Spanner. It records the following metrics:
+//
+//   - spanner.gorm.operation.duration: the duration of gorm operations in
+//     seconds.
+//   - spanner.gorm.mutations: the number of mutations that have been written
+//     with spannergorm.WithMutations.
+//   - spanner.gorm.ddl.batch_size: the number of statements in the DDL batches
+//     that have been executed by the migrator.
+type Plugin struct {
+	// MeterProvider is used to create the meter of the plugin. The default is
+	// the global meter provider.
+	MeterProvider metric.MeterProvider
+	// TracerProvider is used to create the tracer of the plugin. The default
+	// is the global tracer provider.
+	TracerProvider trace.TracerProvider
+
+	tracer       trace.Tracer
+	duration     metric.Float64Histogram
+	mutations    metric.Int64Counter
+	ddlBatchSize metric.Int64Histogram
+}
+
+// Name implements gorm.Plugin.
+func (p *Plugin) Name() string {
+	return "gorm:spanner:metrics"
+}
+
+// Initialize implements gorm.Plugin.
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	if p.MeterProvider == nil {
+		p.MeterProvider = otel.GetMeterProvider()
+	}
+	if p.TracerProvider == nil {
+		p.TracerProvider = otel.GetTracerProvider()
+	}
+	p.tracer = p.TracerProvider.Tracer(instrumentationName)
+	meter := p.MeterProvider.Meter(instrumentationName)
+	var err error
+	if p.duration, err = meter.Float64Histogram("spanner.gorm.operation.duration",
+		metric.WithDescription("The duration of gorm operations on Spanner."),
+		metric.WithUnit("s")); err != nil {
+		return err
+	}
+	if p.mutations, err = meter.Int64Counter("spanner.gorm.mutations",
+		metric.WithDescription("The number of mutations that have been written by gorm operations."),
+		metric.WithUnit("{mutation}")); err != nil {
+		return err
+	}
+	if p.ddlBatchSize, err = meter.Int64Histogram("spanner.gorm.ddl.batch_size",
+		metric.WithDescription("The number of statements in the DDL batches that have been executed by the migrator."),
+		metric.WithUnit("{statement}")); err != nil {
+		return err
+	}
+
+	before, after := "gorm:spanner:metrics_before", "gorm:spanner:metrics_after"
+	if err := db.Callback().Create().Before("*").Register(before, p.before("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("*").Register(after, p.after("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("*").Register(before, p.before("query")); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("*").Register(after, p.after("query")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("*").Register(before, p.before("update")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("*").Register(after, p.after("update")); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("*").Register(before, p.before("delete")); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("*").Register(after, p.after("delete")); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("*").Register(before, p.before("row")); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().After("*").Register(after, p.after("row")); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().Before("*").Register(before, p.before("raw")); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("*").Register(after, p.after("raw"))
+}
+
+// before starts a span for the operation. The span is added to the context of
+// the statement, so the spans of the Spanner client library are its children.
+func (p *Plugin) before(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		parent := db.Statement.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, _ := p.tracer.Start(parent, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "spanner")))
+		db.Statement.Context = ctx
+		db.InstanceSet(parentContextKey, parent)
+		db.InstanceSet(startTimeKey, time.Now())
+	}
+}
+
+// after ends the span of the operation and records the metrics.
+func (p *Plugin) after(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startTimeKey)
+		if !ok {
+			return
+		}
+		start, _ := value.(time.Time)
+		ctx := db.Statement.Context
+		span := trace.SpanFromContext(ctx)
+		// Restore the context of the caller, as the statement can be reused
+		// for another operation.
+		if parent, ok := db.InstanceGet(parentContextKey); ok {
+			db.Statement.Context, _ = parent.(context.Context)
+		}
+
+		failed := db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound)
+		attributes := []attribute.KeyValue{
+			OperationKey.String(operation),
+			TableKey.String(db.Statement.Table),
+			ErrorKey.Bool(failed),
+		}
+		if tag := spannergorm.TransactionTag(ctx); tag != "" {
+			attributes = append(attributes, TransactionTagKey.String(tag))
+		}
+		if attempt := spannergorm.TransactionAttempt(ctx); attempt > 1 {
+			attributes = append(attributes, AbortedRetriesKey.Int(attempt-1))
+		}
+		p.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+		if count := spannergorm.MutationCount(db); count > 0 {
+			p.mutations.Add(ctx, int64(count), metric.WithAttributes(attributes...))
+			span.SetAttributes(MutationCountKey.Int(count))
+		}
+
+		span.SetAttributes(attributes...)
+		span.SetAttributes(StatementKey.String(db.Statement.SQL.String()), RowsAffectedKey.Int64(db.RowsAffected))
+		if failed {
+			span.RecordError(db.Error)
+			span.SetStatus(codes.Error, db.Error.Error())
+		}
+		span.End()
+	}
+}
+
+// ObserveDDLBatch implements spannergorm.DDLBatchObserver.
+func (p *Plugin) ObserveDDLBatch(ctx context.Context, statements []string, duration time.Duration, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	attributes := []attribute.KeyValue{ErrorKey.Bool(err != nil)}
+	p.ddlBatchSize.Record(ctx, int64(len(statements)), metric.WithAttributes(attributes...))
+	_, span := p.tracer.Start(ctx, "gorm.ddl_batch", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(time.Now().Add(-duration)),
+		trace.WithAttributes(attribute.String("db.system", "spanner"), DDLBatchSizeKey.Int(len(statements))))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
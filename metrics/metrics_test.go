@@ -0,0 +1,205 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+)
+
+type singer struct {
+	ID   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name string
+}
+
+func TestPluginMutations(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+	reader, spans := usePlugin(t, db)
+
+	tx := spannergorm.WithTransactionTag(spannergorm.WithMutations(db.Session(&gorm.Session{SkipDefaultTransaction: true})), "checkout-flow")
+	if err := tx.Create(&[]singer{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ended := spans.Ended()
+	if g, w := len(ended), 1; g != w {
+		t.Fatalf("span count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := ended[0].Name(), "gorm.create"; g != w {
+		t.Fatalf("span name mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	attributes := attribute.NewSet(ended[0].Attributes()...)
+	for key, want := range map[attribute.Key]attribute.Value{
+		OperationKey:      attribute.StringValue("create"),
+		TableKey:          attribute.StringValue("singers"),
+		TransactionTagKey: attribute.StringValue("checkout-flow"),
+		MutationCountKey:  attribute.IntValue(2),
+		ErrorKey:          attribute.BoolValue(false),
+	} {
+		if g, ok := attributes.Value(key); !ok || g != want {
+			t.Fatalf("%s mismatch\n Got: %v\nWant: %v", key, g.Emit(), want.Emit())
+		}
+	}
+
+	data := collect(t, reader)
+	sum, ok := findMetric(data, "spanner.gorm.mutations").(metricdata.Sum[int64])
+	if !ok || len(sum.DataPoints) != 1 {
+		t.Fatalf("mutation metric mismatch: %+v", sum)
+	}
+	if g, w := sum.DataPoints[0].Value, int64(2); g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	histogram, ok := findMetric(data, "spanner.gorm.operation.duration").(metricdata.Histogram[float64])
+	if !ok || len(histogram.DataPoints) != 1 {
+		t.Fatalf("duration metric mismatch: %+v", histogram)
+	}
+	if g, w := histogram.DataPoints[0].Count, uint64(1); g != w {
+		t.Fatalf("duration count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestPluginQueryError(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_, spans := usePlugin(t, db)
+
+	var singers []singer
+	if err := db.Raw("SELECT * FROM unknown_table").Find(&singers).Error; err == nil {
+		t.Fatal("missing error")
+	}
+	ended := spans.Ended()
+	if g, w := len(ended), 1; g != w {
+		t.Fatalf("span count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := ended[0].Status().Code.String(), "Error"; g != w {
+		t.Fatalf("status mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	attributes := attribute.NewSet(ended[0].Attributes()...)
+	if g, _ := attributes.Value(StatementKey); g.AsString() != "SELECT * FROM unknown_table" {
+		t.Fatalf("statement mismatch\n Got: %v", g.AsString())
+	}
+}
+
+func TestPluginDDLBatch(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	reader, spans := usePlugin(t, db)
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	_ = server.TestSpanner.PutStatementResult(
+		"SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3",
+		&testutil.StatementResult{
+			Type: testutil.StatementResultResultSet,
+			ResultSet: &spannerpb.ResultSet{
+				Metadata: &spannerpb.ResultSetMetadata{
+					RowType: &spannerpb.StructType{
+						Fields: []*spannerpb.StructType_Field{{Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, Name: "count"}},
+					},
+				},
+				Rows: []*structpb.ListValue{{Values: []*structpb.Value{structpb.NewStringValue("0")}}},
+			},
+		},
+	)
+
+	if err := db.AutoMigrate(&singer{}); err != nil {
+		t.Fatal(err)
+	}
+	histogram, ok := findMetric(collect(t, reader), "spanner.gorm.ddl.batch_size").(metricdata.Histogram[int64])
+	if !ok || len(histogram.DataPoints) != 1 {
+		t.Fatalf("DDL batch metric mismatch: %+v", histogram)
+	}
+	if g, w := histogram.DataPoints[0].Sum, int64(1); g != w {
+		t.Fatalf("DDL batch size mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	found := false
+	for _, span := range spans.Ended() {
+		if span.Name() == "gorm.ddl_batch" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("DDL batch span not found")
+	}
+}
+
+func usePlugin(t *testing.T, db *gorm.DB) (*sdkmetric.ManualReader, *tracetest.SpanRecorder) {
+	reader := sdkmetric.NewManualReader()
+	spans := tracetest.NewSpanRecorder()
+	if err := db.Use(&Plugin{
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return reader, spans
+}
+
+func collect(t *testing.T, reader *sdkmetric.ManualReader) metricdata.ResourceMetrics {
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func findMetric(data metricdata.ResourceMetrics, name string) metricdata.Aggregation {
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
+
+func setupTestGormConnection(t *testing.T) (db *gorm.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	server, _, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	db, err := gorm.Open(spannergorm.New(spannergorm.Config{
+		DriverName: "spanner",
+		DSN:        fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address),
+
+		DisableDialectCheck: true,
+	}), &gorm.Config{})
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	return db, server, serverTeardown
+}
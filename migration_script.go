@@ -0,0 +1,169 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// GenerateMigrationScript returns the DDL statements that AutoMigrate would
+// execute for the given models, and the DDL statements that undo these
+// changes, without changing the database. The statements are generated by
+// comparing the current schema of the database with the models. Use
+// WriteMigrationFiles to write the statements to migration files that can be
+// reviewed and executed by a migration tool, such as golang-migrate, for
+// environments where AutoMigrate may not be used.
+//
+// The down statements drop the tables, indexes, columns, constraints and
+// sequences that are created by the up statements, and change altered
+// columns back to their current type, nullability and default value. An
+// error is returned if the up statements contain a statement that cannot be
+// undone.
+//
+// Example:
+//
+//	m := db.Migrator().(spannergorm.SchemaAnalyzer)
+//	up, down, err := m.GenerateMigrationScript(&Singer{}, &Album{})
+//	if err != nil {
+//	  return err
+//	}
+//	err = spannergorm.WriteMigrationFiles("migrations", 20240601120000, "add_albums", up, down)
+func (m spannerMigrator) GenerateMigrationScript(values ...interface{}) (upDDL, downDDL []string, err error) {
+	defer m.Close()
+	if m.conn.batching {
+		return nil, nil, fmt.Errorf("GenerateMigrationScript cannot be called while a DDL batch is active")
+	}
+	existing, err := m.prepareAutoMigrate(values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Buffer all DDL statements without executing them.
+	if err := m.StartBatchDDL(); err != nil {
+		return nil, nil, err
+	}
+	err = m.autoMigrate(values, existing)
+	upDDL, batchErr := m.conn.takeBatch()
+	if err != nil {
+		return nil, nil, err
+	}
+	if batchErr != nil {
+		return nil, nil, batchErr
+	}
+	downDDL = make([]string, 0, len(upDDL))
+	for i := len(upDDL) - 1; i >= 0; i-- {
+		down, err := m.reverseDDL(upDDL[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if down != "" {
+			downDDL = append(downDDL, down)
+		}
+	}
+	return upDDL, downDDL, nil
+}
+
+var (
+	createTableRegexp    = regexp.MustCompile("(?i)^CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?(\\S+)")
+	createIndexRegexp    = regexp.MustCompile("(?i)^CREATE\\s+(?:UNIQUE\\s+)?(?:NULL_FILTERED\\s+)?INDEX\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?(\\S+)")
+	createSequenceRegexp = regexp.MustCompile("(?i)^CREATE\\s+SEQUENCE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?(\\S+)")
+	addConstraintRegexp  = regexp.MustCompile("(?i)^ALTER\\s+TABLE\\s+(\\S+)\\s+ADD\\s+CONSTRAINT\\s+(\\S+)")
+	addColumnRegexp      = regexp.MustCompile("(?i)^ALTER\\s+TABLE\\s+(\\S+)\\s+ADD\\s+(?:COLUMN\\s+)?(\\S+)")
+	alterColumnRegexp    = regexp.MustCompile("(?i)^ALTER\\s+TABLE\\s+(\\S+)\\s+ALTER\\s+COLUMN\\s+(\\S+)\\s+(\\S+)")
+)
+
+// reverseDDL returns the DDL statement that undoes the given DDL statement,
+// or an empty string if the statement does not need to be undone.
+func (m spannerMigrator) reverseDDL(statement string) (string, error) {
+	statement = strings.TrimSpace(statement)
+	if match := createTableRegexp.FindStringSubmatch(statement); match != nil {
+		return "DROP TABLE " + match[1], nil
+	}
+	if match := createIndexRegexp.FindStringSubmatch(statement); match != nil {
+		return "DROP INDEX " + match[1], nil
+	}
+	if match := createSequenceRegexp.FindStringSubmatch(statement); match != nil {
+		// Sequences are created with IF NOT EXISTS, and sequences that already
+		// exist must not be dropped.
+		if m.HasSequence(unquoteIdentifier(match[1])) {
+			return "", nil
+		}
+		return "DROP SEQUENCE " + match[1], nil
+	}
+	if match := addConstraintRegexp.FindStringSubmatch(statement); match != nil {
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", match[1], match[2]), nil
+	}
+	if match := alterColumnRegexp.FindStringSubmatch(statement); match != nil && !strings.EqualFold(match[3], "SET") {
+		return m.reverseAlterColumn(match[1], match[2])
+	}
+	if match := addColumnRegexp.FindStringSubmatch(statement); match != nil {
+		return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", match[1], match[2]), nil
+	}
+	return "", fmt.Errorf("cannot generate a down migration for DDL statement: %s", statement)
+}
+
+// reverseAlterColumn returns the statement that changes the given column back
+// to its current definition.
+func (m spannerMigrator) reverseAlterColumn(table, column string) (string, error) {
+	var (
+		spannerType  string
+		nullable     bool
+		defaultValue sql.NullString
+	)
+	tableSchema, tableName := m.tableSchemaAndName(unquoteIdentifier(table))
+	if err := m.DB.Raw(
+		"SELECT SPANNER_TYPE, IS_NULLABLE = 'YES', COLUMN_DEFAULT FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		tableSchema, tableName, unquoteIdentifier(column),
+	).Row().Scan(&spannerType, &nullable, &defaultValue); err != nil {
+		return "", fmt.Errorf("failed to get the current definition of column %s.%s: %w", table, column, err)
+	}
+	definition := spannerType
+	if !nullable {
+		definition += " NOT NULL"
+	}
+	if defaultValue.Valid && defaultValue.String != "" {
+		definition += " DEFAULT (" + defaultValue.String + ")"
+	}
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, column, definition), nil
+}
+
+// unquoteIdentifier removes the backticks from the given identifier, which
+// can be qualified with a schema, e.g. `sales`.`orders`.
+func unquoteIdentifier(name string) string {
+	return strings.ReplaceAll(name, "`", "")
+}
+
+// WriteMigrationFiles writes the given up and down DDL statements to the
+// migration files {version}_{name}.up.sql and {version}_{name}.down.sql in the
+// given directory. The file names and the format of the files are compatible
+// with golang-migrate. The statements are separated by semicolons.
+func WriteMigrationFiles(dir string, version uint64, name string, upDDL, downDDL []string) error {
+	write := func(direction string, statements []string) error {
+		file := filepath.Join(dir, fmt.Sprintf("%d_%s.%s.sql", version, name, direction))
+		content := ""
+		if len(statements) > 0 {
+			content = strings.Join(statements, ";\n\n") + ";\n"
+		}
+		return os.WriteFile(file, []byte(content), 0644)
+	}
+	if err := write("up", upDDL); err != nil {
+		return err
+	}
+	return write("down", downDDL)
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateMigrationScript(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	m := db.Migrator().(SchemaAnalyzer)
+	up, down, err := m.GenerateMigrationScript(&singer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The statements must not have been executed.
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := up, []string{
+		`CREATE SEQUENCE IF NOT EXISTS singers_seq OPTIONS (sequence_kind = "bit_reversed_positive")`,
+		"CREATE TABLE `singers` (" +
+			"`id` INT64 DEFAULT (GET_NEXT_SEQUENCE_VALUE(Sequence singers_seq)),`created_at` TIMESTAMP,`updated_at` TIMESTAMP,`deleted_at` TIMESTAMP," +
+			"`first_name` STRING(MAX),`last_name` STRING(MAX),`full_name` STRING(MAX),`active` BOOL) " +
+			"PRIMARY KEY (`id`)",
+		"CREATE INDEX `idx_singers_deleted_at` ON `singers`(`deleted_at`)",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("up statements mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := down, []string{
+		"DROP INDEX `idx_singers_deleted_at`",
+		"DROP TABLE `singers`",
+		"DROP SEQUENCE singers_seq",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("down statements mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	dir := t.TempDir()
+	if err := WriteMigrationFiles(dir, 1, "create_singers", up, down); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "1_create_singers.down.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := string(content), "DROP INDEX `idx_singers_deleted_at`;\n\nDROP TABLE `singers`;\n\nDROP SEQUENCE singers_seq;\n"; g != w {
+		t.Fatalf("down file mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1_create_singers.up.sql")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReverseDDL(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	m := db.Migrator().(spannerMigrator)
+	defer m.Close()
+	for _, test := range []struct {
+		statement string
+		want      string
+	}{
+		{"ALTER TABLE `singers` ADD `nick_name` STRING(MAX)", "ALTER TABLE `singers` DROP COLUMN `nick_name`"},
+		{"ALTER TABLE `singers` ADD COLUMN `name_lower` STRING(MAX) AS (LOWER(`name`)) STORED", "ALTER TABLE `singers` DROP COLUMN `name_lower`"},
+		{"ALTER TABLE `albums` ADD CONSTRAINT `fk_albums_singer` FOREIGN KEY (`singer_id`) REFERENCES `singers`(`id`)", "ALTER TABLE `albums` DROP CONSTRAINT `fk_albums_singer`"},
+		{"CREATE UNIQUE NULL_FILTERED INDEX `idx_name` ON `singers`(`name`)", "DROP INDEX `idx_name`"},
+	} {
+		got, err := m.reverseDDL(test.statement)
+		if err != nil {
+			t.Fatalf("%s: %v", test.statement, err)
+		}
+		if g, w := got, test.want; g != w {
+			t.Errorf("%s: down statement mismatch\n Got: %v\nWant: %v", test.statement, g, w)
+		}
+	}
+	if _, err := m.reverseDDL("DROP TABLE `singers`"); err == nil {
+		t.Fatal("missing expected error for statement that cannot be undone")
+	}
+}
@@ -15,9 +15,15 @@
 package gorm
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -37,9 +43,229 @@ type SpannerMigrator interface {
 	AbortBatch() error
 }
 
+// The migrator that is returned by db.Migrator() for a Spanner database also
+// implements the following optional interfaces. Use a type assertion to get
+// the interface of a feature, e.g. db.Migrator().(spannergorm.SequenceMigrator).
+// The migrator also implements io.Closer. Close returns the connection that is
+// used by the migrator to the pool. The migrator takes a new connection from
+// the pool if it is used again after it has been closed. AutoMigrate
+// automatically closes the migrator when it finishes.
+
+// SchemaAnalyzer compares models with the schema of the database without
+// executing any DDL statements.
+type SchemaAnalyzer interface {
+	// GenerateMigrationScript returns the DDL statements that AutoMigrate
+	// would execute for the given models, and the DDL statements that undo
+	// them, without changing the database. See
+	// spannerMigrator.GenerateMigrationScript for more information.
+	GenerateMigrationScript(values ...interface{}) (upDDL, downDDL []string, err error)
+	// DiffSchema compares the tables of the given models with the schema of
+	// the database without executing any DDL statements. See
+	// spannerMigrator.DiffSchema for more information.
+	DiffSchema(values ...interface{}) (SchemaDiff, error)
+	// AnalyzeHotspots returns a warning for each primary key and index of the
+	// given models that is likely to cause a hotspot. See
+	// spannerMigrator.AnalyzeHotspots for more information.
+	AnalyzeHotspots(values ...interface{}) ([]HotspotWarning, error)
+}
+
+// ConstraintMigrator reads and creates foreign key and check constraints.
+type ConstraintMigrator interface {
+	// GetForeignKeys returns the foreign key constraints of the table of the
+	// given model. The columns of composite foreign keys are returned in the
+	// order in which they are defined in the constraint.
+	GetForeignKeys(value interface{}) ([]ForeignKey, error)
+	// CreateConstraintWithOptions adds a constraint to an existing table and
+	// reports the progress of the validation of the existing rows. See
+	// spannerMigrator.CreateConstraintWithOptions for more information.
+	CreateConstraintWithOptions(value interface{}, name string, options ConstraintOptions) error
+	// EnforceConstraint validates and enforces a NOT ENFORCED foreign key.
+	// See spannerMigrator.EnforceConstraint for more information.
+	EnforceConstraint(value interface{}, name string, options ConstraintOptions) error
+}
+
+// IndexMigrator reads the indexes of a table with options.
+type IndexMigrator interface {
+	// GetIndexesWithOptions returns the indexes of the table of the given
+	// model. See IndexOptions for the available options.
+	GetIndexesWithOptions(value interface{}, options IndexOptions) ([]gorm.Index, error)
+}
+
+// SequenceMigrator reads and drops the bit-reversed sequences of the
+// database.
+type SequenceMigrator interface {
+	// GetSequences returns the bit-reversed sequences in the database.
+	GetSequences() ([]Sequence, error)
+	// HasSequence returns true if the database contains a sequence with the
+	// given name.
+	HasSequence(name string) bool
+	// DropSequence drops the sequence with the given name.
+	DropSequence(name string) error
+}
+
+// SchemaObjectMigrator reads the schema objects of the database that are not
+// tables or indexes.
+type SchemaObjectMigrator interface {
+	// GetChangeStreams returns the change streams in the database.
+	GetChangeStreams() ([]ChangeStream, error)
+	// GetViews returns the views in the database.
+	GetViews() ([]View, error)
+	// GetRoles returns the database roles in the database.
+	GetRoles() ([]Role, error)
+}
+
+// SynonymMigrator manages the synonyms of tables.
+type SynonymMigrator interface {
+	// CreateSynonym adds a synonym to the table of the given model or table
+	// name. The table can be read and written through both its name and the
+	// synonym.
+	CreateSynonym(value interface{}, synonym string) error
+	// DropSynonym drops a synonym from the table of the given model or table
+	// name.
+	DropSynonym(value interface{}, synonym string) error
+	// RenameTableWithSynonym renames a table and adds the old name of the
+	// table as a synonym in one DDL statement. See
+	// spannerMigrator.RenameTableWithSynonym for more information.
+	RenameTableWithSynonym(oldName, newName interface{}) error
+}
+
+// DatabaseOptionsMigrator reads and sets the options of the database.
+type DatabaseOptionsMigrator interface {
+	// GetDatabaseOptions returns the options of the database that have been
+	// set, by option name.
+	GetDatabaseOptions() (map[string]string, error)
+	// SetDatabaseOption sets an option of the database. See
+	// spannerMigrator.SetDatabaseOption for more information.
+	SetDatabaseOption(name string, value interface{}) error
+}
+
+// DataMigrator changes the data of existing tables and columns.
+type DataMigrator interface {
+	// MigrateEpochColumn copies the values of an existing INT64 column that
+	// contains epoch timestamps in the given unit to the TIMESTAMP column of the
+	// given field. See spannerMigrator.MigrateEpochColumn for more information.
+	MigrateEpochColumn(value interface{}, field string, epochColumn string, unit schema.TimeType) error
+	// ChangeColumnTypeSafely executes one step of changing the type of a
+	// column without downtime. See spannerMigrator.ChangeColumnTypeSafely for
+	// more information.
+	ChangeColumnTypeSafely(value interface{}, field string, oldColumn string, step ColumnTypeChangeStep) error
+	// CopyTable creates the table of the destination model if it does not
+	// exist, and copies the rows of the source table to it in batches. See
+	// spannerMigrator.CopyTableWithOptions for more information.
+	CopyTable(src, dst interface{}, where ...interface{}) error
+	// CopyTableWithOptions copies the rows of the source table to the table
+	// of the destination model. See CopyTableOptions for the available
+	// options.
+	CopyTableWithOptions(src, dst interface{}, options CopyTableOptions) error
+}
+
+// StatisticsMigrator reads the built-in statistics tables of Spanner.
+type StatisticsMigrator interface {
+	// GetTableSizes returns the sizes of the tables and indexes in the
+	// database from the table sizes statistics of Spanner. See
+	// spannerMigrator.GetTableSizes for more information.
+	GetTableSizes() ([]TableSize, error)
+	// GetHottestQueries returns the queries that used the most CPU time in
+	// the last hour. See spannerMigrator.GetHottestQueries for more
+	// information.
+	GetHottestQueries(limit int) ([]QueryStats, error)
+	// GetIndexUsage returns the number of reads and writes of the indexes in
+	// the database. See spannerMigrator.GetIndexUsage for more information.
+	GetIndexUsage() ([]IndexUsage, error)
+	// GetUnusedIndexes returns the indexes that have not been read by any
+	// query. See spannerMigrator.GetUnusedIndexes for more information.
+	GetUnusedIndexes() ([]IndexUsage, error)
+	// GetTransactionStats returns the statistics of the transactions with
+	// the given tag prefix. See spannerMigrator.GetTransactionStats for more
+	// information.
+	GetTransactionStats(tagPrefix string, limit int) ([]TransactionStats, error)
+	// GetLockStats returns the row ranges with the longest lock wait times.
+	// See spannerMigrator.GetLockStats for more information.
+	GetLockStats(tagPrefix string, limit int) ([]LockStats, error)
+}
+
+var (
+	_ SpannerMigrator         = spannerMigrator{}
+	_ SchemaAnalyzer          = spannerMigrator{}
+	_ ConstraintMigrator      = spannerMigrator{}
+	_ IndexMigrator           = spannerMigrator{}
+	_ SequenceMigrator        = spannerMigrator{}
+	_ SchemaObjectMigrator    = spannerMigrator{}
+	_ SynonymMigrator         = spannerMigrator{}
+	_ DatabaseOptionsMigrator = spannerMigrator{}
+	_ DataMigrator            = spannerMigrator{}
+	_ StatisticsMigrator      = spannerMigrator{}
+	_ io.Closer               = spannerMigrator{}
+)
+
+// IndexOptions are the options for GetIndexesWithOptions.
+type IndexOptions struct {
+	// IncludeManaged includes the indexes that are managed by Spanner, such as
+	// the backing indexes of foreign keys. These are excluded by default.
+	IncludeManaged bool
+}
+
+// Sequence is a sequence in the database.
+type Sequence struct {
+	Name string
+	// Kind is the kind of the sequence, e.g. bit_reversed_positive.
+	Kind string
+	// SkipRangeMin and SkipRangeMax are the bounds of the range of values
+	// that the sequence skips, if set.
+	SkipRangeMin sql.NullInt64
+	SkipRangeMax sql.NullInt64
+	// StartWithCounter is the initial value of the internal counter of the
+	// sequence, if set.
+	StartWithCounter sql.NullInt64
+	// Counter is the current value of the internal counter of the sequence.
+	// It is NULL if the sequence has not yet been used, or if the internal
+	// state of the sequence cannot be read.
+	Counter sql.NullInt64
+}
+
+// ChangeStream is a change stream in the database.
+type ChangeStream struct {
+	Name string
+	// All is true if the change stream watches all tables in the database.
+	All bool
+	// Tables are the tables that are explicitly watched by the change stream.
+	Tables []string
+	// RetentionPeriod is the value of the retention_period option, if set.
+	RetentionPeriod string
+	// ValueCaptureType is the value of the value_capture_type option, if set.
+	ValueCaptureType string
+}
+
+// View is a view in the database.
+type View struct {
+	Name       string
+	Definition string
+	// SecurityType is the security type of the view, e.g. INVOKER.
+	SecurityType string
+}
+
+// Role is a database role.
+type Role struct {
+	Name string
+	// System is true for the system roles that are created by Spanner.
+	System bool
+}
+
+// ForeignKey is a foreign key constraint in the database.
+type ForeignKey struct {
+	Name              string
+	Table             string
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+	OnDelete          string
+}
+
 type spannerMigrator struct {
 	migrator.Migrator
 	Dialector
+
+	conn *migratorConn
 }
 
 type spannerColumnType struct {
@@ -47,17 +273,44 @@ type spannerColumnType struct {
 	GenerationExpression sql.NullString
 }
 
+// CurrentDatabase returns the name of the schema that is used for tables in
+// INFORMATION_SCHEMA queries. This is the DefaultSchema of the dialector, and
+// the empty string, which is the name of the default schema in Spanner, if no
+// DefaultSchema has been set. Tables with a name in the form schema.table are
+// looked up in their own schema. Use Dialector.DatabaseName to get the name of
+// the database.
 func (m spannerMigrator) CurrentDatabase() (name string) {
-	return ""
+	if m.Dialector.Config == nil {
+		return ""
+	}
+	return m.Dialector.DefaultSchema
 }
 
 func (m spannerMigrator) AutoMigrate(values ...interface{}) error {
+	defer m.Close()
+	values, views, err := m.splitViewModels(values)
+	if err != nil {
+		return err
+	}
+	existing, err := m.prepareAutoMigrate(values...)
+	if err != nil {
+		return err
+	}
 	if !m.Dialector.Config.DisableAutoMigrateBatching {
 		if err := m.StartBatchDDL(); err != nil {
 			return err
 		}
 	}
-	err := m.Migrator.AutoMigrate(values...)
+	// The PROTO BUNDLE is created before the tables, as their PROTO and
+	// ENUM columns use it.
+	err = m.migrateProtoBundle()
+	if err == nil {
+		err = m.autoMigrate(values, existing)
+	}
+	if err == nil {
+		// Views are created after the tables, as they can select from them.
+		err = m.migrateViews(views)
+	}
 	if err == nil {
 		if m.Dialector.Config.DisableAutoMigrateBatching {
 			return nil
@@ -68,26 +321,194 @@ func (m spannerMigrator) AutoMigrate(values ...interface{}) error {
 	return fmt.Errorf("unexpected return value type: %v", err)
 }
 
+// prepareAutoMigrate checks the given models before any statements are
+// executed, and returns the models of existing tables that need the generated
+// columns and indexes of caseInsensitiveIndex tags, that have foreign keys
+// whose ON DELETE action might have changed, that have a row deletion policy
+// or index options, or that have columns that are filled with the commit
+// timestamp.
+func (m spannerMigrator) prepareAutoMigrate(values ...interface{}) ([]interface{}, error) {
+	// Check the models before executing any statements, so unsupported tags
+	// and types are reported with the model and field that use them.
+	if err := m.validateModels(values...); err != nil {
+		return nil, err
+	}
+	if m.Dialector.Config.WarnHotspots {
+		if err := m.warnHotspots(values...); err != nil {
+			return nil, err
+		}
+	}
+	// Report all type changes that Spanner does not support before any of the
+	// tables is changed.
+	if m.Dialector.Config.StrictMigrateColumn {
+		if err := m.checkColumnTypeChanges(values...); err != nil {
+			return nil, err
+		}
+	}
+	// Tables that already exist get the generated columns and indexes for
+	// caseInsensitiveIndex tags, the ON DELETE actions of their foreign keys,
+	// their row deletion policy, the options of their indexes and the
+	// allow_commit_timestamp option of their columns after the migration. New
+	// tables get these from CreateTable.
+	var existing []interface{}
+	for _, value := range values {
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			policy, _ := rowDeletionPolicyOf(stmt.Schema)
+			if (len(caseInsensitiveIndexes(stmt.Schema)) > 0 || len(foreignKeyConstraints(stmt.Schema)) > 0 || policy != "" || hasIndexOptions(stmt.Schema) ||
+				m.Dialector.hasCommitTimestampColumns(stmt.Schema)) && m.HasTable(value) {
+				existing = append(existing, value)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// autoMigrate migrates the tables of the given models, adds the generated
+// columns and indexes of caseInsensitiveIndex tags to the given existing
+// tables, recreates their foreign keys whose columns or ON DELETE action have
+// changed,
+// adds or replaces their row deletion policy, changes the NULL_FILTERED and
+// STORING options of their indexes, and sets the allow_commit_timestamp
+// option of their existing commit timestamp columns. The foreign keys of has-one and
+// has-many associations are added to the existing tables of associated models
+// that are not migrated.
+func (m spannerMigrator) autoMigrate(values []interface{}, existing []interface{}) error {
+	if err := m.Migrator.AutoMigrate(values...); err != nil {
+		return err
+	}
+	migrated := make(map[string]bool, len(values))
+	for _, value := range values {
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			migrated[stmt.Table] = true
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	for _, value := range values {
+		if err := m.migrateReferencingForeignKeys(value, migrated); err != nil {
+			return err
+		}
+	}
+	for _, value := range existing {
+		if err := m.migrateCaseInsensitiveIndexes(value); err != nil {
+			return err
+		}
+		if err := m.migrateForeignKeys(value); err != nil {
+			return err
+		}
+		if err := m.migrateRowDeletionPolicy(value); err != nil {
+			return err
+		}
+		if err := m.migrateIndexOptions(value); err != nil {
+			return err
+		}
+		if err := m.migrateCommitTimestampOptions(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close returns the connection that is used by the migrator to the pool.
+func (m spannerMigrator) Close() error {
+	return m.conn.release()
+}
+
 func (m spannerMigrator) StartBatchDDL() error {
-	return m.DB.Exec("START BATCH DDL").Error
+	return m.conn.startBatch()
 }
 
+// RunBatch executes all DDL statements that have been buffered since
+// StartBatchDDL was called. The statements are sent to Spanner in batches of
+// at most Config.MaxDDLBatchSize statements, in the order in which they were
+// buffered. A *BatchDDLError that contains the index and text of the statement
+// that failed is returned if one of the statements fails and the dialector
+// opened its connection pool from a DSN. The batches before the batch with the
+// failed statement have been applied in that case.
 func (m spannerMigrator) RunBatch() error {
-	return m.DB.Exec("RUN BATCH").Error
+	statements, err := m.conn.takeBatch()
+	if err != nil {
+		return err
+	}
+	ctx := m.DB.Statement.Context
+	batches := splitDDLBatch(statements, m.Dialector.maxDDLBatchSize())
+	offset := 0
+	for i, batch := range batches {
+		if err := m.executeDDLBatch(ctx, batch); err != nil {
+			var batchErr *BatchDDLError
+			if errors.As(err, &batchErr) {
+				batchErr.Index += offset
+			}
+			return err
+		}
+		offset += len(batch)
+		if len(batches) > 1 {
+			m.DB.Logger.Info(ctx, "executed DDL batch %d of %d (%d statements)", i+1, len(batches), len(batch))
+		}
+	}
+	return nil
+}
+
+// executeDDLBatch executes one batch of DDL statements, and notifies the
+// plugins that implement DDLBatchObserver.
+func (m spannerMigrator) executeDDLBatch(ctx context.Context, statements []string) error {
+	return m.executeDDLBatchWithOptions(ctx, statements, DDLBatchOptions{})
+}
+
+// executeDDLBatchWithOptions executes one batch of DDL statements with the
+// given options, and notifies the plugins that implement DDLBatchObserver.
+func (m spannerMigrator) executeDDLBatchWithOptions(ctx context.Context, statements []string, options DDLBatchOptions) error {
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := m.Dialector.executeDDLWithOptions(ctx, m.conn, statements, options)
+	for _, plugin := range m.DB.Config.Plugins {
+		if observer, ok := plugin.(DDLBatchObserver); ok {
+			observer.ObserveDDLBatch(ctx, statements, time.Since(start), err)
+		}
+	}
+	return err
 }
 
 func (m spannerMigrator) AbortBatch() error {
-	return m.DB.Exec("ABORT BATCH").Error
+	_, err := m.conn.takeBatch()
+	return err
 }
 
 // FullDataTypeOf returns field's db full data type
 func (m spannerMigrator) FullDataTypeOf(field *schema.Field) (expr clause.Expr) {
+	expr = m.fullDataTypeWithoutOptions(field)
+	// Spanner requires the options of a column after its NOT NULL constraint
+	// and its default value.
+	if m.Dialector.allowsCommitTimestamp(field) {
+		expr.SQL += " " + allowCommitTimestampOption
+	}
+	return
+}
+
+// fullDataTypeWithoutOptions returns the data type of the given field with its
+// NOT NULL constraint and its default value, but without the column options.
+// ALTER COLUMN does not accept options together with a data type.
+func (m spannerMigrator) fullDataTypeWithoutOptions(field *schema.Field) (expr clause.Expr) {
 	expr.SQL = m.Migrator.DataTypeOf(field)
 
 	if field.NotNull {
 		expr.SQL += " NOT NULL"
 	}
 
+	if isGeneratedIdentity(field) && m.Dialector.Config.IdentityMode == IdentityModeIdentity {
+		options, _ := sequenceOptionsOf(field)
+		expr.SQL += " " + options.identityClause()
+		return
+	}
+
 	if field.HasDefaultValue && (field.DefaultValueInterface != nil || field.DefaultValue != "") {
 		if field.DefaultValueInterface != nil {
 			defaultStmt := &gorm.Statement{Vars: []interface{}{field.DefaultValueInterface}}
@@ -112,14 +533,22 @@ func (m spannerMigrator) CreateTable(values ...interface{}) error {
 			)
 			for _, f := range stmt.Schema.Fields {
 				// Cloud spanner does not support auto incrementing primary keys.
-				if f.AutoIncrement && f.HasDefaultValue && f.DefaultValue == "" && f.DefaultValueInterface == nil {
+				// Identity columns are created by FullDataTypeOf.
+				if isGeneratedIdentity(f) && m.Dialector.Config.IdentityMode != IdentityModeIdentity {
+					if m.Dialector.Config.IdentityMode == IdentityModeUUID {
+						return fmt.Errorf("%s.%s: autoIncrement is not supported with IdentityModeUUID", stmt.Schema.Name, f.Name)
+					}
+					options, err := sequenceOptionsOf(f)
+					if err != nil {
+						return err
+					}
 					sequence := f.Tag.Get(gormSpannerSequenceTag)
 					if sequence == "" {
-						sequence = stmt.Table + "_seq"
+						sequence = qualifiedTableName(stmt) + "_seq"
 					}
-					if err := tx.Exec("CREATE SEQUENCE IF NOT EXISTS " +
-						sequence +
-						` OPTIONS (sequence_kind = "bit_reversed_positive")`).Error; err != nil {
+					// Sequence names are not quoted, unless they are a reserved word.
+					sequence = quoteIfReserved(sequence)
+					if err := tx.Exec("CREATE SEQUENCE IF NOT EXISTS " + sequence + " " + options.sequenceClause()).Error; err != nil {
 						return err
 					}
 					f.DefaultValue = "GET_NEXT_SEQUENCE_VALUE(Sequence " + sequence + ")"
@@ -135,6 +564,13 @@ func (m spannerMigrator) CreateTable(values ...interface{}) error {
 				}
 			}
 
+			caseInsensitive := caseInsensitiveIndexes(stmt.Schema)
+			for _, index := range caseInsensitive {
+				sql, vars := m.caseInsensitiveColumnDefinition(index)
+				createTableSQL += sql + ","
+				values = append(values, vars...)
+			}
+
 			// Indexes should always be created after the table, as Spanner does not support
 			// inline index creation.
 			for _, idx := range stmt.Schema.ParseIndexes() {
@@ -145,6 +581,16 @@ func (m spannerMigrator) CreateTable(values ...interface{}) error {
 				}(value, idx.Name)
 			}
 
+			if len(caseInsensitive) > 0 {
+				defer func(stmt *gorm.Statement) {
+					for _, index := range caseInsensitive {
+						if errr == nil {
+							errr = m.createCaseInsensitiveIndex(tx, stmt, index)
+						}
+					}
+				}(stmt)
+			}
+
 			for _, rel := range stmt.Schema.Relationships.Relations {
 				if !m.DB.DisableForeignKeyConstraintWhenMigrating {
 					if constraint := rel.ParseConstraint(); constraint != nil {
@@ -176,6 +622,20 @@ func (m spannerMigrator) CreateTable(values ...interface{}) error {
 				values = append(values, primaryKeys)
 			}
 
+			if interleaved, err := interleaveOf(stmt.Schema); err != nil {
+				return err
+			} else if interleaved != nil {
+				sql, vars := interleaved.clause()
+				createTableSQL += sql
+				values = append(values, vars...)
+			}
+
+			if policy, err := rowDeletionPolicyOf(stmt.Schema); err != nil {
+				return err
+			} else if policy != "" {
+				createTableSQL += ", ROW DELETION POLICY (" + policy + ")"
+			}
+
 			if tableOption, ok := m.DB.Get("gorm:table_options"); ok {
 				createTableSQL += fmt.Sprint(tableOption)
 			}
@@ -206,14 +666,17 @@ func (m spannerMigrator) DropTable(values ...interface{}) error {
 func (m spannerMigrator) HasIndex(value interface{}, name string) bool {
 	var count int64
 	m.RunWithValue(value, func(stmt *gorm.Statement) error {
-		currentDatabase := m.DB.Migrator().CurrentDatabase()
 		if idx := stmt.Schema.LookIndex(name); idx != nil {
 			name = idx.Name
 		}
+		tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[i+1:]
+		}
 
 		return m.DB.Raw(
 			"SELECT count(*) FROM information_schema.indexes WHERE table_schema = ? AND table_name = ? AND index_name = ?",
-			currentDatabase, stmt.Table, name,
+			tableSchema, table, name,
 		).Row().Scan(&count)
 	})
 
@@ -226,7 +689,7 @@ func (m spannerMigrator) DropIndex(value interface{}, name string) error {
 			name = idx.Name
 		}
 
-		return m.DB.Exec("DROP INDEX ?", clause.Column{Name: name}).Error
+		return m.DB.Exec("DROP INDEX ?", clause.Column{Name: qualifiedIndexName(qualifiedTableName(stmt), name)}).Error
 	})
 }
 
@@ -235,9 +698,13 @@ func (m spannerMigrator) AlterColumn(value interface{}, field string) error {
 	if m.isColumnGenerated(value, field) {
 		return nil
 	}
+	// MigrateColumn sets the unsafe type change of the column that it migrates.
+	if change, ok := m.DB.Statement.Context.Value(unsafeColumnTypeChangeKey{}).(ColumnTypeChange); ok && change.Column == field {
+		return &UnsafeColumnTypeChangeError{Changes: []ColumnTypeChange{change}}
+	}
 	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
 		if field := stmt.Schema.LookUpField(field); field != nil {
-			fullType := m.FullDataTypeOf(field)
+			fullType := m.fullDataTypeWithoutOptions(field)
 			return m.DB.Exec(
 				"ALTER TABLE ? ALTER COLUMN ? ?",
 				m.CurrentTable(stmt), clause.Column{Name: field.DBName}, fullType,
@@ -247,6 +714,115 @@ func (m spannerMigrator) AlterColumn(value interface{}, field string) error {
 	})
 }
 
+// MigrateEpochColumn copies the values of an existing INT64 column that
+// contains epoch timestamps in the given unit to the TIMESTAMP column of the
+// given field. The TIMESTAMP column is added to the table if it does not yet
+// exist. Only rows where the TIMESTAMP column is NULL are updated, which means
+// that the migration can safely be retried. The update is executed as a
+// Partitioned DML statement.
+//
+// Spanner does not support changing the type of an INT64 column to TIMESTAMP,
+// and it does not support renaming columns. Use this method when changing a
+// field with an `autoCreateTime:milli` or `autoUpdateTime:nano` tag from an
+// integer type to time.Time, and then drop the old column once the
+// application no longer uses it.
+//
+// Example:
+//
+//	// Model field changed from `CreatedAtMillis int64 gorm:"autoCreateTime:milli"`
+//	// to `CreatedAt time.Time`.
+//	err := m.MigrateEpochColumn(&Singer{}, "CreatedAt", "created_at_millis", schema.UnixMillisecond)
+func (m spannerMigrator) MigrateEpochColumn(value interface{}, field string, epochColumn string, unit schema.TimeType) error {
+	if m.conn.batching {
+		return fmt.Errorf("MigrateEpochColumn cannot be called while a DDL batch is active")
+	}
+	var toTimestamp string
+	switch unit {
+	case schema.UnixSecond:
+		toTimestamp = "TIMESTAMP_SECONDS(?)"
+	case schema.UnixMillisecond:
+		toTimestamp = "TIMESTAMP_MILLIS(?)"
+	case schema.UnixNanosecond:
+		toTimestamp = "TIMESTAMP_ADD(TIMESTAMP_SECONDS(DIV(?, 1000000000)), INTERVAL MOD(?, 1000000000) NANOSECOND)"
+	default:
+		return fmt.Errorf("unsupported epoch unit: %v", unit)
+	}
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		f := stmt.Schema.LookUpField(field)
+		if f == nil {
+			return fmt.Errorf("failed to look up field with name: %s", field)
+		}
+		if f.DataType != schema.Time {
+			return fmt.Errorf("field %s is not a TIMESTAMP field", field)
+		}
+		if !m.HasColumn(value, f.DBName) {
+			if err := m.AddColumn(value, field); err != nil {
+				return err
+			}
+		}
+		column := clause.Column{Name: f.DBName}
+		source := clause.Column{Name: epochColumn}
+		args := []interface{}{m.CurrentTable(stmt), column}
+		for i := 0; i < strings.Count(toTimestamp, "?"); i++ {
+			args = append(args, source)
+		}
+		args = append(args, column, source)
+
+		return execPartitionedDML(m.DB, "UPDATE ? SET ? = "+toTimestamp+" WHERE ? IS NULL AND ? IS NOT NULL", args...)
+	})
+}
+
+// CreateSynonym adds a synonym to the table of the given model or table name.
+func (m spannerMigrator) CreateSynonym(value interface{}, synonym string) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		return m.DB.Exec("ALTER TABLE ? ADD SYNONYM ?", m.CurrentTable(stmt), clause.Table{Name: synonym}).Error
+	})
+}
+
+// DropSynonym drops a synonym from the table of the given model or table name.
+func (m spannerMigrator) DropSynonym(value interface{}, synonym string) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		return m.DB.Exec("ALTER TABLE ? DROP SYNONYM ?", m.CurrentTable(stmt), clause.Table{Name: synonym}).Error
+	})
+}
+
+// RenameTableWithSynonym renames a table and adds the old name of the table as
+// a synonym in one DDL statement. Existing applications can continue to read
+// and write the table through the old name, while models are gradually
+// changed to use the new name. Drop the synonym with DropSynonym once no
+// application uses the old name anymore.
+//
+// Implement SynonymModel to let a model read and write its table through a
+// synonym, while the migrator keeps using the name of the table.
+//
+// Example:
+//
+//	// Rename the table `singers` to `performers`, and keep `singers` as a synonym.
+//	err := m.RenameTableWithSynonym("singers", "performers")
+func (m spannerMigrator) RenameTableWithSynonym(oldName, newName interface{}) error {
+	oldTable, err := m.tableOf(oldName)
+	if err != nil {
+		return err
+	}
+	newTable, err := m.tableOf(newName)
+	if err != nil {
+		return err
+	}
+	return m.DB.Exec("ALTER TABLE ? RENAME TO ?, ADD SYNONYM ?", oldTable, newTable, oldTable).Error
+}
+
+// tableOf returns the table of the given model or table name.
+func (m spannerMigrator) tableOf(value interface{}) (interface{}, error) {
+	if name, ok := value.(string); ok {
+		return clause.Table{Name: name}, nil
+	}
+	stmt := &gorm.Statement{DB: m.DB}
+	if err := stmt.Parse(value); err != nil {
+		return nil, err
+	}
+	return m.CurrentTable(stmt), nil
+}
+
 // ColumnTypes column types return columnTypes,error
 func (m spannerMigrator) ColumnTypes(value interface{}) ([]gorm.ColumnType, error) {
 	columnTypes := make([]gorm.ColumnType, 0)
@@ -264,7 +840,7 @@ func (m spannerMigrator) ColumnTypes(value interface{}) ([]gorm.ColumnType, erro
 						LIMIT 1
 					   ) AS KEY,
                     `
-		rows, err := m.DB.Session(&gorm.Session{}).Table(stmt.Table).Limit(1).Rows()
+		rows, err := m.DB.Session(&gorm.Session{}).Table(qualifiedTableName(stmt)).Limit(1).Rows()
 		if err != nil {
 			return err
 		}
@@ -277,8 +853,8 @@ func (m spannerMigrator) ColumnTypes(value interface{}) ([]gorm.ColumnType, erro
 		}
 
 		columnTypeSQL += "FROM INFORMATION_SCHEMA.COLUMNS C WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"
-		currentDatabase := m.CurrentDatabase()
-		columns, rowErr := m.DB.Table(stmt.Table).Raw(columnTypeSQL, &currentDatabase, &stmt.Table).Rows()
+		tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+		columns, rowErr := m.DB.Table(qualifiedTableName(stmt)).Raw(columnTypeSQL, &tableSchema, &table).Rows()
 		if rowErr != nil {
 			return rowErr
 		}
@@ -326,44 +902,381 @@ func (m spannerMigrator) ColumnTypes(value interface{}) ([]gorm.ColumnType, erro
 	return columnTypes, err
 }
 
+// GetTypeAliases returns the data types that are equal to the given type.
+// MigrateColumn only alters a column if the data type of the field does not
+// start with the data type that is returned by ColumnTypes, or with one of its
+// aliases. ColumnTypes returns the GoogleSQL type names without lengths, e.g.
+// STRING for STRING(MAX), which therefore need no aliases. ARRAY columns are
+// returned without the length of their element type, e.g. ARRAY<STRING> for
+// ARRAY<STRING(MAX)>, which is equal to any array of the same element type.
+// Other types are equal to the gorm data types that are normalized to the same
+// GoogleSQL type, e.g. TIMESTAMP is equal to time.
+func (m spannerMigrator) GetTypeAliases(databaseTypeName string) []string {
+	if strings.HasPrefix(databaseTypeName, "array<") {
+		return []string{strings.TrimSuffix(databaseTypeName, ">")}
+	}
+	return dataTypeAliases(databaseTypeName)
+}
+
 func (m spannerMigrator) isColumnGenerated(value interface{}, field string) bool {
 	var count int64
 	m.RunWithValue(value, func(stmt *gorm.Statement) error {
-		currentDatabase := m.DB.Migrator().CurrentDatabase()
 		name := field
 		if field := stmt.Schema.LookUpField(field); field != nil {
 			name = field.DBName
 		}
+		tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
 
 		return m.DB.Raw(
 			"SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = ? AND table_name = ? AND column_name = ? AND generation_expression IS NOT NULL",
-			currentDatabase, stmt.Table, name,
+			tableSchema, table, name,
 		).Row().Scan(&count)
 	})
 
 	return count > 0
 }
 
-func buildConstraint(constraint *schema.Constraint) (sql string, results []interface{}) {
-	sql = "CONSTRAINT ? FOREIGN KEY ? REFERENCES ??"
-	if constraint.OnDelete != "" {
-		sql += " ON DELETE " + constraint.OnDelete
+func (m spannerMigrator) GetForeignKeys(value interface{}) ([]ForeignKey, error) {
+	foreignKeys := make([]ForeignKey, 0)
+	err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+		rows, err := m.DB.Raw(
+			`SELECT FK.CONSTRAINT_NAME, FK.COLUMN_NAME, PK.TABLE_NAME, PK.COLUMN_NAME, RC.DELETE_RULE
+			FROM INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS RC
+			INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE FK
+				ON FK.CONSTRAINT_CATALOG = RC.CONSTRAINT_CATALOG
+				AND FK.CONSTRAINT_SCHEMA = RC.CONSTRAINT_SCHEMA
+				AND FK.CONSTRAINT_NAME = RC.CONSTRAINT_NAME
+			INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE PK
+				ON PK.CONSTRAINT_CATALOG = RC.UNIQUE_CONSTRAINT_CATALOG
+				AND PK.CONSTRAINT_SCHEMA = RC.UNIQUE_CONSTRAINT_SCHEMA
+				AND PK.CONSTRAINT_NAME = RC.UNIQUE_CONSTRAINT_NAME
+				AND PK.ORDINAL_POSITION = FK.POSITION_IN_UNIQUE_CONSTRAINT
+			WHERE FK.TABLE_SCHEMA = ? AND FK.TABLE_NAME = ?
+			ORDER BY FK.CONSTRAINT_NAME, FK.ORDINAL_POSITION`,
+			tableSchema, table,
+		).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name, column, referencedTable, referencedColumn, onDelete string
+			if err := rows.Scan(&name, &column, &referencedTable, &referencedColumn, &onDelete); err != nil {
+				return err
+			}
+			if len(foreignKeys) == 0 || foreignKeys[len(foreignKeys)-1].Name != name {
+				foreignKeys = append(foreignKeys, ForeignKey{
+					Name:            name,
+					Table:           stmt.Table,
+					ReferencedTable: referencedTable,
+					OnDelete:        onDelete,
+				})
+			}
+			fk := &foreignKeys[len(foreignKeys)-1]
+			fk.Columns = append(fk.Columns, column)
+			fk.ReferencedColumns = append(fk.ReferencedColumns, referencedColumn)
+		}
+		return rows.Err()
+	})
+	return foreignKeys, err
+}
+
+// GetSequences returns the bit-reversed sequences in the database, ordered by
+// name. The counter of a sequence is NULL if its internal state cannot be
+// read, for example on a database that does not support
+// GET_INTERNAL_SEQUENCE_STATE.
+func (m spannerMigrator) GetSequences() ([]Sequence, error) {
+	sequences := make([]Sequence, 0)
+	rows, err := m.DB.Raw(
+		`SELECT S.NAME,
+			(SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.SEQUENCE_OPTIONS O
+				WHERE O.SCHEMA = S.SCHEMA AND O.NAME = S.NAME AND O.OPTION_NAME = 'sequence_kind'),
+			(SELECT SAFE_CAST(OPTION_VALUE AS INT64) FROM INFORMATION_SCHEMA.SEQUENCE_OPTIONS O
+				WHERE O.SCHEMA = S.SCHEMA AND O.NAME = S.NAME AND O.OPTION_NAME = 'skip_range_min'),
+			(SELECT SAFE_CAST(OPTION_VALUE AS INT64) FROM INFORMATION_SCHEMA.SEQUENCE_OPTIONS O
+				WHERE O.SCHEMA = S.SCHEMA AND O.NAME = S.NAME AND O.OPTION_NAME = 'skip_range_max'),
+			(SELECT SAFE_CAST(OPTION_VALUE AS INT64) FROM INFORMATION_SCHEMA.SEQUENCE_OPTIONS O
+				WHERE O.SCHEMA = S.SCHEMA AND O.NAME = S.NAME AND O.OPTION_NAME = 'start_with_counter')
+		FROM INFORMATION_SCHEMA.SEQUENCES S
+		WHERE S.SCHEMA = ?
+		ORDER BY S.NAME`,
+		m.CurrentDatabase(),
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sequence Sequence
+		var kind sql.NullString
+		if err := rows.Scan(&sequence.Name, &kind, &sequence.SkipRangeMin, &sequence.SkipRangeMax, &sequence.StartWithCounter); err != nil {
+			return nil, err
+		}
+		sequence.Kind = kind.String
+		sequences = append(sequences, sequence)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range sequences {
+		// The internal state of a sequence is not available on all databases,
+		// for example the emulator, and requires additional permissions. The
+		// counter is left NULL if it cannot be read.
+		var counter sql.NullInt64
+		if err := m.DB.Raw("SELECT GET_INTERNAL_SEQUENCE_STATE(SEQUENCE ?)", clause.Table{Name: sequences[i].Name}).
+			Row().Scan(&counter); err == nil {
+			sequences[i].Counter = counter
+		}
+	}
+	return sequences, nil
+}
+
+// HasSequence returns true if the database contains a sequence with the given
+// name.
+func (m spannerMigrator) HasSequence(name string) bool {
+	var count int64
+	_ = m.DB.Raw(
+		"SELECT count(*) FROM INFORMATION_SCHEMA.SEQUENCES WHERE SCHEMA = ? AND NAME = ?",
+		m.CurrentDatabase(), name,
+	).Row().Scan(&count)
+	return count > 0
+}
+
+// DropSequence drops the sequence with the given name. The sequence must not be
+// used by the default value of any column.
+func (m spannerMigrator) DropSequence(name string) error {
+	return m.DB.Exec("DROP SEQUENCE ?", clause.Table{Name: name}).Error
+}
+
+// GetChangeStreams returns the change streams in the database, ordered by name.
+func (m spannerMigrator) GetChangeStreams() ([]ChangeStream, error) {
+	changeStreams := make([]ChangeStream, 0)
+	rows, err := m.DB.Raw(
+		`SELECT CS.CHANGE_STREAM_NAME, CS.ALL,
+			(SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.CHANGE_STREAM_OPTIONS O
+				WHERE O.CHANGE_STREAM_SCHEMA = CS.CHANGE_STREAM_SCHEMA AND O.CHANGE_STREAM_NAME = CS.CHANGE_STREAM_NAME
+				AND O.OPTION_NAME = 'retention_period'),
+			(SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.CHANGE_STREAM_OPTIONS O
+				WHERE O.CHANGE_STREAM_SCHEMA = CS.CHANGE_STREAM_SCHEMA AND O.CHANGE_STREAM_NAME = CS.CHANGE_STREAM_NAME
+				AND O.OPTION_NAME = 'value_capture_type')
+		FROM INFORMATION_SCHEMA.CHANGE_STREAMS CS
+		WHERE CS.CHANGE_STREAM_SCHEMA = ?
+		ORDER BY CS.CHANGE_STREAM_NAME`,
+		m.CurrentDatabase(),
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	indexes := make(map[string]int)
+	for rows.Next() {
+		var changeStream ChangeStream
+		var retentionPeriod, valueCaptureType sql.NullString
+		if err := rows.Scan(&changeStream.Name, &changeStream.All, &retentionPeriod, &valueCaptureType); err != nil {
+			return nil, err
+		}
+		changeStream.RetentionPeriod = retentionPeriod.String
+		changeStream.ValueCaptureType = valueCaptureType.String
+		indexes[changeStream.Name] = len(changeStreams)
+		changeStreams = append(changeStreams, changeStream)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tables, err := m.DB.Raw(
+		`SELECT CHANGE_STREAM_NAME, TABLE_NAME
+		FROM INFORMATION_SCHEMA.CHANGE_STREAM_TABLES
+		WHERE CHANGE_STREAM_SCHEMA = ?
+		ORDER BY CHANGE_STREAM_NAME, TABLE_NAME`,
+		m.CurrentDatabase(),
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer tables.Close()
+	for tables.Next() {
+		var name, table string
+		if err := tables.Scan(&name, &table); err != nil {
+			return nil, err
+		}
+		if i, ok := indexes[name]; ok {
+			changeStreams[i].Tables = append(changeStreams[i].Tables, table)
+		}
 	}
+	return changeStreams, tables.Err()
+}
 
-	if constraint.OnUpdate != "" {
-		sql += " ON UPDATE " + constraint.OnUpdate
+// GetViews returns the views in the database, ordered by name.
+func (m spannerMigrator) GetViews() ([]View, error) {
+	views := make([]View, 0)
+	rows, err := m.DB.Raw(
+		`SELECT TABLE_NAME, VIEW_DEFINITION, SECURITY_TYPE
+		FROM INFORMATION_SCHEMA.VIEWS
+		WHERE TABLE_SCHEMA = ?
+		ORDER BY TABLE_NAME`,
+		m.CurrentDatabase(),
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var view View
+		var securityType sql.NullString
+		if err := rows.Scan(&view.Name, &view.Definition, &securityType); err != nil {
+			return nil, err
+		}
+		view.SecurityType = securityType.String
+		views = append(views, view)
 	}
+	return views, rows.Err()
+}
 
-	var foreignKeys, references []interface{}
-	for _, field := range constraint.ForeignKeys {
-		foreignKeys = append(foreignKeys, clause.Column{Name: field.DBName})
+// GetRoles returns the database roles in the database, ordered by name.
+func (m spannerMigrator) GetRoles() ([]Role, error) {
+	roles := make([]Role, 0)
+	rows, err := m.DB.Raw("SELECT ROLE_NAME, IS_SYSTEM FROM INFORMATION_SCHEMA.ROLES ORDER BY ROLE_NAME").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role Role
+		var system sql.NullBool
+		if err := rows.Scan(&role.Name, &system); err != nil {
+			return nil, err
+		}
+		role.System = system.Bool
+		roles = append(roles, role)
 	}
+	return roles, rows.Err()
+}
 
-	for _, field := range constraint.References {
-		references = append(references, clause.Column{Name: field.DBName})
+// GetDatabaseOptions returns the options of the database that have been set,
+// such as version_retention_period, default_leader and default_sequence_kind.
+func (m spannerMigrator) GetDatabaseOptions() (map[string]string, error) {
+	options := make(map[string]string)
+	rows, err := m.DB.Raw(
+		"SELECT OPTION_NAME, OPTION_VALUE FROM INFORMATION_SCHEMA.DATABASE_OPTIONS WHERE SCHEMA_NAME = ?",
+		m.CurrentDatabase(),
+	).Rows()
+	if err != nil {
+		return nil, err
 	}
-	results = append(results, clause.Table{Name: constraint.Name}, foreignKeys, clause.Table{Name: constraint.ReferenceSchema.Table}, references)
-	return
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		options[name] = value.String
+	}
+	return options, rows.Err()
+}
+
+// SetDatabaseOption sets an option of the database, such as
+// version_retention_period, default_leader or default_sequence_kind. The value
+// must be a string, a bool, an integer, or nil to reset the option to its
+// default value. The dialector must have been created with a DSN, as the name
+// of the database is needed for the ALTER DATABASE statement.
+//
+// The statement is only logged and not executed if the migrator was created
+// from a gorm session with DryRun enabled.
+//
+// Example:
+//
+//	err := m.SetDatabaseOption("version_retention_period", "7d")
+func (m spannerMigrator) SetDatabaseOption(name string, value interface{}) error {
+	if !databaseOptionNameRegExp.MatchString(name) {
+		return fmt.Errorf("invalid database option name: %q", name)
+	}
+	literal, err := databaseOptionLiteral(value)
+	if err != nil {
+		return err
+	}
+	if m.Dialector.Config == nil || m.Dialector.DSN == "" {
+		return fmt.Errorf("SetDatabaseOption requires a dialector with a DSN")
+	}
+	config, err := parseDSN(m.Dialector.DSN)
+	if err != nil {
+		return err
+	}
+	return m.DB.Exec(fmt.Sprintf("ALTER DATABASE `%s` SET OPTIONS (%s = %s)", config.database, name, literal)).Error
+}
+
+var databaseOptionNameRegExp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// databaseOptionLiteral returns the value of a database option as a literal
+// that can be used in a DDL statement. DDL statements do not support query
+// parameters.
+func databaseOptionLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int, int32, int64, uint, uint32, uint64:
+		return fmt.Sprintf("%d", v), nil
+	}
+	return "", fmt.Errorf("unsupported database option value type: %T", value)
+}
+
+// GetIndexes returns the indexes of the table of the given model, including
+// the primary key. Indexes that are managed by Spanner are not included. Use
+// GetIndexesWithOptions to include these.
+func (m spannerMigrator) GetIndexes(value interface{}) ([]gorm.Index, error) {
+	return m.GetIndexesWithOptions(value, IndexOptions{})
+}
+
+// GetIndexesWithOptions returns the indexes of the table of the given model,
+// including the primary key. The Unique method of the returned indexes
+// returns true for unique indexes and for the primary key. STORING columns
+// are not included in the columns of an index.
+func (m spannerMigrator) GetIndexesWithOptions(value interface{}, options IndexOptions) ([]gorm.Index, error) {
+	indexes := make([]gorm.Index, 0)
+	err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+		rows, err := m.DB.Raw(
+			`SELECT I.INDEX_NAME, I.INDEX_TYPE = 'PRIMARY_KEY', I.IS_UNIQUE, IC.COLUMN_NAME
+			FROM INFORMATION_SCHEMA.INDEXES I
+			INNER JOIN INFORMATION_SCHEMA.INDEX_COLUMNS IC USING (TABLE_CATALOG, TABLE_SCHEMA, TABLE_NAME, INDEX_NAME)
+			WHERE I.TABLE_SCHEMA = ? AND I.TABLE_NAME = ? AND (? OR NOT I.SPANNER_IS_MANAGED)
+			AND IC.ORDINAL_POSITION IS NOT NULL
+			ORDER BY I.INDEX_NAME, IC.ORDINAL_POSITION`,
+			tableSchema, table, options.IncludeManaged,
+		).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var index *migrator.Index
+		for rows.Next() {
+			var name, column string
+			var primaryKey, unique bool
+			if err := rows.Scan(&name, &primaryKey, &unique, &column); err != nil {
+				return err
+			}
+			if index == nil || index.NameValue != name {
+				index = &migrator.Index{
+					TableName:       stmt.Table,
+					NameValue:       name,
+					PrimaryKeyValue: sql.NullBool{Bool: primaryKey, Valid: true},
+					UniqueValue:     sql.NullBool{Bool: unique || primaryKey, Valid: true},
+				}
+				indexes = append(indexes, index)
+			}
+			index.ColumnList = append(index.ColumnList, column)
+		}
+		return rows.Err()
+	})
+	return indexes, err
 }
 
 type Column struct {
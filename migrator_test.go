@@ -16,9 +16,16 @@ package gorm
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"cloud.google.com/go/spanner"
@@ -26,11 +33,17 @@ import (
 	"cloud.google.com/go/spanner/apiv1/spannerpb"
 	"github.com/googleapis/go-sql-spanner/testutil"
 	"google.golang.org/api/option"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
 )
 
 type singer struct {
@@ -56,6 +69,19 @@ type test struct {
 	Singer   *singer
 }
 
+type tenantSinger struct {
+	TenantID int64 `gorm:"primaryKey;autoIncrement:false"`
+	ID       int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name     string
+}
+
+type tenantAlbum struct {
+	TenantID int64 `gorm:"primaryKey;autoIncrement:false"`
+	ID       int64 `gorm:"primaryKey;autoIncrement:false"`
+	SingerID int64
+	Singer   tenantSinger `gorm:"foreignKey:TenantID,SingerID;references:TenantID,ID"`
+}
+
 func TestMigrate(t *testing.T) {
 	t.Parallel()
 
@@ -191,6 +217,586 @@ func TestMigrateMultipleTimes(t *testing.T) {
 	}
 }
 
+func TestMigrateBatchError(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	metadata, err := anypb.New(&databasepb.UpdateDatabaseDdlMetadata{
+		CommitTimestamps: []*timestamppb.Timestamp{timestamppb.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name:     "test-operation",
+			Done:     true,
+			Metadata: metadata,
+			Result: &longrunningpb.Operation_Error{Error: &statuspb.Status{
+				Code:    int32(codes.FailedPrecondition),
+				Message: "Duplicate name in schema: singers",
+			}},
+		},
+	})
+
+	err = db.Migrator().AutoMigrate(&singer{})
+	var batchErr *BatchDDLError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, batchErr)
+	}
+	if g, w := batchErr.Index, 1; g != w {
+		t.Fatalf("index mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if !strings.HasPrefix(batchErr.Statement, "CREATE TABLE `singers`") {
+		t.Fatalf("statement mismatch\n Got: %v", batchErr.Statement)
+	}
+	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
+		t.Fatalf("error code mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestRunDDLBatchWithConnError(t *testing.T) {
+	t.Parallel()
+
+	server, _, serverTeardown := setupMockedTestServer(t)
+	defer serverTeardown()
+	_ = putDialectResult(server, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+	sqlDB, err := sql.Open("spanner", fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	db, err := gorm.Open(New(Config{Conn: sqlDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name: "test-operation",
+			Done: true,
+			Result: &longrunningpb.Operation_Error{Error: &statuspb.Status{
+				Code:    int32(codes.FailedPrecondition),
+				Message: "Duplicate name in schema: nickname",
+			}},
+		},
+	})
+
+	statements := []string{
+		"ALTER TABLE singers ADD COLUMN nickname STRING(MAX)",
+		"CREATE INDEX idx_singers_last_name ON singers (last_name)",
+	}
+	err = RunDDLBatch(context.Background(), db, statements)
+	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
+		t.Fatalf("error code mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The statements are sent as one batch through the connection pool of the
+	// application, which does not report which statement failed.
+	var batchErr *BatchDDLError
+	if errors.As(err, &batchErr) {
+		t.Fatalf("unexpected batch error: %v", batchErr)
+	}
+	reqs := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(reqs), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := reqs[0].(*databasepb.UpdateDatabaseDdlRequest).Statements, statements; !reflect.DeepEqual(g, w) {
+		t.Fatalf("statements mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestDDLBatchesShareAdminClient(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name:   "test-operation-1",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+		&longrunningpb.Operation{
+			Name:   "test-operation-2",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+	})
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunDDLBatch(context.Background(), db, []string{"CREATE INDEX idx_a ON singers (first_name)"}); err != nil {
+		t.Fatal(err)
+	}
+	client := dialector.sharedClient.adminClient
+	if client == nil {
+		t.Fatal("missing admin client")
+	}
+	if err := RunDDLBatch(context.Background(), db, []string{"CREATE INDEX idx_b ON singers (last_name)"}); err != nil {
+		t.Fatal(err)
+	}
+	if dialector.sharedClient.adminClient != client {
+		t.Fatal("admin client was not reused")
+	}
+}
+
+func TestMigrateMaxDDLBatchSize(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{MaxDDLBatchSize: 3})
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resps []proto.Message
+	for i := 0; i < 3; i++ {
+		resps = append(resps, &longrunningpb.Operation{
+			Name:   "test-operation",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		})
+	}
+	server.TestDatabaseAdmin.SetResps(resps)
+
+	if err := db.Migrator().AutoMigrate(&singer{}, &album{}, &test{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 3; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, want := range []int{3, 3, 2} {
+		request := requests[i].(*databasepb.UpdateDatabaseDdlRequest)
+		if g, w := len(request.GetStatements()), want; g != w {
+			t.Fatalf("%d: statement count mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+	// The statements must be executed in the original order.
+	if g, w := requests[1].(*databasepb.UpdateDatabaseDdlRequest).GetStatements()[0],
+		`CREATE SEQUENCE IF NOT EXISTS albums_seq OPTIONS (sequence_kind = "bit_reversed_positive")`; g != w {
+		t.Fatalf("statement text mismatch\n Got: %s\nWant: %s", g, w)
+	}
+}
+
+func TestSplitDDLBatch(t *testing.T) {
+	statements := []string{"s1", "s2", "s3", "s4", "s5"}
+	for _, test := range []struct {
+		size int
+		want [][]string
+	}{
+		{1, [][]string{{"s1"}, {"s2"}, {"s3"}, {"s4"}, {"s5"}}},
+		{2, [][]string{{"s1", "s2"}, {"s3", "s4"}, {"s5"}}},
+		{5, [][]string{{"s1", "s2", "s3", "s4", "s5"}}},
+		{10, [][]string{{"s1", "s2", "s3", "s4", "s5"}}},
+	} {
+		if g, w := splitDDLBatch(statements, test.size), test.want; !reflect.DeepEqual(g, w) {
+			t.Errorf("%d: batches mismatch\n Got: %v\nWant: %v", test.size, g, w)
+		}
+	}
+	if g := splitDDLBatch(nil, 10); len(g) != 0 {
+		t.Errorf("batches mismatch\n Got: %v\nWant: []", g)
+	}
+}
+
+func TestMigrateCompositeForeignKey(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name:   "test-operation",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+	})
+
+	if err := db.Migrator().AutoMigrate(&tenantSinger{}, &tenantAlbum{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	request := requests[0].(*databasepb.UpdateDatabaseDdlRequest)
+	if g, w := len(request.GetStatements()), 2; g != w {
+		t.Fatalf("statement count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := request.GetStatements()[1],
+		"CREATE TABLE `tenant_albums` (`tenant_id` INT64,`id` INT64,`singer_id` INT64,"+
+			"CONSTRAINT `fk_tenant_albums_singer` FOREIGN KEY (`tenant_id`,`singer_id`) REFERENCES `tenant_singers`(`tenant_id`,`id`)) "+
+			"PRIMARY KEY (`tenant_id`,`id`)"; g != w {
+		t.Fatalf("create tenant_albums statement text mismatch\n Got: %s\nWant: %s", g, w)
+	}
+}
+
+func TestGetForeignKeys(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	sql := `SELECT FK.CONSTRAINT_NAME, FK.COLUMN_NAME, PK.TABLE_NAME, PK.COLUMN_NAME, RC.DELETE_RULE
+			FROM INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS RC
+			INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE FK
+				ON FK.CONSTRAINT_CATALOG = RC.CONSTRAINT_CATALOG
+				AND FK.CONSTRAINT_SCHEMA = RC.CONSTRAINT_SCHEMA
+				AND FK.CONSTRAINT_NAME = RC.CONSTRAINT_NAME
+			INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE PK
+				ON PK.CONSTRAINT_CATALOG = RC.UNIQUE_CONSTRAINT_CATALOG
+				AND PK.CONSTRAINT_SCHEMA = RC.UNIQUE_CONSTRAINT_SCHEMA
+				AND PK.CONSTRAINT_NAME = RC.UNIQUE_CONSTRAINT_NAME
+				AND PK.ORDINAL_POSITION = FK.POSITION_IN_UNIQUE_CONSTRAINT
+			WHERE FK.TABLE_SCHEMA = @p1 AND FK.TABLE_NAME = @p2
+			ORDER BY FK.CONSTRAINT_NAME, FK.ORDINAL_POSITION`
+	_ = putStringRowsResult(server, sql, []string{"CONSTRAINT_NAME", "COLUMN_NAME", "TABLE_NAME", "COLUMN_NAME", "DELETE_RULE"}, [][]string{
+		{"fk_tenant_albums_singer", "tenant_id", "tenant_singers", "tenant_id", "NO ACTION"},
+		{"fk_tenant_albums_singer", "singer_id", "tenant_singers", "id", "NO ACTION"},
+	})
+
+	foreignKeys, err := db.Migrator().(ConstraintMigrator).GetForeignKeys(&tenantAlbum{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ForeignKey{{
+		Name:              "fk_tenant_albums_singer",
+		Table:             "tenant_albums",
+		Columns:           []string{"tenant_id", "singer_id"},
+		ReferencedTable:   "tenant_singers",
+		ReferencedColumns: []string{"tenant_id", "id"},
+		OnDelete:          "NO ACTION",
+	}}
+	if g, w := foreignKeys, want; !reflect.DeepEqual(g, w) {
+		t.Fatalf("foreign keys mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestGetIndexes(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	sql := `SELECT I.INDEX_NAME, I.INDEX_TYPE = 'PRIMARY_KEY', I.IS_UNIQUE, IC.COLUMN_NAME
+			FROM INFORMATION_SCHEMA.INDEXES I
+			INNER JOIN INFORMATION_SCHEMA.INDEX_COLUMNS IC USING (TABLE_CATALOG, TABLE_SCHEMA, TABLE_NAME, INDEX_NAME)
+			WHERE I.TABLE_SCHEMA = @p1 AND I.TABLE_NAME = @p2 AND (@p3 OR NOT I.SPANNER_IS_MANAGED)
+			AND IC.ORDINAL_POSITION IS NOT NULL
+			ORDER BY I.INDEX_NAME, IC.ORDINAL_POSITION`
+	_ = putStringRowsResult(server, sql, []string{"INDEX_NAME", "IS_PRIMARY_KEY", "IS_UNIQUE", "COLUMN_NAME"}, [][]string{
+		{"PRIMARY_KEY", "true", "true", "id"},
+		{"idx_singers_full_name", "false", "true", "first_name"},
+		{"idx_singers_full_name", "false", "true", "last_name"},
+		{"idx_singers_deleted_at", "false", "false", "deleted_at"},
+	})
+
+	indexes, err := db.Migrator().GetIndexes(&singer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(indexes), 3; g != w {
+		t.Fatalf("index count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, want := range []struct {
+		name       string
+		columns    []string
+		primaryKey bool
+		unique     bool
+	}{
+		{"PRIMARY_KEY", []string{"id"}, true, true},
+		{"idx_singers_full_name", []string{"first_name", "last_name"}, false, true},
+		{"idx_singers_deleted_at", []string{"deleted_at"}, false, false},
+	} {
+		index := indexes[i]
+		if g, w := index.Table(), "singers"; g != w {
+			t.Fatalf("%d: table mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+		if g, w := index.Name(), want.name; g != w {
+			t.Fatalf("%d: name mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+		if g, w := index.Columns(), want.columns; !reflect.DeepEqual(g, w) {
+			t.Fatalf("%d: columns mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+		if g, _ := index.PrimaryKey(); g != want.primaryKey {
+			t.Fatalf("%d: primary key mismatch\n Got: %v\nWant: %v", i, g, want.primaryKey)
+		}
+		if g, _ := index.Unique(); g != want.unique {
+			t.Fatalf("%d: unique mismatch\n Got: %v\nWant: %v", i, g, want.unique)
+		}
+	}
+	req := getLastSqlRequest(server)
+	if req.Params.Fields["p3"].GetBoolValue() {
+		t.Fatal("managed indexes should not be included by default")
+	}
+
+	if _, err := db.Migrator().(IndexMigrator).GetIndexesWithOptions(&singer{}, IndexOptions{IncludeManaged: true}); err != nil {
+		t.Fatal(err)
+	}
+	req = getLastSqlRequest(server)
+	if !req.Params.Fields["p3"].GetBoolValue() {
+		t.Fatal("managed indexes should be included")
+	}
+}
+
+func TestSequences(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	query := `SELECT S.NAME,
+			(SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.SEQUENCE_OPTIONS O
+				WHERE O.SCHEMA = S.SCHEMA AND O.NAME = S.NAME AND O.OPTION_NAME = 'sequence_kind'),
+			(SELECT SAFE_CAST(OPTION_VALUE AS INT64) FROM INFORMATION_SCHEMA.SEQUENCE_OPTIONS O
+				WHERE O.SCHEMA = S.SCHEMA AND O.NAME = S.NAME AND O.OPTION_NAME = 'skip_range_min'),
+			(SELECT SAFE_CAST(OPTION_VALUE AS INT64) FROM INFORMATION_SCHEMA.SEQUENCE_OPTIONS O
+				WHERE O.SCHEMA = S.SCHEMA AND O.NAME = S.NAME AND O.OPTION_NAME = 'skip_range_max'),
+			(SELECT SAFE_CAST(OPTION_VALUE AS INT64) FROM INFORMATION_SCHEMA.SEQUENCE_OPTIONS O
+				WHERE O.SCHEMA = S.SCHEMA AND O.NAME = S.NAME AND O.OPTION_NAME = 'start_with_counter')
+		FROM INFORMATION_SCHEMA.SEQUENCES S
+		WHERE S.SCHEMA = @p1
+		ORDER BY S.NAME`
+	_ = putStringRowsResult(server, query, []string{"NAME", "KIND", "SKIP_RANGE_MIN", "SKIP_RANGE_MAX", "START_WITH_COUNTER"}, [][]string{
+		{"singers_seq", "bit_reversed_positive", "1", "1000", "50"},
+	})
+	_ = putCountStatementResult(server, "SELECT GET_INTERNAL_SEQUENCE_STATE(SEQUENCE `singers_seq`)", 100)
+	_ = putCountStatementResult(server, "SELECT count(*) FROM INFORMATION_SCHEMA.SEQUENCES WHERE SCHEMA = @p1 AND NAME = @p2", 1)
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name:   "test-operation",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+	})
+
+	m := db.Migrator().(SequenceMigrator)
+	defer m.(io.Closer).Close()
+	sequences, err := m.GetSequences()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Sequence{{
+		Name:             "singers_seq",
+		Kind:             "bit_reversed_positive",
+		SkipRangeMin:     sql.NullInt64{Int64: 1, Valid: true},
+		SkipRangeMax:     sql.NullInt64{Int64: 1000, Valid: true},
+		StartWithCounter: sql.NullInt64{Int64: 50, Valid: true},
+		Counter:          sql.NullInt64{Int64: 100, Valid: true},
+	}}
+	if g, w := sequences, want; !reflect.DeepEqual(g, w) {
+		t.Fatalf("sequences mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if !m.HasSequence("singers_seq") {
+		t.Fatal("missing sequence singers_seq")
+	}
+	if err := m.DropSequence("singers_seq"); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements()[0], "DROP SEQUENCE `singers_seq`"; g != w {
+		t.Fatalf("statement text mismatch\n Got: %s\nWant: %s", g, w)
+	}
+
+	// The counter is left NULL if the internal state of a sequence cannot be
+	// read.
+	_ = server.TestSpanner.PutStatementResult("SELECT GET_INTERNAL_SEQUENCE_STATE(SEQUENCE `singers_seq`)", &testutil.StatementResult{
+		Type: testutil.StatementResultError,
+		Err:  status.Error(codes.PermissionDenied, "permission denied"),
+	})
+	sequences, err = m.GetSequences()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(sequences), 1; g != w {
+		t.Fatalf("sequence count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if sequences[0].Counter.Valid {
+		t.Fatalf("counter mismatch\n Got: %v\nWant: NULL", sequences[0].Counter)
+	}
+}
+
+func TestSchemaObjects(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putStringRowsResult(server, `SELECT CS.CHANGE_STREAM_NAME, CS.ALL,
+			(SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.CHANGE_STREAM_OPTIONS O
+				WHERE O.CHANGE_STREAM_SCHEMA = CS.CHANGE_STREAM_SCHEMA AND O.CHANGE_STREAM_NAME = CS.CHANGE_STREAM_NAME
+				AND O.OPTION_NAME = 'retention_period'),
+			(SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.CHANGE_STREAM_OPTIONS O
+				WHERE O.CHANGE_STREAM_SCHEMA = CS.CHANGE_STREAM_SCHEMA AND O.CHANGE_STREAM_NAME = CS.CHANGE_STREAM_NAME
+				AND O.OPTION_NAME = 'value_capture_type')
+		FROM INFORMATION_SCHEMA.CHANGE_STREAMS CS
+		WHERE CS.CHANGE_STREAM_SCHEMA = @p1
+		ORDER BY CS.CHANGE_STREAM_NAME`,
+		[]string{"CHANGE_STREAM_NAME", "ALL", "RETENTION_PERIOD", "VALUE_CAPTURE_TYPE"},
+		[][]string{
+			{"all_changes", "true", "7d", "NEW_VALUES"},
+			{"singer_changes", "false", "1d", "OLD_AND_NEW_VALUES"},
+		})
+	_ = putStringRowsResult(server, `SELECT CHANGE_STREAM_NAME, TABLE_NAME
+		FROM INFORMATION_SCHEMA.CHANGE_STREAM_TABLES
+		WHERE CHANGE_STREAM_SCHEMA = @p1
+		ORDER BY CHANGE_STREAM_NAME, TABLE_NAME`,
+		[]string{"CHANGE_STREAM_NAME", "TABLE_NAME"},
+		[][]string{
+			{"singer_changes", "albums"},
+			{"singer_changes", "singers"},
+		})
+	_ = putStringRowsResult(server, `SELECT TABLE_NAME, VIEW_DEFINITION, SECURITY_TYPE
+		FROM INFORMATION_SCHEMA.VIEWS
+		WHERE TABLE_SCHEMA = @p1
+		ORDER BY TABLE_NAME`,
+		[]string{"TABLE_NAME", "VIEW_DEFINITION", "SECURITY_TYPE"},
+		[][]string{{"active_singers", "SELECT * FROM singers WHERE active", "INVOKER"}})
+	_ = putStringRowsResult(server, "SELECT ROLE_NAME, IS_SYSTEM FROM INFORMATION_SCHEMA.ROLES ORDER BY ROLE_NAME",
+		[]string{"ROLE_NAME", "IS_SYSTEM"},
+		[][]string{{"public", "true"}, {"reader", "false"}})
+
+	m := db.Migrator().(SchemaObjectMigrator)
+	defer m.(io.Closer).Close()
+	changeStreams, err := m.GetChangeStreams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChangeStreams := []ChangeStream{
+		{Name: "all_changes", All: true, RetentionPeriod: "7d", ValueCaptureType: "NEW_VALUES"},
+		{Name: "singer_changes", Tables: []string{"albums", "singers"}, RetentionPeriod: "1d", ValueCaptureType: "OLD_AND_NEW_VALUES"},
+	}
+	if g, w := changeStreams, wantChangeStreams; !reflect.DeepEqual(g, w) {
+		t.Fatalf("change streams mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	views, err := m.GetViews()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantViews := []View{{Name: "active_singers", Definition: "SELECT * FROM singers WHERE active", SecurityType: "INVOKER"}}
+	if g, w := views, wantViews; !reflect.DeepEqual(g, w) {
+		t.Fatalf("views mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	roles, err := m.GetRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRoles := []Role{{Name: "public", System: true}, {Name: "reader"}}
+	if g, w := roles, wantRoles; !reflect.DeepEqual(g, w) {
+		t.Fatalf("roles mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestDatabaseOptions(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putStringRowsResult(server, "SELECT OPTION_NAME, OPTION_VALUE FROM INFORMATION_SCHEMA.DATABASE_OPTIONS WHERE SCHEMA_NAME = @p1",
+		[]string{"OPTION_NAME", "OPTION_VALUE"},
+		[][]string{{"version_retention_period", "1h"}, {"default_sequence_kind", "bit_reversed_positive"}})
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name:   "test-operation",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+	})
+
+	m := db.Migrator().(DatabaseOptionsMigrator)
+	defer m.(io.Closer).Close()
+	options, err := m.GetDatabaseOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version_retention_period": "1h", "default_sequence_kind": "bit_reversed_positive"}
+	if g, w := options, want; !reflect.DeepEqual(g, w) {
+		t.Fatalf("options mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if err := m.SetDatabaseOption("version_retention_period", "7d"); err != nil {
+		t.Fatal(err)
+	}
+	// A dry-run migrator does not execute the statement.
+	dryRun := db.Session(&gorm.Session{DryRun: true}).Migrator().(DatabaseOptionsMigrator)
+	defer dryRun.(io.Closer).Close()
+	if err := dryRun.SetDatabaseOption("default_leader", nil); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements()[0], "ALTER DATABASE `d` SET OPTIONS (version_retention_period = '7d')"; g != w {
+		t.Fatalf("statement text mismatch\n Got: %s\nWant: %s", g, w)
+	}
+
+	if err := m.SetDatabaseOption("version_retention_period = '1d'), (x", "7d"); err == nil {
+		t.Fatal("missing expected error for invalid option name")
+	}
+	if err := m.SetDatabaseOption("version_retention_period", 1.5); err == nil {
+		t.Fatal("missing expected error for unsupported value type")
+	}
+}
+
+func TestDatabaseOptionLiteral(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, "NULL"},
+		{"us-east1", "'us-east1'"},
+		{`it's`, `'it\'s'`},
+		{true, "true"},
+		{int64(10), "10"},
+	} {
+		got, err := databaseOptionLiteral(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, w := got, test.want; g != w {
+			t.Errorf("literal mismatch\n Got: %v\nWant: %v", g, w)
+		}
+	}
+}
+
+func putStringRowsResult(server *testutil.MockedSpannerInMemTestServer, sql string, columns []string, rows [][]string) error {
+	fields := make([]*spannerpb.StructType_Field, len(columns))
+	for i, column := range columns {
+		fields[i] = &spannerpb.StructType_Field{Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, Name: column}
+	}
+	values := make([]*structpb.ListValue, len(rows))
+	for i, row := range rows {
+		values[i] = &structpb.ListValue{}
+		for _, v := range row {
+			values[i].Values = append(values[i].Values, structpb.NewStringValue(v))
+		}
+	}
+	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: fields}},
+			Rows:     values,
+		},
+	})
+}
+
 func putCountStatementResult(server *testutil.MockedSpannerInMemTestServer, sql string, count int) error {
 	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
 		Type: testutil.StatementResultResultSet,
@@ -323,11 +929,15 @@ func setupTestGormConnection(t *testing.T) (db *gorm.DB, server *testutil.Mocked
 }
 
 func setupTestGormConnectionWithParams(t *testing.T, params string) (db *gorm.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	return setupTestGormConnectionWithConfig(t, params, Config{})
+}
+
+func setupTestGormConnectionWithConfig(t *testing.T, params string, config Config) (db *gorm.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
 	server, _, serverTeardown := setupMockedTestServer(t)
-	db, err := gorm.Open(New(Config{
-		DriverName: "spanner",
-		DSN:        fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;%s", server.Address, params),
-	}), &gorm.Config{PrepareStmt: true})
+	config.DriverName = "spanner"
+	config.DSN = fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;%s", server.Address, params)
+	_ = putDialectResult(server, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+	db, err := gorm.Open(New(config), &gorm.Config{PrepareStmt: true})
 	if err != nil {
 		serverTeardown()
 		t.Fatal(err)
@@ -362,3 +972,329 @@ func setupMockedTestServerWithConfigAndClientOptions(t *testing.T, config spanne
 		serverTeardown()
 	}
 }
+
+func TestMigrateEpochColumn(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	hasColSql := "SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = @p1 AND table_name = @p2 AND column_name = @p3"
+	updateSql := "UPDATE `singers` SET `created_at` = TIMESTAMP_MILLIS(`created_millis`) WHERE `created_at` IS NULL AND `created_millis` IS NOT NULL"
+	_ = putCountStatementResult(server, hasColSql, 1)
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 10,
+	})
+	drainRequestsFromServer(server.TestSpanner)
+
+	m := db.Migrator().(DataMigrator)
+	if err := m.MigrateEpochColumn(&singerWithAutoTime{}, "CreatedAt", "created_millis", schema.UnixMillisecond); err != nil {
+		t.Fatal(err)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	beginRequests := requestsOfType(requests, reflect.TypeOf(&spannerpb.BeginTransactionRequest{}))
+	if g, w := len(beginRequests), 1; g != w {
+		t.Fatalf("begin request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if beginRequests[0].(*spannerpb.BeginTransactionRequest).Options.GetPartitionedDml() == nil {
+		t.Fatal("update was not executed as Partitioned DML")
+	}
+	executeRequests := requestsOfType(requests, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := executeRequests[len(executeRequests)-1].(*spannerpb.ExecuteSqlRequest).Sql, updateSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The column already existed, so no DDL statements should have been executed.
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	if err := m.MigrateEpochColumn(&singerWithAutoTime{}, "CreatedMillis", "created_millis", schema.UnixMillisecond); err == nil {
+		t.Fatal("missing expected error for non-TIMESTAMP field")
+	}
+}
+
+type auditedConcert struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP()" spannerGorm:"commit_timestamp"`
+}
+
+func TestMigrateCommitTimestampWithNotNullAndDefault(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name:   "test-operation",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+	})
+
+	m := db.Migrator()
+	if err := m.CreateTable(&auditedConcert{}); err != nil {
+		t.Fatal(err)
+	}
+	// ALTER COLUMN does not accept options together with a data type.
+	if err := m.AlterColumn(&auditedConcert{}, "CreatedAt"); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 2; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, want := range []string{
+		"CREATE TABLE `audited_concerts` (`id` INT64,`created_at` TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP()) " +
+			"OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY (`id`)",
+		"ALTER TABLE `audited_concerts` ALTER COLUMN `created_at` TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP())",
+	} {
+		if g, w := requests[i].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{want}; !reflect.DeepEqual(g, w) {
+			t.Fatalf("%d: statements mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+}
+
+func TestMigrateCommitTimestampOptions(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	// created_at exists without the option, updated_at exists with the
+	// option, and last_write does not exist yet.
+	_ = putStringRowsResult(server, "SELECT C.COLUMN_NAME, COALESCE(O.OPTION_VALUE, 'FALSE') "+
+		"FROM INFORMATION_SCHEMA.COLUMNS C "+
+		"LEFT JOIN INFORMATION_SCHEMA.COLUMN_OPTIONS O "+
+		"ON O.TABLE_SCHEMA = C.TABLE_SCHEMA AND O.TABLE_NAME = C.TABLE_NAME AND O.COLUMN_NAME = C.COLUMN_NAME "+
+		"AND O.OPTION_NAME = 'allow_commit_timestamp' "+
+		"WHERE C.TABLE_SCHEMA = @p1 AND C.TABLE_NAME = @p2 AND C.SPANNER_TYPE = 'TIMESTAMP'",
+		[]string{"COLUMN_NAME", "OPTION_VALUE"},
+		[][]string{{"created_at", "FALSE"}, {"updated_at", "TRUE"}, {"reviewed", "FALSE"}})
+
+	m := db.Migrator().(spannerMigrator)
+	defer m.Close()
+	if err := m.migrateCommitTimestampOptions(&auditedSinger{}); err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	for _, request := range server.TestDatabaseAdmin.Reqs() {
+		statements = append(statements, request.(*databasepb.UpdateDatabaseDdlRequest).GetStatements()...)
+	}
+	if g, w := statements, []string{"ALTER TABLE `audited_singers` ALTER COLUMN `created_at` SET OPTIONS (allow_commit_timestamp=true)"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigratorReleasesConnection(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Name:   "test-operation",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		},
+	})
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 0)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := db.Migrator().(SpannerMigrator)
+	if m.HasTable(&singer{}) {
+		t.Fatal("unexpected table found")
+	}
+	if g, w := sqlDB.Stats().InUse, 1; g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if err := m.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := sqlDB.Stats().InUse, 0; g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// AutoMigrate should automatically release the connection.
+	if err := m.AutoMigrate(&singer{}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := sqlDB.Stats().InUse, 0; g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigratorDoesNotAffectOtherQueries(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 1)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrators := make([]SpannerMigrator, 4)
+	var wg sync.WaitGroup
+	for i := range migrators {
+		migrators[i] = db.Migrator().(SpannerMigrator)
+		wg.Add(1)
+		go func(m SpannerMigrator) {
+			defer wg.Done()
+			if !m.HasTable(&singer{}) {
+				t.Error("table not found")
+			}
+		}(migrators[i])
+	}
+	wg.Wait()
+	// Each migrator should use its own connection.
+	if g, w := sqlDB.Stats().InUse, len(migrators); g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The connections of the migrators should not be used for other queries.
+	if _, ok := db.ConnPool.(*migratorConn); ok {
+		t.Fatal("migrator connection was set as the connection pool of the database")
+	}
+	if _, ok := db.Statement.ConnPool.(*migratorConn); ok {
+		t.Fatal("migrator connection was set as the connection pool of the statement")
+	}
+	for _, m := range migrators {
+		if err := m.(io.Closer).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, w := sqlDB.Stats().InUse, 0; g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestSynonyms(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resps []proto.Message
+	for i := 0; i < 3; i++ {
+		resps = append(resps, &longrunningpb.Operation{
+			Name:   "test-operation",
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: anyProto},
+		})
+	}
+	server.TestDatabaseAdmin.SetResps(resps)
+
+	m := db.Migrator().(SynonymMigrator)
+	defer m.(io.Closer).Close()
+	if err := m.CreateSynonym(&singer{}, "performers"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RenameTableWithSynonym("albums", "records"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DropSynonym("records", "albums"); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 3; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, want := range []string{
+		"ALTER TABLE `singers` ADD SYNONYM `performers`",
+		"ALTER TABLE `albums` RENAME TO `records`, ADD SYNONYM `albums`",
+		"ALTER TABLE `records` DROP SYNONYM `albums`",
+	} {
+		request := requests[i].(*databasepb.UpdateDatabaseDdlRequest)
+		if g, w := request.GetStatements()[0], want; g != w {
+			t.Fatalf("%d: statement text mismatch\n Got: %s\nWant: %s", i, g, w)
+		}
+	}
+}
+
+type typeAliasRecord struct {
+	ID      int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name    string
+	Code    string `gorm:"size:10"`
+	Data    []byte
+	Rating  float32
+	Score   float64
+	Active  bool
+	Created time.Time
+	Day     spanner.NullDate
+	Details spanner.NullJSON
+	Amount  spanner.NullNumeric
+	Tags    StringArray
+	Codes   StringArray `gorm:"type:ARRAY<STRING(10)>"`
+	Blobs   Array[[]byte]
+}
+
+func TestMigrateColumnTypeAliases(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&typeAliasRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	// The types are returned by ColumnTypes without the length of STRING and
+	// BYTES types, and must not be altered.
+	for _, test := range []struct {
+		field    string
+		dataType string
+		length   sql.NullInt64
+	}{
+		{"Name", "STRING", sql.NullInt64{}},
+		{"Code", "STRING", sql.NullInt64{Int64: 10, Valid: true}},
+		{"Data", "BYTES", sql.NullInt64{}},
+		{"Rating", "FLOAT32", sql.NullInt64{}},
+		{"Score", "FLOAT64", sql.NullInt64{}},
+		{"Active", "BOOL", sql.NullInt64{}},
+		{"Created", "TIMESTAMP", sql.NullInt64{}},
+		{"Day", "DATE", sql.NullInt64{}},
+		{"Details", "JSON", sql.NullInt64{}},
+		{"Amount", "NUMERIC", sql.NullInt64{}},
+		{"Tags", "ARRAY<STRING>", sql.NullInt64{}},
+		{"Codes", "ARRAY<STRING>", sql.NullInt64{}},
+		{"Blobs", "ARRAY<BYTES>", sql.NullInt64{}},
+	} {
+		field := stmt.Schema.LookUpField(test.field)
+		if err := db.Migrator().MigrateColumn(&typeAliasRecord{}, field, migrator.ColumnType{
+			NameValue:     sql.NullString{String: field.DBName, Valid: true},
+			DataTypeValue: sql.NullString{String: test.dataType, Valid: true},
+			LengthValue:   test.length,
+			NullableValue: sql.NullBool{Bool: true, Valid: true},
+			SQLColumnType: &sql.ColumnType{},
+		}); err != nil {
+			t.Fatalf("%s: %v", test.field, err)
+		}
+		if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+			t.Fatalf("%s: DDL request count mismatch\n Got: %v\nWant: %v", test.field, g, w)
+		}
+	}
+}
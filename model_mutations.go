@@ -0,0 +1,213 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// MutationOperation is the type of the mutations that MutationsFromModel
+// returns.
+type MutationOperation int
+
+const (
+	// MutationInsert inserts the rows. The mutation fails if a row already
+	// exists.
+	MutationInsert MutationOperation = iota
+	// MutationUpdate updates all columns of existing rows. The mutation fails
+	// if a row does not exist.
+	MutationUpdate
+	// MutationInsertOrUpdate inserts the rows, or updates the columns of the
+	// rows that already exist.
+	MutationInsertOrUpdate
+	// MutationReplace inserts the rows, or replaces the rows that already
+	// exist. Columns that are not in the model are set to NULL.
+	MutationReplace
+	// MutationDelete deletes the rows with the primary keys of the models.
+	MutationDelete
+)
+
+func (op MutationOperation) String() string {
+	switch op {
+	case MutationInsert:
+		return "insert"
+	case MutationUpdate:
+		return "update"
+	case MutationInsertOrUpdate:
+		return "insert_or_update"
+	case MutationReplace:
+		return "replace"
+	case MutationDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("MutationOperation(%d)", int(op))
+}
+
+// MutationsFromModel returns the mutations that write the given model, or
+// slice of models, to its table with the given operation. Use this to combine
+// mutations for gorm models with other mutations, and to apply them with the
+// Spanner client library or with WithSpannerConn. The mutations are not
+// written to the database.
+//
+// The mutations contain all columns of the model, also for MutationUpdate, so
+// columns with a zero value in the model are overwritten. The columns are
+// handled in the same way as by WithMutations:
+//   - Generated columns and read-only fields are not included.
+//   - Fields with a database default value are not included in inserts if
+//     the value is not set, so the default is applied.
+//   - Commit timestamp fields are set to the commit timestamp of the
+//     transaction. Fields with an autoCreateTime or autoUpdateTime tag that
+//     are not set are set to the current time, but the values are not set in
+//     the model.
+//
+// Delete mutations only contain the primary key of each model. An error is
+// returned if the primary key of a model is not set, or if a value cannot be
+// written as a mutation, such as a gorm.Expr.
+//
+// Example:
+//
+//	mutations, err := spannergorm.MutationsFromModel(db, spannergorm.MutationInsert, &singers)
+//	if err != nil {
+//	  return err
+//	}
+//	mutations = append(mutations, spanner.Delete("pending_singers", spanner.AllKeys()))
+//	_, err = client.Apply(ctx, mutations)
+func MutationsFromModel(db *gorm.DB, op MutationOperation, value interface{}) ([]*spanner.Mutation, error) {
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return nil, err
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	stmt := &gorm.Statement{DB: db, Context: ctx}
+	if err := stmt.Parse(value); err != nil {
+		return nil, err
+	}
+	table := qualifiedTableName(stmt)
+
+	var rows []reflect.Value
+	switch rv := reflect.Indirect(reflect.ValueOf(value)); rv.Kind() {
+	case reflect.Struct:
+		rows = append(rows, rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			rows = append(rows, reflect.Indirect(rv.Index(i)))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported model type: %T", value)
+	}
+
+	now := time.Now()
+	mutations := make([]*spanner.Mutation, 0, len(rows))
+	for _, row := range rows {
+		if op == MutationDelete {
+			key, ok := primaryKeyValues(stmt, row)
+			if !ok {
+				return nil, fmt.Errorf("the primary key of a row in %s is not set", table)
+			}
+			mutations = append(mutations, spanner.Delete(table, spanner.Key(key)))
+			continue
+		}
+		columns, values, err := dialector.mutationColumns(stmt, op, row, now)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case MutationInsert:
+			mutations = append(mutations, spanner.Insert(table, columns, values))
+		case MutationUpdate:
+			mutations = append(mutations, spanner.Update(table, columns, values))
+		case MutationInsertOrUpdate:
+			mutations = append(mutations, spanner.InsertOrUpdate(table, columns, values))
+		case MutationReplace:
+			mutations = append(mutations, spanner.Replace(table, columns, values))
+		default:
+			return nil, fmt.Errorf("unsupported mutation operation: %v", op)
+		}
+	}
+	return mutations, nil
+}
+
+// mutationColumns returns the columns and values of the given row that are
+// written by a mutation with the given operation.
+func (dialector Dialector) mutationColumns(stmt *gorm.Statement, op MutationOperation, row reflect.Value, now time.Time) ([]string, []interface{}, error) {
+	columns := make([]string, 0, len(stmt.Schema.DBNames))
+	values := make([]interface{}, 0, len(stmt.Schema.DBNames))
+	for _, name := range stmt.Schema.DBNames {
+		field := stmt.Schema.FieldsByDBName[name]
+		if isGeneratedField(field) || isReadOnlyGeneratedField(field) {
+			continue
+		}
+		if !field.PrimaryKey && ((op == MutationUpdate && !field.Updatable) || (op != MutationUpdate && !field.Creatable)) {
+			continue
+		}
+		if op == MutationUpdate && dialector.isCommitTimestampField(field) && !dialector.isCommitTimestampOnUpdate(field) {
+			// Fields that are only set when a row is created keep their value.
+			continue
+		}
+		if (op == MutationUpdate && dialector.isCommitTimestampOnUpdate(field)) ||
+			(op != MutationUpdate && dialector.isCommitTimestampField(field)) {
+			columns = append(columns, name)
+			values = append(values, spanner.CommitTimestamp)
+			continue
+		}
+		value, zero := field.ValueOf(stmt.Context, row)
+		if zero {
+			if field.HasDefaultValue && field.DefaultValueInterface == nil && op != MutationUpdate {
+				continue
+			}
+			if op == MutationUpdate && field.AutoCreateTime > 0 && field.AutoUpdateTime == 0 {
+				continue
+			}
+			if field.AutoUpdateTime > 0 || (field.AutoCreateTime > 0 && op != MutationUpdate) {
+				value = autoTimeValue(field, now)
+			}
+		}
+		v, ok := mutationValue(value)
+		if !ok {
+			return nil, nil, fmt.Errorf("the value of %s.%s cannot be written as a mutation: %T", stmt.Table, name, value)
+		}
+		columns = append(columns, name)
+		values = append(values, v)
+	}
+	return columns, values, nil
+}
+
+// autoTimeValue returns the value of an autoCreateTime or autoUpdateTime field
+// for the given time.
+func autoTimeValue(field *schema.Field, now time.Time) interface{} {
+	unit := field.AutoUpdateTime
+	if unit == 0 {
+		unit = field.AutoCreateTime
+	}
+	switch {
+	case field.DataType == schema.Time:
+		return now
+	case unit == schema.UnixNanosecond:
+		return now.UnixNano()
+	case unit == schema.UnixMillisecond:
+		return now.UnixMilli()
+	}
+	return now.Unix()
+}
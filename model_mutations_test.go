@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type singerWithGeneratedName struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	FullName  string `gorm:"->;type:STRING(MAX) AS (UPPER(name)) STORED"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type lowerName string
+
+func (n lowerName) GormValue(context.Context, *gorm.DB) clause.Expr {
+	return clause.Expr{SQL: "LOWER(?)", Vars: []interface{}{string(n)}}
+}
+
+type singerWithLowerName struct {
+	ID   int64
+	Name lowerName
+}
+
+func TestMutationsFromModel(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	singers := []singerWithCommitTimestamp{{ID: 1, FirstName: "First"}, {ID: 2, FirstName: "Second"}}
+	inserts, err := MutationsFromModel(db, MutationInsert, &singers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates, err := MutationsFromModel(db, MutationUpdate, &singerWithGeneratedName{ID: 3, Name: "Third"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deletes, err := MutationsFromModel(db, MutationDelete, &singerWithCommitTimestamp{ID: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainRequestsFromServer(server.TestSpanner)
+	if err := WithSpannerConn(db, func(conn spannerdriver.SpannerConn) error {
+		mutations := append(append(inserts, updates...), deletes...)
+		_, err := conn.Apply(context.Background(), mutations)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	mutations := commitReqs[0].(*spannerpb.CommitRequest).Mutations
+	if g, w := len(mutations), 4; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	insert := mutations[0].GetInsert()
+	if insert == nil {
+		t.Fatalf("mutation type mismatch\n Got: %v\nWant: insert", mutations[0])
+	}
+	if g, w := insert.Columns, []string{"id", "first_name", "last_name", "last_updated", "rating"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("columns mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := insert.Values[0].Values[3].GetStringValue(), "spanner.commit_timestamp()"; g != w {
+		t.Fatalf("commit timestamp mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The generated column and the zero CreatedAt are not included in an
+	// update, and UpdatedAt is set to the current time.
+	update := mutations[2].GetUpdate()
+	if update == nil {
+		t.Fatalf("mutation type mismatch\n Got: %v\nWant: update", mutations[2])
+	}
+	if g, w := update.Columns, []string{"id", "name", "updated_at"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("columns mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g := update.Values[0].Values[2].GetStringValue(); g == "" || g == "0001-01-01T00:00:00Z" {
+		t.Fatalf("updated_at is not set: %q", g)
+	}
+	if g, w := len(mutations[3].GetDelete().GetKeySet().GetKeys()), 1; g != w {
+		t.Fatalf("key count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMutationsFromModelErrors(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	if _, err := MutationsFromModel(db, MutationDelete, &singerWithCommitTimestamp{}); err == nil {
+		t.Fatal("missing error for delete without a primary key")
+	}
+	if _, err := MutationsFromModel(db, MutationInsert, &singerWithLowerName{ID: 1, Name: "Name"}); err == nil {
+		t.Fatal("missing error for SQL expression")
+	}
+	if _, err := MutationsFromModel(db, MutationInsert, 1); err == nil {
+		t.Fatal("missing error for unsupported model")
+	}
+}
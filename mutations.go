@@ -0,0 +1,337 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	mutationsKey     = "gorm:spanner:mutations"
+	mutationCountKey = "gorm:spanner:mutation_count"
+)
+
+// WithMutations returns a gorm database that writes simple Create, Update and
+// Delete operations as Spanner mutations instead of DML statements. Mutations
+// are more efficient than DML statements, especially for bulk inserts. The
+// mutations are buffered in the transaction and sent to Spanner when the
+// transaction is committed. Operations outside a transaction are applied
+// directly.
+//
+// Operations that cannot be expressed as mutations are executed as DML
+// statements. These are:
+//   - Create with a RETURNING or ON CONFLICT clause, and Create for models
+//     with database-generated values that are not set, such as primary keys
+//     that are generated by a sequence, or with generated columns.
+//   - Update and Delete with a Where condition, and Update and Delete of rows
+//     whose primary key is not set. Update is only written as a mutation for
+//     a single row.
+//   - Update and Delete of models with soft delete, unless Unscoped is used.
+//   - Operations with SQL expressions as values, such as gorm.Expr.
+//
+// Note that mutations are not executed until the transaction is committed.
+// An Update mutation for a row that does not exist therefore causes the
+// commit to fail, instead of updating zero rows, and the number of affected
+// rows is the number of mutations.
+//
+// Example:
+//
+//	err := spannergorm.WithMutations(db).CreateInBatches(&singers, 1000).Error
+func WithMutations(db *gorm.DB) *gorm.DB {
+	return db.Set(mutationsKey, true)
+}
+
+// registerMutationCallbacks replaces the gorm:create, gorm:update and
+// gorm:delete callbacks with callbacks that write the operation as mutations
+// if WithMutations has been used, and that otherwise call the original
+// callback.
+func (dialector Dialector) registerMutationCallbacks(db *gorm.DB) error {
+	create := db.Callback().Create().Get("gorm:create")
+	if err := db.Callback().Create().Replace("gorm:create", func(db *gorm.DB) {
+		if !useMutations(db) || !dialector.createWithMutations(db) {
+			create(db)
+		}
+	}); err != nil {
+		return err
+	}
+	update := db.Callback().Update().Get("gorm:update")
+	if err := db.Callback().Update().Replace("gorm:update", func(db *gorm.DB) {
+		if !useMutations(db) || !dialector.updateWithMutations(db) {
+			update(db)
+		}
+	}); err != nil {
+		return err
+	}
+	deleteCallback := db.Callback().Delete().Get("gorm:delete")
+	return db.Callback().Delete().Replace("gorm:delete", func(db *gorm.DB) {
+		if !useMutations(db) || !dialector.deleteWithMutations(db) {
+			deleteCallback(db)
+		}
+	})
+}
+
+func useMutations(db *gorm.DB) bool {
+	if db.Error != nil || db.DryRun || db.Statement.Schema == nil || db.Statement.SQL.Len() > 0 {
+		return false
+	}
+	value, ok := db.Get(mutationsKey)
+	if !ok || value != true {
+		return false
+	}
+	_, returning := db.Statement.Clauses[clause.Returning{}.Name()]
+	return !returning
+}
+
+// createWithMutations writes the rows of a Create operation as Insert
+// mutations. It returns false if the operation cannot be written as mutations.
+func (dialector Dialector) createWithMutations(db *gorm.DB) bool {
+	stmt := db.Statement
+	if _, ok := stmt.Clauses[clause.OnConflict{}.Name()]; ok {
+		return false
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array:
+	default:
+		return false
+	}
+	values := callbacks.ConvertToCreateValues(stmt)
+	if db.Error != nil {
+		return true
+	}
+	columns := make([]string, len(values.Columns))
+	fields := make([]*schema.Field, len(values.Columns))
+	for i, column := range values.Columns {
+		columns[i] = column.Name
+		fields[i] = stmt.Schema.LookUpField(column.Name)
+	}
+	// Values that are generated by the database must be returned by a DML
+	// statement.
+	for _, field := range stmt.Schema.FieldsWithDefaultDBValue {
+		if !containsString(columns, field.DBName) {
+			return false
+		}
+	}
+	mutations := make([]*spanner.Mutation, 0, len(values.Values))
+	for _, row := range values.Values {
+		mutationRow := make([]interface{}, len(row))
+		for i, value := range row {
+			if dialector.isCommitTimestampField(fields[i]) {
+				mutationRow[i] = spanner.CommitTimestamp
+				continue
+			}
+			v, ok := mutationValue(value)
+			if !ok {
+				return false
+			}
+			mutationRow[i] = v
+		}
+		mutations = append(mutations, spanner.Insert(qualifiedTableName(stmt), columns, mutationRow))
+	}
+	dialector.writeMutations(db, "insert", mutations)
+	return true
+}
+
+// updateWithMutations writes an Update operation for a single row as an
+// Update mutation. It returns false if the operation cannot be written as a
+// mutation.
+func (dialector Dialector) updateWithMutations(db *gorm.DB) bool {
+	stmt := db.Statement
+	if _, ok := stmt.Clauses[clause.Where{}.Name()]; ok {
+		return false
+	}
+	if _, ok := stmt.Clauses[clause.Set{}.Name()]; ok {
+		return false
+	}
+	if !stmt.Unscoped && len(stmt.Schema.UpdateClauses) > 0 {
+		return false
+	}
+	if stmt.ReflectValue.Kind() != reflect.Struct {
+		return false
+	}
+	key, ok := primaryKeyValues(stmt, stmt.ReflectValue)
+	if !ok {
+		return false
+	}
+	set := callbacks.ConvertToAssignments(stmt)
+	if db.Error != nil {
+		return true
+	}
+	// An update without assignments is skipped by the DML callback of gorm.
+	if len(set) == 0 {
+		return false
+	}
+	// Add the assignments to the statement, so they are not calculated again
+	// if the update falls back to DML.
+	stmt.AddClause(set)
+	columns := make([]string, 0, len(stmt.Schema.PrimaryFields)+len(set))
+	values := make([]interface{}, 0, cap(columns))
+	for i, field := range stmt.Schema.PrimaryFields {
+		columns = append(columns, field.DBName)
+		values = append(values, key[i])
+	}
+	for _, assignment := range set {
+		field := stmt.Schema.LookUpField(assignment.Column.Name)
+		if field != nil && field.PrimaryKey {
+			continue
+		}
+		var value interface{}
+		if dialector.isCommitTimestampOnUpdate(field) {
+			value = spanner.CommitTimestamp
+		} else if value, ok = mutationValue(assignment.Value); !ok {
+			return false
+		}
+		columns = append(columns, assignment.Column.Name)
+		values = append(values, value)
+	}
+	dialector.writeMutations(db, "update", []*spanner.Mutation{spanner.Update(qualifiedTableName(stmt), columns, values)})
+	return true
+}
+
+// deleteWithMutations writes a Delete operation as Delete mutations. It
+// returns false if the operation cannot be written as mutations.
+func (dialector Dialector) deleteWithMutations(db *gorm.DB) bool {
+	stmt := db.Statement
+	if _, ok := stmt.Clauses[clause.Where{}.Name()]; ok {
+		return false
+	}
+	if !stmt.Unscoped && len(stmt.Schema.DeleteClauses) > 0 {
+		return false
+	}
+	var rows []reflect.Value
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct:
+		rows = append(rows, stmt.ReflectValue)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			rows = append(rows, reflect.Indirect(stmt.ReflectValue.Index(i)))
+		}
+	default:
+		return false
+	}
+	if len(rows) == 0 {
+		return false
+	}
+	mutations := make([]*spanner.Mutation, len(rows))
+	for i, row := range rows {
+		key, ok := primaryKeyValues(stmt, row)
+		if !ok {
+			return false
+		}
+		mutations[i] = spanner.Delete(qualifiedTableName(stmt), spanner.Key(key))
+	}
+	dialector.writeMutations(db, "delete", mutations)
+	return true
+}
+
+// primaryKeyValues returns the primary key values of the given row, and false
+// if a primary key value is not set or not supported.
+func primaryKeyValues(stmt *gorm.Statement, row reflect.Value) ([]interface{}, bool) {
+	if len(stmt.Schema.PrimaryFields) == 0 || row.Kind() != reflect.Struct {
+		return nil, false
+	}
+	key := make([]interface{}, len(stmt.Schema.PrimaryFields))
+	for i, field := range stmt.Schema.PrimaryFields {
+		value, zero := field.ValueOf(stmt.Context, row)
+		if zero {
+			return nil, false
+		}
+		v, ok := mutationValue(value)
+		if !ok {
+			return nil, false
+		}
+		key[i] = v
+	}
+	return key, true
+}
+
+// writeMutations buffers the mutations in the current transaction, or applies
+// them directly if the statement is not executed in a transaction. Mutations
+// that are applied directly are committed with the transaction tag of the
+// given operation.
+func (dialector Dialector) writeMutations(db *gorm.DB, operation string, mutations []*spanner.Mutation) {
+	_, inTransaction := unwrapConnPool(db.Statement.ConnPool).(gorm.TxCommitter)
+	if err := WithSpannerConn(db, func(conn spannerdriver.SpannerConn) error {
+		if inTransaction {
+			return conn.BufferWrite(mutations)
+		}
+		var options []spanner.ApplyOption
+		if tag := dialector.transactionTag(db.Statement.Context, operation, db.Statement.Table); tag != "" {
+			options = append(options, spanner.TransactionTag(tag))
+		}
+		_, err := conn.Apply(db.Statement.Context, mutations, options...)
+		return err
+	}); err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	db.RowsAffected = int64(len(mutations))
+	db.InstanceSet(mutationCountKey, len(mutations))
+}
+
+// MutationCount returns the number of mutations that the current operation of
+// the given gorm database has written with WithMutations, or zero if the
+// operation was executed as a DML statement. Use this in a callback that is
+// registered after the gorm:create, gorm:update or gorm:delete callback.
+func MutationCount(db *gorm.DB) int {
+	count, _ := db.InstanceGet(mutationCountKey)
+	n, _ := count.(int)
+	return n
+}
+
+// mutationValue converts a value of a model to a value that can be used in a
+// mutation. It returns false for values that can only be used in a DML
+// statement, such as SQL expressions.
+func mutationValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case CommitTimestamp:
+		return spanner.CommitTimestamp, true
+	case clause.Expression, gorm.Valuer:
+		return nil, false
+	case driver.Valuer:
+		// The types of the Spanner client library are supported by mutations.
+		if strings.HasPrefix(reflect.Indirect(reflect.ValueOf(v)).Type().PkgPath(), "cloud.google.com/go/spanner") {
+			return v, true
+		}
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil, true
+		}
+		converted, err := v.Value()
+		if err != nil {
+			return nil, false
+		}
+		return converted, true
+	}
+	return value, true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+func TestWithMutations(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	commitMutations := func() []*spannerpb.Mutation {
+		reqs := drainRequestsFromServer(server.TestSpanner)
+		for _, req := range requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+			t.Fatalf("unexpected statement: %s", req.(*spannerpb.ExecuteSqlRequest).Sql)
+		}
+		commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+		if g, w := len(commitReqs), 1; g != w {
+			t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		return commitReqs[0].(*spannerpb.CommitRequest).Mutations
+	}
+
+	drainRequestsFromServer(server.TestSpanner)
+	singers := []singerWithCommitTimestamp{{ID: 1, FirstName: "First"}, {ID: 2, FirstName: "Second"}}
+	res := WithMutations(db).Create(&singers)
+	if res.Error != nil {
+		t.Fatalf("failed to create singers: %v", res.Error)
+	}
+	if g, w := res.RowsAffected, int64(2); g != w {
+		t.Fatalf("rows affected mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	mutations := commitMutations()
+	if g, w := len(mutations), 2; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	insert := mutations[0].GetInsert()
+	if insert == nil {
+		t.Fatalf("mutation type mismatch\n Got: %v\nWant: insert", mutations[0])
+	}
+	if g, w := insert.Columns, []string{"first_name", "last_name", "last_updated", "rating", "id"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("columns mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := insert.Values[0].Values[2].GetStringValue(), "spanner.commit_timestamp()"; g != w {
+		t.Fatalf("commit timestamp mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	if err := WithMutations(db).Model(&singerWithCommitTimestamp{ID: 1}).Update("last_name", "Last").Error; err != nil {
+		t.Fatalf("failed to update singer: %v", err)
+	}
+	mutations = commitMutations()
+	update := mutations[0].GetUpdate()
+	if update == nil {
+		t.Fatalf("mutation type mismatch\n Got: %v\nWant: update", mutations[0])
+	}
+	if g, w := update.Columns, []string{"id", "last_name"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("columns mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	if err := WithMutations(db).Delete(&singers).Error; err != nil {
+		t.Fatalf("failed to delete singers: %v", err)
+	}
+	mutations = commitMutations()
+	if g, w := len(mutations), 2; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(mutations[1].GetDelete().GetKeySet().GetKeys()), 1; g != w {
+		t.Fatalf("key count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWithMutationsOutsideTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	drainRequestsFromServer(server.TestSpanner)
+	tx := WithMutations(db.Session(&gorm.Session{SkipDefaultTransaction: true}))
+	if err := tx.Delete(&singerWithCommitTimestamp{ID: 1}).Error; err != nil {
+		t.Fatalf("failed to delete singer: %v", err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(commitReqs[0].(*spannerpb.CommitRequest).Mutations), 1; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWithMutationsFallsBackToDml(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	deleteSql := "DELETE FROM `singers` WHERE last_name = @p1"
+	_ = server.TestSpanner.PutStatementResult(deleteSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 3,
+	})
+	drainRequestsFromServer(server.TestSpanner)
+	res := WithMutations(db).Where("last_name = ?", "Last").Delete(&singerWithCommitTimestamp{})
+	if res.Error != nil {
+		t.Fatalf("failed to delete singers: %v", res.Error)
+	}
+	if g, w := res.RowsAffected, int64(3); g != w {
+		t.Fatalf("rows affected mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	executeReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(executeReqs), 1; g != w {
+		t.Fatalf("execute request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := executeReqs[0].(*spannerpb.ExecuteSqlRequest).Sql, deleteSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs[0].(*spannerpb.CommitRequest).Mutations), 0; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWithMutationsUpdateWithoutAssignments(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	type singerWithoutUpdateTime struct {
+		ID       int64
+		LastName string
+	}
+	drainRequestsFromServer(server.TestSpanner)
+	// An update without assignments is a no-op, both with mutations and with
+	// the DML fallback.
+	res := WithMutations(db.Table("singers")).Model(&singerWithoutUpdateTime{ID: 1}).Updates(&singerWithoutUpdateTime{})
+	if res.Error != nil {
+		t.Fatalf("failed to update singer: %v", res.Error)
+	}
+	if g, w := res.RowsAffected, int64(0); g != w {
+		t.Fatalf("rows affected mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	for _, req := range requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		t.Fatalf("unexpected statement: %s", req.(*spannerpb.ExecuteSqlRequest).Sql)
+	}
+	for _, req := range requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{})) {
+		if g, w := len(req.(*spannerpb.CommitRequest).Mutations), 0; g != w {
+			t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+		}
+	}
+}
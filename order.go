@@ -0,0 +1,79 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NullOrdering is an ORDER BY column with an explicit position for NULL
+// values. Use OrderByNullsFirst or OrderByNullsLast to create a NullOrdering.
+//
+// Spanner sorts NULL values before all other values in ascending order, and
+// after all other values in descending order. Other databases, such as
+// PostgreSQL, use the opposite order. Queries that are ported from such a
+// database, for example for keyset pagination, should therefore set the
+// position of NULL values explicitly.
+type NullOrdering struct {
+	Column     string
+	Desc       bool
+	NullsFirst bool
+}
+
+// OrderByNullsFirst orders the result of a query by the given column with
+// NULL values before all other values.
+//
+// Example:
+//
+//	db.Clauses(spannergorm.OrderByNullsFirst("last_name", true)).Find(&singers)
+//	// SELECT * FROM `singers` ORDER BY `last_name` DESC NULLS FIRST
+func OrderByNullsFirst(column string, desc bool) NullOrdering {
+	return NullOrdering{Column: column, Desc: desc, NullsFirst: true}
+}
+
+// OrderByNullsLast orders the result of a query by the given column with
+// NULL values after all other values.
+//
+// Example:
+//
+//	db.Clauses(spannergorm.OrderByNullsLast("last_name", false)).Find(&singers)
+//	// SELECT * FROM `singers` ORDER BY `last_name` ASC NULLS LAST
+func OrderByNullsLast(column string, desc bool) NullOrdering {
+	return NullOrdering{Column: column, Desc: desc}
+}
+
+// ModifyStatement implements gorm.StatementModifier. The column is added
+// after the columns that have already been added with Order.
+func (ordering NullOrdering) ModifyStatement(stmt *gorm.Statement) {
+	sql := stmt.Quote(ordering.Column)
+	if ordering.Desc {
+		sql += " DESC"
+	} else {
+		sql += " ASC"
+	}
+	if ordering.NullsFirst {
+		sql += " NULLS FIRST"
+	} else {
+		sql += " NULLS LAST"
+	}
+	stmt.AddClause(clause.OrderBy{
+		Columns: []clause.OrderByColumn{{Column: clause.Column{Name: sql, Raw: true}}},
+	})
+}
+
+// Build implements clause.Expression. The clause is added to the statement by
+// ModifyStatement, so Build does not write anything.
+func (ordering NullOrdering) Build(clause.Builder) {}
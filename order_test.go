@@ -0,0 +1,36 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestOrderByNulls(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	var singers []singer
+	stmt := db.Session(&gorm.Session{DryRun: true}).
+		Order("first_name").
+		Clauses(OrderByNullsLast("last_name", false), OrderByNullsFirst("singers.rating", true)).
+		Order("id").
+		Find(&singers).Statement
+	if g, w := stmt.SQL.String(), "SELECT * FROM `singers` WHERE `singers`.`deleted_at` IS NULL ORDER BY first_name,`last_name` ASC NULLS LAST,`singers`.`rating` DESC NULLS FIRST,id"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
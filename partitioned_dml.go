@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+)
+
+const partitionedDMLKey = "gorm:spanner:partitioned_dml"
+
+// PartitionedDMLInTransactionError is returned when an Update or Delete
+// operation that should be executed as Partitioned DML is executed in a
+// transaction. Partitioned DML statements are executed in their own
+// transactions by Spanner, and cannot be part of another transaction.
+type PartitionedDMLInTransactionError struct {
+	// Table is the table of the operation, if known.
+	Table string
+}
+
+func (e *PartitionedDMLInTransactionError) Error() string {
+	if e.Table == "" {
+		return "Partitioned DML cannot be executed in a transaction"
+	}
+	return fmt.Sprintf("Partitioned DML on table %s cannot be executed in a transaction", e.Table)
+}
+
+// PartitionedDML returns a gorm database that executes Update and Delete
+// operations as Partitioned DML statements. Partitioned DML is intended for
+// large updates and deletes, such as deleting all rows that are older than a
+// given date, that would exceed the mutation limit of a single transaction.
+// Spanner partitions the key space of the table and executes the statement on
+// each partition in a separate transaction.
+//
+// Partitioned DML statements are not atomic, and the statement may be applied
+// more than once to some rows. The statement must therefore be idempotent.
+// The number of affected rows is a lower bound of the number of rows that
+// were modified. Partitioned DML cannot be used in a transaction. Update and
+// Delete operations that are executed in a transaction return a
+// *PartitionedDMLInTransactionError. Other operations are not affected.
+//
+// The statement is executed on a connection that is taken from the pool for
+// the duration of the operation, and that is reset to transactional DML
+// before it is returned to the pool.
+//
+// Example:
+//
+//	err := spannergorm.PartitionedDML(db).Where("created_at < ?", cutoff).Delete(&Event{}).Error
+func PartitionedDML(db *gorm.DB) *gorm.DB {
+	return db.Set(partitionedDMLKey, true)
+}
+
+func usePartitionedDML(db *gorm.DB) bool {
+	value, ok := db.Get(partitionedDMLKey)
+	return ok && value == true
+}
+
+// partitionedDMLConn is the connection pool of an operation that is executed
+// as Partitioned DML. It only exposes the methods of gorm.ConnPool, so gorm
+// does not start a default transaction on the connection.
+type partitionedDMLConn struct {
+	gorm.ConnPool
+	conn *sql.Conn
+	pool gorm.ConnPool
+}
+
+// registerPartitionedDMLCallbacks registers the callbacks that execute Update
+// and Delete operations as Partitioned DML if PartitionedDML has been used.
+func registerPartitionedDMLCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Update().Before("*").Register("gorm:spanner:partitioned_dml", beginPartitionedDML); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("*").Register("gorm:spanner:partitioned_dml_end", endPartitionedDML); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("*").Register("gorm:spanner:partitioned_dml", beginPartitionedDML); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("*").Register("gorm:spanner:partitioned_dml_end", endPartitionedDML)
+}
+
+// beginPartitionedDML takes a connection from the pool, sets the autocommit
+// DML mode of the connection to Partitioned DML, and uses the connection for
+// the operation.
+func beginPartitionedDML(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || !usePartitionedDML(db) {
+		return
+	}
+	switch unwrapConnPool(db.Statement.ConnPool).(type) {
+	case *connTx, *sql.Tx:
+		db.AddError(&PartitionedDMLInTransactionError{Table: db.Statement.Table})
+		return
+	}
+	conn, err := partitionedDMLConnOf(db)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.Statement.ConnPool = &partitionedDMLConn{ConnPool: conn, conn: conn, pool: db.Statement.ConnPool}
+}
+
+// endPartitionedDML resets the autocommit DML mode of the connection of an
+// operation that was executed as Partitioned DML, and returns the connection
+// to the pool.
+func endPartitionedDML(db *gorm.DB) {
+	p, ok := db.Statement.ConnPool.(*partitionedDMLConn)
+	if !ok {
+		return
+	}
+	db.Statement.ConnPool = p.pool
+	if err := releasePartitionedDMLConn(p.conn); err != nil {
+		db.AddError(err)
+	}
+}
+
+// execPartitionedDML executes the given statement as Partitioned DML on a
+// connection that is taken from the pool for the duration of the statement.
+func execPartitionedDML(db *gorm.DB, sql string, values ...interface{}) error {
+	conn, err := partitionedDMLConnOf(db)
+	if err != nil {
+		return err
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Setting a context clones the statement, so the connection pool of db is
+	// not changed.
+	tx := db.Session(&gorm.Session{Context: ctx})
+	tx.Statement.ConnPool = conn
+	err = tx.Exec(sql, values...).Error
+	return errors.Join(err, releasePartitionedDMLConn(conn))
+}
+
+// partitionedDMLConnOf takes a connection from the pool of the given gorm
+// database, and sets the autocommit DML mode of the connection to Partitioned
+// DML.
+func partitionedDMLConnOf(db *gorm.DB) (*sql.Conn, error) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	pool, err := sqlDB(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := withSpannerConn(conn, func(spannerConn spannerdriver.SpannerConn) error {
+		return spannerConn.SetAutocommitDMLMode(spannerdriver.PartitionedNonAtomic)
+	}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// releasePartitionedDMLConn resets the autocommit DML mode of the given
+// connection to transactional DML, and returns the connection to the pool.
+// The connection is discarded if the mode cannot be reset.
+func releasePartitionedDMLConn(conn *sql.Conn) error {
+	var resetErr error
+	_ = withSpannerConn(conn, func(spannerConn spannerdriver.SpannerConn) error {
+		if resetErr = spannerConn.SetAutocommitDMLMode(spannerdriver.Transactional); resetErr != nil {
+			// Discard the connection instead of returning it to the pool
+			// with the wrong autocommit DML mode.
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	return errors.Join(resetErr, conn.Close())
+}
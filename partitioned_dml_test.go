@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+func TestPartitionedDML(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	deleteSql := "DELETE FROM `singers` WHERE last_name = @p1"
+	_ = server.TestSpanner.PutStatementResult(deleteSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 100,
+	})
+	res := PartitionedDML(db).Unscoped().Where("last_name = ?", "Doe").Delete(&singer{})
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if g, w := res.RowsAffected, int64(100); g != w {
+		t.Fatalf("rows affected mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	beginReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.BeginTransactionRequest{}))
+	if g, w := len(beginReqs), 1; g != w {
+		t.Fatalf("begin request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if beginReqs[0].(*spannerpb.BeginTransactionRequest).GetOptions().GetPartitionedDml() == nil {
+		t.Fatalf("transaction is not a Partitioned DML transaction: %v", beginReqs[0])
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 0; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The connection is reset to transactional DML when it is returned to the
+	// pool, so later statements are executed in normal transactions.
+	if err := db.Unscoped().Where("last_name = ?", "Doe").Delete(&singer{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	reqs = drainRequestsFromServer(server.TestSpanner)
+	for _, req := range requestsOfType(reqs, reflect.TypeOf(&spannerpb.BeginTransactionRequest{})) {
+		if req.(*spannerpb.BeginTransactionRequest).GetOptions().GetPartitionedDml() != nil {
+			t.Fatalf("unexpected Partitioned DML transaction: %v", req)
+		}
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestPartitionedDMLInTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return PartitionedDML(tx).Unscoped().Where("last_name = ?", "Doe").Delete(&singer{}).Error
+	})
+	var txErr *PartitionedDMLInTransactionError
+	if !errors.As(err, &txErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, txErr)
+	}
+	if g, w := txErr.Table, "singers"; g != w {
+		t.Fatalf("table mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
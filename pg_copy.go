@@ -0,0 +1,302 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// pgDefaultSchema is the default schema of a PostgreSQL-dialect database.
+const pgDefaultSchema = "public"
+
+// CopyFromCSV writes the rows in the given CSV file to a table in a
+// PostgreSQL-dialect database. It is the equivalent of
+// COPY table (columns) FROM STDIN WITH (FORMAT csv, HEADER) for seeding a
+// database and for data migrations. The first line of the file must contain
+// the column names, and the values must be in the text format of PostgreSQL,
+// which is also the format that is written by COPY ... TO STDOUT:
+//   - booleans are t, f, true or false,
+//   - bytea values are hex encoded with a \x prefix,
+//   - timestamps are written as 2024-06-01 12:00:00.123456+00,
+//   - arrays are written as array literals, such as {1,2,NULL} or {"a b",c}.
+//
+// The column types are read from information_schema.columns. Table names
+// without a schema are in the public schema.
+//
+// This library does not support PostgreSQL-dialect databases with gorm, so
+// CopyFromCSV uses the given client of the Spanner client library instead of
+// a gorm database. The rows are written in the same way as by ImportCSV: as
+// InsertOrUpdate mutations in batches of ImportOptions.BatchSize rows, each
+// in its own transaction. The priority and the transaction tag of the
+// request options of ctx are applied to the transactions.
+//
+// Example:
+//
+//	f, err := os.Open("singers.csv")
+//	...
+//	err = spannergorm.CopyFromCSV(ctx, client, "singers", f, spannergorm.ImportOptions{})
+func CopyFromCSV(ctx context.Context, client *spanner.Client, table string, r io.Reader, options ImportOptions) error {
+	reader := csv.NewReader(r)
+	columns, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	columnTypes, err := pgColumnTypes(ctx, client, table)
+	if err != nil {
+		return err
+	}
+	types := make([]*spannerpb.Type, len(columns))
+	for i, column := range columns {
+		pgType, ok := columnTypes[column]
+		if !ok {
+			return fmt.Errorf("column %s not found in table %s", column, table)
+		}
+		if types[i], err = parsePGType(pgType); err != nil {
+			return fmt.Errorf("column %s: %w", column, err)
+		}
+	}
+	return applyRows(ctx, client, table, columns, options, requestOptions(ctx).TransactionTag, func() ([]interface{}, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(record))
+		for i, s := range record {
+			value, err := parsePGCSVValue(types[i], s, options.NullValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for column %s: %w", columns[i], err)
+			}
+			values[i] = spanner.GenericColumnValue{Type: types[i], Value: value}
+		}
+		return values, nil
+	})
+}
+
+// pgColumnTypes returns the types of the columns of the given table in a
+// PostgreSQL-dialect database as they are returned in
+// information_schema.columns.
+func pgColumnTypes(ctx context.Context, client *spanner.Client, table string) (map[string]string, error) {
+	tableSchema, tableName := splitTableName(table, pgDefaultSchema)
+	statement := spanner.Statement{
+		SQL:    "SELECT column_name, spanner_type FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2",
+		Params: map[string]interface{}{"p1": tableSchema, "p2": tableName},
+	}
+	it := client.Single().QueryWithOptions(ctx, statement, requestOptions(ctx).queryOptions())
+	defer it.Stop()
+	types := make(map[string]string)
+	for {
+		row, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var column, spannerType string
+		if err := row.Columns(&column, &spannerType); err != nil {
+			return nil, err
+		}
+		types[column] = spannerType
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	return types, nil
+}
+
+// parsePGType parses a type as it is returned in the spanner_type column of
+// information_schema.columns in a PostgreSQL-dialect database, such as
+// character varying(100) or bigint[].
+func parsePGType(s string) (*spannerpb.Type, error) {
+	name := strings.ToLower(strings.TrimSpace(spannerTypeLengthRegexp.ReplaceAllString(s, "")))
+	if strings.HasSuffix(name, "[]") {
+		elem, err := parsePGType(strings.TrimSuffix(name, "[]"))
+		if err != nil {
+			return nil, err
+		}
+		if elem.Code == spannerpb.TypeCode_ARRAY {
+			return nil, fmt.Errorf("nested arrays are not supported: %s", s)
+		}
+		return &spannerpb.Type{Code: spannerpb.TypeCode_ARRAY, ArrayElementType: elem}, nil
+	}
+	switch name {
+	case "bigint", "int8":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, nil
+	case "boolean", "bool":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_BOOL}, nil
+	case "bytea":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_BYTES}, nil
+	case "character varying", "varchar", "text":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, nil
+	case "date":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_DATE}, nil
+	case "double precision", "float8":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_FLOAT64}, nil
+	case "real", "float4":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_FLOAT32}, nil
+	case "jsonb":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_JSON, TypeAnnotation: spannerpb.TypeAnnotationCode_PG_JSONB}, nil
+	case "numeric", "decimal":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_NUMERIC, TypeAnnotation: spannerpb.TypeAnnotationCode_PG_NUMERIC}, nil
+	case "timestamp with time zone", "timestamptz":
+		return &spannerpb.Type{Code: spannerpb.TypeCode_TIMESTAMP}, nil
+	}
+	return nil, fmt.Errorf("unsupported column type: %s", s)
+}
+
+// parsePGCSVValue parses a value in the text format of PostgreSQL.
+func parsePGCSVValue(t *spannerpb.Type, s, nullValue string) (*structpb.Value, error) {
+	if s == nullValue {
+		return structpb.NewNullValue(), nil
+	}
+	if t.Code != spannerpb.TypeCode_ARRAY {
+		return parsePGValue(t, s)
+	}
+	elements, err := parsePGArray(s)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*structpb.Value, len(elements))
+	for i, element := range elements {
+		if element == nil {
+			values[i] = structpb.NewNullValue()
+			continue
+		}
+		if values[i], err = parsePGValue(t.ArrayElementType, *element); err != nil {
+			return nil, err
+		}
+	}
+	return structpb.NewListValue(&structpb.ListValue{Values: values}), nil
+}
+
+// pgTimestampLayouts are the layouts of timestamps that are accepted by
+// parsePGValue. Timestamps without a time zone are in UTC.
+var pgTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+}
+
+// parsePGValue parses a value that is not an array in the text format of
+// PostgreSQL.
+func parsePGValue(t *spannerpb.Type, s string) (*structpb.Value, error) {
+	switch t.Code {
+	case spannerpb.TypeCode_BOOL:
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return structpb.NewBoolValue(true), nil
+		case "f", "false", "n", "no", "off", "0":
+			return structpb.NewBoolValue(false), nil
+		}
+		return nil, fmt.Errorf("invalid boolean: %q", s)
+	case spannerpb.TypeCode_INT64:
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	case spannerpb.TypeCode_FLOAT32, spannerpb.TypeCode_FLOAT64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return floatValue(f), nil
+	case spannerpb.TypeCode_BYTES:
+		b := []byte(s)
+		if strings.HasPrefix(s, `\x`) {
+			var err error
+			if b, err = hex.DecodeString(s[2:]); err != nil {
+				return nil, err
+			}
+		}
+		return structpb.NewStringValue(base64.StdEncoding.EncodeToString(b)), nil
+	case spannerpb.TypeCode_TIMESTAMP:
+		for _, layout := range pgTimestampLayouts {
+			if ts, err := time.Parse(layout, s); err == nil {
+				return structpb.NewStringValue(ts.UTC().Format(time.RFC3339Nano)), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid timestamp: %q", s)
+	}
+	return structpb.NewStringValue(s), nil
+}
+
+// parsePGArray parses a one-dimensional PostgreSQL array literal, such as
+// {1,2,NULL} or {"a b",c}. NULL elements are returned as nil.
+func parsePGArray(s string) ([]*string, error) {
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, fmt.Errorf("invalid array: %q", s)
+	}
+	body := s[1 : len(s)-1]
+	elements := make([]*string, 0)
+	if strings.TrimSpace(body) == "" {
+		return elements, nil
+	}
+	for i := 0; ; {
+		var b strings.Builder
+		quoted := i < len(body) && body[i] == '"'
+		if quoted {
+			for i++; i < len(body) && body[i] != '"'; i++ {
+				if body[i] == '\\' && i+1 < len(body) {
+					i++
+				}
+				b.WriteByte(body[i])
+			}
+			if i == len(body) {
+				return nil, fmt.Errorf("unterminated quoted element in array: %q", s)
+			}
+			i++
+		} else {
+			for ; i < len(body) && body[i] != ','; i++ {
+				if body[i] == '{' || body[i] == '"' {
+					return nil, fmt.Errorf("unsupported array: %q", s)
+				}
+				b.WriteByte(body[i])
+			}
+		}
+		element := b.String()
+		if !quoted {
+			element = strings.TrimSpace(element)
+		}
+		if !quoted && strings.EqualFold(element, "NULL") {
+			elements = append(elements, nil)
+		} else {
+			elements = append(elements, &element)
+		}
+		if i == len(body) {
+			break
+		}
+		if body[i] != ',' {
+			return nil, fmt.Errorf("invalid array: %q", s)
+		}
+		i++
+	}
+	return elements, nil
+}
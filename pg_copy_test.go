@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestCopyFromCSV(t *testing.T) {
+	t.Parallel()
+
+	server, client, teardown := setupMockedTestServer(t)
+	defer teardown()
+
+	columns := [][]string{
+		{"id", "bigint"}, {"name", "character varying(100)"}, {"price", "numeric"}, {"data", "jsonb"},
+		{"updated", "timestamp with time zone"}, {"tags", "character varying[]"}, {"active", "boolean"},
+		{"checksum", "bytea"},
+	}
+	rows := make([]*structpb.ListValue, len(columns))
+	for i, column := range columns {
+		rows[i] = &structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue(column[0]), structpb.NewStringValue(column[1])}}
+	}
+	if err := server.TestSpanner.PutStatementResult(
+		"SELECT column_name, spanner_type FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2",
+		&testutil.StatementResult{
+			Type: testutil.StatementResultResultSet,
+			ResultSet: &spannerpb.ResultSet{
+				Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+					{Name: "column_name", Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}},
+					{Name: "spanner_type", Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}},
+				}}},
+				Rows: rows,
+			},
+		}); err != nil {
+		t.Fatal(err)
+	}
+
+	data := "id,name,price,data,updated,tags,active,checksum\n" +
+		`1,"Alice, ""the first""",123.45,"{""a"": 1}",2024-06-01 12:00:00.123456+02,"{x,""y z"",NULL}",t,\x010203` + "\n" +
+		`2,,,,,{},f,` + "\n"
+	ctx := WithRequestOptions(context.Background(), RequestOptions{TransactionTag: "seed"})
+	if err := CopyFromCSV(ctx, client, "singers", strings.NewReader(data), ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	sqlReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(sqlReqs), 1; g != w {
+		t.Fatalf("sql request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := sqlReqs[0].(*spannerpb.ExecuteSqlRequest).Params.Fields["p1"].GetStringValue(), "public"; g != w {
+		t.Fatalf("schema mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commit := commitReqs[0].(*spannerpb.CommitRequest)
+	if g, w := commit.GetRequestOptions().GetTransactionTag(), "seed"; g != w {
+		t.Fatalf("transaction tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	want := []*structpb.ListValue{
+		{Values: []*structpb.Value{
+			structpb.NewStringValue("1"),
+			structpb.NewStringValue("Alice, \"the first\""),
+			structpb.NewStringValue("123.45"),
+			structpb.NewStringValue(`{"a": 1}`),
+			structpb.NewStringValue("2024-06-01T10:00:00.123456Z"),
+			structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{
+				structpb.NewStringValue("x"), structpb.NewStringValue("y z"), structpb.NewNullValue(),
+			}}),
+			structpb.NewBoolValue(true),
+			structpb.NewStringValue("AQID"),
+		}},
+		{Values: []*structpb.Value{
+			structpb.NewStringValue("2"),
+			structpb.NewNullValue(),
+			structpb.NewNullValue(),
+			structpb.NewNullValue(),
+			structpb.NewNullValue(),
+			structpb.NewListValue(&structpb.ListValue{}),
+			structpb.NewBoolValue(false),
+			structpb.NewNullValue(),
+		}},
+	}
+	if g, w := len(commit.Mutations), len(want); g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, mutation := range commit.Mutations {
+		write := mutation.GetInsertOrUpdate()
+		if write == nil {
+			t.Fatalf("mutation %d is not an InsertOrUpdate mutation: %v", i, mutation)
+		}
+		if g, w := write.Table, "singers"; g != w {
+			t.Fatalf("table mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		if g, w := write.Values[0], want[i]; !proto.Equal(g, w) {
+			t.Fatalf("row %d mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+
+	// Unknown columns are rejected before any rows are written.
+	if err := CopyFromCSV(ctx, client, "singers", strings.NewReader("id,unknown\n1,2\n"), ImportOptions{}); err == nil {
+		t.Fatal("missing error for unknown column")
+	}
+}
+
+func TestParsePGType(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		input string
+		want  string
+	}{
+		{"bigint", "INT64"},
+		{"character varying(100)", "STRING"},
+		{"double precision", "FLOAT64"},
+		{"real", "FLOAT32"},
+		{"jsonb", "JSON"},
+		{"numeric", "NUMERIC"},
+		{"timestamp with time zone", "TIMESTAMP"},
+		{"bigint[]", "ARRAY<INT64>"},
+		{"character varying(10)[]", "ARRAY<STRING>"},
+	} {
+		got, err := parsePGType(test.input)
+		if err != nil {
+			t.Fatalf("%s: %v", test.input, err)
+		}
+		if g, w := formatSpannerType(got), test.want; g != w {
+			t.Errorf("%s: type mismatch\n Got: %v\nWant: %v", test.input, g, w)
+		}
+	}
+	for _, input := range []string{"spanner.commit_timestamp", "bigint[][]", "interval"} {
+		if _, err := parsePGType(input); err == nil {
+			t.Errorf("%s: missing expected error", input)
+		}
+	}
+}
+
+func TestParsePGArray(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		input string
+		want  []interface{}
+	}{
+		{"{}", []interface{}{}},
+		{"{1,2,3}", []interface{}{"1", "2", "3"}},
+		{`{"a,b",NULL,"NULL", c }`, []interface{}{"a,b", nil, "NULL", "c"}},
+		{`{"say \"hi\"","back\\slash"}`, []interface{}{`say "hi"`, `back\slash`}},
+	} {
+		elements, err := parsePGArray(test.input)
+		if err != nil {
+			t.Fatalf("%s: %v", test.input, err)
+		}
+		got := make([]interface{}, len(elements))
+		for i, element := range elements {
+			if element != nil {
+				got[i] = *element
+			}
+		}
+		if g, w := got, test.want; !reflect.DeepEqual(g, w) {
+			t.Errorf("%s: elements mismatch\n Got: %v\nWant: %v", test.input, g, w)
+		}
+	}
+	for _, input := range []string{"1,2", "{{1,2},{3,4}}", `{"a}`} {
+		if _, err := parsePGArray(input); err == nil {
+			t.Errorf("%s: missing expected error", input)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PoolStatistics are the statistics of the connection pool of a gorm
+// database that uses the Spanner dialector. See PoolStats.
+type PoolStatistics struct {
+	// Connections are the statistics of the database/sql connection pool.
+	// Connections of the Spanner database/sql driver are lightweight, and
+	// all connections share the sessions of one Spanner client.
+	Connections sql.DBStats
+	// SessionPool contains the session pool settings of the Spanner client of
+	// the driver.
+	SessionPool SessionPoolDiagnostics
+	// WarmupSessions is the number of sessions that were checked out when
+	// gorm.Open was called. See Config.WarmupSessions.
+	WarmupSessions int
+}
+
+// Ping checks that the database of the given gorm database can be reached by
+// executing the query SELECT 1. Use it in health checks. Unlike sql.DB.Ping,
+// which returns driver.ErrBadConn for all errors, Ping returns the error of
+// Spanner, such as a PermissionDenied or NotFound error.
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	var one int64
+	return sqlDB.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// PoolStats returns the statistics of the database/sql connection pool and the
+// session pool settings of the given gorm database. The number of sessions
+// that are in use is not exposed by the Spanner client library. It is
+// reported in the session pool metrics of the client library, such as
+// num_in_use_sessions.
+func PoolStats(db *gorm.DB) (PoolStatistics, error) {
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return PoolStatistics{}, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return PoolStatistics{}, err
+	}
+	stats := PoolStatistics{Connections: sqlDB.Stats(), SessionPool: defaultSessionPoolDiagnostics()}
+	if dialector.Config != nil {
+		stats.WarmupSessions = dialector.WarmupSessions
+		if dialector.DSN != "" {
+			config, err := parseDSN(dialector.currentDSN())
+			if err != nil {
+				return PoolStatistics{}, err
+			}
+			stats.SessionPool = sessionPoolDiagnosticsOf(config.params)
+		}
+	}
+	return stats, nil
+}
+
+// warmupTimeout is the maximum time that the warm-up of the sessions in
+// gorm.Open may take.
+const warmupTimeout = time.Minute
+
+// warmUpSessions executes the given number of queries concurrently on the
+// given database, so the Spanner client of the driver has created at least
+// that many sessions and the connections to Spanner when it returns. The
+// number of queries is limited to the maximum number of open connections of
+// the database, as each query holds a connection until all queries have
+// started.
+func warmUpSessions(ctx context.Context, db *sql.DB, n int) error {
+	if max := db.Stats().MaxOpenConnections; max > 0 && n > max {
+		n = max
+	}
+	ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+	var (
+		ready, done sync.WaitGroup
+		release     = make(chan struct{})
+		errs        = make([]error, n)
+	)
+	ready.Add(n)
+	done.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer done.Done()
+			rows, err := db.QueryContext(ctx, "SELECT 1")
+			if err != nil {
+				errs[i] = err
+				ready.Done()
+				return
+			}
+			// The session of the query is checked out until the rows are
+			// closed, so all queries use a different session.
+			rows.Next()
+			ready.Done()
+			<-release
+			errs[i] = errors.Join(rows.Err(), rows.Close())
+		}(i)
+	}
+	ready.Wait()
+	close(release)
+	done.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func TestWarmupSessions(t *testing.T) {
+	t.Parallel()
+
+	_, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{WarmupSessions: 5})
+	defer teardown()
+
+	sessions := make(map[string]bool)
+	for _, req := range requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		if req := req.(*spannerpb.ExecuteSqlRequest); req.Sql == "SELECT 1" {
+			sessions[req.Session] = true
+		}
+	}
+	if g, w := len(sessions), 5; g != w {
+		t.Fatalf("session count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	if err := Ping(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	_ = server.TestSpanner.PutStatementResult("SELECT 1", &testutil.StatementResult{
+		Type: testutil.StatementResultError,
+		Err:  status.Error(codes.PermissionDenied, "permission denied"),
+	})
+	if g, w := spanner.ErrCode(Ping(context.Background(), db)), codes.PermissionDenied; g != w {
+		t.Fatalf("error code mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnectionWithConfig(t, "minSessions=10;maxSessions=20", Config{WarmupSessions: 2})
+	defer teardown()
+
+	stats, err := PoolStats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := stats.SessionPool, (SessionPoolDiagnostics{MinSessions: 10, MaxSessions: 20}); g != w {
+		t.Fatalf("session pool mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+	if g, w := stats.WarmupSessions, 2; g != w {
+		t.Fatalf("warmup sessions mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if stats.Connections.OpenConnections == 0 {
+		t.Fatal("no open connections")
+	}
+}
+
+func TestWarmupSessionsMaxOpenConns(t *testing.T) {
+	t.Parallel()
+
+	server, _, serverTeardown := setupMockedTestServer(t)
+	defer serverTeardown()
+	_ = putDialectResult(server, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+	sqlDB, err := sql.Open("spanner", fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(2)
+
+	// The warm-up must not wait for more connections than the pool allows.
+	if _, err := gorm.Open(New(Config{Conn: sqlDB, WarmupSessions: 5}), &gorm.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	sessions := make(map[string]bool)
+	for _, req := range requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		if req := req.(*spannerpb.ExecuteSqlRequest); req.Sql == "SELECT 1" {
+			sessions[req.Session] = true
+		}
+	}
+	if g, w := len(sessions), 2; g != w {
+		t.Fatalf("session count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var (
+	protoBundleStatementRegExp = regexp.MustCompile(`(?is)^\s*(CREATE|ALTER)\s+PROTO\s+BUNDLE\b`)
+	createProtoBundleRegExp    = regexp.MustCompile(`(?is)^\s*CREATE\s+PROTO\s+BUNDLE\s*\((.*)\)\s*$`)
+)
+
+// migrateProtoBundle creates or updates the PROTO BUNDLE of the database with
+// the types in Config.ProtoDescriptors. The statement is added to the active
+// DDL batch, or executed directly if there is no active batch.
+func (m spannerMigrator) migrateProtoBundle() error {
+	if m.Dialector.Config == nil || len(m.Dialector.ProtoDescriptors) == 0 {
+		return nil
+	}
+	if m.Dialector.DSN == "" {
+		return errors.New("ProtoDescriptors can only be used with a dialector that has a DSN")
+	}
+	want, err := protoTypesOf(m.Dialector.ProtoDescriptors)
+	if err != nil {
+		return fmt.Errorf("invalid ProtoDescriptors: %w", err)
+	}
+	bundle := m.Dialector.ProtoBundle
+	if len(bundle) == 0 {
+		for name := range want {
+			if !strings.HasPrefix(name, "google.protobuf.") {
+				bundle = append(bundle, name)
+			}
+		}
+		sort.Strings(bundle)
+	}
+	for _, name := range bundle {
+		if _, ok := want[name]; !ok {
+			return fmt.Errorf("type %s in ProtoBundle not found in ProtoDescriptors", name)
+		}
+	}
+	ctx := m.DB.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	statements, descriptors, err := m.Dialector.databaseDdl(ctx)
+	if err != nil {
+		return err
+	}
+	existing := map[string]proto.Message{}
+	if len(descriptors) > 0 {
+		if existing, err = protoTypesOf(descriptors); err != nil {
+			return err
+		}
+	}
+	statement := protoBundleStatement(protoBundleOf(statements), existing, bundle, want)
+	if statement == "" {
+		return nil
+	}
+	if m.conn.batching {
+		return m.DB.Exec(statement).Error
+	}
+	return m.executeDDLBatch(ctx, []string{statement})
+}
+
+// protoBundleStatement returns the statement that creates the PROTO BUNDLE
+// with the given types if the bundle does not exist, or that inserts the new
+// types and updates the types whose descriptor has changed. It returns an
+// empty string if the bundle is up to date.
+func protoBundleStatement(current []string, currentTypes map[string]proto.Message, bundle []string, types map[string]proto.Message) string {
+	if len(bundle) == 0 {
+		return ""
+	}
+	if len(current) == 0 {
+		return "CREATE PROTO BUNDLE (" + strings.Join(bundle, ", ") + ")"
+	}
+	exists := make(map[string]bool, len(current))
+	for _, name := range current {
+		exists[name] = true
+	}
+	var insert, update []string
+	for _, name := range bundle {
+		if !exists[name] {
+			insert = append(insert, name)
+		} else if !proto.Equal(currentTypes[name], types[name]) {
+			update = append(update, name)
+		}
+	}
+	var parts []string
+	if len(insert) > 0 {
+		parts = append(parts, "INSERT ("+strings.Join(insert, ", ")+")")
+	}
+	if len(update) > 0 {
+		parts = append(parts, "UPDATE ("+strings.Join(update, ", ")+")")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "ALTER PROTO BUNDLE " + strings.Join(parts, " ")
+}
+
+// protoBundleOf returns the types in the CREATE PROTO BUNDLE statement in the
+// given DDL statements of a database, or nil if the database has no PROTO
+// BUNDLE.
+func protoBundleOf(statements []string) []string {
+	for _, statement := range statements {
+		match := createProtoBundleRegExp.FindStringSubmatch(statement)
+		if match == nil {
+			continue
+		}
+		var types []string
+		for _, name := range strings.Split(match[1], ",") {
+			if name = strings.Trim(strings.TrimSpace(name), "`"); name != "" {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// protoTypesOf returns the descriptors of all messages and enums, including
+// nested types, in the given serialized FileDescriptorSet by their fully
+// qualified name.
+func protoTypesOf(descriptors []byte) (map[string]proto.Message, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptors, &set); err != nil {
+		return nil, err
+	}
+	types := make(map[string]proto.Message)
+	var addMessages func(prefix string, messages []*descriptorpb.DescriptorProto)
+	addEnums := func(prefix string, enums []*descriptorpb.EnumDescriptorProto) {
+		for _, enum := range enums {
+			types[prefix+enum.GetName()] = enum
+		}
+	}
+	addMessages = func(prefix string, messages []*descriptorpb.DescriptorProto) {
+		for _, message := range messages {
+			name := prefix + message.GetName()
+			types[name] = message
+			addMessages(name+".", message.GetNestedType())
+			addEnums(name+".", message.GetEnumType())
+		}
+	}
+	for _, file := range set.GetFile() {
+		prefix := ""
+		if file.GetPackage() != "" {
+			prefix = file.GetPackage() + "."
+		}
+		addMessages(prefix, file.GetMessageType())
+		addEnums(prefix, file.GetEnumType())
+	}
+	return types, nil
+}
+
+// protoDescriptorsFor returns the proto descriptors that must be sent with
+// the given DDL statements. These are Config.ProtoDescriptors if one of the
+// statements creates or alters the PROTO BUNDLE, and nil otherwise.
+func (dialector Dialector) protoDescriptorsFor(statements []string) []byte {
+	if dialector.Config == nil || len(dialector.ProtoDescriptors) == 0 {
+		return nil
+	}
+	for _, statement := range statements {
+		if protoBundleStatementRegExp.MatchString(statement) {
+			return dialector.ProtoDescriptors
+		}
+	}
+	return nil
+}
+
+// databaseDdl returns the DDL statements and the proto descriptors of the
+// database in the DSN of the dialector.
+func (dialector Dialector) databaseDdl(ctx context.Context) ([]string, []byte, error) {
+	config, err := parseDSN(dialector.currentDSN())
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := database.NewDatabaseAdminClient(ctx, config.clientOptions()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
+	resp, err := client.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: config.databaseName()})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.GetStatements(), resp.GetProtoDescriptors(), nil
+}
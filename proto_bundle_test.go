@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func testProtoDescriptors(t *testing.T, fields ...string) []byte {
+	singerInfo := &descriptorpb.DescriptorProto{
+		Name:     proto.String("SingerInfo"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{Name: proto.String("Status")}},
+	}
+	for i, field := range fields {
+		singerInfo.Field = append(singerInfo.Field, &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(field),
+			Number: proto.Int32(int32(i + 1)),
+			Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		})
+	}
+	descriptors, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		{
+			Name:        proto.String("google/protobuf/timestamp.proto"),
+			Package:     proto.String("google.protobuf"),
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Timestamp")}},
+		},
+		{
+			Name:        proto.String("singers.proto"),
+			Package:     proto.String("examples.music"),
+			MessageType: []*descriptorpb.DescriptorProto{singerInfo},
+			EnumType:    []*descriptorpb.EnumDescriptorProto{{Name: proto.String("Genre")}},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return descriptors
+}
+
+func TestProtoTypesOf(t *testing.T) {
+	t.Parallel()
+
+	types, err := protoTypesOf(testProtoDescriptors(t, "name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if g, w := names, []string{
+		"examples.music.Genre",
+		"examples.music.SingerInfo",
+		"examples.music.SingerInfo.Status",
+		"google.protobuf.Timestamp",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("types mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestProtoBundleStatement(t *testing.T) {
+	t.Parallel()
+
+	current, err := protoTypesOf(testProtoDescriptors(t, "name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := protoTypesOf(testProtoDescriptors(t, "name", "nationality"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name    string
+		current []string
+		bundle  []string
+		types   map[string]proto.Message
+		want    string
+	}{
+		{"create", nil, []string{"examples.music.Genre", "examples.music.SingerInfo"}, current,
+			"CREATE PROTO BUNDLE (examples.music.Genre, examples.music.SingerInfo)"},
+		{"unchanged", []string{"examples.music.SingerInfo"}, []string{"examples.music.SingerInfo"}, current, ""},
+		{"insert and update", []string{"examples.music.SingerInfo"}, []string{"examples.music.Genre", "examples.music.SingerInfo"}, changed,
+			"ALTER PROTO BUNDLE INSERT (examples.music.Genre) UPDATE (examples.music.SingerInfo)"},
+	} {
+		if g, w := protoBundleStatement(test.current, current, test.bundle, test.types), test.want; g != w {
+			t.Errorf("%s: statement mismatch\n Got: %v\nWant: %v", test.name, g, w)
+		}
+	}
+}
+
+func TestProtoBundleOf(t *testing.T) {
+	t.Parallel()
+
+	statements := []string{
+		"CREATE TABLE singers (id INT64) PRIMARY KEY (id)",
+		"CREATE PROTO BUNDLE (\n  examples.music.Genre,\n  `examples.music.SingerInfo`,\n)",
+	}
+	if g, w := protoBundleOf(statements), []string{"examples.music.Genre", "examples.music.SingerInfo"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("bundle mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g := protoBundleOf(statements[:1]); g != nil {
+		t.Fatalf("bundle mismatch\n Got: %v\nWant: nil", g)
+	}
+}
+
+func TestProtoDescriptorsSentWithBundleStatement(t *testing.T) {
+	t.Parallel()
+
+	descriptors := testProtoDescriptors(t, "name")
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{ProtoDescriptors: descriptors})
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := &longrunningpb.Operation{Name: "test-operation", Done: true, Result: &longrunningpb.Operation_Response{Response: anyProto}}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{op, op})
+
+	ctx := context.Background()
+	if err := RunDDLBatch(ctx, db, []string{"CREATE PROTO BUNDLE (examples.music.SingerInfo)"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunDDLBatch(ctx, db, []string{"CREATE TABLE singers (id INT64) PRIMARY KEY (id)"}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 2; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetProtoDescriptors(), descriptors; !reflect.DeepEqual(g, w) {
+		t.Fatalf("proto descriptors mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g := requests[1].(*databasepb.UpdateDatabaseDdlRequest).GetProtoDescriptors(); g != nil {
+		t.Fatalf("proto descriptors sent without a PROTO BUNDLE statement: %v", g)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql"
+	"time"
+)
+
+// QueryStats are the statistics of a query in an interval, as reported by the
+// query statistics of Spanner.
+type QueryStats struct {
+	// Text is the text of the query. It is truncated to 64KB if
+	// TextTruncated is true.
+	Text          string
+	TextTruncated bool
+	// Fingerprint is the hash of the text of the query.
+	Fingerprint       int64
+	ExecutionCount    int64
+	AvgLatencySeconds float64
+	AvgRows           float64
+	AvgBytes          float64
+	AvgRowsScanned    float64
+	AvgCPUSeconds     float64
+	// IntervalEnd is the end of the interval of the statistics.
+	IntervalEnd time.Time
+}
+
+// IndexUsage is the number of reads and writes of an index, as reported by
+// the table operations statistics of Spanner.
+type IndexUsage struct {
+	Table string
+	Index string
+	// ReadQueryCount is the number of queries and reads that have read from
+	// the index.
+	ReadQueryCount int64
+	// WriteCount is the number of writes that have changed the index.
+	WriteCount int64
+	// Since is the start of the first interval with statistics for the index.
+	// It is zero if Spanner has no statistics for the index.
+	Since time.Time
+}
+
+// GetHottestQueries returns the queries that used the most CPU time in the
+// most recent interval of SPANNER_SYS.QUERY_STATS_TOP_HOUR, ordered by the
+// total CPU time of all executions. At most limit queries are returned. No
+// statistics are returned by the emulator.
+//
+// Example:
+//
+//	queries, err := db.Migrator().(spannergorm.StatisticsMigrator).GetHottestQueries(10)
+func (m spannerMigrator) GetHottestQueries(limit int) ([]QueryStats, error) {
+	rows, err := m.DB.Raw(
+		`SELECT TEXT, TEXT_TRUNCATED, TEXT_FINGERPRINT, EXECUTION_COUNT, AVG_LATENCY_SECONDS,
+			AVG_ROWS, AVG_BYTES, AVG_ROWS_SCANNED, AVG_CPU_SECONDS, INTERVAL_END
+		FROM SPANNER_SYS.QUERY_STATS_TOP_HOUR
+		WHERE INTERVAL_END = (SELECT MAX(INTERVAL_END) FROM SPANNER_SYS.QUERY_STATS_TOP_HOUR)
+		ORDER BY AVG_CPU_SECONDS * EXECUTION_COUNT DESC
+		LIMIT ?`,
+		limit,
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make([]QueryStats, 0)
+	for rows.Next() {
+		var s QueryStats
+		if err := rows.Scan(&s.Text, &s.TextTruncated, &s.Fingerprint, &s.ExecutionCount, &s.AvgLatencySeconds,
+			&s.AvgRows, &s.AvgBytes, &s.AvgRowsScanned, &s.AvgCPUSeconds, &s.IntervalEnd); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// GetIndexUsage returns the number of reads and writes of all indexes in the
+// database that are not primary keys, ordered by table and index name. The
+// counts are the totals of all intervals in
+// SPANNER_SYS.TABLE_OPERATIONS_STATS_HOUR, which retains the statistics of
+// the last 30 days. Indexes without statistics are returned with zero counts.
+func (m spannerMigrator) GetIndexUsage() ([]IndexUsage, error) {
+	indexes, err := m.secondaryIndexes()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.Raw(
+		`SELECT TABLE_NAME, SUM(READ_QUERY_COUNT), SUM(WRITE_COUNT), TIMESTAMP_SUB(MIN(INTERVAL_END), INTERVAL 1 HOUR)
+		FROM SPANNER_SYS.TABLE_OPERATIONS_STATS_HOUR
+		GROUP BY TABLE_NAME`,
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make(map[string]IndexUsage)
+	for rows.Next() {
+		var name string
+		var usage IndexUsage
+		var readQueryCount, writeCount sql.NullInt64
+		if err := rows.Scan(&name, &readQueryCount, &writeCount, &usage.Since); err != nil {
+			return nil, err
+		}
+		usage.ReadQueryCount, usage.WriteCount = readQueryCount.Int64, writeCount.Int64
+		stats[name] = usage
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	usages := make([]IndexUsage, len(indexes))
+	for i, index := range indexes {
+		usages[i] = stats[index.Index]
+		usages[i].Table, usages[i].Index = index.Table, index.Index
+	}
+	return usages, nil
+}
+
+// GetUnusedIndexes returns the indexes that have not been read by any query
+// according to GetIndexUsage. These indexes only add to the cost of writes,
+// and are candidates to be dropped. Indexes that were created recently, or
+// that are only used by queries that run less often than the retention of the
+// statistics, are also returned. Check the Since field of the result before
+// dropping an index.
+//
+// Example:
+//
+//	unused, err := db.Migrator().(spannergorm.StatisticsMigrator).GetUnusedIndexes()
+//	if err != nil {
+//	  return err
+//	}
+//	for _, index := range unused {
+//	  log.Printf("index %s on %s has not been used since %v", index.Index, index.Table, index.Since)
+//	}
+func (m spannerMigrator) GetUnusedIndexes() ([]IndexUsage, error) {
+	usages, err := m.GetIndexUsage()
+	if err != nil {
+		return nil, err
+	}
+	unused := make([]IndexUsage, 0)
+	for _, usage := range usages {
+		if usage.ReadQueryCount == 0 {
+			unused = append(unused, usage)
+		}
+	}
+	return unused, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestGetHottestQueries(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putTypedRowsResult(server, `SELECT TEXT, TEXT_TRUNCATED, TEXT_FINGERPRINT, EXECUTION_COUNT, AVG_LATENCY_SECONDS,
+			AVG_ROWS, AVG_BYTES, AVG_ROWS_SCANNED, AVG_CPU_SECONDS, INTERVAL_END
+		FROM SPANNER_SYS.QUERY_STATS_TOP_HOUR
+		WHERE INTERVAL_END = (SELECT MAX(INTERVAL_END) FROM SPANNER_SYS.QUERY_STATS_TOP_HOUR)
+		ORDER BY AVG_CPU_SECONDS * EXECUTION_COUNT DESC
+		LIMIT @p1`,
+		[]spannerpb.TypeCode{
+			spannerpb.TypeCode_STRING, spannerpb.TypeCode_BOOL, spannerpb.TypeCode_INT64, spannerpb.TypeCode_INT64, spannerpb.TypeCode_FLOAT64,
+			spannerpb.TypeCode_FLOAT64, spannerpb.TypeCode_FLOAT64, spannerpb.TypeCode_FLOAT64, spannerpb.TypeCode_FLOAT64, spannerpb.TypeCode_TIMESTAMP,
+		},
+		[][]*structpb.Value{{
+			structpb.NewStringValue("SELECT * FROM `singers`"), structpb.NewBoolValue(false), structpb.NewStringValue("123"),
+			structpb.NewStringValue("1000"), structpb.NewNumberValue(0.5), structpb.NewNumberValue(10), structpb.NewNumberValue(100),
+			structpb.NewNumberValue(10000), structpb.NewNumberValue(0.25), structpb.NewStringValue("2024-06-01T10:00:00Z"),
+		}},
+	)
+
+	queries, err := db.Migrator().(StatisticsMigrator).GetHottestQueries(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := queries, []QueryStats{{
+		Text:              "SELECT * FROM `singers`",
+		Fingerprint:       123,
+		ExecutionCount:    1000,
+		AvgLatencySeconds: 0.5,
+		AvgRows:           10,
+		AvgBytes:          100,
+		AvgRowsScanned:    10000,
+		AvgCPUSeconds:     0.25,
+		IntervalEnd:       time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+	}}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("queries mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+}
+
+func TestGetUnusedIndexes(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putStringRowsResult(server, secondaryIndexesSql, []string{"TABLE_NAME", "INDEX_NAME"}, [][]string{
+		{"albums", "idx_albums_title"},
+		{"singers", "idx_singers_email"},
+		{"singers", "idx_singers_name"},
+	})
+	_ = putTypedRowsResult(server, `SELECT TABLE_NAME, SUM(READ_QUERY_COUNT), SUM(WRITE_COUNT), TIMESTAMP_SUB(MIN(INTERVAL_END), INTERVAL 1 HOUR)
+		FROM SPANNER_SYS.TABLE_OPERATIONS_STATS_HOUR
+		GROUP BY TABLE_NAME`,
+		[]spannerpb.TypeCode{spannerpb.TypeCode_STRING, spannerpb.TypeCode_INT64, spannerpb.TypeCode_INT64, spannerpb.TypeCode_TIMESTAMP},
+		[][]*structpb.Value{
+			{structpb.NewStringValue("singers"), structpb.NewStringValue("500"), structpb.NewStringValue("20"), structpb.NewStringValue("2024-05-01T00:00:00Z")},
+			{structpb.NewStringValue("idx_singers_name"), structpb.NewStringValue("50"), structpb.NewStringValue("20"), structpb.NewStringValue("2024-05-01T00:00:00Z")},
+			{structpb.NewStringValue("idx_singers_email"), structpb.NewStringValue("0"), structpb.NewStringValue("20"), structpb.NewStringValue("2024-05-01T00:00:00Z")},
+		},
+	)
+
+	unused, err := db.Migrator().(StatisticsMigrator).GetUnusedIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := unused, []IndexUsage{
+		{Table: "albums", Index: "idx_albums_title"},
+		{Table: "singers", Index: "idx_singers_email", WriteCount: 20, Since: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("unused indexes mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+}
+
+// putTypedRowsResult registers a result with the given column types and rows
+// for the given SQL string.
+func putTypedRowsResult(server *testutil.MockedSpannerInMemTestServer, sql string, types []spannerpb.TypeCode, rows [][]*structpb.Value) error {
+	fields := make([]*spannerpb.StructType_Field, len(types))
+	for i, code := range types {
+		fields[i] = &spannerpb.StructType_Field{Type: &spannerpb.Type{Code: code}}
+	}
+	values := make([]*structpb.ListValue, len(rows))
+	for i, row := range rows {
+		values[i] = &structpb.ListValue{Values: row}
+	}
+	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: fields}},
+			Rows:     values,
+		},
+	})
+}
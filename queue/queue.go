@@ -0,0 +1,324 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package queue contains a job queue that is stored in a Spanner table.
+//
+// Spanner does not support SELECT ... FOR UPDATE SKIP LOCKED, which is
+// commonly used to implement job queues in other databases. Instead, workers
+// claim jobs with a conditional UPDATE ... THEN RETURN statement that sets a
+// lease on the jobs. A job that is claimed is not claimed by other workers
+// until its lease has expired. Jobs are assigned to a random shard when they
+// are enqueued, and workers claim jobs from one shard at a time, starting at a
+// random shard. This spreads the workers over the jobs, and reduces the number
+// of transactions that are aborted because workers try to claim the same jobs.
+//
+// All queues are stored in the table DefaultTable. The table is created or
+// updated by CreateTable or by AutoMigrate with the Job model.
+//
+// Example:
+//
+//	q := queue.New(db, "emails")
+//	if err := q.CreateTable(); err != nil {
+//	  return err
+//	}
+//	if _, err := q.Enqueue(ctx, payload); err != nil {
+//	  return err
+//	}
+//
+//	// In a worker:
+//	jobs, err := q.Claim(ctx, 10)
+//	if err != nil {
+//	  return err
+//	}
+//	for _, job := range jobs {
+//	  if err := send(job.Payload); err != nil {
+//	    _ = q.Fail(ctx, &job, err)
+//	    continue
+//	  }
+//	  _ = q.Complete(ctx, &job)
+//	}
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultTable is the name of the table that contains the jobs of all
+	// queues.
+	DefaultTable = "gorm_jobs"
+	// DefaultNumShards is the number of shards of a queue if no other number
+	// is set.
+	DefaultNumShards = 8
+	// DefaultLeaseDuration is the duration of the lease of a claimed job if no
+	// other duration is set.
+	DefaultLeaseDuration = 5 * time.Minute
+	// DefaultMaxAttempts is the number of times that a job is claimed before
+	// it is marked as failed, if no other number is set.
+	DefaultMaxAttempts = 5
+	// DefaultRetryDelay is the delay before a failed job is retried the first
+	// time, if no other delay is set. The delay is doubled for each attempt.
+	DefaultRetryDelay = 10 * time.Second
+
+	maxRetryDelay = time.Hour
+)
+
+// ErrLeaseLost is returned by Complete, Fail and ExtendLease if the lease of
+// the job has expired, and the job has been claimed again.
+var ErrLeaseLost = errors.New("queue: the lease of the job has expired and the job has been claimed again")
+
+// leaseExpiredError is the error that is recorded for jobs that are marked as
+// failed because the lease of their last attempt expired.
+const leaseExpiredError = "queue: the lease of the last attempt of the job expired"
+
+// Job is a job in a queue. It is also the model of the table of the queues,
+// which can be passed to AutoMigrate.
+type Job struct {
+	ID    string `gorm:"primaryKey;type:STRING(36);default:GENERATE_UUID()"`
+	Queue string `gorm:"not null;index:idx_gorm_jobs_claim,priority:1"`
+	// Shard is the random shard of the job. Workers claim jobs from one shard
+	// at a time.
+	Shard int64 `gorm:"not null;index:idx_gorm_jobs_claim,priority:2"`
+	// AvailableAt is the time at which the job can be claimed.
+	AvailableAt time.Time `gorm:"not null;index:idx_gorm_jobs_claim,priority:3"`
+	Payload     []byte
+	// Attempts is the number of times that the job has been claimed.
+	Attempts    int64 `gorm:"not null"`
+	MaxAttempts int64 `gorm:"not null"`
+	// LeaseID identifies the current lease of the job. It is generated each
+	// time that the job is claimed.
+	LeaseID        string `gorm:"type:STRING(36)"`
+	LeaseExpiresAt *time.Time
+	// LastError is the error of the last attempt that failed.
+	LastError string
+	// FailedAt is the time at which the last attempt of the job failed. Failed
+	// jobs are not claimed again.
+	FailedAt  *time.Time
+	CreatedAt time.Time
+}
+
+// TableName implements schema.Tabler.
+func (Job) TableName() string {
+	return DefaultTable
+}
+
+// Options are the options of a queue.
+type Options struct {
+	// NumShards is the number of shards of the queue. The default is
+	// DefaultNumShards. Changing the number of shards of an existing queue
+	// does not move existing jobs, and jobs in shards that are no longer used
+	// are not claimed.
+	NumShards int
+	// LeaseDuration is the duration of the lease of a claimed job. The job is
+	// claimed again by another worker if it has not been completed or failed
+	// when the lease expires. The default is DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	// MaxAttempts is the number of times that a job is claimed before it is
+	// marked as failed. The default is DefaultMaxAttempts.
+	MaxAttempts int
+	// RetryDelay is the delay before a failed job is retried the first time.
+	// The delay is doubled for each attempt, up to one hour. The default is
+	// DefaultRetryDelay.
+	RetryDelay time.Duration
+}
+
+// Queue is a named job queue that is stored in a Spanner table.
+type Queue struct {
+	db      *gorm.DB
+	name    string
+	options Options
+}
+
+// New returns the queue with the given name with the default options.
+func New(db *gorm.DB, name string) *Queue {
+	return NewWithOptions(db, name, Options{})
+}
+
+// NewWithOptions returns the queue with the given name with the given
+// options.
+func NewWithOptions(db *gorm.DB, name string, options Options) *Queue {
+	if options.NumShards <= 0 {
+		options.NumShards = DefaultNumShards
+	}
+	if options.LeaseDuration <= 0 {
+		options.LeaseDuration = DefaultLeaseDuration
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultMaxAttempts
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = DefaultRetryDelay
+	}
+	return &Queue{db: db, name: name, options: options}
+}
+
+// CreateTable creates or updates the table of the queues with AutoMigrate.
+func (q *Queue) CreateTable() error {
+	return q.session(context.Background()).AutoMigrate(&Job{})
+}
+
+// Enqueue adds a job with the given payload to the queue. The job can be
+// claimed immediately.
+func (q *Queue) Enqueue(ctx context.Context, payload []byte) (*Job, error) {
+	return q.EnqueueAt(ctx, payload, time.Now())
+}
+
+// EnqueueAt adds a job with the given payload to the queue. The job can be
+// claimed from the given time.
+func (q *Queue) EnqueueAt(ctx context.Context, payload []byte, availableAt time.Time) (*Job, error) {
+	job := &Job{
+		Queue:       q.name,
+		Shard:       rand.Int63n(int64(q.options.NumShards)),
+		AvailableAt: availableAt.UTC(),
+		Payload:     payload,
+		MaxAttempts: int64(q.options.MaxAttempts),
+	}
+	if err := q.session(ctx).Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Claim claims at most limit jobs that are available, and sets a lease on
+// them. The jobs are claimed from the first shard with available jobs,
+// starting at a random shard. Claim returns an empty slice if no jobs are
+// available. Each claimed job must be completed with Complete or failed with
+// Fail before its lease expires, or its lease must be extended with
+// ExtendLease.
+//
+// Jobs in a shard that have reached their maximum number of attempts, and
+// whose lease has expired without being completed or failed, are marked as
+// failed before jobs are claimed from the shard.
+func (q *Queue) Claim(ctx context.Context, limit int) ([]Job, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("queue: limit must be positive: %d", limit)
+	}
+	start := rand.Intn(q.options.NumShards)
+	for i := 0; i < q.options.NumShards; i++ {
+		shard := (start + i) % q.options.NumShards
+		if err := q.failExpiredJobs(ctx, shard); err != nil {
+			return nil, err
+		}
+		var jobs []Job
+		if err := q.session(ctx).Raw(fmt.Sprintf(
+			"UPDATE `%[1]s` SET `lease_id` = GENERATE_UUID(), "+
+				"`lease_expires_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ? MILLISECOND), "+
+				"`attempts` = `attempts` + 1 "+
+				"WHERE `id` IN (SELECT `id` FROM `%[1]s` "+
+				"WHERE `queue` = ? AND `shard` = ? AND `failed_at` IS NULL AND `attempts` < `max_attempts` "+
+				"AND `available_at` <= CURRENT_TIMESTAMP() "+
+				"AND (`lease_expires_at` IS NULL OR `lease_expires_at` <= CURRENT_TIMESTAMP()) "+
+				"ORDER BY `available_at` LIMIT ?) "+
+				"THEN RETURN *", DefaultTable),
+			q.options.LeaseDuration.Milliseconds(), q.name, shard, limit,
+		).Find(&jobs).Error; err != nil {
+			return nil, err
+		}
+		if len(jobs) > 0 {
+			return jobs, nil
+		}
+	}
+	return []Job{}, nil
+}
+
+// failExpiredJobs marks the jobs in the given shard that have reached their
+// maximum number of attempts and whose lease has expired as failed. These
+// jobs are otherwise never claimed again, and never marked as failed.
+func (q *Queue) failExpiredJobs(ctx context.Context, shard int) error {
+	return q.session(ctx).Exec(fmt.Sprintf(
+		"UPDATE `%s` SET `lease_id` = NULL, `lease_expires_at` = NULL, `last_error` = ?, "+
+			"`failed_at` = CURRENT_TIMESTAMP() "+
+			"WHERE `queue` = ? AND `shard` = ? AND `failed_at` IS NULL AND `attempts` >= `max_attempts` "+
+			"AND `lease_expires_at` <= CURRENT_TIMESTAMP()", DefaultTable),
+		leaseExpiredError, q.name, shard,
+	).Error
+}
+
+// Complete removes a claimed job from the queue. It returns ErrLeaseLost if
+// the job has been claimed again after its lease expired.
+func (q *Queue) Complete(ctx context.Context, job *Job) error {
+	return q.execWithLease(ctx, job, fmt.Sprintf(
+		"DELETE FROM `%s` WHERE `id` = ? AND `lease_id` = ?", DefaultTable),
+		job.ID, job.LeaseID)
+}
+
+// Fail releases the lease of a claimed job that could not be processed, and
+// records the error. The job is retried after the retry delay of the queue,
+// unless it has reached its maximum number of attempts, in which case it is
+// marked as failed. It returns ErrLeaseLost if the job has been claimed again
+// after its lease expired.
+func (q *Queue) Fail(ctx context.Context, job *Job, cause error) error {
+	var message string
+	if cause != nil {
+		message = cause.Error()
+	}
+	return q.execWithLease(ctx, job, fmt.Sprintf(
+		"UPDATE `%s` SET `lease_id` = NULL, `lease_expires_at` = NULL, `last_error` = ?, "+
+			"`available_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ? MILLISECOND), "+
+			"`failed_at` = IF(`attempts` >= `max_attempts`, CURRENT_TIMESTAMP(), NULL) "+
+			"WHERE `id` = ? AND `lease_id` = ?", DefaultTable),
+		message, q.retryDelay(job.Attempts).Milliseconds(), job.ID, job.LeaseID)
+}
+
+// ExtendLease extends the lease of a claimed job by the given duration from
+// now. It returns ErrLeaseLost if the job has been claimed again after its
+// lease expired.
+func (q *Queue) ExtendLease(ctx context.Context, job *Job, duration time.Duration) error {
+	return q.execWithLease(ctx, job, fmt.Sprintf(
+		"UPDATE `%s` SET `lease_expires_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ? MILLISECOND) "+
+			"WHERE `id` = ? AND `lease_id` = ?", DefaultTable),
+		duration.Milliseconds(), job.ID, job.LeaseID)
+}
+
+func (q *Queue) execWithLease(ctx context.Context, job *Job, sql string, values ...interface{}) error {
+	if job.LeaseID == "" {
+		return fmt.Errorf("queue: job %s has not been claimed", job.ID)
+	}
+	res := q.session(ctx).Exec(sql, values...)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// retryDelay returns the delay before the next attempt of a job that has
+// been claimed the given number of times.
+func (q *Queue) retryDelay(attempts int64) time.Duration {
+	delay := q.options.RetryDelay
+	for i := int64(1); i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// session returns a session that is not affected by other statements on the
+// database of the queue.
+func (q *Queue) session(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return q.db.Session(&gorm.Session{NewDB: true, Context: ctx})
+}
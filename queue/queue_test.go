@@ -0,0 +1,301 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+)
+
+const claimSql = "UPDATE `gorm_jobs` SET `lease_id` = GENERATE_UUID(), " +
+	"`lease_expires_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @p1 MILLISECOND), " +
+	"`attempts` = `attempts` + 1 " +
+	"WHERE `id` IN (SELECT `id` FROM `gorm_jobs` " +
+	"WHERE `queue` = @p2 AND `shard` = @p3 AND `failed_at` IS NULL AND `attempts` < `max_attempts` " +
+	"AND `available_at` <= CURRENT_TIMESTAMP() " +
+	"AND (`lease_expires_at` IS NULL OR `lease_expires_at` <= CURRENT_TIMESTAMP()) " +
+	"ORDER BY `available_at` LIMIT @p4) " +
+	"THEN RETURN *"
+
+const failExpiredSql = "UPDATE `gorm_jobs` SET `lease_id` = NULL, `lease_expires_at` = NULL, `last_error` = @p1, " +
+	"`failed_at` = CURRENT_TIMESTAMP() " +
+	"WHERE `queue` = @p2 AND `shard` = @p3 AND `failed_at` IS NULL AND `attempts` >= `max_attempts` " +
+	"AND `lease_expires_at` <= CURRENT_TIMESTAMP()"
+
+func TestEnqueue(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	insertSql := "INSERT INTO `gorm_jobs` (`queue`,`shard`,`available_at`,`payload`,`attempts`,`max_attempts`,`lease_id`,`lease_expires_at`,`last_error`,`failed_at`,`created_at`) " +
+		"VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7,@p8,@p9,@p10,@p11) THEN RETURN `id`"
+	_ = putJobsResult(server, insertSql, []string{"id"}, [][]string{{"job-1"}})
+
+	q := NewWithOptions(db, "emails", Options{MaxAttempts: 3})
+	job, err := q.Enqueue(context.Background(), []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := job.ID, "job-1"; g != w {
+		t.Fatalf("id mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	req := lastRequest(server, insertSql)
+	if req == nil {
+		t.Fatal("insert statement not found")
+	}
+	if g, w := req.Params.Fields["p1"].GetStringValue(), "emails"; g != w {
+		t.Fatalf("queue mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p6"].GetStringValue(), "3"; g != w {
+		t.Fatalf("max attempts mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putJobsResult(server, claimSql, []string{"id", "queue", "payload", "attempts", "lease_id"}, [][]string{
+		{"job-1", "emails", "cGF5bG9hZA==", "1", "lease-1"},
+		{"job-2", "emails", "cGF5bG9hZA==", "2", "lease-2"},
+	})
+	_ = putUpdateCount(server, failExpiredSql, 0)
+
+	q := NewWithOptions(db, "emails", Options{NumShards: 1, LeaseDuration: time.Minute})
+	jobs, err := q.Claim(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(jobs), 2; g != w {
+		t.Fatalf("job count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := fmt.Sprintf("%s %s %s %d", jobs[1].ID, jobs[1].LeaseID, jobs[1].Payload, jobs[1].Attempts), "job-2 lease-2 payload 2"; g != w {
+		t.Fatalf("job mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	req := lastRequest(server, claimSql)
+	if req == nil {
+		t.Fatal("claim statement not found")
+	}
+	if g, w := req.Params.Fields["p1"].GetStringValue(), "60000"; g != w {
+		t.Fatalf("lease duration mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p4"].GetStringValue(), "2"; g != w {
+		t.Fatalf("limit mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestClaimEmptyQueue(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putJobsResult(server, claimSql, []string{"id"}, nil)
+	_ = putUpdateCount(server, failExpiredSql, 0)
+
+	q := NewWithOptions(db, "emails", Options{NumShards: 3})
+	jobs, err := q.Claim(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(jobs), 0; g != w {
+		t.Fatalf("job count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	shards := make(map[string]bool)
+	for _, req := range drainRequestsFromServer(server.TestSpanner) {
+		if executeReq, ok := req.(*spannerpb.ExecuteSqlRequest); ok && executeReq.Sql == claimSql {
+			shards[executeReq.Params.Fields["p3"].GetStringValue()] = true
+		}
+	}
+	if g, w := len(shards), 3; g != w {
+		t.Fatalf("shard count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestClaimFailsExpiredJobs(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putJobsResult(server, claimSql, []string{"id"}, nil)
+	_ = putUpdateCount(server, failExpiredSql, 1)
+
+	q := NewWithOptions(db, "emails", Options{NumShards: 1})
+	if _, err := q.Claim(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	var requests []*spannerpb.ExecuteSqlRequest
+	for _, req := range drainRequestsFromServer(server.TestSpanner) {
+		if executeReq, ok := req.(*spannerpb.ExecuteSqlRequest); ok && (executeReq.Sql == failExpiredSql || executeReq.Sql == claimSql) {
+			requests = append(requests, executeReq)
+		}
+	}
+	// The expired jobs are marked as failed before jobs are claimed.
+	if g, w := len(requests), 2; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].Sql, failExpiredSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].Params.Fields["p1"].GetStringValue(), leaseExpiredError; g != w {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].Params.Fields["p2"].GetStringValue(), "emails"; g != w {
+		t.Fatalf("queue mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestCompleteLeaseLost(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	deleteSql := "DELETE FROM `gorm_jobs` WHERE `id` = @p1 AND `lease_id` = @p2"
+	_ = server.TestSpanner.PutStatementResult(deleteSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 0,
+	})
+
+	q := New(db, "emails")
+	err := q.Complete(context.Background(), &Job{ID: "job-1", LeaseID: "lease-1"})
+	if g, w := err, ErrLeaseLost; !errors.Is(g, w) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if err := q.Complete(context.Background(), &Job{ID: "job-1"}); err == nil {
+		t.Fatal("missing error for job that has not been claimed")
+	}
+}
+
+func TestFail(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	failSql := "UPDATE `gorm_jobs` SET `lease_id` = NULL, `lease_expires_at` = NULL, `last_error` = @p1, " +
+		"`available_at` = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @p2 MILLISECOND), " +
+		"`failed_at` = IF(`attempts` >= `max_attempts`, CURRENT_TIMESTAMP(), NULL) " +
+		"WHERE `id` = @p3 AND `lease_id` = @p4"
+	_ = server.TestSpanner.PutStatementResult(failSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+
+	q := NewWithOptions(db, "emails", Options{RetryDelay: time.Second})
+	if err := q.Fail(context.Background(), &Job{ID: "job-1", LeaseID: "lease-1", Attempts: 3}, errors.New("smtp error")); err != nil {
+		t.Fatal(err)
+	}
+	req := lastRequest(server, failSql)
+	if req == nil {
+		t.Fatal("fail statement not found")
+	}
+	if g, w := req.Params.Fields["p1"].GetStringValue(), "smtp error"; g != w {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p2"].GetStringValue(), "4000"; g != w {
+		t.Fatalf("retry delay mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	q := NewWithOptions(nil, "emails", Options{RetryDelay: 10 * time.Minute})
+	for _, test := range []struct {
+		attempts int64
+		want     time.Duration
+	}{
+		{0, 10 * time.Minute},
+		{1, 10 * time.Minute},
+		{2, 20 * time.Minute},
+		{3, 40 * time.Minute},
+		{4, time.Hour},
+		{100, time.Hour},
+	} {
+		if g, w := q.retryDelay(test.attempts), test.want; g != w {
+			t.Errorf("%d: retry delay mismatch\n Got: %v\nWant: %v", test.attempts, g, w)
+		}
+	}
+}
+
+func putJobsResult(server *testutil.MockedSpannerInMemTestServer, sql string, columns []string, rows [][]string) error {
+	fields := make([]*spannerpb.StructType_Field, len(columns))
+	for i, column := range columns {
+		code := spannerpb.TypeCode_STRING
+		switch column {
+		case "attempts":
+			code = spannerpb.TypeCode_INT64
+		case "payload":
+			code = spannerpb.TypeCode_BYTES
+		}
+		fields[i] = &spannerpb.StructType_Field{Name: column, Type: &spannerpb.Type{Code: code}}
+	}
+	values := make([]*structpb.ListValue, len(rows))
+	for i, row := range rows {
+		values[i] = &structpb.ListValue{}
+		for _, value := range row {
+			values[i].Values = append(values[i].Values, structpb.NewStringValue(value))
+		}
+	}
+	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: fields}},
+			Rows:     values,
+		},
+	})
+}
+
+func putUpdateCount(server *testutil.MockedSpannerInMemTestServer, sql string, count int64) error {
+	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: count,
+	})
+}
+
+// lastRequest returns the last ExecuteSqlRequest with the given SQL string
+// that has been received by the server.
+func lastRequest(server *testutil.MockedSpannerInMemTestServer, sql string) *spannerpb.ExecuteSqlRequest {
+	var last *spannerpb.ExecuteSqlRequest
+	for _, req := range drainRequestsFromServer(server.TestSpanner) {
+		if executeReq, ok := req.(*spannerpb.ExecuteSqlRequest); ok && executeReq.Sql == sql {
+			last = executeReq
+		}
+	}
+	return last
+}
+
+func setupTestGormConnection(t *testing.T) (db *gorm.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	server, _, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	db, err := gorm.Open(spannergorm.New(spannergorm.Config{
+		DriverName: "spanner",
+		DSN:        fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address),
+
+		DisableDialectCheck: true,
+	}), &gorm.Config{})
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	return db, server, serverTeardown
+}
+
+func drainRequestsFromServer(server testutil.InMemSpannerServer) []interface{} {
+	var reqs []interface{}
+loop:
+	for {
+		select {
+		case req := <-server.ReceivedRequests():
+			reqs = append(reqs, req)
+		default:
+			break loop
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql/driver"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const defaultRedactedValue = "<redacted>"
+
+// RedactionPolicy determines which query parameters are replaced with a
+// placeholder in the statements that are logged by gorm. The values of fields
+// with a `gorm:"sensitive"` tag are always redacted. The values that are sent
+// to Spanner are not changed.
+//
+// Values are redacted when they are assigned to a column in an INSERT or
+// UPDATE statement, or when they are compared with a column in a condition
+// that gorm generates, such as db.Where(&User{Email: email}) or
+// db.Where(map[string]interface{}{"email": email}). Values in SQL strings,
+// such as db.Where("email = ?", email), are not associated with a column and
+// are not redacted. Use the ParameterizedQueries option of the gorm logger to
+// hide the values of all parameters.
+//
+// Example:
+//
+//	type User struct {
+//	  ID    int64
+//	  Email string `gorm:"sensitive"`
+//	}
+type RedactionPolicy struct {
+	// Columns are the names of additional columns whose values are redacted
+	// in all tables.
+	Columns []string
+	// Replacement is logged instead of a redacted value. Defaults to
+	// "<redacted>".
+	Replacement string
+}
+
+// redactedValue is a query parameter that is logged as a placeholder. The
+// actual value is sent to Spanner.
+type redactedValue struct {
+	value       interface{}
+	replacement string
+}
+
+// Value implements driver.Valuer.
+func (v redactedValue) Value() (driver.Value, error) {
+	if valuer, ok := v.value.(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	return v.value, nil
+}
+
+// isSensitiveColumn returns true if the values of the given column should be
+// redacted.
+func (p *RedactionPolicy) isSensitiveColumn(s *schema.Schema, column string) bool {
+	if p != nil {
+		for _, c := range p.Columns {
+			if strings.EqualFold(c, column) {
+				return true
+			}
+		}
+	}
+	if s == nil {
+		return false
+	}
+	field := s.LookUpField(column)
+	if field == nil {
+		return false
+	}
+	_, ok := field.TagSettings["SENSITIVE"]
+	return ok
+}
+
+func (p *RedactionPolicy) replacement() string {
+	if p == nil || p.Replacement == "" {
+		return defaultRedactedValue
+	}
+	return p.Replacement
+}
+
+// redact wraps the given value in a redactedValue. Expressions and values that
+// gorm converts to expressions are not wrapped, as these are not sent as
+// query parameters.
+func (p *RedactionPolicy) redact(value interface{}) interface{} {
+	switch value.(type) {
+	case nil, redactedValue, clause.Expression, gorm.Valuer, *gorm.DB:
+		return value
+	}
+	return redactedValue{value: value, replacement: p.replacement()}
+}
+
+// redactVars replaces redacted values with their replacement for logging.
+func redactVars(vars []interface{}) []interface{} {
+	var result []interface{}
+	for i, v := range vars {
+		if r, ok := v.(redactedValue); ok {
+			if result == nil {
+				result = make([]interface{}, len(vars))
+				copy(result, vars)
+			}
+			result[i] = r.replacement
+		}
+	}
+	if result == nil {
+		return vars
+	}
+	return result
+}
+
+// registerRedaction registers clause builders that wrap the values of sensitive
+// columns in INSERT, UPDATE and WHERE clauses in a redactedValue. The
+// previously registered builders for these clauses are called afterwards.
+func registerRedaction(db *gorm.DB, policy *RedactionPolicy) {
+	wrap := func(name string, redact func(c clause.Clause, s *schema.Schema) clause.Clause) {
+		next := db.ClauseBuilders[name]
+		db.ClauseBuilders[name] = func(c clause.Clause, builder clause.Builder) {
+			if stmt, ok := builder.(*gorm.Statement); ok {
+				c = redact(c, stmt.Schema)
+			}
+			if next != nil {
+				next(c, builder)
+			} else {
+				c.Build(builder)
+			}
+		}
+	}
+	wrap(clause.Values{}.Name(), func(c clause.Clause, s *schema.Schema) clause.Clause {
+		values, ok := c.Expression.(clause.Values)
+		if !ok {
+			return c
+		}
+		var indexes []int
+		for i, column := range values.Columns {
+			if policy.isSensitiveColumn(s, column.Name) {
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) == 0 {
+			return c
+		}
+		rows := make([][]interface{}, len(values.Values))
+		for r, row := range values.Values {
+			rows[r] = make([]interface{}, len(row))
+			copy(rows[r], row)
+			for _, i := range indexes {
+				rows[r][i] = policy.redact(rows[r][i])
+			}
+		}
+		c.Expression = clause.Values{Columns: values.Columns, Values: rows}
+		return c
+	})
+	wrap(clause.Set{}.Name(), func(c clause.Clause, s *schema.Schema) clause.Clause {
+		set, ok := c.Expression.(clause.Set)
+		if !ok {
+			return c
+		}
+		assignments := make(clause.Set, len(set))
+		for i, assignment := range set {
+			assignments[i] = assignment
+			if policy.isSensitiveColumn(s, assignment.Column.Name) {
+				assignments[i].Value = policy.redact(assignment.Value)
+			}
+		}
+		c.Expression = assignments
+		return c
+	})
+	wrap(clause.Where{}.Name(), func(c clause.Clause, s *schema.Schema) clause.Clause {
+		where, ok := c.Expression.(clause.Where)
+		if !ok {
+			return c
+		}
+		c.Expression = clause.Where{Exprs: policy.redactConditions(s, where.Exprs)}
+		return c
+	})
+}
+
+// redactConditions returns a copy of the given conditions where the values that
+// are compared with sensitive columns are redacted.
+func (p *RedactionPolicy) redactConditions(s *schema.Schema, exprs []clause.Expression) []clause.Expression {
+	result := make([]clause.Expression, len(exprs))
+	for i, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Eq:
+			if p.isSensitiveColumn(s, columnName(e.Column)) {
+				e.Value = p.redact(e.Value)
+			}
+			result[i] = e
+		case clause.Neq:
+			if p.isSensitiveColumn(s, columnName(e.Column)) {
+				e.Value = p.redact(e.Value)
+			}
+			result[i] = e
+		case clause.IN:
+			if p.isSensitiveColumn(s, columnName(e.Column)) {
+				values := make([]interface{}, len(e.Values))
+				for j, v := range e.Values {
+					values[j] = p.redact(v)
+				}
+				e.Values = values
+			}
+			result[i] = e
+		case clause.AndConditions:
+			result[i] = clause.AndConditions{Exprs: p.redactConditions(s, e.Exprs)}
+		case clause.OrConditions:
+			result[i] = clause.OrConditions{Exprs: p.redactConditions(s, e.Exprs)}
+		case clause.NotConditions:
+			result[i] = clause.NotConditions{Exprs: p.redactConditions(s, e.Exprs)}
+		default:
+			result[i] = expr
+		}
+	}
+	return result
+}
+
+// columnName returns the name of the column of a condition.
+func columnName(column interface{}) string {
+	switch c := column.(type) {
+	case clause.Column:
+		return c.Name
+	case string:
+		return c
+	}
+	return ""
+}
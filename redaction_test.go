@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type userWithSensitiveFields struct {
+	ID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name  string
+	Email string `gorm:"sensitive"`
+	Phone string
+}
+
+func (userWithSensitiveFields) TableName() string {
+	return "users"
+}
+
+type logRecorder struct {
+	lines []string
+}
+
+func (r *logRecorder) Printf(format string, args ...interface{}) {
+	r.lines = append(r.lines, fmt.Sprintf(format, args...))
+}
+
+func TestRedaction(t *testing.T) {
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{
+		RedactionPolicy: &RedactionPolicy{Columns: []string{"phone"}, Replacement: "***"},
+	})
+	defer teardown()
+	recorder := &logRecorder{}
+	db = db.Session(&gorm.Session{Logger: logger.New(recorder, logger.Config{LogLevel: logger.Info})})
+
+	insertSql := "INSERT INTO `users` (`id`,`name`,`email`,`phone`) VALUES (@p1,@p2,@p3,@p4)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	if err := db.Create(&userWithSensitiveFields{ID: 1, Name: "Alice", Email: "alice@example.com", Phone: "555-0100"}).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.Sql, insertSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The actual values must be sent to Spanner.
+	if g, w := req.Params.Fields["p3"].GetStringValue(), "alice@example.com"; g != w {
+		t.Fatalf("email param mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	updateSql := "UPDATE `users` SET `email`=@p1 WHERE `users`.`email` = @p2 AND `id` = @p3"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	if err := db.Model(&userWithSensitiveFields{ID: 1}).Where(&userWithSensitiveFields{Email: "alice@example.com"}).Update("email", "bob@example.com").Error; err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	if g, w := getLastSql(server), updateSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	logs := strings.Join(recorder.lines, "\n")
+	for _, value := range []string{"alice@example.com", "bob@example.com", "555-0100"} {
+		if strings.Contains(logs, value) {
+			t.Fatalf("logs contain sensitive value %q:\n%s", value, logs)
+		}
+	}
+	for _, value := range []string{"'Alice'", "'***'"} {
+		if !strings.Contains(logs, value) {
+			t.Fatalf("logs do not contain %q:\n%s", value, logs)
+		}
+	}
+}
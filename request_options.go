@@ -0,0 +1,342 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"gorm.io/gorm"
+)
+
+// RequestOptions are the options that are sent to Spanner with each request
+// that is executed in a context that was created by WithRequestOptions.
+type RequestOptions struct {
+	// Priority is the priority of the requests. Spanner uses the priority to
+	// schedule requests, and reports the priority in its statistics, which
+	// makes it possible to distinguish background jobs from online traffic.
+	Priority spannerpb.RequestOptions_Priority
+	// RequestTag is the tag that is added to the requests, and that is shown
+	// in the query statistics of Spanner. The Spanner database/sql driver does
+	// not support request tags, so the tag can only be used for statements
+	// that are executed with the Spanner client library. These are the gorm
+	// statements in a RunHybridTransaction or RunHybridReadOnlyTransaction,
+	// and the queries of QueryRows, FindStructs, ScanTable and ExportCSV.
+	// Statements that are executed by the driver fail with
+	// ErrTagsNotSupported if the context has a request tag.
+	RequestTag string
+	// TransactionTag is the tag that is added to read/write transactions, and
+	// that is shown in the transaction statistics of Spanner. The Spanner
+	// database/sql driver does not support transaction tags, so the tag can
+	// only be used for transactions that are committed with the Spanner
+	// client library. These are the transactions of RunHybridTransaction, the
+	// mutations of WithMutations that are written outside of a transaction,
+	// and the batches of ImportCSV. Read/write transactions and DML
+	// statements that are executed by the driver fail with
+	// ErrTagsNotSupported if the context has a transaction tag.
+	TransactionTag string
+}
+
+// ErrTagsNotSupported is returned for statements and transactions that are
+// executed by the Spanner database/sql driver with a context that has a
+// request tag or a transaction tag. The driver does not support tags, and
+// would silently drop them. Use RunHybridTransaction to execute tagged gorm
+// statements.
+var ErrTagsNotSupported = errors.New("spanner: request and transaction tags are not supported by the database/sql driver")
+
+// checkDriverTags returns ErrTagsNotSupported if the request options of the
+// given context have a request tag, or a transaction tag for a statement or
+// transaction that writes.
+func checkDriverTags(ctx context.Context, write bool) error {
+	options := requestOptions(ctx)
+	if options.RequestTag != "" || write && options.TransactionTag != "" {
+		return ErrTagsNotSupported
+	}
+	return nil
+}
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a context that sends the given request options
+// to Spanner for all statements that are executed with the context.
+//
+// The Spanner database/sql driver only supports setting the priority for a
+// connection, so the priority is applied by executing the statements and
+// transactions on a separate connection pool for each priority. These
+// connection pools are opened when a priority is first used, and use the same
+// connection string as the gorm database with an additional rpcPriority
+// property. They are closed when the connection pool of the gorm database that
+// is returned by db.DB() is closed. Priorities can therefore only be used with
+// a dialector that was created with a DSN. Statements and transactions with a
+// priority fail with ErrPriorityNotSupported for other dialectors, for example
+// a dialector with a connection pool in Config.Conn. Statements in a
+// transaction are executed with the priority of the transaction.
+//
+// Example:
+//
+//	ctx := spannergorm.WithRequestOptions(context.Background(), spannergorm.RequestOptions{
+//	  Priority: spannerpb.RequestOptions_PRIORITY_LOW,
+//	})
+//	db.WithContext(ctx).Where("active = ?", false).Delete(&Singer{})
+//
+//	// Request tags can only be used with the Spanner client library.
+//	ctx = spannergorm.WithRequestOptions(ctx, spannergorm.RequestOptions{RequestTag: "nightly-batch"})
+//	err := spannergorm.QueryRows(db.WithContext(ctx).Model(&Singer{}), func(row *spanner.Row) error { ... })
+func WithRequestOptions(ctx context.Context, options RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, options)
+}
+
+// WithTransactionTag returns a session that adds the given transaction tag to
+// the read/write transactions that are executed with the session. The other
+// request options of the context of the session are kept. See
+// RequestOptions.TransactionTag for the transactions that support tags.
+//
+// Example:
+//
+//	tx := spannergorm.WithTransactionTag(db, "checkout-flow")
+//	_, err := spannergorm.RunHybridTransaction(tx.Statement.Context, tx, func(tx *gorm.DB, _ *spanner.ReadWriteTransaction) error {
+//	  return tx.Create(&order).Error
+//	})
+func WithTransactionTag(db *gorm.DB, tag string) *gorm.DB {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	options := requestOptions(ctx)
+	options.TransactionTag = tag
+	return db.WithContext(WithRequestOptions(ctx, options))
+}
+
+// TransactionTag returns the transaction tag of the request options of the
+// given context, or an empty string if the context has no transaction tag.
+func TransactionTag(ctx context.Context) string {
+	return requestOptions(ctx).TransactionTag
+}
+
+// requestOptions returns the request options of the given context.
+func requestOptions(ctx context.Context) RequestOptions {
+	if ctx == nil {
+		return RequestOptions{}
+	}
+	options, _ := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return options
+}
+
+// queryOptions returns the options for queries that are executed with the
+// Spanner client library.
+func (o RequestOptions) queryOptions() spanner.QueryOptions {
+	return spanner.QueryOptions{Priority: o.Priority, RequestTag: o.RequestTag}
+}
+
+// requestTag returns the request tag for a statement with the given operation
+// on the given table. This is the tag in the request options of the context if
+// there is one, and otherwise the tag of Config.RequestTagTemplate, or an
+// automatic tag if AutoRequestTags is enabled.
+func (dialector Dialector) requestTag(ctx context.Context, operation, table string) string {
+	if tag := requestOptions(ctx).RequestTag; tag != "" {
+		return tag
+	}
+	if dialector.Config == nil {
+		return ""
+	}
+	return defaultTag(dialector.RequestTagTemplate, dialector.AutoRequestTags, operation, table)
+}
+
+// transactionTag returns the transaction tag for a transaction that only
+// executes the given operation on the given table.
+func (dialector Dialector) transactionTag(ctx context.Context, operation, table string) string {
+	if tag := requestOptions(ctx).TransactionTag; tag != "" {
+		return tag
+	}
+	if dialector.Config == nil {
+		return ""
+	}
+	return defaultTag(dialector.TransactionTagTemplate, dialector.AutoRequestTags, operation, table)
+}
+
+// defaultTag returns the tag for a request or transaction without an explicit
+// tag. This is the expanded template if there is one, and otherwise an
+// automatic tag if auto is set.
+func defaultTag(template string, auto bool, operation, table string) string {
+	if template != "" {
+		return expandTagTemplate(template, operation, table)
+	}
+	if !auto {
+		return ""
+	}
+	return automaticTag(operation, table)
+}
+
+// expandTagTemplate replaces the {operation} and {table} placeholders of the
+// given template. The tag is truncated to maxAutomaticTagLength characters.
+func expandTagTemplate(template, operation, table string) string {
+	tag := strings.NewReplacer("{operation}", operation, "{table}", table).Replace(template)
+	if len(tag) > maxAutomaticTagLength {
+		tag = tag[:maxAutomaticTagLength]
+	}
+	return tag
+}
+
+// AutomaticTagPrefix is the prefix of the tags that are added to requests
+// and transactions if Config.AutoRequestTags is set. Use it to filter the
+// statistics of GetTransactionStats and GetLockStats.
+const AutomaticTagPrefix = "gorm_"
+
+// maxAutomaticTagLength is the maximum length of an automatic tag. Spanner
+// truncates tags that are longer than 50 characters in its statistics.
+const maxAutomaticTagLength = 50
+
+// automaticTag returns the tag for the given operation on the given table,
+// e.g. gorm_insert_singers. Characters that are not letters, digits or
+// underscores are replaced with underscores.
+func automaticTag(operation, table string) string {
+	tag := []byte(AutomaticTagPrefix + operation)
+	if table != "" {
+		tag = append(tag, '_')
+		tag = append(tag, table...)
+	}
+	for i, c := range tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			tag[i] = '_'
+		}
+	}
+	if len(tag) > maxAutomaticTagLength {
+		tag = tag[:maxAutomaticTagLength]
+	}
+	return string(tag)
+}
+
+// ErrPriorityNotSupported is returned for statements and transactions with a
+// request priority that are executed on a gorm database whose dialector was
+// not created with a DSN, for example a dialector with a connection pool in
+// Config.Conn. The priority is set by opening a connection pool for each
+// priority, which requires the connection string of the database.
+var ErrPriorityNotSupported = errors.New("spanner: request priorities are only supported for a dialector that was created with a DSN")
+
+// db returns the connection pool that should be used for statements that are
+// executed with the given context. It returns ErrPriorityNotSupported if the
+// context has a priority, and p was not opened from a DSN.
+func (p *connPool) db(ctx context.Context) (*sql.DB, error) {
+	priority := requestOptions(ctx).Priority
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if priority == spannerpb.RequestOptions_PRIORITY_UNSPECIFIED || p.closed {
+		return p.DB, nil
+	}
+	if p.dsn == "" {
+		return nil, ErrPriorityNotSupported
+	}
+	if db, ok := p.priorityPools[priority]; ok {
+		return db, nil
+	}
+	name := strings.TrimPrefix(priority.String(), "PRIORITY_")
+	db, err := sql.Open(p.driverName, p.dsn+";rpcPriority="+name)
+	if err != nil {
+		return nil, err
+	}
+	if p.priorityPools == nil {
+		p.priorityPools = make(map[spannerpb.RequestOptions_Priority]*sql.DB)
+	}
+	p.priorityPools[priority] = db
+	return db, nil
+}
+
+// supportsPriority returns true if the request priority of a statement can be
+// applied to statements that are executed on the given connection pool.
+// Statements in a transaction use the priority of the transaction, and the
+// statements of the migrator use the default priority.
+func supportsPriority(pool gorm.ConnPool) bool {
+	switch p := unwrapConnPool(pool).(type) {
+	case *connPool:
+		return p.dsn != ""
+	case *connTx, *migratorConn, *hybridConnPool:
+		return true
+	}
+	return false
+}
+
+// registerRequestOptionsCallbacks registers callbacks that bypass the cache
+// of prepared statements for statements with request options. Prepared
+// statements are bound to the connection pool that prepared them, which is
+// not necessarily the connection pool of the priority of the statement, and
+// are executed without the checks of the tags of the statement. The callbacks
+// also add automatic request tags to the statements of hybrid transactions.
+func registerRequestOptionsCallbacks(db *gorm.DB) error {
+	bypass := func(operation string) func(db *gorm.DB) {
+		return func(db *gorm.DB) {
+			options := requestOptions(db.Statement.Context)
+			// Hybrid transactions execute statements with the client library,
+			// which supports tags.
+			_, hybrid := db.Statement.ConnPool.(*hybridConnPool)
+			if hybrid && options.RequestTag == "" {
+				if dialector, err := spannerDialector(db); err == nil {
+					if options.RequestTag = dialector.requestTag(db.Statement.Context, operation, db.Statement.Table); options.RequestTag != "" {
+						db.Statement.Context = WithRequestOptions(db.Statement.Context, options)
+					}
+				}
+			}
+			if options == (RequestOptions{}) {
+				return
+			}
+			// The driver would silently drop the request tag of the statement.
+			if options.RequestTag != "" && !db.DryRun && !hybrid {
+				_ = db.AddError(ErrTagsNotSupported)
+				return
+			}
+			if options.Priority != spannerpb.RequestOptions_PRIORITY_UNSPECIFIED && !db.DryRun && !supportsPriority(db.Statement.ConnPool) {
+				_ = db.AddError(ErrPriorityNotSupported)
+				return
+			}
+			switch p := db.Statement.ConnPool.(type) {
+			case *gorm.PreparedStmtDB:
+				db.Statement.ConnPool = p.ConnPool
+			case *gorm.PreparedStmtTX:
+				db.Statement.ConnPool = p.Tx
+			}
+		}
+	}
+	if err := db.Callback().Create().Before("*").Register("gorm:spanner:request_options", bypass("insert")); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("*").Register("gorm:spanner:request_options", bypass("query")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("*").Register("gorm:spanner:request_options", bypass("update")); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("*").Register("gorm:spanner:request_options", bypass("delete")); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("*").Register("gorm:spanner:request_options", bypass("query")); err != nil {
+		return err
+	}
+	return db.Callback().Raw().Before("*").Register("gorm:spanner:request_options", bypass("raw"))
+}
+
+// sqlDB returns the connection pool that should be used for statements of the
+// given gorm database that are executed outside of a transaction.
+func sqlDB(ctx context.Context, db *gorm.DB) (*sql.DB, error) {
+	if p, ok := unwrapConnPool(db.ConnPool).(*connPool); ok {
+		return p.db(ctx)
+	}
+	if requestOptions(ctx).Priority != spannerpb.RequestOptions_PRIORITY_UNSPECIFIED {
+		return nil, ErrPriorityNotSupported
+	}
+	return db.DB()
+}
@@ -0,0 +1,364 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+func TestWithRequestOptions(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	updateSql := "UPDATE `singers` SET `active`=@p1,`updated_at`=@p2 WHERE last_name = @p3 AND `singers`.`deleted_at` IS NULL"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	ctx := WithRequestOptions(context.Background(), RequestOptions{Priority: spannerpb.RequestOptions_PRIORITY_LOW})
+
+	// Statements outside of a transaction.
+	if err := db.WithContext(ctx).Model(&singer{}).Where("last_name = ?", "Doe").Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).GetRequestOptions().GetPriority(), spannerpb.RequestOptions_PRIORITY_LOW; g != w {
+		t.Fatalf("priority mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// Statements without request options use the default priority.
+	if err := db.Model(&singer{}).Where("last_name = ?", "Doe").Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).GetRequestOptions().GetPriority(), spannerpb.RequestOptions_PRIORITY_UNSPECIFIED; g != w {
+		t.Fatalf("priority mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Statements and the commit of a transaction.
+	if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Model(&singer{}).Where("last_name = ?", "Doe").Update("active", false).Error
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	for _, req := range requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		if g, w := req.(*spannerpb.ExecuteSqlRequest).GetRequestOptions().GetPriority(), spannerpb.RequestOptions_PRIORITY_LOW; g != w {
+			t.Fatalf("statement priority mismatch\n Got: %v\nWant: %v", g, w)
+		}
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := commitReqs[0].(*spannerpb.CommitRequest).GetRequestOptions().GetPriority(), spannerpb.RequestOptions_PRIORITY_LOW; g != w {
+		t.Fatalf("commit priority mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWithRequestOptionsQueryRows(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+	ctx := WithRequestOptions(context.Background(), RequestOptions{
+		Priority:   spannerpb.RequestOptions_PRIORITY_MEDIUM,
+		RequestTag: "nightly-batch",
+	})
+	if err := QueryRows(db.WithContext(ctx).Model(&singerWithCommitTimestamp{}), func(row *spanner.Row) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	options := getLastSqlRequest(server).GetRequestOptions()
+	if g, w := options.GetPriority(), spannerpb.RequestOptions_PRIORITY_MEDIUM; g != w {
+		t.Fatalf("priority mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := options.GetRequestTag(), "nightly-batch"; g != w {
+		t.Fatalf("request tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestWithTransactionTag(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	drainRequestsFromServer(server.TestSpanner)
+	ctx := WithRequestOptions(context.Background(), RequestOptions{Priority: spannerpb.RequestOptions_PRIORITY_LOW})
+	tx := WithTransactionTag(WithMutations(db.WithContext(ctx).Session(&gorm.Session{SkipDefaultTransaction: true})), "checkout-flow")
+	if g, w := requestOptions(tx.Statement.Context), (RequestOptions{Priority: spannerpb.RequestOptions_PRIORITY_LOW, TransactionTag: "checkout-flow"}); g != w {
+		t.Fatalf("request options mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if err := tx.Delete(&singerWithCommitTimestamp{ID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := commitReqs[0].(*spannerpb.CommitRequest).GetRequestOptions().GetTransactionTag(), "checkout-flow"; g != w {
+		t.Fatalf("transaction tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestAutoRequestTags(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{AutoRequestTags: true})
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+	if err := QueryRows(db.Model(&singerWithCommitTimestamp{}), func(row *spanner.Row) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).GetRequestOptions().GetRequestTag(), "gorm_query_singers"; g != w {
+		t.Fatalf("request tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// A request tag in the request options is used instead of the automatic tag.
+	ctx := WithRequestOptions(context.Background(), RequestOptions{RequestTag: "nightly-batch"})
+	if err := QueryRows(db.WithContext(ctx).Model(&singerWithCommitTimestamp{}), func(row *spanner.Row) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).GetRequestOptions().GetRequestTag(), "nightly-batch"; g != w {
+		t.Fatalf("request tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	drainRequestsFromServer(server.TestSpanner)
+	tx := WithMutations(db.Session(&gorm.Session{SkipDefaultTransaction: true}))
+	if err := tx.Create(&singerWithCommitTimestamp{ID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := commitReqs[0].(*spannerpb.CommitRequest).GetRequestOptions().GetTransactionTag(), "gorm_insert_singers"; g != w {
+		t.Fatalf("transaction tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The statements of hybrid transactions are tagged with the operation
+	// and the table of the statement.
+	if _, err := RunHybridTransaction(context.Background(), db, func(tx *gorm.DB, rwTx *spanner.ReadWriteTransaction) error {
+		var singers []singerWithCommitTimestamp
+		return tx.Find(&singers).Error
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).GetRequestOptions().GetRequestTag(), "gorm_query_singers"; g != w {
+		t.Fatalf("request tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestAutomaticTag(t *testing.T) {
+	for _, test := range []struct {
+		operation string
+		table     string
+		want      string
+	}{
+		{"insert", "singers", "gorm_insert_singers"},
+		{"query", "", "gorm_query"},
+		{"update", "my-schema.albums", "gorm_update_my_schema_albums"},
+		{"delete", "a_very_long_table_name_that_exceeds_the_maximum", "gorm_delete_a_very_long_table_name_that_exceeds_th"},
+	} {
+		if g, w := automaticTag(test.operation, test.table), test.want; g != w {
+			t.Errorf("%s %s: tag mismatch\n Got: %v\nWant: %v", test.operation, test.table, g, w)
+		}
+	}
+}
+
+func TestTagTemplates(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{
+		AutoRequestTags:        true,
+		RequestTagTemplate:     "orders-{operation}-{table}",
+		TransactionTagTemplate: "orders-tx-{operation}",
+	})
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+	if err := QueryRows(db.Model(&singerWithCommitTimestamp{}), func(row *spanner.Row) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSqlRequest(server).GetRequestOptions().GetRequestTag(), "orders-query-singers"; g != w {
+		t.Fatalf("request tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	drainRequestsFromServer(server.TestSpanner)
+	if _, err := RunHybridTransaction(context.Background(), db, func(tx *gorm.DB, rwTx *spanner.ReadWriteTransaction) error {
+		var singers []singerWithCommitTimestamp
+		return tx.Find(&singers).Error
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	sqlReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(sqlReqs), 1; g != w {
+		t.Fatalf("sql request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := sqlReqs[0].(*spannerpb.ExecuteSqlRequest).GetRequestOptions().GetRequestTag(), "orders-query-singers"; g != w {
+		t.Fatalf("request tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := commitReqs[0].(*spannerpb.CommitRequest).GetRequestOptions().GetTransactionTag(), "orders-tx-transaction"; g != w {
+		t.Fatalf("transaction tag mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestExpandTagTemplate(t *testing.T) {
+	for _, test := range []struct {
+		template  string
+		operation string
+		table     string
+		want      string
+	}{
+		{"{operation}_{table}", "insert", "singers", "insert_singers"},
+		{"checkout", "query", "orders", "checkout"},
+		{"app-{table}-{table}", "delete", "albums", "app-albums-albums"},
+		{"{table}", "query", "a_very_long_table_name_that_exceeds_the_maximum_tag_length", "a_very_long_table_name_that_exceeds_the_maximum_ta"},
+	} {
+		if g, w := expandTagTemplate(test.template, test.operation, test.table), test.want; g != w {
+			t.Errorf("%s: tag mismatch\n Got: %v\nWant: %v", test.template, g, w)
+		}
+	}
+}
+
+func TestWithRequestOptionsClosesPriorityPools(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	_ = server.TestSpanner.PutStatementResult("DELETE FROM `singers` WHERE last_name = @p1", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	ctx := WithRequestOptions(context.Background(), RequestOptions{Priority: spannerpb.RequestOptions_PRIORITY_LOW})
+	if err := db.WithContext(ctx).Exec("DELETE FROM `singers` WHERE last_name = ?", "Doe").Error; err != nil {
+		t.Fatal(err)
+	}
+	pool := unwrapConnPool(db.ConnPool).(*connPool)
+	priorityPool, err := pool.db(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priorityPool == pool.DB {
+		t.Fatal("statement with a priority did not use a separate connection pool")
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := priorityPool.Ping(), "sql: database is closed"; g == nil || g.Error() != w {
+		t.Fatalf("priority pool error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// No new connection pools are opened after the database has been closed.
+	if g, _ := pool.db(ctx); g != sqlDB {
+		t.Fatalf("connection pool mismatch\n Got: %p\nWant: %p", g, sqlDB)
+	}
+}
+
+func TestPriorityNotSupportedWithConn(t *testing.T) {
+	t.Parallel()
+
+	server, _, teardown := setupMockedTestServer(t)
+	defer teardown()
+	_ = putDialectResult(server, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+	sqlDB, err := sql.Open("spanner", fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	db, err := gorm.Open(New(Config{Conn: sqlDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestOptions(context.Background(), RequestOptions{Priority: spannerpb.RequestOptions_PRIORITY_LOW})
+	if g, w := db.WithContext(ctx).Where("active = ?", false).Delete(&singer{}).Error, ErrPriorityNotSupported; !errors.Is(g, w) {
+		t.Fatalf("delete error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return nil
+	}), ErrPriorityNotSupported; !errors.Is(g, w) {
+		t.Fatalf("transaction error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	var count int64
+	pool := unwrapConnPool(db.ConnPool).(*connPool)
+	if g, w := pool.QueryRowContext(ctx, "SELECT 1").Scan(&count), ErrPriorityNotSupported; !errors.Is(g, w) {
+		t.Fatalf("query row error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestTagsNotSupportedByDriver(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	ctx := WithRequestOptions(context.Background(), RequestOptions{RequestTag: "nightly-batch"})
+	if g, w := db.WithContext(ctx).Where("active = ?", false).Delete(&singer{}).Error, ErrTagsNotSupported; !errors.Is(g, w) {
+		t.Fatalf("delete error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	var singers []singer
+	if g, w := db.WithContext(ctx).Find(&singers).Error, ErrTagsNotSupported; !errors.Is(g, w) {
+		t.Fatalf("query error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := WithTransactionTag(db, "checkout-flow").Transaction(func(tx *gorm.DB) error {
+		return nil
+	}), ErrTagsNotSupported; !errors.Is(g, w) {
+		t.Fatalf("transaction error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := WithTransactionTag(db, "checkout-flow").Exec("DELETE FROM singers WHERE TRUE").Error, ErrTagsNotSupported; !errors.Is(g, w) {
+		t.Fatalf("exec error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	var count int64
+	pool := unwrapConnPool(db.ConnPool).(*connPool)
+	if g, w := pool.QueryRowContext(ctx, "SELECT COUNT(*) FROM singers").Scan(&count), ErrTagsNotSupported; !errors.Is(g, w) {
+		t.Fatalf("query row error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
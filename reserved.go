@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reservedWords are the reserved keywords of the GoogleSQL dialect. These must
+// be quoted when they are used as identifiers.
+// See https://cloud.google.com/spanner/docs/reference/standard-sql/lexical#reserved_keywords
+var reservedWords = map[string]bool{
+	"ALL": true, "AND": true, "ANY": true, "ARRAY": true, "AS": true, "ASC": true,
+	"ASSERT_ROWS_MODIFIED": true, "AT": true, "BETWEEN": true, "BY": true,
+	"CASE": true, "CAST": true, "COLLATE": true, "CONTAINS": true, "CREATE": true,
+	"CROSS": true, "CUBE": true, "CURRENT": true, "DEFAULT": true, "DEFINE": true,
+	"DESC": true, "DISTINCT": true, "ELSE": true, "END": true, "ENUM": true,
+	"ESCAPE": true, "EXCEPT": true, "EXCLUDE": true, "EXISTS": true,
+	"EXTRACT": true, "FALSE": true, "FETCH": true, "FOLLOWING": true, "FOR": true,
+	"FROM": true, "FULL": true, "GROUP": true, "GROUPING": true, "GROUPS": true,
+	"HASH": true, "HAVING": true, "IF": true, "IGNORE": true, "IN": true,
+	"INNER": true, "INTERSECT": true, "INTERVAL": true, "INTO": true, "IS": true,
+	"JOIN": true, "LATERAL": true, "LEFT": true, "LIKE": true, "LIMIT": true,
+	"LOOKUP": true, "MERGE": true, "NATURAL": true, "NEW": true, "NO": true,
+	"NOT": true, "NULL": true, "NULLS": true, "OF": true, "ON": true, "OR": true,
+	"ORDER": true, "OUTER": true, "OVER": true, "PARTITION": true,
+	"PRECEDING": true, "PROTO": true, "RANGE": true, "RECURSIVE": true,
+	"RESPECT": true, "RIGHT": true, "ROLLUP": true, "ROWS": true, "SELECT": true,
+	"SET": true, "SOME": true, "STRUCT": true, "TABLESAMPLE": true, "THEN": true,
+	"TO": true, "TREAT": true, "TRUE": true, "UNBOUNDED": true, "UNION": true,
+	"UNNEST": true, "USING": true, "WHEN": true, "WHERE": true, "WINDOW": true,
+	"WITH": true, "WITHIN": true,
+}
+
+// IsReservedWord returns true if the given identifier is a reserved keyword in
+// the GoogleSQL dialect, and must be quoted when it is used as an identifier.
+func IsReservedWord(identifier string) bool {
+	return reservedWords[strings.ToUpper(identifier)]
+}
+
+// quoteIfReserved quotes the given identifier if it is a reserved keyword.
+// Other identifiers are returned unmodified.
+func quoteIfReserved(identifier string) string {
+	if IsReservedWord(identifier) {
+		return "`" + identifier + "`"
+	}
+	return identifier
+}
+
+// quoteReservedRawColumn quotes the name of a raw column in an ORDER BY or
+// GROUP BY clause if it only consists of a reserved keyword, optionally
+// followed by a sort direction. Raw columns are not quoted by gorm, which
+// means that for example Order("order desc") would otherwise generate invalid
+// SQL. Other raw expressions are not modified.
+func quoteReservedRawColumn(column clause.Column) clause.Column {
+	if !column.Raw {
+		return column
+	}
+	parts := strings.Fields(column.Name)
+	switch len(parts) {
+	case 1:
+	case 2:
+		if direction := strings.ToUpper(parts[1]); direction != "ASC" && direction != "DESC" {
+			return column
+		}
+	default:
+		return column
+	}
+	if !IsReservedWord(parts[0]) {
+		return column
+	}
+	parts[0] = quoteIfReserved(parts[0])
+	column.Name = strings.Join(parts, " ")
+	return column
+}
+
+// registerReservedWordQuoting registers clause builders that quote reserved
+// keywords that are used as raw column names in ORDER BY and GROUP BY
+// clauses. Identifiers that are generated by gorm are always quoted by the
+// dialector. The previously registered builders for these clauses are called
+// afterwards.
+func registerReservedWordQuoting(db *gorm.DB) {
+	wrap := func(name string, quote func(c clause.Clause) clause.Clause) {
+		next := db.ClauseBuilders[name]
+		db.ClauseBuilders[name] = func(c clause.Clause, builder clause.Builder) {
+			c = quote(c)
+			if next != nil {
+				next(c, builder)
+			} else {
+				c.Build(builder)
+			}
+		}
+	}
+	wrap(clause.OrderBy{}.Name(), func(c clause.Clause) clause.Clause {
+		orderBy, ok := c.Expression.(clause.OrderBy)
+		if !ok {
+			return c
+		}
+		columns := make([]clause.OrderByColumn, len(orderBy.Columns))
+		for i, column := range orderBy.Columns {
+			column.Column = quoteReservedRawColumn(column.Column)
+			columns[i] = column
+		}
+		orderBy.Columns = columns
+		c.Expression = orderBy
+		return c
+	})
+	wrap(clause.GroupBy{}.Name(), func(c clause.Clause) clause.Clause {
+		groupBy, ok := c.Expression.(clause.GroupBy)
+		if !ok {
+			return c
+		}
+		columns := make([]clause.Column, len(groupBy.Columns))
+		for i, column := range groupBy.Columns {
+			columns[i] = quoteReservedRawColumn(column)
+		}
+		groupBy.Columns = columns
+		c.Expression = groupBy
+		return c
+	})
+}
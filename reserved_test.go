@@ -0,0 +1,70 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type reservedWordModel struct {
+	ID       int64 `gorm:"primaryKey;autoIncrement:false"`
+	Order    int64
+	Interval string
+}
+
+func TestReservedWordQuoting(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+	dryRun := db.Session(&gorm.Session{DryRun: true})
+
+	var results []reservedWordModel
+	stmt := dryRun.Model(&reservedWordModel{}).
+		Select("?, COUNT(*)", clause.Column{Name: "interval"}).
+		Group("interval").
+		Order("order desc").
+		Order("id").
+		Find(&results).Statement
+	if g, w := stmt.SQL.String(), "SELECT `interval`, COUNT(*) FROM `reserved_word_models` GROUP BY `interval` ORDER BY `order` desc,id"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	stmt = dryRun.Create(&reservedWordModel{ID: 1, Order: 1, Interval: "day"}).Statement
+	if g, w := stmt.SQL.String(), "INSERT INTO `reserved_word_models` (`id`,`order`,`interval`) VALUES (?,?,?)"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestQuoteReservedRawColumn(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		column clause.Column
+		want   string
+	}{
+		{clause.Column{Name: "order", Raw: true}, "`order`"},
+		{clause.Column{Name: "Interval ASC", Raw: true}, "`Interval` ASC"},
+		{clause.Column{Name: "name desc", Raw: true}, "name desc"},
+		{clause.Column{Name: "order + 1", Raw: true}, "order + 1"},
+		{clause.Column{Name: "order"}, "order"},
+	} {
+		if g, w := quoteReservedRawColumn(test.column).Name, test.want; g != w {
+			t.Errorf("quoted name mismatch for %q\n Got: %v\nWant: %v", test.column.Name, g, w)
+		}
+	}
+}
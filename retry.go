@@ -0,0 +1,105 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"time"
+
+	vkit "cloud.google.com/go/spanner/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+)
+
+// RetryConfig contains the timeout and retry settings for the RPCs of the
+// Spanner client of the dialector that execute queries and DML statements,
+// and that begin and commit transactions. See
+// Config.SpannerClientRetryConfig. Fields that are not set use the default
+// value that is documented on the field. RPCs that are not covered by
+// RetryConfig use the default settings of the Spanner client library.
+type RetryConfig struct {
+	// Timeout is the timeout of each unary RPC. Defaults to 60 seconds. The
+	// timeout is not applied to streaming queries and reads, as it would also
+	// limit the time that is available for consuming the results.
+	Timeout time.Duration
+	// RetryableCodes are the error codes that are retried. Defaults to
+	// Unavailable and ResourceExhausted.
+	RetryableCodes []codes.Code
+	// InitialBackoff is the time to wait before the first retry. Defaults to
+	// 250 milliseconds.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time to wait between two retries. Defaults to
+	// 32 seconds.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the backoff is increased after each
+	// retry. Defaults to 1.3.
+	Multiplier float64
+}
+
+// DefaultRetryConfig returns the default retry settings.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Timeout:        60 * time.Second,
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+		InitialBackoff: 250 * time.Millisecond,
+		MaxBackoff:     32 * time.Second,
+		Multiplier:     1.3,
+	}
+}
+
+// withDefaults returns a copy of the config where all fields that are not set
+// have their default value.
+func (c RetryConfig) withDefaults() RetryConfig {
+	defaults := DefaultRetryConfig()
+	if c.Timeout <= 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if len(c.RetryableCodes) == 0 {
+		c.RetryableCodes = defaults.RetryableCodes
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaults.InitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaults.MaxBackoff
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = defaults.Multiplier
+	}
+	return c
+}
+
+// callOptions returns the call options of the Spanner client library for the
+// retry settings.
+func (c RetryConfig) callOptions() *vkit.CallOptions {
+	c = c.withDefaults()
+	retry := gax.WithRetry(func() gax.Retryer {
+		return gax.OnCodes(c.RetryableCodes, gax.Backoff{
+			Initial:    c.InitialBackoff,
+			Max:        c.MaxBackoff,
+			Multiplier: c.Multiplier,
+		})
+	})
+	unary := []gax.CallOption{gax.WithTimeout(c.Timeout), retry}
+	streaming := []gax.CallOption{retry}
+	return &vkit.CallOptions{
+		ExecuteSql:          unary,
+		ExecuteStreamingSql: streaming,
+		ExecuteBatchDml:     unary,
+		Read:                unary,
+		StreamingRead:       streaming,
+		BeginTransaction:    unary,
+		Commit:              unary,
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+)
+
+func TestRetryConfigWithDefaults(t *testing.T) {
+	config := RetryConfig{Timeout: 5 * time.Second, RetryableCodes: []codes.Code{codes.Aborted}}.withDefaults()
+	if g, w := config.Timeout, 5*time.Second; g != w {
+		t.Fatalf("timeout mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := config.RetryableCodes, []codes.Code{codes.Aborted}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("retryable codes mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	defaults := DefaultRetryConfig()
+	if g, w := config.InitialBackoff, defaults.InitialBackoff; g != w {
+		t.Fatalf("initial backoff mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := config.MaxBackoff, defaults.MaxBackoff; g != w {
+		t.Fatalf("max backoff mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := config.Multiplier, defaults.Multiplier; g != w {
+		t.Fatalf("multiplier mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(config.callOptions().ExecuteSql), 2; g != w {
+		t.Fatalf("unary call option count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// Streaming calls must not have a timeout.
+	if g, w := len(config.callOptions().ExecuteStreamingSql), 1; g != w {
+		t.Fatalf("streaming call option count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestQueryRowsWithRetryConfig(t *testing.T) {
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{
+		SpannerClientRetryConfig: &RetryConfig{Timeout: 10 * time.Second},
+	})
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+	count := 0
+	if err := QueryRows(db.Model(&singerWithCommitTimestamp{}), func(row *spanner.Row) error {
+		count++
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to query rows: %v", err)
+	}
+	if g, w := count, 1; g != w {
+		t.Fatalf("row count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"gorm.io/gorm"
+)
+
+const returningTransactionKey = "gorm:spanner:started_returning_transaction"
+
+var thenReturnRegExp = regexp.MustCompile(`(?i)\bTHEN\s+RETURN\b`)
+
+// isDMLWithReturning returns true if the given statement is a DML statement
+// with a THEN RETURN clause.
+func isDMLWithReturning(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "INSERT", "UPDATE", "DELETE":
+		return thenReturnRegExp.MatchString(query)
+	}
+	return false
+}
+
+// registerReturningCallbacks registers the callbacks that make it possible to
+// execute DML statements with a THEN RETURN clause as a query, for example:
+//
+//	var results []map[string]interface{}
+//	db.Raw("UPDATE singers SET active=true WHERE id=? THEN RETURN *", 1).Find(&results)
+//
+// Spanner executes queries outside of transactions in a read-only transaction,
+// which means that these statements must be executed in a read/write
+// transaction instead. The values that are returned for Spanner-specific types
+// are converted to generic Go types when the result is scanned into a map.
+//
+// Scan and Rows return the rows of the statement to the caller before the
+// transaction could be committed. These can therefore only be used for DML
+// statements with a THEN RETURN clause inside a transaction.
+func registerReturningCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Row().Before("gorm:row").Register("gorm:spanner:check_returning_transaction", checkReturningTransaction); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("gorm:spanner:begin_returning_transaction", beginReturningTransaction); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("gorm:spanner:commit_returning_transaction", commitReturningTransaction); err != nil {
+		return err
+	}
+	return db.Callback().Query().After("gorm:query").Register("gorm:spanner:convert_map_values", convertMapValues)
+}
+
+func beginReturningTransaction(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || !isDMLWithReturning(db.Statement.SQL.String()) {
+		return
+	}
+	if tx := db.Begin(); tx.Error == nil {
+		db.Statement.ConnPool = tx.Statement.ConnPool
+		db.InstanceSet(returningTransactionKey, true)
+	} else if tx.Error != gorm.ErrInvalidTransaction {
+		// ErrInvalidTransaction means that the statement is already executed
+		// in a transaction.
+		_ = db.AddError(tx.Error)
+	}
+}
+
+func checkReturningTransaction(db *gorm.DB) {
+	if db.Error != nil || !isDMLWithReturning(db.Statement.SQL.String()) {
+		return
+	}
+	if _, ok := unwrapConnPool(db.Statement.ConnPool).(gorm.TxCommitter); !ok {
+		_ = db.AddError(fmt.Errorf("DML statements with THEN RETURN must be executed with Find or in a transaction"))
+	}
+}
+
+func commitReturningTransaction(db *gorm.DB) {
+	if _, ok := db.InstanceGet(returningTransactionKey); !ok {
+		return
+	}
+	if db.Error != nil {
+		db.Rollback()
+	} else {
+		db.Commit()
+	}
+	db.Statement.ConnPool = db.ConnPool
+}
+
+// convertMapValues converts the Spanner-specific values in the maps that a
+// DML statement with a THEN RETURN clause was scanned into to generic Go
+// types. The results of other queries are not changed.
+func convertMapValues(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Dest == nil || !isDMLWithReturning(db.Statement.SQL.String()) {
+		return
+	}
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		convertMap(dest)
+	case *map[string]interface{}:
+		convertMap(*dest)
+	case *[]map[string]interface{}:
+		for _, m := range *dest {
+			convertMap(m)
+		}
+	}
+}
+
+func convertMap(m map[string]interface{}) {
+	for k, v := range m {
+		m[k] = convertSpannerValue(v)
+	}
+}
+
+// convertSpannerValue converts a value that is returned by the Spanner
+// database/sql driver to a generic Go type:
+//
+//   - NULL values are returned as nil.
+//   - JSON values are returned as the decoded JSON value, and the JSON value
+//     null is returned as JSONNull.
+//   - NUMERIC values are returned as *big.Rat.
+//   - ARRAY values are returned as []interface{} with converted elements.
+func convertSpannerValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case spanner.NullJSON:
+		if !value.Valid {
+			return nil
+		}
+		if value.Value == nil {
+			return JSONNull{}
+		}
+		return value.Value
+	case big.Rat:
+		return &value
+	case []byte:
+		return value
+	case driver.Valuer:
+		converted, err := value.Value()
+		if err != nil {
+			return v
+		}
+		if rat, ok := converted.(big.Rat); ok {
+			return &rat
+		}
+		return converted
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		if rv.IsNil() {
+			return nil
+		}
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = convertSpannerValue(rv.Index(i).Interface())
+		}
+		return result
+	}
+	return v
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type returningSinger struct {
+	ID     int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name   string
+	Rating int64
+}
+
+func TestReturningIntoMaps(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	updateSql := "UPDATE singers SET rating=rating+1 WHERE id=@p1 THEN RETURN id, name, rating, attributes, tags"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{
+				RowType: &spannerpb.StructType{
+					Fields: []*spannerpb.StructType_Field{
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, Name: "id"},
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, Name: "name"},
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_NUMERIC}, Name: "rating"},
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_JSON}, Name: "attributes"},
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_ARRAY, ArrayElementType: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}}, Name: "tags"},
+					},
+				},
+			},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{
+					structpb.NewStringValue("1"),
+					structpb.NewNullValue(),
+					structpb.NewStringValue("3.5"),
+					structpb.NewStringValue(`{"genre":"pop"}`),
+					structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("a"), structpb.NewNullValue()}}),
+				}},
+			},
+			Stats: &spannerpb.ResultSetStats{RowCount: &spannerpb.ResultSetStats_RowCountExact{RowCountExact: 1}},
+		},
+	})
+	drainRequestsFromServer(server.TestSpanner)
+
+	var results []map[string]interface{}
+	if err := db.Raw("UPDATE singers SET rating=rating+1 WHERE id=? THEN RETURN id, name, rating, attributes, tags", 1).Find(&results).Error; err != nil {
+		t.Fatalf("failed to execute update: %v", err)
+	}
+	if g, w := len(results), 1; g != w {
+		t.Fatalf("result count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := results[0]["id"], int64(1); g != w {
+		t.Errorf("id mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g := results[0]["name"]; g != nil {
+		t.Errorf("name mismatch\n Got: %v\nWant: %v", g, nil)
+	}
+	if g, w := results[0]["rating"], big.NewRat(7, 2); !reflect.DeepEqual(g, w) {
+		t.Errorf("rating mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := results[0]["attributes"], map[string]interface{}{"genre": "pop"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("attributes mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := results[0]["tags"], []interface{}{"a", nil}; !reflect.DeepEqual(g, w) {
+		t.Errorf("tags mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The statement must have been executed in a read/write transaction.
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	executeReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(executeReqs), 1; g != w {
+		t.Fatalf("execute request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if executeReqs[0].(*spannerpb.ExecuteSqlRequest).GetTransaction().GetSingleUse() != nil {
+		t.Fatalf("statement was not executed in a read/write transaction")
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Scan uses Rows, which cannot be executed in an implicit transaction.
+	err := db.Raw("UPDATE singers SET rating=rating+1 WHERE id=? THEN RETURN id, name, rating, attributes, tags", 1).Scan(&results).Error
+	if err == nil {
+		t.Fatal("missing expected error for Scan outside a transaction")
+	}
+}
+
+func TestUpdateReturning(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	updateSql := "UPDATE `returning_singers` SET `rating`=rating + 1 WHERE rating < @p1 THEN RETURN *"
+	_ = putReturningSingersResult(server, updateSql, []string{"id", "name", "rating"}, [][]string{
+		{"1", "Alice", "3"},
+		{"2", "Bob", "5"},
+	})
+	drainRequestsFromServer(server.TestSpanner)
+
+	var singers []returningSinger
+	res := db.Model(&singers).Clauses(clause.Returning{}).Where("rating < ?", 5).Update("rating", gorm.Expr("rating + 1"))
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if g, w := res.RowsAffected, int64(2); g != w {
+		t.Fatalf("rows affected mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := singers, []returningSinger{{ID: 1, Name: "Alice", Rating: 3}, {ID: 2, Name: "Bob", Rating: 5}}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("singers mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	executeReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(executeReqs), 1; g != w {
+		t.Fatalf("execute request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := executeReqs[0].(*spannerpb.ExecuteSqlRequest).Sql, updateSql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestDeleteReturning(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	deleteSql := "DELETE FROM `returning_singers` WHERE rating = @p1 THEN RETURN `id`,`name`"
+	_ = putReturningSingersResult(server, deleteSql, []string{"id", "name"}, [][]string{
+		{"3", "Carol"},
+	})
+
+	var deleted []returningSinger
+	res := db.Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "name"}}}).Where("rating = ?", 0).Delete(&deleted)
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if g, w := res.RowsAffected, int64(1); g != w {
+		t.Fatalf("rows affected mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := deleted, []returningSinger{{ID: 3, Name: "Carol"}}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("deleted mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+// putReturningSingersResult registers a result with the given columns for the
+// given DML statement. The name column is a STRING column, and all other
+// columns are INT64 columns.
+func putReturningSingersResult(server *testutil.MockedSpannerInMemTestServer, sql string, columns []string, rows [][]string) error {
+	fields := make([]*spannerpb.StructType_Field, len(columns))
+	for i, column := range columns {
+		code := spannerpb.TypeCode_INT64
+		if column == "name" {
+			code = spannerpb.TypeCode_STRING
+		}
+		fields[i] = &spannerpb.StructType_Field{Type: &spannerpb.Type{Code: code}, Name: column}
+	}
+	values := make([]*structpb.ListValue, len(rows))
+	for i, row := range rows {
+		values[i] = &structpb.ListValue{}
+		for _, value := range row {
+			values[i].Values = append(values[i].Values, structpb.NewStringValue(value))
+		}
+	}
+	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: fields}},
+			Rows:     values,
+			Stats:    &spannerpb.ResultSetStats{RowCount: &spannerpb.ResultSetStats_RowCountExact{RowCountExact: int64(len(rows))}},
+		},
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	"gorm.io/gorm"
+)
+
+// QueryRows executes the query of the given gorm database and calls f for
+// each row in the result. The rows are returned as *spanner.Row, which makes
+// it possible to decode types that cannot be represented by gorm, such as
+// STRUCT columns, by decoding the columns into a spanner.GenericColumnValue or
+// a struct with `spanner` tags.
+//
+// The query is executed directly with the Spanner client library as a
+// single-use read-only transaction. QueryRows returns ErrInTransaction if the
+// given gorm database is a transaction, as the query would not see the
+// uncommitted writes of the transaction. The read-only staleness that is set
+// with WithReadOnlyStaleness is applied to the query. QueryRows can only be
+// used with a dialector that was created with a DSN.
+//
+// Example:
+//
+//	err := spannergorm.QueryRows(db.Model(&Singer{}).Select("id, ARRAY(SELECT AS STRUCT title FROM albums WHERE albums.singer_id=singers.id) AS albums"),
+//	  func(row *spanner.Row) error {
+//	    var id int64
+//	    var albums []*struct{ Title string }
+//	    return row.Columns(&id, &albums)
+//	  })
+func QueryRows(db *gorm.DB, f func(row *spanner.Row) error) error {
+	iter, err := query(db)
+	if err != nil {
+		return err
+	}
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+}
+
+// query executes the query of the given gorm database directly with the
+// Spanner client library in a single-use read-only transaction.
+func query(db *gorm.DB) (*spanner.RowIterator, error) {
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNotInTransaction(db, "query"); err != nil {
+		return nil, err
+	}
+	var dest []map[string]interface{}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Find(&dest).Statement
+	if stmt.Error != nil {
+		return nil, stmt.Error
+	}
+	ctx := stmt.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	statement, err := toSpannerStatement(stmt.SQL.String(), stmt.Vars)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialector.spannerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bound := spanner.StrongRead()
+	if value, ok := db.Get(readOnlyStalenessKey); ok {
+		if b, ok := value.(spanner.TimestampBound); ok {
+			bound = b
+		}
+	}
+	options := requestOptions(ctx).queryOptions()
+	options.RequestTag = dialector.requestTag(ctx, "query", stmt.Table)
+	return client.Single().WithTimestampBound(bound).QueryWithOptions(ctx, statement, options), nil
+}
+
+// FindStructs executes the query of the given gorm database with QueryRows and
+// decodes the rows into dest, which must be a pointer to a slice of structs or
+// a pointer to a slice of pointers to structs. Use this function for queries
+// that return STRUCT values, such as `ARRAY(SELECT AS STRUCT ...)`, as these
+// cannot be scanned by the Spanner database/sql driver.
+//
+// The columns are mapped to the fields of the struct in the same way as the
+// Spanner client library does: a field is mapped to the column with the name
+// in its `spanner` tag, or otherwise to the column with the same name as the
+// field (case-insensitive). STRUCT columns are mapped to nested structs in the
+// same way. Columns without a corresponding field and fields without a
+// corresponding column are ignored.
+//
+// Example:
+//
+//	type SingerWithAlbums struct {
+//	  ID     int64 `spanner:"id"`
+//	  Albums []*struct {
+//	    Title string `spanner:"title"`
+//	  } `spanner:"albums"`
+//	}
+//	var singers []SingerWithAlbums
+//	err := spannergorm.FindStructs(db.Model(&Singer{}).Select("id, ARRAY(SELECT AS STRUCT title FROM albums WHERE albums.singer_id=singers.id) AS albums"), &singers)
+func FindStructs(db *gorm.DB, dest interface{}) error {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest must be a pointer to a slice, got %T", dest)
+	}
+	slice := value.Elem()
+	elemType := slice.Type().Elem()
+	isPointer := elemType.Kind() == reflect.Pointer
+	if isPointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("dest must be a pointer to a slice of structs, got %T", dest)
+	}
+	if db.Statement.Model == nil && db.Statement.Table == "" {
+		db = db.Model(reflect.New(elemType).Interface())
+	}
+	result := reflect.MakeSlice(slice.Type(), 0, 0)
+	err := QueryRows(db, func(row *spanner.Row) error {
+		elem := reflect.New(elemType)
+		if err := row.ToStructLenient(elem.Interface()); err != nil {
+			return err
+		}
+		if isPointer {
+			result = reflect.Append(result, elem)
+		} else {
+			result = reflect.Append(result, elem.Elem())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slice.Set(result)
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestQueryRows(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers` WHERE id=@p1"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+
+	var ids []int64
+	err := QueryRows(WithReadOnlyStaleness(db.Model(&singerWithCommitTimestamp{}).Where("id=?", 1), spanner.ExactStaleness(10*time.Second)),
+		func(row *spanner.Row) error {
+			var id spanner.GenericColumnValue
+			if err := row.ColumnByName("ID", &id); err != nil {
+				return err
+			}
+			var value int64
+			if err := id.Decode(&value); err != nil {
+				return err
+			}
+			ids = append(ids, value)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("failed to query rows: %v", err)
+	}
+	if g, w := len(ids), 1; g != w {
+		t.Fatalf("row count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := ids[0], int64(1); g != w {
+		t.Fatalf("id mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.Sql, querySql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p1"].GetStringValue(), "1"; g != w {
+		t.Fatalf("param mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if req.GetTransaction().GetSingleUse().GetReadOnly().GetExactStaleness() == nil {
+		t.Fatalf("query was not executed with exact staleness: %v", req.GetTransaction())
+	}
+}
+
+func TestToSpannerStatement(t *testing.T) {
+	stmt, err := toSpannerStatement("SELECT '?', `a?` FROM t WHERE a=? AND b=\"\\\"?\" AND c=?", []interface{}{1, "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := stmt.SQL, "SELECT '?', `a?` FROM t WHERE a=@p1 AND b=\"\\\"?\" AND c=@p2"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(stmt.Params), 2; g != w {
+		t.Fatalf("param count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if _, err := toSpannerStatement("SELECT ?", nil); err == nil {
+		t.Fatal("missing expected error for missing parameter value")
+	}
+}
+
+func TestFindStructs(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	type album struct {
+		Title string `spanner:"title"`
+	}
+	type singerWithAlbums struct {
+		ID     int64    `spanner:"id"`
+		Albums []*album `spanner:"albums"`
+	}
+	querySql := "SELECT id, ARRAY(SELECT AS STRUCT title FROM albums WHERE albums.singer_id=singers.id) AS albums FROM `singers`"
+	albumType := &spannerpb.Type{
+		Code: spannerpb.TypeCode_STRUCT,
+		StructType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+			{Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, Name: "title"},
+		}},
+	}
+	_ = server.TestSpanner.PutStatementResult(querySql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{
+				RowType: &spannerpb.StructType{
+					Fields: []*spannerpb.StructType_Field{
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, Name: "id"},
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_ARRAY, ArrayElementType: albumType}, Name: "albums"},
+					},
+				},
+			},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{
+					structpb.NewStringValue("1"),
+					structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{
+						structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("Title 1")}}),
+						structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("Title 2")}}),
+					}}),
+				}},
+			},
+		},
+	})
+
+	var singers []singerWithAlbums
+	if err := FindStructs(db.Table("singers").Select("id, ARRAY(SELECT AS STRUCT title FROM albums WHERE albums.singer_id=singers.id) AS albums"), &singers); err != nil {
+		t.Fatalf("failed to find structs: %v", err)
+	}
+	if g, w := len(singers), 1; g != w {
+		t.Fatalf("row count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := singers[0].ID, int64(1); g != w {
+		t.Fatalf("id mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(singers[0].Albums), 2; g != w {
+		t.Fatalf("album count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := singers[0].Albums[1].Title, "Title 2"; g != w {
+		t.Fatalf("album title mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	if err := FindStructs(db.Table("singers"), singers); err == nil {
+		t.Fatal("missing expected error for non-pointer destination")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/googleapis/gax-go/v2"
+	"gorm.io/gorm"
+)
+
+// TransactionOptions are the options for RunTransactionWithOptions.
+type TransactionOptions struct {
+	// MaxAttempts is the maximum number of times that the transaction is
+	// executed. The default is no limit, in which case the transaction is
+	// retried until it succeeds, fails with an error that is not an abort, or
+	// the context or Timeout expires.
+	MaxAttempts int
+	// Timeout is the maximum total time of all attempts of the transaction.
+	// The default is no timeout other than the deadline of the context.
+	Timeout time.Duration
+	// TxOptions are the options that are passed to gorm's Transaction
+	// function, e.g. &sql.TxOptions{ReadOnly: true}.
+	TxOptions *sql.TxOptions
+}
+
+type transactionAttemptKey struct{}
+
+// TransactionAttempt returns the number of the attempt of the transaction of
+// RunTransaction or RunTransactionWithOptions that the given context belongs
+// to, starting at 1. The number of times that the transaction has been retried
+// after an abort is the attempt minus one. TransactionAttempt returns zero for
+// contexts that do not belong to such a transaction.
+func TransactionAttempt(ctx context.Context) int {
+	if ctx == nil {
+		return 0
+	}
+	attempt, _ := ctx.Value(transactionAttemptKey{}).(int)
+	return attempt
+}
+
+// RunTransaction executes fn in a read/write transaction, and retries the
+// transaction if Spanner aborts it. See RunTransactionWithOptions for more
+// information.
+func RunTransaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	var options TransactionOptions
+	if len(opts) > 0 {
+		options.TxOptions = opts[0]
+	}
+	return RunTransactionWithOptions(ctx, db, fn, options)
+}
+
+// RunTransactionWithOptions executes fn in a transaction, and retries the
+// transaction if Spanner aborts it. fn must therefore be safe to call more
+// than once, and must not have side effects outside the transaction.
+//
+// The Spanner database/sql driver already retries aborted transactions
+// internally by replaying the statements of the transaction. That retry fails
+// with spannerdriver.ErrAbortedDueToConcurrentModification if the data that
+// the transaction read was modified in the meantime. RunTransactionWithOptions
+// handles that error, and aborts that are returned by Spanner, by calling fn
+// again in a new transaction. It waits for the retry delay that Spanner
+// returned with the error before the next attempt, or for an exponentially
+// increasing backoff if Spanner did not return a retry delay.
+//
+// If db already is a transaction, fn is called once with db. An abort is then
+// returned to the caller, so it can be retried by the outer transaction.
+//
+// Example:
+//
+//	err := spannergorm.RunTransaction(ctx, db, func(tx *gorm.DB) error {
+//	  var account Account
+//	  if err := tx.First(&account, 1).Error; err != nil {
+//	    return err
+//	  }
+//	  return tx.Model(&account).Update("balance", account.Balance-100).Error
+//	})
+func RunTransactionWithOptions(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error, options TransactionOptions) error {
+	switch unwrapConnPool(db.Statement.ConnPool).(type) {
+	case *connTx, *sql.Tx:
+		return fn(db.WithContext(ctx))
+	}
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+	backoff := gax.Backoff{
+		Initial:    20 * time.Millisecond,
+		Max:        32 * time.Second,
+		Multiplier: 1.3,
+	}
+	var txOptions []*sql.TxOptions
+	if options.TxOptions != nil {
+		txOptions = append(txOptions, options.TxOptions)
+	}
+	for attempt := 1; ; attempt++ {
+		err := db.WithContext(context.WithValue(ctx, transactionAttemptKey{}, attempt)).Transaction(fn, txOptions...)
+		if !isAborted(err) || (options.MaxAttempts > 0 && attempt >= options.MaxAttempts) {
+			return err
+		}
+		delay, ok := spanner.ExtractRetryDelay(err)
+		if !ok {
+			delay = backoff.Pause()
+		}
+		if sleepErr := gax.Sleep(ctx, delay); sleepErr != nil {
+			return errors.Join(sleepErr, err)
+		}
+	}
+}
+
+// isAborted returns true if the given error means that the transaction was
+// aborted, and that it can be retried.
+func isAborted(err error) bool {
+	return err != nil && errorKind(err) == ErrAbortedTransaction
+}
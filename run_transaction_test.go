@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func TestRunTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+		Errors: []error{status.Error(codes.Aborted, "Transaction was aborted")},
+	})
+	attempts := 0
+	if err := RunTransaction(context.Background(), db, func(tx *gorm.DB) error {
+		attempts++
+		if g, w := TransactionAttempt(tx.Statement.Context), attempts; g != w {
+			t.Errorf("transaction attempt mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		return execConcurrentlyModified(server, tx, attempts)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := attempts, 2; g != w {
+		t.Fatalf("attempts mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commitReqs := requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.CommitRequest{}))
+	// The internal retry of the driver fails at the update statement, as the
+	// update count changed. RunTransaction then executes the function again.
+	if g, w := len(commitReqs), 2; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestRunTransactionMaxAttempts(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+		Errors: []error{
+			status.Error(codes.Aborted, "Transaction was aborted"),
+			status.Error(codes.Aborted, "Transaction was aborted"),
+			status.Error(codes.Aborted, "Transaction was aborted"),
+		},
+	})
+	attempts := 0
+	err := RunTransactionWithOptions(context.Background(), db, func(tx *gorm.DB) error {
+		attempts++
+		return execConcurrentlyModified(server, tx, attempts)
+	}, TransactionOptions{MaxAttempts: 2})
+	if !errors.Is(err, spannerdriver.ErrAbortedDueToConcurrentModification) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, spannerdriver.ErrAbortedDueToConcurrentModification)
+	}
+	if g, w := attempts, 2; g != w {
+		t.Fatalf("attempts mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+// execConcurrentlyModified executes an update statement whose update count is
+// different in each attempt, so the internal retry of an aborted transaction
+// by the driver fails with ErrAbortedDueToConcurrentModification.
+func execConcurrentlyModified(server *testutil.MockedSpannerInMemTestServer, tx *gorm.DB, attempt int) error {
+	updateSql := "UPDATE singers SET active=false WHERE active=true"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: int64(attempt),
+	})
+	if err := tx.Exec(updateSql).Error; err != nil {
+		return err
+	}
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: int64(attempt) + 100,
+	})
+	return nil
+}
+
+func TestRunTransactionNotRetried(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	// Errors other than aborts are not retried.
+	fnErr := errors.New("test error")
+	attempts := 0
+	err := RunTransaction(context.Background(), db, func(tx *gorm.DB) error {
+		attempts++
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, fnErr)
+	}
+	if g, w := attempts, 1; g != w {
+		t.Fatalf("attempts mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// RunTransaction in a transaction calls the function with the transaction.
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return RunTransaction(context.Background(), tx, func(inner *gorm.DB) error {
+			if g, w := inner.Statement.ConnPool, tx.Statement.ConnPool; g != w {
+				t.Fatalf("transaction mismatch\n Got: %v\nWant: %v", g, w)
+			}
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -27,6 +27,9 @@ import (
 // Simple sample application that shows how to use GORM with Cloud Spanner.
 //
 // Execute the sample with the command `go run main.go` from this directory.
+// The sample runs on the Spanner emulator in a Docker container by default.
+// Run the sample on an existing Spanner database with the command
+// `go run main.go -project=my-project -instance=my-instance -database=my-database`.
 func helloWorld(projectId, instanceId, databaseId string) error {
 	db, err := gorm.Open(spannergorm.New(spannergorm.Config{
 		DriverName: "spanner",
@@ -51,5 +54,5 @@ func helloWorld(projectId, instanceId, databaseId string) error {
 }
 
 func main() {
-	samples.RunSampleOnEmulator(helloWorld)
+	samples.RunSample(helloWorld)
 }
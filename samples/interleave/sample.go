@@ -40,8 +40,9 @@ type Singer struct {
 	gorm.Model
 	FirstName sql.NullString
 	LastName  string
-	// FullName is generated by the database. The '->' marks this a read-only field.
-	FullName string `gorm:"->;type:STRING(MAX) AS (ARRAY_TO_STRING([first_name, last_name], \" \")) STORED;"`
+	// FullName is generated by the database. Generated columns are automatically
+	// omitted from insert and update statements.
+	FullName string `gorm:"type:STRING(MAX) AS (ARRAY_TO_STRING([first_name, last_name], \" \")) STORED;"`
 	Active   bool
 	Albums   []Album
 }
@@ -0,0 +1,128 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package samples
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// SampleConfig contains the settings that determine where a sample is
+// executed. The settings are read from command line flags, and fall back to
+// environment variables if a flag has not been set.
+type SampleConfig struct {
+	// Project is the Google Cloud project of the Spanner database.
+	// Flag: -project, environment variable: SPANNER_PROJECT_ID.
+	Project string
+	// Instance is the Spanner instance of the database.
+	// Flag: -instance, environment variable: SPANNER_INSTANCE_ID.
+	Instance string
+	// Database is the Spanner database that the sample uses.
+	// Flag: -database, environment variable: SPANNER_DATABASE_ID.
+	Database string
+	// Credentials is the path to a credentials file. Application Default
+	// Credentials are used if no credentials file has been set.
+	// Flag: -credentials, environment variable: GOOGLE_APPLICATION_CREDENTIALS.
+	Credentials string
+	// Dialect is the SQL dialect of the database. The samples only support
+	// 'googlesql'.
+	// Flag: -dialect, environment variable: SPANNER_DIALECT.
+	Dialect string
+}
+
+// UseEmulator returns true if the sample should be executed on an emulator
+// that is started automatically, because no project, instance and database
+// have been set.
+func (c *SampleConfig) UseEmulator() bool {
+	return c.Project == "" && c.Instance == "" && c.Database == ""
+}
+
+// Validate returns an error if the configuration cannot be used to run a
+// sample.
+func (c *SampleConfig) Validate() error {
+	switch strings.ToLower(c.Dialect) {
+	case "", "googlesql", "google_standard_sql":
+	case "postgresql", "pg":
+		return fmt.Errorf("dialect %q is not supported: the gorm dialect only supports GoogleSQL databases", c.Dialect)
+	default:
+		return fmt.Errorf("unknown dialect %q, the only supported dialect is 'googlesql'", c.Dialect)
+	}
+	if c.UseEmulator() {
+		return nil
+	}
+	if c.Project == "" || c.Instance == "" || c.Database == "" {
+		return fmt.Errorf("project, instance and database must all be set to run a sample on Spanner, got project=%q, instance=%q, database=%q", c.Project, c.Instance, c.Database)
+	}
+	return nil
+}
+
+// ParseSampleConfig parses the sample configuration from the command line
+// flags in args and the environment.
+func ParseSampleConfig(name string, args []string) (*SampleConfig, error) {
+	config := &SampleConfig{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&config.Project, "project", os.Getenv("SPANNER_PROJECT_ID"), "the Google Cloud project of the database, defaults to $SPANNER_PROJECT_ID")
+	fs.StringVar(&config.Instance, "instance", os.Getenv("SPANNER_INSTANCE_ID"), "the Spanner instance of the database, defaults to $SPANNER_INSTANCE_ID")
+	fs.StringVar(&config.Database, "database", os.Getenv("SPANNER_DATABASE_ID"), "the Spanner database to use, defaults to $SPANNER_DATABASE_ID")
+	fs.StringVar(&config.Credentials, "credentials", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "the credentials file to use, defaults to $GOOGLE_APPLICATION_CREDENTIALS")
+	fs.StringVar(&config.Dialect, "dialect", envOrDefault("SPANNER_DIALECT", "googlesql"), "the SQL dialect of the database, defaults to $SPANNER_DIALECT or 'googlesql'")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// RunSample runs a sample function on the Spanner database that has been set
+// with the -project, -instance and -database flags or the corresponding
+// environment variables. The sample is executed on an emulator in a Docker
+// container with a new database that is created with the given DDL statements
+// if no database has been set. See RunSampleOnEmulator for more information.
+//
+// The DDL statements are not executed when the sample runs on an existing
+// database. The database must therefore already contain the tables that the
+// sample uses.
+func RunSample(sample func(string, string, string) error, ddlStatements ...string) {
+	config, err := ParseSampleConfig(os.Args[0], os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.UseEmulator() {
+		RunSampleOnEmulator(sample, ddlStatements...)
+		return
+	}
+	if config.Credentials != "" {
+		// The Spanner client libraries use Application Default Credentials,
+		// which are read from this environment variable.
+		if err := os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", config.Credentials); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := sample(config.Project, config.Instance, config.Database); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func envOrDefault(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return def
+}
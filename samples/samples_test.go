@@ -71,6 +71,35 @@ func TestIntegration_Sample(t *testing.T) {
 	assertContains(t, out, "The venue details for venue id 19")
 }
 
+func TestParseSampleConfig(t *testing.T) {
+	t.Setenv("SPANNER_PROJECT_ID", "")
+	t.Setenv("SPANNER_INSTANCE_ID", "")
+	t.Setenv("SPANNER_DATABASE_ID", "")
+	t.Setenv("SPANNER_DIALECT", "")
+
+	config, err := jsonsamples.ParseSampleConfig("test", []string{})
+	require.NoError(t, err)
+	require.True(t, config.UseEmulator())
+	require.Equal(t, "googlesql", config.Dialect)
+
+	config, err = jsonsamples.ParseSampleConfig("test", []string{"-project=p", "-instance=i", "-database=d"})
+	require.NoError(t, err)
+	require.False(t, config.UseEmulator())
+	require.Equal(t, "p", config.Project)
+	require.Equal(t, "i", config.Instance)
+	require.Equal(t, "d", config.Database)
+
+	t.Setenv("SPANNER_PROJECT_ID", "env-project")
+	_, err = jsonsamples.ParseSampleConfig("test", []string{"-instance=i"})
+	require.Error(t, err)
+	config, err = jsonsamples.ParseSampleConfig("test", []string{"-instance=i", "-database=d"})
+	require.NoError(t, err)
+	require.Equal(t, "env-project", config.Project)
+
+	_, err = jsonsamples.ParseSampleConfig("test", []string{"-dialect=postgresql"})
+	require.Error(t, err)
+}
+
 func runSample(t *testing.T, f sampleFunc, db *gorm.DB, errMsg string) string {
 	var b bytes.Buffer
 	if err := f(&b, db); err != nil {
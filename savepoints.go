@@ -0,0 +1,39 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrSavepointNotSupported is returned for nested calls to db.Transaction, as
+// gorm uses savepoints for nested transactions, and Spanner does not support
+// savepoints. Set Config.DisableNestedTransaction to execute nested
+// transactions as part of the outer transaction instead.
+var ErrSavepointNotSupported = errors.New("spanner: savepoints are not supported")
+
+// SavePoint implements gorm.SavePointerDialectorInterface. It always returns
+// ErrSavepointNotSupported.
+func (dialector Dialector) SavePoint(tx *gorm.DB, name string) error {
+	return ErrSavepointNotSupported
+}
+
+// RollbackTo implements gorm.SavePointerDialectorInterface. It always returns
+// ErrSavepointNotSupported.
+func (dialector Dialector) RollbackTo(tx *gorm.DB, name string) error {
+	return ErrSavepointNotSupported
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"gorm.io/gorm"
+)
+
+func TestNestedTransactionNotSupported(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	called := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			called = true
+			return nil
+		})
+	})
+	if g, w := err, ErrSavepointNotSupported; !errors.Is(g, w) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if called {
+		t.Fatal("nested transaction was executed")
+	}
+	if g, w := len(requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.CommitRequest{}))), 0; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestDisableNestedTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{DisableNestedTransaction: true})
+	defer teardown()
+	_ = putSingerResult(server, "SELECT * FROM `singers` WHERE `singers`.`id` = @p1 ORDER BY `singers`.`id` LIMIT @p2", singerWithCommitTimestamp{ID: 1})
+	drainRequestsFromServer(server.TestSpanner)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			var s singerWithCommitTimestamp
+			return tx.First(&s, 1).Error
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	executeReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(executeReqs), 1; g != w {
+		t.Fatalf("execute request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The nested transaction must use the outer transaction.
+	if executeReqs[0].(*spannerpb.ExecuteSqlRequest).GetTransaction().GetSingleUse() != nil {
+		t.Fatal("nested transaction did not use the outer transaction")
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,439 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/api/iterator"
+	"gorm.io/gorm"
+)
+
+// defaultScanWorkers is the default number of workers of ScanTable.
+const defaultScanWorkers = 4
+
+// ScanTableOptions are the options for ScanTable.
+type ScanTableOptions struct {
+	// Workers is the number of partitions that are processed in parallel.
+	// The default is 4.
+	Workers int
+	// MaxPartitions is the desired maximum number of partitions. Spanner may
+	// return fewer or more partitions. The default is 4 times the number of
+	// workers.
+	MaxPartitions int64
+	// Checkpoint stores the progress of the scan. An interrupted scan is
+	// resumed from the checkpoint, and only processes the partitions that had
+	// not been processed. Rows of partitions that were being processed when
+	// the scan was interrupted are processed again when it is resumed.
+	Checkpoint ScanCheckpoint
+}
+
+// ScanCheckpoint stores the progress of a ScanTable call. See
+// FileScanCheckpoint for an implementation that stores the progress in a
+// file.
+type ScanCheckpoint interface {
+	// Load returns the last state that was saved, or nil if there is no saved
+	// state.
+	Load(ctx context.Context) ([]byte, error)
+	// Save stores the state of the scan. It is called after the partitions
+	// have been created, after each partition that has been processed, and
+	// with a nil state when the scan has finished.
+	Save(ctx context.Context, state []byte) error
+}
+
+// FileScanCheckpoint is a ScanCheckpoint that stores the state of the scan
+// in the file with the given name.
+type FileScanCheckpoint string
+
+// Load implements ScanCheckpoint.
+func (f FileScanCheckpoint) Load(context.Context) ([]byte, error) {
+	state, err := os.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return state, err
+}
+
+// Save implements ScanCheckpoint. The file is replaced atomically, so an
+// interrupted write does not corrupt the state.
+func (f FileScanCheckpoint) Save(_ context.Context, state []byte) error {
+	if state == nil {
+		if err := os.Remove(string(f)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp := string(f) + ".tmp"
+	if err := os.WriteFile(tmp, state, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(f))
+}
+
+// scanState is the state of a ScanTable call that is stored in a
+// ScanCheckpoint.
+type scanState struct {
+	Transaction []byte
+	Partitions  [][]byte
+	Done        []bool
+}
+
+// ScanTable reads all rows of the table of the given model with a pool of
+// workers, and calls f with each row decoded into a new instance of the
+// model. The query is split into partitions with the partitioned query API
+// of Spanner, and each worker processes one partition at a time. f is called
+// concurrently by the workers. The first error that is returned by f stops
+// the scan and is returned.
+//
+// The rows are read in a batch read-only transaction, so all partitions see
+// the same snapshot of the table. The read-only staleness that is set with
+// WithReadOnlyStaleness is used for the transaction. Conditions of the given
+// gorm database are applied to the query, but the query must be
+// partitionable, which means that it cannot use for example ORDER BY or
+// LIMIT. ScanTable can only be used with a dialector that was created with a
+// DSN.
+//
+// Set a Checkpoint in the options to be able to resume the scan if it is
+// interrupted. The checkpoint contains the ID of the transaction, and can
+// only be resumed while the transaction is still valid.
+//
+// Example:
+//
+//	err := spannergorm.ScanTable(db.Where("active = ?", true), &Singer{},
+//	  spannergorm.ScanTableOptions{Workers: 8, Checkpoint: spannergorm.FileScanCheckpoint("singers.checkpoint")},
+//	  func(ctx context.Context, model interface{}) error {
+//	    singer := model.(*Singer)
+//	    return process(ctx, singer)
+//	  })
+func ScanTable(db *gorm.DB, model interface{}, options ScanTableOptions, f func(ctx context.Context, model interface{}) error) error {
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		return err
+	}
+	if err := checkNotInTransaction(db, "scan"); err != nil {
+		return err
+	}
+	modelType := reflect.TypeOf(model)
+	for modelType != nil && modelType.Kind() == reflect.Pointer {
+		modelType = modelType.Elem()
+	}
+	if modelType == nil || modelType.Kind() != reflect.Struct {
+		return fmt.Errorf("model must be a pointer to a struct, got %T", model)
+	}
+	dest := reflect.New(reflect.SliceOf(modelType)).Interface()
+	stmt := db.Session(&gorm.Session{DryRun: true}).Model(model).Find(dest).Statement
+	if stmt.Error != nil {
+		return stmt.Error
+	}
+	statement, err := toSpannerStatement(stmt.SQL.String(), stmt.Vars)
+	if err != nil {
+		return err
+	}
+	ctx := stmt.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client, err := dialector.spannerClient(ctx)
+	if err != nil {
+		return err
+	}
+	workers := options.Workers
+	if workers <= 0 {
+		workers = defaultScanWorkers
+	}
+
+	var (
+		txn        *spanner.BatchReadOnlyTransaction
+		partitions []*spanner.Partition
+		state      scanState
+	)
+	if options.Checkpoint != nil {
+		saved, err := options.Checkpoint.Load(ctx)
+		if err != nil {
+			return err
+		}
+		if len(saved) > 0 {
+			if err := json.Unmarshal(saved, &state); err != nil {
+				return fmt.Errorf("invalid scan checkpoint: %w", err)
+			}
+			var tid spanner.BatchReadOnlyTransactionID
+			if err := tid.UnmarshalBinary(state.Transaction); err != nil {
+				return fmt.Errorf("invalid scan checkpoint: %w", err)
+			}
+			txn = client.BatchReadOnlyTransactionFromID(tid)
+			partitions = make([]*spanner.Partition, len(state.Partitions))
+			for i, p := range state.Partitions {
+				partitions[i] = &spanner.Partition{}
+				if err := partitions[i].UnmarshalBinary(p); err != nil {
+					return fmt.Errorf("invalid scan checkpoint: %w", err)
+				}
+			}
+		}
+	}
+	if txn == nil {
+		bound := spanner.StrongRead()
+		if value, ok := db.Get(readOnlyStalenessKey); ok {
+			if b, ok := value.(spanner.TimestampBound); ok {
+				bound = b
+			}
+		}
+		if txn, err = client.BatchReadOnlyTransaction(ctx, bound); err != nil {
+			return err
+		}
+		maxPartitions := options.MaxPartitions
+		if maxPartitions <= 0 {
+			maxPartitions = int64(4 * workers)
+		}
+		queryOptions := requestOptions(ctx).queryOptions()
+		queryOptions.RequestTag = dialector.requestTag(ctx, "scan", stmt.Table)
+		if partitions, err = txn.PartitionQueryWithOptions(ctx, statement, spanner.PartitionOptions{MaxPartitions: maxPartitions}, queryOptions); err != nil {
+			txn.Cleanup(ctx)
+			return err
+		}
+		if state.Transaction, err = txn.ID.MarshalBinary(); err != nil {
+			txn.Cleanup(ctx)
+			return err
+		}
+		state.Partitions = make([][]byte, len(partitions))
+		for i, p := range partitions {
+			if state.Partitions[i], err = p.MarshalBinary(); err != nil {
+				txn.Cleanup(ctx)
+				return err
+			}
+		}
+		state.Done = make([]bool, len(partitions))
+		if options.Checkpoint != nil {
+			if err := saveScanState(ctx, options.Checkpoint, &state); err != nil {
+				txn.Cleanup(ctx)
+				return err
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	work := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if err := scanPartition(ctx, stmt, txn, partitions[i], modelType, f); err != nil {
+					fail(err)
+					continue
+				}
+				if options.Checkpoint != nil {
+					mu.Lock()
+					state.Done[i] = true
+					err := saveScanState(ctx, options.Checkpoint, &state)
+					mu.Unlock()
+					if err != nil {
+						fail(err)
+					}
+				}
+			}
+		}()
+	}
+	for i := range partitions {
+		if state.Done != nil && state.Done[i] {
+			continue
+		}
+		select {
+		case work <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		// Keep the transaction, so the scan can be resumed.
+		txn.Close()
+		return firstErr
+	}
+	if options.Checkpoint != nil {
+		if err := options.Checkpoint.Save(ctx, nil); err != nil {
+			txn.Close()
+			return err
+		}
+	}
+	txn.Cleanup(ctx)
+	return nil
+}
+
+func saveScanState(ctx context.Context, checkpoint ScanCheckpoint, state *scanState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return checkpoint.Save(ctx, data)
+}
+
+// scanPartition reads the rows of the given partition, and calls f with each
+// row decoded into a new instance of the model.
+func scanPartition(ctx context.Context, stmt *gorm.Statement, txn *spanner.BatchReadOnlyTransaction, partition *spanner.Partition, modelType reflect.Type, f func(ctx context.Context, model interface{}) error) error {
+	iter := txn.Execute(ctx, partition)
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		model := reflect.New(modelType)
+		for i, name := range row.ColumnNames() {
+			field := stmt.Schema.LookUpField(name)
+			if field == nil {
+				continue
+			}
+			var col spanner.GenericColumnValue
+			if err := row.Column(i, &col); err != nil {
+				return err
+			}
+			value, err := decodeColumnValue(col)
+			if err != nil {
+				return fmt.Errorf("failed to decode column %s: %w", name, err)
+			}
+			if err := field.Set(ctx, model.Elem(), value); err != nil {
+				return fmt.Errorf("failed to set field %s: %w", field.Name, err)
+			}
+		}
+		if err := f(ctx, model.Interface()); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeColumnValue decodes a column value to the same type as the Spanner
+// database/sql driver returns for the column, so gorm can assign it to the
+// field of a model.
+func decodeColumnValue(col spanner.GenericColumnValue) (interface{}, error) {
+	if col.Type.Code == spannerpb.TypeCode_ARRAY {
+		var dest interface{}
+		switch col.Type.ArrayElementType.Code {
+		case spannerpb.TypeCode_INT64:
+			dest = &[]spanner.NullInt64{}
+		case spannerpb.TypeCode_FLOAT32:
+			dest = &[]spanner.NullFloat32{}
+		case spannerpb.TypeCode_FLOAT64:
+			dest = &[]spanner.NullFloat64{}
+		case spannerpb.TypeCode_NUMERIC:
+			dest = &[]spanner.NullNumeric{}
+		case spannerpb.TypeCode_STRING:
+			dest = &[]spanner.NullString{}
+		case spannerpb.TypeCode_JSON:
+			dest = &[]spanner.NullJSON{}
+		case spannerpb.TypeCode_BYTES:
+			dest = &[][]byte{}
+		case spannerpb.TypeCode_BOOL:
+			dest = &[]spanner.NullBool{}
+		case spannerpb.TypeCode_DATE:
+			dest = &[]spanner.NullDate{}
+		case spannerpb.TypeCode_TIMESTAMP:
+			dest = &[]spanner.NullTime{}
+		default:
+			return nil, fmt.Errorf("unsupported array element type: %v", col.Type.ArrayElementType.Code)
+		}
+		if err := col.Decode(dest); err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(dest).Elem().Interface(), nil
+	}
+	switch col.Type.Code {
+	case spannerpb.TypeCode_INT64:
+		var v spanner.NullInt64
+		if err := col.Decode(&v); err != nil || !v.Valid {
+			return nil, err
+		}
+		return v.Int64, nil
+	case spannerpb.TypeCode_FLOAT32:
+		var v spanner.NullFloat32
+		if err := col.Decode(&v); err != nil || !v.Valid {
+			return nil, err
+		}
+		return v.Float32, nil
+	case spannerpb.TypeCode_FLOAT64:
+		var v spanner.NullFloat64
+		if err := col.Decode(&v); err != nil || !v.Valid {
+			return nil, err
+		}
+		return v.Float64, nil
+	case spannerpb.TypeCode_NUMERIC:
+		var v spanner.NullNumeric
+		if err := col.Decode(&v); err != nil || !v.Valid {
+			return nil, err
+		}
+		return v.Numeric, nil
+	case spannerpb.TypeCode_STRING:
+		var v spanner.NullString
+		if err := col.Decode(&v); err != nil || !v.Valid {
+			return nil, err
+		}
+		return v.StringVal, nil
+	case spannerpb.TypeCode_JSON:
+		var v spanner.NullJSON
+		if err := col.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case spannerpb.TypeCode_BYTES:
+		var v []byte
+		if err := col.Decode(&v); err != nil || v == nil {
+			return nil, err
+		}
+		return v, nil
+	case spannerpb.TypeCode_BOOL:
+		var v spanner.NullBool
+		if err := col.Decode(&v); err != nil || !v.Valid {
+			return nil, err
+		}
+		return v.Bool, nil
+	case spannerpb.TypeCode_DATE:
+		var v spanner.NullDate
+		if err := col.Decode(&v); err != nil || !v.Valid {
+			return nil, err
+		}
+		return v.Date, nil
+	case spannerpb.TypeCode_TIMESTAMP:
+		var v spanner.NullTime
+		if err := col.Decode(&v); err != nil || !v.Valid {
+			return nil, err
+		}
+		return v.Time, nil
+	}
+	return nil, fmt.Errorf("unsupported type: %v", col.Type.Code)
+}
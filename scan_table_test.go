@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// partitionResultCheckpoint registers the result of each partition on the
+// mock server when the partitions are saved, as the mock server generates
+// random partition tokens.
+type partitionResultCheckpoint struct {
+	FileScanCheckpoint
+	server *testutil.MockedSpannerInMemTestServer
+	result *testutil.StatementResult
+}
+
+func (c *partitionResultCheckpoint) Save(ctx context.Context, data []byte) error {
+	if data != nil {
+		var state scanState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+		for _, partition := range state.Partitions {
+			var token []byte
+			if err := gob.NewDecoder(bytes.NewReader(partition)).Decode(&token); err != nil {
+				return err
+			}
+			if err := c.server.TestSpanner.PutPartitionResult(token, c.result); err != nil {
+				return err
+			}
+		}
+	}
+	return c.FileScanCheckpoint.Save(ctx, data)
+}
+
+func TestScanTable(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	checkpoint := &partitionResultCheckpoint{
+		FileScanCheckpoint: FileScanCheckpoint(filepath.Join(t.TempDir(), "singers.checkpoint")),
+		server:             server,
+		result: &testutil.StatementResult{
+			Type: testutil.StatementResultResultSet,
+			ResultSet: &spannerpb.ResultSet{
+				Metadata: &spannerpb.ResultSetMetadata{
+					RowType: &spannerpb.StructType{
+						Fields: []*spannerpb.StructType_Field{
+							{Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, Name: "id"},
+							{Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, Name: "first_name"},
+							{Type: &spannerpb.Type{Code: spannerpb.TypeCode_TIMESTAMP}, Name: "last_updated"},
+							{Type: &spannerpb.Type{Code: spannerpb.TypeCode_FLOAT32}, Name: "rating"},
+						},
+					},
+				},
+				Rows: []*structpb.ListValue{
+					{Values: []*structpb.Value{
+						structpb.NewStringValue("1"),
+						structpb.NewStringValue("First"),
+						structpb.NewNullValue(),
+						structpb.NewNumberValue(3.5),
+					}},
+				},
+			},
+		},
+	}
+
+	// The first scan fails on the first row, and can be resumed from the
+	// checkpoint.
+	errProcess := errors.New("process failed")
+	err := ScanTable(db.Where("active = ?", true), &singerWithCommitTimestamp{},
+		ScanTableOptions{Workers: 1, MaxPartitions: 3, Checkpoint: checkpoint},
+		func(ctx context.Context, model interface{}) error {
+			return errProcess
+		})
+	if !errors.Is(err, errProcess) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, errProcess)
+	}
+	if _, err := os.Stat(string(checkpoint.FileScanCheckpoint)); err != nil {
+		t.Fatalf("missing checkpoint: %v", err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.PartitionQueryRequest{}))), 1; g != w {
+		t.Fatalf("partition request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	var (
+		mu      sync.Mutex
+		singers []*singerWithCommitTimestamp
+	)
+	err = ScanTable(db.Where("active = ?", true), &singerWithCommitTimestamp{},
+		ScanTableOptions{Workers: 2, Checkpoint: checkpoint},
+		func(ctx context.Context, model interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			singers = append(singers, model.(*singerWithCommitTimestamp))
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("failed to scan table: %v", err)
+	}
+	// The resumed scan uses the partitions of the checkpoint.
+	reqs = drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.PartitionQueryRequest{}))), 0; g != w {
+		t.Fatalf("partition request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for _, req := range requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		if len(req.(*spannerpb.ExecuteSqlRequest).PartitionToken) == 0 {
+			t.Fatalf("query was not executed for a partition: %v", req)
+		}
+	}
+	// The mock server returns the same row for each of the three partitions.
+	if g, w := len(singers), 3; g != w {
+		t.Fatalf("row count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := *singers[0], (singerWithCommitTimestamp{ID: 1, FirstName: "First", Rating: 3.5}); !reflect.DeepEqual(g, w) {
+		t.Fatalf("singer mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// The checkpoint is removed when the scan has finished.
+	if _, err := os.Stat(string(checkpoint.FileScanCheckpoint)); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint was not removed: %v", err)
+	}
+}
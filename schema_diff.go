@@ -0,0 +1,315 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// SchemaDiff is the difference between the schema of the database and the
+// models that is returned by DiffSchema.
+type SchemaDiff struct {
+	// MissingTables are the tables of models that do not exist in the
+	// database.
+	MissingTables []string
+	// MissingColumns are the columns of fields that do not exist in the
+	// table.
+	MissingColumns []ColumnDiff
+	// ExtraColumns are the columns in the table that have no field in the
+	// model.
+	ExtraColumns []ColumnDiff
+	// TypeMismatches are the columns whose type in the database differs from
+	// the type of the field in the model.
+	TypeMismatches []ColumnDiff
+	// MissingIndexes are the indexes of the model that do not exist in the
+	// database.
+	MissingIndexes []IndexDiff
+	// ExtraIndexes are the indexes in the database that are not defined by
+	// the model. The primary key is not included.
+	ExtraIndexes []IndexDiff
+	// IndexMismatches are the indexes whose columns or uniqueness in the
+	// database differ from the model.
+	IndexMismatches []IndexDiff
+	// RowDeletionPolicyMismatches are the tables whose row deletion policy in
+	// the database differs from the model.
+	RowDeletionPolicyMismatches []RowDeletionPolicyDiff
+}
+
+// ColumnDiff is a column that differs between the database and a model.
+type ColumnDiff struct {
+	Table  string
+	Column string
+	// DatabaseType is the type of the column in the database. It is empty
+	// for missing columns.
+	DatabaseType string
+	// ModelType is the type of the field in the model. It is empty for extra
+	// columns.
+	ModelType string
+}
+
+// IndexDiff is an index that differs between the database and a model.
+type IndexDiff struct {
+	Table string
+	Index string
+	// DatabaseColumns are the columns of the index in the database. They are
+	// empty for missing indexes.
+	DatabaseColumns []string
+	// ModelColumns are the columns of the index in the model. They are empty
+	// for extra indexes.
+	ModelColumns   []string
+	DatabaseUnique bool
+	ModelUnique    bool
+}
+
+// RowDeletionPolicyDiff is a table whose row deletion policy differs between
+// the database and a model.
+type RowDeletionPolicyDiff struct {
+	Table string
+	// DatabasePolicy is the row deletion policy of the table in the
+	// database. It is empty if the table has no row deletion policy.
+	DatabasePolicy string
+	// ModelPolicy is the row deletion policy of the model. It is empty if the
+	// model has no row deletion policy.
+	ModelPolicy string
+}
+
+// Empty returns true if the database matches the models.
+func (d SchemaDiff) Empty() bool {
+	return len(d.MissingTables) == 0 && len(d.MissingColumns) == 0 && len(d.ExtraColumns) == 0 &&
+		len(d.TypeMismatches) == 0 && len(d.MissingIndexes) == 0 && len(d.ExtraIndexes) == 0 &&
+		len(d.IndexMismatches) == 0 && len(d.RowDeletionPolicyMismatches) == 0
+}
+
+// String returns the differences in a human-readable format, with one line
+// per difference.
+func (d SchemaDiff) String() string {
+	var b strings.Builder
+	for _, table := range d.MissingTables {
+		fmt.Fprintf(&b, "missing table: %s\n", table)
+	}
+	for _, column := range d.MissingColumns {
+		fmt.Fprintf(&b, "missing column: %s.%s %s\n", column.Table, column.Column, column.ModelType)
+	}
+	for _, column := range d.ExtraColumns {
+		fmt.Fprintf(&b, "extra column: %s.%s %s\n", column.Table, column.Column, column.DatabaseType)
+	}
+	for _, column := range d.TypeMismatches {
+		fmt.Fprintf(&b, "type mismatch: %s.%s is %s in the database and %s in the model\n", column.Table, column.Column, column.DatabaseType, column.ModelType)
+	}
+	for _, index := range d.MissingIndexes {
+		fmt.Fprintf(&b, "missing index: %s on %s(%s)\n", index.Index, index.Table, strings.Join(index.ModelColumns, ", "))
+	}
+	for _, index := range d.ExtraIndexes {
+		fmt.Fprintf(&b, "extra index: %s on %s(%s)\n", index.Index, index.Table, strings.Join(index.DatabaseColumns, ", "))
+	}
+	for _, index := range d.IndexMismatches {
+		fmt.Fprintf(&b, "index mismatch: %s on %s is (%s) unique=%v in the database and (%s) unique=%v in the model\n",
+			index.Index, index.Table, strings.Join(index.DatabaseColumns, ", "), index.DatabaseUnique,
+			strings.Join(index.ModelColumns, ", "), index.ModelUnique)
+	}
+	for _, policy := range d.RowDeletionPolicyMismatches {
+		fmt.Fprintf(&b, "row deletion policy mismatch: %s has %s in the database and %s in the model\n",
+			policy.Table, rowDeletionPolicyOrNone(policy.DatabasePolicy), rowDeletionPolicyOrNone(policy.ModelPolicy))
+	}
+	return b.String()
+}
+
+func rowDeletionPolicyOrNone(policy string) string {
+	if policy == "" {
+		return "no policy"
+	}
+	return "(" + policy + ")"
+}
+
+// DiffSchema compares the tables of the given models with the schema of the
+// database, and returns the missing tables, the missing and extra columns, the
+// columns with a different type, the indexes that differ, and the tables with
+// a different row deletion policy. No DDL statements are executed. Use this in
+// a CI pipeline to detect models that have drifted from the schema of a
+// production database.
+//
+// The types of columns are compared after normalization, so e.g. a field
+// with type INT is equal to an INT64 column. The lengths of STRING and BYTES
+// columns are also compared. Models that implement ViewModel are skipped.
+//
+// Example:
+//
+//	m := db.Migrator().(spannergorm.SchemaAnalyzer)
+//	diff, err := m.DiffSchema(&Singer{}, &Album{})
+//	if err != nil {
+//	  return err
+//	}
+//	if !diff.Empty() {
+//	  log.Fatalf("schema drift:\n%s", diff)
+//	}
+func (m spannerMigrator) DiffSchema(values ...interface{}) (SchemaDiff, error) {
+	defer m.Close()
+	var diff SchemaDiff
+	tables, _, err := m.splitViewModels(values)
+	if err != nil {
+		return diff, err
+	}
+	for _, value := range tables {
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			return m.diffTable(&diff, value, stmt)
+		}); err != nil {
+			return diff, err
+		}
+	}
+	return diff, nil
+}
+
+// diffTable adds the differences between the table of the given model and
+// the database to diff.
+func (m spannerMigrator) diffTable(diff *SchemaDiff, value interface{}, stmt *gorm.Statement) error {
+	tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+	rows, err := m.DB.Raw(
+		"SELECT COLUMN_NAME, SPANNER_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		tableSchema, table,
+	).Rows()
+	if err != nil {
+		return err
+	}
+	var columns []string
+	columnTypes := make(map[string]string)
+	for rows.Next() {
+		var name, dataType string
+		if err := rows.Scan(&name, &dataType); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		columns = append(columns, name)
+		columnTypes[name] = dataType
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		diff.MissingTables = append(diff.MissingTables, stmt.Table)
+		return nil
+	}
+
+	// The generated columns of caseInsensitiveIndex tags have no field.
+	caseInsensitive := caseInsensitiveIndexes(stmt.Schema)
+	generated := make(map[string]bool, len(caseInsensitive))
+	for _, index := range caseInsensitive {
+		generated[index.column] = true
+	}
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || field.IgnoreMigration {
+			continue
+		}
+		modelType := m.Migrator.DataTypeOf(field)
+		databaseType, ok := columnTypes[field.DBName]
+		if !ok {
+			diff.MissingColumns = append(diff.MissingColumns, ColumnDiff{Table: stmt.Table, Column: field.DBName, ModelType: modelType})
+			continue
+		}
+		if !sameDataType(databaseType, modelType) {
+			diff.TypeMismatches = append(diff.TypeMismatches, ColumnDiff{Table: stmt.Table, Column: field.DBName, DatabaseType: databaseType, ModelType: modelType})
+		}
+	}
+	for _, column := range columns {
+		if field, ok := stmt.Schema.FieldsByDBName[column]; (ok && !field.IgnoreMigration) || generated[column] {
+			continue
+		}
+		diff.ExtraColumns = append(diff.ExtraColumns, ColumnDiff{Table: stmt.Table, Column: column, DatabaseType: columnTypes[column]})
+	}
+
+	databasePolicy, err := m.rowDeletionPolicyInDatabase(stmt)
+	if err != nil {
+		return err
+	}
+	modelPolicy, err := rowDeletionPolicyOf(stmt.Schema)
+	if err != nil {
+		return err
+	}
+	if !sameRowDeletionPolicy(databasePolicy, modelPolicy) {
+		diff.RowDeletionPolicyMismatches = append(diff.RowDeletionPolicyMismatches,
+			RowDeletionPolicyDiff{Table: stmt.Table, DatabasePolicy: databasePolicy, ModelPolicy: modelPolicy})
+	}
+
+	indexes, err := m.GetIndexes(value)
+	if err != nil {
+		return err
+	}
+	modelIndexes := modelIndexesOf(stmt.Schema, caseInsensitive)
+	for _, index := range indexes {
+		if primaryKey, _ := index.PrimaryKey(); primaryKey {
+			continue
+		}
+		unique, _ := index.Unique()
+		want, ok := modelIndexes[index.Name()]
+		if !ok {
+			diff.ExtraIndexes = append(diff.ExtraIndexes, IndexDiff{Table: stmt.Table, Index: index.Name(), DatabaseColumns: index.Columns(), DatabaseUnique: unique})
+			continue
+		}
+		delete(modelIndexes, index.Name())
+		if !reflect.DeepEqual(index.Columns(), want.ModelColumns) || unique != want.ModelUnique {
+			want.DatabaseColumns, want.DatabaseUnique = index.Columns(), unique
+			diff.IndexMismatches = append(diff.IndexMismatches, want)
+		}
+	}
+	names := make([]string, 0, len(modelIndexes))
+	for name := range modelIndexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		diff.MissingIndexes = append(diff.MissingIndexes, modelIndexes[name])
+	}
+	return nil
+}
+
+// modelIndexesOf returns the indexes that the migrator creates for the given
+// schema by name, including the indexes of caseInsensitiveIndex tags.
+func modelIndexesOf(s *schema.Schema, caseInsensitive []caseInsensitiveIndex) map[string]IndexDiff {
+	indexes := make(map[string]IndexDiff)
+	for _, index := range s.ParseIndexes() {
+		diff := IndexDiff{Table: s.Table, Index: index.Name, ModelUnique: index.Class == "UNIQUE"}
+		for _, option := range index.Fields {
+			diff.ModelColumns = append(diff.ModelColumns, option.DBName)
+		}
+		indexes[index.Name] = diff
+	}
+	for _, index := range caseInsensitive {
+		indexes[index.name] = IndexDiff{Table: s.Table, Index: index.name, ModelColumns: []string{index.column}, ModelUnique: index.unique}
+	}
+	return indexes
+}
+
+// sameDataType returns true if the given data types are the same GoogleSQL
+// type with the same length.
+func sameDataType(databaseType, modelType string) bool {
+	return normalizeDataType(databaseType) == normalizeDataType(modelType) &&
+		dataTypeLengthOf(databaseType) == dataTypeLengthOf(modelType)
+}
+
+// dataTypeLengthOf returns the length of the given data type in upper case,
+// e.g. MAX for STRING(MAX) and ARRAY<BYTES(MAX)>, or an empty string if the
+// data type has no length. Options after the type are ignored.
+func dataTypeLengthOf(dataType string) string {
+	fields := strings.Fields(dataType)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.Trim(dataTypeLength.FindString(fields[0]), "()"))
+}
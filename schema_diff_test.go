@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	diffColumnsSql = "SELECT COLUMN_NAME, SPANNER_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2 ORDER BY ORDINAL_POSITION"
+	diffIndexesSql = `SELECT I.INDEX_NAME, I.INDEX_TYPE = 'PRIMARY_KEY', I.IS_UNIQUE, IC.COLUMN_NAME
+			FROM INFORMATION_SCHEMA.INDEXES I
+			INNER JOIN INFORMATION_SCHEMA.INDEX_COLUMNS IC USING (TABLE_CATALOG, TABLE_SCHEMA, TABLE_NAME, INDEX_NAME)
+			WHERE I.TABLE_SCHEMA = @p1 AND I.TABLE_NAME = @p2 AND (@p3 OR NOT I.SPANNER_IS_MANAGED)
+			AND IC.ORDINAL_POSITION IS NOT NULL
+			ORDER BY I.INDEX_NAME, IC.ORDINAL_POSITION`
+	diffRowDeletionPolicySql = "SELECT ROW_DELETION_POLICY_EXPRESSION FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2"
+)
+
+type diffSinger struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement:false"`
+	FirstName string `gorm:"size:100;index:idx_diff_singers_name"`
+	LastName  string `gorm:"index:idx_diff_singers_name"`
+	Email     string `gorm:"uniqueIndex"`
+	Rating    float64
+}
+
+func TestDiffSchema(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putStringRowsResult(server, diffColumnsSql, []string{"COLUMN_NAME", "SPANNER_TYPE"}, [][]string{
+		{"id", "INT64"},
+		{"first_name", "STRING(MAX)"},
+		{"last_name", "STRING(MAX)"},
+		{"rating", "INT64"},
+		{"nickname", "STRING(MAX)"},
+	})
+	_ = putStringRowsResult(server, diffIndexesSql, []string{"INDEX_NAME", "IS_PRIMARY_KEY", "IS_UNIQUE", "COLUMN_NAME"}, [][]string{
+		{"PRIMARY_KEY", "true", "true", "id"},
+		{"idx_diff_singers_name", "false", "false", "first_name"},
+		{"idx_old", "false", "false", "nickname"},
+	})
+	_ = putStringRowsResult(server, diffRowDeletionPolicySql, []string{"ROW_DELETION_POLICY_EXPRESSION"}, [][]string{
+		{"OLDER_THAN(created_at, INTERVAL 30 DAY)"},
+	})
+
+	diff, err := db.Migrator().(SchemaAnalyzer).DiffSchema(&diffSinger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SchemaDiff{
+		MissingColumns: []ColumnDiff{{Table: "diff_singers", Column: "email", ModelType: "STRING(MAX)"}},
+		ExtraColumns:   []ColumnDiff{{Table: "diff_singers", Column: "nickname", DatabaseType: "STRING(MAX)"}},
+		TypeMismatches: []ColumnDiff{
+			{Table: "diff_singers", Column: "first_name", DatabaseType: "STRING(MAX)", ModelType: "STRING(100)"},
+			{Table: "diff_singers", Column: "rating", DatabaseType: "INT64", ModelType: "FLOAT64"},
+		},
+		MissingIndexes: []IndexDiff{{Table: "diff_singers", Index: "idx_diff_singers_email", ModelColumns: []string{"email"}, ModelUnique: true}},
+		ExtraIndexes:   []IndexDiff{{Table: "diff_singers", Index: "idx_old", DatabaseColumns: []string{"nickname"}}},
+		IndexMismatches: []IndexDiff{{
+			Table:           "diff_singers",
+			Index:           "idx_diff_singers_name",
+			DatabaseColumns: []string{"first_name"},
+			ModelColumns:    []string{"first_name", "last_name"},
+		}},
+		RowDeletionPolicyMismatches: []RowDeletionPolicyDiff{{
+			Table:          "diff_singers",
+			DatabasePolicy: "OLDER_THAN(created_at, INTERVAL 30 DAY)",
+		}},
+	}
+	if g, w := diff, want; !reflect.DeepEqual(g, w) {
+		t.Fatalf("diff mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+	if diff.Empty() {
+		t.Fatal("diff is empty")
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("DDL request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestDiffSchemaMissingTable(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putStringRowsResult(server, diffColumnsSql, []string{"COLUMN_NAME", "SPANNER_TYPE"}, nil)
+
+	diff, err := db.Migrator().(SchemaAnalyzer).DiffSchema(&diffSinger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := diff, (SchemaDiff{MissingTables: []string{"diff_singers"}}); !reflect.DeepEqual(g, w) {
+		t.Fatalf("diff mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+	if g, w := diff.String(), "missing table: diff_singers\n"; g != w {
+		t.Fatalf("string mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestSameDataType(t *testing.T) {
+	for _, test := range []struct {
+		databaseType string
+		modelType    string
+		want         bool
+	}{
+		{"INT64", "INT64", true},
+		{"INT64", "int", true},
+		{"STRING(MAX)", "STRING(MAX)", true},
+		{"STRING(MAX)", "STRING(100)", false},
+		{"TIMESTAMP", "TIMESTAMP OPTIONS (allow_commit_timestamp=true)", true},
+		{"ARRAY<STRING(MAX)>", "ARRAY<STRING(MAX)>", true},
+		{"ARRAY<STRING(10)>", "ARRAY<STRING(MAX)>", false},
+		{"BYTES(MAX)", "STRING(MAX)", false},
+	} {
+		if g, w := sameDataType(test.databaseType, test.modelType), test.want; g != w {
+			t.Errorf("%s %s: mismatch\n Got: %v\nWant: %v", test.databaseType, test.modelType, g, w)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// applyDefaultSchema adds the given schema as a prefix to the names of the
+// tables of models that are generated by the naming strategy of the given
+// database. Models that implement schema.Tabler, and databases that use a
+// custom naming strategy or a table prefix, are not changed.
+func applyDefaultSchema(db *gorm.DB, defaultSchema string) {
+	if defaultSchema == "" {
+		return
+	}
+	if namer, ok := db.NamingStrategy.(schema.NamingStrategy); ok && namer.TablePrefix == "" {
+		namer.TablePrefix = defaultSchema + "."
+		db.NamingStrategy = namer
+	}
+}
+
+// defaultSchemaOf returns the DefaultSchema of the Spanner dialector of the
+// given database, or the empty string if the database does not use a Spanner
+// dialector.
+func defaultSchemaOf(db *gorm.DB) string {
+	switch dialector := db.Dialector.(type) {
+	case *Dialector:
+		if dialector.Config != nil {
+			return dialector.DefaultSchema
+		}
+	case Dialector:
+		if dialector.Config != nil {
+			return dialector.DefaultSchema
+		}
+	}
+	return ""
+}
+
+// splitTableName returns the schema and the name of the given table. Table
+// names in the form schema.table are split at the dot. Other tables are in the
+// given default schema.
+func splitTableName(table, defaultSchema string) (string, string) {
+	if i := strings.IndexByte(table, '.'); i >= 0 {
+		return table[:i], table[i+1:]
+	}
+	return defaultSchema, table
+}
+
+// qualifiedTableName returns the name of the table of the given statement,
+// including its schema. gorm only keeps the schema of a table name in the form
+// schema.table in the table expression of the statement.
+func qualifiedTableName(stmt *gorm.Statement) string {
+	if stmt.TableExpr != nil && !strings.Contains(stmt.Table, ".") {
+		if name := unquoteIdentifier(stmt.TableExpr.SQL); strings.HasSuffix(name, "."+stmt.Table) {
+			return name
+		}
+	}
+	return stmt.Table
+}
+
+// qualifiedIndexName returns the name of the given index with the schema of
+// the given table, as the indexes of a table in a named schema must be in the
+// same schema. Index names that already contain a schema, and the indexes of
+// tables in the default schema, are returned unchanged.
+func qualifiedIndexName(table, index string) string {
+	if strings.Contains(index, ".") {
+		return index
+	}
+	if i := strings.IndexByte(table, '.'); i >= 0 {
+		return table[:i] + "." + index
+	}
+	return index
+}
+
+// tableSchemaAndName returns the schema and the name of the given table for
+// INFORMATION_SCHEMA queries.
+func (m spannerMigrator) tableSchemaAndName(table string) (string, string) {
+	return splitTableName(table, m.CurrentDatabase())
+}
+
+// HasTable returns true if the table of the given model or with the given
+// name exists. Table names in the form schema.table are looked up in the
+// named schema.
+func (m spannerMigrator) HasTable(value interface{}) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+		return m.DB.Raw(
+			"SELECT count(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ? AND table_type = ?",
+			tableSchema, table, "BASE TABLE",
+		).Row().Scan(&count)
+	})
+	return count > 0
+}
+
+// HasColumn returns true if the table of the given model has the given column.
+func (m spannerMigrator) HasColumn(value interface{}, field string) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		name := field
+		if stmt.Schema != nil {
+			if field := stmt.Schema.LookUpField(field); field != nil {
+				name = field.DBName
+			}
+		}
+		tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+		return m.DB.Raw(
+			"SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_schema = ? AND table_name = ? AND column_name = ?",
+			tableSchema, table, name,
+		).Row().Scan(&count)
+	})
+	return count > 0
+}
+
+// HasConstraint returns true if the table of the given model has the given
+// constraint. A foreign key of the model is also found if the table has a
+// foreign key with a different name, but with the same columns and referenced
+// columns, for example because the foreign key was created by another tool.
+func (m spannerMigrator) HasConstraint(value interface{}, name string) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		constraint, table := m.GuessConstraintInterfaceAndTable(stmt, name)
+		if constraint != nil {
+			name = constraint.GetName()
+		}
+		tableSchema, tableName := m.tableSchemaAndName(table)
+		if err := m.DB.Raw(
+			"SELECT count(*) FROM INFORMATION_SCHEMA.table_constraints WHERE constraint_schema = ? AND table_name = ? AND constraint_name = ?",
+			tableSchema, tableName, name,
+		).Row().Scan(&count); err != nil || count > 0 {
+			return err
+		}
+		if foreignKey, ok := constraint.(*schema.Constraint); ok {
+			if _, ok := m.equivalentForeignKey(table, foreignKey); ok {
+				count = 1
+			}
+		}
+		return nil
+	})
+	return count > 0
+}
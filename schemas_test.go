@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type schemaSinger struct {
+	ID   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name string `gorm:"index"`
+}
+
+type salesOrder struct {
+	ID     int64 `gorm:"primaryKey;autoIncrement:false"`
+	Amount float64
+}
+
+func (salesOrder) TableName() string {
+	return "sales.orders"
+}
+
+func TestDefaultSchema(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnectionWithConfig(t, "", Config{DefaultSchema: "sales"})
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 0)
+
+	if err := db.Migrator().AutoMigrate(&schemaSinger{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE TABLE `sales`.`schema_singers` (`id` INT64,`name` STRING(MAX)) PRIMARY KEY (`id`)",
+		"CREATE INDEX `sales`.`idx_sales_schema_singers_name` ON `sales`.`schema_singers`(`name`)",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	req := lastExecuteSqlRequest(drainRequestsFromServer(server.TestSpanner), hasTableSql)
+	if req == nil {
+		t.Fatal("HasTable query not found")
+	}
+	if g, w := []string{req.Params.Fields["p1"].GetStringValue(), req.Params.Fields["p2"].GetStringValue()}, []string{"sales", "schema_singers"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("params mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := db.Migrator().CurrentDatabase(), "sales"; g != w {
+		t.Fatalf("current database mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestNamedSchemaTableName(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 1)
+	_ = putStringRowsResult(server, diffIndexesSql, []string{"INDEX_NAME", "IS_PRIMARY_KEY", "IS_UNIQUE", "COLUMN_NAME"}, [][]string{
+		{"PRIMARY_KEY", "true", "true", "id"},
+	})
+
+	if !db.Migrator().HasTable(&salesOrder{}) {
+		t.Fatal("table not found")
+	}
+	if _, err := db.Migrator().GetIndexes(&salesOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	for _, sql := range []string{hasTableSql, diffIndexesSql} {
+		req := lastExecuteSqlRequest(requests, sql)
+		if req == nil {
+			t.Fatalf("query not found: %s", sql)
+		}
+		if g, w := []string{req.Params.Fields["p1"].GetStringValue(), req.Params.Fields["p2"].GetStringValue()}, []string{"sales", "orders"}; !reflect.DeepEqual(g, w) {
+			t.Fatalf("params mismatch\n Got: %v\nWant: %v", g, w)
+		}
+	}
+}
+
+func TestSplitTableName(t *testing.T) {
+	for _, test := range []struct {
+		table         string
+		defaultSchema string
+		wantSchema    string
+		wantTable     string
+	}{
+		{"singers", "", "", "singers"},
+		{"singers", "sales", "sales", "singers"},
+		{"sales.orders", "", "sales", "orders"},
+		{"sales.orders", "finance", "sales", "orders"},
+	} {
+		schema, table := splitTableName(test.table, test.defaultSchema)
+		if g, w := schema+"|"+table, test.wantSchema+"|"+test.wantTable; g != w {
+			t.Errorf("%s: mismatch\n Got: %v\nWant: %v", test.table, g, w)
+		}
+	}
+}
+
+func TestQualifiedIndexName(t *testing.T) {
+	for _, test := range []struct {
+		table string
+		index string
+		want  string
+	}{
+		{"singers", "idx_singers_name", "idx_singers_name"},
+		{"sales.orders", "idx_orders_amount", "sales.idx_orders_amount"},
+		{"sales.orders", "sales.idx_orders_amount", "sales.idx_orders_amount"},
+	} {
+		if g, w := qualifiedIndexName(test.table, test.index), test.want; g != w {
+			t.Errorf("%s %s: mismatch\n Got: %v\nWant: %v", test.table, test.index, g, w)
+		}
+	}
+}
+
+// lastExecuteSqlRequest returns the last ExecuteSqlRequest with the given SQL
+// string in the given requests.
+func lastExecuteSqlRequest(requests []interface{}, sql string) *spannerpb.ExecuteSqlRequest {
+	var last *spannerpb.ExecuteSqlRequest
+	for _, req := range requestsOfType(requests, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		if req.(*spannerpb.ExecuteSqlRequest).Sql == sql {
+			last = req.(*spannerpb.ExecuteSqlRequest)
+		}
+	}
+	return last
+}
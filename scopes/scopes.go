@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scopes contains reusable gorm scopes for common Spanner query
+// patterns. The scopes can be combined with each other and with any other
+// gorm scope.
+//
+// Example:
+//
+//	var singers []Singer
+//	err := db.Scopes(
+//	  scopes.ForceIndex("idx_singers_last_name"),
+//	  scopes.Staleness(spanner.ExactStaleness(15*time.Second)),
+//	).Where("last_name = ?", "Doe").Find(&singers).Error
+//
+// There is no scope for request tags, as tags are not supported by the Spanner
+// database/sql driver that is used by gorm.
+package scopes
+
+import (
+	"cloud.google.com/go/spanner"
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"gorm.io/gorm"
+)
+
+// ForceIndex instructs Spanner to use the given index for the table in the
+// FROM clause of the query.
+//
+// Example:
+//
+//	db.Scopes(scopes.ForceIndex("idx_singers_last_name")).Find(&singers)
+//	// SELECT * FROM `singers` @{FORCE_INDEX=`idx_singers_last_name`}
+func ForceIndex(name string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Clauses(spannergorm.ForceIndex(name))
+	}
+}
+
+// Staleness executes the query as a stale read with the given timestamp
+// bound. The query must be executed outside of a transaction.
+//
+// Example:
+//
+//	db.Scopes(scopes.Staleness(spanner.MaxStaleness(10*time.Second))).Find(&singers)
+func Staleness(bound spanner.TimestampBound) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return spannergorm.WithReadOnlyStaleness(db, bound)
+	}
+}
+
+// GroupByRollup groups the result of the query by the given columns, and adds
+// subtotal rows for each prefix of the columns and a grand total row.
+//
+// Example:
+//
+//	db.Model(&Album{}).
+//	  Select("singer_id, release_year, SUM(sales) AS sales").
+//	  Scopes(scopes.GroupByRollup("singer_id", "release_year")).
+//	  Scan(&results)
+//	// SELECT singer_id, release_year, SUM(sales) AS sales FROM `albums` GROUP BY ROLLUP(`singer_id`,`release_year`)
+func GroupByRollup(columns ...string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Clauses(spannergorm.GroupByRollup(columns...))
+	}
+}
+
+// OrderByNullsFirst orders the result of the query by the given column with
+// NULL values before all other values.
+//
+// Example:
+//
+//	db.Scopes(scopes.OrderByNullsFirst("last_name", true)).Find(&singers)
+//	// SELECT * FROM `singers` ORDER BY `last_name` DESC NULLS FIRST
+func OrderByNullsFirst(column string, desc bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Clauses(spannergorm.OrderByNullsFirst(column, desc))
+	}
+}
+
+// OrderByNullsLast orders the result of the query by the given column with
+// NULL values after all other values.
+//
+// Example:
+//
+//	db.Scopes(scopes.OrderByNullsLast("last_name", false)).Find(&singers)
+//	// SELECT * FROM `singers` ORDER BY `last_name` ASC NULLS LAST
+func OrderByNullsLast(column string, desc bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Clauses(spannergorm.OrderByNullsLast(column, desc))
+	}
+}
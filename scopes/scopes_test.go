@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scopes
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	spannergorm "github.com/googleapis/go-gorm-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+)
+
+type singer struct {
+	ID       int64
+	LastName string
+}
+
+type album struct {
+	ID          int64
+	SingerID    int64
+	ReleaseYear int64
+	Sales       int64
+}
+
+func TestForceIndex(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	var singers []singer
+	stmt := db.Session(&gorm.Session{DryRun: true}).
+		Scopes(ForceIndex("idx_singers_last_name")).
+		Where("last_name = ?", "Doe").
+		Find(&singers).Statement
+	if g, w := stmt.SQL.String(), "SELECT * FROM `singers` @{FORCE_INDEX=`idx_singers_last_name`} WHERE last_name = ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestGroupByRollup(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	var results []map[string]interface{}
+	stmt := db.Session(&gorm.Session{DryRun: true}).
+		Model(&album{}).
+		Select("singer_id, release_year, SUM(sales) AS sales").
+		Scopes(GroupByRollup("singer_id", "release_year")).
+		Find(&results).Statement
+	if g, w := stmt.SQL.String(), "SELECT singer_id, release_year, SUM(sales) AS sales FROM `albums` GROUP BY ROLLUP(`singer_id`,`release_year`)"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestOrderByNulls(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	var singers []singer
+	stmt := db.Session(&gorm.Session{DryRun: true}).
+		Scopes(OrderByNullsLast("last_name", false), OrderByNullsFirst("id", true)).
+		Find(&singers).Statement
+	if g, w := stmt.SQL.String(), "SELECT * FROM `singers` ORDER BY `last_name` ASC NULLS LAST,`id` DESC NULLS FIRST"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestStaleness(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers` @{FORCE_INDEX=`idx_singers_last_name`}"
+	_ = server.TestSpanner.PutStatementResult(querySql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{
+				RowType: &spannerpb.StructType{
+					Fields: []*spannerpb.StructType_Field{
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, Name: "id"},
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, Name: "last_name"},
+					},
+				},
+			},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{structpb.NewStringValue("1"), structpb.NewStringValue("Doe")}},
+			},
+		},
+	})
+
+	var singers []singer
+	if err := db.Scopes(
+		ForceIndex("idx_singers_last_name"),
+		Staleness(spanner.MaxStaleness(10*time.Second)),
+	).Find(&singers).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(singers), 1; g != w {
+		t.Fatalf("row count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	var req *spannerpb.ExecuteSqlRequest
+	for _, r := range drainRequestsFromServer(server.TestSpanner) {
+		if executeReq, ok := r.(*spannerpb.ExecuteSqlRequest); ok {
+			req = executeReq
+		}
+	}
+	if req == nil {
+		t.Fatal("no query received")
+	}
+	if g, w := req.GetTransaction().GetSingleUse().GetReadOnly().GetMaxStaleness().AsDuration(), 10*time.Second; g != w {
+		t.Fatalf("max staleness mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func setupTestGormConnection(t *testing.T) (db *gorm.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	server, _, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	db, err := gorm.Open(spannergorm.New(spannergorm.Config{
+		DriverName: "spanner",
+		DSN:        fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address),
+
+		DisableDialectCheck: true,
+	}), &gorm.Config{})
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	return db, server, serverTeardown
+}
+
+func drainRequestsFromServer(server testutil.InMemSpannerServer) []interface{} {
+	var reqs []interface{}
+loop:
+	for {
+		select {
+		case req := <-server.ReceivedRequests():
+			reqs = append(reqs, req)
+		default:
+			break loop
+		}
+	}
+	return reqs
+}
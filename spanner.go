@@ -18,6 +18,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/callbacks"
@@ -34,6 +35,12 @@ type Config struct {
 	DSN        string
 	Conn       gorm.ConnPool
 
+	// Connection contains the components of the connection string. The
+	// dialector builds the DSN from these options if DSN is empty. gorm.Open
+	// returns an error if the options are invalid, or if both DSN and
+	// Connection are set.
+	Connection *ConnectionOptions
+
 	// DisableAutoMigrateBatching turns off DDL batching for AutoMigrate calls.
 	// Cloud Spanner by default uses DDL batching when AutoMigrate is called, as
 	// executing multiple DDL statements in a single batch is a lot more efficient
@@ -41,10 +48,191 @@ type Config struct {
 	// if you are experiencing problems with the automatic batching of DDL
 	// statements when calling AutoMigrate.
 	DisableAutoMigrateBatching bool
+
+	// MaxDDLBatchSize is the maximum number of DDL statements that are sent to
+	// Spanner in one batch. Larger batches, for example from AutoMigrate calls
+	// with many models, are split into multiple batches that are executed in
+	// order. The default is 100.
+	MaxDDLBatchSize int
+
+	// ProtoDescriptors is a serialized FileDescriptorSet with the proto
+	// messages and enums that are used by PROTO and ENUM columns, for example
+	// generated with `protoc --include_imports --descriptor_set_out`.
+	// AutoMigrate creates the PROTO BUNDLE of the database with these types,
+	// or adds new types and updates the types that have changed. Types are
+	// never removed from the bundle. Requires a DSN.
+	ProtoDescriptors []byte
+	// ProtoBundle are the fully qualified names of the types in
+	// ProtoDescriptors that are added to the PROTO BUNDLE. The default is all
+	// messages and enums in ProtoDescriptors, except the types in the package
+	// google.protobuf.
+	ProtoBundle []string
+
+	// StrictMigrateColumn makes AutoMigrate and MigrateColumn return a
+	// *ColumnTypeChangeError if the type of an existing column differs from
+	// the type of its field in a way that Spanner cannot change with ALTER
+	// COLUMN, for example from INT64 to STRING. AutoMigrate checks all
+	// models before it changes any table, and the error lists all columns
+	// with an unsupported change. Supported changes, such as changing the
+	// length of a STRING column, are executed as normal.
+	StrictMigrateColumn bool
+	// AllowUnsafeColumnTypeChanges makes AutoMigrate and MigrateColumn alter
+	// columns to a type that cannot hold all values of the current type, such
+	// as a STRING column with a shorter length, or BYTES to STRING. Spanner
+	// validates the existing rows when the column is altered, and the change
+	// fails if a value does not fit the new type, which can take a long time
+	// for a large table. By default, an *UnsafeColumnTypeChangeError is
+	// returned instead of altering the column. AlterColumn always alters the
+	// column.
+	AllowUnsafeColumnTypeChanges bool
+
+	// IdentityMode determines how AutoMigrate generates the values of integer
+	// primary keys with an autoIncrement tag. The default is
+	// IdentityModeSequence, which creates a bit-reversed sequence named
+	// <table>_seq for each table. Use the tags gorm_sequence_skip_range and
+	// gorm_sequence_start_counter to set the options of the sequence or
+	// identity column of a field, e.g.
+	// `gorm:"primaryKey" gorm_sequence_skip_range:"1,1000" gorm_sequence_start_counter:"5000"`.
+	IdentityMode IdentityMode
+
+	// DisableNestedTransaction makes nested calls to db.Transaction execute
+	// the function as part of the outer transaction, instead of returning
+	// ErrSavepointNotSupported. gorm uses savepoints for nested transactions,
+	// which Spanner does not support. An error that is returned by a nested
+	// transaction does not undo the changes of the nested transaction. It only
+	// rolls back the outer transaction if the error is returned by the outer
+	// transaction as well. This sets gorm.Config.DisableNestedTransaction.
+	DisableNestedTransaction bool
+
+	// DefaultSchema is the named schema that is used for the tables of models
+	// that do not specify a schema. The schema is added as a prefix to the
+	// table names that are generated by the naming strategy, so a model
+	// Singer is stored in the table sales.singers if DefaultSchema is sales.
+	// Models with a TableName method must return a name in the form
+	// schema.table to use a named schema. The migrator looks up tables,
+	// columns and indexes in the schema of each table. The schema must be
+	// created before AutoMigrate is called. The default is the default schema
+	// of the database.
+	DefaultSchema string
+
+	// WarnHotspots makes AutoMigrate log a warning with the logger of gorm for
+	// each primary key and index of the models whose first column is likely
+	// to increase monotonically, such as a timestamp. These keys cause
+	// hotspots in Spanner. Enable this option during development. See
+	// AnalyzeHotspots for more information.
+	WarnHotspots bool
+
+	// AutoRequestTags adds a tag that is derived from the operation and the
+	// table of a statement, such as gorm_query_singers or
+	// gorm_insert_singers, to requests that do not have a tag in their
+	// RequestOptions. The tags are shown in the statistics tables of Spanner.
+	// The Spanner database/sql driver does not support tags, so the tags are
+	// only added to the requests and transactions that are executed with the
+	// Spanner client library, such as the statements of RunHybridTransaction,
+	// and not to the DML statements and queries that gorm executes with the
+	// driver. See RequestOptions for more information.
+	AutoRequestTags bool
+
+	// RequestTagTemplate is the tag that is added to requests that do not
+	// have a tag in their RequestOptions. The placeholders {operation} and
+	// {table} are replaced with the operation and the table of the
+	// statement, e.g. "orders-{operation}-{table}". The template is used
+	// instead of the tags of AutoRequestTags, and is only applied to the same
+	// requests.
+	RequestTagTemplate string
+
+	// TransactionTagTemplate is the tag that is added to read/write
+	// transactions that do not have a tag in their RequestOptions. It
+	// supports the same placeholders as RequestTagTemplate. Transactions that
+	// are not limited to one operation, such as RunHybridTransaction, use the
+	// operation "transaction" and an empty table.
+	TransactionTagTemplate string
+
+	// UseCommitTimestampForAutoTime instructs gorm to fill TIMESTAMP fields that
+	// have an autoCreateTime or autoUpdateTime tag with the commit timestamp of
+	// the transaction, instead of the current time of the client. The migrator
+	// creates these columns with the option allow_commit_timestamp=true.
+	//
+	// Note that the value of the field in the model is still set to the current
+	// time of the client after a Create or Update. Reload the row after the
+	// transaction has committed to get the actual commit timestamp.
+	UseCommitTimestampForAutoTime bool
+
+	// TranslateDateTimeFunctions rewrites common MySQL and PostgreSQL date/time
+	// expressions, such as NOW() and `created_at > NOW() - INTERVAL 1 DAY`, to
+	// their Spanner equivalents before a statement is executed. This makes it
+	// easier to port applications from other databases. The statements that
+	// are logged by gorm contain the original expressions.
+	TranslateDateTimeFunctions bool
+
+	// SpannerClientRetryConfig sets the timeout and retry settings of the
+	// Spanner client of the dialector. This is the client that SpannerClient
+	// returns, and that is used by QueryRows, FindStructs, ScanTable,
+	// ExportCSV and ImportCSV. The default settings of the Spanner client
+	// library are used if SpannerClientRetryConfig is nil.
+	//
+	// The settings do not apply to the statements and transactions that gorm
+	// executes with the Spanner database/sql driver. The driver does not
+	// support custom retry settings, and always uses the default settings of
+	// the client library.
+	SpannerClientRetryConfig *RetryConfig
+
+	// MinCommitDeadline is the minimum time that must be left until the
+	// deadline of the context of a transaction when the transaction is
+	// committed. The transaction is rolled back and a *CommitDeadlineError is
+	// returned if less time is left. This prevents commits that are likely to
+	// time out after they have been sent to Spanner, as the outcome of such a
+	// commit is unknown. The check is skipped for transactions without a
+	// deadline, and if MinCommitDeadline is zero.
+	MinCommitDeadline time.Duration
+
+	// RedactionPolicy determines which query parameters are redacted in the
+	// statements that are logged by gorm, in addition to the values of fields
+	// with a `gorm:"sensitive"` tag. See RedactionPolicy for more information.
+	RedactionPolicy *RedactionPolicy
+
+	// WarmupSessions is the number of queries that gorm.Open executes
+	// concurrently before it returns. This makes the Spanner client of the
+	// driver create its connections and at least this number of sessions, so
+	// the first statements of the application do not have to wait for them.
+	// The number of queries is limited to the maximum number of open
+	// connections of the connection pool. The warm-up is skipped in DryRun
+	// mode. gorm.Open returns an error if a query fails, or if the warm-up
+	// takes longer than one minute. Set MinSessions in ConnectionOptions or the minSessions
+	// property of the DSN to keep the sessions in the session pool.
+	WarmupSessions int
+
+	// DisableDialectCheck turns off the check that verifies that the database
+	// uses the GoogleSQL dialect when gorm.Open is called. The check executes
+	// a query on the database, and gorm.Open returns a *DialectMismatchError if
+	// the database uses the PostgreSQL dialect. The check is also skipped in
+	// DryRun mode.
+	DisableDialectCheck bool
+
+	// AdmissionController is called before each statement that is executed
+	// by gorm, and can delay or reject the statement. Use this to throttle
+	// statements of background jobs. Statements are assigned an operation
+	// class with WithOperationClass. See TokenBucketAdmissionController for a
+	// token bucket implementation.
+	AdmissionController AdmissionController
+
+	// CircuitBreakers returns the circuit breaker for an operation, or nil if
+	// the operation should not use a circuit breaker. It is called once for
+	// each type of operation when gorm.Open is called: create, query, update,
+	// delete, row and raw. Statements of an operation with an open circuit
+	// breaker fail immediately with a *CircuitOpenError. Statements that fail
+	// with an error for which IsOutageError returns true are reported as
+	// failures to the circuit breaker. Commits of transactions that are
+	// started with db.Transaction or db.Begin are not covered.
+	CircuitBreakers func(operation string) CircuitBreaker
 }
 
 type Dialector struct {
 	*Config
+
+	// sharedClient is the Spanner client of the database that was opened with
+	// the dialector. It is set by Initialize.
+	sharedClient *sharedClient
 }
 
 func Open(dsn string) gorm.Dialector {
@@ -59,13 +247,50 @@ func (dialector Dialector) Name() string {
 	return "spanner"
 }
 
+// DatabaseName returns the fully qualified name of the database that the
+// dialector connects to, e.g. projects/my-project/instances/my-instance/databases/my-database.
+// It returns an empty string if the dialector was not created with a valid
+// DSN, for example when it uses an existing connection pool.
+func (dialector Dialector) DatabaseName() string {
+	if dialector.Config == nil || dialector.DSN == "" {
+		return ""
+	}
+	config, err := parseDSN(dialector.DSN)
+	if err != nil || config.database == "" {
+		return ""
+	}
+	return config.databaseName()
+}
+
 func (dialector Dialector) Initialize(db *gorm.DB) (err error) {
+	// Spanner supports THEN RETURN clauses for all DML statements. The
+	// RETURNING clause is built as THEN RETURN.
 	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{
 		CreateClauses: []string{"INSERT", "VALUES", "RETURNING"},
+		UpdateClauses: []string{"UPDATE", "SET", "WHERE", "RETURNING"},
+		DeleteClauses: []string{"DELETE", "FROM", "WHERE", "RETURNING"},
 	})
+	// The defaults are set on a copy of the config, so the config of the
+	// application is not changed, and the same dialector can be used to open
+	// more than one database. The copy and the client of the database are
+	// stored in the dialector of the database.
+	config := *dialector.Config
+	dialector.Config = &config
+	dialector.sharedClient = &sharedClient{}
+	db.Dialector = &dialector
 	if dialector.DriverName == "" {
 		dialector.DriverName = "spanner"
 	}
+	if dialector.Connection != nil {
+		if dialector.DSN != "" {
+			return fmt.Errorf("DSN and Connection cannot both be set")
+		}
+		dsn, err := dialector.Connection.DSN()
+		if err != nil {
+			return err
+		}
+		dialector.DSN = dsn
+	}
 	// Register an UPDATE callback that will ensure that primary key columns are
 	// never included in the SET clause of the statement.
 	updateCallback := db.Callback().Update()
@@ -75,18 +300,105 @@ func (dialector Dialector) Initialize(db *gorm.DB) (err error) {
 		Register("gorm:spanner:remove_primary_key_from_update", BeforeUpdate); err != nil {
 		return err
 	}
+	if err := registerGeneratedColumnCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerStaleQueryCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerReturningCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerInsertSelectCallback(db); err != nil {
+		return err
+	}
+	if err := dialector.registerMutationCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerRequestOptionsCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerTransactionHookCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerBatchDMLCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerPartitionedDMLCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerReadOnlyViewCallbacks(db); err != nil {
+		return err
+	}
+	if err := registerSynonymCallbacks(db); err != nil {
+		return err
+	}
+	if dialector.AdmissionController != nil {
+		if err := registerAdmissionControl(db, dialector.AdmissionController); err != nil {
+			return err
+		}
+	}
+
+	if dialector.CircuitBreakers != nil {
+		if err := registerCircuitBreakers(db, dialector.CircuitBreakers); err != nil {
+			return err
+		}
+	}
 
+	applyDefaultSchema(db, dialector.DefaultSchema)
+	if dialector.DisableNestedTransaction {
+		db.Config.DisableNestedTransaction = true
+	}
+	dialector.registerCommitTimestamps(db)
+	registerRedaction(db, dialector.RedactionPolicy)
+	registerReservedWordQuoting(db)
+
+	// Wrap the connection pool to pin the connection of each transaction.
+	// This makes the Spanner connection of a transaction available for
+	// WithSpannerConn.
+	pool := &connPool{minCommitDeadline: dialector.MinCommitDeadline}
+	if dialector.TranslateDateTimeFunctions {
+		pool.translate = translateDateTimeFunctions
+	}
 	if dialector.Conn != nil {
 		db.ConnPool = dialector.Conn
+		if sqlDB, ok := dialector.Conn.(*sql.DB); ok {
+			pool.DB = sqlDB
+			db.ConnPool = pool
+		}
 	} else {
-		db.ConnPool, err = sql.Open(dialector.DriverName, dialector.DSN)
+		pool.DB, err = pool.openDB(dialector.DriverName, dialector.DSN)
 		if err != nil {
 			return err
 		}
+		pool.driverName, pool.dsn = dialector.DriverName, dialector.DSN
+		pool.onClose = append(pool.onClose, dialector.sharedClient.close)
+		db.ConnPool = pool
+		// Close the connection pool that was opened here if the dialect
+		// check or the warm-up fails.
+		defer func() {
+			if err != nil {
+				_ = pool.DB.Close()
+			}
+		}()
+	}
+	if !dialector.DisableDialectCheck && !db.DryRun {
+		if err := dialector.checkDialect(db); err != nil {
+			return err
+		}
+	}
+	if dialector.WarmupSessions > 0 && !db.DryRun {
+		if sqlDB, err := db.DB(); err == nil {
+			if err := warmUpSessions(context.Background(), sqlDB, dialector.WarmupSessions); err != nil {
+				return fmt.Errorf("failed to warm up sessions: %w", err)
+			}
+		}
 	}
 
-	// Spanner DML does not support 'ON CONFLICT' clauses.
+	// Spanner DML does not support 'ON CONFLICT' clauses. OnConflict clauses
+	// are translated to INSERT OR UPDATE and INSERT OR IGNORE instead.
 	db.ClauseBuilders[clause.OnConflict{}.Name()] = func(c clause.Clause, builder clause.Builder) {}
+	registerInsertOrUpdate(db)
 	db.ClauseBuilders[clause.Returning{}.Name()] = func(c clause.Clause, builder clause.Builder) {
 		builder.WriteString("THEN RETURN ")
 		returning, ok := c.Expression.(clause.Returning)
@@ -108,23 +420,40 @@ func (dialector Dialector) Initialize(db *gorm.DB) (err error) {
 
 func BeforeUpdate(db *gorm.DB) {
 	// Omit all primary key fields from the SET clause of an UPDATE statement.
-	db.Statement.Omit(db.Statement.Schema.PrimaryFieldDBNames...)
+	// The primary key fields are appended to the existing omitted fields, as
+	// Statement.Omit replaces the fields that were omitted by the application.
+	db.Statement.Omits = append(db.Statement.Omits, db.Statement.Schema.PrimaryFieldDBNames...)
 }
 
 func (dialector Dialector) DefaultValueOf(field *schema.Field) clause.Expression {
 	return clause.Expr{SQL: "NULL"}
 }
 
+// Migrator returns a migrator that uses one connection for all its statements.
+// The connection is only used by the migrator, and does not affect other
+// queries that are executed on the same gorm database. Each call to Migrator
+// returns a migrator with its own connection, which makes it safe to use
+// different migrators in different goroutines. A single migrator must not be
+// used concurrently by multiple goroutines.
 func (dialector Dialector) Migrator(db *gorm.DB) gorm.Migrator {
-	var conn *sql.Conn
-	if c, ok := db.ConnPool.(*sql.Conn); ok && c != nil {
-		conn = c
-	} else {
-		sqlDB, _ := db.DB()
-		conn, _ = sqlDB.Conn(context.Background())
+	conn, ok := db.Statement.ConnPool.(*migratorConn)
+	if !ok || conn == nil {
+		if c, ok := db.ConnPool.(*sql.Conn); ok && c != nil {
+			conn = &migratorConn{conn: c}
+		} else {
+			sqlDB, _ := db.DB()
+			conn = &migratorConn{db: sqlDB}
+		}
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		// Create a new session with a copy of the statement, so setting the
+		// connection of the migrator does not modify the statement of the
+		// caller.
+		db = db.Session(&gorm.Session{Context: ctx})
+		db.Statement.ConnPool = conn
 	}
-	db.ConnPool = conn
-	db.Statement.ConnPool = conn
 	return spannerMigrator{
 		Migrator: migrator.Migrator{
 			Config: migrator.Config{
@@ -134,6 +463,7 @@ func (dialector Dialector) Migrator(db *gorm.DB) gorm.Migrator {
 			},
 		},
 		Dialector: dialector,
+		conn:      conn,
 	}
 }
 
@@ -190,7 +520,7 @@ func (dialector Dialector) QuoteTo(writer clause.Writer, str string) {
 }
 
 func (dialector Dialector) Explain(sql string, vars ...interface{}) string {
-	return logger.ExplainSQL(sql, nil, `'`, vars...)
+	return logger.ExplainSQL(sql, nil, `'`, redactVars(vars)...)
 }
 
 func (dialector Dialector) DataTypeOf(field *schema.Field) string {
@@ -223,6 +553,11 @@ func (dialector Dialector) DataTypeOf(field *schema.Field) string {
 	case schema.Time:
 		return "TIMESTAMP"
 	}
+	// The allow_commit_timestamp option of CommitTimestamp fields is added
+	// by the migrator after the NOT NULL constraint and the default value.
+	if dialector.allowsCommitTimestamp(field) {
+		return "TIMESTAMP"
+	}
 
 	return string(field.DataType)
 }
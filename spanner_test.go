@@ -15,13 +15,18 @@
 package gorm
 
 import (
+	"context"
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
 	"cloud.google.com/go/spanner/apiv1/spannerpb"
 	"github.com/googleapis/go-sql-spanner/testutil"
 	"google.golang.org/protobuf/types/known/structpb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type singerWithCommitTimestamp struct {
@@ -78,6 +83,302 @@ func TestFloat32(t *testing.T) {
 	}
 }
 
+func TestDatabaseName(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		dialector *Dialector
+		want      string
+	}{
+		{Open("projects/p/instances/i/databases/d").(*Dialector), "projects/p/instances/i/databases/d"},
+		{Open("localhost:9010/projects/p/instances/i/databases/d?useplaintext=true").(*Dialector), "projects/p/instances/i/databases/d"},
+		{Open("projects/p/instances/i").(*Dialector), ""},
+		{New(Config{}).(*Dialector), ""},
+	} {
+		if g, w := test.dialector.DatabaseName(), test.want; g != w {
+			t.Errorf("%q: database name mismatch\n Got: %v\nWant: %v", test.dialector.DSN, g, w)
+		}
+	}
+}
+
+func TestConnectionOptions(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		options ConnectionOptions
+		want    string
+		wantErr bool
+	}{
+		{
+			options: ConnectionOptions{Project: "p", Instance: "i", Database: "d"},
+			want:    "projects/p/instances/i/databases/d",
+		},
+		{
+			options: ConnectionOptions{
+				Host:             "localhost:9010",
+				Project:          "my-project",
+				Instance:         "my-instance",
+				Database:         "my_database",
+				UsePlainText:     true,
+				MinSessions:      10,
+				MaxSessions:      100,
+				OptimizerVersion: "latest",
+				UserAgent:        "my-app/1.0",
+			},
+			want: "localhost:9010/projects/my-project/instances/my-instance/databases/my_database?maxSessions=100;minSessions=10;optimizerVersion=latest;usePlainText=true;userAgent=my-app/1.0",
+		},
+		{
+			options: ConnectionOptions{Project: "p", Instance: "i", Database: "d", CredentialsFile: "/tmp/key.json"},
+			want:    "projects/p/instances/i/databases/d?credentials=/tmp/key.json",
+		},
+		{options: ConnectionOptions{Instance: "i", Database: "d"}, wantErr: true},
+		{options: ConnectionOptions{Project: "p", Instance: "My_Instance", Database: "d"}, wantErr: true},
+		{options: ConnectionOptions{Project: "p", Instance: "i"}, wantErr: true},
+		{options: ConnectionOptions{Project: "p", Instance: "i", Database: "d", UsePlainText: true, CredentialsFile: "/tmp/key.json"}, wantErr: true},
+		{options: ConnectionOptions{Project: "p", Instance: "i", Database: "d", MinSessions: 10, MaxSessions: 5}, wantErr: true},
+		{options: ConnectionOptions{Project: "p", Instance: "i", Database: "d", UserAgent: "a;b"}, wantErr: true},
+	} {
+		dsn, err := test.options.DSN()
+		if g, w := err != nil, test.wantErr; g != w {
+			t.Errorf("%+v: error mismatch\n Got: %v\nWant error: %v", test.options, err, w)
+			continue
+		}
+		if g, w := dsn, test.want; g != w {
+			t.Errorf("%+v: DSN mismatch\n Got: %v\nWant: %v", test.options, g, w)
+		}
+		if err == nil {
+			if _, err := parseDSN(dsn); err != nil {
+				t.Errorf("%+v: failed to parse DSN: %v", test.options, err)
+			}
+		}
+	}
+}
+
+func TestOpenWithConnectionOptions(t *testing.T) {
+	t.Parallel()
+
+	server, _, teardown := setupMockedTestServer(t)
+	defer teardown()
+	_ = putDialectResult(server, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+
+	config := Config{Connection: &ConnectionOptions{
+		Host:         server.Address,
+		Project:      "p",
+		Instance:     "i",
+		Database:     "d",
+		UsePlainText: true,
+	}}
+	db, err := gorm.Open(New(config), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := db.Dialector.(*Dialector).DatabaseName(), "projects/p/instances/i/databases/d"; g != w {
+		t.Fatalf("database name mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	config.DSN = "projects/p/instances/i/databases/other"
+	if _, err := gorm.Open(New(config), &gorm.Config{}); err == nil {
+		t.Fatal("missing expected error for DSN and Connection")
+	}
+	if _, err := gorm.Open(New(Config{Connection: &ConnectionOptions{Project: "p"}}), &gorm.Config{}); err == nil {
+		t.Fatal("missing expected error for invalid connection options")
+	}
+}
+
+func TestOpenDoesNotChangeDialector(t *testing.T) {
+	t.Parallel()
+
+	server, _, teardown := setupMockedTestServer(t)
+	defer teardown()
+	_ = putDialectResult(server, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+
+	dialector := New(Config{Connection: &ConnectionOptions{
+		Host:         server.Address,
+		Project:      "p",
+		Instance:     "i",
+		Database:     "d",
+		UsePlainText: true,
+	}})
+	db1, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db2, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := dialector.(*Dialector).Config
+	if g, w := config.DSN, ""; g != w {
+		t.Fatalf("DSN mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := config.DriverName, ""; g != w {
+		t.Fatalf("driver name mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	d1, d2 := db1.Dialector.(*Dialector), db2.Dialector.(*Dialector)
+	if d1.sharedClient == nil || d1.sharedClient == d2.sharedClient {
+		t.Fatal("databases must have their own client")
+	}
+	if g, w := d1.DatabaseName(), "projects/p/instances/i/databases/d"; g != w {
+		t.Fatalf("database name mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	// Closing one database does not close the client of the other.
+	if sqlDB, err := db1.DB(); err != nil {
+		t.Fatal(err)
+	} else if err := sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d2.spannerClient(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type singerWithAutoTime struct {
+	ID            int64
+	Name          string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	CreatedMillis int64 `gorm:"autoCreateTime:milli"`
+	UpdatedNanos  int64 `gorm:"autoUpdateTime:nano"`
+}
+
+func (singerWithAutoTime) TableName() string {
+	return "singers"
+}
+
+func TestAutoTimePrecision(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	s := singerWithAutoTime{ID: 1, Name: "First"}
+	_ = putSingerResult(server, "INSERT INTO `singers` (`name`,`created_at`,`updated_at`,`created_millis`,`updated_nanos`,`id`) VALUES (@p1,@p2,@p3,@p4,@p5,@p6) THEN RETURN `id`",
+		singerWithCommitTimestamp{ID: 1})
+	if err := db.Create(&s).Error; err != nil {
+		t.Fatalf("failed to create singer: %v", err)
+	}
+	req := getLastSqlRequest(server)
+	createdAt, err := time.Parse(time.RFC3339Nano, req.Params.Fields["p2"].GetStringValue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := createdAt, s.CreatedAt; !g.Equal(w) {
+		t.Errorf("created_at mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p4"].GetStringValue(), strconv.FormatInt(s.CreatedMillis, 10); g != w {
+		t.Errorf("created_millis mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := req.Params.Fields["p5"].GetStringValue(), strconv.FormatInt(s.UpdatedNanos, 10); g != w {
+		t.Errorf("updated_nanos mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := s.CreatedMillis, s.CreatedAt.UnixMilli(); g < w-1000 || g > w+1000 {
+		t.Errorf("created_millis does not contain milliseconds\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := s.UpdatedNanos, s.UpdatedAt.UnixNano(); g < w-int64(time.Second) || g > w+int64(time.Second) {
+		t.Errorf("updated_nanos does not contain nanoseconds\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestUseCommitTimestampForAutoTime(t *testing.T) {
+	db, _, teardown := setupTestGormConnectionWithConfig(t, "", Config{UseCommitTimestampForAutoTime: true})
+	defer teardown()
+
+	s := singerWithAutoTime{ID: 1, Name: "First"}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Create(&s).Statement
+	if g, w := stmt.SQL.String(), "INSERT INTO `singers` (`name`,`created_at`,`updated_at`,`created_millis`,`updated_nanos`,`id`) "+
+		"VALUES (?,PENDING_COMMIT_TIMESTAMP(),PENDING_COMMIT_TIMESTAMP(),?,?,?) THEN RETURN `id`"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	stmt = db.Session(&gorm.Session{DryRun: true}).Model(&s).Update("name", "Second").Statement
+	if g, w := stmt.SQL.String(), "UPDATE `singers` SET `name`=?,`updated_at`=PENDING_COMMIT_TIMESTAMP(),`updated_nanos`=? WHERE `id` = ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	stmt = &gorm.Statement{DB: db}
+	if err := stmt.Parse(&singerWithAutoTime{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"CreatedAt":     "TIMESTAMP OPTIONS (allow_commit_timestamp=true)",
+		"UpdatedAt":     "TIMESTAMP OPTIONS (allow_commit_timestamp=true)",
+		"CreatedMillis": "INT64",
+	} {
+		if g, w := db.Migrator().FullDataTypeOf(stmt.Schema.LookUpField(name)).SQL, want; g != w {
+			t.Errorf("%s data type mismatch\n Got: %v\nWant: %v", name, g, w)
+		}
+	}
+}
+
+type auditedSinger struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	CreatedAt time.Time `spannerGorm:"commit_timestamp"`
+	UpdatedAt time.Time `spannerGorm:"commit_timestamp"`
+	LastWrite time.Time `spannerGorm:"commit_timestamp"`
+	Reviewed  time.Time
+}
+
+func TestCommitTimestampTag(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	s := auditedSinger{ID: 1, Name: "First"}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Create(&s).Statement
+	if g, w := stmt.SQL.String(), "INSERT INTO `audited_singers` (`id`,`name`,`created_at`,`updated_at`,`last_write`,`reviewed`) "+
+		"VALUES (?,?,PENDING_COMMIT_TIMESTAMP(),PENDING_COMMIT_TIMESTAMP(),PENDING_COMMIT_TIMESTAMP(),?)"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	stmt = db.Session(&gorm.Session{DryRun: true}).Model(&s).Update("name", "Second").Statement
+	if g, w := stmt.SQL.String(), "UPDATE `audited_singers` SET `name`=?,`updated_at`=PENDING_COMMIT_TIMESTAMP() WHERE `id` = ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	stmt = db.Session(&gorm.Session{DryRun: true}).Save(&s).Statement
+	if g, w := stmt.SQL.String(), "UPDATE `audited_singers` SET `name`=?,`created_at`=?,`updated_at`=PENDING_COMMIT_TIMESTAMP(),"+
+		"`last_write`=PENDING_COMMIT_TIMESTAMP(),`reviewed`=? WHERE `id` = ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	stmt = &gorm.Statement{DB: db}
+	if err := stmt.Parse(&auditedSinger{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"CreatedAt": "TIMESTAMP OPTIONS (allow_commit_timestamp=true)",
+		"LastWrite": "TIMESTAMP OPTIONS (allow_commit_timestamp=true)",
+		"Reviewed":  "TIMESTAMP",
+	} {
+		if g, w := db.Migrator().FullDataTypeOf(stmt.Schema.LookUpField(name)).SQL, want; g != w {
+			t.Errorf("%s data type mismatch\n Got: %v\nWant: %v", name, g, w)
+		}
+	}
+}
+
+func TestCommitTimestampCallsPreviousClauseBuilders(t *testing.T) {
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+	dialector, err := spannerDialector(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{clause.Values{}.Name(), clause.Set{}.Name()} {
+		name := name
+		db.ClauseBuilders[name] = func(c clause.Clause, builder clause.Builder) {
+			_, _ = builder.WriteString("/* " + name + " */ ")
+			c.Build(builder)
+		}
+	}
+	dialector.registerCommitTimestamps(db)
+
+	s := auditedSinger{ID: 1, Name: "First"}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Create(&s).Statement
+	if g, w := stmt.SQL.String(), "INSERT INTO `audited_singers` /* VALUES */ (`id`,`name`,`created_at`,`updated_at`,`last_write`,`reviewed`) "+
+		"VALUES (?,?,PENDING_COMMIT_TIMESTAMP(),PENDING_COMMIT_TIMESTAMP(),PENDING_COMMIT_TIMESTAMP(),?)"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	stmt = db.Session(&gorm.Session{DryRun: true}).Model(&s).Update("name", "Second").Statement
+	if g, w := stmt.SQL.String(), "UPDATE `audited_singers` /* SET */ SET `name`=?,`updated_at`=PENDING_COMMIT_TIMESTAMP() WHERE `id` = ?"; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
 func putSingerResult(server *testutil.MockedSpannerInMemTestServer, sql string, s singerWithCommitTimestamp) error {
 	return server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
 		Type: testutil.StatementResultResultSet,
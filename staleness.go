@@ -0,0 +1,235 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+)
+
+const (
+	readOnlyStalenessKey  = "gorm:spanner:read_only_staleness"
+	staleQueryConnKey     = "gorm:spanner:stale_query_conn"
+	staleQueryConnPoolKey = "gorm:spanner:stale_query_conn_pool"
+)
+
+// WithReadOnlyStaleness returns a gorm database that executes queries with the
+// given read-only staleness. This can be used to execute queries as stale
+// reads, which can be served by any replica that is sufficiently up to date.
+// The staleness is only applied to queries that are executed outside of a
+// transaction. Executing a query with a staleness in a read/write transaction
+// returns an error.
+//
+// Example:
+//
+//	var singers []Singer
+//	err := spannergorm.WithReadOnlyStaleness(db, spanner.ExactStaleness(15*time.Second)).Find(&singers).Error
+func WithReadOnlyStaleness(db *gorm.DB, bound spanner.TimestampBound) *gorm.DB {
+	return db.Set(readOnlyStalenessKey, bound)
+}
+
+type readOnlyTransactionKey struct{}
+
+// ReadOnlyTransaction starts a read-only transaction with the given timestamp
+// bound, and returns a gorm database that executes all queries in that
+// transaction. All queries in the transaction read data at the same
+// timestamp. Read-only transactions do not take any locks, and stale
+// read-only transactions can be served by any replica that is sufficiently
+// up to date. The transaction must be ended by calling Commit or Rollback on
+// the returned database.
+//
+// Example:
+//
+//	tx := spannergorm.ReadOnlyTransaction(db, spanner.ExactStaleness(10*time.Second))
+//	if tx.Error != nil {
+//	  return tx.Error
+//	}
+//	defer tx.Commit()
+//	tx.Find(&singers)
+//	tx.Find(&albums)
+func ReadOnlyTransaction(db *gorm.DB, bound spanner.TimestampBound) *gorm.DB {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return db.WithContext(context.WithValue(ctx, readOnlyTransactionKey{}, bound)).
+		Begin(&sql.TxOptions{ReadOnly: true})
+}
+
+type writeBarrierKey struct{}
+
+// writeBarrier keeps track of whether a write has been executed with a
+// context that was returned by WithMaxStalenessUntilWrite.
+type writeBarrier struct {
+	maxStaleness time.Duration
+	written      atomic.Bool
+}
+
+// WithMaxStalenessUntilWrite returns a context that makes queries that are
+// executed outside of a transaction with this context use a bounded staleness
+// of at most maxStaleness, until a write has been executed with the context.
+// All queries with the context are executed as strong reads after the first
+// insert, update, delete or Exec call, including writes in transactions that
+// use the context. This makes reads cheap, while preventing that a request
+// does not see its own writes.
+//
+// Create one context per request, as the write barrier is shared by all
+// operations that use the context. A read-only staleness that is set with
+// WithReadOnlyStaleness takes precedence. Writes that are not executed by gorm,
+// for example mutations that are buffered with WithSpannerConn, are not
+// detected. Call MarkWritten after such writes.
+//
+// Example:
+//
+//	ctx := spannergorm.WithMaxStalenessUntilWrite(r.Context(), 10*time.Second)
+//	// This query uses a bounded staleness of max 10 seconds.
+//	db.WithContext(ctx).Find(&singers)
+//	db.WithContext(ctx).Create(&singer)
+//	// This query is executed as a strong read.
+//	db.WithContext(ctx).Find(&singers)
+func WithMaxStalenessUntilWrite(ctx context.Context, maxStaleness time.Duration) context.Context {
+	return context.WithValue(ctx, writeBarrierKey{}, &writeBarrier{maxStaleness: maxStaleness})
+}
+
+// MarkWritten marks that a write has been executed with the given context.
+// Queries that are executed with the context after this are strong reads. See
+// WithMaxStalenessUntilWrite for more information. MarkWritten is a no-op if
+// the context was not returned by WithMaxStalenessUntilWrite.
+func MarkWritten(ctx context.Context) {
+	if barrier, ok := ctx.Value(writeBarrierKey{}).(*writeBarrier); ok {
+		barrier.written.Store(true)
+	}
+}
+
+// registerStaleQueryCallbacks registers the callbacks that execute a query on
+// a connection with the read-only staleness that was set with
+// WithReadOnlyStaleness or WithMaxStalenessUntilWrite, and the callbacks that
+// detect writes for WithMaxStalenessUntilWrite.
+func registerStaleQueryCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("gorm:spanner:before_stale_query", beforeStaleQuery); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("gorm:spanner:after_stale_query", afterStaleQuery); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().Before("gorm:create").Register("gorm:spanner:mark_written", markWritten); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("gorm:spanner:mark_written", markWritten); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("gorm:spanner:mark_written", markWritten); err != nil {
+		return err
+	}
+	return db.Callback().Raw().Before("gorm:raw").Register("gorm:spanner:mark_written", markWritten)
+}
+
+// markWritten marks the write barrier of the context of the statement before
+// a write is executed. The barrier is also marked if the write fails, as the
+// outcome of a failed write is not always known.
+func markWritten(db *gorm.DB) {
+	if db.DryRun || db.Statement.Context == nil {
+		return
+	}
+	MarkWritten(db.Statement.Context)
+}
+
+// staleness returns the read-only staleness for the query of the statement,
+// and whether the staleness was set explicitly with WithReadOnlyStaleness.
+func staleness(db *gorm.DB) (bound spanner.TimestampBound, explicit bool, ok bool) {
+	if value, found := db.Get(readOnlyStalenessKey); found {
+		bound, ok = value.(spanner.TimestampBound)
+		return bound, true, ok
+	}
+	if db.Statement.Context == nil {
+		return bound, false, false
+	}
+	barrier, found := db.Statement.Context.Value(writeBarrierKey{}).(*writeBarrier)
+	if !found || barrier.written.Load() {
+		return bound, false, false
+	}
+	return spanner.MaxStaleness(barrier.maxStaleness), false, true
+}
+
+func beforeStaleQuery(db *gorm.DB) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+	bound, explicit, ok := staleness(db)
+	if !ok {
+		return
+	}
+	if _, ok := unwrapConnPool(db.Statement.ConnPool).(gorm.TxCommitter); ok {
+		// The default staleness of WithMaxStalenessUntilWrite is only applied
+		// to queries outside of transactions.
+		if explicit {
+			_ = db.AddError(fmt.Errorf("read-only staleness cannot be used in a read/write transaction"))
+		}
+		return
+	}
+	pool, err := sqlDB(db.Statement.Context, db)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	conn, err := pool.Conn(db.Statement.Context)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	if err := setReadOnlyStaleness(conn, bound); err != nil {
+		_ = conn.Close()
+		_ = db.AddError(err)
+		return
+	}
+	db.InstanceSet(staleQueryConnKey, conn)
+	db.InstanceSet(staleQueryConnPoolKey, db.Statement.ConnPool)
+	db.Statement.ConnPool = conn
+}
+
+func afterStaleQuery(db *gorm.DB) {
+	value, ok := db.InstanceGet(staleQueryConnKey)
+	if !ok {
+		return
+	}
+	conn := value.(*sql.Conn)
+	if pool, ok := db.InstanceGet(staleQueryConnPoolKey); ok {
+		db.Statement.ConnPool = pool.(gorm.ConnPool)
+	}
+	// Reset the staleness before the connection is returned to the pool.
+	if err := setReadOnlyStaleness(conn, spanner.StrongRead()); err != nil {
+		_ = db.AddError(err)
+	}
+	if err := conn.Close(); err != nil {
+		_ = db.AddError(err)
+	}
+}
+
+func setReadOnlyStaleness(conn *sql.Conn, bound spanner.TimestampBound) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		spannerConn, ok := driverConn.(spannerdriver.SpannerConn)
+		if !ok {
+			return fmt.Errorf("not a Spanner connection: %T", driverConn)
+		}
+		return spannerConn.SetReadOnlyStaleness(bound)
+	})
+}
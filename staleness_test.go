@@ -0,0 +1,205 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"gorm.io/gorm"
+)
+
+func TestWithReadOnlyStaleness(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+
+	var singers []singerWithCommitTimestamp
+	if err := WithReadOnlyStaleness(db, spanner.ExactStaleness(10*time.Second)).Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute stale query: %v", err)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.Sql, querySql; g != w {
+		t.Fatalf("sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	readOnly := req.GetTransaction().GetSingleUse().GetReadOnly()
+	if readOnly == nil || readOnly.GetExactStaleness() == nil {
+		t.Fatalf("query was not executed with exact staleness: %v", req.GetTransaction())
+	}
+	if g, w := readOnly.GetExactStaleness().AsDuration(), 10*time.Second; g != w {
+		t.Fatalf("staleness mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The staleness should not be used for other queries.
+	if err := db.Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	req = getLastSqlRequest(server)
+	if !req.GetTransaction().GetSingleUse().GetReadOnly().GetStrong() {
+		t.Fatalf("query was not executed as a strong read: %v", req.GetTransaction())
+	}
+	sqlDB, _ := db.DB()
+	if g, w := sqlDB.Stats().InUse, 0; g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Stale reads are not possible in read/write transactions.
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return WithReadOnlyStaleness(tx, spanner.ExactStaleness(10*time.Second)).Find(&singers).Error
+	})
+	if err == nil {
+		t.Fatal("missing expected error for stale read in read/write transaction")
+	}
+}
+
+func TestWithMaxStalenessUntilWrite(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+	updateSql := "UPDATE `singers` SET `name`=@p1 WHERE `id` = @p2"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+
+	ctx := WithMaxStalenessUntilWrite(context.Background(), 10*time.Second)
+	var singers []singerWithCommitTimestamp
+	if err := db.WithContext(ctx).Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	req := getLastSqlRequest(server)
+	if g, w := req.GetTransaction().GetSingleUse().GetReadOnly().GetMaxStaleness().AsDuration(), 10*time.Second; g != w {
+		t.Fatalf("max staleness mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The default staleness is not used in read/write transactions.
+	if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Find(&singers).Error
+	}); err != nil {
+		t.Fatalf("failed to execute query in transaction: %v", err)
+	}
+	// Reading in a transaction does not mark the context as written.
+	if err := db.WithContext(ctx).Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	req = getLastSqlRequest(server)
+	if req.GetTransaction().GetSingleUse().GetReadOnly().GetMaxStaleness() == nil {
+		t.Fatalf("query was not executed with max staleness: %v", req.GetTransaction())
+	}
+
+	// Queries are strong reads after a write.
+	if err := db.WithContext(ctx).Model(&singerWithCommitTimestamp{ID: 1}).Update("name", "test").Error; err != nil {
+		t.Fatalf("failed to execute update: %v", err)
+	}
+	if err := db.WithContext(ctx).Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	req = getLastSqlRequest(server)
+	if !req.GetTransaction().GetSingleUse().GetReadOnly().GetStrong() {
+		t.Fatalf("query was not executed as a strong read: %v", req.GetTransaction())
+	}
+
+	// Other contexts are not affected.
+	otherCtx := WithMaxStalenessUntilWrite(context.Background(), 5*time.Second)
+	if err := db.WithContext(otherCtx).Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	req = getLastSqlRequest(server)
+	if g, w := req.GetTransaction().GetSingleUse().GetReadOnly().GetMaxStaleness().AsDuration(), 5*time.Second; g != w {
+		t.Fatalf("max staleness mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	MarkWritten(otherCtx)
+	if err := db.WithContext(otherCtx).Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	req = getLastSqlRequest(server)
+	if !req.GetTransaction().GetSingleUse().GetReadOnly().GetStrong() {
+		t.Fatalf("query was not executed as a strong read: %v", req.GetTransaction())
+	}
+	sqlDB, _ := db.DB()
+	if g, w := sqlDB.Stats().InUse, 0; g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestReadOnlyTransaction(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	querySql := "SELECT * FROM `singers`"
+	_ = putSingerResult(server, querySql, singerWithCommitTimestamp{ID: 1})
+
+	tx := ReadOnlyTransaction(db, spanner.ExactStaleness(10*time.Second))
+	if tx.Error != nil {
+		t.Fatalf("failed to start read-only transaction: %v", tx.Error)
+	}
+	var singers []singerWithCommitTimestamp
+	for i := 0; i < 2; i++ {
+		if err := tx.Find(&singers).Error; err != nil {
+			t.Fatalf("failed to execute query: %v", err)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatalf("failed to commit read-only transaction: %v", err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	beginRequests := requestsOfType(reqs, reflect.TypeOf(&spannerpb.BeginTransactionRequest{}))
+	if g, w := len(beginRequests), 1; g != w {
+		t.Fatalf("begin request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	readOnly := beginRequests[0].(*spannerpb.BeginTransactionRequest).GetOptions().GetReadOnly()
+	if g, w := readOnly.GetExactStaleness().AsDuration(), 10*time.Second; g != w {
+		t.Fatalf("staleness mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	queries := 0
+	for _, req := range requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{})) {
+		sqlRequest := req.(*spannerpb.ExecuteSqlRequest)
+		if sqlRequest.Sql != querySql {
+			continue
+		}
+		queries++
+		if sqlRequest.GetTransaction().GetId() == nil {
+			t.Fatalf("query was not executed in the read-only transaction: %v", sqlRequest.GetTransaction())
+		}
+	}
+	if g, w := queries, 2; g != w {
+		t.Fatalf("query count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 0; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The staleness is reset when the transaction ends.
+	if err := db.Find(&singers).Error; err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	req := getLastSqlRequest(server)
+	if !req.GetTransaction().GetSingleUse().GetReadOnly().GetStrong() {
+		t.Fatalf("query was not executed as a strong read: %v", req.GetTransaction())
+	}
+	sqlDB, _ := db.DB()
+	if g, w := sqlDB.Stats().InUse, 0; g != w {
+		t.Fatalf("connections in use mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// SyncChildren makes the children of the given parent in the database equal to
+// the given set of children. The children must be a slice of a model that has
+// a has-many or has-one relationship with the parent. All given children are
+// inserted or updated, and all children of the parent in the database that are
+// not in the given set are deleted with one Delete mutation. The changes are
+// applied in one read/write transaction.
+//
+// The foreign key fields of the children are automatically set to the primary
+// key of the parent. Children that do not have a primary key value are
+// inserted.
+//
+// Example:
+//
+//	singer.Albums = []Album{{ID: 1, Title: "Updated title"}, {Title: "New album"}}
+//	err := spannergorm.SyncChildren(ctx, db, &singer, &singer.Albums)
+func SyncChildren(ctx context.Context, db *gorm.DB, parent interface{}, children interface{}) error {
+	childrenValue := reflect.Indirect(reflect.ValueOf(children))
+	if childrenValue.Kind() != reflect.Slice {
+		return fmt.Errorf("children must be a slice, got %T", children)
+	}
+	childType := childrenValue.Type().Elem()
+	for childType.Kind() == reflect.Ptr {
+		childType = childType.Elem()
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(parent); err != nil {
+			return err
+		}
+		rel := findChildRelationship(stmt.Schema, childType)
+		if rel == nil {
+			return fmt.Errorf("%s does not have a has-many or has-one relationship with %s", stmt.Schema.Name, childType.Name())
+		}
+		if len(rel.FieldSchema.PrimaryFields) == 0 {
+			return fmt.Errorf("%s does not have a primary key", rel.FieldSchema.Name)
+		}
+		parentValue := reflect.Indirect(reflect.ValueOf(parent))
+
+		// Set the foreign key of all children to the parent.
+		conditions := make([]clause.Expression, 0, len(rel.References))
+		for _, ref := range rel.References {
+			var value interface{}
+			if ref.OwnPrimaryKey {
+				v, zero := ref.PrimaryKey.ValueOf(ctx, parentValue)
+				if zero {
+					return fmt.Errorf("primary key of %s has not been set", stmt.Schema.Name)
+				}
+				value = v
+			} else if ref.PrimaryValue != "" {
+				value = ref.PrimaryValue
+			} else {
+				continue
+			}
+			for i := 0; i < childrenValue.Len(); i++ {
+				if err := ref.ForeignKey.Set(ctx, reflect.Indirect(childrenValue.Index(i)), value); err != nil {
+					return err
+				}
+			}
+			conditions = append(conditions, clause.Eq{Column: clause.Column{Name: ref.ForeignKey.DBName}, Value: value})
+		}
+		// Without a condition on the parent, all children of all parents that
+		// are not in the given set would be deleted.
+		if len(conditions) == 0 {
+			return fmt.Errorf("the relationship between %s and %s does not have a foreign key that references the parent", stmt.Schema.Name, rel.FieldSchema.Name)
+		}
+
+		if childrenValue.Len() > 0 {
+			if err := tx.Clauses(clause.Insert{Modifier: "OR UPDATE"}).Omit(clause.Associations).Create(children).Error; err != nil {
+				return err
+			}
+		}
+		keep := make(map[string]bool, childrenValue.Len())
+		for i := 0; i < childrenValue.Len(); i++ {
+			keep[primaryKeyString(ctx, rel.FieldSchema, reflect.Indirect(childrenValue.Index(i)))] = true
+		}
+
+		existing := reflect.New(reflect.SliceOf(childType))
+		primaryKeys := make([]string, len(rel.FieldSchema.PrimaryFields))
+		for i, field := range rel.FieldSchema.PrimaryFields {
+			primaryKeys[i] = field.DBName
+		}
+		if err := tx.Select(primaryKeys).Clauses(clause.Where{Exprs: conditions}).Find(existing.Interface()).Error; err != nil {
+			return err
+		}
+		stale := reflect.New(reflect.SliceOf(childType))
+		for i := 0; i < existing.Elem().Len(); i++ {
+			child := existing.Elem().Index(i)
+			if !keep[primaryKeyString(ctx, rel.FieldSchema, child)] {
+				stale.Elem().Set(reflect.Append(stale.Elem(), child))
+			}
+		}
+		if stale.Elem().Len() == 0 {
+			return nil
+		}
+		// The children are deleted with one Delete mutation. Models with soft
+		// delete fall back to one DML statement for all children.
+		return WithMutations(tx).Delete(stale.Interface()).Error
+	})
+}
+
+func findChildRelationship(s *schema.Schema, childType reflect.Type) *schema.Relationship {
+	for _, rel := range s.Relationships.HasMany {
+		if rel.FieldSchema.ModelType == childType {
+			return rel
+		}
+	}
+	for _, rel := range s.Relationships.HasOne {
+		if rel.FieldSchema.ModelType == childType {
+			return rel
+		}
+	}
+	return nil
+}
+
+func primaryKeyString(ctx context.Context, s *schema.Schema, value reflect.Value) string {
+	key := ""
+	for _, field := range s.PrimaryFields {
+		v, _ := field.ValueOf(ctx, value)
+		key += fmt.Sprintf("%v/", v)
+	}
+	return key
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type syncSinger struct {
+	ID     int64
+	Name   string
+	Albums []syncAlbum `gorm:"foreignKey:SingerID"`
+}
+
+func (syncSinger) TableName() string {
+	return "singers"
+}
+
+type syncAlbum struct {
+	ID       int64
+	Title    string
+	SingerID int64
+}
+
+func (syncAlbum) TableName() string {
+	return "albums"
+}
+
+func TestSyncChildren(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	upsertSql := "INSERT OR UPDATE INTO `albums` (`title`,`singer_id`,`id`) VALUES (@p1,@p2,@p3),(@p4,@p5,@p6) THEN RETURN `id`"
+	_ = server.TestSpanner.PutStatementResult(upsertSql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{
+				RowType: &spannerpb.StructType{
+					Fields: []*spannerpb.StructType_Field{
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, Name: "id"},
+					},
+				},
+			},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{structpb.NewStringValue("1")}},
+				{Values: []*structpb.Value{structpb.NewStringValue("2")}},
+			},
+			Stats: &spannerpb.ResultSetStats{RowCount: &spannerpb.ResultSetStats_RowCountExact{RowCountExact: 2}},
+		},
+	})
+	selectSql := "SELECT `id` FROM `albums` WHERE `singer_id` = @p1"
+	_ = server.TestSpanner.PutStatementResult(selectSql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{
+				RowType: &spannerpb.StructType{
+					Fields: []*spannerpb.StructType_Field{
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_INT64}, Name: "id"},
+					},
+				},
+			},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{structpb.NewStringValue("1")}},
+				{Values: []*structpb.Value{structpb.NewStringValue("2")}},
+				{Values: []*structpb.Value{structpb.NewStringValue("3")}},
+			},
+		},
+	})
+	_ = drainRequestsFromServer(server.TestSpanner)
+	singer := syncSinger{ID: 1, Name: "Singer"}
+	singer.Albums = []syncAlbum{{ID: 1, Title: "Album 1"}, {ID: 2, Title: "Album 2"}}
+	if err := SyncChildren(context.Background(), db, &singer, &singer.Albums); err != nil {
+		t.Fatalf("failed to sync children: %v", err)
+	}
+	for _, album := range singer.Albums {
+		if g, w := album.SingerID, singer.ID; g != w {
+			t.Fatalf("singer id mismatch\n Got: %v\nWant: %v", g, w)
+		}
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	execReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(execReqs), 2; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, sql := range []string{upsertSql, selectSql} {
+		if g, w := execReqs[i].(*spannerpb.ExecuteSqlRequest).Sql, sql; g != w {
+			t.Fatalf("%d: sql mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	mutations := commitReqs[0].(*spannerpb.CommitRequest).Mutations
+	if g, w := len(mutations), 1; g != w {
+		t.Fatalf("mutation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	keys := mutations[0].GetDelete().GetKeySet().GetKeys()
+	if g, w := len(keys), 1; g != w {
+		t.Fatalf("deleted key count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := keys[0].Values[0].GetStringValue(), "3"; g != w {
+		t.Fatalf("deleted id mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// SynonymModel can be implemented by models that read and write their table
+// through a synonym. Queries and DML statements for the model use the synonym
+// that is returned by TableSynonym, while the migrator keeps using the name of
+// the table. This makes it possible to rename a table gradually:
+//
+//  1. Add the new name as a synonym with CreateSynonym, and let the model
+//     return it from TableSynonym.
+//  2. Rename the table with RenameTableWithSynonym. The old name becomes a
+//     synonym, and the model continues to work unchanged.
+//  3. Change the TableName method of the model to return the new name, remove
+//     TableSynonym, and drop the old name with DropSynonym.
+//
+// Statements that set the table explicitly with db.Table do not use the
+// synonym. Example:
+//
+//	type Singer struct {
+//	  ID   int64
+//	  Name string
+//	}
+//
+//	func (Singer) TableName() string {
+//	  return "singers"
+//	}
+//
+//	func (Singer) TableSynonym() string {
+//	  return "performers"
+//	}
+type SynonymModel interface {
+	TableSynonym() string
+}
+
+// tableSynonymOf returns the synonym of the table of the given schema, or an
+// empty string if the model of the schema does not implement SynonymModel.
+func tableSynonymOf(s *schema.Schema) string {
+	if s == nil || s.ModelType == nil {
+		return ""
+	}
+	model, ok := reflect.New(s.ModelType).Interface().(SynonymModel)
+	if !ok {
+		return ""
+	}
+	return model.TableSynonym()
+}
+
+// registerSynonymCallbacks registers callbacks that replace the table of
+// queries and DML statements for models that implement SynonymModel with the
+// synonym of the model.
+func registerSynonymCallbacks(db *gorm.DB) error {
+	useSynonym := func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.TableExpr != nil {
+			return
+		}
+		if synonym := tableSynonymOf(db.Statement.Schema); synonym != "" {
+			db.Statement.Table = synonym
+		}
+	}
+	if err := db.Callback().Create().Before("*").Register("gorm:spanner:table_synonym", useSynonym); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("*").Register("gorm:spanner:table_synonym", useSynonym); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("*").Register("gorm:spanner:table_synonym", useSynonym); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("*").Register("gorm:spanner:table_synonym", useSynonym); err != nil {
+		return err
+	}
+	return db.Callback().Row().Before("*").Register("gorm:spanner:table_synonym", useSynonym)
+}
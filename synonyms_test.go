@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gorm.io/gorm"
+)
+
+type synonymSinger struct {
+	ID   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name string
+}
+
+func (synonymSinger) TableName() string {
+	return "singers"
+}
+
+func (synonymSinger) TableSynonym() string {
+	return "performers"
+}
+
+func TestSynonymModel(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	dryRun := db.Session(&gorm.Session{DryRun: true})
+
+	for _, test := range []struct {
+		name string
+		stmt *gorm.Statement
+		want string
+	}{
+		{"create", dryRun.Create(&synonymSinger{ID: 1, Name: "Alice"}).Statement,
+			"INSERT INTO `performers` (`id`,`name`) VALUES (?,?)"},
+		{"query", dryRun.Where("name = ?", "Alice").Find(&[]synonymSinger{}).Statement,
+			"SELECT * FROM `performers` WHERE name = ?"},
+		{"update", dryRun.Model(&synonymSinger{ID: 1}).Update("name", "Bob").Statement,
+			"UPDATE `performers` SET `name`=? WHERE `id` = ?"},
+		{"delete", dryRun.Delete(&synonymSinger{ID: 1}).Statement,
+			"DELETE FROM `performers` WHERE `performers`.`id` = ?"},
+		{"table", dryRun.Table("singers").Find(&[]synonymSinger{}).Statement,
+			"SELECT * FROM `singers`"},
+	} {
+		if g, w := test.stmt.SQL.String(), test.want; g != w {
+			t.Errorf("%s: sql mismatch\n Got: %v\nWant: %v", test.name, g, w)
+		}
+	}
+
+	// The migrator uses the name of the table.
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	_ = putCountStatementResult(server, "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3", 0)
+	if err := db.Migrator().AutoMigrate(&synonymSinger{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE TABLE `singers` (`id` INT64,`name` STRING(MAX)) PRIMARY KEY (`id`)",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,435 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	rowDeletionPolicyTagSetting = "ROW_DELETION_POLICY"
+	nullFilteredTagSetting      = "INDEX_NULL_FILTERED"
+	storingTagSetting           = "STORING"
+	ttlAfterDeleteTagSetting    = "TTL_AFTER_DELETE"
+)
+
+var (
+	olderThanRegExp = regexp.MustCompile(`(?is)^OLDER_THAN\s*\(.+\)$`)
+	ttlDaysRegExp   = regexp.MustCompile(`(?i)^(\d+)\s*(?:d|days?)?$`)
+)
+
+// spannerGormSettings returns the settings in the `spannerGorm` tag of the
+// given field. Settings are separated by ',' or ';'. Separators inside
+// parentheses are ignored, and values without a key are added to the list of
+// columns of a preceding `storing` setting. This makes it possible to write
+// tags like `spannerGorm:"index_null_filtered;storing:col_a,col_b"`.
+func spannerGormSettings(field *schema.Field) (map[string]string, bool) {
+	tag, ok := field.Tag.Lookup(spannerGormTag)
+	if !ok {
+		return nil, false
+	}
+	settings := map[string]string{}
+	var last string
+	for _, part := range splitTagSettings(tag) {
+		key, value, hasValue := strings.Cut(part, ":")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		if !hasValue && last == storingTagSetting {
+			settings[last] += "," + strings.TrimSpace(part)
+			continue
+		}
+		if !hasValue {
+			value = key
+		}
+		settings[key] = value
+		last = key
+	}
+	return settings, true
+}
+
+// splitTagSettings splits a tag on all ',' and ';' characters that are not
+// inside parentheses.
+func splitTagSettings(tag string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range tag {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',', ';':
+			if depth == 0 {
+				parts = append(parts, tag[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, tag[start:])
+}
+
+// rowDeletionPolicyOf returns the row deletion policy of the given schema, or
+// an empty string if the table has no row deletion policy. A row deletion
+// policy is added to a table by adding a `spannerGorm` tag with the setting
+// `row_deletion_policy` to one of the fields of the model, typically the
+// timestamp column that the policy uses. Example:
+//
+//	type Event struct {
+//	  ID        int64
+//	  CreatedAt time.Time `spannerGorm:"row_deletion_policy:OLDER_THAN(created_at, INTERVAL 30 DAY)"`
+//	}
+//
+// AutoMigrate then creates the table with the clause
+// `ROW DELETION POLICY (OLDER_THAN(created_at, INTERVAL 30 DAY))`. The policy
+// is added to an existing table that has no policy, and replaces the policy of
+// an existing table that has a different policy. Removing the setting does not
+// drop the policy of the table.
+//
+// The setting `ttl_after_delete` on a gorm.DeletedAt field is a shorthand for
+// a policy that deletes soft-deleted rows after the given number of days. The
+// tag `spannerGorm:"ttl_after_delete:30d"` on the field DeletedAt creates the
+// policy `OLDER_THAN(deleted_at, INTERVAL 30 DAY)`. Spanner never deletes rows
+// whose deleted_at column is NULL.
+//
+// A *ModelError is returned if the setting is invalid.
+func rowDeletionPolicyOf(s *schema.Schema) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	var result string
+	for _, field := range s.Fields {
+		settings, ok := spannerGormSettings(field)
+		if !ok {
+			continue
+		}
+		policy, hasPolicy := settings[rowDeletionPolicyTagSetting]
+		ttl, hasTTL := settings[ttlAfterDeleteTagSetting]
+		if !hasPolicy && !hasTTL {
+			continue
+		}
+		if result != "" || (hasPolicy && hasTTL) {
+			return "", &ModelError{
+				Model:      s.Name,
+				Field:      field.Name,
+				Problem:    "the model has more than one row_deletion_policy or ttl_after_delete setting",
+				Suggestion: "Remove all but one of the row_deletion_policy and ttl_after_delete settings",
+			}
+		}
+		if hasTTL {
+			var err error
+			if result, err = ttlAfterDeletePolicy(s, field, ttl); err != nil {
+				return "", err
+			}
+			continue
+		}
+		policy = strings.TrimSpace(policy)
+		if strings.HasPrefix(policy, "(") && strings.HasSuffix(policy, ")") {
+			policy = strings.TrimSpace(policy[1 : len(policy)-1])
+		}
+		if !olderThanRegExp.MatchString(policy) {
+			return "", &ModelError{
+				Model:      s.Name,
+				Field:      field.Name,
+				Problem:    fmt.Sprintf("row deletion policy %q is not supported", policy),
+				Suggestion: "Use a policy of the form `spannerGorm:\"row_deletion_policy:OLDER_THAN(created_at, INTERVAL 30 DAY)\"`",
+			}
+		}
+		result = policy
+	}
+	return result, nil
+}
+
+// ttlAfterDeletePolicy returns the row deletion policy for the
+// `ttl_after_delete` setting with the given value on the given field.
+func ttlAfterDeletePolicy(s *schema.Schema, field *schema.Field, ttl string) (string, error) {
+	if field.FieldType != reflect.TypeOf(gorm.DeletedAt{}) {
+		return "", &ModelError{
+			Model:      s.Name,
+			Field:      field.Name,
+			Problem:    "ttl_after_delete can only be used on a gorm.DeletedAt field",
+			Suggestion: "Use `spannerGorm:\"row_deletion_policy:OLDER_THAN(column, INTERVAL 30 DAY)\"` for other fields",
+		}
+	}
+	match := ttlDaysRegExp.FindStringSubmatch(strings.TrimSpace(ttl))
+	if match == nil {
+		return "", &ModelError{
+			Model:      s.Name,
+			Field:      field.Name,
+			Problem:    fmt.Sprintf("ttl_after_delete %q is not supported", ttl),
+			Suggestion: "Use a number of days, e.g. `spannerGorm:\"ttl_after_delete:30d\"`. Spanner only supports row deletion policies in days",
+		}
+	}
+	return fmt.Sprintf("OLDER_THAN(%s, INTERVAL %s DAY)", field.DBName, match[1]), nil
+}
+
+// getRowDeletionPolicySql returns the row deletion policy of a table.
+const getRowDeletionPolicySql = "SELECT ROW_DELETION_POLICY_EXPRESSION FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+
+// rowDeletionPolicyInDatabase returns the row deletion policy of the table of
+// the given statement in the database, or an empty string if the table has no
+// row deletion policy.
+func (m spannerMigrator) rowDeletionPolicyInDatabase(stmt *gorm.Statement) (string, error) {
+	tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+	var policy sql.NullString
+	if err := m.DB.Raw(getRowDeletionPolicySql, tableSchema, table).Row().Scan(&policy); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return policy.String, nil
+}
+
+// sameRowDeletionPolicy returns true if the given row deletion policies are
+// equal, ignoring case, whitespace and quotes.
+func sameRowDeletionPolicy(a, b string) bool {
+	normalize := func(policy string) string {
+		return strings.ToUpper(strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) || r == '`' {
+				return -1
+			}
+			return r
+		}, policy))
+	}
+	return normalize(a) == normalize(b)
+}
+
+// migrateRowDeletionPolicy adds the row deletion policy of the given model to
+// its existing table, or replaces the row deletion policy of the table if it
+// differs from the model. A row deletion policy is never dropped by
+// AutoMigrate.
+func (m spannerMigrator) migrateRowDeletionPolicy(value interface{}) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		policy, err := rowDeletionPolicyOf(stmt.Schema)
+		if err != nil || policy == "" {
+			return err
+		}
+		current, err := m.rowDeletionPolicyInDatabase(stmt)
+		if err != nil {
+			return err
+		}
+		if sameRowDeletionPolicy(current, policy) {
+			return nil
+		}
+		action := "REPLACE"
+		if current == "" {
+			action = "ADD"
+		}
+		return m.DB.Exec("ALTER TABLE ? "+action+" ROW DELETION POLICY (?)", m.CurrentTable(stmt), clause.Expr{SQL: policy}).Error
+	})
+}
+
+// spannerIndexOptions contains the Spanner-specific options of an index.
+type spannerIndexOptions struct {
+	nullFiltered bool
+	storing      []string
+}
+
+// indexOptionsOf returns the Spanner-specific options of the given index.
+// These are set with the settings `index_null_filtered` and `storing` in the
+// `spannerGorm` tag of one of the fields of the index. Example:
+//
+//	type Singer struct {
+//	  ID        int64
+//	  FirstName string
+//	  LastName  string `gorm:"index:idx_singers_last_name" spannerGorm:"index_null_filtered;storing:first_name"`
+//	}
+//
+// AutoMigrate then creates the index with the statement
+// `CREATE NULL_FILTERED INDEX idx_singers_last_name ON singers (last_name) STORING (first_name)`.
+// An existing index is dropped and created again if its NULL_FILTERED option
+// differs from the model, and its STORING columns are changed with ALTER INDEX
+// if they differ from the model.
+func indexOptionsOf(idx *schema.Index) spannerIndexOptions {
+	var options spannerIndexOptions
+	seen := map[string]bool{}
+	for _, field := range idx.Fields {
+		settings, ok := spannerGormSettings(field.Field)
+		if !ok {
+			continue
+		}
+		if _, ok := settings[nullFilteredTagSetting]; ok {
+			options.nullFiltered = true
+		}
+		if storing, ok := settings[storingTagSetting]; ok {
+			for _, column := range strings.Split(storing, ",") {
+				if column = strings.TrimSpace(column); column != "" && !seen[column] {
+					seen[column] = true
+					options.storing = append(options.storing, column)
+				}
+			}
+		}
+	}
+	return options
+}
+
+// hasIndexOptions returns true if one of the indexes of the given schema has a
+// NULL_FILTERED or STORING option.
+func hasIndexOptions(s *schema.Schema) bool {
+	for _, idx := range s.ParseIndexes() {
+		if options := indexOptionsOf(&idx); options.nullFiltered || len(options.storing) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// getIndexOptionsSql returns the NULL_FILTERED option and the STORING columns
+// of the secondary indexes of a table.
+const getIndexOptionsSql = `SELECT I.INDEX_NAME, I.IS_NULL_FILTERED, IC.COLUMN_NAME
+			FROM INFORMATION_SCHEMA.INDEXES I
+			LEFT JOIN INFORMATION_SCHEMA.INDEX_COLUMNS IC
+				ON IC.TABLE_CATALOG = I.TABLE_CATALOG
+				AND IC.TABLE_SCHEMA = I.TABLE_SCHEMA
+				AND IC.TABLE_NAME = I.TABLE_NAME
+				AND IC.INDEX_NAME = I.INDEX_NAME
+				AND IC.ORDINAL_POSITION IS NULL
+			WHERE I.TABLE_SCHEMA = ? AND I.TABLE_NAME = ? AND I.INDEX_TYPE = 'INDEX'
+			ORDER BY I.INDEX_NAME, IC.COLUMN_NAME`
+
+// indexOptionsInDatabase returns the options of the secondary indexes of the
+// table of the given statement in the database by index name.
+func (m spannerMigrator) indexOptionsInDatabase(stmt *gorm.Statement) (map[string]spannerIndexOptions, error) {
+	tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+	rows, err := m.DB.Raw(getIndexOptionsSql, tableSchema, table).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make(map[string]spannerIndexOptions)
+	for rows.Next() {
+		var name string
+		var nullFiltered bool
+		var column sql.NullString
+		if err := rows.Scan(&name, &nullFiltered, &column); err != nil {
+			return nil, err
+		}
+		options := indexes[name]
+		options.nullFiltered = nullFiltered
+		if column.Valid {
+			options.storing = append(options.storing, column.String)
+		}
+		indexes[name] = options
+	}
+	return indexes, rows.Err()
+}
+
+// migrateIndexOptions changes the existing indexes of the given model whose
+// NULL_FILTERED or STORING options in the database differ from the model.
+// Spanner does not support changing the NULL_FILTERED option of an index, so
+// the index is dropped and created again. STORING columns are added and
+// dropped with ALTER INDEX.
+func (m spannerMigrator) migrateIndexOptions(value interface{}) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		current, err := m.indexOptionsInDatabase(stmt)
+		if err != nil {
+			return err
+		}
+		indexes := stmt.Schema.ParseIndexes()
+		names := make([]string, 0, len(indexes))
+		for name := range indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			idx := indexes[name]
+			indexName := idx.Name
+			if i := strings.IndexByte(indexName, '.'); i >= 0 {
+				indexName = indexName[i+1:]
+			}
+			got, ok := current[indexName]
+			if !ok {
+				// The index is created by AutoMigrate.
+				continue
+			}
+			want := indexOptionsOf(&idx)
+			if got.nullFiltered != want.nullFiltered {
+				if err := m.DropIndex(value, idx.Name); err != nil {
+					return err
+				}
+				if err := m.CreateIndex(value, idx.Name); err != nil {
+					return err
+				}
+				continue
+			}
+			index := clause.Column{Name: qualifiedIndexName(qualifiedTableName(stmt), idx.Name)}
+			for _, column := range want.storing {
+				if !containsString(got.storing, column) {
+					if err := m.DB.Exec("ALTER INDEX ? ADD STORED COLUMN ?", index, clause.Column{Name: column}).Error; err != nil {
+						return err
+					}
+				}
+			}
+			for _, column := range got.storing {
+				if !containsString(want.storing, column) {
+					if err := m.DB.Exec("ALTER INDEX ? DROP STORED COLUMN ?", index, clause.Column{Name: column}).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// CreateIndex creates the index with the given name, including the
+// NULL_FILTERED and STORING options that are set in the `spannerGorm` tags of
+// the fields of the index.
+func (m spannerMigrator) CreateIndex(value interface{}, name string) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if stmt.Schema == nil {
+			return errors.New("failed to get schema")
+		}
+		idx := stmt.Schema.LookIndex(name)
+		if idx == nil {
+			return fmt.Errorf("failed to create index with name %s", name)
+		}
+		options := indexOptionsOf(idx)
+		opts := m.BuildIndexOptions(idx.Fields, stmt)
+		values := []interface{}{clause.Column{Name: qualifiedIndexName(qualifiedTableName(stmt), idx.Name)}, m.CurrentTable(stmt), opts}
+
+		createIndexSQL := "CREATE "
+		if idx.Class != "" {
+			createIndexSQL += idx.Class + " "
+		}
+		if options.nullFiltered {
+			createIndexSQL += "NULL_FILTERED "
+		}
+		createIndexSQL += "INDEX ? ON ??"
+		if len(options.storing) > 0 {
+			createIndexSQL += " STORING ?"
+			columns := make([]interface{}, len(options.storing))
+			for i, column := range options.storing {
+				columns[i] = clause.Column{Name: column}
+			}
+			values = append(values, columns)
+		}
+		if idx.Option != "" {
+			createIndexSQL += " " + idx.Option
+		}
+		return m.DB.Exec(createIndexSQL, values...).Error
+	})
+}
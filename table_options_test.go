@@ -0,0 +1,345 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type auditEvent struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement:false"`
+	Kind      string `gorm:"index:idx_audit_events_kind" spannerGorm:"index_null_filtered;storing:payload,created_at"`
+	Payload   string
+	CreatedAt time.Time `spannerGorm:"row_deletion_policy:OLDER_THAN(created_at, INTERVAL 30 DAY)"`
+}
+
+type invalidRowDeletionPolicy struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time `spannerGorm:"row_deletion_policy:NEWER_THAN(created_at, INTERVAL 30 DAY)"`
+}
+
+func TestMigrateTableOptions(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 0)
+
+	if err := db.Migrator().AutoMigrate(&auditEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE TABLE `audit_events` (`id` INT64,`kind` STRING(MAX),`payload` STRING(MAX),`created_at` TIMESTAMP) " +
+			"PRIMARY KEY (`id`), ROW DELETION POLICY (OLDER_THAN(created_at, INTERVAL 30 DAY))",
+		"CREATE NULL_FILTERED INDEX `idx_audit_events_kind` ON `audit_events`(`kind`) STORING (`payload`,`created_at`)",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigrateRowDeletionPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name   string
+		policy [][]string
+		want   []string
+	}{
+		{
+			name:   "missing",
+			policy: [][]string{{""}},
+			want:   []string{"ALTER TABLE `audit_events` ADD ROW DELETION POLICY (OLDER_THAN(created_at, INTERVAL 30 DAY))"},
+		},
+		{
+			name:   "different",
+			policy: [][]string{{"OLDER_THAN(created_at, INTERVAL 7 DAY)"}},
+			want:   []string{"ALTER TABLE `audit_events` REPLACE ROW DELETION POLICY (OLDER_THAN(created_at, INTERVAL 30 DAY))"},
+		},
+		{
+			name:   "equivalent",
+			policy: [][]string{{"OLDER_THAN(`created_at`, INTERVAL 30 DAY)"}},
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, server, teardown := setupTestGormConnection(t)
+			defer teardown()
+			anyProto, err := anypb.New(&emptypb.Empty{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+				Name:   "test-operation",
+				Done:   true,
+				Result: &longrunningpb.Operation_Response{Response: anyProto},
+			}})
+			_ = putStringRowsResult(server, "SELECT ROW_DELETION_POLICY_EXPRESSION FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2",
+				[]string{"ROW_DELETION_POLICY_EXPRESSION"}, test.policy)
+
+			m := db.Migrator().(spannerMigrator)
+			defer m.Close()
+			if err := m.migrateRowDeletionPolicy(&auditEvent{}); err != nil {
+				t.Fatal(err)
+			}
+			var statements []string
+			for _, request := range server.TestDatabaseAdmin.Reqs() {
+				statements = append(statements, request.(*databasepb.UpdateDatabaseDdlRequest).GetStatements()...)
+			}
+			if g, w := statements, test.want; !reflect.DeepEqual(g, w) {
+				t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+			}
+		})
+	}
+}
+
+func TestMigrateIndexOptions(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name    string
+		indexes [][]string
+		want    []string
+	}{
+		{
+			name:    "not null filtered",
+			indexes: [][]string{{"idx_audit_events_kind", "false", "created_at"}, {"idx_audit_events_kind", "false", "payload"}},
+			want: []string{
+				"DROP INDEX `idx_audit_events_kind`",
+				"CREATE NULL_FILTERED INDEX `idx_audit_events_kind` ON `audit_events`(`kind`) STORING (`payload`,`created_at`)",
+			},
+		},
+		{
+			name:    "different storing columns",
+			indexes: [][]string{{"idx_audit_events_kind", "true", "id_old"}, {"idx_audit_events_kind", "true", "payload"}},
+			want: []string{
+				"ALTER INDEX `idx_audit_events_kind` ADD STORED COLUMN `created_at`",
+				"ALTER INDEX `idx_audit_events_kind` DROP STORED COLUMN `id_old`",
+			},
+		},
+		{
+			name:    "equal",
+			indexes: [][]string{{"idx_audit_events_kind", "true", "created_at"}, {"idx_audit_events_kind", "true", "payload"}},
+		},
+		{
+			name: "missing",
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db, server, teardown := setupTestGormConnection(t)
+			defer teardown()
+			anyProto, err := anypb.New(&emptypb.Empty{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.TestDatabaseAdmin.SetResps([]proto.Message{
+				&longrunningpb.Operation{
+					Name:   "test-operation-1",
+					Done:   true,
+					Result: &longrunningpb.Operation_Response{Response: anyProto},
+				},
+				&longrunningpb.Operation{
+					Name:   "test-operation-2",
+					Done:   true,
+					Result: &longrunningpb.Operation_Response{Response: anyProto},
+				},
+			})
+			_ = putStringRowsResult(server, `SELECT I.INDEX_NAME, I.IS_NULL_FILTERED, IC.COLUMN_NAME
+			FROM INFORMATION_SCHEMA.INDEXES I
+			LEFT JOIN INFORMATION_SCHEMA.INDEX_COLUMNS IC
+				ON IC.TABLE_CATALOG = I.TABLE_CATALOG
+				AND IC.TABLE_SCHEMA = I.TABLE_SCHEMA
+				AND IC.TABLE_NAME = I.TABLE_NAME
+				AND IC.INDEX_NAME = I.INDEX_NAME
+				AND IC.ORDINAL_POSITION IS NULL
+			WHERE I.TABLE_SCHEMA = @p1 AND I.TABLE_NAME = @p2 AND I.INDEX_TYPE = 'INDEX'
+			ORDER BY I.INDEX_NAME, IC.COLUMN_NAME`, []string{"INDEX_NAME", "IS_NULL_FILTERED", "COLUMN_NAME"}, test.indexes)
+
+			m := db.Migrator().(spannerMigrator)
+			defer m.Close()
+			if err := m.migrateIndexOptions(&auditEvent{}); err != nil {
+				t.Fatal(err)
+			}
+			var statements []string
+			for _, request := range server.TestDatabaseAdmin.Reqs() {
+				statements = append(statements, request.(*databasepb.UpdateDatabaseDdlRequest).GetStatements()...)
+			}
+			if g, w := statements, test.want; !reflect.DeepEqual(g, w) {
+				t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+			}
+		})
+	}
+}
+
+func TestMigrateInvalidRowDeletionPolicy(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	err := db.Migrator().AutoMigrate(&invalidRowDeletionPolicy{})
+	var modelErr *ModelError
+	if !errors.As(err, &modelErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, modelErr)
+	}
+	if g, w := err.Error(), `invalidRowDeletionPolicy.CreatedAt: row deletion policy "NEWER_THAN(created_at, INTERVAL 30 DAY)" is not supported`; !strings.Contains(g, w) {
+		t.Fatalf("error message mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+type softDeletedEvent struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	Kind      string
+	DeletedAt gorm.DeletedAt `spannerGorm:"ttl_after_delete:30d"`
+}
+
+func TestMigrateTTLAfterDelete(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	hasTableSql := "SELECT count(*) FROM information_schema.tables WHERE table_schema = @p1 AND table_name = @p2 AND table_type = @p3"
+	_ = putCountStatementResult(server, hasTableSql, 0)
+
+	if err := db.Migrator().AutoMigrate(&softDeletedEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE TABLE `soft_deleted_events` (`id` INT64,`kind` STRING(MAX),`deleted_at` TIMESTAMP) " +
+			"PRIMARY KEY (`id`), ROW DELETION POLICY (OLDER_THAN(deleted_at, INTERVAL 30 DAY))",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestTTLAfterDeletePolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name    string
+		model   interface{}
+		want    string
+		wantErr string
+	}{
+		{"days", &struct {
+			ID        int64
+			DeletedAt gorm.DeletedAt `spannerGorm:"ttl_after_delete:7 DAYS"`
+		}{}, "OLDER_THAN(deleted_at, INTERVAL 7 DAY)", ""},
+		{"number", &struct {
+			ID        int64
+			DeletedAt gorm.DeletedAt `spannerGorm:"ttl_after_delete:90"`
+		}{}, "OLDER_THAN(deleted_at, INTERVAL 90 DAY)", ""},
+		{"hours", &struct {
+			ID        int64
+			DeletedAt gorm.DeletedAt `spannerGorm:"ttl_after_delete:24h"`
+		}{}, "", `ttl_after_delete "24h" is not supported`},
+		{"not deleted at", &struct {
+			ID        int64
+			CreatedAt time.Time `spannerGorm:"ttl_after_delete:30d"`
+		}{}, "", "ttl_after_delete can only be used on a gorm.DeletedAt field"},
+		{"two policies", &struct {
+			ID        int64
+			CreatedAt time.Time      `spannerGorm:"row_deletion_policy:OLDER_THAN(created_at, INTERVAL 30 DAY)"`
+			DeletedAt gorm.DeletedAt `spannerGorm:"ttl_after_delete:30d"`
+		}{}, "", "more than one row_deletion_policy or ttl_after_delete setting"},
+	} {
+		s, err := schema.Parse(test.model, &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		policy, err := rowDeletionPolicyOf(s)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error mismatch\n Got: %v\nWant: %v", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if g, w := policy, test.want; g != w {
+			t.Errorf("%s: policy mismatch\n Got: %v\nWant: %v", test.name, g, w)
+		}
+	}
+}
+
+func TestSpannerGormSettings(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		tag  string
+		want map[string]string
+	}{
+		{`spannerGorm:"interleave_in:albums,on_delete:cascade"`, map[string]string{"INTERLEAVE_IN": "albums", "ON_DELETE": "cascade"}},
+		{`spannerGorm:"index_null_filtered;storing:col_a,col_b"`, map[string]string{"INDEX_NULL_FILTERED": "INDEX_NULL_FILTERED", "STORING": "col_a,col_b"}},
+		{`spannerGorm:"row_deletion_policy:OLDER_THAN(created_at, INTERVAL 30 DAY)"`, map[string]string{"ROW_DELETION_POLICY": "OLDER_THAN(created_at, INTERVAL 30 DAY)"}},
+	} {
+		settings, ok := spannerGormSettings(&schema.Field{Tag: reflect.StructTag(test.tag)})
+		if !ok {
+			t.Fatalf("%s: tag not found", test.tag)
+		}
+		if g, w := settings, test.want; !reflect.DeepEqual(g, w) {
+			t.Errorf("%s: settings mismatch\n Got: %v\nWant: %v", test.tag, g, w)
+		}
+	}
+}
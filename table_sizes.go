@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import "time"
+
+// TableSize is the size of a table or an index in the database, as reported
+// by the table sizes statistics of Spanner.
+type TableSize struct {
+	// Table is the name of the table, or the name of the table of the index.
+	Table string
+	// Index is the name of the index, or empty for the size of a table.
+	Index string
+	// UsedBytes is the total size of the table or index in bytes.
+	UsedBytes float64
+	// UsedSSDBytes is the size of the data on SSD storage in bytes.
+	UsedSSDBytes float64
+	// UsedHDDBytes is the size of the data on HDD storage in bytes.
+	UsedHDDBytes float64
+	// IntervalEnd is the end of the hourly interval in which the size was
+	// measured.
+	IntervalEnd time.Time
+}
+
+// GetTableSizes returns the sizes of all tables and indexes in the database
+// from the most recent interval of SPANNER_SYS.TABLE_SIZES_STATS_1HOUR,
+// ordered by the name of the table or index. The sizes of tables are returned
+// with an empty Index. Spanner computes the sizes once per hour, so the sizes
+// of new tables and indexes are not returned until the next interval has
+// ended. No sizes are returned by the emulator.
+//
+// Spanner does not keep statistics of the number of rows in a table. Use a
+// COUNT(*) query to count the rows of a table.
+//
+// Example:
+//
+//	sizes, err := db.Migrator().(spannergorm.StatisticsMigrator).GetTableSizes()
+//	if err != nil {
+//	  return err
+//	}
+//	for _, size := range sizes {
+//	  fmt.Printf("%s %s: %.0f bytes\n", size.Table, size.Index, size.UsedBytes)
+//	}
+func (m spannerMigrator) GetTableSizes() ([]TableSize, error) {
+	indexes, err := m.secondaryIndexes()
+	if err != nil {
+		return nil, err
+	}
+	indexTables := make(map[string]string, len(indexes))
+	for _, index := range indexes {
+		indexTables[index.Index] = index.Table
+	}
+
+	rows, err := m.DB.Raw(
+		`SELECT TABLE_NAME, USED_BYTES, USED_SSD_BYTES, USED_HDD_BYTES, INTERVAL_END
+		FROM SPANNER_SYS.TABLE_SIZES_STATS_1HOUR
+		WHERE INTERVAL_END = (SELECT MAX(INTERVAL_END) FROM SPANNER_SYS.TABLE_SIZES_STATS_1HOUR)
+		ORDER BY TABLE_NAME`,
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sizes := make([]TableSize, 0)
+	for rows.Next() {
+		var size TableSize
+		var name string
+		if err := rows.Scan(&name, &size.UsedBytes, &size.UsedSSDBytes, &size.UsedHDDBytes, &size.IntervalEnd); err != nil {
+			return nil, err
+		}
+		if table, ok := indexTables[name]; ok {
+			size.Table, size.Index = table, name
+		} else {
+			size.Table = name
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, rows.Err()
+}
+
+// secondaryIndex is an index in the database that is not a primary key.
+type secondaryIndex struct {
+	Table string
+	Index string
+}
+
+// secondaryIndexes returns the indexes in the database that are not primary
+// keys, ordered by table and index name.
+func (m spannerMigrator) secondaryIndexes() ([]secondaryIndex, error) {
+	rows, err := m.DB.Raw(
+		"SELECT TABLE_NAME, INDEX_NAME FROM INFORMATION_SCHEMA.INDEXES WHERE TABLE_SCHEMA = ? AND INDEX_TYPE = 'INDEX' ORDER BY TABLE_NAME, INDEX_NAME",
+		m.CurrentDatabase(),
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var indexes []secondaryIndex
+	for rows.Next() {
+		var index secondaryIndex
+		if err := rows.Scan(&index.Table, &index.Index); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, rows.Err()
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const secondaryIndexesSql = "SELECT TABLE_NAME, INDEX_NAME FROM INFORMATION_SCHEMA.INDEXES WHERE TABLE_SCHEMA = @p1 AND INDEX_TYPE = 'INDEX' ORDER BY TABLE_NAME, INDEX_NAME"
+
+func TestGetTableSizes(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	_ = putStringRowsResult(server,
+		secondaryIndexesSql, []string{"TABLE_NAME", "INDEX_NAME"}, [][]string{{"singers", "idx_singers_name"}})
+	float := &spannerpb.Type{Code: spannerpb.TypeCode_FLOAT64}
+	_ = server.TestSpanner.PutStatementResult(`SELECT TABLE_NAME, USED_BYTES, USED_SSD_BYTES, USED_HDD_BYTES, INTERVAL_END
+		FROM SPANNER_SYS.TABLE_SIZES_STATS_1HOUR
+		WHERE INTERVAL_END = (SELECT MAX(INTERVAL_END) FROM SPANNER_SYS.TABLE_SIZES_STATS_1HOUR)
+		ORDER BY TABLE_NAME`, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+				{Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, Name: "TABLE_NAME"},
+				{Type: float, Name: "USED_BYTES"},
+				{Type: float, Name: "USED_SSD_BYTES"},
+				{Type: float, Name: "USED_HDD_BYTES"},
+				{Type: &spannerpb.Type{Code: spannerpb.TypeCode_TIMESTAMP}, Name: "INTERVAL_END"},
+			}}},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{structpb.NewStringValue("idx_singers_name"), structpb.NewNumberValue(512), structpb.NewNumberValue(512), structpb.NewNumberValue(0), structpb.NewStringValue("2024-06-01T10:00:00Z")}},
+				{Values: []*structpb.Value{structpb.NewStringValue("singers"), structpb.NewNumberValue(4096), structpb.NewNumberValue(1024), structpb.NewNumberValue(3072), structpb.NewStringValue("2024-06-01T10:00:00Z")}},
+			},
+		},
+	})
+
+	sizes, err := db.Migrator().(StatisticsMigrator).GetTableSizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	intervalEnd := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	if g, w := sizes, []TableSize{
+		{Table: "singers", Index: "idx_singers_name", UsedBytes: 512, UsedSSDBytes: 512, IntervalEnd: intervalEnd},
+		{Table: "singers", UsedBytes: 4096, UsedSSDBytes: 1024, UsedHDDBytes: 3072, IntervalEnd: intervalEnd},
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("sizes mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const emulatorDownloadURL = "https://storage.googleapis.com/cloud-spanner-emulator/releases/%s/cloud-spanner-emulator_linux_amd64-%s.tar.gz"
+
+// StartEmulatorBinary starts the standalone Spanner emulator binary at the
+// given path (emulator_main from an emulator release) as a child process on a
+// free local port, and sets SPANNER_EMULATOR_HOST to the address of the
+// emulator. This makes it possible to run the integration tests on the
+// emulator in environments that do not have Docker. The returned function
+// stops the emulator.
+func StartEmulatorBinary(path string) (stop func(), err error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	host := listener.Addr().String()
+	_ = listener.Close()
+
+	cmd := exec.Command(path, "--host_port", host)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start emulator %s: %v", path, err)
+	}
+	stop = func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	// Wait max 10 seconds until the emulator accepts connections.
+	for c := 0; ; c++ {
+		conn, err := net.DialTimeout("tcp", host, 500*time.Millisecond)
+		if err == nil {
+			_ = conn.Close()
+			break
+		}
+		if c == 20 {
+			stop()
+			return nil, fmt.Errorf("emulator did not start listening on %s: %v", host, err)
+		}
+		<-time.After(500 * time.Millisecond)
+	}
+	if err := os.Setenv("SPANNER_EMULATOR_HOST", host); err != nil {
+		stop()
+		return nil, err
+	}
+	return stop, nil
+}
+
+// DownloadEmulatorBinary downloads the given version of the standalone Spanner
+// emulator to dir, and returns the path of the emulator binary. The download
+// is skipped if the binary already exists in dir. The standalone emulator is
+// only available for Linux on amd64.
+func DownloadEmulatorBinary(version, dir string) (path string, err error) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		return "", fmt.Errorf("the standalone emulator is not available for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	path = filepath.Join(dir, "emulator_main")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	resp, err := http.Get(fmt.Sprintf(emulatorDownloadURL, version, version))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download emulator version %s: %s", version, resp.Status)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("emulator archive for version %s does not contain emulator_main", version)
+		}
+		if err != nil {
+			return "", err
+		}
+		if filepath.Base(header.Name) != "emulator_main" {
+			continue
+		}
+		file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(file, archive); err != nil {
+			_ = file.Close()
+			return "", err
+		}
+		if err := file.Close(); err != nil {
+			return "", err
+		}
+		return path, os.Rename(path+".tmp", path)
+	}
+}
+
+// startEmulatorFromEnv starts the standalone emulator if SPANNER_EMULATOR_HOST
+// has not been set, and either SPANNER_EMULATOR_BINARY contains the path of
+// the emulator binary, or SPANNER_EMULATOR_VERSION contains the version of
+// the emulator that should be downloaded.
+func startEmulatorFromEnv() (stop func(), err error) {
+	noop := func() {}
+	if _, ok := os.LookupEnv("SPANNER_EMULATOR_HOST"); ok {
+		return noop, nil
+	}
+	path, ok := os.LookupEnv("SPANNER_EMULATOR_BINARY")
+	if !ok {
+		version, ok := os.LookupEnv("SPANNER_EMULATOR_VERSION")
+		if !ok {
+			return noop, nil
+		}
+		if path, err = DownloadEmulatorBinary(version, filepath.Join(os.TempDir(), "cloud-spanner-emulator", version)); err != nil {
+			return nil, err
+		}
+	}
+	return StartEmulatorBinary(path)
+}
@@ -189,6 +189,12 @@ func InitIntegrationTests() (cleanup func(), err error) {
 		log.Println("Integration tests skipped in -short mode.")
 		return noop, nil
 	}
+	// Start the standalone emulator if SPANNER_EMULATOR_BINARY or
+	// SPANNER_EMULATOR_VERSION has been set.
+	stopEmulator, err := startEmulatorFromEnv()
+	if err != nil {
+		return nil, err
+	}
 	_, hasCredentials := os.LookupEnv("GOOGLE_APPLICATION_CREDENTIALS")
 	_, hasEmulator := os.LookupEnv("SPANNER_EMULATOR_HOST")
 	if !(hasCredentials || hasEmulator) {
@@ -204,8 +210,12 @@ func InitIntegrationTests() (cleanup func(), err error) {
 	}
 	cleanup, err = initTestInstance(config)
 	if err != nil {
+		stopEmulator()
 		return nil, err
 	}
 
-	return cleanup, nil
+	return func() {
+		cleanup()
+		stopEmulator()
+	}, nil
 }
@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// AfterCommitHook can be implemented by models that must be notified once
+// after a transaction that created, updated or deleted the model has been
+// committed successfully. The hook is called with the context of the
+// statement that changed the model. Statements that are executed outside of a
+// transaction call the hook directly after the statement succeeded.
+type AfterCommitHook interface {
+	AfterCommit(ctx context.Context)
+}
+
+// AfterRollbackHook can be implemented by models that must be notified once
+// after a transaction that created, updated or deleted the model has been
+// rolled back. See AfterRollback for the cases in which a transaction is
+// considered to have been rolled back.
+type AfterRollbackHook interface {
+	AfterRollback(ctx context.Context)
+}
+
+// AfterCommit registers a function that is called once after the transaction
+// of tx has been committed successfully. The function is not called if the
+// transaction is rolled back or if the commit fails. The functions of a
+// transaction are called in the order in which they were registered.
+//
+// The Spanner database/sql driver retries transactions that are aborted by
+// Spanner internally by replaying the statements of the transaction. gorm
+// hooks such as BeforeCreate and AfterCreate are therefore executed once for
+// each statement, regardless of the number of internal retries. AfterCommit
+// functions are also only called once, after the commit of the last attempt
+// succeeded. If the application retries a transaction by calling
+// db.Transaction again, then the functions that were registered by a failed
+// attempt are discarded.
+//
+// AfterCommit returns an error if tx is not a transaction that was started by
+// gorm with db.Transaction or db.Begin. This includes the transaction that
+// gorm uses for Create, Update and Delete, unless SkipDefaultTransaction is
+// enabled, which means that AfterCommit can be called from gorm hooks.
+//
+// Example:
+//
+//	func (s *Singer) AfterCreate(tx *gorm.DB) error {
+//	  return spannergorm.AfterCommit(tx, func() {
+//	    publishSingerCreated(s.ID)
+//	  })
+//	}
+func AfterCommit(tx *gorm.DB, f func()) error {
+	t, err := currentTransaction(tx)
+	if err != nil {
+		return err
+	}
+	t.afterCommit = append(t.afterCommit, f)
+	return nil
+}
+
+// AfterRollback registers a function that is called once after the
+// transaction of tx has been rolled back. This includes transactions where
+// the commit failed with an error that guarantees that the transaction was not
+// committed, as reported by ClassifyCommitError. Neither the AfterCommit nor
+// the AfterRollback functions are called if the outcome of the commit is
+// unknown. Use ResolveCommitOutcome to determine the outcome in that case.
+//
+// AfterRollback returns an error if tx is not a transaction that was started
+// by gorm. See AfterCommit for more information.
+func AfterRollback(tx *gorm.DB, f func()) error {
+	t, err := currentTransaction(tx)
+	if err != nil {
+		return err
+	}
+	t.afterRollback = append(t.afterRollback, f)
+	return nil
+}
+
+// registerTransactionHookCallbacks registers the callbacks that register the
+// AfterCommitHook and AfterRollbackHook of the models that are created,
+// updated or deleted.
+func registerTransactionHookCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:after_create").Before("gorm:commit_or_rollback_transaction").Register("gorm:spanner:transaction_hooks", registerModelHooks); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:after_update").Before("gorm:commit_or_rollback_transaction").Register("gorm:spanner:transaction_hooks", registerModelHooks); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:after_delete").Before("gorm:commit_or_rollback_transaction").Register("gorm:spanner:transaction_hooks", registerModelHooks)
+}
+
+func registerModelHooks(db *gorm.DB) {
+	if db.Error != nil || db.Statement.SkipHooks || db.Statement.Schema == nil {
+		return
+	}
+	ctx := db.Statement.Context
+	var afterCommit, afterRollback []func()
+	addHooks := func(value reflect.Value) {
+		if value.Kind() != reflect.Ptr && value.CanAddr() {
+			value = value.Addr()
+		}
+		if !value.CanInterface() {
+			return
+		}
+		model := value.Interface()
+		if hook, ok := model.(AfterCommitHook); ok {
+			afterCommit = append(afterCommit, func() { hook.AfterCommit(ctx) })
+		}
+		if hook, ok := model.(AfterRollbackHook); ok {
+			afterRollback = append(afterRollback, func() { hook.AfterRollback(ctx) })
+		}
+	}
+	switch value := db.Statement.ReflectValue; value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			addHooks(value.Index(i))
+		}
+	case reflect.Struct:
+		addHooks(value)
+	}
+	t, err := currentTransaction(db)
+	if err != nil {
+		// The statement was executed outside of a transaction, and has
+		// therefore already been committed.
+		for _, f := range afterCommit {
+			f()
+		}
+		return
+	}
+	t.afterCommit = append(t.afterCommit, afterCommit...)
+	t.afterRollback = append(t.afterRollback, afterRollback...)
+}
+
+// currentTransaction returns the hooks of the transaction that is used by the
+// given gorm database. This is either a transaction that was started by gorm,
+// or a hybrid transaction.
+func currentTransaction(db *gorm.DB) (*transactionHooks, error) {
+	pool := db.Statement.ConnPool
+	if pool == nil {
+		pool = db.ConnPool
+	}
+	switch t := unwrapConnPool(pool).(type) {
+	case *connTx:
+		return &t.transactionHooks, nil
+	case *hybridConnPool:
+		return &t.transactionHooks, nil
+	}
+	return nil, fmt.Errorf("db does not have an active transaction that was started by gorm")
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func TestAfterCommit(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	updateSql := "UPDATE `singers` SET `active`=@p1,`updated_at`=@p2 WHERE last_name = @p3 AND `singers`.`deleted_at` IS NULL"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	// The first commit is aborted, which makes the driver retry the
+	// transaction internally.
+	server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+		Errors: []error{status.Error(codes.Aborted, "aborted")},
+	})
+	var calls []string
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := AfterCommit(tx, func() { calls = append(calls, "first") }); err != nil {
+			return err
+		}
+		if err := tx.Model(&singer{}).Where("last_name = ?", "Doe").Update("active", false).Error; err != nil {
+			return err
+		}
+		if len(calls) > 0 {
+			t.Fatal("after commit function was called before the commit")
+		}
+		return AfterCommit(tx, func() { calls = append(calls, "second") })
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.CommitRequest{}))), 2; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := calls, []string{"first", "second"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("calls mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// AfterCommit can only be called in a transaction.
+	if err := AfterCommit(db, func() {}); err == nil {
+		t.Fatal("missing expected error for AfterCommit outside of a transaction")
+	}
+}
+
+func TestAfterRollback(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	var calls []string
+	register := func(tx *gorm.DB) error {
+		if err := AfterCommit(tx, func() { calls = append(calls, "commit") }); err != nil {
+			return err
+		}
+		return AfterRollback(tx, func() { calls = append(calls, "rollback") })
+	}
+	rollbackErr := errors.New("rollback")
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := register(tx); err != nil {
+			return err
+		}
+		return rollbackErr
+	}); !errors.Is(err, rollbackErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, rollbackErr)
+	}
+	if g, w := calls, []string{"rollback"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("calls mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// A commit that fails with an error that guarantees that the transaction
+	// was not committed also calls the AfterRollback functions once, although
+	// gorm also rolls back the transaction.
+	calls = nil
+	server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+		Errors: []error{status.Error(codes.FailedPrecondition, "failed")},
+	})
+	if err := db.Transaction(register); spanner.ErrCode(err) != codes.FailedPrecondition {
+		t.Fatalf("error code mismatch\n Got: %v\nWant: %v", spanner.ErrCode(err), codes.FailedPrecondition)
+	}
+	if g, w := calls, []string{"rollback"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("calls mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Neither function is called if the outcome of the commit is unknown.
+	calls = nil
+	server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+		Errors: []error{status.Error(codes.Internal, "internal")},
+	})
+	if err := db.Transaction(register); err == nil {
+		t.Fatal("missing expected commit error")
+	}
+	if len(calls) > 0 {
+		t.Fatalf("functions were called for unknown commit outcome: %v", calls)
+	}
+}
+
+type hookedSinger struct {
+	ID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name  string
+	calls *[]string
+}
+
+func (s *hookedSinger) AfterCommit(ctx context.Context) {
+	*s.calls = append(*s.calls, "commit")
+}
+
+func (s *hookedSinger) AfterRollback(ctx context.Context) {
+	*s.calls = append(*s.calls, "rollback")
+}
+
+func TestTransactionHookModels(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT INTO `hooked_singers` (`id`,`name`) VALUES (@p1,@p2)"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	var calls []string
+	// Create uses a transaction by default.
+	if err := db.Create(&hookedSinger{ID: 1, Name: "Alice", calls: &calls}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := calls, []string{"commit"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("calls mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Statements outside of a transaction call the commit hook directly.
+	calls = nil
+	if err := db.Session(&gorm.Session{SkipDefaultTransaction: true}).Create(&hookedSinger{ID: 1, Name: "Alice", calls: &calls}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := calls, []string{"commit"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("calls mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The hooks of all models in a transaction are called when the
+	// transaction ends.
+	calls = nil
+	rollbackErr := errors.New("rollback")
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&hookedSinger{ID: 1, Name: "Alice", calls: &calls}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&hookedSinger{ID: 1, Name: "Alice", calls: &calls}).Error; err != nil {
+			return err
+		}
+		if len(calls) > 0 {
+			t.Fatalf("hooks were called before the transaction ended: %v", calls)
+		}
+		return rollbackErr
+	}); !errors.Is(err, rollbackErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %v", err, rollbackErr)
+	}
+	if g, w := calls, []string{"rollback", "rollback"}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("calls mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql"
+	"time"
+)
+
+// TransactionStats are the statistics of the transactions with the same tag
+// and the same reads and writes in an interval, as reported by the
+// transaction statistics of Spanner.
+type TransactionStats struct {
+	// Tag is the transaction tag of the transactions. It is empty for
+	// transactions without a tag.
+	Tag string
+	// Fingerprint is the hash of the tag and the columns that are read and
+	// written by the transactions.
+	Fingerprint int64
+	// AttemptCount is the number of attempts of the transactions, including
+	// attempts that were aborted before they were committed.
+	AttemptCount int64
+	// CommitAttemptCount is the number of commits of the transactions.
+	CommitAttemptCount int64
+	// CommitAbortCount is the number of commits that were aborted, mostly
+	// because of lock contention.
+	CommitAbortCount int64
+	// CommitRetryCount is the number of commits that were retries of aborted
+	// transactions.
+	CommitRetryCount int64
+	// CommitFailedPreconditionCount is the number of commits that failed with
+	// a precondition error, such as a unique key violation.
+	CommitFailedPreconditionCount int64
+	AvgParticipants               float64
+	AvgTotalLatencySeconds        float64
+	AvgCommitLatencySeconds       float64
+	AvgBytes                      float64
+	// IntervalEnd is the end of the interval of the statistics.
+	IntervalEnd time.Time
+}
+
+// LockStats are the lock wait times of a row range in an interval, as reported
+// by the lock statistics of Spanner.
+type LockStats struct {
+	// RowRangeStartKey is the start of the row range with the lock conflicts,
+	// e.g. singers(1). The range can span multiple rows.
+	RowRangeStartKey string
+	// LockWaitSeconds is the total time that transactions have waited for
+	// locks on the row range.
+	LockWaitSeconds float64
+	// SampleLockRequests are samples of the lock requests on the row range.
+	SampleLockRequests []LockRequest
+	// IntervalEnd is the end of the interval of the statistics.
+	IntervalEnd time.Time
+}
+
+// LockRequest is a sample of a lock request in LockStats.
+type LockRequest struct {
+	// LockMode is the mode of the lock, e.g. ReaderShared or WriterShared.
+	LockMode string
+	// Column is the column that was locked, e.g. singers._exists for the
+	// existence of a row.
+	Column string
+	// TransactionTag is the tag of the transaction that requested the lock.
+	TransactionTag string
+}
+
+// GetTransactionStats returns the statistics of the transactions in the most
+// recent interval of SPANNER_SYS.TXN_STATS_TOP_HOUR with a tag that starts
+// with the given prefix, ordered by the number of aborted commits and the
+// total latency. All transactions are returned if tagPrefix is empty. At most
+// limit transactions are returned.
+//
+// Use AutomaticTagPrefix to get the statistics of the transactions that are
+// tagged by Config.AutoRequestTags, or the tags that are set with
+// WithTransactionTag. Tags are only set on transactions that are executed
+// with the Spanner client library, such as the transactions of mutations and
+// RunHybridTransaction.
+//
+// Example:
+//
+//	stats, err := db.Migrator().(spannergorm.StatisticsMigrator).GetTransactionStats(spannergorm.AutomaticTagPrefix, 10)
+func (m spannerMigrator) GetTransactionStats(tagPrefix string, limit int) ([]TransactionStats, error) {
+	rows, err := m.DB.Raw(
+		`SELECT TRANSACTION_TAG, FPRINT, ATTEMPT_COUNT, COMMIT_ATTEMPT_COUNT, COMMIT_ABORT_COUNT, COMMIT_RETRY_COUNT,
+			COMMIT_FAILED_PRECONDITION_COUNT, AVG_PARTICIPANTS, AVG_TOTAL_LATENCY_SECONDS, AVG_COMMIT_LATENCY_SECONDS,
+			AVG_BYTES, INTERVAL_END
+		FROM SPANNER_SYS.TXN_STATS_TOP_HOUR
+		WHERE INTERVAL_END = (SELECT MAX(INTERVAL_END) FROM SPANNER_SYS.TXN_STATS_TOP_HOUR)
+		AND STARTS_WITH(IFNULL(TRANSACTION_TAG, ''), ?)
+		ORDER BY COMMIT_ABORT_COUNT DESC, AVG_TOTAL_LATENCY_SECONDS * ATTEMPT_COUNT DESC
+		LIMIT ?`,
+		tagPrefix, limit,
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make([]TransactionStats, 0)
+	for rows.Next() {
+		var s TransactionStats
+		var tag sql.NullString
+		if err := rows.Scan(&tag, &s.Fingerprint, &s.AttemptCount, &s.CommitAttemptCount, &s.CommitAbortCount,
+			&s.CommitRetryCount, &s.CommitFailedPreconditionCount, &s.AvgParticipants, &s.AvgTotalLatencySeconds,
+			&s.AvgCommitLatencySeconds, &s.AvgBytes, &s.IntervalEnd); err != nil {
+			return nil, err
+		}
+		s.Tag = tag.String
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// GetLockStats returns the row ranges with the longest lock wait times in the
+// most recent interval of SPANNER_SYS.LOCK_STATS_TOP_HOUR, ordered by the lock
+// wait time. Only the row ranges with a sample lock request of a transaction
+// with a tag that starts with the given prefix are returned, and
+// SampleLockRequests only contains these requests. All row ranges are
+// returned if tagPrefix is empty. At most limit row ranges are returned.
+//
+// Example:
+//
+//	stats, err := db.Migrator().(spannergorm.StatisticsMigrator).GetLockStats(spannergorm.AutomaticTagPrefix, 10)
+//	if err != nil {
+//	  return err
+//	}
+//	for _, s := range stats {
+//	  log.Printf("%s: waited %.2fs for locks", s.RowRangeStartKey, s.LockWaitSeconds)
+//	}
+func (m spannerMigrator) GetLockStats(tagPrefix string, limit int) ([]LockStats, error) {
+	rows, err := m.DB.Raw(
+		`SELECT S.ROW_RANGE_START_KEY, S.LOCK_WAIT_SECONDS, R.LOCK_MODE, R.COLUMN, R.TRANSACTION_TAG, S.INTERVAL_END
+		FROM SPANNER_SYS.LOCK_STATS_TOP_HOUR S, UNNEST(S.SAMPLE_LOCK_REQUESTS) R
+		WHERE S.INTERVAL_END = (SELECT MAX(INTERVAL_END) FROM SPANNER_SYS.LOCK_STATS_TOP_HOUR)
+		AND STARTS_WITH(IFNULL(R.TRANSACTION_TAG, ''), ?)
+		ORDER BY S.LOCK_WAIT_SECONDS DESC, S.ROW_RANGE_START_KEY`,
+		tagPrefix,
+	).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make([]LockStats, 0)
+	for rows.Next() {
+		var (
+			key               []byte
+			waitSeconds       float64
+			mode, column, tag sql.NullString
+			intervalEnd       time.Time
+		)
+		if err := rows.Scan(&key, &waitSeconds, &mode, &column, &tag, &intervalEnd); err != nil {
+			return nil, err
+		}
+		// The query returns one row per sample lock request, and the rows of
+		// a row range are adjacent.
+		if len(stats) == 0 || stats[len(stats)-1].RowRangeStartKey != string(key) {
+			if len(stats) == limit {
+				break
+			}
+			stats = append(stats, LockStats{RowRangeStartKey: string(key), LockWaitSeconds: waitSeconds, IntervalEnd: intervalEnd})
+		}
+		s := &stats[len(stats)-1]
+		s.SampleLockRequests = append(s.SampleLockRequests, LockRequest{LockMode: mode.String, Column: column.String, TransactionTag: tag.String})
+	}
+	return stats, rows.Err()
+}
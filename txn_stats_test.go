@@ -0,0 +1,133 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestGetTransactionStats(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	sql := `SELECT TRANSACTION_TAG, FPRINT, ATTEMPT_COUNT, COMMIT_ATTEMPT_COUNT, COMMIT_ABORT_COUNT, COMMIT_RETRY_COUNT,
+			COMMIT_FAILED_PRECONDITION_COUNT, AVG_PARTICIPANTS, AVG_TOTAL_LATENCY_SECONDS, AVG_COMMIT_LATENCY_SECONDS,
+			AVG_BYTES, INTERVAL_END
+		FROM SPANNER_SYS.TXN_STATS_TOP_HOUR
+		WHERE INTERVAL_END = (SELECT MAX(INTERVAL_END) FROM SPANNER_SYS.TXN_STATS_TOP_HOUR)
+		AND STARTS_WITH(IFNULL(TRANSACTION_TAG, ''), @p1)
+		ORDER BY COMMIT_ABORT_COUNT DESC, AVG_TOTAL_LATENCY_SECONDS * ATTEMPT_COUNT DESC
+		LIMIT @p2`
+	_ = putTypedRowsResult(server, sql,
+		[]spannerpb.TypeCode{
+			spannerpb.TypeCode_STRING, spannerpb.TypeCode_INT64, spannerpb.TypeCode_INT64, spannerpb.TypeCode_INT64,
+			spannerpb.TypeCode_INT64, spannerpb.TypeCode_INT64, spannerpb.TypeCode_INT64, spannerpb.TypeCode_FLOAT64,
+			spannerpb.TypeCode_FLOAT64, spannerpb.TypeCode_FLOAT64, spannerpb.TypeCode_FLOAT64, spannerpb.TypeCode_TIMESTAMP,
+		},
+		[][]*structpb.Value{{
+			structpb.NewStringValue("gorm_update_singers"), structpb.NewStringValue("42"), structpb.NewStringValue("120"),
+			structpb.NewStringValue("110"), structpb.NewStringValue("10"), structpb.NewStringValue("9"), structpb.NewStringValue("1"),
+			structpb.NewNumberValue(2), structpb.NewNumberValue(0.2), structpb.NewNumberValue(0.05), structpb.NewNumberValue(512),
+			structpb.NewStringValue("2024-06-01T10:00:00Z"),
+		}},
+	)
+
+	stats, err := db.Migrator().(StatisticsMigrator).GetTransactionStats(AutomaticTagPrefix, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := stats, []TransactionStats{{
+		Tag:                           "gorm_update_singers",
+		Fingerprint:                   42,
+		AttemptCount:                  120,
+		CommitAttemptCount:            110,
+		CommitAbortCount:              10,
+		CommitRetryCount:              9,
+		CommitFailedPreconditionCount: 1,
+		AvgParticipants:               2,
+		AvgTotalLatencySeconds:        0.2,
+		AvgCommitLatencySeconds:       0.05,
+		AvgBytes:                      512,
+		IntervalEnd:                   time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+	}}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("stats mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+	req := lastExecuteSqlRequest(drainRequestsFromServer(server.TestSpanner), sql)
+	if req == nil {
+		t.Fatal("query not found")
+	}
+	if g, w := req.Params.Fields["p1"].GetStringValue(), AutomaticTagPrefix; g != w {
+		t.Fatalf("tag prefix mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestGetLockStats(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	key := func(s string) *structpb.Value {
+		return structpb.NewStringValue(base64.StdEncoding.EncodeToString([]byte(s)))
+	}
+	end := structpb.NewStringValue("2024-06-01T10:00:00Z")
+	_ = putTypedRowsResult(server, `SELECT S.ROW_RANGE_START_KEY, S.LOCK_WAIT_SECONDS, R.LOCK_MODE, R.COLUMN, R.TRANSACTION_TAG, S.INTERVAL_END
+		FROM SPANNER_SYS.LOCK_STATS_TOP_HOUR S, UNNEST(S.SAMPLE_LOCK_REQUESTS) R
+		WHERE S.INTERVAL_END = (SELECT MAX(INTERVAL_END) FROM SPANNER_SYS.LOCK_STATS_TOP_HOUR)
+		AND STARTS_WITH(IFNULL(R.TRANSACTION_TAG, ''), @p1)
+		ORDER BY S.LOCK_WAIT_SECONDS DESC, S.ROW_RANGE_START_KEY`,
+		[]spannerpb.TypeCode{
+			spannerpb.TypeCode_BYTES, spannerpb.TypeCode_FLOAT64, spannerpb.TypeCode_STRING,
+			spannerpb.TypeCode_STRING, spannerpb.TypeCode_STRING, spannerpb.TypeCode_TIMESTAMP,
+		},
+		[][]*structpb.Value{
+			{key("singers(1)"), structpb.NewNumberValue(3.5), structpb.NewStringValue("WriterShared"), structpb.NewStringValue("singers.rating"), structpb.NewStringValue("gorm_update_singers"), end},
+			{key("singers(1)"), structpb.NewNumberValue(3.5), structpb.NewStringValue("ReaderShared"), structpb.NewStringValue("singers.rating"), structpb.NewStringValue("gorm_query_singers"), end},
+			{key("albums(2)"), structpb.NewNumberValue(1), structpb.NewStringValue("Exclusive"), structpb.NewStringValue("albums._exists"), structpb.NewStringValue("gorm_insert_albums"), end},
+			{key("tracks(3)"), structpb.NewNumberValue(0.5), structpb.NewStringValue("Exclusive"), structpb.NewStringValue("tracks._exists"), structpb.NewStringValue("gorm_insert_tracks"), end},
+		},
+	)
+
+	stats, err := db.Migrator().(StatisticsMigrator).GetLockStats(AutomaticTagPrefix, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intervalEnd := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	if g, w := stats, []LockStats{
+		{
+			RowRangeStartKey: "singers(1)",
+			LockWaitSeconds:  3.5,
+			SampleLockRequests: []LockRequest{
+				{LockMode: "WriterShared", Column: "singers.rating", TransactionTag: "gorm_update_singers"},
+				{LockMode: "ReaderShared", Column: "singers.rating", TransactionTag: "gorm_query_singers"},
+			},
+			IntervalEnd: intervalEnd,
+		},
+		{
+			RowRangeStartKey:   "albums(2)",
+			LockWaitSeconds:    1,
+			SampleLockRequests: []LockRequest{{LockMode: "Exclusive", Column: "albums._exists", TransactionTag: "gorm_insert_albums"}},
+			IntervalEnd:        intervalEnd,
+		},
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("stats mismatch\n Got: %+v\nWant: %+v", g, w)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// UpdateMany updates the given columns of all rows in the given slice in one
+// read/write transaction. The UPDATE statements are sent to Spanner as one
+// batch of DML statements, which means that the rows are updated in a single
+// round trip instead of one round trip per row. All columns, except the primary
+// key columns, are updated if no columns are given.
+//
+// rows must be a slice, or a pointer to a slice or an array. An array that is
+// passed by value is not accepted, as its elements cannot be addressed.
+//
+// Example:
+//
+//	singers[0].Active = false
+//	singers[1].Active = true
+//	err := spannergorm.UpdateMany(ctx, db, singers, "active")
+func UpdateMany(ctx context.Context, db *gorm.DB, rows interface{}, columns ...string) error {
+	value := reflect.ValueOf(rows)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice && !(value.Kind() == reflect.Array && value.CanAddr()) {
+		return fmt.Errorf("rows must be a slice or a pointer to a slice or an array, got %T", rows)
+	}
+	if value.Len() == 0 {
+		return nil
+	}
+	if len(columns) == 0 {
+		columns = []string{"*"}
+	}
+	// The transaction batches the UPDATE statements automatically.
+	return db.WithContext(WithBatchDML(ctx)).Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < value.Len(); i++ {
+			row := value.Index(i)
+			if row.Kind() != reflect.Ptr {
+				row = row.Addr()
+			}
+			if err := tx.Model(row.Interface()).Select(columns).Updates(row.Interface()).Error; err != nil {
+				return err
+			}
+		}
+		// Send the batch before the transaction is committed, so an error
+		// that is returned by one of the statements is returned as-is.
+		if t, ok := unwrapConnPool(tx.Statement.ConnPool).(*connTx); ok {
+			return t.runBatch(tx.Statement.Context)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+)
+
+func TestUpdateMany(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	updateSql := "UPDATE `singers` SET `first_name`=@p1,`last_name`=@p2 WHERE `id` = @p3"
+	_ = server.TestSpanner.PutStatementResult(updateSql, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	singers := []singerWithCommitTimestamp{
+		{ID: 1, FirstName: "First1", LastName: "Last1"},
+		{ID: 2, FirstName: "First2", LastName: "Last2"},
+		{ID: 3, FirstName: "First3", LastName: "Last3"},
+	}
+	if err := UpdateMany(context.Background(), db, singers, "first_name", "last_name"); err != nil {
+		t.Fatalf("failed to update singers: %v", err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	batchReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteBatchDmlRequest{}))
+	if g, w := len(batchReqs), 1; g != w {
+		t.Fatalf("batch request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	batchReq := batchReqs[0].(*spannerpb.ExecuteBatchDmlRequest)
+	if g, w := len(batchReq.Statements), 3; g != w {
+		t.Fatalf("statement count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, stmt := range batchReq.Statements {
+		if g, w := stmt.Sql, updateSql; g != w {
+			t.Fatalf("%d: sql mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+		if g, w := stmt.Params.Fields["p3"].GetStringValue(), singers[i].ID; g != strconv.FormatInt(w, 10) {
+			t.Fatalf("%d: id mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 1; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestUpdateManyUnaddressableRows(t *testing.T) {
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	_ = server.TestSpanner.PutStatementResult("UPDATE `singers` SET `first_name`=@p1 WHERE `id` = @p2", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	singers := [2]singerWithCommitTimestamp{{ID: 1}, {ID: 2}}
+	if err := UpdateMany(context.Background(), db, singers, "first_name"); err == nil {
+		t.Fatal("missing error for array")
+	}
+	if err := UpdateMany(context.Background(), db, singers[0], "first_name"); err == nil {
+		t.Fatal("missing error for struct")
+	}
+	if err := UpdateMany(context.Background(), db, &singers, "first_name"); err != nil {
+		t.Fatalf("failed to update singers: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultUpsertBatchSize = 1000
+	// maxMutationsPerCommit is the maximum number of mutations in one commit
+	// that Spanner accepts.
+	maxMutationsPerCommit = 80000
+)
+
+// UpsertOptions are the options for UpsertAll.
+type UpsertOptions struct {
+	// BatchSize is the maximum number of rows that are written in one
+	// transaction. The default is 1000. The number of rows is reduced further
+	// if a batch would exceed the mutation limit of Spanner.
+	BatchSize int
+	// UseMutations writes the rows as InsertOrUpdate mutations instead of
+	// INSERT OR UPDATE statements. Mutations are more efficient, but gorm
+	// hooks are not invoked and database-generated values are not returned.
+	// See MutationsFromModel for how the columns of the mutations are chosen.
+	UseMutations bool
+	// ContinueOnError continues with the next batch if a batch fails. The
+	// default is to stop at the first batch that fails.
+	ContinueOnError bool
+}
+
+// UpsertBatchError is the error of one batch of UpsertAll.
+type UpsertBatchError struct {
+	// Start is the index of the first row of the batch.
+	Start int
+	// End is the index after the last row of the batch.
+	End int
+	// Err is the error of the batch.
+	Err error
+}
+
+func (e *UpsertBatchError) Error() string {
+	return fmt.Sprintf("rows %d to %d: %v", e.Start, e.End-1, e.Err)
+}
+
+func (e *UpsertBatchError) Unwrap() error {
+	return e.Err
+}
+
+// UpsertError is returned by UpsertAll if one or more batches failed. The
+// batches that are not included have been committed.
+type UpsertError struct {
+	// Batches are the batches that failed, in order.
+	Batches []*UpsertBatchError
+	// Rows is the total number of rows.
+	Rows int
+}
+
+func (e *UpsertError) Error() string {
+	messages := make([]string, len(e.Batches))
+	for i, batch := range e.Batches {
+		messages[i] = batch.Error()
+	}
+	return fmt.Sprintf("upsert of %d rows failed: %s", e.Rows, strings.Join(messages, "; "))
+}
+
+func (e *UpsertError) Unwrap() []error {
+	errs := make([]error, len(e.Batches))
+	for i, batch := range e.Batches {
+		errs[i] = batch
+	}
+	return errs
+}
+
+// UpsertAll inserts the given slice of rows, or updates the rows that already
+// exist, in batches. Each batch is written in its own transaction with an
+// INSERT OR UPDATE statement, or with InsertOrUpdate mutations if
+// UseMutations is set. The number of rows in a batch is limited by
+// UpsertOptions.BatchSize, and by an estimate of the number of mutations per
+// row, which is the number of columns plus the number of columns in the
+// indexes of the table. This keeps each transaction below the limit of 80,000
+// mutations per commit of Spanner.
+//
+// The batches that were committed before a batch failed are not rolled back.
+// An *UpsertError that contains the index range and the error of each batch
+// that failed is returned if one or more batches fail. UpsertAll stops at the
+// first batch that fails, unless ContinueOnError is set. UpsertAll cannot be
+// used in a transaction.
+//
+// Example:
+//
+//	err := spannergorm.UpsertAll(ctx, db, singers, spannergorm.UpsertOptions{UseMutations: true})
+//	var upsertErr *spannergorm.UpsertError
+//	if errors.As(err, &upsertErr) {
+//	  for _, batch := range upsertErr.Batches {
+//	    log.Printf("failed to write rows %d to %d: %v", batch.Start, batch.End-1, batch.Err)
+//	  }
+//	}
+func UpsertAll(ctx context.Context, db *gorm.DB, rows interface{}, opts ...UpsertOptions) error {
+	var options UpsertOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	value := reflect.ValueOf(rows)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return fmt.Errorf("rows must be a slice or an array, got %T", rows)
+	}
+	if value.Len() == 0 {
+		return nil
+	}
+	if value.Kind() == reflect.Array {
+		if !value.CanAddr() {
+			return fmt.Errorf("rows must be a slice or a pointer to an array, got %T", rows)
+		}
+		value = value.Slice(0, value.Len())
+	}
+	if _, ok := unwrapConnPool(db.Statement.ConnPool).(gorm.TxCommitter); ok {
+		return errors.New("UpsertAll cannot be used in a transaction")
+	}
+	db = db.WithContext(ctx)
+	batchSize, err := upsertBatchSize(db, rows, options.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	upsertErr := &UpsertError{Rows: value.Len()}
+	for start := 0; start < value.Len(); start += batchSize {
+		end := start + batchSize
+		if end > value.Len() {
+			end = value.Len()
+		}
+		// Pass a pointer to the batch, so values that are returned by the
+		// database are set in the rows of the original slice.
+		batch := reflect.New(value.Type())
+		batch.Elem().Set(value.Slice(start, end))
+		var err error
+		if options.UseMutations {
+			err = upsertWithMutations(db, batch.Interface())
+		} else {
+			err = db.Clauses(clause.OnConflict{UpdateAll: true}).Create(batch.Interface()).Error
+		}
+		if err != nil {
+			upsertErr.Batches = append(upsertErr.Batches, &UpsertBatchError{Start: start, End: end, Err: err})
+			if !options.ContinueOnError {
+				break
+			}
+		}
+	}
+	if len(upsertErr.Batches) > 0 {
+		return upsertErr
+	}
+	return nil
+}
+
+func upsertWithMutations(db *gorm.DB, rows interface{}) error {
+	mutations, err := MutationsFromModel(db, MutationInsertOrUpdate, rows)
+	if err != nil {
+		return err
+	}
+	return WithSpannerConn(db, func(conn spannerdriver.SpannerConn) error {
+		_, err := conn.Apply(db.Statement.Context, mutations)
+		return err
+	})
+}
+
+// upsertBatchSize returns the number of rows of the given model that can be
+// written in one transaction without exceeding the mutation limit, and at
+// most the given batch size.
+func upsertBatchSize(db *gorm.DB, rows interface{}, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultUpsertBatchSize
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(rows); err != nil {
+		return 0, err
+	}
+	mutationsPerRow := 0
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName != "" && field.Creatable && !isGeneratedField(field) {
+			mutationsPerRow++
+		}
+	}
+	for _, index := range stmt.Schema.ParseIndexes() {
+		mutationsPerRow += len(index.Fields)
+	}
+	if mutationsPerRow > 0 && maxMutationsPerCommit/mutationsPerRow < batchSize {
+		batchSize = maxMutationsPerCommit / mutationsPerRow
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return batchSize, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+)
+
+func TestUpsertAll(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	sqls := []string{
+		"INSERT OR UPDATE INTO `upsert_singers` (`id`,`name`) VALUES (@p1,@p2),(@p3,@p4)",
+		"INSERT OR UPDATE INTO `upsert_singers` (`id`,`name`) VALUES (@p1,@p2)",
+	}
+	for _, sql := range sqls {
+		_ = server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+			Type:        testutil.StatementResultUpdateCount,
+			UpdateCount: 1,
+		})
+	}
+	singers := []upsertSinger{{1, "One"}, {2, "Two"}, {3, "Three"}}
+	drainRequestsFromServer(server.TestSpanner)
+	if err := UpsertAll(context.Background(), db, singers, UpsertOptions{BatchSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	sqlReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))
+	if g, w := len(sqlReqs), len(sqls); g != w {
+		t.Fatalf("sql request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, req := range sqlReqs {
+		if g, w := req.(*spannerpb.ExecuteSqlRequest).Sql, sqls[i]; g != w {
+			t.Fatalf("%d: sql mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+	}
+	// Each batch is committed in its own transaction.
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))), 2; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestUpsertAllWithMutations(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	singers := []upsertSinger{{1, "One"}, {2, "Two"}, {3, "Three"}}
+	drainRequestsFromServer(server.TestSpanner)
+	if err := UpsertAll(context.Background(), db, &singers, UpsertOptions{BatchSize: 2, UseMutations: true}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(reqs, reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))), 0; g != w {
+		t.Fatalf("sql request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&spannerpb.CommitRequest{}))
+	if g, w := len(commitReqs), 2; g != w {
+		t.Fatalf("commit request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	for i, want := range []int{2, 1} {
+		mutations := commitReqs[i].(*spannerpb.CommitRequest).Mutations
+		if g, w := len(mutations), want; g != w {
+			t.Fatalf("%d: mutation count mismatch\n Got: %v\nWant: %v", i, g, w)
+		}
+		for _, mutation := range mutations {
+			if mutation.GetInsertOrUpdate() == nil {
+				t.Fatalf("%d: mutation type mismatch\n Got: %v\nWant: insert_or_update", i, mutation)
+			}
+		}
+	}
+}
+
+func TestUpsertAllContinueOnError(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	// Only the statement for a batch of two rows returns a result. The last
+	// batch, which contains one row, fails.
+	_ = server.TestSpanner.PutStatementResult("INSERT OR UPDATE INTO `upsert_singers` (`id`,`name`) VALUES (@p1,@p2),(@p3,@p4)", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 2,
+	})
+	singers := []upsertSinger{{1, "One"}, {2, "Two"}, {3, "Three"}, {4, "Four"}, {5, "Five"}}
+	for _, continueOnError := range []bool{false, true} {
+		err := UpsertAll(context.Background(), db, singers, UpsertOptions{BatchSize: 2, ContinueOnError: continueOnError})
+		var upsertErr *UpsertError
+		if !errors.As(err, &upsertErr) {
+			t.Fatalf("error mismatch\n Got: %v\nWant: *UpsertError", err)
+		}
+		if g, w := len(upsertErr.Batches), 1; g != w {
+			t.Fatalf("failed batch count mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		if g, w := [2]int{upsertErr.Batches[0].Start, upsertErr.Batches[0].End}, [2]int{4, 5}; g != w {
+			t.Fatalf("failed batch mismatch\n Got: %v\nWant: %v", g, w)
+		}
+		if g, w := upsertErr.Rows, len(singers); g != w {
+			t.Fatalf("row count mismatch\n Got: %v\nWant: %v", g, w)
+		}
+	}
+}
+
+func TestUpsertAllInTransaction(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	tx := db.Begin()
+	defer tx.Rollback()
+	if err := UpsertAll(context.Background(), tx, []upsertSinger{{1, "One"}}); err == nil {
+		t.Fatal("missing error for UpsertAll in a transaction")
+	}
+}
+
+func TestUpsertBatchSize(t *testing.T) {
+	t.Parallel()
+
+	db, _, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	for _, test := range []struct {
+		model     interface{}
+		batchSize int
+		want      int
+	}{
+		{&[]upsertSinger{}, 0, defaultUpsertBatchSize},
+		{&[]upsertSinger{}, 10, 10},
+		// Two columns per row.
+		{&[]upsertSinger{}, 100000, 40000},
+		// Five columns, an index with two columns and an index with one
+		// column per row.
+		{&[]diffSinger{}, 100000, maxMutationsPerCommit / 8},
+	} {
+		batchSize, err := upsertBatchSize(db, test.model, test.batchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, w := batchSize, test.want; g != w {
+			t.Errorf("%T %d: batch size mismatch\n Got: %v\nWant: %v", test.model, test.batchSize, g, w)
+		}
+	}
+}
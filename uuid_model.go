@@ -0,0 +1,48 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UUIDBaseModel is a base model like gorm.Model with a string primary key
+// that is generated by Spanner. AutoMigrate creates the primary key column
+// with DEFAULT (GENERATE_UUID()). The primary key is left out of INSERT
+// statements if it is empty, and the generated value is read back with THEN
+// RETURN.
+//
+// Use the tag `gorm:"primaryKey;type:STRING(36);default:GENERATE_UUID()"` to
+// generate the value of other string fields in the same way.
+//
+// Example:
+//
+//	type Singer struct {
+//	  spannergorm.UUIDBaseModel
+//	  Name string
+//	}
+//
+//	singer := Singer{Name: "Alice"}
+//	// INSERT INTO `singers` (`created_at`,`updated_at`,`deleted_at`,`name`) VALUES (...) THEN RETURN `id`
+//	db.Create(&singer)
+//	fmt.Println(singer.ID)
+type UUIDBaseModel struct {
+	ID        string `gorm:"primaryKey;type:STRING(36);default:GENERATE_UUID()"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type uuidSinger struct {
+	UUIDBaseModel
+	Name string
+}
+
+func TestUUIDBaseModelCreateTable(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	operation := &longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{operation, operation})
+
+	if err := db.Migrator().CreateTable(&uuidSinger{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 2; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	request := requests[0].(*databasepb.UpdateDatabaseDdlRequest)
+	if g, w := request.GetStatements()[0],
+		"CREATE TABLE `uuid_singers` (`id` STRING(36) DEFAULT (GENERATE_UUID()),`created_at` TIMESTAMP,`updated_at` TIMESTAMP,`deleted_at` TIMESTAMP,`name` STRING(MAX)) "+
+			"PRIMARY KEY (`id`)"; g != w {
+		t.Fatalf("create table statement mismatch\n Got: %s\nWant: %s", g, w)
+	}
+}
+
+func TestUUIDBaseModelCreate(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	insertSql := "INSERT INTO `uuid_singers` (`created_at`,`updated_at`,`deleted_at`,`name`) VALUES (@p1,@p2,@p3,@p4) THEN RETURN `id`"
+	_ = server.TestSpanner.PutStatementResult(insertSql, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &spannerpb.ResultSet{
+			Metadata: &spannerpb.ResultSetMetadata{
+				RowType: &spannerpb.StructType{
+					Fields: []*spannerpb.StructType_Field{
+						{Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}, Name: "id"},
+					},
+				},
+			},
+			Rows: []*structpb.ListValue{
+				{Values: []*structpb.Value{
+					{Kind: &structpb.Value_StringValue{StringValue: "a3a6b2f4-3c52-4e5a-9d7e-1f3a4b5c6d7e"}},
+				}},
+			},
+		},
+	})
+
+	singer := uuidSinger{Name: "Alice"}
+	if err := db.Create(&singer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if g, w := getLastSql(server), insertSql; g != w {
+		t.Fatalf("insert sql mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := singer.ID, "a3a6b2f4-3c52-4e5a-9d7e-1f3a4b5c6d7e"; g != w {
+		t.Fatalf("id mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ModelError is returned by AutoMigrate when a model uses a tag or a type that
+// is not supported by Spanner. It identifies the model and the field, and
+// contains a suggestion for how to fix the problem.
+type ModelError struct {
+	// Model is the name of the model.
+	Model string
+	// Field is the name of the field, or empty if the problem is not caused by
+	// a single field.
+	Field string
+	// Problem describes what is not supported.
+	Problem string
+	// Suggestion describes how the problem can be fixed.
+	Suggestion string
+}
+
+func (e *ModelError) Error() string {
+	name := e.Model
+	if e.Field != "" {
+		name += "." + e.Field
+	}
+	return fmt.Sprintf("%s: %s. %s", name, e.Problem, e.Suggestion)
+}
+
+// spannerTypeRegExp matches the column types that are supported by Spanner.
+// The type may be followed by additional column options.
+var spannerTypeRegExp = regexp.MustCompile(`(?i)^\s*(BOOL|INT64|FLOAT32|FLOAT64|NUMERIC|DATE|TIMESTAMP|JSON|TOKENLIST|STRING\(\s*(MAX|\d+)\s*\)|BYTES\(\s*(MAX|\d+)\s*\)|ARRAY<.+>|STRUCT<.+>|PROTO<.+>|ENUM<.+>)(\s|$)`)
+
+// spannerTypeSuggestions contains the Spanner types that should be used
+// instead of common types of other databases.
+var spannerTypeSuggestions = map[string]string{
+	"bigint":      "INT64",
+	"boolean":     "BOOL",
+	"bytea":       "BYTES(MAX)",
+	"blob":        "BYTES(MAX)",
+	"char":        "STRING(n)",
+	"datetime":    "TIMESTAMP",
+	"decimal":     "NUMERIC",
+	"double":      "FLOAT64",
+	"float":       "FLOAT64",
+	"int":         "INT64",
+	"integer":     "INT64",
+	"jsonb":       "JSON",
+	"real":        "FLOAT32",
+	"serial":      "INT64 with an autoIncrement tag",
+	"bigserial":   "INT64 with an autoIncrement tag",
+	"smallint":    "INT64",
+	"text":        "STRING(MAX)",
+	"timestamptz": "TIMESTAMP",
+	"uuid":        "STRING(36)",
+	"varchar":     "STRING(n)",
+}
+
+// validateModels checks that the given models only use tags and types that are
+// supported by Spanner, and returns a *ModelError for each problem that is
+// found.
+func (m spannerMigrator) validateModels(values ...interface{}) error {
+	var errs []error
+	for _, value := range values {
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			errs = append(errs, m.validateSchema(stmt.Schema)...)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m spannerMigrator) validateSchema(s *schema.Schema) []error {
+	if s == nil {
+		return nil
+	}
+	var errs []error
+	if len(s.PrimaryFields) == 0 {
+		errs = append(errs, &ModelError{
+			Model:      s.Name,
+			Problem:    "the model has no primary key, and Spanner requires all tables to have a primary key",
+			Suggestion: "Add an ID field, or add a `gorm:\"primaryKey\"` tag to the fields that form the primary key",
+		})
+	}
+	if _, err := interleaveOf(s); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := rowDeletionPolicyOf(s); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, m.validateForeignKeys(s)...)
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.IgnoreMigration {
+			continue
+		}
+		if field.AutoIncrement {
+			if field.DataType != schema.Int && field.DataType != schema.Uint {
+				errs = append(errs, &ModelError{
+					Model:      s.Name,
+					Field:      field.Name,
+					Problem:    fmt.Sprintf("autoIncrement is only supported for INT64 columns, but the field has type %s", m.Migrator.DataTypeOf(field)),
+					Suggestion: "Remove the autoIncrement tag, or change the type of the field to an integer type",
+				})
+			}
+			if isGeneratedIdentity(field) {
+				if m.Dialector.Config.IdentityMode == IdentityModeUUID {
+					errs = append(errs, &ModelError{
+						Model:      s.Name,
+						Field:      field.Name,
+						Problem:    "autoIncrement is not supported with IdentityModeUUID",
+						Suggestion: "Use a string primary key with `gorm:\"primaryKey;type:STRING(36);default:GENERATE_UUID()\"`, for example by embedding spannergorm.UUIDBaseModel",
+					})
+				} else if _, err := sequenceOptionsOf(field); err != nil {
+					errs = append(errs, &ModelError{
+						Model:      s.Name,
+						Field:      field.Name,
+						Problem:    err.Error(),
+						Suggestion: "Use `gorm_sequence_skip_range:\"<min>,<max>\"` and `gorm_sequence_start_counter:\"<n>\"`",
+					})
+				}
+			}
+			if field.AutoIncrementIncrement > 1 {
+				errs = append(errs, &ModelError{
+					Model:      s.Name,
+					Field:      field.Name,
+					Problem:    "autoIncrementIncrement is not supported, as Spanner generates primary key values with bit-reversed sequences",
+					Suggestion: "Remove the autoIncrementIncrement tag",
+				})
+			}
+		}
+		if _, ok := field.TagSettings[caseInsensitiveIndexTag]; ok && field.DataType != schema.String {
+			errs = append(errs, &ModelError{
+				Model:      s.Name,
+				Field:      field.Name,
+				Problem:    "caseInsensitiveIndex is only supported for STRING columns",
+				Suggestion: "Remove the caseInsensitiveIndex tag, or change the type of the field to string",
+			})
+		}
+		if field.DataType == "" {
+			continue
+		}
+		dataType := m.Migrator.DataTypeOf(field)
+		if !spannerTypeRegExp.MatchString(dataType) {
+			suggestion := "Use a Spanner type, such as INT64, STRING(MAX) or TIMESTAMP, in the type tag, or remove the type tag"
+			base := strings.ToLower(strings.TrimSpace(dataType))
+			if i := strings.IndexAny(base, "( "); i > -1 {
+				base = base[:i]
+			}
+			if alternative, ok := spannerTypeSuggestions[base]; ok {
+				suggestion = fmt.Sprintf("Use %s instead", alternative)
+			}
+			errs = append(errs, &ModelError{
+				Model:      s.Name,
+				Field:      field.Name,
+				Problem:    fmt.Sprintf("type %s is not supported by Spanner", dataType),
+				Suggestion: suggestion,
+			})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type unsupportedModel struct {
+	Code    string `gorm:"primaryKey;type:varchar(100)"`
+	Counter string `gorm:"autoIncrement"`
+	Payload string `gorm:"type:jsonb"`
+	Name    string `gorm:"type:STRING(100)"`
+	Age     int64  `gorm:"caseInsensitiveIndex"`
+}
+
+type modelWithoutPrimaryKey struct {
+	Name string
+}
+
+func TestAutoMigrateValidation(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+
+	err := db.Migrator().AutoMigrate(&unsupportedModel{}, &modelWithoutPrimaryKey{})
+	if err == nil {
+		t.Fatal("missing expected validation error")
+	}
+	var modelErr *ModelError
+	if !errors.As(err, &modelErr) {
+		t.Fatalf("error mismatch\n Got: %v\nWant: %T", err, modelErr)
+	}
+	for _, want := range []string{
+		"unsupportedModel.Code: type varchar(100) is not supported by Spanner. Use STRING(n) instead",
+		"unsupportedModel.Counter: autoIncrement is only supported for INT64 columns",
+		"unsupportedModel.Payload: type jsonb is not supported by Spanner. Use JSON instead",
+		"unsupportedModel.Age: caseInsensitiveIndex is only supported for STRING columns",
+		"modelWithoutPrimaryKey: the model has no primary key",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error does not contain %q:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "unsupportedModel.Name") {
+		t.Fatalf("unexpected error for supported type:\n%v", err)
+	}
+	// No DDL statements should have been executed.
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 0; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
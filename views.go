@@ -0,0 +1,170 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ViewModel can be implemented by models that are backed by a view instead
+// of a table. AutoMigrate creates the view with the query that is returned by
+// ViewQuery, and replaces the view if the query has changed. Create, Update and
+// Delete operations on the model fail with a *ReadOnlyViewError.
+//
+// Spanner requires views to use SQL SECURITY INVOKER, and the columns of the
+// query must have names. Example:
+//
+//	type SingerAlbumCount struct {
+//	  SingerID   int64
+//	  AlbumCount int64
+//	}
+//
+//	func (SingerAlbumCount) ViewQuery() string {
+//	  return "SELECT singer_id, COUNT(*) AS album_count FROM albums GROUP BY singer_id"
+//	}
+type ViewModel interface {
+	ViewQuery() string
+}
+
+// ReadOnlyViewError is returned for Create, Update and Delete operations on
+// models that implement ViewModel.
+type ReadOnlyViewError struct {
+	// Model is the name of the model.
+	Model string
+	// View is the name of the view.
+	View string
+	// Operation is the type of operation: create, update or delete.
+	Operation string
+}
+
+func (e *ReadOnlyViewError) Error() string {
+	return fmt.Sprintf("cannot %s %s: the model is backed by the read-only view %s", e.Operation, e.Model, e.View)
+}
+
+// viewQueryOf returns the query of the view of the given schema, and false if
+// the model of the schema does not implement ViewModel.
+func viewQueryOf(s *schema.Schema) (string, bool) {
+	if s == nil || s.ModelType == nil {
+		return "", false
+	}
+	view, ok := reflect.New(s.ModelType).Interface().(ViewModel)
+	if !ok {
+		return "", false
+	}
+	return view.ViewQuery(), true
+}
+
+// registerReadOnlyViewCallbacks registers callbacks that reject Create, Update
+// and Delete operations on models that implement ViewModel.
+func registerReadOnlyViewCallbacks(db *gorm.DB) error {
+	reject := func(operation string) func(db *gorm.DB) {
+		return func(db *gorm.DB) {
+			if db.Error != nil {
+				return
+			}
+			if _, ok := viewQueryOf(db.Statement.Schema); ok {
+				db.AddError(&ReadOnlyViewError{Model: db.Statement.Schema.Name, View: db.Statement.Table, Operation: operation})
+			}
+		}
+	}
+	if err := db.Callback().Create().Before("*").Register("gorm:spanner:read_only_view", reject("create")); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("*").Register("gorm:spanner:read_only_view", reject("update")); err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("*").Register("gorm:spanner:read_only_view", reject("delete"))
+}
+
+// splitViewModels returns the models of the given values that are backed by
+// tables, and the models that are backed by views.
+func (m spannerMigrator) splitViewModels(values []interface{}) (tables, views []interface{}, err error) {
+	for _, value := range values {
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			if _, ok := viewQueryOf(stmt.Schema); ok {
+				views = append(views, value)
+			} else {
+				tables = append(tables, value)
+			}
+			return nil
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tables, views, nil
+}
+
+// migrateViews creates the views of the given models, and replaces the views
+// whose query has changed.
+func (m spannerMigrator) migrateViews(values []interface{}) error {
+	for _, value := range values {
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			query, _ := viewQueryOf(stmt.Schema)
+			query = strings.TrimSpace(query)
+			var definition string
+			tableSchema, table := m.tableSchemaAndName(qualifiedTableName(stmt))
+			err := m.DB.Raw(
+				"SELECT VIEW_DEFINITION FROM INFORMATION_SCHEMA.VIEWS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+				tableSchema, table,
+			).Row().Scan(&definition)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if err == nil && strings.TrimSpace(definition) == query {
+				return nil
+			}
+			// The query is added as-is to the statement, so question marks and
+			// named parameters in the query are not replaced with bind vars.
+			b := new(strings.Builder)
+			b.WriteString("CREATE OR REPLACE VIEW ")
+			m.QuoteTo(b, qualifiedTableName(stmt))
+			b.WriteString(" SQL SECURITY INVOKER AS ")
+			b.WriteString(query)
+			return m.DB.Exec(b.String()).Error
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateView creates a view with the given query. Spanner requires views to
+// use SQL SECURITY INVOKER, which is added to the statement. Spanner does not
+// support check options.
+func (m spannerMigrator) CreateView(name string, option gorm.ViewOption) error {
+	if option.Query == nil {
+		return gorm.ErrSubQueryRequired
+	}
+	if option.CheckOption != "" {
+		return fmt.Errorf("spanner does not support view check options: %s", option.CheckOption)
+	}
+	b := new(strings.Builder)
+	b.WriteString("CREATE ")
+	if option.Replace {
+		b.WriteString("OR REPLACE ")
+	}
+	b.WriteString("VIEW ")
+	m.QuoteTo(b, name)
+	b.WriteString(" SQL SECURITY INVOKER AS ")
+	m.DB.Statement.AddVar(b, option.Query)
+	return m.DB.Exec(m.Explain(b.String(), m.DB.Statement.Vars...)).Error
+}
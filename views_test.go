@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type singerAlbumCount struct {
+	SingerID   int64
+	AlbumCount int64
+}
+
+func (singerAlbumCount) ViewQuery() string {
+	return "SELECT singer_id, COUNT(*) AS album_count FROM albums GROUP BY singer_id"
+}
+
+type singerMark struct {
+	SingerID int64
+	Mark     string
+}
+
+func (singerMark) TableName() string {
+	return "reporting.singer_marks"
+}
+
+func (singerMark) ViewQuery() string {
+	return "SELECT singer_id, '?' AS mark FROM singers WHERE nickname != '@name'"
+}
+
+func TestReadOnlyView(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	drainRequestsFromServer(server.TestSpanner)
+
+	for _, test := range []struct {
+		operation string
+		err       error
+	}{
+		{"create", db.Create(&singerAlbumCount{SingerID: 1}).Error},
+		{"update", db.Model(&singerAlbumCount{}).Where("singer_id = ?", 1).Update("album_count", 2).Error},
+		{"delete", db.Where("singer_id = ?", 1).Delete(&singerAlbumCount{}).Error},
+	} {
+		var viewErr *ReadOnlyViewError
+		if !errors.As(test.err, &viewErr) {
+			t.Fatalf("%s: error mismatch\n Got: %v\nWant: %T", test.operation, test.err, viewErr)
+		}
+		if g, w := *viewErr, (ReadOnlyViewError{Model: "singerAlbumCount", View: "singer_album_counts", Operation: test.operation}); g != w {
+			t.Fatalf("%s: error mismatch\n Got: %+v\nWant: %+v", test.operation, g, w)
+		}
+	}
+	if g, w := len(requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&spannerpb.ExecuteSqlRequest{}))), 0; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigrateView(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	viewSql := "SELECT VIEW_DEFINITION FROM INFORMATION_SCHEMA.VIEWS WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2"
+	putViewDefinition := func(definitions ...string) {
+		rows := make([]*structpb.ListValue, len(definitions))
+		for i, definition := range definitions {
+			rows[i] = &structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue(definition)}}
+		}
+		_ = server.TestSpanner.PutStatementResult(viewSql, &testutil.StatementResult{
+			Type: testutil.StatementResultResultSet,
+			ResultSet: &spannerpb.ResultSet{
+				Metadata: &spannerpb.ResultSetMetadata{RowType: &spannerpb.StructType{Fields: []*spannerpb.StructType_Field{
+					{Name: "VIEW_DEFINITION", Type: &spannerpb.Type{Code: spannerpb.TypeCode_STRING}},
+				}}},
+				Rows: rows,
+			},
+		})
+	}
+
+	// The view does not exist.
+	putViewDefinition()
+	if err := db.Migrator().AutoMigrate(&singerAlbumCount{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE OR REPLACE VIEW `singer_album_counts` SQL SECURITY INVOKER AS SELECT singer_id, COUNT(*) AS album_count FROM albums GROUP BY singer_id",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// The view exists with the same query.
+	putViewDefinition(singerAlbumCount{}.ViewQuery())
+	if err := db.Migrator().AutoMigrate(&singerAlbumCount{}); err != nil {
+		t.Fatal(err)
+	}
+	if g, w := len(server.TestDatabaseAdmin.Reqs()), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMigrateViewWithPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestGormConnection(t)
+	defer teardown()
+	anyProto, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestDatabaseAdmin.SetResps([]proto.Message{&longrunningpb.Operation{
+		Name:   "test-operation",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: anyProto},
+	}})
+	_ = putStringRowsResult(server, "SELECT VIEW_DEFINITION FROM INFORMATION_SCHEMA.VIEWS WHERE TABLE_SCHEMA = @p1 AND TABLE_NAME = @p2",
+		[]string{"VIEW_DEFINITION"}, nil)
+
+	if err := db.Migrator().AutoMigrate(&singerMark{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	if g, w := requests[0].(*databasepb.UpdateDatabaseDdlRequest).GetStatements(), []string{
+		"CREATE OR REPLACE VIEW `reporting`.`singer_marks` SQL SECURITY INVOKER AS SELECT singer_id, '?' AS mark FROM singers WHERE nickname != '@name'",
+	}; !reflect.DeepEqual(g, w) {
+		t.Fatalf("DDL mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}